@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"runtime"
 
@@ -50,11 +49,11 @@ var addHeaderCmd = &cobra.Command{
 			}
 		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -0,0 +1,364 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/util/stringutil"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// aggCmd represents the agg command
+var aggCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:     "agg",
+	Aliases: []string{"aggregate"},
+	Short:   "grouped aggregation with multiple named outputs",
+	Long: `grouped aggregation with multiple named outputs
+
+Records are grouped by -g/--groups, and each aggregation in -e/--expr
+outputs a column, named by "as <name>" or the aggregation itself.
+Groups are outputted in the order of their first appearance.
+
+    csvtk agg -g country,year \
+        -e 'sum(sales) as total, mean(price) as avg_price, countunique(customer)'
+
+Columns are given by names or field numbers. Without -g/--groups,
+all records are aggregated into one row.
+
+Available aggregations:
+
+  # numeric/statistical operations
+  countn (count numeric values), min, max, sum, argmin, argmax,
+  mean, stdev/std, variance, median, q1, q2, q3,
+  quantile(column, p) with p in [0, 1], e.g., quantile(price, 0.9),
+  entropy (Shannon entropy),
+  prod (product of the elements)
+
+  # textual/numeric operations
+  count, first, last, rand, unique/uniq, collapse, countunique
+  count(*) or count() counts records.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		groupsStr := getFlagString(cmd, "groups")
+		exprStr := getFlagString(cmd, "expr")
+		if exprStr == "" {
+			checkError(fmt.Errorf("flag -e/--expr needed"))
+		}
+		aggs, err := parseAggExprs(exprStr)
+		checkError(err)
+
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+		separater = getFlagString(cmd, "separater")
+		statsRand = rand.New(rand.NewSource(getFlagInt64(cmd, "rand-seed")))
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk agg: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		var groupFields []int
+		var dataFields []int         // unique fields of all aggregations
+		dataIdx := make(map[int]int) // field -> index in dataFields
+
+		data := make(map[string][][]string, 128) // group -> data field -> values
+		groupOrder := make(map[string]int, 128)
+		var group string
+		var i, f int
+		var ok bool
+		var values [][]string
+
+		groupValues := make(map[string][]string, 128) // group -> values of group fields
+		keyEncoder := &joinKeyEncoder{}
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header := record.All
+				if config.NoHeaderRow {
+					header = make([]string, len(record.All))
+				}
+				if groupsStr != "" {
+					groupFields = selectFieldsByHeader(header, groupsStr, false)
+				}
+				for _, a := range aggs {
+					if a.column == "" {
+						continue
+					}
+					fields := selectFieldsByHeader(header, a.column, false)
+					if len(fields) != 1 {
+						checkError(fmt.Errorf("only one column allowed in aggregation: %s", a.expr))
+					}
+					a.field = fields[0]
+					if _, ok = dataIdx[a.field]; !ok {
+						dataIdx[a.field] = len(dataFields)
+						dataFields = append(dataFields, a.field)
+					}
+				}
+
+				if !config.NoOutHeader {
+					items := make([]string, 0, len(groupFields)+len(aggs))
+					for _, f = range groupFields {
+						if config.NoHeaderRow {
+							items = append(items, fmt.Sprintf("%d", f))
+						} else {
+							items = append(items, header[f-1])
+						}
+					}
+					for _, a := range aggs {
+						items = append(items, a.name)
+					}
+					checkError(writer.Write(items))
+				}
+				if !config.NoHeaderRow {
+					continue
+				}
+			}
+
+			group, _ = keyEncoder.key(record.All, groupFields)
+
+			if values, ok = data[group]; !ok {
+				groupOrder[group] = record.Row
+				groupKey := make([]string, len(groupFields))
+				for i, f := range groupFields {
+					groupKey[i] = record.All[f-1]
+				}
+				groupValues[group] = groupKey
+				values = make([][]string, len(dataFields)+1)
+				data[group] = values
+			}
+			for i, f = range dataFields {
+				values[i] = append(values[i], record.All[f-1])
+			}
+			values[len(dataFields)] = append(values[len(dataFields)], "") // for counting records
+		}
+		readerReport(&config, csvReader, file)
+
+		var nums []float64
+		var v float64
+		for _, o := range stringutil.SortCountOfString(groupOrder, false) {
+			values = data[o.Key]
+			items := make([]string, 0, len(groupFields)+len(aggs))
+			items = append(items, groupValues[o.Key]...)
+
+			for _, a := range aggs {
+				if a.field == 0 { // count(*)
+					items = append(items, strconv.Itoa(len(values[len(dataFields)])))
+					continue
+				}
+				vals := values[dataIdx[a.field]]
+				if a.textual != nil {
+					items = append(items, a.textual(vals))
+					continue
+				}
+
+				nums = nums[:0]
+				for _, val := range vals {
+					if !reDigitals.MatchString(val) {
+						if ignore {
+							continue
+						}
+						checkError(fmt.Errorf("non-numeric value in %s: %s, you can use flag -i/--ignore-non-numbers to skip these data", a.expr, val))
+					}
+					v, err = strconv.ParseFloat(removeComma(val), 64)
+					checkError(err)
+					nums = append(nums, v)
+				}
+				if len(nums) == 0 {
+					items = append(items, "")
+					continue
+				}
+				switch a.op {
+				case "countn", "argmin", "argmax":
+					items = append(items, fmt.Sprintf("%.0f", a.numeric(nums)))
+				case "median", "q1", "q2", "q3", "quantile":
+					sort.Float64s(nums)
+					fallthrough
+				default:
+					items = append(items, fmt.Sprintf(decimalFormat, a.numeric(nums)))
+				}
+			}
+			checkError(writer.Write(items))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(aggCmd)
+
+	aggCmd.Flags().StringP("groups", "g", "", `group via fields. e.g -g 1,2 or -g columnA,columnB`)
+	aggCmd.Flags().StringP("expr", "e", "", `comma separated aggregations, e.g., 'sum(sales) as total, quantile(price, 0.9)'`)
+	aggCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore non-numeric values like "NA" or "N/A"`)
+	aggCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+	aggCmd.Flags().StringP("separater", "s", "; ", "separater for collapsed data")
+	aggCmd.Flags().Int64P("rand-seed", "S", 11, `rand seed for aggregation "rand"`)
+}
+
+// aggExpr is an aggregation like "sum(sales) as total".
+type aggExpr struct {
+	expr   string
+	op     string
+	column string
+	name   string
+	field  int // 1-based, 0 for counting records
+
+	numeric func([]float64) float64
+	textual func([]string) string
+}
+
+var reAggExpr = regexp.MustCompile(`(?is)^(\w+)\s*\((.*)\)(?:\s+as\s+(.+))?$`)
+
+// parseAggExprs parses comma separated aggregations.
+func parseAggExprs(s string) ([]*aggExpr, error) {
+	aggs := make([]*aggExpr, 0, 4)
+	var depth, start int
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		a, err := parseAggExpr(strings.TrimSpace(s[start:i]))
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, a)
+		start = i + 1
+	}
+	return aggs, nil
+}
+
+func parseAggExpr(s string) (*aggExpr, error) {
+	found := reAggExpr.FindStringSubmatch(s)
+	if found == nil {
+		return nil, fmt.Errorf(`invalid aggregation: "%s", it should be like "sum(column) as name"`, s)
+	}
+	a := &aggExpr{expr: s, op: strings.ToLower(found[1]), name: strings.TrimSpace(found[3])}
+	if a.name == "" {
+		a.name = s
+	}
+	args := strings.Split(found[2], ",")
+	a.column = strings.TrimSpace(args[0])
+
+	if a.op == "std" {
+		a.op = "stdev"
+	}
+	switch a.op {
+	case "quantile":
+		if len(args) != 2 {
+			return nil, fmt.Errorf(`invalid aggregation: "%s", it should be like "quantile(column, 0.9)"`, s)
+		}
+		p, err := strconv.ParseFloat(strings.TrimSpace(args[1]), 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf(`invalid quantile in "%s", it should be in [0, 1]`, s)
+		}
+		a.numeric = func(sorted []float64) float64 {
+			if p == 1 {
+				return sorted[len(sorted)-1]
+			}
+			return percentileValue(sorted, p)
+		}
+		return a, nil
+	case "count":
+		if a.column == "" || a.column == "*" {
+			a.column = ""
+		}
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf(`only one column allowed in aggregation: "%s"`, s)
+	}
+	if a.column == "" && a.op != "count" {
+		return nil, fmt.Errorf(`column needed in aggregation: "%s"`, s)
+	}
+
+	var ok bool
+	if a.numeric, ok = allStats[a.op]; ok {
+		return a, nil
+	}
+	if a.textual, ok = allStats2[a.op]; ok {
+		return a, nil
+	}
+	return nil, fmt.Errorf("unsupported aggregation: %s. available: %s, std, quantile", a.op, strings.Join(allStatsList, ", "))
+}
@@ -0,0 +1,445 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/araddon/dateparse"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// anonymizeCmd represents the anonymize command
+var anonymizeCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:     "anonymize",
+	Aliases: []string{"mask"},
+	Short:   "mask sensitive fields with hashing, fake values, date shifting and generalization",
+	Long: `mask sensitive fields with hashing, fake values, date shifting and generalization
+
+Rules (-r/--rule) are in the format of "column:method[:argument]",
+multiple rules supported. Methods:
+
+  hash[:N]           HMAC-SHA256 of the value with --salt, in N hex digits (default 16)
+  name               a fake full name
+  first-name         a fake first name
+  last-name          a fake last name
+  email              a fake email in the domain of example.com
+  phone              replace digits with random ones, keeping the format
+  mask               replace letters and digits with random ones, keeping the format
+  date-shift:N       shift dates by a random number of days in [-N, N]
+  date-shift:N:KEY   same as above, with the same shift for records of
+                     the same value of the KEY column, e.g., a patient ID
+  bucket:N           generalize numbers into intervals of width N, e.g., [20,30)
+  truncate:N         keep the first N characters, and replace others with "*"
+  redact[:TEXT]      replace with TEXT (default "*")
+
+All random values are derived from the values and the salt, so the
+same value is always masked to the same result with the same salt,
+which keeps joins between masked files working. Use a secret salt,
+otherwise hashes of common values could be reversed by brute force.
+
+k-anonymity: with -k/--k-anonymity K, values of generalized columns
+(quasi-identifiers, i.e., columns with methods bucket and truncate) in
+records whose combinations occur less than K times are suppressed with "*".
+
+Empty values are kept as they are.
+
+Examples:
+
+    csvtk anonymize --salt s3cret -r id:hash -r name:name -r email:email \
+        -r phone:phone -r dob:date-shift:30:id -r age:bucket:10 \
+        -r zip:truncate:3 -k 5 data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		ruleStrs := getFlagStringArray(cmd, "rule")
+		if len(ruleStrs) == 0 {
+			checkError(fmt.Errorf("flag -r (--rule) needed"))
+		}
+		salt := getFlagString(cmd, "salt")
+		k := getFlagNonNegativeInt(cmd, "k-anonymity")
+
+		rules := make([]*anonymizeRule, 0, len(ruleStrs))
+		for _, s := range ruleStrs {
+			rule, err := parseAnonymizeRule(s)
+			checkError(err)
+			rules = append(rules, rule)
+		}
+		if k > 0 {
+			var hasQI bool
+			for _, rule := range rules {
+				if rule.generalize() {
+					hasQI = true
+					break
+				}
+			}
+			if !hasQI {
+				checkError(fmt.Errorf("flag -k/--k-anonymity needs at least one rule of bucket or truncate"))
+			}
+		}
+		m := &anonymizer{key: []byte(salt)}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk anonymize: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		records := make([][]string, 0, 1024) // only for k-anonymity
+		var orig []string
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header := record.All
+				if config.NoHeaderRow {
+					header = make([]string, len(record.All))
+				}
+				for _, rule := range rules {
+					rule.field = anonymizeField(header, rule.column)
+					if rule.keyColumn != "" {
+						rule.keyField = anonymizeField(header, rule.keyColumn)
+					}
+				}
+
+				if !config.NoHeaderRow {
+					if !config.NoOutHeader {
+						checkError(writer.Write(record.All))
+					}
+					continue
+				}
+			}
+
+			// key columns of date shifting might be masked by other rules
+			orig = append(orig[:0], record.All...)
+			for _, rule := range rules {
+				if orig[rule.field-1] == "" {
+					continue
+				}
+				record.All[rule.field-1], err = m.apply(rule, orig)
+				if err != nil {
+					checkError(fmt.Errorf("[line %d] %s", record.Line, err))
+				}
+			}
+
+			if k > 0 {
+				records = append(records, record.All)
+				continue
+			}
+			checkError(writer.Write(record.All))
+		}
+		readerReport(&config, csvReader, file)
+
+		if k == 0 {
+			return
+		}
+
+		// k-anonymity
+		qiFields := make([]int, 0, len(rules))
+		for _, rule := range rules {
+			if rule.generalize() {
+				qiFields = append(qiFields, rule.field)
+			}
+		}
+		counts := make(map[string]int, 1024)
+		keys := make([]string, len(records))
+		items := make([]string, len(qiFields))
+		for i, record := range records {
+			for j, f := range qiFields {
+				items[j] = record[f-1]
+			}
+			keys[i] = strings.Join(items, "_shenwei356_")
+			counts[keys[i]]++
+		}
+		var nSuppressed int
+		for i, record := range records {
+			if counts[keys[i]] < k {
+				nSuppressed++
+				for _, f := range qiFields {
+					record[f-1] = "*"
+				}
+			}
+			checkError(writer.Write(record))
+		}
+		if nSuppressed > 0 && config.Verbose {
+			log.Infof("quasi-identifiers of %d record(s) suppressed for %d-anonymity", nSuppressed, k)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(anonymizeCmd)
+
+	anonymizeCmd.Flags().StringArrayP("rule", "r", []string{}, `masking rule in the format of "column:method[:argument]", multiple values supported. type "csvtk anonymize -h" for details`)
+	anonymizeCmd.Flags().StringP("salt", "s", "", `secret salt for hashing and random values`)
+	anonymizeCmd.Flags().IntP("k-anonymity", "k", 0, `suppress generalized values of records whose combinations occur less than K times`)
+}
+
+func anonymizeField(header []string, column string) int {
+	fields := selectFieldsByHeader(header, column, false)
+	if len(fields) != 1 {
+		checkError(fmt.Errorf("only one column allowed in a rule: %s", column))
+	}
+	return fields[0]
+}
+
+// anonymizeRule is a masking rule like "age:bucket:10".
+type anonymizeRule struct {
+	column string
+	field  int
+	method string
+
+	n         int
+	text      string
+	keyColumn string
+	keyField  int
+}
+
+func (r *anonymizeRule) generalize() bool {
+	return r.method == "bucket" || r.method == "truncate"
+}
+
+func parseAnonymizeRule(s string) (*anonymizeRule, error) {
+	items := strings.Split(s, ":")
+	if len(items) < 2 || items[0] == "" {
+		return nil, fmt.Errorf(`invalid rule: %s, the format is "column:method[:argument]"`, s)
+	}
+	rule := &anonymizeRule{column: items[0], method: strings.ToLower(items[1])}
+	args := items[2:]
+
+	parseN := func(def int, required bool) error {
+		if len(args) == 0 {
+			if required {
+				return fmt.Errorf("argument needed for method %s: %s", rule.method, s)
+			}
+			rule.n = def
+			return nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("positive integer needed for method %s: %s", rule.method, s)
+		}
+		rule.n = n
+		return nil
+	}
+
+	var err error
+	switch rule.method {
+	case "hash":
+		err = parseN(16, false)
+		if err == nil && rule.n > 64 {
+			rule.n = 64
+		}
+	case "name", "first-name", "last-name", "email", "phone", "mask":
+		if len(args) > 0 {
+			err = fmt.Errorf("no argument needed for method %s: %s", rule.method, s)
+		}
+	case "date-shift":
+		err = parseN(0, true)
+		if len(args) > 1 {
+			rule.keyColumn = strings.Join(args[1:], ":")
+		}
+	case "bucket", "truncate":
+		err = parseN(0, true)
+	case "redact":
+		rule.text = "*"
+		if len(args) > 0 {
+			rule.text = strings.Join(args, ":")
+		}
+	default:
+		err = fmt.Errorf("invalid method in rule: %s. available: hash, name, first-name, last-name, email, phone, mask, date-shift, bucket, truncate, redact", s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// anonymizer masks values with HMAC-SHA256 of a salt as the source of
+// deterministic randomness.
+type anonymizer struct {
+	key []byte
+}
+
+func (m *anonymizer) sum(method, value string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// uint returns a deterministic random number of the value.
+func (m *anonymizer) uint(method, value string) uint64 {
+	return binary.BigEndian.Uint64(m.sum(method, value))
+}
+
+func (m *anonymizer) apply(rule *anonymizeRule, record []string) (string, error) {
+	val := record[rule.field-1]
+	switch rule.method {
+	case "hash":
+		return hex.EncodeToString(m.sum("hash", val))[:rule.n], nil
+	case "name":
+		return m.pick("first-name", val, fakeFirstNames) + " " + m.pick("last-name", val, fakeLastNames), nil
+	case "first-name":
+		return m.pick("first-name", val, fakeFirstNames), nil
+	case "last-name":
+		return m.pick("last-name", val, fakeLastNames), nil
+	case "email":
+		return fmt.Sprintf("%s.%s%d@example.com",
+			strings.ToLower(m.pick("first-name", val, fakeFirstNames)),
+			strings.ToLower(m.pick("last-name", val, fakeLastNames)),
+			m.uint("email", val)%100), nil
+	case "phone":
+		return m.mask(val, false), nil
+	case "mask":
+		return m.mask(val, true), nil
+	case "date-shift":
+		t, err := dateparse.ParseLocal(val)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse date: %s", val)
+		}
+		layout, err := dateparse.ParseFormat(val)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse date: %s", val)
+		}
+		key := ""
+		if rule.keyField > 0 {
+			key = record[rule.keyField-1]
+		}
+		days := int(m.uint("date-shift", key)%uint64(2*rule.n+1)) - rule.n
+		return t.AddDate(0, 0, days).Format(layout), nil
+	case "bucket":
+		v, err := strconv.ParseFloat(removeComma(val), 64)
+		if err != nil {
+			return "", fmt.Errorf("non-numeric value for method bucket: %s", val)
+		}
+		start := math.Floor(v/float64(rule.n)) * float64(rule.n)
+		return fmt.Sprintf("[%s,%s)", strconv.FormatFloat(start, 'f', -1, 64),
+			strconv.FormatFloat(start+float64(rule.n), 'f', -1, 64)), nil
+	case "truncate":
+		runes := []rune(val)
+		if len(runes) <= rule.n {
+			return val, nil
+		}
+		return string(runes[:rule.n]) + strings.Repeat("*", len(runes)-rule.n), nil
+	case "redact":
+		return rule.text, nil
+	}
+	return val, nil
+}
+
+func (m *anonymizer) pick(method, value string, list []string) string {
+	return list[m.uint(method, value)%uint64(len(list))]
+}
+
+// mask replaces digits (and letters if letters is true) with random ones,
+// keeping other characters.
+func (m *anonymizer) mask(value string, letters bool) string {
+	sum := m.sum("mask", value)
+	var buf strings.Builder
+	var b byte
+	for i, c := range value {
+		b = sum[i%len(sum)] ^ byte(i/len(sum))
+		switch {
+		case c >= '0' && c <= '9':
+			buf.WriteByte('0' + b%10)
+		case letters && c >= 'a' && c <= 'z':
+			buf.WriteByte('a' + b%26)
+		case letters && c >= 'A' && c <= 'Z':
+			buf.WriteByte('A' + b%26)
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
+var fakeFirstNames = []string{
+	"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda",
+	"William", "Elizabeth", "David", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+	"Thomas", "Sarah", "Charles", "Karen", "Daniel", "Nancy", "Matthew", "Lisa",
+	"Anthony", "Betty", "Mark", "Margaret", "Paul", "Sandra", "Steven", "Ashley",
+	"Andrew", "Emily", "Kenneth", "Donna", "Joshua", "Michelle", "Kevin", "Carol",
+	"Wei", "Yan", "Li", "Ming", "Ana", "Luis", "Sofia", "Mateo", "Amir", "Fatima",
+}
+
+var fakeLastNames = []string{
+	"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+	"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
+	"Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
+	"Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson", "Walker", "Young",
+	"Allen", "King", "Wright", "Scott", "Torres", "Nguyen", "Hill", "Flores",
+	"Wang", "Zhang", "Chen", "Liu", "Kim", "Park", "Singh", "Kumar", "Mueller", "Rossi",
+}
@@ -0,0 +1,290 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/spf13/cobra"
+)
+
+// arrow2csvCmd represents the arrow2csv command
+var arrow2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "arrow2csv",
+	Short: "convert Arrow IPC stream/file (Feather V2) to CSV format",
+	Long: `convert Arrow IPC stream/file (Feather V2) to CSV format
+
+Notes:
+  1. Both the IPC stream format and the IPC file format (Feather V2) are
+     supported, which are detected automatically.
+  2. Record batches of IPC streams are converted one by one, so the input
+     could be an endless stream from stdin. While the whole file is loaded
+     into memory for IPC files from stdin or http(s) URLs.
+  3. Null values are converted to empty strings, or the value of --na.
+  4. All commands can read Arrow data directly with the global flag
+     "--in-format arrow".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		na := getFlagString(cmd, "na")
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := !config.NoOutHeader
+		var record []string
+		for _, file := range files {
+			source, err := newArrowIPCSource(file, na)
+			checkError(err)
+
+			if printHeaderRow {
+				checkError(writer.Write(source.colnames))
+				printHeaderRow = false // only print the header row of the first file
+			}
+			for {
+				record, err = source.Read()
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+				checkError(writer.Write(record))
+			}
+			checkError(source.Close())
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(arrow2csvCmd)
+	arrow2csvCmd.Flags().StringP("na", "", "", `content for null values`)
+}
+
+// arrowSource reads rows from Arrow record batches.
+type arrowSource struct {
+	file     string
+	colnames []string
+	na       string
+
+	reader array.RecordReader
+	close  func() error
+
+	rec    arrow.Record // current record batch
+	i      int          // index of the next row in rec
+	record []string
+}
+
+func newArrowSource(file string, na string, reader array.RecordReader, close func() error) *arrowSource {
+	s := &arrowSource{file: file, na: na, reader: reader, close: close}
+	schema := reader.Schema()
+	s.colnames = make([]string, schema.NumFields())
+	for i, f := range schema.Fields() {
+		s.colnames[i] = f.Name
+	}
+	s.record = make([]string, len(s.colnames))
+	return s
+}
+
+// Read returns the next row. The returned slice is reused.
+func (s *arrowSource) Read() ([]string, error) {
+	for s.rec == nil || s.i >= int(s.rec.NumRows()) {
+		if !s.reader.Next() {
+			if err := s.reader.Err(); err != nil && err != io.EOF {
+				return nil, fmt.Errorf("failed to read file %s: %s", s.file, err)
+			}
+			return nil, io.EOF
+		}
+		s.rec = s.reader.Record()
+		s.i = 0
+	}
+
+	for j, col := range s.rec.Columns() {
+		s.record[j] = arrowValue2String(col, s.i, s.na)
+	}
+	s.i++
+	return s.record, nil
+}
+
+func (s *arrowSource) Close() error {
+	if s.reader != nil {
+		s.reader.Release()
+		s.reader = nil
+	}
+	if s.close != nil {
+		err := s.close()
+		s.close = nil
+		return err
+	}
+	return nil
+}
+
+// arrowValue2String formats the i-th value of an Arrow array.
+func arrowValue2String(col arrow.Array, i int, na string) string {
+	if col.IsNull(i) {
+		return na
+	}
+	switch col := col.(type) {
+	case *array.String:
+		return col.Value(i)
+	case *array.LargeString:
+		return col.Value(i)
+	case *array.Float64:
+		return strconv.FormatFloat(col.Value(i), 'f', -1, 64)
+	case *array.Float32:
+		return strconv.FormatFloat(float64(col.Value(i)), 'f', -1, 32)
+	}
+	return col.ValueStr(i)
+}
+
+// newArrowIPCSource creates a source of records from an Arrow IPC stream or file.
+func newArrowIPCSource(file string, na string) (*arrowSource, error) {
+	var fh io.ReadCloser
+	var err error
+	if isStdin(file) || isURL(file) || inCompressed() {
+		fh, err = ropenRaw(file)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fh, err = os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	br := bufio.NewReaderSize(fh, 1<<16)
+	magic, _ := br.Peek(len(ipc.Magic))
+	if !bytes.Equal(magic, ipc.Magic) { // IPC stream
+		reader, err := ipc.NewReader(br)
+		if err != nil {
+			fh.Close()
+			return nil, fmt.Errorf("failed to read Arrow IPC stream %s: %s", file, err)
+		}
+		return newArrowSource(file, na, reader, fh.Close), nil
+	}
+
+	// IPC file
+	var r ipc.ReadAtSeeker
+	if f, ok := fh.(*os.File); ok && !isStdin(file) {
+		r = f
+	} else {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	fr, err := ipc.NewFileReader(r)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("failed to read Arrow IPC file %s: %s", file, err)
+	}
+	return newArrowSource(file, na, &arrowFileRecordReader{fr: fr}, func() error {
+		fr.Close()
+		return fh.Close()
+	}), nil
+}
+
+// arrowFileRecordReader makes ipc.FileReader an array.RecordReader.
+type arrowFileRecordReader struct {
+	fr  *ipc.FileReader
+	i   int
+	rec arrow.Record
+	err error
+}
+
+func (r *arrowFileRecordReader) Retain()               {}
+func (r *arrowFileRecordReader) Release()              {}
+func (r *arrowFileRecordReader) Schema() *arrow.Schema { return r.fr.Schema() }
+func (r *arrowFileRecordReader) Record() arrow.Record  { return r.rec }
+func (r *arrowFileRecordReader) Err() error            { return r.err }
+func (r *arrowFileRecordReader) Next() bool {
+	if r.err != nil || r.i >= r.fr.NumRecords() {
+		return false
+	}
+	r.rec, r.err = r.fr.Record(r.i)
+	r.i++
+	return r.err == nil
+}
+
+// arrowRecordSource wraps arrowSource to emit the header row first,
+// and it's used by CSVReader.
+type arrowRecordSource struct {
+	*arrowSource
+	headerRow []string
+}
+
+func (s *arrowRecordSource) Read() ([]string, error) {
+	if s.headerRow != nil {
+		record := s.headerRow
+		s.headerRow = nil
+		return record, nil
+	}
+	record, err := s.arrowSource.Read()
+	if err != nil {
+		return nil, err
+	}
+	// records are sent to a channel, so they can not be reused
+	record2 := make([]string, len(record))
+	copy(record2, record)
+	return record2, nil
+}
+
+// newArrowCSVReader creates a CSVReader reading from an arrowSource,
+// where column names are returned as the header row.
+func newArrowCSVReader(config Config, source *arrowSource) *CSVReader {
+	s := &arrowRecordSource{arrowSource: source}
+	if !config.NoHeaderRow {
+		s.headerRow = source.colnames
+	}
+
+	return newSourceCSVReader(config, source.file, s)
+}
@@ -0,0 +1,103 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/shenwei356/xopen"
+)
+
+// badRows writes malformed rows to a file, for --errors quarantine.
+type badRows struct {
+	mu     sync.Mutex
+	file   string
+	outfh  *xopen.Writer
+	writer *csvWriter
+	n      int
+}
+
+// quarantine is not nil for --errors quarantine.
+var quarantine *badRows
+
+// setBadRows sets how to handle malformed rows: "fail", "skip" or
+// "quarantine". Malformed rows are written to the file for "quarantine".
+func setBadRows(mode string, file string) error {
+	switch mode {
+	case "fail", "skip":
+		return nil
+	case "quarantine":
+	default:
+		return fmt.Errorf("unsupported value of flag --errors: %s. available: fail, skip, quarantine", mode)
+	}
+	if file == "" {
+		return fmt.Errorf("flag --bad-rows needed for --errors quarantine")
+	}
+
+	outfh, err := xopen.Wopen(file)
+	if err != nil {
+		return err
+	}
+	quarantine = &badRows{file: file, outfh: outfh, writer: newCSVWriter(outfh)}
+	quarantine.writer.comments = false
+	return quarantine.writer.Write([]string{"file", "row", "line", "column", "reason", "message", "fields"})
+}
+
+// quarantineRecord writes a malformed row to the file of bad rows, and
+// returns false if --errors is not quarantine. Fields of the row are
+// appended after the reason and the message, and they may be empty or
+// partial for rows with unparsable quotes.
+func quarantineRecord(err *RecordError, record []string) bool {
+	if quarantine == nil {
+		return false
+	}
+	q := quarantine
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	row := make([]string, 0, 6+len(record))
+	row = append(row, err.File, strconv.Itoa(err.Row), strconv.Itoa(err.Line),
+		strconv.Itoa(err.Column), errorClass(err), err.Err.Error())
+	row = append(row, record...)
+	checkError(q.writer.Write(row))
+	q.n++
+	return true
+}
+
+// CloseBadRows flushes and closes the file of bad rows.
+func CloseBadRows() error {
+	if quarantine == nil {
+		return nil
+	}
+	q := quarantine
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.writer.Flush()
+	if err := q.writer.Error(); err != nil {
+		return err
+	}
+	if q.n > 0 {
+		log.Warningf("%d bad rows written to %s", q.n, q.file)
+	}
+	return q.outfh.Close()
+}
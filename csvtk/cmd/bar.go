@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"slices"
@@ -35,6 +36,7 @@ import (
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
 )
 
 // barCmd represents the bar command
@@ -47,10 +49,17 @@ Notes:
 
   1. Output file can be set by flag -o/--out-file.
   2. File format is determined by the out file suffix.
-     Supported formats: eps, jpg|jpeg, pdf, png, svg, and tif|tiff
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, html, and terminal
   3. If flag -o/--out-file not set (default), image is written to stdout,
      you can display the image by pipping to "display" command of Imagemagic
      or just redirect to file.
+  4. The html format outputs an interactive chart, see "csvtk plot -h".
+  5. The terminal format draws the plot in the terminal, see "csvtk plot -h".
+  6. Bars of groups (--group-field) are placed side by side, or stacked
+     with --stack. One row for each X in a group is expected, values of
+     duplicated X are summed.
+  7. Error bars are plotted with values in -e/--error-field, e.g., standard
+     deviations. For stacked bars, they are placed on the top of each segment.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -92,6 +101,7 @@ Notes:
 		}
 
 		groupFieldStr := getFlagString(cmd, "group-field")
+		plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr
 		if len(groupFieldStr) > 0 {
 			if strings.Contains(groupFieldStr, ",") {
 				checkError(fmt.Errorf("only one field allowed for flag --group-field"))
@@ -99,10 +109,20 @@ Notes:
 			if groupFieldStr[0] == '-' {
 				checkError(fmt.Errorf("unselect not allowed for flag --group-field"))
 			}
-			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr + "," + groupFieldStr
-		} else {
-			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr
+			plotConfig.fieldStr += "," + groupFieldStr
+		}
+
+		errorFieldStr := getFlagString(cmd, "error-field")
+		if len(errorFieldStr) > 0 {
+			if strings.Contains(errorFieldStr, ",") {
+				checkError(fmt.Errorf("only one field allowed for flag -e (--error-field)"))
+			}
+			if errorFieldStr[0] == '-' {
+				checkError(fmt.Errorf("unselect not allowed for flag -e (--error-field)"))
+			}
+			plotConfig.fieldStr += "," + errorFieldStr
 		}
+		stack := getFlagBool(cmd, "stack")
 
 		horizontal := getFlagBool(cmd, "horizontal")
 		skipNA := getFlagBool(cmd, "skip-na")
@@ -116,7 +136,7 @@ Notes:
 		}
 
 		file := files[0]
-		headerRow, fields, data, _, _, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, false)
+		headerRow, fields, data, headerRowAll, dataAll, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, plotConfig.facetFieldStr != "")
 
 		if err != nil {
 			// if err == xopen.ErrNoContent {
@@ -126,159 +146,374 @@ Notes:
 			checkError(err)
 		}
 
-		var xNominalValues []string
-		// Collect unique values
-		xNominalValues = make([]string, 0, len(data)/4) // Assume a quarter of the data is unique
-		for _, d := range data {
-			i, found := slices.BinarySearch(xNominalValues, d[0])
-			if !found {
-				// 0 alloc insert slice trick https://go.dev/wiki/SliceTricks#insert
-				xNominalValues = append(xNominalValues, "")
-				copy(xNominalValues[i+1:], xNominalValues[i:])
-				xNominalValues[i] = d[0]
+		build := func(data [][]string) *plot.Plot {
+			var xNominalValues []string
+			// Collect unique values
+			xNominalValues = make([]string, 0, len(data)/4) // Assume a quarter of the data is unique
+			for _, d := range data {
+				i, found := slices.BinarySearch(xNominalValues, d[0])
+				if !found {
+					// 0 alloc insert slice trick https://go.dev/wiki/SliceTricks#insert
+					xNominalValues = append(xNominalValues, "")
+					copy(xNominalValues[i+1:], xNominalValues[i:])
+					xNominalValues[i] = d[0]
+				}
 			}
-		}
-
-		// =======================================
 
-		groups := make(map[string]plotter.Values)
-		groupOrderMap := make(map[string]int)
-		var y float64
-		var ok bool
-		var order int
+			// =======================================
 
-		for _, d := range data {
-			if skipNA {
-				if _, ok = naMap[strings.ToLower(d[0])]; ok {
-					continue
+			// group -> x -> y/error, values of duplicated X in a group are summed
+			xIndex := make(map[string]int, len(xNominalValues))
+			for i, x := range xNominalValues {
+				xIndex[x] = i
+			}
+			groups := make(map[string]plotter.Values)
+			groupErrors := make(map[string][]float64)
+			groupOrderMap := make(map[string]int)
+			var y, e float64
+			var ok bool
+			var order int
+			iGroup, iError := -1, -1
+			if len(groupFieldStr) > 0 {
+				iGroup = 2
+			}
+			if len(errorFieldStr) > 0 {
+				iError = 2
+				if iGroup > 0 {
+					iError = 3
 				}
 			}
 
-			if len(d) > 1 {
+			for _, d := range data {
 				if skipNA {
-					if _, ok = naMap[strings.ToLower(d[1])]; ok {
+					if _, ok = naMap[strings.ToLower(d[0])]; ok {
 						continue
 					}
 				}
-				y, err = strconv.ParseFloat(d[1], 64)
-			} else {
-				y, err = strconv.ParseFloat(d[0], 64)
-			}
-			if err != nil {
-				if len(headerRow) > 0 {
-					checkError(fmt.Errorf("fail to parse Y value: %s at column: %s. please choose the right column by flag --data-field-y", d[1], headerRow[1]))
+
+				if len(d) > 1 {
+					if skipNA {
+						if _, ok = naMap[strings.ToLower(d[1])]; ok {
+							continue
+						}
+					}
+					y, err = strconv.ParseFloat(d[1], 64)
 				} else {
-					checkError(fmt.Errorf("fail to parse Y value: %s at column: %d. please choose the right column by flag --data-field-y", d[1], fields[1]))
+					y, err = strconv.ParseFloat(d[0], 64)
+				}
+				if err != nil {
+					if len(headerRow) > 0 {
+						checkError(fmt.Errorf("fail to parse Y value: %s at column: %s. please choose the right column by flag --data-field-y", d[1], headerRow[1]))
+					} else {
+						checkError(fmt.Errorf("fail to parse Y value: %s at column: %d. please choose the right column by flag --data-field-y", d[1], fields[1]))
+					}
+				}
+
+				var groupName string
+				if iGroup > 0 {
+					groupName = d[iGroup]
+				}
+
+				if _, ok = groups[groupName]; !ok {
+					groups[groupName] = make(plotter.Values, len(xNominalValues))
+					groupErrors[groupName] = make([]float64, len(xNominalValues))
+				}
+				groups[groupName][xIndex[d[0]]] += y
+
+				if iError > 0 {
+					e, err = strconv.ParseFloat(d[iError], 64)
+					if err != nil {
+						checkError(fmt.Errorf("fail to parse error value: %s. please choose the right column by flag -e (--error-field)", d[iError]))
+					}
+					groupErrors[groupName][xIndex[d[0]]] = e
+				}
+				if _, ok = groupOrderMap[groupName]; !ok {
+					groupOrderMap[groupName] = order
+					order++
 				}
 			}
 
-			var groupName string
-			if len(d) > 2 {
-				groupName = d[2]
+			if barWidth == 0 {
+				fullWidth := plotConfig.width * vg.Inch
+				if horizontal {
+					fullWidth = plotConfig.height * vg.Inch
+				}
+				fullWidth -= plotConfig.axisWidth * vg.Inch // leave space for axis
+
+				nBars := len(groups)
+				if stack {
+					nBars = 1
+				}
+				barWidth = vg.Points(
+					(float64(fullWidth) / float64(nBars*len(xNominalValues))),
+				)
 			}
 
-			if _, ok = groups[groupName]; !ok {
-				groups[groupName] = make(plotter.Values, 0)
+			p := plot.New()
+
+			var groupOrders []stringutil.StringCount
+			for g := range groupOrderMap {
+				groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
 			}
-			groups[groupName] = append(groups[groupName], y)
-			if _, ok = groupOrderMap[groupName]; !ok {
-				groupOrderMap[groupName] = order
-				order++
+			sort.Sort(stringutil.StringCountList(groupOrders))
+
+			addLegend := len(groupOrders) > 1
+			var prev *plotter.BarChart
+			tops := make([]float64, len(xNominalValues)) // tops of stacked bars
+			for i, gor := range groupOrders {
+				v := groups[gor.Key]
+				g := gor.Key
+
+				bars, err := plotter.NewBarChart(v, barWidth)
+				checkError(err)
+				bars.LineStyle.Width = vg.Length(0)
+				bars.Color = plotutil.Color(colorIndex - 1 + i)
+				bars.Horizontal = horizontal
+
+				if stack {
+					if prev != nil {
+						bars.StackOn(prev)
+					}
+					prev = bars
+				} else {
+					// Calculate offset to center the bars
+					bars.Offset = barWidth * vg.Length(float64(i)-(float64(len(groupOrders)-1)/2))
+				}
+
+				p.Add(bars)
+				if addLegend {
+					p.Legend.Add(g, bars)
+				}
+
+				if iError > 0 {
+					ys := make([]float64, len(v))
+					for j := range v {
+						tops[j] += v[j]
+						if stack {
+							ys[j] = tops[j]
+						} else {
+							ys[j] = v[j]
+						}
+					}
+					errBars := &barErrorBars{
+						ys:         ys,
+						errs:       groupErrors[g],
+						offset:     bars.Offset,
+						cap:        barWidth / 3,
+						horizontal: horizontal,
+					}
+					errBars.LineStyle = plotter.DefaultLineStyle
+					errBars.LineStyle.Width = vg.Points(plotConfig.scale)
+					p.Add(errBars)
+				}
 			}
-		}
 
-		if barWidth == 0 {
-			fullWidth := plotConfig.width * vg.Inch
+			p.Legend.Top = getFlagBool(cmd, "legend-top")
+			p.Legend.Left = getFlagBool(cmd, "legend-left")
+			p.Legend.Padding = 1.5
+
 			if horizontal {
-				fullWidth = plotConfig.height * vg.Inch
+				p.X.Width = plotConfig.axisWidth
+				if plotConfig.xlab == "" {
+					if len(headerRow) > 1 {
+						plotConfig.xlab = headerRow[1]
+					} else {
+						plotConfig.xlab = "Values"
+					}
+				}
+				p.NominalY(xNominalValues...)
+			} else {
+				p.Y.Width = plotConfig.axisWidth
+				if plotConfig.ylab == "" {
+					if len(headerRow) > 1 {
+						plotConfig.ylab = headerRow[1]
+					} else {
+						plotConfig.ylab = "Values"
+					}
+				}
+				p.NominalX(xNominalValues...)
 			}
-			fullWidth -= plotConfig.axisWidth * vg.Inch // leave space for axis
-
-			barWidth = vg.Points(
-				(float64(fullWidth) / float64(len(groups)*len(xNominalValues))),
-			)
-		}
 
-		p := plot.New()
+			if plotConfig.html {
+				groupNames := make([]string, len(groupOrders))
+				values := make([]vegaObj, 0, len(groupOrders)*len(xNominalValues))
+				tops := make([]float64, len(xNominalValues))
+				for i, gor := range groupOrders {
+					groupNames[i] = gor.Key
+					v := groups[gor.Key]
+					for j, x := range xNominalValues {
+						value := vegaObj{"x": x, "y": v[j], "group": gor.Key}
+						if iError > 0 {
+							tops[j] += v[j]
+							value["error"] = groupErrors[gor.Key][j]
+							if stack {
+								value["top"] = tops[j]
+							} else {
+								value["top"] = v[j]
+							}
+						}
+						values = append(values, value)
+					}
+				}
+				spec := newVegaLiteSpec(plotConfig, values)
 
-		var groupOrders []stringutil.StringCount
-		for g := range groupOrderMap {
-			groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
-		}
-		sort.Sort(stringutil.StringCountList(groupOrders))
+				catChannel, valChannel, offsetChannel := "x", "y", "xOffset"
+				catTitle, valTitle := plotConfig.xlab, plotConfig.ylab
+				if horizontal {
+					catChannel, valChannel, offsetChannel = "y", "x", "yOffset"
+					catTitle, valTitle = plotConfig.ylab, plotConfig.xlab
+				}
+				cat := vegaObj{"field": "x", "type": "nominal", "sort": xNominalValues, "title": vegaTitle(catTitle)}
+				val := vegaQuantitative("y", valTitle, false,
+					plotConfig.yminStr, plotConfig.ymin, plotConfig.ymaxStr, plotConfig.ymax)
+				var offset vegaObj
+				if stack {
+					val["stack"] = "zero"
+				} else {
+					val["stack"] = nil
+					if len(groupNames) > 1 {
+						offset = vegaObj{"field": "group", "type": "nominal", "sort": groupNames}
+					}
+				}
 
-		addLegend := len(groupOrders) > 1
-		for i, gor := range groupOrders {
-			v := groups[gor.Key]
-			g := gor.Key
+				barEncoding := vegaObj{catChannel: cat, valChannel: val}
+				if offset != nil {
+					barEncoding[offsetChannel] = offset
+				}
+				bars := vegaObj{"mark": vegaObj{"type": "bar", "tooltip": true}}
+				colors := vegaPlotutilColors(colorIndex-1, len(groupNames))
+				if addLegend {
+					vegaAddLegendToggle(bars, barEncoding, "group", groupNames, colors)
+				} else {
+					bars["mark"].(vegaObj)["color"] = colors[0]
+				}
+				bars["encoding"] = barEncoding
 
-			bars, err := plotter.NewBarChart(v, barWidth)
-			checkError(err)
-			bars.LineStyle.Width = vg.Length(0)
-			bars.Color = plotutil.Color(colorIndex - 1 + i)
-			bars.Horizontal = horizontal
+				if iError > 0 {
+					errEncoding := vegaObj{
+						catChannel:           cat,
+						valChannel:           vegaObj{"field": "top", "type": "quantitative"},
+						valChannel + "Error": vegaObj{"field": "error"},
+					}
+					if offset != nil {
+						errEncoding[offsetChannel] = offset
+					}
+					errorBars := vegaObj{
+						"mark":     vegaObj{"type": "errorbar", "ticks": true, "color": "black"},
+						"encoding": errEncoding,
+					}
+					spec["layer"] = []vegaObj{bars, errorBars}
+				} else {
+					for k, v := range bars {
+						spec[k] = v
+					}
+				}
+				writePlotHTML(config.OutFile, plotConfig, spec)
+				return nil
+			}
 
-			// Calculate offset to center the bars
-			bars.Offset = barWidth * vg.Length(float64(i)-(float64(len(groupOrders)-1)/2))
+			if plotConfig.terminal {
+				if iError > 0 {
+					log.Warning("flag -e (--error-field) ignored for the terminal format")
+				}
+				groupNames := make([]string, len(groupOrders))
+				values := make([][]float64, len(groupOrders))
+				for i, gor := range groupOrders {
+					groupNames[i] = gor.Key
+					values[i] = groups[gor.Key]
+				}
+				if horizontal {
+					writeTermHBars(config.OutFile, plotConfig, xNominalValues, groupNames, values, colorIndex-1)
+					return nil
+				}
 
-			p.Add(bars)
-			if addLegend {
-				p.Legend.Add(g, bars)
+				tops := make([]float64, len(xNominalValues))
+				var ymax float64
+				for _, v := range values {
+					for j, y := range v {
+						if stack {
+							tops[j] += y
+							ymax = math.Max(ymax, tops[j])
+						} else {
+							ymax = math.Max(ymax, y)
+						}
+					}
+				}
+				if plotConfig.ymaxStr != "" {
+					ymax = plotConfig.ymax
+				}
+				tp := newTermPlot(plotConfig, 0, 1, 0, ymax)
+				tp.xCategories = xNominalValues
+				slot := tp.width / len(xNominalValues)
+				if slot < 1 {
+					checkError(fmt.Errorf("too many bars for the terminal width: %d", tp.width))
+				}
+				bar := slot * 2 / 3 // width of all bars in a slot
+				if bar < 1 {
+					bar = 1
+				}
+				if !stack && bar < len(values) {
+					bar = min(len(values), slot)
+				}
+				for j := range tops {
+					tops[j] = 0
+				}
+				for i, v := range values {
+					for j, y := range v {
+						c0 := slot*j + (slot-bar)/2
+						if stack {
+							tp.Bar(c0, c0+bar, tops[j], tops[j]+y, colorIndex-1+i)
+							tops[j] += y
+						} else {
+							w := max(bar/len(values), 1)
+							tp.Bar(c0+w*i, c0+w*(i+1), 0, y, colorIndex-1+i)
+						}
+					}
+					tp.AddLegend(groupNames[i], colorIndex-1+i)
+				}
+				writeTermPlot(config.OutFile, tp)
+				return nil
 			}
-		}
 
-		p.Legend.Top = getFlagBool(cmd, "legend-top")
-		p.Legend.Left = getFlagBool(cmd, "legend-left")
-		p.Legend.Padding = 1.5
+			p.Title.Text = plotConfig.title
+			p.Title.TextStyle.Font.Size = plotConfig.titleSize
+			p.X.Label.Text = plotConfig.xlab
+			p.Y.Label.Text = plotConfig.ylab
+			p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.X.Tick.Width = plotConfig.tickWidth
+			p.Y.Tick.Width = plotConfig.tickWidth
+			p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
+
+			// TODO log scale
+			// if plotConfig.scaleLnX {
+			// 	p.X.Scale = plot.LogScale{}
+			// 	p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+			// }
+			// if plotConfig.scaleLnY {
+			// 	p.Y.Scale = plot.LogScale{}
+			// 	p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+			// }
 
-		if horizontal {
-			p.X.Width = plotConfig.axisWidth
-			if plotConfig.xlab == "" {
-				if len(headerRow) > 1 {
-					plotConfig.xlab = headerRow[1]
-				} else {
-					plotConfig.xlab = "Values"
-				}
+			if plotConfig.yminStr != "" {
+				p.Y.Min = plotConfig.ymin
 			}
-			p.NominalY(xNominalValues...)
-		} else {
-			p.Y.Width = plotConfig.axisWidth
-			if plotConfig.ylab == "" {
-				if len(headerRow) > 1 {
-					plotConfig.ylab = headerRow[1]
-				} else {
-					plotConfig.ylab = "Values"
-				}
+			if plotConfig.ymaxStr != "" {
+				p.Y.Max = plotConfig.ymax
 			}
-			p.NominalX(xNominalValues...)
+
+			return p
 		}
 
-		p.Title.Text = plotConfig.title
-		p.Title.TextStyle.Font.Size = plotConfig.titleSize
-		p.X.Label.Text = plotConfig.xlab
-		p.Y.Label.Text = plotConfig.ylab
-		p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.X.Tick.Width = plotConfig.tickWidth
-		p.Y.Tick.Width = plotConfig.tickWidth
-		p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
-		p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
-
-		// TODO log scale
-		// if plotConfig.scaleLnX {
-		// 	p.X.Scale = plot.LogScale{}
-		// 	p.X.Tick.Marker = plot.LogTicks{Prec: -1}
-		// }
-		// if plotConfig.scaleLnY {
-		// 	p.Y.Scale = plot.LogScale{}
-		// 	p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
-		// }
-
-		if plotConfig.yminStr != "" {
-			p.Y.Min = plotConfig.ymin
+		if plotConfig.facetFieldStr != "" {
+			plotFacets(config, plotConfig, headerRowAll, data, dataAll, build)
+			return
 		}
-		if plotConfig.ymaxStr != "" {
-			p.Y.Max = plotConfig.ymax
+
+		p := build(data)
+		if p == nil { // html or terminal format
+			return
 		}
 
 		// Save image
@@ -297,6 +532,57 @@ Notes:
 	},
 }
 
+// barErrorBars draws error bars on bars, at the X positions of 0, 1, 2, ...
+// shifted by an offset, the same as plotter.BarChart.
+type barErrorBars struct {
+	ys, errs   []float64
+	offset     vg.Length
+	cap        vg.Length
+	horizontal bool
+	draw.LineStyle
+}
+
+// Plot implements the plot.Plotter interface.
+func (b *barErrorBars) Plot(c draw.Canvas, plt *plot.Plot) {
+	trCat, trVal := plt.Transforms(&c)
+	if b.horizontal {
+		trCat, trVal = trVal, trCat
+	}
+	var pos, lo, hi vg.Length
+	for i, y := range b.ys {
+		if b.errs[i] == 0 {
+			continue
+		}
+		pos = trCat(float64(i)) + b.offset
+		lo, hi = trVal(y-b.errs[i]), trVal(y+b.errs[i])
+		for _, line := range [][2]vg.Point{
+			{{X: pos, Y: lo}, {X: pos, Y: hi}},
+			{{X: pos - b.cap/2, Y: lo}, {X: pos + b.cap/2, Y: lo}},
+			{{X: pos - b.cap/2, Y: hi}, {X: pos + b.cap/2, Y: hi}},
+		} {
+			if b.horizontal {
+				line[0].X, line[0].Y = line[0].Y, line[0].X
+				line[1].X, line[1].Y = line[1].Y, line[1].X
+			}
+			c.StrokeLine2(b.LineStyle, line[0].X, line[0].Y, line[1].X, line[1].Y)
+		}
+	}
+}
+
+// DataRange implements the plot.DataRanger interface.
+func (b *barErrorBars) DataRange() (xmin, xmax, ymin, ymax float64) {
+	xmin, xmax = 0, float64(len(b.ys)-1)
+	ymin, ymax = math.Inf(1), math.Inf(-1)
+	for i, y := range b.ys {
+		ymin = math.Min(ymin, y-b.errs[i])
+		ymax = math.Max(ymax, y+b.errs[i])
+	}
+	if b.horizontal {
+		return ymin, ymax, xmin, xmax
+	}
+	return
+}
+
 func init() {
 	plotCmd.AddCommand(barCmd)
 	barCmd.Flags().StringP("data-field-x", "x", "", `column index or column name of X for command bar`)
@@ -308,4 +594,6 @@ func init() {
 	barCmd.Flags().Float64P("bar-width", "", 0, "bar width (0 for auto)")
 	barCmd.Flags().IntP("color-index", "", 1, `color index, 1-7`)
 	barCmd.Flags().BoolP("horizontal", "", false, "horizontal bar chart")
+	barCmd.Flags().BoolP("stack", "", false, "stack bars of groups instead of placing them side by side")
+	barCmd.Flags().StringP("error-field", "e", "", `column index or column name of errors (e.g., standard deviation) for plotting error bars`)
 }
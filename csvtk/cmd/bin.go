@@ -0,0 +1,347 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// binCmd represents the bin command
+var binCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:     "bin",
+	Aliases: []string{"cut-bins", "discretize"},
+	Short:   "bin numeric fields into categories",
+	Long: `bin numeric fields into categories
+
+Methods (choose one):
+  -b/--bins N         N equal-width bins between the minimum and maximum
+  -B/--breaks LIST    explicit breakpoints, e.g., 0,10,50,100
+  -q/--quantiles N    N bins with (nearly) equal numbers of values
+
+Bins are left-closed intervals like "[0,10)" by default, or right-closed
+like "(0,10]" with -r/--right-closed. The outermost edges are always
+included, e.g., the last bin "[90,100]" contains 100. Values out of the
+breakpoints are replaced with --na.
+
+Labels are intervals by default, or given by -L/--labels, e.g.,
+-L low,medium,high. Bins are appended as new columns named with the
+suffix "_bin", or replace the original values with -R/--replace.
+
+Examples:
+
+    csvtk bin -f age -B 0,18,65,120 -L child,adult,senior data.csv
+    csvtk bin -f score -q 4 -L Q1,Q2,Q3,Q4 data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		nBins := getFlagNonNegativeInt(cmd, "bins")
+		nQuantiles := getFlagNonNegativeInt(cmd, "quantiles")
+		breaksStr := getFlagStringSlice(cmd, "breaks")
+		labels := getFlagStringSlice(cmd, "labels")
+		rightClosed := getFlagBool(cmd, "right-closed")
+		replace := getFlagBool(cmd, "replace")
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+		na := getFlagString(cmd, "na")
+		decimalWidth := getFlagNonNegativeInt(cmd, "decimal-width")
+
+		var nMethods int
+		for _, ok := range []bool{nBins > 0, nQuantiles > 0, len(breaksStr) > 0} {
+			if ok {
+				nMethods++
+			}
+		}
+		if nMethods != 1 {
+			checkError(fmt.Errorf("one and only one of -b/--bins, -B/--breaks and -q/--quantiles needed"))
+		}
+
+		var breaks0 []float64
+		if len(breaksStr) > 0 {
+			if len(breaksStr) < 2 {
+				checkError(fmt.Errorf("at least two breakpoints needed: %s", breaksStr))
+			}
+			breaks0 = make([]float64, len(breaksStr))
+			for i, s := range breaksStr {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					checkError(fmt.Errorf("invalid breakpoint: %s", s))
+				}
+				if i > 0 && v <= breaks0[i-1] {
+					checkError(fmt.Errorf("breakpoints should be in ascending order: %s", breaksStr))
+				}
+				breaks0[i] = v
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk bin: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr:    fieldStr,
+			FuzzyFields: fuzzyFields,
+
+			DoNotAllowDuplicatedColumnName: true,
+		})
+
+		var fields []int
+		var header []string
+		records := make([][]string, 0, 1024)
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+				fields = record.Fields
+
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					header = record.All
+					continue
+				}
+			}
+
+			records = append(records, record.All)
+		}
+		readerReport(&config, csvReader, file)
+
+		// parse values and compute breakpoints for each field
+		nums := make([][]float64, len(fields))
+		valid := make([][]bool, len(fields))
+		breaksList := make([][]float64, len(fields))
+		for j, f := range fields {
+			nums[j] = make([]float64, len(records))
+			valid[j] = make([]bool, len(records))
+			values := make([]float64, 0, len(records))
+			for i, record := range records {
+				if !reDigitals.MatchString(record[f-1]) {
+					if ignore {
+						continue
+					}
+					checkError(fmt.Errorf("non-numeric value: %s, you can use flag -i/--ignore-non-numbers to skip these data", record[f-1]))
+				}
+				v, err := strconv.ParseFloat(removeComma(record[f-1]), 64)
+				checkError(err)
+				nums[j][i], valid[j][i] = v, true
+				values = append(values, v)
+			}
+			sort.Float64s(values)
+
+			switch {
+			case breaks0 != nil:
+				breaksList[j] = breaks0
+			case len(values) == 0:
+			case nBins > 0:
+				breaksList[j] = equalWidthBreaks(values[0], values[len(values)-1], nBins)
+			default:
+				breaksList[j] = quantileBreaks(values, nQuantiles)
+			}
+
+			if len(labels) > 0 && len(breaksList[j]) > 0 && len(labels) != len(breaksList[j])-1 {
+				checkError(fmt.Errorf("the number of labels (%d) does not match the number of bins (%d)", len(labels), len(breaksList[j])-1))
+			}
+		}
+
+		// bin labels of each field
+		labelsList := make([][]string, len(fields))
+		for j := range fields {
+			if len(labels) > 0 {
+				labelsList[j] = labels
+				continue
+			}
+			breaks := breaksList[j]
+			for i := 0; i+1 < len(breaks); i++ {
+				a := formatBreak(breaks[i], decimalWidth)
+				b := formatBreak(breaks[i+1], decimalWidth)
+				// the outermost edges are included
+				if rightClosed {
+					if i == 0 {
+						labelsList[j] = append(labelsList[j], "["+a+","+b+"]")
+					} else {
+						labelsList[j] = append(labelsList[j], "("+a+","+b+"]")
+					}
+				} else {
+					if i+2 == len(breaks) {
+						labelsList[j] = append(labelsList[j], "["+a+","+b+"]")
+					} else {
+						labelsList[j] = append(labelsList[j], "["+a+","+b+")")
+					}
+				}
+			}
+		}
+
+		if header != nil && !config.NoOutHeader {
+			items := make([]string, 0, len(header)+len(fields))
+			items = append(items, header...)
+			if !replace {
+				for _, f := range fields {
+					items = append(items, header[f-1]+"_bin")
+				}
+			}
+			checkError(writer.Write(items))
+		}
+
+		var label string
+		items := make([]string, 0, 64)
+		for i, record := range records {
+			items = append(items[:0], record...)
+			for j, f := range fields {
+				label = na
+				if valid[j][i] {
+					if k := findBin(breaksList[j], nums[j][i], rightClosed); k >= 0 {
+						label = labelsList[j][k]
+					}
+				}
+				if replace {
+					items[f-1] = label
+				} else {
+					items = append(items, label)
+				}
+			}
+			checkError(writer.Write(items))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(binCmd)
+
+	binCmd.Flags().StringP("fields", "f", "", `numeric fields to bin. e.g -f 1,2 or -f columnA,columnB`)
+	binCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	binCmd.Flags().IntP("bins", "b", 0, `the number of equal-width bins`)
+	binCmd.Flags().StringSliceP("breaks", "B", []string{}, `explicit breakpoints in ascending order, e.g., 0,10,50,100`)
+	binCmd.Flags().IntP("quantiles", "q", 0, `the number of quantile bins, e.g., 4 for quartiles`)
+	binCmd.Flags().StringSliceP("labels", "L", []string{}, `labels of bins, e.g., low,medium,high`)
+	binCmd.Flags().BoolP("right-closed", "r", false, `bins are right-closed intervals like "(0,10]"`)
+	binCmd.Flags().BoolP("replace", "R", false, `replace the original values instead of appending new columns`)
+	binCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore non-numeric values like "NA" or "N/A"`)
+	binCmd.Flags().StringP("na", "", "", `content for non-numeric values and values out of breakpoints`)
+	binCmd.Flags().IntP("decimal-width", "w", 2, "limit floats in interval labels to N decimal points")
+}
+
+// equalWidthBreaks returns n+1 breakpoints of n equal-width bins.
+func equalWidthBreaks(min, max float64, n int) []float64 {
+	breaks := make([]float64, n+1)
+	step := (max - min) / float64(n)
+	for i := range breaks {
+		breaks[i] = min + float64(i)*step
+	}
+	breaks[n] = max
+	return breaks
+}
+
+// quantileBreaks returns breakpoints of n quantile bins of sorted values.
+// Duplicated breakpoints are removed, so there might be fewer bins.
+func quantileBreaks(sorted []float64, n int) []float64 {
+	breaks := make([]float64, 0, n+1)
+	var v float64
+	for i := 0; i <= n; i++ {
+		if i == n {
+			v = sorted[len(sorted)-1]
+		} else {
+			v = percentileValue(sorted, float64(i)/float64(n))
+		}
+		if len(breaks) > 0 && v <= breaks[len(breaks)-1] {
+			continue
+		}
+		breaks = append(breaks, v)
+	}
+	if len(breaks) == 1 { // all values are the same
+		breaks = append(breaks, breaks[0])
+	}
+	return breaks
+}
+
+// findBin returns the index of the bin containing v, or -1 if out of range.
+func findBin(breaks []float64, v float64, rightClosed bool) int {
+	n := len(breaks) - 1
+	if n < 1 || v < breaks[0] || v > breaks[n] {
+		return -1
+	}
+	var i int
+	if rightClosed {
+		if v == breaks[0] {
+			return 0
+		}
+		i = sort.Search(len(breaks), func(i int) bool { return breaks[i] >= v }) - 1
+	} else {
+		if v == breaks[n] {
+			return n - 1
+		}
+		i = sort.Search(len(breaks), func(i int) bool { return breaks[i] > v }) - 1
+	}
+	return i
+}
+
+func formatBreak(v float64, decimalWidth int) string {
+	p := math.Pow10(decimalWidth)
+	return strconv.FormatFloat(math.Round(v*p)/p, 'f', -1, 64)
+}
@@ -46,10 +46,11 @@ Notes:
 
   1. Output file can be set by flag -o/--out-file.
   2. File format is determined by the out file suffix.
-     Supported formats: eps, jpg|jpeg, pdf, png, svg, and tif|tiff
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, and html
   3. If flag -o/--out-file not set (default), image is written to stdout,
      you can display the image by pipping to "display" command of Imagemagic
      or just redirect to file.
+  4. The html format outputs an interactive chart, see "csvtk plot -h".
 
 
 `,
@@ -82,7 +83,7 @@ Notes:
 		}
 
 		file := files[0]
-		headerRow, fields, data, _, _, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, false)
+		headerRow, fields, data, headerRowAll, dataAll, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, plotConfig.facetFieldStr != "")
 
 		if err != nil {
 			// if err == xopen.ErrNoContent {
@@ -92,153 +93,195 @@ Notes:
 			checkError(err)
 		}
 
-		// =======================================
-
-		horiz := getFlagBool(cmd, "horiz")
-		w := vg.Length(getFlagNonNegativeFloat64(cmd, "box-width"))
-
-		groups := make(map[string]plotter.Values)
-		groupOrderMap := make(map[string]int)
-		var f float64
-		var ok bool
-		var order int
-		var groupName string
-		for _, d := range data {
-			if skipNA {
-				if _, ok = naMap[strings.ToLower(d[0])]; ok {
-					continue
+		build := func(data [][]string) *plot.Plot {
+			// =======================================
+
+			horiz := getFlagBool(cmd, "horiz")
+			w := vg.Length(getFlagNonNegativeFloat64(cmd, "box-width"))
+
+			groups := make(map[string]plotter.Values)
+			groupOrderMap := make(map[string]int)
+			var f float64
+			var ok bool
+			var order int
+			var groupName string
+			for _, d := range data {
+				if skipNA {
+					if _, ok = naMap[strings.ToLower(d[0])]; ok {
+						continue
+					}
 				}
-			}
 
-			f, err = strconv.ParseFloat(d[0], 64)
-			if err != nil {
-				if len(headerRow) > 0 {
-					checkError(fmt.Errorf("fail to parse data: %s at column: %s. please choose the right column by flag -f (--data-field)", d[0], headerRow[0]))
-				} else {
-					checkError(fmt.Errorf("fail to parse data: %s at column: %d. please choose the right column by flag -f (--data-field)", d[0], fields[0]))
+				f, err = strconv.ParseFloat(d[0], 64)
+				if err != nil {
+					if len(headerRow) > 0 {
+						checkError(fmt.Errorf("fail to parse data: %s at column: %s. please choose the right column by flag -f (--data-field)", d[0], headerRow[0]))
+					} else {
+						checkError(fmt.Errorf("fail to parse data: %s at column: %d. please choose the right column by flag -f (--data-field)", d[0], fields[0]))
+					}
 				}
-			}
-			if len(d) > 1 {
-				groupName = d[1]
-			} else { // no group, only given a field
-				if len(headerRow) > 0 {
-					groupName = headerRow[0]
-				} else {
-					groupName = ""
+				if len(d) > 1 {
+					groupName = d[1]
+				} else { // no group, only given a field
+					if len(headerRow) > 0 {
+						groupName = headerRow[0]
+					} else {
+						groupName = ""
+					}
+				}
+				if _, ok = groups[groupName]; !ok {
+					groups[groupName] = make(plotter.Values, 0)
+				}
+				groups[groupName] = append(groups[groupName], f)
+
+				if _, ok = groupOrderMap[groupName]; !ok {
+					groupOrderMap[groupName] = order
+					order++
 				}
 			}
-			if _, ok = groups[groupName]; !ok {
-				groups[groupName] = make(plotter.Values, 0)
+
+			p := plot.New()
+
+			var groupOrders []stringutil.StringCount
+			for g := range groupOrderMap {
+				groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
 			}
-			groups[groupName] = append(groups[groupName], f)
+			sort.Sort(stringutil.StringCountList(groupOrders))
 
-			if _, ok = groupOrderMap[groupName]; !ok {
-				groupOrderMap[groupName] = order
-				order++
+			if !horiz {
+				if w == 0 {
+					w = vg.Points(float64(plotConfig.width*vg.Inch) / float64(len(groupOrders)) / 2.5)
+				}
+			} else {
+				if w == 0 {
+					w = vg.Points(float64(plotConfig.height*vg.Inch) / float64(len(groupOrders)) / 2.5)
+				}
 			}
-		}
 
-		p := plot.New()
+			groupNames := make([]string, len(groupOrders))
+			j := colorIndex - 1
+			for i, group := range groupOrders {
+				groupNames[i] = group.Key
+				b, err := plotter.NewBoxPlot(w, float64(i), groups[group.Key])
+				checkError(err)
+				if horiz {
+					b.Horizontal = true
+				}
+				p.Add(b)
+
+				b.BoxStyle.Color = plotutil.Color(j)
+				b.BoxStyle.Width = lineWidth
 
-		var groupOrders []stringutil.StringCount
-		for g := range groupOrderMap {
-			groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
-		}
-		sort.Sort(stringutil.StringCountList(groupOrders))
+				b.MedianStyle.Color = plotutil.Color(j)
+				b.MedianStyle.Width = lineWidth
 
-		if !horiz {
-			if w == 0 {
-				w = vg.Points(float64(plotConfig.width*vg.Inch) / float64(len(groupOrders)) / 2.5)
+				b.WhiskerStyle.Color = plotutil.Color(j)
+				b.WhiskerStyle.Width = lineWidth
+
+				b.GlyphStyle.Color = plotutil.Color(j)
+				b.GlyphStyle.Radius = pointSize
+				j++
 			}
-		} else {
-			if w == 0 {
-				w = vg.Points(float64(plotConfig.height*vg.Inch) / float64(len(groupOrders)) / 2.5)
+
+			if !horiz {
+				p.NominalX(groupNames...)
+				// p.HideX()
+			} else {
+				p.NominalY(groupNames...)
+				// p.HideY()
 			}
-		}
 
-		groupNames := make([]string, len(groupOrders))
-		j := colorIndex - 1
-		for i, group := range groupOrders {
-			groupNames[i] = group.Key
-			b, err := plotter.NewBoxPlot(w, float64(i), groups[group.Key])
-			checkError(err)
+			if plotConfig.ylab == "" {
+				if len(headerRow) > 0 {
+					plotConfig.ylab = headerRow[0]
+				} else {
+					plotConfig.ylab = "Values"
+				}
+			}
+			if plotConfig.xlab == "" {
+				if len(headerRow) > 1 {
+					plotConfig.xlab = headerRow[1]
+				} else {
+					plotConfig.xlab = "Groups"
+				}
+			}
 			if horiz {
-				b.Horizontal = true
+				plotConfig.xlab, plotConfig.ylab = plotConfig.ylab, plotConfig.xlab
 			}
-			p.Add(b)
-
-			b.BoxStyle.Color = plotutil.Color(j)
-			b.BoxStyle.Width = lineWidth
-
-			b.MedianStyle.Color = plotutil.Color(j)
-			b.MedianStyle.Width = lineWidth
-
-			b.WhiskerStyle.Color = plotutil.Color(j)
-			b.WhiskerStyle.Width = lineWidth
 
-			b.GlyphStyle.Color = plotutil.Color(j)
-			b.GlyphStyle.Radius = pointSize
-			j++
-		}
+			if plotConfig.html {
+				values := make([]vegaObj, 0, len(data))
+				for _, g := range groupNames {
+					for _, f := range groups[g] {
+						values = append(values, vegaObj{"group": g, "value": f})
+					}
+				}
+				spec := newVegaLiteSpec(plotConfig, values)
+				spec["mark"] = vegaObj{"type": "boxplot", "extent": 1.5, "size": float64(w)}
+				encoding := vegaObj{}
+				group := vegaObj{"field": "group", "type": "nominal", "sort": groupNames}
+				if !horiz {
+					group["title"] = vegaTitle(plotConfig.xlab)
+					encoding["x"] = group
+					encoding["y"] = vegaQuantitative("value", plotConfig.ylab, plotConfig.scaleLnY,
+						plotConfig.yminStr, plotConfig.ymin, plotConfig.ymaxStr, plotConfig.ymax)
+				} else {
+					group["title"] = vegaTitle(plotConfig.ylab)
+					encoding["y"] = group
+					encoding["x"] = vegaQuantitative("value", plotConfig.xlab, plotConfig.scaleLnX,
+						plotConfig.xminStr, plotConfig.xmin, plotConfig.xmaxStr, plotConfig.xmax)
+				}
+				vegaAddLegendToggle(spec, encoding, "group", groupNames, vegaPlotutilColors(colorIndex-1, len(groupNames)))
+				spec["encoding"] = encoding
+				writePlotHTML(config.OutFile, plotConfig, spec)
+				return nil
+			}
 
-		if !horiz {
-			p.NominalX(groupNames...)
-			// p.HideX()
-		} else {
-			p.NominalY(groupNames...)
-			// p.HideY()
-		}
+			p.Title.Text = plotConfig.title
+			p.Title.TextStyle.Font.Size = plotConfig.titleSize
+			p.X.Label.Text = plotConfig.xlab
+			p.Y.Label.Text = plotConfig.ylab
+			p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.X.Width = plotConfig.axisWidth
+			p.Y.Width = plotConfig.axisWidth
+			p.X.Tick.Width = plotConfig.tickWidth
+			p.Y.Tick.Width = plotConfig.tickWidth
+			p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			if plotConfig.scaleLnX {
+				p.X.Scale = plot.LogScale{}
+				p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+			if plotConfig.scaleLnY {
+				p.Y.Scale = plot.LogScale{}
+				p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
 
-		if plotConfig.ylab == "" {
-			if len(headerRow) > 0 {
-				plotConfig.ylab = headerRow[0]
-			} else {
-				plotConfig.ylab = "Values"
+			if plotConfig.xminStr != "" {
+				log.Warning("flag --x-min ignored for command box")
 			}
-		}
-		if plotConfig.xlab == "" {
-			if len(headerRow) > 1 {
-				plotConfig.xlab = headerRow[1]
-			} else {
-				plotConfig.xlab = "Groups"
+			if plotConfig.xmaxStr != "" {
+				log.Warning("flag --x-max ignored for command box")
+			}
+			if plotConfig.yminStr != "" {
+				log.Warning("flag --y-min ignored for command box")
+			}
+			if plotConfig.ymaxStr != "" {
+				log.Warning("flag --y-max ignored for command box")
 			}
-		}
-		if horiz {
-			plotConfig.xlab, plotConfig.ylab = plotConfig.ylab, plotConfig.xlab
-		}
 
-		p.Title.Text = plotConfig.title
-		p.Title.TextStyle.Font.Size = plotConfig.titleSize
-		p.X.Label.Text = plotConfig.xlab
-		p.Y.Label.Text = plotConfig.ylab
-		p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.X.Width = plotConfig.axisWidth
-		p.Y.Width = plotConfig.axisWidth
-		p.X.Tick.Width = plotConfig.tickWidth
-		p.Y.Tick.Width = plotConfig.tickWidth
-		p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
-		p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
-		if plotConfig.scaleLnX {
-			p.X.Scale = plot.LogScale{}
-			p.X.Tick.Marker = plot.LogTicks{Prec: -1}
-		}
-		if plotConfig.scaleLnY {
-			p.Y.Scale = plot.LogScale{}
-			p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+			return p
 		}
 
-		if plotConfig.xminStr != "" {
-			log.Warning("flag --x-min ignored for command box")
+		if plotConfig.facetFieldStr != "" {
+			plotFacets(config, plotConfig, headerRowAll, data, dataAll, build)
+			return
 		}
-		if plotConfig.xmaxStr != "" {
-			log.Warning("flag --x-max ignored for command box")
-		}
-		if plotConfig.yminStr != "" {
-			log.Warning("flag --y-min ignored for command box")
-		}
-		if plotConfig.ymaxStr != "" {
-			log.Warning("flag --y-max ignored for command box")
+
+		p := build(data)
+		if p == nil { // html or terminal format
+			return
 		}
 
 		// Save image
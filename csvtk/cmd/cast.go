@@ -0,0 +1,458 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// castCmd represents the cast command
+var castCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "cast",
+	Short: "cast columns to declared types, with locale-aware number parsing",
+	Long: `cast columns to declared types, with locale-aware number parsing
+
+Types are declared with -a/--as in the form of "field:type", separated by
+commas, where fields can be column names, field numbers or ranges.
+
+Types:
+  int                 integer, e.g., "1,234" -> 1234
+  float               float number, e.g., "1.234,5" -> 1234.5 with --locale de
+  bool                true/false, from true/false, t/f, yes/no, y/n, 1/0, on/off
+  string              unchanged
+  date(LAYOUT)        date in a Go layout, e.g., date(02/01/2006), outputted as
+                      --out-date-layout. Formats are detected if LAYOUT is omitted
+  datetime(LAYOUT)    date and time in a Go layout, e.g., datetime(2006-01-02 15:04),
+                      outputted as --out-datetime-layout
+
+Locales of numbers (--locale), which can be overridden by --decimal-sep and
+--thousands-sep:
+  en    1,234.5
+  de    1.234,5
+  fr    1 234,5 (spaces and no-break spaces)
+  ch    1'234.5
+
+Thousands separators are only accepted between groups of three digits,
+so "1,5" fails to cast as a number with the locale en.
+
+Empty values and values of --na are treated as nulls and outputted as
+empty strings.
+
+Values failed to cast are handled by --on-error:
+  fail    exit with an error (default)
+  null    replace them with empty strings
+  keep    keep them unchanged
+  skip    remove the rows
+Failed rows can also be written to --fail-file, with a column "cast_error"
+of reasons appended.
+
+Examples:
+
+    csvtk cast -a 'price:float, qty:int, dt:datetime(2006-01-02)'
+    csvtk cast -a 'price:float' --locale de --on-error null --fail-file bad.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		specs, err := parseCastSpecs(getFlagString(cmd, "as"))
+		checkError(err)
+
+		locale := strings.ToLower(getFlagString(cmd, "locale"))
+		decimalSep, thousandsSep, ok := castLocales(locale)
+		if !ok {
+			checkError(fmt.Errorf("unsupported locale: %s. available: en, de, fr, ch", locale))
+		}
+		if cmd.Flags().Changed("decimal-sep") {
+			decimalSep = getFlagString(cmd, "decimal-sep")
+		}
+		if cmd.Flags().Changed("thousands-sep") {
+			thousandsSep = []string{getFlagString(cmd, "thousands-sep")}
+		}
+		if decimalSep == "" {
+			checkError(fmt.Errorf("value of flag --decimal-sep should not be empty"))
+		}
+
+		onError := strings.ToLower(getFlagString(cmd, "on-error"))
+		switch onError {
+		case "fail", "null", "keep", "skip":
+		default:
+			checkError(fmt.Errorf("unsupported value of flag --on-error: %s. available: fail, null, keep, skip", onError))
+		}
+
+		na := make(map[string]struct{}, 8)
+		for _, v := range getFlagStringSlice(cmd, "na") {
+			na[v] = struct{}{}
+		}
+
+		caster := &valueCaster{
+			decimalSep:     decimalSep,
+			thousandsSep:   thousandsSep,
+			dateLayout:     getFlagString(cmd, "out-date-layout"),
+			datetimeLayout: getFlagString(cmd, "out-datetime-layout"),
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		var failWriter *csvWriter
+		if failFile := getFlagString(cmd, "fail-file"); failFile != "" {
+			failfh, err := xopen.Wopen(failFile)
+			checkError(err)
+			defer failfh.Close()
+
+			failWriter = newCSVWriter(failfh)
+			failWriter.comments = false
+			failWriter.Comma = writer.Comma
+			defer func() {
+				failWriter.Flush()
+				checkError(failWriter.Error())
+			}()
+		}
+
+		var nFailed int
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk cast: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var header []string
+			var types []*castType // types of all columns, nil for unchanged
+			var reasons []string
+			var failed bool
+			var v string
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if types == nil {
+					types = make([]*castType, len(record.All))
+					for _, spec := range specs {
+						for _, f := range selectFieldsByHeader(record.All, spec.field, false) {
+							types[f-1] = spec.typ
+						}
+					}
+				}
+
+				if record.IsHeaderRow {
+					header = append([]string{}, record.All...)
+					if !config.NoOutHeader {
+						checkError(writer.Write(record.All))
+					}
+					if failWriter != nil {
+						checkError(failWriter.Write(append(append([]string{}, record.All...), "cast_error")))
+					}
+					continue
+				}
+
+				reasons = reasons[:0]
+				failed = false
+				original := record.All
+				if failWriter != nil {
+					original = append([]string{}, record.All...)
+				}
+				for i, typ := range types {
+					if typ == nil || i >= len(record.All) {
+						continue
+					}
+					if _, ok := na[record.All[i]]; ok || record.All[i] == "" {
+						record.All[i] = ""
+						continue
+					}
+
+					v, err = caster.cast(record.All[i], typ)
+					if err == nil {
+						record.All[i] = v
+						continue
+					}
+
+					failed = true
+					colname := strconv.Itoa(i + 1)
+					if i < len(header) {
+						colname = header[i]
+					}
+					if onError == "fail" {
+						checkError(fmt.Errorf("[%s] row %d, column %s: %s", file, record.Row, colname, err))
+					}
+					reasons = append(reasons, fmt.Sprintf("%s: %s", colname, err))
+					if onError == "null" {
+						record.All[i] = ""
+					}
+				}
+
+				if failed {
+					nFailed++
+					if failWriter != nil {
+						checkError(failWriter.Write(append(original, strings.Join(reasons, "; "))))
+					}
+					if onError == "skip" {
+						continue
+					}
+				}
+				checkError(writer.Write(record.All))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+
+		if nFailed > 0 && config.Verbose {
+			log.Warningf("%d rows failed to cast", nFailed)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(castCmd)
+	castCmd.Flags().StringP("as", "a", "", `types of fields, e.g., 'price:float, qty:int, dt:datetime(2006-01-02)'`)
+	castCmd.Flags().StringP("locale", "L", "en", `locale of numbers: en, de, fr, ch`)
+	castCmd.Flags().StringP("decimal-sep", "", ".", `decimal separator of numbers, overriding --locale`)
+	castCmd.Flags().StringP("thousands-sep", "", ",", `thousands separator of numbers, overriding --locale. "" for none`)
+	castCmd.Flags().StringP("on-error", "e", "fail", `how to handle values failed to cast: fail, null, keep, skip`)
+	castCmd.Flags().StringP("fail-file", "", "", `file of rows failed to cast, with a column "cast_error" appended`)
+	castCmd.Flags().StringSliceP("na", "", []string{"NA", "N/A", "null", "NULL"}, `values treated as nulls, which are outputted as empty strings`)
+	castCmd.Flags().StringP("out-date-layout", "", "2006-01-02", `Go layout of outputted dates`)
+	castCmd.Flags().StringP("out-datetime-layout", "", time.RFC3339, `Go layout of outputted dates and times`)
+}
+
+// castType is a type to cast values to.
+type castType struct {
+	name   string // int, float, bool, string, date, datetime
+	layout string // layout of date and datetime, "" for detecting formats
+}
+
+// castSpec is a field and its type.
+type castSpec struct {
+	field string
+	typ   *castType
+}
+
+// parseCastSpecs parses specs like 'price:float, qty:int, dt:datetime(2006-01-02)',
+// where layouts in parentheses can contain commas.
+func parseCastSpecs(s string) ([]castSpec, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("flag -a/--as needed")
+	}
+
+	items := make([]string, 0, 8)
+	var depth, start int
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	items = append(items, s[start:])
+
+	specs := make([]castSpec, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, ":")
+		if j := strings.Index(item, "("); j >= 0 {
+			i = strings.LastIndex(item[:j], ":")
+		}
+		if i <= 0 {
+			return nil, fmt.Errorf(`invalid type declaration, "field:type" expected: %s`, item)
+		}
+		field, name := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+
+		typ := &castType{}
+		if j := strings.Index(name, "("); j >= 0 {
+			if !strings.HasSuffix(name, ")") {
+				return nil, fmt.Errorf("invalid type: %s", name)
+			}
+			typ.layout = name[j+1 : len(name)-1]
+			name = strings.TrimSpace(name[:j])
+		}
+		typ.name = strings.ToLower(name)
+		switch typ.name {
+		case "int", "float", "bool", "string":
+			if typ.layout != "" {
+				return nil, fmt.Errorf("layout not supported for type %s: %s", typ.name, item)
+			}
+		case "date", "datetime":
+		default:
+			return nil, fmt.Errorf("unsupported type: %s. available: int, float, bool, string, date, datetime", name)
+		}
+		specs = append(specs, castSpec{field: field, typ: typ})
+	}
+	return specs, nil
+}
+
+// castLocales returns the decimal separator and thousands separators of a locale.
+func castLocales(locale string) (string, []string, bool) {
+	switch locale {
+	case "en", "en_us", "en_gb", "c":
+		return ".", []string{","}, true
+	case "de", "de_de", "es", "it", "nl", "pt", "id":
+		return ",", []string{"."}, true
+	case "fr", "fr_fr", "ru", "pl", "cs", "sv", "fi", "nb":
+		return ",", []string{" ", " ", " "}, true
+	case "ch", "de_ch":
+		return ".", []string{"'", "’"}, true
+	}
+	return "", nil, false
+}
+
+// valueCaster casts values to types.
+type valueCaster struct {
+	decimalSep     string
+	thousandsSep   []string
+	dateLayout     string
+	datetimeLayout string
+}
+
+func (c *valueCaster) cast(s string, typ *castType) (string, error) {
+	switch typ.name {
+	case "int":
+		num, err := c.normalizeNumber(s)
+		if err != nil {
+			return "", err
+		}
+		if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil || f != math.Trunc(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("not an integer: %s", s)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case "float":
+		num, err := c.normalizeNumber(s)
+		if err != nil {
+			return "", err
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return "", fmt.Errorf("not a number: %s", s)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case "bool":
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "true", "t", "yes", "y", "1", "on":
+			return "true", nil
+		case "false", "f", "no", "n", "0", "off":
+			return "false", nil
+		}
+		return "", fmt.Errorf("not a boolean: %s", s)
+	case "date", "datetime":
+		var t time.Time
+		var err error
+		if typ.layout != "" {
+			t, err = time.ParseInLocation(typ.layout, strings.TrimSpace(s), time.Local)
+		} else {
+			t, err = dateparse.ParseLocal(strings.TrimSpace(s))
+		}
+		if err != nil {
+			return "", fmt.Errorf("not a %s: %s", typ.name, s)
+		}
+		if typ.name == "date" {
+			return t.Format(c.dateLayout), nil
+		}
+		return t.Format(c.datetimeLayout), nil
+	}
+	return s, nil
+}
+
+// normalizeNumber converts a number in the locale to the form accepted by
+// strconv. Thousands separators are only accepted between groups of three digits.
+func (c *valueCaster) normalizeNumber(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	num := s
+
+	var sign string
+	if num != "" && (num[0] == '-' || num[0] == '+') {
+		sign, num = num[:1], num[1:]
+	}
+
+	intPart, fracPart, hasFrac := strings.Cut(num, c.decimalSep)
+	if hasFrac && strings.Contains(fracPart, c.decimalSep) {
+		return "", fmt.Errorf("not a number: %s", s)
+	}
+
+	for _, sep := range c.thousandsSep {
+		if sep == "" || !strings.Contains(intPart, sep) {
+			continue
+		}
+		groups := strings.Split(intPart, sep)
+		for i, g := range groups {
+			if (i == 0 && (len(g) < 1 || len(g) > 3)) || (i > 0 && len(g) != 3) {
+				return "", fmt.Errorf("invalid thousands separators: %s", s)
+			}
+		}
+		intPart = strings.Join(groups, "")
+		break
+	}
+
+	if hasFrac {
+		return sign + intPart + "." + fracPart, nil
+	}
+	return sign + intPart, nil
+}
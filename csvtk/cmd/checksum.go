@@ -0,0 +1,255 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"runtime"
+	"sort"
+	"strconv"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// checksumCmd represents the checksum command
+var checksumCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:     "checksum",
+	Aliases: []string{"fingerprint"},
+	Short:   "canonical content hashes of CSV files, insensitive to row order and formatting",
+	Long: `canonical content hashes of CSV files, insensitive to row order and formatting
+
+The hash (SHA-256) is computed on parsed values, so it is not affected
+by quoting, line endings, delimiters or compression. Rows are hashed
+as a multiset, so the order of rows does not matter unless --ordered is
+given, while duplicated rows do. The header row is included.
+
+Columns are sorted by names before hashing with -s/--sort-columns, so
+that the column order does not matter either.
+
+Outputs are in CSV format with columns of file, rows, columns and
+checksum, or with -c/--per-column, hashes of each column in columns
+of file, column and checksum.
+
+Example:
+
+    csvtk checksum a.csv b.tsv.gz -s
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		sortColumns := getFlagBool(cmd, "sort-columns")
+		ordered := getFlagBool(cmd, "ordered")
+		perColumn := getFlagBool(cmd, "per-column")
+		if sortColumns && config.NoHeaderRow {
+			checkError(fmt.Errorf("flag -s/--sort-columns is not allowed with -H/--no-header-row"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if !config.NoOutHeader {
+			if perColumn {
+				checkError(writer.Write([]string{"file", "column", "checksum"}))
+			} else {
+				checkError(writer.Write([]string{"file", "rows", "columns", "checksum"}))
+			}
+		}
+
+		for _, file := range files {
+			var header []string
+			var order []int
+			var table *tableChecksum
+			var columns []*tableChecksum
+			var nRows int
+			items := make([]string, 0, 64)
+
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil && err != xopen.ErrNoContent {
+				checkError(err)
+			}
+			if err == nil {
+				csvReader.Read(ReadOption{
+					FieldStr: "1-",
+				})
+
+				checkFirstLine := true
+				for record := range csvReader.Ch {
+					if record.Err != nil {
+						checkError(record.Err)
+					}
+
+					if checkFirstLine {
+						checkFirstLine = false
+
+						header = make([]string, len(record.All))
+						for i := range header {
+							if config.NoHeaderRow {
+								header[i] = strconv.Itoa(i + 1)
+							} else {
+								header[i] = record.All[i]
+							}
+						}
+						order = make([]int, len(header))
+						for i := range order {
+							order[i] = i
+						}
+						if sortColumns {
+							sort.SliceStable(order, func(i, j int) bool { return header[order[i]] < header[order[j]] })
+						}
+
+						table = newTableChecksum(ordered)
+						items = items[:0]
+						for _, i := range order {
+							items = append(items, header[i])
+						}
+						table.header(items)
+						columns = make([]*tableChecksum, len(header))
+						for i := range columns {
+							columns[i] = newTableChecksum(ordered)
+							columns[i].header(header[i : i+1])
+						}
+
+						if !config.NoHeaderRow {
+							continue
+						}
+					}
+
+					nRows++
+					items = items[:0]
+					for _, i := range order {
+						items = append(items, record.All[i])
+					}
+					table.add(items)
+					if perColumn {
+						for i, c := range columns {
+							c.add(record.All[i : i+1])
+						}
+					}
+				}
+
+				readerReport(&config, csvReader, file)
+			}
+
+			if table == nil {
+				table = newTableChecksum(ordered)
+			}
+			if perColumn {
+				for _, i := range order {
+					checkError(writer.Write([]string{file, header[i], columns[i].sum()}))
+				}
+				continue
+			}
+			checkError(writer.Write([]string{file, strconv.Itoa(nRows), strconv.Itoa(len(header)), table.sum()}))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(checksumCmd)
+
+	checksumCmd.Flags().BoolP("sort-columns", "s", false, `sort columns by names, so the column order does not matter`)
+	checksumCmd.Flags().BoolP("ordered", "", false, `the order of rows matters`)
+	checksumCmd.Flags().BoolP("per-column", "c", false, `output hashes of each column`)
+}
+
+// tableChecksum computes the hash of rows. Hashes of rows are added
+// as 4 uint64 lanes for a row-order-insensitive hash, or written to a
+// running hash if ordered.
+type tableChecksum struct {
+	ordered bool
+	running hash.Hash
+	lanes   [4]uint64
+	head    []byte
+	n       uint64
+	buf     []byte
+}
+
+func newTableChecksum(ordered bool) *tableChecksum {
+	return &tableChecksum{ordered: ordered, running: sha256.New(), buf: make([]byte, 0, 1024)}
+}
+
+// encode encodes values with lengths prefixed, so that ["a,b"] and
+// ["a", "b"] are different.
+func (c *tableChecksum) encode(values []string) []byte {
+	c.buf = binary.AppendUvarint(c.buf[:0], uint64(len(values)))
+	for _, v := range values {
+		c.buf = binary.AppendUvarint(c.buf, uint64(len(v)))
+		c.buf = append(c.buf, v...)
+	}
+	return c.buf
+}
+
+func (c *tableChecksum) header(values []string) {
+	h := sha256.Sum256(c.encode(values))
+	c.head = h[:]
+}
+
+func (c *tableChecksum) add(values []string) {
+	c.n++
+	if c.ordered {
+		c.running.Write(c.encode(values))
+		return
+	}
+	h := sha256.Sum256(c.encode(values))
+	for i := range c.lanes {
+		c.lanes[i] += binary.BigEndian.Uint64(h[i*8 : i*8+8])
+	}
+}
+
+func (c *tableChecksum) sum() string {
+	h := sha256.New()
+	h.Write(c.head)
+	h.Write(binary.BigEndian.AppendUint64(nil, c.n))
+	if c.ordered {
+		h.Write(c.running.Sum(nil))
+	} else {
+		for _, l := range c.lanes {
+			h.Write(binary.BigEndian.AppendUint64(nil, l))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,426 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// clusterCmd represents the cluster command
+var clusterCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:   "cluster",
+	Short: "cluster records by numeric fields with k-means or hierarchical clustering",
+	Long: `cluster records by numeric fields with k-means or hierarchical clustering
+
+Methods (-m/--method):
+
+  kmeans    k-means with k-means++ initialization. The number of clusters
+            is given by -k/--k, or automatically selected with the elbow
+            method among 1 to --max-k if -k is 0.
+  single    hierarchical clustering with single linkage, clusters closer
+            than --threshold are merged
+  complete  hierarchical clustering with complete linkage, clusters
+            closer than --threshold are merged
+
+Distances are Euclidean distances of the selected fields, which are
+standardized to z-scores with -s/--scale. A column of cluster IDs is
+appended, numbered in the order of appearance. Records with non-numeric
+values get --na with -i/--ignore-non-numbers.
+
+Hierarchical clustering needs O(N^2) memory and is slow for large files.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		method := strings.ToLower(getFlagString(cmd, "method"))
+		k := getFlagNonNegativeInt(cmd, "k")
+		maxK := getFlagPositiveInt(cmd, "max-k")
+		threshold := getFlagFloat64(cmd, "threshold")
+		switch method {
+		case "kmeans":
+		case "single", "complete":
+			if !cmd.Flags().Changed("threshold") {
+				checkError(fmt.Errorf("flag --threshold needed for method: %s", method))
+			}
+		default:
+			checkError(fmt.Errorf("invalid method: %s. available: kmeans, single, complete", method))
+		}
+		maxIter := getFlagPositiveInt(cmd, "max-iter")
+		nInit := getFlagPositiveInt(cmd, "n-init")
+		scale := getFlagBool(cmd, "scale")
+		name := getFlagString(cmd, "name")
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+		na := getFlagString(cmd, "na")
+		rnd := rand.New(rand.NewSource(getFlagInt64(cmd, "rand-seed")))
+
+		file := files[0]
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+		if header == nil {
+			return
+		}
+
+		fields := selectFieldsByHeader(header, fieldStr, fuzzyFields)
+
+		// points
+		points := make([][]float64, 0, len(data))
+		rows := make([]int, 0, len(data)) // rows of points
+		for r, record := range data {
+			p := make([]float64, len(fields))
+			ok := true
+			for j, f := range fields {
+				v := record[f-1]
+				if !reDigitals.MatchString(v) {
+					if ignore {
+						ok = false
+						break
+					}
+					checkError(fmt.Errorf("column %s has non-numeric data: %s, you can use flag -i/--ignore-non-numbers to skip these data", header[f-1], v))
+				}
+				p[j], err = strconv.ParseFloat(removeComma(v), 64)
+				checkError(err)
+			}
+			if ok {
+				points = append(points, p)
+				rows = append(rows, r)
+			}
+		}
+		if scale {
+			clusterScale(points)
+		}
+
+		var labels []int
+		switch {
+		case len(points) == 0:
+		case method == "kmeans":
+			if k == 0 {
+				k = clusterElbow(rnd, points, min(maxK, len(points)), maxIter, nInit)
+				if config.Verbose {
+					log.Infof("number of clusters selected by the elbow method: %d", k)
+				}
+			}
+			labels, _ = kmeansBest(rnd, points, min(k, len(points)), maxIter, nInit)
+		default:
+			labels = hierarchicalClusters(points, threshold, method == "complete")
+		}
+
+		// renumber clusters in the order of appearance
+		ids := make(map[int]int, 16)
+		clusters := make([]string, len(data))
+		for i := range clusters {
+			clusters[i] = na
+		}
+		for i, l := range labels {
+			if _, ok := ids[l]; !ok {
+				ids[l] = len(ids) + 1
+			}
+			clusters[rows[i]] = strconv.Itoa(ids[l])
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if !config.NoHeaderRow && !config.NoOutHeader {
+			checkError(writer.Write(append(header, name)))
+		}
+		for r, record := range data {
+			checkError(writer.Write(append(record, clusters[r])))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(clusterCmd)
+	clusterCmd.Flags().StringP("fields", "f", "", `numeric fields for clustering. e.g -f 1,2 or -f columnA,columnB`)
+	clusterCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	clusterCmd.Flags().StringP("method", "m", "kmeans", `clustering method: kmeans, single, complete`)
+	clusterCmd.Flags().IntP("k", "k", 0, `number of clusters for k-means, 0 for selecting with the elbow method`)
+	clusterCmd.Flags().IntP("max-k", "", 10, `the maximum number of clusters for the elbow method`)
+	clusterCmd.Flags().Float64P("threshold", "", 0, `distance threshold for hierarchical clustering`)
+	clusterCmd.Flags().IntP("max-iter", "", 100, `the maximum number of iterations of k-means`)
+	clusterCmd.Flags().IntP("n-init", "", 5, `the number of k-means runs with different initial centroids, the best one is kept`)
+	clusterCmd.Flags().BoolP("scale", "s", false, `standardize fields to z-scores`)
+	clusterCmd.Flags().StringP("name", "n", "cluster", `name of the cluster column`)
+	clusterCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore records with non-numeric values like "NA" or "N/A"`)
+	clusterCmd.Flags().StringP("na", "", "", `cluster ID for records with non-numeric values`)
+	clusterCmd.Flags().Int64P("rand-seed", "", 11, `rand seed for k-means`)
+}
+
+// clusterScale standardizes each dimension to z-scores.
+func clusterScale(points [][]float64) {
+	vals := make([]float64, len(points))
+	for j := range points[0] {
+		for i, p := range points {
+			vals[i] = p[j]
+		}
+		mean := allStats["mean"](vals)
+		sd := allStats["stdev"](vals)
+		for _, p := range points {
+			if sd > 0 {
+				p[j] = (p[j] - mean) / sd
+			} else {
+				p[j] = 0
+			}
+		}
+	}
+}
+
+func squaredDistance(a, b []float64) float64 {
+	var d, s float64
+	for i := range a {
+		d = a[i] - b[i]
+		s += d * d
+	}
+	return s
+}
+
+// kmeansBest runs k-means n times and returns labels of the run with
+// the minimal within-cluster sum of squares.
+func kmeansBest(rnd *rand.Rand, points [][]float64, k, maxIter, n int) ([]int, float64) {
+	var best []int
+	bestSSE := math.Inf(1)
+	for i := 0; i < n; i++ {
+		labels, sse := kmeans(rnd, points, k, maxIter)
+		if sse < bestSSE {
+			best, bestSSE = labels, sse
+		}
+	}
+	return best, bestSSE
+}
+
+// kmeans clusters points with k-means++ initialization.
+func kmeans(rnd *rand.Rand, points [][]float64, k, maxIter int) ([]int, float64) {
+	dim := len(points[0])
+
+	// k-means++
+	centroids := make([][]float64, 0, k)
+	centroids = append(centroids, append([]float64{}, points[rnd.Intn(len(points))]...))
+	dists := make([]float64, len(points))
+	for len(centroids) < k {
+		var sum float64
+		for i, p := range points {
+			dists[i] = math.Inf(1)
+			for _, c := range centroids {
+				dists[i] = math.Min(dists[i], squaredDistance(p, c))
+			}
+			sum += dists[i]
+		}
+		next := rnd.Intn(len(points))
+		if sum > 0 {
+			t := rnd.Float64() * sum
+			for i, d := range dists {
+				t -= d
+				if t <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, append([]float64{}, points[next]...))
+	}
+
+	labels := make([]int, len(points))
+	counts := make([]int, k)
+	var sse float64
+	for iter := 0; iter < maxIter; iter++ {
+		changed := false
+		sse = 0
+		for i, p := range points {
+			best, bestD := 0, math.Inf(1)
+			for j, c := range centroids {
+				if d := squaredDistance(p, c); d < bestD {
+					best, bestD = j, d
+				}
+			}
+			if labels[i] != best || iter == 0 {
+				changed = true
+			}
+			labels[i] = best
+			sse += bestD
+		}
+		if !changed {
+			break
+		}
+
+		for j := range centroids {
+			counts[j] = 0
+			for d := 0; d < dim; d++ {
+				centroids[j][d] = 0
+			}
+		}
+		for i, p := range points {
+			counts[labels[i]]++
+			for d := 0; d < dim; d++ {
+				centroids[labels[i]][d] += p[d]
+			}
+		}
+		for j := range centroids {
+			if counts[j] == 0 { // empty cluster, reset to a random point
+				copy(centroids[j], points[rnd.Intn(len(points))])
+				continue
+			}
+			for d := 0; d < dim; d++ {
+				centroids[j][d] /= float64(counts[j])
+			}
+		}
+	}
+	return labels, sse
+}
+
+// clusterElbow selects k at the point of the SSE curve farthest from
+// the line between the first and last points, with both axes normalized.
+func clusterElbow(rnd *rand.Rand, points [][]float64, maxK, maxIter, n int) int {
+	if maxK <= 2 {
+		return maxK
+	}
+	sses := make([]float64, maxK+1)
+	for k := 1; k <= maxK; k++ {
+		_, sses[k] = kmeansBest(rnd, points, k, maxIter, n)
+	}
+	if sses[1] <= sses[maxK] {
+		return 1
+	}
+	best, bestD := 1, 0.0
+	var x, y, d float64
+	for k := 2; k < maxK; k++ {
+		x = float64(k-1) / float64(maxK-1)
+		y = (sses[k] - sses[maxK]) / (sses[1] - sses[maxK])
+		if d = 1 - x - y; d > bestD {
+			best, bestD = k, d
+		}
+	}
+	return best
+}
+
+// hierarchicalClusters merges clusters closer than the threshold with
+// single or complete linkage.
+func hierarchicalClusters(points [][]float64, threshold float64, complete bool) []int {
+	n := len(points)
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = i
+	}
+
+	if !complete { // single linkage: connected components
+		var find func(int) int
+		find = func(i int) int {
+			for labels[i] != i {
+				labels[i] = labels[labels[i]]
+				i = labels[i]
+			}
+			return i
+		}
+		t2 := threshold * threshold
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				if squaredDistance(points[i], points[j]) <= t2 {
+					if a, b := find(i), find(j); a != b {
+						labels[b] = a
+					}
+				}
+			}
+		}
+		for i := range labels {
+			labels[i] = find(i)
+		}
+		return labels
+	}
+
+	// complete linkage with a distance matrix
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			dist[i][j] = math.Sqrt(squaredDistance(points[i], points[j]))
+			dist[j][i] = dist[i][j]
+		}
+	}
+	active := make([]bool, n)
+	for i := range active {
+		active[i] = true
+	}
+	for {
+		a, b, best := -1, -1, math.Inf(1)
+		for i := 0; i < n; i++ {
+			if !active[i] {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if active[j] && dist[i][j] < best {
+					a, b, best = i, j, dist[i][j]
+				}
+			}
+		}
+		if a < 0 || best > threshold {
+			break
+		}
+		// merge b into a
+		active[b] = false
+		for i := 0; i < n; i++ {
+			if active[i] && i != a {
+				dist[a][i] = math.Max(dist[a][i], dist[b][i])
+				dist[i][a] = dist[a][i]
+			}
+		}
+		for i := range labels {
+			if labels[i] == b {
+				labels[i] = a
+			}
+		}
+	}
+	return labels
+}
@@ -54,11 +54,11 @@ var combCmd = &cobra.Command{
 		number0 := getFlagNonNegativeInt(cmd, "number")
 		ignoreCase := getFlagBool(cmd, "ignore-case")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -93,7 +93,7 @@ var combCmd = &cobra.Command{
 		m = make(map[string]interface{}, 1024)
 
 		for _, file := range files {
-			fh, err = xopen.Ropen(file)
+			fh, err = ropen(file)
 			if err != nil {
 				checkError(fmt.Errorf("reading file %s: %s", file, err))
 			}
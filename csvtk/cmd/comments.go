@@ -0,0 +1,197 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/shenwei356/xopen"
+)
+
+// parseCommentChar parses the value of -C/--comment-char. A prefix of
+// multiple characters, e.g., "##" for metadata lines of VCF files, is
+// returned as a string, with the rune being 0.
+func parseCommentChar(s string) (rune, string) {
+	switch utf8.RuneCountInString(s) {
+	case 0:
+		return 0, ""
+	case 1:
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, ""
+	}
+	return 0, s
+}
+
+// commentPrefix returns the prefix of comment lines, "" for none.
+func (config Config) commentPrefix() string {
+	if config.CommentPrefix != "" {
+		return config.CommentPrefix
+	}
+	if config.CommentChar != 0 {
+		return string(config.CommentChar)
+	}
+	return ""
+}
+
+// commentsMode is how comment lines at the top of input files are handled:
+// "strip", "keep" or "sidecar", set by the global flag --comments.
+var commentsMode = "strip"
+
+// leadingComments are comment lines at the top of the first input file
+// having them.
+var leadingComments struct {
+	sync.Mutex
+	lines    []string
+	captured bool
+}
+
+// setComments sets how to handle comment lines at the top of input files.
+// For "sidecar", the lines are written to the file, which is the output file
+// plus ".comments" if not given.
+func setComments(mode string, file string, outFile string) error {
+	switch mode {
+	case "strip", "keep":
+	case "sidecar":
+		if file == "" {
+			if isStdin(outFile) {
+				return fmt.Errorf("flag --comments-file needed for --comments sidecar with stdout")
+			}
+			file = outFile + ".comments"
+		}
+		commentsFile = file
+	default:
+		return fmt.Errorf("unsupported value of flag --comments: %s. available: strip, keep, sidecar", mode)
+	}
+	commentsMode = mode
+	return nil
+}
+
+// commentsFile is the sidecar file of comment lines.
+var commentsFile string
+
+// captureComments reads comment lines at the top of a file, which are
+// kept for the CSV output or written to the sidecar file. Only the first file
+// having comment lines is captured.
+func captureComments(fh *bufio.Reader, prefix string) error {
+	if commentsMode == "strip" || prefix == "" {
+		return nil
+	}
+	leadingComments.Lock()
+	defer leadingComments.Unlock()
+	if leadingComments.captured {
+		return nil
+	}
+
+	var lines []string
+	for {
+		b, _ := fh.Peek(len(prefix))
+		if !bytes.Equal(b, []byte(prefix)) {
+			break
+		}
+		line, err := fh.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	leadingComments.captured = true
+
+	if commentsMode == "sidecar" {
+		outfh, err := xopen.Wopen(commentsFile)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			outfh.WriteString(line + "\n")
+		}
+		return outfh.Close()
+	}
+	leadingComments.lines = lines
+	return nil
+}
+
+// keptComments returns comment lines to write before the CSV output.
+func keptComments() []string {
+	if commentsMode != "keep" {
+		return nil
+	}
+	leadingComments.Lock()
+	defer leadingComments.Unlock()
+	return leadingComments.lines
+}
+
+// commentFilter removes lines starting with a prefix of multiple characters,
+// which are not supported by encoding/csv.
+type commentFilter struct {
+	r      *bufio.Reader
+	prefix []byte
+	buf    []byte
+}
+
+func newCommentFilter(r io.Reader, prefix string) *commentFilter {
+	return &commentFilter{r: bufio.NewReaderSize(r, 1<<16), prefix: []byte(prefix)}
+}
+
+func (f *commentFilter) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		line, err := f.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull { // a long line
+			f.buf = append(f.buf[:0], line...)
+			for err == bufio.ErrBufferFull {
+				line, err = f.r.ReadSlice('\n')
+				f.buf = append(f.buf, line...)
+			}
+			if bytes.HasPrefix(f.buf, f.prefix) {
+				f.buf = f.buf[:0]
+			}
+		} else if !bytes.HasPrefix(line, f.prefix) {
+			f.buf = append(f.buf[:0], line...)
+		}
+		if err != nil {
+			if len(f.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// writeKeptComments writes comment lines kept for the CSV output.
+func writeKeptComments(w io.Writer) {
+	for _, line := range keptComments() {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			checkError(err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/shenwei356/xopen"
+	"github.com/ulikunitz/xz"
+)
+
+// compressionFormats maps compression formats to file extensions.
+var compressionFormats = map[string]string{
+	"gzip":  ".gz",
+	"zstd":  ".zst",
+	"bzip2": ".bz2",
+	"xz":    ".xz",
+	"lz4":   ".lz4",
+	"none":  "",
+}
+
+// compressionFormatByExt returns the compression format of a file by its extension.
+func compressionFormatByExt(file string) string {
+	file = strings.ToLower(file)
+	for format, ext := range compressionFormats {
+		if ext != "" && strings.HasSuffix(file, ext) {
+			return format
+		}
+	}
+	return "none"
+}
+
+var lz4Magic = []byte{0x04, 0x22, 0x4d, 0x18}
+
+// readCloser combines a reader and the closer of the underlying file.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// inCompress is the compression format of input files given by
+// --in-compress. An empty string means detecting by magic numbers.
+var inCompress string
+
+// setInputCompression sets the compression format of input files.
+func setInputCompression(format string) error {
+	switch format {
+	case "", "auto":
+		format = ""
+	case "gz":
+		format = "gzip"
+	case "zst":
+		format = "zstd"
+	case "bz2":
+		format = "bzip2"
+	}
+	if _, ok := compressionFormats[format]; format != "" && !ok {
+		return fmt.Errorf("unsupported input compression format: %s. available: auto, gzip, zstd, bzip2, xz, lz4, none", format)
+	}
+	inCompress = format
+	return nil
+}
+
+// inCompressed returns true if a compression format is given by --in-compress.
+func inCompressed() bool {
+	return inCompress != "" && inCompress != "none"
+}
+
+// ropen opens a local file, stdin, a http(s) URL or an object-store URL
+// for buffered reading. Compression formats supported by xopen
+// (gzip, xz, zstd, bzip2) and lz4 are detected automatically,
+// unless the format is given by --in-compress. Data are transcoded to
+// UTF-8 for --in-encoding.
+func ropen(file string) (*xopen.Reader, error) {
+	return openInput(file, true)
+}
+
+// ropenRaw is like ropen, but data are not transcoded, for binary formats.
+func ropenRaw(file string) (*xopen.Reader, error) {
+	return openInput(file, false)
+}
+
+// wopen opens a file for writing via xopen.Wopen, or an in-memory file of
+// subcommands run in the same process.
+func wopen(file string) (*xopen.Writer, error) {
+	if mf := getMemFile(file); mf != nil {
+		return mf.writer(), nil
+	}
+	return xopen.Wopen(file)
+}
+
+func openInput(file string, decode bool) (*xopen.Reader, error) {
+	var rc io.ReadCloser
+	var err error
+	if mf := getMemFile(file); mf != nil {
+		return newXopenReader(mf.csvReader())
+	}
+	switch {
+	case file == "-":
+		if !xopen.IsStdin() {
+			return nil, errors.New("stdin not detected")
+		}
+		rc = os.Stdin
+	case strings.HasPrefix(file, "|"):
+		return xopen.Ropen(file)
+	case isObjectURL(file):
+		rc, err = openObject(file)
+	default:
+		var r io.Reader
+		r, err = xopen.XReader(file)
+		if err == nil {
+			rc = r.(io.ReadCloser)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if showProgress {
+		var size int64
+		if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+			size = fi.Size()
+		}
+		rc = newProgressReader(rc, file, size)
+	}
+
+	br := bufio.NewReaderSize(rc, 1<<16)
+	if inCompress != "" {
+		r, err := newDecompressReader(br, inCompress)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("failed to read %s as %s: %s", file, inCompress, err)
+		}
+		if decode && decodingInput() {
+			r = decodeInput(r)
+		}
+		return newXopenReader(&eofCloser{Reader: r, c: rc})
+	}
+	var fh *xopen.Reader
+	if magic, _ := br.Peek(len(lz4Magic)); bytes.Equal(magic, lz4Magic) {
+		fh, err = xopen.Buf(&readCloser{Reader: lz4.NewReader(br), Closer: rc})
+	} else {
+		fh, err = xopen.Buf(&readCloser{Reader: br, Closer: rc})
+	}
+	if err != nil || !decode || !decodingInput() {
+		return fh, err
+	}
+	// transcoding after decompression by xopen
+	return newXopenReader(&eofCloser{Reader: decodeInput(fh), c: fh})
+}
+
+// newDecompressReader returns a reader decompressing data of a given format.
+func newDecompressReader(r io.Reader, format string) (io.Reader, error) {
+	switch format {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		return zstd.NewReader(r)
+	case "bzip2":
+		return bzip2.NewReader(r, &bzip2.ReaderConfig{})
+	case "xz":
+		return xz.NewReader(r)
+	case "lz4":
+		return lz4.NewReader(r), nil
+	}
+	return r, nil
+}
+
+// newXopenReader creates a xopen.Reader without detecting the compression
+// format, while the BOM is still removed. Its Close() does nothing,
+// so the underlying file should be closed by eofCloser.
+func newXopenReader(r io.Reader) (*xopen.Reader, error) {
+	b := bufio.NewReaderSize(r, 1<<16)
+	t, _, err := b.ReadRune()
+	if err != nil {
+		if err == io.EOF {
+			return nil, xopen.ErrNoContent
+		}
+		return nil, err
+	}
+	if t != '\uFEFF' {
+		b.UnreadRune()
+	}
+	return &xopen.Reader{Reader: b}, nil
+}
+
+// eofCloser closes the underlying file when reaching the end.
+type eofCloser struct {
+	io.Reader
+	c io.Closer
+}
+
+func (r *eofCloser) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && r.c != nil {
+		r.c.Close()
+		r.c = nil
+	}
+	return n, err
+}
+
+// readAllDecompressed reads all data of a file, decompressed in the format
+// given by --in-compress. It's used for binary formats which need random
+// access, e.g., Parquet and XLSX.
+func readAllDecompressed(file string) ([]byte, error) {
+	fh, err := ropenRaw(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(fh)
+	if err != nil {
+		return nil, err
+	}
+	return data, fh.Close()
+}
+
+// newCompressWriter returns a writer compressing data into w.
+// level < 0 means the default level of each format.
+func newCompressWriter(w io.Writer, format string, level int) (io.WriteCloser, error) {
+	checkLevel := func(min, max int) error {
+		if level >= 0 && (level < min || level > max) {
+			return fmt.Errorf("invalid compression level for %s: %d, available: %d-%d", format, level, min, max)
+		}
+		return nil
+	}
+	switch format {
+	case "gzip":
+		if level < 0 {
+			level = gzip.DefaultCompression
+		} else if err := checkLevel(1, 9); err != nil {
+			return nil, err
+		}
+		return gzip.NewWriterLevel(w, level)
+	case "zstd":
+		if err := checkLevel(1, 22); err != nil {
+			return nil, err
+		}
+		if level < 0 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	case "bzip2":
+		if level < 0 {
+			level = 6
+		} else if err := checkLevel(1, 9); err != nil {
+			return nil, err
+		}
+		return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: level})
+	case "xz":
+		if level >= 0 {
+			return nil, fmt.Errorf("compression level not supported for xz")
+		}
+		return xz.NewWriter(w)
+	case "lz4":
+		if err := checkLevel(0, 9); err != nil {
+			return nil, err
+		}
+		zw := lz4.NewWriter(w)
+		if level > 0 {
+			if err := zw.Apply(lz4.CompressionLevelOption(lz4.CompressionLevel(1 << (8 + level - 1)))); err != nil {
+				return nil, err
+			}
+		}
+		return zw, nil
+	case "none":
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression format: %s. available: gzip, zstd, bzip2, xz, lz4, none", format)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressedOutput is used when the output is compressed by csvtk instead
+// of xopen. The stdout is replaced with a pipe, data from which are
+// compressed and written to the real stdout or the output file.
+var compressedOutput struct {
+	w    *os.File
+	done chan error
+}
+
+// setOutputCompression compresses the output in a format given by
+// --compress or the file extension, and returns the new output file "-".
+// It's only needed for formats not supported by xopen, or when
+// --compress or --compress-level is given.
+func setOutputCompression(outFile string, format string, level int) (string, error) {
+	if compressedOutput.w != nil { // already set
+		return "-", nil
+	}
+
+	if format == "" {
+		format = "none"
+		if !isStdin(outFile) {
+			format = compressionFormatByExt(outFile)
+		}
+		if format != "lz4" && level < 0 {
+			return outFile, nil
+		}
+	} else if _, ok := compressionFormats[format]; !ok {
+		return outFile, fmt.Errorf("unsupported compression format: %s. available: gzip, zstd, bzip2, xz, lz4, none", format)
+	}
+
+	var dst *os.File
+	var err error
+	if isStdin(outFile) {
+		dst = os.Stdout
+	} else {
+		if err = os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+			return outFile, err
+		}
+		if dst, err = os.Create(outFile); err != nil {
+			return outFile, err
+		}
+	}
+
+	zw, err := newCompressWriter(dst, format, level)
+	if err != nil {
+		return outFile, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return outFile, err
+	}
+	os.Stdout = w
+
+	compressedOutput.w = w
+	compressedOutput.done = make(chan error, 1)
+	go func() {
+		_, err := io.Copy(zw, r)
+		if err2 := zw.Close(); err == nil {
+			err = err2
+		}
+		if dst != os.Stdout {
+			if err2 := dst.Close(); err == nil {
+				err = err2
+			}
+		}
+		compressedOutput.done <- err
+	}()
+
+	return "-", nil
+}
+
+// FinishOutputCompression waits for the compression of the output to finish.
+func FinishOutputCompression() error {
+	if compressedOutput.w == nil {
+		return nil
+	}
+	if err := compressedOutput.w.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return <-compressedOutput.done
+}
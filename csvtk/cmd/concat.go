@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"runtime"
 
 	"github.com/shenwei356/xopen"
@@ -49,7 +48,7 @@ so only columns match that of the first files kept.
 		keepUnmatched := getFlagBool(cmd, "keep-unmatched")
 		UnmatchedRepl := getFlagString(cmd, "unmatched-repl")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -118,7 +117,7 @@ so only columns match that of the first files kept.
 			return
 		}
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
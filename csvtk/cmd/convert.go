@@ -0,0 +1,321 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "convert",
+	Short: "convert units of length, mass, temperature, data sizes and durations",
+	Long: `convert units of length, mass, temperature, data sizes and durations
+
+Units are case-sensitive, e.g., "b" for bits and "B" for bytes, and should be
+of the same quantity. Type "csvtk convert --list-units" for all units.
+
+The conversion is also available in "csvtk mutate2" and "csvtk filter2" as
+the function convert(value, from, to), e.g.,
+
+    csvtk mutate2 -n weight_kg -e 'convert($weight, "lb", "kg")'
+
+Values that are not numbers are kept unchanged.
+
+Examples:
+
+    csvtk convert -f weight --from lb --to kg
+    csvtk convert -f temp --from F --to C -n 1
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if getFlagBool(cmd, "list-units") {
+			listUnits()
+			return
+		}
+
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+
+		from := getFlagString(cmd, "from")
+		to := getFlagString(cmd, "to")
+		if from == "" || to == "" {
+			checkError(fmt.Errorf("flags --from and --to needed"))
+		}
+		_, err := convertUnit(0, from, to)
+		checkError(err)
+
+		decimalWidth := getFlagInt(cmd, "decimal-width")
+		if decimalWidth < -1 {
+			checkError(fmt.Errorf("value of flag -n/--decimal-width should be >= -1"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk convert: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr:    fieldStr,
+				FuzzyFields: fuzzyFields,
+			})
+
+			convert := func() func(*Record) bool {
+				return func(record *Record) bool {
+					for _, f := range record.Fields {
+						v, err := strconv.ParseFloat(removeComma(strings.TrimSpace(record.All[f-1])), 64)
+						if err != nil {
+							continue
+						}
+						v, _ = convertUnit(v, from, to)
+						record.All[f-1] = strconv.FormatFloat(v, 'f', decimalWidth, 64)
+					}
+					return true
+				}
+			}
+
+			writeHeader := func(record Record) { // do not replace head line
+				if !config.NoOutHeader {
+					checkError(writer.Write(record.All))
+				}
+			}
+
+			for record := range parallelRecords(csvReader.Ch, config.NumCPUs, config.NoHeaderRow, writeHeader, convert) {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+				checkError(writer.Write(record.All))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringP("fields", "f", "1", `select only these fields. e.g -f 1,2 or -f columnA,columnB`)
+	convertCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	convertCmd.Flags().StringP("from", "", "", `unit of input values, e.g., lb`)
+	convertCmd.Flags().StringP("to", "", "", `unit of output values, e.g., kg`)
+	convertCmd.Flags().IntP("decimal-width", "n", -1, `limit floats to N decimal points, -1 for the shortest representation`)
+	convertCmd.Flags().BoolP("list-units", "", false, `list all supported units`)
+}
+
+// unit is a unit of a quantity, with the factor to the base unit of the quantity.
+type unit struct {
+	quantity string
+	factor   float64
+}
+
+// units are supported units. Temperatures are handled by convertTemperature.
+var units = map[string]unit{
+	// length, in meters
+	"nm":  {"length", 1e-9},
+	"um":  {"length", 1e-6},
+	"mm":  {"length", 1e-3},
+	"cm":  {"length", 1e-2},
+	"dm":  {"length", 1e-1},
+	"m":   {"length", 1},
+	"km":  {"length", 1e3},
+	"in":  {"length", 0.0254},
+	"ft":  {"length", 0.3048},
+	"yd":  {"length", 0.9144},
+	"mi":  {"length", 1609.344},
+	"nmi": {"length", 1852},
+
+	// mass, in kilograms
+	"ug": {"mass", 1e-9},
+	"mg": {"mass", 1e-6},
+	"g":  {"mass", 1e-3},
+	"kg": {"mass", 1},
+	"t":  {"mass", 1e3},
+	"oz": {"mass", 0.028349523125},
+	"lb": {"mass", 0.45359237},
+	"st": {"mass", 6.35029318},
+
+	// temperature
+	"C": {"temperature", 0},
+	"F": {"temperature", 0},
+	"K": {"temperature", 0},
+	"R": {"temperature", 0},
+
+	// data size, in bytes
+	"b":   {"data size", 0.125},
+	"B":   {"data size", 1},
+	"kB":  {"data size", 1e3},
+	"MB":  {"data size", 1e6},
+	"GB":  {"data size", 1e9},
+	"TB":  {"data size", 1e12},
+	"PB":  {"data size", 1e15},
+	"KiB": {"data size", 1 << 10},
+	"MiB": {"data size", 1 << 20},
+	"GiB": {"data size", 1 << 30},
+	"TiB": {"data size", 1 << 40},
+	"PiB": {"data size", 1 << 50},
+
+	// duration, in seconds
+	"ns":  {"duration", 1e-9},
+	"us":  {"duration", 1e-6},
+	"ms":  {"duration", 1e-3},
+	"s":   {"duration", 1},
+	"min": {"duration", 60},
+	"h":   {"duration", 3600},
+	"d":   {"duration", 86400},
+	"wk":  {"duration", 604800},
+}
+
+// convertUnit converts a value between two units of the same quantity.
+func convertUnit(v float64, from, to string) (float64, error) {
+	u1, ok := units[from]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit: %s", from)
+	}
+	u2, ok := units[to]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit: %s", to)
+	}
+	if u1.quantity != u2.quantity {
+		return 0, fmt.Errorf("incompatible units: %s (%s) and %s (%s)", from, u1.quantity, to, u2.quantity)
+	}
+
+	if u1.quantity == "temperature" {
+		return convertTemperature(v, from, to), nil
+	}
+	return v * u1.factor / u2.factor, nil
+}
+
+// convertTemperature converts a temperature via Kelvin.
+func convertTemperature(v float64, from, to string) float64 {
+	switch from {
+	case "C":
+		v += 273.15
+	case "F":
+		v = (v + 459.67) * 5 / 9
+	case "R":
+		v = v * 5 / 9
+	}
+	switch to {
+	case "C":
+		v -= 273.15
+	case "F":
+		v = v*9/5 - 459.67
+	case "R":
+		v = v * 9 / 5
+	}
+	// remove the noise of floating-point arithmetic, e.g., 100C -> 373.15K -> 99.99999999999997C
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return v
+}
+
+// convertFunction is the expression function convert(value, from, to)
+// used in mutate2 and filter2.
+func convertFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("convert() needs 3 arguments: value, from, to")
+	}
+
+	var v float64
+	switch a := args[0].(type) {
+	case float64:
+		v = a
+	case string:
+		var err error
+		v, err = strconv.ParseFloat(removeComma(strings.TrimSpace(a)), 64)
+		if err != nil {
+			return nil, fmt.Errorf("convert(): not a number: %s", a)
+		}
+	default:
+		return nil, fmt.Errorf("convert(): not a number: %v", a)
+	}
+
+	from, ok1 := args[1].(string)
+	to, ok2 := args[2].(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("convert(): units should be strings")
+	}
+	return convertUnit(v, from, to)
+}
+
+func listUnits() {
+	quantities := make(map[string][]string)
+	for name, u := range units {
+		quantities[u.quantity] = append(quantities[u.quantity], name)
+	}
+	names := make([]string, 0, len(quantities))
+	for q := range quantities {
+		names = append(names, q)
+	}
+	sort.Strings(names)
+
+	for _, q := range names {
+		us := quantities[q]
+		sort.Slice(us, func(i, j int) bool {
+			fi, fj := units[us[i]].factor, units[us[j]].factor
+			if fi == fj {
+				return us[i] < us[j]
+			}
+			return fi < fj
+		})
+		fmt.Printf("%-12s %s\n", q+":", strings.Join(us, ", "))
+	}
+}
@@ -17,20 +17,26 @@
 // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
-
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"gonum.org/v1/gonum/mat"
 	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
 )
 
 // corrCmd represents the corr command
@@ -38,8 +44,30 @@ var corrCmd = &cobra.Command{
 	GroupID: "info",
 
 	Use:   "corr",
-	Short: "calculate Pearson correlation between two columns",
-	Long:  "calculate Pearson correlation between two columns",
+	Short: "calculate correlations or covariances between columns",
+	Long: `calculate correlations or covariances between columns
+
+All pairs of selected columns are computed after reading the data once.
+By default, all numeric columns are used, i.e., columns with at least one
+numeric value.
+
+Methods (-m/--method):
+  pearson   Pearson correlation coefficient
+  spearman  Spearman's rank correlation coefficient, with average ranks for ties
+  kendall   Kendall's tau-b, with ties adjusted
+
+Output formats (--out-format):
+  pairs     one pair per line: field1, field2, value. Written to stderr
+            to work with -x/--pass.
+  matrix    a square matrix with column names in the first row and column
+  long      all ordered pairs in the long format: field1, field2, value,
+            which is easy to plot or filter
+
+Use --cov to compute covariances instead of Pearson correlations,
+and --heatmap to plot the matrix as a heatmap, the image format is
+determined by the file suffix: eps, jpg|jpeg, pdf, png, svg, and tif|tiff.
+
+`,
 
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -51,11 +79,40 @@ var corrCmd = &cobra.Command{
 		printPass := getFlagBool(cmd, "pass")
 		printLog := getFlagBool(cmd, "log")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		method := strings.ToLower(getFlagString(cmd, "method"))
+		switch method {
+		case "pearson", "spearman", "kendall":
+		default:
+			checkError(fmt.Errorf("invalid value of flag -m/--method: %s. available: pearson, spearman, kendall", method))
+		}
+		cov := getFlagBool(cmd, "cov")
+		if cov && method != "pearson" {
+			checkError(fmt.Errorf("flag --cov only works with the method pearson"))
+		}
+		outFormat := strings.ToLower(getFlagString(cmd, "out-format"))
+		switch outFormat {
+		case "pairs":
+		case "matrix", "long":
+			if printPass {
+				checkError(fmt.Errorf("flag -x/--pass only works with --out-format pairs"))
+			}
+		default:
+			checkError(fmt.Errorf("invalid value of flag --out-format: %s. available: pairs, matrix, long", outFormat))
+		}
+		decimalWidth := getFlagNonNegativeInt(cmd, "decimal-width")
+		decimalFormat := fmt.Sprintf("%%.%df", decimalWidth)
+		heatmapFile := getFlagString(cmd, "heatmap")
+
+		allColumns := printField == ""
+		if allColumns {
+			printField = "1-"
+		}
+
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -98,6 +155,7 @@ var corrCmd = &cobra.Command{
 		})
 
 		var data [][]float64
+		var numeric []bool
 		var i, f int
 		var val float64
 		var fields []int
@@ -117,6 +175,7 @@ var corrCmd = &cobra.Command{
 				for i = range record.Fields {
 					data[i] = make([]float64, 0, 1024)
 				}
+				numeric = make([]bool, len(record.Fields))
 				fields = record.Fields
 
 				if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
@@ -134,6 +193,7 @@ var corrCmd = &cobra.Command{
 				val, err = strconv.ParseFloat(removeComma(record.All[f-1]), 64)
 				if err == nil {
 					data[i] = append(data[i], transform(val))
+					numeric[i] = true
 				} else {
 					data[i] = append(data[i], math.NaN())
 				}
@@ -147,26 +207,80 @@ var corrCmd = &cobra.Command{
 
 		readerReport(&config, csvReader, file)
 
-		for col1, field1 := range fields {
-			for col2, field2 := range fields {
-				if col1 >= col2 {
+		// column names
+		names := make([]string, 0, len(fields))
+		cols := make([]int, 0, len(fields))
+		for col, field := range fields {
+			if allColumns && !numeric[col] {
+				continue
+			}
+			cols = append(cols, col)
+			if hasHeaderRow {
+				names = append(names, HeaderRow[field-1])
+			} else {
+				names = append(names, strconv.Itoa(field))
+			}
+		}
+
+		n := len(cols)
+		matrix := mat.NewSymDense(n, nil)
+		for a := 0; a < n; a++ {
+			for b := a; b < n; b++ {
+				if outFormat == "pairs" && heatmapFile == "" && a == b {
 					continue
 				}
-
-				d1, d2 := data[col1], data[col2]
+				d1, d2 := data[cols[a]], data[cols[b]]
 				if printIgnore {
 					d1, d2 = removeNaNs(d1, d2)
 				}
 
-				pearsonr := stat.Correlation(d1, d2, nil)
-
-				if hasHeaderRow {
-					fmt.Fprintf(os.Stderr, "%s\t%s\t%.4f\n", HeaderRow[field1-1], HeaderRow[field2-1], pearsonr)
-				} else {
-					fmt.Fprintf(os.Stderr, "%d\t%d\t%.4f\n", field1, field2, pearsonr)
+				switch {
+				case cov:
+					val = stat.Covariance(d1, d2, nil)
+				case method == "spearman":
+					val = spearmanCorrelation(d1, d2)
+				case method == "kendall":
+					val = kendallTauB(d1, d2)
+				default:
+					val = stat.Correlation(d1, d2, nil)
 				}
+				matrix.SetSym(a, b, val)
+			}
+		}
 
+		switch outFormat {
+		case "pairs":
+			for a := 0; a < n; a++ {
+				for b := a + 1; b < n; b++ {
+					fmt.Fprintf(os.Stderr, "%s\t%s\t"+decimalFormat+"\n", names[a], names[b], matrix.At(a, b))
+				}
+			}
+		case "matrix":
+			record := make([]string, n+1)
+			copy(record[1:], names)
+			checkError(writer.Write(record))
+			for a := 0; a < n; a++ {
+				record[0] = names[a]
+				for b := 0; b < n; b++ {
+					record[b+1] = fmt.Sprintf(decimalFormat, matrix.At(a, b))
+				}
+				checkError(writer.Write(record))
 			}
+		case "long":
+			valueName := method
+			if cov {
+				valueName = "cov"
+			}
+			checkError(writer.Write([]string{"field1", "field2", valueName}))
+			for a := 0; a < n; a++ {
+				for b := 0; b < n; b++ {
+					checkError(writer.Write([]string{names[a], names[b], fmt.Sprintf(decimalFormat, matrix.At(a, b))}))
+				}
+			}
+		}
+
+		if heatmapFile != "" {
+			checkError(plotCorrHeatmap(matrix, names, !cov, heatmapFile))
 		}
 	},
 }
@@ -186,11 +300,193 @@ func removeNaNs(d1, d2 []float64) ([]float64, []float64) {
 	return r1, r2
 }
 
+// hasNaN returns true if any value is NaN.
+func hasNaN(s []float64) bool {
+	for _, v := range s {
+		if math.IsNaN(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// averageRanks returns 1-based ranks, tied values get the average rank.
+func averageRanks(x []float64) []float64 {
+	idx := make([]int, len(x))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return x[idx[i]] < x[idx[j]] })
+
+	ranks := make([]float64, len(x))
+	var j int
+	var r float64
+	for i := 0; i < len(idx); i = j {
+		for j = i + 1; j < len(idx) && x[idx[j]] == x[idx[i]]; j++ {
+		}
+		r = float64(i+j+1) / 2 // average of ranks i+1 .. j
+		for k := i; k < j; k++ {
+			ranks[idx[k]] = r
+		}
+	}
+	return ranks
+}
+
+// spearmanCorrelation returns Spearman's rank correlation coefficient.
+func spearmanCorrelation(x, y []float64) float64 {
+	if hasNaN(x) || hasNaN(y) {
+		return math.NaN()
+	}
+	return stat.Correlation(averageRanks(x), averageRanks(y), nil)
+}
+
+// kendallTauB returns Kendall's tau-b, computed in O(nlogn) with Knight's algorithm.
+func kendallTauB(x, y []float64) float64 {
+	n := len(x)
+	if n < 2 || hasNaN(x) || hasNaN(y) {
+		return math.NaN()
+	}
+
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		if x[idx[i]] == x[idx[j]] {
+			return y[idx[i]] < y[idx[j]]
+		}
+		return x[idx[i]] < x[idx[j]]
+	})
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	for i, k := range idx {
+		xs[i], ys[i] = x[k], y[k]
+	}
+
+	// pairs tied in x (n1), and tied in both x and y (n3)
+	var n1, n2, n3, t int64
+	var j, l int
+	for i := 0; i < n; i = j {
+		for j = i + 1; j < n && xs[j] == xs[i]; j++ {
+		}
+		t = int64(j - i)
+		n1 += t * (t - 1) / 2
+
+		for k := i; k < j; k = l {
+			for l = k + 1; l < j && ys[l] == ys[k]; l++ {
+			}
+			t = int64(l - k)
+			n3 += t * (t - 1) / 2
+		}
+	}
+
+	// discordant pairs are the inversions of y
+	swaps := countInversions(ys, make([]float64, n))
+
+	// pairs tied in y (n2)
+	for i := 0; i < n; i = j {
+		for j = i + 1; j < n && ys[j] == ys[i]; j++ {
+		}
+		t = int64(j - i)
+		n2 += t * (t - 1) / 2
+	}
+
+	n0 := int64(n) * int64(n-1) / 2
+	return float64(n0-n1-n2+n3-2*swaps) / math.Sqrt(float64(n0-n1)*float64(n0-n2))
+}
+
+// countInversions sorts s with merge sort and returns the number of pairs
+// i < j with s[i] > s[j].
+func countInversions(s, buf []float64) int64 {
+	n := len(s)
+	if n < 2 {
+		return 0
+	}
+	m := n / 2
+	c := countInversions(s[:m], buf[:m]) + countInversions(s[m:], buf[m:])
+
+	i, j, k := 0, m, 0
+	for i < m && j < n {
+		if s[j] < s[i] {
+			buf[k] = s[j]
+			c += int64(m - i)
+			j++
+		} else {
+			buf[k] = s[i]
+			i++
+		}
+		k++
+	}
+	k += copy(buf[k:], s[i:m])
+	copy(buf[k:], s[j:])
+	copy(s, buf[:n])
+	return c
+}
+
+// corrMatrixGrid implements plotter.GridXYZ for a symmetric matrix.
+type corrMatrixGrid struct {
+	m *mat.SymDense
+}
+
+func (g corrMatrixGrid) Dims() (c, r int)   { n := g.m.SymmetricDim(); return n, n }
+func (g corrMatrixGrid) Z(c, r int) float64 { return g.m.At(g.m.SymmetricDim()-1-r, c) }
+func (g corrMatrixGrid) X(c int) float64    { return float64(c) }
+func (g corrMatrixGrid) Y(r int) float64    { return float64(r) }
+
+// plotCorrHeatmap plots a correlation or covariance matrix, with the first column at the top.
+func plotCorrHeatmap(m *mat.SymDense, names []string, isCorr bool, file string) error {
+	n := len(names)
+	if n == 0 {
+		return fmt.Errorf("no columns to plot")
+	}
+
+	pal := moreland.SmoothBlueRed().Palette(255)
+	h := plotter.NewHeatMap(corrMatrixGrid{m}, pal)
+	if isCorr {
+		h.Min, h.Max = -1, 1
+	}
+	h.NaN = pal.Colors()[127]
+
+	p := plot.New()
+	p.Add(h)
+
+	ticksX := make([]plot.Tick, n)
+	ticksY := make([]plot.Tick, n)
+	for i, name := range names {
+		ticksX[i] = plot.Tick{Value: float64(i), Label: name}
+		ticksY[i] = plot.Tick{Value: float64(n - 1 - i), Label: name}
+	}
+	p.X.Tick.Marker = plot.ConstantTicks(ticksX)
+	p.Y.Tick.Marker = plot.ConstantTicks(ticksY)
+	p.X.Tick.Label.Rotation = math.Pi / 4
+	p.X.Tick.Label.XAlign = -1.2
+	p.X.Tick.Label.YAlign = -0.2
+	p.X.Padding, p.Y.Padding = 0, 0
+	if isCorr {
+		p.Title.Text = fmt.Sprintf("correlation (%.0f to %.0f)", h.Min, h.Max)
+	} else {
+		p.Title.Text = fmt.Sprintf("covariance (%.3g to %.3g)", h.Min, h.Max)
+	}
+
+	size := vg.Length(2+0.4*float64(n)) * vg.Inch
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(file), ".")) {
+	case "eps", "jpg", "jpeg", "pdf", "png", "svg", "tif", "tiff":
+	default:
+		return fmt.Errorf("unsupported image format of heatmap file: %s. available: eps, jpg|jpeg, pdf, png, svg, and tif|tiff", file)
+	}
+	return p.Save(size, size, file)
+}
+
 func init() {
 	RootCmd.AddCommand(corrCmd)
 
-	corrCmd.Flags().StringP("fields", "f", "", "comma separated fields")
+	corrCmd.Flags().StringP("fields", "f", "", `comma separated fields. default: all numeric fields`)
 	corrCmd.Flags().BoolP("ignore_nan", "i", false, "Ignore non-numeric fields to avoid returning NaN")
 	corrCmd.Flags().BoolP("log", "L", false, "Calcute correlations on Log10 transformed data")
 	corrCmd.Flags().BoolP("pass", "x", false, "passthrough mode (forward input to output)")
+	corrCmd.Flags().StringP("method", "m", "pearson", `correlation method: pearson, spearman, kendall`)
+	corrCmd.Flags().BoolP("cov", "", false, `compute covariances instead of Pearson correlations`)
+	corrCmd.Flags().StringP("out-format", "", "pairs", `output format: pairs (to stderr), matrix, long`)
+	corrCmd.Flags().IntP("decimal-width", "w", 4, "limit floats to N decimal points")
+	corrCmd.Flags().StringP("heatmap", "", "", `plot the correlation matrix as a heatmap to this image file`)
 }
@@ -0,0 +1,274 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/shenwei356/csvtk/pkg/csvtk"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// crosscheckCmd represents the crosscheck command
+var crosscheckCmd = &cobra.Command{
+	GroupID: "set",
+
+	Use:     "crosscheck",
+	Aliases: []string{"fk"},
+	Short:   "check referential integrity (foreign keys) between files",
+	Long: `check referential integrity (foreign keys) between files
+
+Every value of -f/--fields in input files must exist in -k/--ref-fields
+of the reference file (-r/--ref-file). Multiple fields are checked as a
+composite key. Rows with empty values are skipped unless --check-empty
+is given.
+
+Orphan rows are reported in CSV format with columns of file, line and
+key fields, and can also be written to a file with -O/--orphan-file.
+The exit code is 1 if any orphan row is found.
+Use --no-exit-code to always exit with 0.
+
+Examples:
+
+    csvtk crosscheck -f customer_id -r customers.csv -k id orders.csv
+    csvtk crosscheck -f customer_id -r customers.csv -k id \
+        -O orphans.csv orders.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		refFile := getFlagString(cmd, "ref-file")
+		if refFile == "" {
+			checkError(fmt.Errorf("flag -r (--ref-file) needed"))
+		}
+		refFieldStr := getFlagString(cmd, "ref-fields")
+		if refFieldStr == "" {
+			refFieldStr = fieldStr
+		}
+		ignoreCase := getFlagBool(cmd, "ignore-case")
+		checkEmpty := getFlagBool(cmd, "check-empty")
+		orphanFile := getFlagString(cmd, "orphan-file")
+		noExitCode := getFlagBool(cmd, "no-exit-code")
+
+		keyEncoder := &joinKeyEncoder{csvtk.KeyEncoder{IgnoreCase: ignoreCase}}
+		keyOf := func(record []string, fields []int) (string, bool) {
+			empty := true
+			for _, f := range fields {
+				if record[f-1] != "" {
+					empty = false
+					break
+				}
+			}
+			key, _ := keyEncoder.key(record, fields)
+			return key, empty
+		}
+
+		// keys of the reference file
+		refKeys := make(map[string]struct{}, 1024)
+		var nRefFields int
+		csvReader, err := newCSVReaderByConfig(config, refFile)
+		if err != nil && err != xopen.ErrNoContent {
+			checkError(err)
+		}
+		if err == nil {
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var refFields []int
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					refFields = selectFieldsByHeader(header, refFieldStr, false)
+					nRefFields = len(refFields)
+					if !config.NoHeaderRow {
+						continue
+					}
+				}
+
+				key, _ := keyOf(record.All, refFields)
+				refKeys[key] = struct{}{}
+			}
+			readerReport(&config, csvReader, refFile)
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		var orphanWriter *csvWriter
+		if orphanFile != "" {
+			orphanfh, err := xopen.Wopen(orphanFile)
+			checkError(err)
+			defer orphanfh.Close()
+
+			orphanWriter = newCSVWriter(orphanfh)
+		}
+		for _, w := range []*csvWriter{writer, orphanWriter} {
+			if w == nil {
+				continue
+			}
+			if config.OutTabs || config.Tabs {
+				if config.OutDelimiter == ',' {
+					w.Comma = '\t'
+				} else {
+					w.Comma = config.OutDelimiter
+				}
+			} else {
+				w.Comma = config.OutDelimiter
+			}
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+			if orphanWriter != nil {
+				orphanWriter.Flush()
+				checkError(orphanWriter.Error())
+			}
+		}()
+
+		var nOrphans, nRows int
+		printHeaderRow := true
+		printOrphanHeaderRow := true
+		items := make([]string, 0, 8)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk crosscheck: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var fields []int
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					fields = selectFieldsByHeader(header, fieldStr, false)
+					if nRefFields > 0 && len(fields) != nRefFields {
+						checkError(fmt.Errorf("the numbers of fields (%d) and reference fields (%d) do not match", len(fields), nRefFields))
+					}
+
+					if printHeaderRow && !config.NoOutHeader {
+						items = append(items[:0], "file", "line")
+						for _, f := range fields {
+							if config.NoHeaderRow {
+								items = append(items, strconv.Itoa(f))
+							} else {
+								items = append(items, header[f-1])
+							}
+						}
+						checkError(writer.Write(items))
+					}
+					printHeaderRow = false
+
+					if !config.NoHeaderRow {
+						if orphanWriter != nil && printOrphanHeaderRow && !config.NoOutHeader {
+							checkError(orphanWriter.Write(record.All))
+						}
+						printOrphanHeaderRow = false
+						continue
+					}
+				}
+
+				nRows++
+				key, empty := keyOf(record.All, fields)
+				if empty && !checkEmpty {
+					continue
+				}
+				if _, ok := refKeys[key]; ok {
+					continue
+				}
+
+				nOrphans++
+				items = append(items[:0], file, strconv.Itoa(record.Line))
+				for _, f := range fields {
+					items = append(items, record.All[f-1])
+				}
+				checkError(writer.Write(items))
+				if orphanWriter != nil {
+					checkError(orphanWriter.Write(record.All))
+				}
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+
+		if nOrphans > 0 {
+			if config.Verbose {
+				log.Warningf("%d orphan row(s) found in %d row(s)", nOrphans, nRows)
+			}
+			if !noExitCode {
+				exitCode = 1
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(crosscheckCmd)
+
+	crosscheckCmd.Flags().StringP("fields", "f", "", `key fields of input files. e.g -f 1,2 or -f columnA,columnB`)
+	crosscheckCmd.Flags().StringP("ref-file", "r", "", `reference file`)
+	crosscheckCmd.Flags().StringP("ref-fields", "k", "", `key fields of the reference file, default: the same as -f/--fields`)
+	crosscheckCmd.Flags().BoolP("ignore-case", "i", false, `ignore case`)
+	crosscheckCmd.Flags().BoolP("check-empty", "", false, `also report rows with empty key values`)
+	crosscheckCmd.Flags().StringP("orphan-file", "O", "", `file for saving orphan rows`)
+	crosscheckCmd.Flags().BoolP("no-exit-code", "", false, `exit with 0 even if orphan rows are found`)
+}
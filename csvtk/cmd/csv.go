@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -54,6 +55,7 @@ type CSVReader struct {
 	ShowRowNumber bool
 
 	Reader *csv.Reader
+	source recordSource // source of records in other formats, Reader is used if it's nil
 
 	Ch chan Record
 
@@ -66,7 +68,7 @@ type CSVReader struct {
 
 // NewCSVReader is
 func NewCSVReader(file string) (*CSVReader, error) {
-	fh, err := xopen.Ropen(file)
+	fh, err := ropen(file)
 	if err != nil {
 		// if err == xopen.ErrNoContent {
 		// 	return nil, fmt.Errorf("empty file: %s", file)
@@ -90,6 +92,47 @@ func NewCSVReader(file string) (*CSVReader, error) {
 	return csvReader, nil
 }
 
+// recordSource returns records of data in formats other than CSV/TSV.
+type recordSource interface {
+	// Read returns the next record, and io.EOF at the end.
+	Read() ([]string, error)
+	Close() error
+}
+
+// newSourceCSVReader creates a CSVReader reading records from a recordSource.
+func newSourceCSVReader(config Config, file string, source recordSource) *CSVReader {
+	return &CSVReader{
+		file:             file,
+		Reader:           csv.NewReader(bytes.NewReader(nil)), // not used, but some commands change its options
+		source:           source,
+		NoHeaderRow:      config.NoHeaderRow,
+		IgnoreEmptyRow:   config.IgnoreEmptyRow,
+		IgnoreIllegalRow: config.IgnoreIllegalRow,
+		Ch:               make(chan Record, 128),
+		NumEmptyRows:     make([]int, 0, 128),
+		NumIllegalRows:   make([]int, 0, 128),
+	}
+}
+
+// sliceSource returns records loaded into memory.
+type sliceSource struct {
+	records [][]string
+	i       int
+}
+
+func (s *sliceSource) Read() ([]string, error) {
+	if s.i >= len(s.records) {
+		return nil, io.EOF
+	}
+	s.i++
+	return s.records[s.i-1], nil
+}
+
+func (s *sliceSource) Close() error {
+	s.records = nil
+	return nil
+}
+
 type ReadOption struct {
 	FieldStr                       string
 	FieldStrSep                    string
@@ -127,7 +170,12 @@ func (csvReader *CSVReader) Read(opt ReadOption) {
 		doNotAllowDuplicatedColumnName := opt.DoNotAllowDuplicatedColumnName
 
 		defer func() {
-			csvReader.fh.Close()
+			if csvReader.fh != nil {
+				csvReader.fh.Close()
+			}
+			if csvReader.source != nil {
+				csvReader.source.Close()
+			}
 		}()
 
 		fields, colnames, negativeFields, needParseHeaderRow, x2ends := parseFields(fieldStr, fieldStrSep, csvReader.NoHeaderRow, opt.Verbose)
@@ -167,21 +215,33 @@ func (csvReader *CSVReader) Read(opt ReadOption) {
 		var err error
 		var isHeaderRow bool
 
+		var names []string // column names for selection, different from the header row for --on-dup-colnames index
+		checkColnames := dupColnamesPolicy != "keep" && (needParseHeaderRow || !csvReader.NoHeaderRow)
+
 		for {
-			record, err = csvReader.Reader.Read()
+			if csvReader.source != nil {
+				record, err = csvReader.source.Read()
+			} else {
+				record, err = csvReader.Reader.Read()
+			}
 			if err == io.EOF {
 				break
 			}
 
 			lineNum++
+			progressAddRow()
 			if err != nil {
 				if ignoreIllegalRow {
 					csvReader.NumIllegalRows = append(csvReader.NumIllegalRows, lineNum)
 					continue
 				}
+				rerr := newRecordError(csvReader.file, lineNum, err)
+				if quarantineRecord(rerr, record) || reportRecordError(rerr) {
+					continue
+				}
 				csvReader.Ch <- Record{
 					Line: lineNum,
-					Err:  err,
+					Err:  rerr,
 				}
 			}
 
@@ -205,6 +265,12 @@ func (csvReader *CSVReader) Read(opt ReadOption) {
 
 			// ------------------------------------------------------------------
 
+			names = record
+			if checkColnames { // the header row
+				checkColnames = false
+				record, names = applyDupColnamesPolicy(record, csvReader.file)
+			}
+
 			isHeaderRow = false
 
 			if parseHeaderRow { // parsing header row
@@ -213,7 +279,7 @@ func (csvReader *CSVReader) Read(opt ReadOption) {
 				if len(fields) == 0 { // user gives the colnames
 					// colnames
 					colnames2fileds = make(map[string][]int, len(record))
-					for i, col = range record {
+					for i, col = range names {
 						if ignoreFieldCase {
 							col = strings.ToLower(col)
 						}
@@ -258,7 +324,7 @@ func (csvReader *CSVReader) Read(opt ReadOption) {
 
 					// matching colnames
 					if negativeFields {
-						for _, col = range record {
+						for _, col = range names {
 							if ignoreFieldCase {
 								col = strings.ToLower(col)
 							}
@@ -290,7 +356,7 @@ func (csvReader *CSVReader) Read(opt ReadOption) {
 									col = strings.ToLower(col)
 								}
 
-								for _, col2 := range record {
+								for _, col2 := range names {
 									if ignoreFieldCase {
 										col2 = strings.ToLower(col2)
 									}
@@ -687,6 +753,62 @@ func readerReport(config *Config, csvReader *CSVReader, file string) {
 	}
 }
 
+// selectFieldsByHeader returns 1-based fields of columns given by field numbers,
+// ranges, column names or fuzzy column names.
+func selectFieldsByHeader(header []string, fieldStr string, fuzzy bool) []int {
+	fields := make([]int, 0, 8)
+	added := make(map[int]struct{}, 8)
+	add := func(f int) {
+		if _, ok := added[f]; !ok {
+			added[f] = struct{}{}
+			fields = append(fields, f)
+		}
+	}
+
+	var found bool
+	for _, s := range strings.Split(fieldStr, ",") {
+		if s == "" {
+			checkError(fmt.Errorf("empty field in: %s", fieldStr))
+		}
+		if f, err := strconv.Atoi(s); err == nil {
+			if f < 1 || f > len(header) {
+				checkError(fmt.Errorf("field %d out of range (%d columns)", f, len(header)))
+			}
+			add(f)
+			continue
+		}
+		if reIntegerRange.MatchString(s) {
+			for _, f := range fieldRange(len(header), s) {
+				add(f)
+			}
+			continue
+		}
+
+		found = false
+		if fuzzy {
+			re := fuzzyField2Regexp(s)
+			for i, col := range header {
+				if re.MatchString(col) {
+					add(i + 1)
+					found = true
+				}
+			}
+		} else {
+			for i, col := range header {
+				if col == s {
+					add(i + 1)
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			checkError(fmt.Errorf("column not found: %s", s))
+		}
+	}
+	return fields
+}
+
 // the result is 1-based
 func fieldRange(nFields int, _range string) []int {
 	found := reIntegerRange.FindAllStringSubmatch(_range, -1)
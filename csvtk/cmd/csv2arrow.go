@@ -0,0 +1,229 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2arrowCmd represents the csv2arrow command
+var csv2arrowCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2arrow",
+	Short: "convert CSV to Arrow IPC stream/file (Feather V2)",
+	Long: `convert CSV to Arrow IPC stream/file (Feather V2)
+
+Records are converted and written in record batches, so the output stream
+could be consumed by other tools (e.g., DuckDB and Polars) while reading.
+
+Column types are inferred from non-empty values of the first N rows (--infer-rows):
+  int64    all values are integers
+  double   all values are numbers
+  boolean  all values are true/false, TRUE/FALSE, or True/False
+  string   others, or all columns when --all-text is given
+Empty values are stored as null, except for string columns.
+An error is reported if following values do not match the inferred types,
+please increase --infer-rows or use --all-text in this case.
+
+Output formats (--out-format):
+  stream   Arrow IPC stream format, the default
+  file     Arrow IPC file format, i.e., Feather V2
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		allText := getFlagBool(cmd, "all-text")
+		inferRows := getFlagNonNegativeInt(cmd, "infer-rows")
+		batchSize := getFlagPositiveInt(cmd, "batch-size")
+		outFormat := strings.ToLower(getFlagString(cmd, "out-format"))
+		if outFormat == "feather" {
+			outFormat = "file"
+		}
+		if outFormat != "stream" && outFormat != "file" {
+			checkError(fmt.Errorf("unsupported output format: %s. available: stream, file", outFormat))
+		}
+		var ipcOpts []ipc.Option
+		switch strings.ToLower(getFlagString(cmd, "compression")) {
+		case "none", "":
+		case "lz4":
+			ipcOpts = append(ipcOpts, ipc.WithLZ4())
+		case "zstd":
+			ipcOpts = append(ipcOpts, ipc.WithZstd())
+		default:
+			checkError(fmt.Errorf("unsupported compression codec: %s. available: none, lz4, zstd", getFlagString(cmd, "compression")))
+		}
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				checkError(fmt.Errorf("no data found in file: %s", file))
+			}
+			checkError(err)
+		}
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		// column names and rows for type inference
+		var colnames []string
+		buf := make([][]string, 0, 1024)
+		checkFirstLine := true
+		var record Record
+		var ok bool
+		for {
+			record, ok = <-csvReader.Ch
+			if !ok {
+				break
+			}
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+			if checkFirstLine {
+				checkFirstLine = false
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					colnames = record.All
+					continue
+				}
+			}
+			buf = append(buf, record.All)
+			if inferRows > 0 && len(buf) >= inferRows {
+				break
+			}
+		}
+		if colnames == nil {
+			if len(buf) == 0 {
+				checkError(fmt.Errorf("no data found in file: %s", file))
+			}
+			colnames = make([]string, len(buf[0]))
+			for i := range colnames {
+				colnames[i] = fmt.Sprintf("c%d", i+1)
+			}
+		}
+
+		types := make([]int, len(colnames))
+		fields := make([]arrow.Field, len(colnames))
+		for j, colname := range colnames {
+			if !allText {
+				types[j] = inferColumnType(buf, j)
+			}
+			fields[j] = arrow.Field{Name: colname, Type: arrowDataType(types[j]), Nullable: true}
+		}
+		schema := arrow.NewSchema(fields, nil)
+
+		var outfh io.Writer
+		if isStdin(config.OutFile) {
+			outfh = os.Stdout
+		} else {
+			fh, err := os.Create(config.OutFile)
+			checkError(err)
+			defer func() {
+				checkError(fh.Close())
+			}()
+			outfh = fh
+		}
+
+		ipcOpts = append(ipcOpts, ipc.WithSchema(schema))
+		var writer interface {
+			Write(arrow.Record) error
+			Close() error
+		}
+		if outFormat == "file" {
+			writer, err = ipc.NewFileWriter(outfh, ipcOpts...)
+			checkError(err)
+		} else {
+			writer = ipc.NewWriter(outfh, ipcOpts...)
+		}
+
+		builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		defer builder.Release()
+
+		var n, row int
+		add := func(items []string) {
+			row++
+			for j := range colnames {
+				if j < len(items) {
+					if err := appendArrowValue(builder.Field(j), types[j], items[j]); err != nil {
+						checkError(fmt.Errorf("row %d, column %s: %s. please increase --infer-rows or use --all-text", row, colnames[j], err))
+					}
+				} else {
+					builder.Field(j).AppendNull()
+				}
+			}
+			n++
+			if n < batchSize {
+				return
+			}
+			rec := builder.NewRecord()
+			err := writer.Write(rec)
+			rec.Release()
+			checkError(err)
+			n = 0
+		}
+
+		for _, items := range buf {
+			add(items)
+		}
+		buf = nil
+		for record = range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+			add(record.All)
+		}
+		readerReport(&config, csvReader, file)
+
+		if n > 0 {
+			rec := builder.NewRecord()
+			err = writer.Write(rec)
+			rec.Release()
+			checkError(err)
+		}
+		checkError(writer.Close())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2arrowCmd)
+	csv2arrowCmd.Flags().BoolP("all-text", "", false, `store all columns as strings, no type inference`)
+	csv2arrowCmd.Flags().IntP("infer-rows", "n", 10000, `number of rows for inferring column types, 0 for all rows`)
+	csv2arrowCmd.Flags().IntP("batch-size", "b", 65536, `number of rows in a record batch`)
+	csv2arrowCmd.Flags().StringP("out-format", "f", "stream", `output format: stream (Arrow IPC stream), file (Arrow IPC file, i.e., Feather V2)`)
+	csv2arrowCmd.Flags().StringP("compression", "c", "none", `compression codec of record batches: none, lz4, zstd`)
+}
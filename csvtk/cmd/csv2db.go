@@ -0,0 +1,140 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// csv2dbCmd represents the csv2db command
+var csv2dbCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2db",
+	Short: "load CSV/TSV files into a SQLite database",
+	Long: `load CSV/TSV files into a SQLite database
+
+Each file is loaded into a table. Table names, column names and column types
+are the same as "csvtk sql".
+
+Indexes:
+  Indexes can be created with --index, in the format of "[table:]col1,col2",
+  the table name can be omitted if there's only one input file, e.g.,
+    --index id --index "sales:region,date"
+
+Use "csvtk db2csv" to query the database.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		dbFile := getFlagString(cmd, "db")
+		if dbFile == "" {
+			checkError(fmt.Errorf("flag --db needed"))
+		}
+		tableNames := getFlagCommaSeparatedStrings(cmd, "table-names")
+		if len(tableNames) > 0 && len(tableNames) != len(files) {
+			checkError(fmt.Errorf("number of table names (%d) should be equal to number of files (%d)", len(tableNames), len(files)))
+		}
+		opts := sqliteLoadOptions{
+			AllText:   getFlagBool(cmd, "all-text"),
+			Replace:   getFlagBool(cmd, "replace"),
+			Append:    getFlagBool(cmd, "append"),
+			BatchSize: getFlagPositiveInt(cmd, "batch-size"),
+		}
+		if opts.Replace && opts.Append {
+			checkError(fmt.Errorf("flag --replace and --append are exclusive"))
+		}
+
+		tables := make([]string, len(files))
+		for i, file := range files {
+			if len(tableNames) > 0 {
+				tables[i] = tableNames[i]
+			} else {
+				tables[i] = sqlTableName(file)
+			}
+		}
+
+		// indexes of each table
+		indexes := make(map[string][][]string, len(files))
+		var table string
+		var j int
+		for _, val := range getFlagStringArray(cmd, "index") {
+			j = strings.LastIndex(val, ":")
+			if j < 0 {
+				if len(files) > 1 {
+					checkError(fmt.Errorf(`table name needed in the value of --index for multiple files: %s. e.g., --index "table:col1,col2"`, val))
+				}
+				table = tables[0]
+			} else {
+				table = val[:j]
+				val = val[j+1:]
+			}
+			if val == "" {
+				checkError(fmt.Errorf("no columns given in the value of --index"))
+			}
+			indexes[table] = append(indexes[table], strings.Split(val, ","))
+		}
+		for table = range indexes {
+			found := false
+			for _, t := range tables {
+				if t == table {
+					found = true
+					break
+				}
+			}
+			if !found {
+				checkError(fmt.Errorf("table in flag --index not found: %s", table))
+			}
+		}
+
+		db, err := sql.Open("sqlite", dbFile)
+		checkError(err)
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		for i, file := range files {
+			opts.Indexes = indexes[tables[i]]
+			checkError(loadCSVToSQLite(config, db, file, tables[i], opts))
+			if config.Verbose {
+				log.Infof("file %s loaded into table: %s", file, tables[i])
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2dbCmd)
+	csv2dbCmd.Flags().StringP("db", "", "", `SQLite database file`)
+	csv2dbCmd.Flags().StringP("table-names", "n", "", `comma separated table names for all files, in the same order of files`)
+	csv2dbCmd.Flags().BoolP("all-text", "", false, `store all columns as TEXT, no type inference`)
+	csv2dbCmd.Flags().StringArrayP("index", "i", []string{}, `create an index, in the format of "[table:]col1,col2". multiple values supported`)
+	csv2dbCmd.Flags().BoolP("replace", "r", false, `drop existing tables with the same names`)
+	csv2dbCmd.Flags().BoolP("append", "a", false, `append data to existing tables with the same names`)
+	csv2dbCmd.Flags().IntP("batch-size", "b", 100000, `number of rows inserted in a transaction`)
+}
@@ -0,0 +1,266 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2fwfCmd represents the csv2fwf command
+var csv2fwfCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2fwf",
+	Short: "convert CSV to fixed-width format",
+	Long: `convert CSV to fixed-width format
+
+Widths of columns are the maximum widths of values (including the header row)
+by default, which requires reading all records into memory. Widths can also
+be given via -w/--widths, then records are outputted one by one, and values
+longer than the widths are reported as errors, or truncated with --truncate.
+
+Texts are aligned left (default) or right (-r/--align-right) for selected
+columns (field index/range or column name). E.g.,
+
+    -r 2,3     # 2nd and 3rd columns
+    -r 3-      # 3rd and later columns
+    -r -1      # the last column
+    -r score   # column "score"
+
+A column-spec file can be written via --spec-file, which is accepted by
+"csvtk fwf2csv -s".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		widths := getFlagCommaSeparatedInts(cmd, "widths")
+		alignRights := getFlagStringSlice(cmd, "align-right")
+		separator := getFlagString(cmd, "separator")
+		truncate := getFlagBool(cmd, "truncate")
+		specFile := getFlagString(cmd, "spec-file")
+
+		for _, w := range widths {
+			if w <= 0 {
+				checkError(fmt.Errorf("column width should be positive: %d", w))
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk csv2fwf: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr:      "1-",
+			ShowRowNumber: config.ShowRowNumber,
+		})
+
+		var rights []bool
+		var header []string
+		var buf [][]string
+		var ncols int
+
+		writeRow := func(record []string) {
+			var w, vw int
+			for i, v := range record {
+				w = widths[i]
+				vw = runewidth.StringWidth(v)
+				if vw > w {
+					if !truncate {
+						checkError(fmt.Errorf("value longer than width of column %d (%d): %s", i+1, w, v))
+					}
+					v = runewidth.Truncate(v, w, "")
+					vw = runewidth.StringWidth(v)
+				}
+				if i > 0 {
+					outfh.WriteString(separator)
+				}
+				if rights[i] {
+					outfh.WriteString(strings.Repeat(" ", w-vw))
+					outfh.WriteString(v)
+				} else {
+					outfh.WriteString(v)
+					outfh.WriteString(strings.Repeat(" ", w-vw))
+				}
+			}
+			outfh.WriteString("\n")
+		}
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			checkError(record.Err)
+
+			if checkFirstLine {
+				checkFirstLine = false
+				ncols = len(record.All)
+				if config.ShowRowNumber {
+					ncols++
+				}
+
+				if len(widths) > 0 && len(widths) != ncols {
+					checkError(fmt.Errorf("the number of values from -w/--widths (%d) need equal to the number of columns (%d)", len(widths), ncols))
+				}
+
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					header = record.Selected
+				}
+				rights = fwfAlignRights(alignRights, record.All, header != nil, config.ShowRowNumber)
+
+				if header != nil {
+					if len(widths) > 0 {
+						writeRow(header)
+					} else {
+						buf = append(buf, header)
+					}
+					continue
+				}
+			}
+
+			if len(widths) > 0 {
+				writeRow(record.Selected)
+				continue
+			}
+			buf = append(buf, record.Selected)
+		}
+
+		readerReport(&config, csvReader, file)
+
+		if len(widths) == 0 && len(buf) > 0 {
+			widths = make([]int, ncols)
+			var w int
+			for _, record := range buf {
+				for i, v := range record {
+					w = runewidth.StringWidth(v)
+					if w > widths[i] {
+						widths[i] = w
+					}
+				}
+			}
+			for i := range widths {
+				if widths[i] == 0 {
+					widths[i] = 1
+				}
+			}
+			for _, record := range buf {
+				writeRow(record)
+			}
+		}
+
+		if specFile != "" && len(widths) > 0 {
+			checkError(writeFWFSpec(specFile, header, widths, runewidth.StringWidth(separator)))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2fwfCmd)
+	csv2fwfCmd.Flags().StringP("widths", "w", "", "widths of all columns, separated by commas, e.g., 5,10,3. default: maximum widths of values")
+	csv2fwfCmd.Flags().StringSliceP("align-right", "r", []string{}, `align right for selected columns (field index/range or column name, type "csvtk csv2fwf -h" for examples)`)
+	csv2fwfCmd.Flags().StringP("separator", "s", " ", "fields/columns separator")
+	csv2fwfCmd.Flags().BoolP("truncate", "", false, "truncate values longer than the widths given by -w/--widths")
+	csv2fwfCmd.Flags().StringP("spec-file", "", "", `write the column-spec file, which can be used in "csvtk fwf2csv -s"`)
+}
+
+var reNegativeField = regexp.MustCompile(`^(-\d+)$`)
+
+// fwfAlignRights returns which columns are right-aligned.
+func fwfAlignRights(cols []string, record []string, hasHeaderRow bool, showRowNumber bool) []bool {
+	ncols := len(record)
+	colnames2fileds := make(map[string][]int, ncols)
+	var col string
+	if hasHeaderRow {
+		for i, col := range record {
+			colnames2fileds[col] = append(colnames2fileds[col], i+1)
+		}
+	}
+	for i := range record {
+		col = strconv.Itoa(i + 1)
+		colnames2fileds[col] = append(colnames2fileds[col], i+1)
+	}
+
+	if showRowNumber {
+		ncols++
+	}
+	rights := make([]bool, ncols)
+	var _range []int
+	for _, col = range cols {
+		if reNegativeField.MatchString(col) {
+			f, _ := strconv.Atoi(col)
+			_range = []int{len(record) + 1 + f}
+		} else if reIntegerRange.MatchString(col) {
+			_range = fieldRange(len(record), col)
+		} else {
+			_range = colnames2fileds[col]
+		}
+		for _, i := range _range {
+			if showRowNumber {
+				i++
+			}
+			rights[i-1] = true
+		}
+	}
+	return rights
+}
+
+// writeFWFSpec writes a column-spec file with 1-based inclusive positions.
+func writeFWFSpec(file string, header []string, widths []int, sepLen int) error {
+	outfh, err := xopen.Wopen(file)
+	if err != nil {
+		return err
+	}
+	var name string
+	start := 1
+	for i, w := range widths {
+		if header != nil {
+			name = header[i]
+		} else {
+			name = fmt.Sprintf("%d", i+1)
+		}
+		fmt.Fprintf(outfh, "%s\t%d\t%d\n", name, start, start+w-1)
+		start += w + sepLen
+	}
+	return outfh.Close()
+}
@@ -0,0 +1,226 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"html/template"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2htmlCmd represents the csv2html command
+var csv2htmlCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2html",
+	Short: "convert CSV to HTML table",
+	Long: `convert CSV to HTML table
+
+A standalone HTML page with a styled table is outputted by default,
+use --table-only to only output the <table> element for embedding.
+Numeric cells are right-aligned via the CSS class "num".
+
+Custom template:
+
+  A Go html/template file can be given via --template, with variables below:
+
+    .Title     string, the value of --title
+    .Header    []string, the header row, nil for -H/--no-header-row
+    .Rows      []Row, each Row has a field .Cells of cells
+               with fields .Value and .Numeric
+    .Sortable  bool, the value of -s/--sortable
+    .Style     template.CSS, the default CSS style
+    .Script    template.JS, the script for sorting columns
+
+  E.g.,
+
+    <html><body><table>
+    {{range .Rows}}<tr>{{range .Cells}}<td>{{.Value}}</td>{{end}}</tr>
+    {{end}}</table></body></html>
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		title := getFlagString(cmd, "title")
+		sortable := getFlagBool(cmd, "sortable")
+		tableOnly := getFlagBool(cmd, "table-only")
+		templateFile := getFlagString(cmd, "template")
+
+		if tableOnly && templateFile != "" {
+			checkError(fmt.Errorf("flag --table-only and --template are incompatible"))
+		}
+
+		var tpl *template.Template
+		var err error
+		if templateFile != "" {
+			tpl, err = template.ParseFiles(templateFile)
+			checkError(err)
+		} else if tableOnly {
+			tpl = template.Must(template.New("table").Parse(htmlTableTemplate))
+		} else {
+			tpl = template.Must(template.New("page").Parse(htmlPageTemplate))
+			tpl = template.Must(tpl.New("table").Parse(htmlTableTemplate))
+			tpl = tpl.Lookup("page")
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		file := files[0]
+		headerRow, data, csvReader, err := readCSV(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk csv2html: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		readerReport(&config, csvReader, file)
+
+		page := htmlPage{
+			Title:    title,
+			Header:   headerRow,
+			Rows:     make([]htmlRow, len(data)),
+			Sortable: sortable,
+			Style:    template.CSS(htmlStyle),
+			Script:   template.JS(htmlSortScript),
+		}
+		if config.NoOutHeader {
+			page.Header = nil
+		}
+		for i, record := range data {
+			cells := make([]htmlCell, len(record))
+			for j, v := range record {
+				cells[j] = htmlCell{Value: v, Numeric: reDigitals.MatchString(strings.TrimSpace(v))}
+			}
+			page.Rows[i] = htmlRow{Cells: cells}
+		}
+
+		checkError(tpl.Execute(outfh, page))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2htmlCmd)
+	csv2htmlCmd.Flags().StringP("title", "", "", "title of the HTML page, also used as the table caption")
+	csv2htmlCmd.Flags().BoolP("sortable", "s", false, "make columns sortable by clicking the header cells")
+	csv2htmlCmd.Flags().BoolP("table-only", "", false, "only output the <table> element")
+	csv2htmlCmd.Flags().StringP("template", "", "", `custom Go html/template file, type "csvtk csv2html -h" for details`)
+}
+
+type htmlCell struct {
+	Value   string
+	Numeric bool
+}
+
+type htmlRow struct {
+	Cells []htmlCell
+}
+
+type htmlPage struct {
+	Title    string
+	Header   []string
+	Rows     []htmlRow
+	Sortable bool
+	Style    template.CSS
+	Script   template.JS
+}
+
+const htmlTableTemplate = `<table class="csvtk{{if .Sortable}} sortable{{end}}">
+{{- if .Title}}
+<caption>{{.Title}}</caption>
+{{- end}}
+{{- if .Header}}
+<thead>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+{{- end}}
+<tbody>
+{{- range .Rows}}
+<tr>{{range .Cells}}<td{{if .Numeric}} class="num"{{end}}>{{.Value}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+`
+
+const htmlPageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+{{.Style}}
+</style>
+</head>
+<body>
+{{template "table" .}}
+{{- if .Sortable}}
+<script>
+{{.Script}}
+</script>
+{{- end}}
+</body>
+</html>
+`
+
+const htmlStyle = `table.csvtk { border-collapse: collapse; font-family: sans-serif; font-size: 14px; }
+table.csvtk caption { font-weight: bold; padding: 6px; }
+table.csvtk th, table.csvtk td { border: 1px solid #ddd; padding: 4px 8px; }
+table.csvtk th { background-color: #f2f2f2; text-align: left; }
+table.csvtk tbody tr:nth-child(even) { background-color: #fafafa; }
+table.csvtk tbody tr:hover { background-color: #f0f7ff; }
+table.csvtk td.num { text-align: right; }
+table.sortable th { cursor: pointer; user-select: none; }
+table.sortable th.asc::after { content: " \25B2"; }
+table.sortable th.desc::after { content: " \25BC"; }`
+
+const htmlSortScript = `document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("thead th").forEach(function (th, col) {
+    th.addEventListener("click", function () {
+      var asc = !th.classList.contains("asc");
+      table.querySelectorAll("thead th").forEach(function (h) { h.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var tbody = table.tBodies[0];
+      var rows = Array.prototype.slice.call(tbody.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[col] ? a.cells[col].textContent : "";
+        var y = b.cells[col] ? b.cells[col].textContent : "";
+        var nx = parseFloat(x), ny = parseFloat(y);
+        var c = (!isNaN(nx) && !isNaN(ny)) ? nx - ny : x.localeCompare(y);
+        return asc ? c : -c;
+      });
+      rows.forEach(function (r) { tbody.appendChild(r); });
+    });
+  });
+});`
@@ -87,7 +87,7 @@ var csv2jsonCmd = &cobra.Command{
 
 		keyed := fieldStr != ""
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -0,0 +1,217 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2jsonlCmd represents the csv2jsonl command
+var csv2jsonlCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2jsonl",
+	Short: "convert CSV to JSON Lines (NDJSON) format",
+	Long: `convert CSV to JSON Lines (NDJSON) format
+
+Each record is converted to a JSON object in one line. Columns are
+converted to nested objects if --flatten-sep is given, e.g., columns
+"user.name" and "user.id" are converted to {"user": {"name": .., "id": ..}}.
+This is the reverse operation of "csvtk jsonl2csv".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		blanks := getFlagBool(cmd, "blanks")
+		flattenSep := getFlagString(cmd, "flatten-sep")
+
+		var parseNumAll bool
+		parseNumCols := make(map[int]struct{})
+		var n int
+		for _, c := range getFlagStringSlice(cmd, "parse-num") {
+			c = strings.ToLower(c)
+			if c == "a" || c == "all" {
+				parseNumAll = true
+				break
+			}
+			if !reIntegers.MatchString(c) {
+				checkError(fmt.Errorf("positive column index needed: %s", c))
+			}
+			n, _ = strconv.Atoi(c)
+			if n < 1 {
+				checkError(fmt.Errorf("positive column index needed: %s", c))
+			}
+			parseNumCols[n] = struct{}{}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var ok, parseNum bool
+		var values []string
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk csv2jsonl: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var tree *jsonNode
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+					if !config.NoHeaderRow || record.IsHeaderRow {
+						tree, err = newJSONTree(record.All, flattenSep)
+						checkError(err)
+						values = make([]string, len(record.All))
+						continue
+					}
+				}
+
+				if len(values) < len(record.All) {
+					values = make([]string, len(record.All))
+				}
+				for i, v := range record.All {
+					parseNum = parseNumAll
+					if !parseNum {
+						_, parseNum = parseNumCols[i+1]
+					}
+					values[i] = processJSONValue(v, blanks, parseNum)
+				}
+
+				if tree == nil { // no header row, output values as an array
+					outfh.WriteString("[" + strings.Join(values[:len(record.All)], ",") + "]\n")
+					continue
+				}
+				if ok = tree.write(outfh, values[:len(record.All)]); !ok {
+					checkError(fmt.Errorf("[line %d] number of columns (%d) does not match the header row (%d)", record.Line, len(record.All), len(tree.fields)))
+				}
+				outfh.WriteString("\n")
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2jsonlCmd)
+	csv2jsonlCmd.Flags().BoolP("blanks", "b", false, `do not convert "", "na", "n/a", "none", "null", "." to null`)
+	csv2jsonlCmd.Flags().StringSliceP("parse-num", "n", []string{}, `parse numeric values for nth column, multiple values are supported and "a"/"all" for all columns`)
+	csv2jsonlCmd.Flags().StringP("flatten-sep", "s", "", `separator of nested keys in column names, e.g., ".", columns are converted to nested objects if given`)
+}
+
+// jsonNode is a node of a JSON object built from column names.
+type jsonNode struct {
+	key      string
+	field    int // 0-based index of the column for leaf nodes
+	children []*jsonNode
+
+	fields []int // all columns, only for the root
+}
+
+// newJSONTree builds a tree of nested objects from column names,
+// which are split by sep if it's not empty.
+func newJSONTree(colnames []string, sep string) (*jsonNode, error) {
+	root := &jsonNode{fields: make([]int, len(colnames))}
+	var paths []string
+	for i, col := range colnames {
+		root.fields[i] = i
+		if sep == "" {
+			paths = []string{col}
+		} else {
+			paths = strings.Split(col, sep)
+		}
+
+		node := root
+		for j, key := range paths {
+			var child *jsonNode
+			for _, c := range node.children {
+				if c.key == key {
+					child = c
+					break
+				}
+			}
+			leaf := j == len(paths)-1
+			if child != nil && (leaf || child.field >= 0) {
+				return nil, fmt.Errorf("conflicting column names: %s", col)
+			}
+			if child == nil {
+				child = &jsonNode{key: key, field: -1}
+				if leaf {
+					child.field = i
+				}
+				node.children = append(node.children, child)
+			}
+			node = child
+		}
+	}
+	return root, nil
+}
+
+// write writes an object of values, which are already formatted as JSON.
+func (n *jsonNode) write(outfh *xopen.Writer, values []string) bool {
+	if len(values) != len(n.fields) {
+		return false
+	}
+	n.writeObject(outfh, values)
+	return true
+}
+
+func (n *jsonNode) writeObject(outfh *xopen.Writer, values []string) {
+	outfh.WriteString("{")
+	for i, c := range n.children {
+		if i > 0 {
+			outfh.WriteString(",")
+		}
+		outfh.WriteString(`"` + unescapeJSONField(c.key) + `":`)
+		if c.field >= 0 {
+			outfh.WriteString(values[c.field])
+		} else {
+			c.writeObject(outfh, values)
+		}
+	}
+	outfh.WriteString("}")
+}
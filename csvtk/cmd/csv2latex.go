@@ -0,0 +1,210 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2latexCmd represents the csv2latex command
+var csv2latexCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2latex",
+	Short: "convert CSV to LaTeX table",
+	Long: `convert CSV to LaTeX table
+
+A booktabs-style table is outputted, which requires \usepackage{booktabs}
+in the preamble, and \usepackage{longtable} for -L/--longtable.
+
+Attention:
+
+  1. Columns with all values being numbers are right-aligned, others are
+     left-aligned. Alignments can also be given via -a/--alignments,
+     with one value for all columns, or one for each column, e.g.,
+     -a l,r,c,p{3cm}.
+  2. Special characters (& % $ # _ { } ~ ^ \) are escaped, unless
+     --no-escape is given.
+  3. For tables with many rows, -L/--longtable can be used to output a
+     longtable environment which can span multiple pages, the header row
+     is repeated on each page.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		aligns := getFlagCommaSeparatedStrings(cmd, "alignments")
+		caption := getFlagString(cmd, "caption")
+		label := getFlagString(cmd, "label")
+		longtable := getFlagBool(cmd, "longtable")
+		noEscape := getFlagBool(cmd, "no-escape")
+		position := getFlagString(cmd, "position")
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		file := files[0]
+		headerRow, data, csvReader, err := readCSV(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk csv2latex: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		readerReport(&config, csvReader, file)
+
+		var ncols int
+		if len(headerRow) > 0 {
+			ncols = len(headerRow)
+		} else if len(data) > 0 {
+			ncols = len(data[0])
+		} else {
+			if config.Verbose {
+				log.Warningf("no data found in file: %s", file)
+			}
+			return
+		}
+		if config.NoOutHeader {
+			headerRow = nil
+		}
+
+		if len(aligns) == 0 {
+			aligns = make([]string, ncols)
+			for j := range aligns {
+				aligns[j] = "r"
+				for _, record := range data {
+					if record[j] != "" && !reDigitals.MatchString(record[j]) {
+						aligns[j] = "l"
+						break
+					}
+				}
+			}
+		} else if len(aligns) == 1 {
+			a := aligns[0]
+			aligns = make([]string, ncols)
+			for j := range aligns {
+				aligns[j] = a
+			}
+		} else if len(aligns) != ncols {
+			checkError(fmt.Errorf("number of alignments (%d) should be equal to 1 or number of fields (%d)", len(aligns), ncols))
+		}
+
+		escape := latexEscape
+		if noEscape {
+			escape = func(s string) string { return s }
+		}
+		row := func(record []string) string {
+			cells := make([]string, len(record))
+			for i, c := range record {
+				cells[i] = escape(c)
+			}
+			return strings.Join(cells, " & ") + ` \\`
+		}
+
+		colSpec := strings.Join(aligns, "")
+		if longtable {
+			fmt.Fprintf(outfh, "\\begin{longtable}{%s}\n", colSpec)
+			if caption != "" {
+				fmt.Fprintf(outfh, "\\caption{%s}", escape(caption))
+				if label != "" {
+					fmt.Fprintf(outfh, "\\label{%s}", label)
+				}
+				fmt.Fprintf(outfh, " \\\\\n")
+			} else if label != "" {
+				fmt.Fprintf(outfh, "\\label{%s} \\\\\n", label)
+			}
+			fmt.Fprintf(outfh, "\\toprule\n")
+			if headerRow != nil {
+				fmt.Fprintf(outfh, "%s\n\\midrule\n", row(headerRow))
+			}
+			fmt.Fprintf(outfh, "\\endfirsthead\n")
+			fmt.Fprintf(outfh, "\\toprule\n")
+			if headerRow != nil {
+				fmt.Fprintf(outfh, "%s\n\\midrule\n", row(headerRow))
+			}
+			fmt.Fprintf(outfh, "\\endhead\n")
+			fmt.Fprintf(outfh, "\\bottomrule\n\\endlastfoot\n")
+			for _, record := range data {
+				fmt.Fprintf(outfh, "%s\n", row(record))
+			}
+			fmt.Fprintf(outfh, "\\end{longtable}\n")
+			return
+		}
+
+		fmt.Fprintf(outfh, "\\begin{table}[%s]\n\\centering\n", position)
+		if caption != "" {
+			fmt.Fprintf(outfh, "\\caption{%s}\n", escape(caption))
+		}
+		if label != "" {
+			fmt.Fprintf(outfh, "\\label{%s}\n", label)
+		}
+		fmt.Fprintf(outfh, "\\begin{tabular}{%s}\n\\toprule\n", colSpec)
+		if headerRow != nil {
+			fmt.Fprintf(outfh, "%s\n\\midrule\n", row(headerRow))
+		}
+		for _, record := range data {
+			fmt.Fprintf(outfh, "%s\n", row(record))
+		}
+		fmt.Fprintf(outfh, "\\bottomrule\n\\end{tabular}\n\\end{table}\n")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2latexCmd)
+	csv2latexCmd.Flags().StringP("alignments", "a", "", `column alignments (l, c, r, or p{width}), one value for all columns or one for each column. default: r for numeric columns and l for others`)
+	csv2latexCmd.Flags().StringP("caption", "", "", "table caption")
+	csv2latexCmd.Flags().StringP("label", "", "", "table label for cross-references")
+	csv2latexCmd.Flags().BoolP("longtable", "L", false, "output a longtable environment for tables spanning multiple pages")
+	csv2latexCmd.Flags().BoolP("no-escape", "", false, "do not escape special characters")
+	csv2latexCmd.Flags().StringP("position", "p", "htbp", "position specifier of the table environment")
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+// latexEscape escapes special characters of LaTeX.
+func latexEscape(s string) string {
+	return latexEscaper.Replace(s)
+}
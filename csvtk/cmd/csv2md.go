@@ -22,7 +22,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/mattn/go-runewidth"
@@ -43,6 +45,13 @@ Attention:
 
   csv2md treats the first row as header line and requires them to be unique
 
+Wide tables:
+
+  Tables wider than --split-width are split into segments of columns, with
+  key columns (-k/--key-cols) repeated in every segment. Tables wider than
+  --transpose-width are transposed, with columns named by values of key
+  columns or row numbers.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -52,9 +61,11 @@ Attention:
 		}
 		runtime.GOMAXPROCS(config.NumCPUs)
 
-		separator := "|"
 		aligns := getFlagCommaSeparatedStrings(cmd, "alignments")
 		minWidth := getFlagNonNegativeInt(cmd, "min-width")
+		keyCols := getFlagStringSlice(cmd, "key-cols")
+		splitWidth := getFlagNonNegativeInt(cmd, "split-width")
+		transposeWidth := getFlagNonNegativeInt(cmd, "transpose-width")
 		if minWidth < 3 {
 			checkError(fmt.Errorf("value of -w (--min-width) should not be less than 3"))
 		}
@@ -71,7 +82,7 @@ Attention:
 			}
 		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -119,87 +130,181 @@ Attention:
 			checkError(fmt.Errorf("number of alignment symbols (%d) should be equal to 1 or number of fields (%d)", len(aligns), len(header)))
 		}
 
-		widths := make([]int, len(header))
-		for i, c := range header {
-			if len(c) < minWidth {
-				widths[i] = minWidth
-			} else {
-				widths[i] = len(c)
+		keys := make([]int, 0, len(keyCols))
+		for _, col := range keyCols {
+			var _range []int
+			for i, c := range header {
+				if c == col {
+					_range = append(_range, i+1)
+				}
+			}
+			if len(_range) == 0 {
+				if i, err := strconv.Atoi(col); err == nil && i > 0 && i <= len(header) {
+					_range = []int{i}
+				} else if reIntegerRange.MatchString(col) {
+					_range = fieldRange(len(header), col)
+				}
+			}
+			if len(_range) == 0 {
+				checkError(fmt.Errorf("column not found for -k/--key-cols: %s", col))
+			}
+			for _, i := range _range {
+				keys = append(keys, i-1)
 			}
 		}
 
-		for _, data := range datas {
-			for j, c := range data {
-				if len(c) > widths[j] {
-					widths[j] = len(c)
+		// wide tables are split or transposed
+		tableWidth := func() ([]int, int) {
+			widths := make([]int, len(header))
+			total := 1
+			for i, c := range header {
+				widths[i] = max(runewidth.StringWidth(c), minWidth)
+				for _, data := range datas {
+					if i < len(data) {
+						widths[i] = max(widths[i], runewidth.StringWidth(data[i]))
+					}
 				}
+				widths[i]++
+				total += widths[i]
+			}
+			return widths, total
+		}
+		widths, total := tableWidth()
+		if transposeWidth > 0 && total > transposeWidth {
+			header, datas = transposeTable(header, datas, keys)
+			aligns2 := make([]string, len(header))
+			for i := range aligns2 {
+				aligns2[i] = aligns[0]
 			}
+			aligns, keys = aligns2, []int{0}
+			widths, total = tableWidth()
 		}
 
-		alignRow := make([]string, len(header))
-		var l, r, a string
-		for i, w := range widths {
-			switch aligns[i] {
-			case "c", "center":
-				l, r = ":", ":"
-			case "l", "left":
-				l, r = ":", "-"
-			case "r", "right":
-				l, r = "-", ":"
+		segments := [][]int{nil}
+		if splitWidth > 0 && total > splitWidth {
+			segments = splitTableColumns(widths, keys, 1, splitWidth)
+		} else {
+			for i := range header {
+				segments[0] = append(segments[0], i)
+			}
+		}
+
+		var _header, _aligns []string
+		var _datas [][]string
+		for k, cols := range segments {
+			if k > 0 {
+				outfh.WriteString("\n")
 			}
-			a = l
-			for j := 0; j < w-2; j++ {
-				a += "-"
+			_header = make([]string, len(cols))
+			_aligns = make([]string, len(cols))
+			for j, c := range cols {
+				_header[j] = header[c]
+				_aligns[j] = aligns[c]
 			}
-			a += r
-			alignRow[i] = a
+			_datas = make([][]string, len(datas))
+			for i, data := range datas {
+				_datas[i] = make([]string, len(cols))
+				for j, c := range cols {
+					if c < len(data) {
+						_datas[i][j] = data[c]
+					}
+				}
+			}
+			checkError(writeMarkdownTable(outfh, _header, _datas, _aligns, minWidth))
 		}
 
-		j := len(header) - 1
-		columns := make([]prettytable.Column, len(header))
-		for i, c := range header {
-			if i == 0 {
-				c = separator + c
-			} else if i == j {
-				c = c + strings.Repeat(" ", widths[i]-runewidth.StringWidth(c)) + separator
+		readerReport(&config, csvReader, file)
+	},
+}
+
+// writeMarkdownTable writes a table in markdown format.
+func writeMarkdownTable(outfh io.Writer, header []string, datas [][]string, aligns []string, minWidth int) error {
+	separator := "|"
+
+	widths := make([]int, len(header))
+	for i, c := range header {
+		if len(c) < minWidth {
+			widths[i] = minWidth
+		} else {
+			widths[i] = len(c)
+		}
+	}
+
+	for _, data := range datas {
+		for j, c := range data {
+			if len(c) > widths[j] {
+				widths[j] = len(c)
 			}
-			columns[i] = prettytable.Column{Header: c, AlignRight: false, MinWidth: minWidth}
 		}
-		tbl, err := prettytable.NewTable(columns...)
-		checkError(err)
-		tbl.Separator = separator
+	}
+
+	alignRow := make([]string, len(header))
+	var l, r, a string
+	for i, w := range widths {
+		switch aligns[i] {
+		case "c", "center":
+			l, r = ":", ":"
+		case "l", "left":
+			l, r = ":", "-"
+		case "r", "right":
+			l, r = "-", ":"
+		}
+		a = l
+		for j := 0; j < w-2; j++ {
+			a += "-"
+		}
+		a += r
+		alignRow[i] = a
+	}
+
+	j := len(header) - 1
+	columns := make([]prettytable.Column, len(header))
+	for i, c := range header {
+		if i == 0 {
+			c = separator + c
+		} else if i == j {
+			c = c + strings.Repeat(" ", widths[i]-runewidth.StringWidth(c)) + separator
+		}
+		columns[i] = prettytable.Column{Header: c, AlignRight: false, MinWidth: minWidth}
+	}
+	tbl, err := prettytable.NewTable(columns...)
+	if err != nil {
+		return err
+	}
+	tbl.Separator = separator
 
-		record2 := make([]interface{}, len(alignRow))
-		for i, c := range alignRow {
+	record2 := make([]interface{}, len(alignRow))
+	for i, c := range alignRow {
+		if i == 0 {
+			c = separator + c
+		} else if i == j {
+			c = c + separator
+		}
+		record2[i] = c
+	}
+	tbl.AddRow(record2...)
+	for _, record := range datas {
+		// have to do this stupid conversion
+		record2 := make([]interface{}, len(record))
+		for i, c := range record {
 			if i == 0 {
 				c = separator + c
 			} else if i == j {
-				c = c + separator
+				c = c + strings.Repeat(" ", widths[i]-runewidth.StringWidth(c)) + separator
 			}
 			record2[i] = c
 		}
 		tbl.AddRow(record2...)
-		for _, record := range datas {
-			// have to do this stupid conversion
-			record2 := make([]interface{}, len(record))
-			for i, c := range record {
-				if i == 0 {
-					c = separator + c
-				} else if i == j {
-					c = c + strings.Repeat(" ", widths[i]-runewidth.StringWidth(c)) + separator
-				}
-				record2[i] = c
-			}
-			tbl.AddRow(record2...)
-		}
-		outfh.Write(tbl.Bytes())
-
-		readerReport(&config, csvReader, file)
-	},
+	}
+	_, err = outfh.Write(tbl.Bytes())
+	return err
 }
 
 func init() {
 	RootCmd.AddCommand(csv2mdCmd)
 	csv2mdCmd.Flags().StringP("alignments", "a", "l", `comma separated alignments. e.g. -a l,c,c,c or -a c`)
 	csv2mdCmd.Flags().IntP("min-width", "w", 3, "min width (at least 3)")
+	csv2mdCmd.Flags().StringSliceP("key-cols", "k", []string{}, `key columns (field index/range or column name) repeated in every segment of a split table, or used to name columns of a transposed table`)
+	csv2mdCmd.Flags().IntP("split-width", "", 0, `split the table into segments of columns, if it's wider than this value. 0 for no splitting`)
+	csv2mdCmd.Flags().IntP("transpose-width", "", 0, `transpose the table, if it's wider than this value. 0 for no transposition`)
 }
@@ -0,0 +1,252 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2parquetCmd represents the csv2parquet command
+var csv2parquetCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2parquet",
+	Short: "convert CSV to Parquet format",
+	Long: `convert CSV to Parquet format
+
+Column types are inferred from all non-empty values:
+  int64    all values are integers
+  double   all values are numbers
+  boolean  all values are true/false, TRUE/FALSE, or True/False
+  string   others, or all columns when --all-text is given
+Empty values are stored as null, except for string columns.
+
+Attention:
+  1. The whole file is loaded into memory for type inference.
+  2. For files without header row (-H), column names are c1, c2, ...
+  3. The output file is not compressed by xopen, i.e., the ".gz" suffix
+     does not work. Please use --compression instead.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		allText := getFlagBool(cmd, "all-text")
+		codec, err := parquetCompression(getFlagString(cmd, "compression"))
+		checkError(err)
+		level := getFlagInt(cmd, "compression-level")
+		rowGroupSize := getFlagPositiveInt(cmd, "row-group-size")
+
+		file := files[0]
+		colnames, data, err := readCSVAll(config, file)
+		checkError(err)
+		if colnames == nil {
+			checkError(fmt.Errorf("no data found in file: %s", file))
+		}
+
+		// schema
+		types := make([]int, len(colnames))
+		fields := make([]arrow.Field, len(colnames))
+		for j, colname := range colnames {
+			if !allText {
+				types[j] = inferColumnType(data, j)
+			}
+			fields[j] = arrow.Field{Name: colname, Type: arrowDataType(types[j]), Nullable: true}
+		}
+		schema := arrow.NewSchema(fields, nil)
+
+		var outfh io.Writer
+		if isStdin(config.OutFile) {
+			outfh = os.Stdout
+		} else {
+			fh, err := os.Create(config.OutFile)
+			checkError(err)
+			outfh = fh // closed by the writer
+		}
+
+		opts := []parquet.WriterProperty{
+			parquet.WithCompression(codec),
+			parquet.WithMaxRowGroupLength(int64(rowGroupSize)),
+		}
+		if level != 0 {
+			opts = append(opts, parquet.WithCompressionLevel(level))
+		}
+		writer, err := pqarrow.NewFileWriter(schema, outfh, parquet.NewWriterProperties(opts...), pqarrow.DefaultWriterProps())
+		checkError(err)
+
+		builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		defer builder.Release()
+
+		batchSize := 1 << 16
+		if batchSize > rowGroupSize {
+			batchSize = rowGroupSize
+		}
+		for start := 0; start < len(data); start += batchSize {
+			end := start + batchSize
+			if end > len(data) {
+				end = len(data)
+			}
+			for _, record := range data[start:end] {
+				for j := range colnames {
+					if j < len(record) {
+						checkError(appendArrowValue(builder.Field(j), types[j], record[j]))
+					} else {
+						builder.Field(j).AppendNull()
+					}
+				}
+			}
+			rec := builder.NewRecord()
+			err = writer.Write(rec)
+			rec.Release()
+			checkError(err)
+		}
+		checkError(writer.Close())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2parquetCmd)
+	csv2parquetCmd.Flags().BoolP("all-text", "", false, `store all columns as strings, no type inference`)
+	csv2parquetCmd.Flags().StringP("compression", "c", "snappy", `compression codec: none, snappy, gzip, brotli, zstd, lz4raw`)
+	csv2parquetCmd.Flags().IntP("compression-level", "L", 0, `compression level, 0 for the default level of the codec`)
+	csv2parquetCmd.Flags().IntP("row-group-size", "g", 1048576, `maximum number of rows in a row group`)
+}
+
+func parquetCompression(name string) (compress.Compression, error) {
+	switch strings.ToLower(name) {
+	case "none", "uncompressed":
+		return compress.Codecs.Uncompressed, nil
+	case "snappy":
+		return compress.Codecs.Snappy, nil
+	case "gzip", "gz":
+		return compress.Codecs.Gzip, nil
+	case "brotli":
+		return compress.Codecs.Brotli, nil
+	case "zstd":
+		return compress.Codecs.Zstd, nil
+	case "lz4raw", "lz4":
+		return compress.Codecs.Lz4Raw, nil
+	}
+	return compress.Codecs.Uncompressed, fmt.Errorf("unsupported compression codec: %s", name)
+}
+
+// readCSVAll reads all records of a file. Column names are c1, c2, ...
+// for files without header row.
+func readCSVAll(config Config, file string) ([]string, [][]string, error) {
+	csvReader, err := newCSVReaderByConfig(config, file)
+	if err != nil {
+		if err == xopen.ErrNoContent {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	csvReader.Read(ReadOption{
+		FieldStr: "1-",
+	})
+
+	var colnames []string
+	data := make([][]string, 0, 1024)
+	checkFirstLine := true
+	for record := range csvReader.Ch {
+		if record.Err != nil {
+			return nil, nil, record.Err
+		}
+		if checkFirstLine {
+			checkFirstLine = false
+			if !config.NoHeaderRow || record.IsHeaderRow {
+				colnames = record.All
+				continue
+			}
+		}
+		data = append(data, record.All)
+	}
+	readerReport(&config, csvReader, file)
+
+	if colnames == nil && len(data) > 0 {
+		colnames = make([]string, len(data[0]))
+		for i := range colnames {
+			colnames[i] = fmt.Sprintf("c%d", i+1)
+		}
+	}
+	return colnames, data, nil
+}
+
+func arrowDataType(t int) arrow.DataType {
+	switch t {
+	case colTypeInt:
+		return arrow.PrimitiveTypes.Int64
+	case colTypeFloat:
+		return arrow.PrimitiveTypes.Float64
+	case colTypeBool:
+		return arrow.FixedWidthTypes.Boolean
+	}
+	return arrow.BinaryTypes.String
+}
+
+// appendArrowValue appends a value to a builder of the type inferred by inferColumnType.
+// An error is returned if the value does not match the type.
+func appendArrowValue(b array.Builder, t int, v string) error {
+	if v == "" && t != colTypeString {
+		b.AppendNull()
+		return nil
+	}
+	switch t {
+	case colTypeInt:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer: %s", v)
+		}
+		b.(*array.Int64Builder).Append(i)
+	case colTypeFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid float: %s", v)
+		}
+		b.(*array.Float64Builder).Append(f)
+	case colTypeBool:
+		if !isBoolValue(v) {
+			return fmt.Errorf("invalid boolean: %s", v)
+		}
+		b.(*array.BooleanBuilder).Append(strings.ToLower(v) == "true")
+	default:
+		b.(*array.StringBuilder).Append(v)
+	}
+	return nil
+}
@@ -57,7 +57,7 @@ Attention:
 		borderY := getFlagString(cmd, "vertical-border")
 		header := getFlagString(cmd, "header")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -0,0 +1,193 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// csv2tomlCmd represents the csv2toml command
+var csv2tomlCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2toml",
+	Short: "convert CSV to TOML format",
+	Long: `convert CSV to TOML format
+
+Each record is converted to a table in an array of tables, the name
+of which is given by -k/--key, with keys in the order of columns.
+
+Values:
+  1. "true" and "false" (case-insensitive) are converted to booleans.
+  2. TOML has no null value, so "", "na", "n/a", "none", "null", "."
+     are omitted, unless -b/--blanks is given.
+  3. Numbers are converted to numbers for columns given by -n/--parse-num,
+     otherwise strings.
+
+This is the reverse operation of "csvtk toml2csv".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		key := getFlagString(cmd, "key")
+		if key == "" {
+			checkError(fmt.Errorf("flag -k/--key needed"))
+		}
+		blanks := getFlagBool(cmd, "blanks")
+		parseNumAll, parseNumCols := getFlagParseNum(cmd, "parse-num")
+
+		if config.NoHeaderRow {
+			checkError(fmt.Errorf("header row needed for converting to TOML"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		w := bufio.NewWriter(outfh)
+		defer func() {
+			checkError(w.Flush())
+		}()
+
+		tableHeader := "[[" + tomlKey(key) + "]]\n"
+		var parseNum, first bool
+		first = true
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk csv2toml: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var header []string
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if header == nil {
+					header = make([]string, len(record.All))
+					for i, c := range record.All {
+						header[i] = tomlKey(c)
+					}
+					continue
+				}
+				if len(record.All) != len(header) {
+					checkError(fmt.Errorf("[line %d] number of columns (%d) does not match the header row (%d)", record.Line, len(record.All), len(header)))
+				}
+
+				if !first {
+					w.WriteString("\n")
+				}
+				first = false
+				w.WriteString(tableHeader)
+				for i, v := range record.All {
+					switch strings.ToLower(v) {
+					case "true", "false":
+						v = strings.ToLower(v)
+					case "", "na", "n/a", "none", "null", ".":
+						if !blanks {
+							continue
+						}
+						v = tomlString(v)
+					default:
+						parseNum = parseNumAll
+						if !parseNum {
+							_, parseNum = parseNumCols[i+1]
+						}
+						if !(parseNum && reTOMLNumber.MatchString(v)) {
+							v = tomlString(v)
+						}
+					}
+					fmt.Fprintf(w, "%s = %s\n", header[i], v)
+				}
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2tomlCmd)
+	csv2tomlCmd.Flags().StringP("key", "k", "records", "name of the array of tables")
+	csv2tomlCmd.Flags().BoolP("blanks", "b", false, `do not omit "", "na", "n/a", "none", "null", "."`)
+	csv2tomlCmd.Flags().StringSliceP("parse-num", "n", []string{}, `parse numeric values for nth column, multiple values are supported and "a"/"all" for all columns`)
+}
+
+var reTOMLNumber = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+var reTOMLBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey returns a bare key if possible, or a quoted key.
+func tomlKey(key string) string {
+	if reTOMLBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+// tomlString returns a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
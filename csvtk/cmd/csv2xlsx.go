@@ -25,10 +25,14 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mattn/go-runewidth"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
 )
 
 // csv2xlsxCmd represents the seq command
@@ -44,6 +48,44 @@ Attention:
   1. Multiple CSV/TSV files are saved as separated sheets in .xlsx file.
   2. All input files should all be CSV or TSV.
   3. First rows are freezed unless given '-H/--no-header-row'.
+     First columns can also be freezed via --freeze-cols.
+  4. Cell types:
+       -f/--format-numbers  numbers are saved as numbers, instead of text.
+       --format-dates       dates and times in formats below are saved as dates:
+                              2006-01-02, 2006/01/02, 2006-01-02 15:04:05,
+                              2006-01-02T15:04:05Z07:00 (RFC3339)
+  5. Column widths can be automatically adjusted to the widths of values
+     with -a/--auto-width, with a limit of --max-width.
+
+Conditional formatting:
+
+  Rules can be given via --cond-format (multiple values supported) in the
+  format of "column:criteria:value:fill-color", where the value and color
+  are optional. The column can be a column name or a 1-based field index.
+  Examples:
+
+    "score:>=:90:#C6EFCE"       # >, >=, <, <=, ==, !=
+    "score:between:60,80"       # between, not between, with two values
+    "name:duplicate::#FFC7CE"   # duplicate, unique
+    "score:top:3"               # top, bottom, with the rank (default 10)
+    "score:data_bar"            # data_bar, 2_color_scale, 3_color_scale
+
+  Or via a YAML file (--cond-format-file), with more options:
+
+    rules:
+      - columns: [score, score2]   # column names or field indexes
+        sheet: data                # optional, all sheets by default
+        criteria: ">="
+        value: 90
+        fill-color: "#C6EFCE"
+        font-color: "#006100"      # optional
+        bold: true                 # optional
+      - columns: [score]
+        criteria: between
+        value: 60,80
+        fill-color: "#FFEB9C"
+
+  The default fill color is #FFEB9C.
   
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -51,9 +93,27 @@ Attention:
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
 
 		formatNumbers := getFlagBool(cmd, "format-numbers")
+		formatDates := getFlagBool(cmd, "format-dates")
+		autoWidth := getFlagBool(cmd, "auto-width")
+		maxWidth := getFlagPositiveInt(cmd, "max-width")
+		freezeCols := getFlagNonNegativeInt(cmd, "freeze-cols")
+		condFormats := getFlagStringArray(cmd, "cond-format")
+		condFormatFile := getFlagString(cmd, "cond-format-file")
 
 		runtime.GOMAXPROCS(config.NumCPUs)
 
+		rules := make([]*xlsxCondFormatRule, 0, len(condFormats))
+		for _, s := range condFormats {
+			rule, err := parseXlsxCondFormatRule(s)
+			checkError(err)
+			rules = append(rules, rule)
+		}
+		if condFormatFile != "" {
+			_rules, err := readXlsxCondFormatRules(condFormatFile)
+			checkError(err)
+			rules = append(rules, _rules...)
+		}
+
 		singleInput := len(files) == 1
 
 		outFile := config.OutFile
@@ -68,11 +128,26 @@ Attention:
 		xlsx := excelize.NewFile()
 		defer checkError(xlsx.Close())
 
+		var styleDate, styleDateTime int
+		var err error
+		if formatDates {
+			fmtDate, fmtDateTime := "yyyy-mm-dd", "yyyy-mm-dd hh:mm:ss"
+			styleDate, err = xlsx.NewStyle(&excelize.Style{CustomNumFmt: &fmtDate})
+			checkError(err)
+			styleDateTime, err = xlsx.NewStyle(&excelize.Style{CustomNumFmt: &fmtDateTime})
+			checkError(err)
+		}
+
 		var sheet, cell, val string
 		var col, line int
 		var valFloat float64
+		var valTime time.Time
+		var isDate bool
 		var nSheets int
 		var idx, firstIdx int
+		var header []string
+		var widths []int
+		var w int
 		for i, file := range files {
 			csvReader, err := newCSVReaderByConfig(config, file)
 			if err != nil {
@@ -110,18 +185,17 @@ Attention:
 				}
 			}
 
+			freezeRows := 0
 			if !config.NoHeaderRow && !config.NoOutHeader {
-				checkError(xlsx.SetPanes(sheet, &excelize.Panes{
-					Freeze:      true,
-					Split:       false,
-					XSplit:      0,
-					YSplit:      1,
-					TopLeftCell: "A2",
-					ActivePane:  "bottomLeft",
-				}))
+				freezeRows = 1
+			}
+			if freezeRows > 0 || freezeCols > 0 {
+				checkError(xlsx.SetPanes(sheet, xlsxFreezePanes(freezeRows, freezeCols)))
 			}
 
 			line = 1
+			header = nil
+			widths = widths[:0]
 			handleHeaderRow := !config.NoHeaderRow
 			for record := range csvReader.Ch {
 				if record.Err != nil {
@@ -130,6 +204,7 @@ Attention:
 
 				if handleHeaderRow {
 					handleHeaderRow = false
+					header = record.Selected
 					if config.NoOutHeader {
 						continue
 					}
@@ -137,21 +212,65 @@ Attention:
 
 				for col, val = range record.Selected {
 					cell = fmt.Sprintf("%s%d", ExcelColumnIndex(col), line)
-					if formatNumbers {
-						valFloat, err = strconv.ParseFloat(val, 64)
-						if err != nil {
-							xlsx.SetCellValue(sheet, cell, val)
-						} else {
-							xlsx.SetCellFloat(sheet, cell, valFloat, -1, 64)
+
+					if autoWidth {
+						for col >= len(widths) {
+							widths = append(widths, 0)
+						}
+						if w = runewidth.StringWidth(val); w > widths[col] {
+							widths[col] = w
 						}
-					} else {
-						xlsx.SetCellValue(sheet, cell, val)
 					}
+
+					if line > 1 || config.NoHeaderRow || config.NoOutHeader {
+						if formatNumbers {
+							valFloat, err = strconv.ParseFloat(val, 64)
+							if err == nil {
+								xlsx.SetCellFloat(sheet, cell, valFloat, -1, 64)
+								continue
+							}
+						}
+						if formatDates {
+							valTime, isDate, err = parseXlsxDate(val)
+							if err == nil {
+								xlsx.SetCellValue(sheet, cell, valTime)
+								if isDate {
+									xlsx.SetCellStyle(sheet, cell, cell, styleDate)
+								} else {
+									xlsx.SetCellStyle(sheet, cell, cell, styleDateTime)
+								}
+								continue
+							}
+						}
+					}
+					xlsx.SetCellValue(sheet, cell, val)
 				}
 				line++
 			}
 
 			readerReport(&config, csvReader, file)
+
+			if autoWidth {
+				for col, w = range widths {
+					w += 2
+					if w > maxWidth {
+						w = maxWidth
+					}
+					checkError(xlsx.SetColWidth(sheet, ExcelColumnIndex(col), ExcelColumnIndex(col), float64(w)))
+				}
+			}
+
+			if len(rules) > 0 && line > 1 {
+				firstRow := 1
+				if !config.NoHeaderRow && !config.NoOutHeader {
+					firstRow = 2
+				}
+				if firstRow < line {
+					for _, rule := range rules {
+						checkError(rule.apply(xlsx, sheet, header, firstRow, line-1))
+					}
+				}
+			}
 		}
 
 		xlsx.SetActiveSheet(firstIdx)
@@ -163,7 +282,231 @@ func init() {
 	RootCmd.AddCommand(csv2xlsxCmd)
 
 	csv2xlsxCmd.Flags().BoolP("format-numbers", "f", false, `save numbers in number format, instead of text`)
+	csv2xlsxCmd.Flags().BoolP("format-dates", "", false, `save dates and times in date format, instead of text`)
+	csv2xlsxCmd.Flags().BoolP("auto-width", "a", false, `automatically adjust column widths to the widths of values`)
+	csv2xlsxCmd.Flags().IntP("max-width", "", 60, `maximum column width for -a/--auto-width`)
+	csv2xlsxCmd.Flags().IntP("freeze-cols", "", 0, `the number of first columns to freeze`)
+	csv2xlsxCmd.Flags().StringArrayP("cond-format", "c", []string{}, `conditional formatting rule in the format of "column:criteria:value:fill-color", multiple values supported. type "csvtk csv2xlsx -h" for details`)
+	csv2xlsxCmd.Flags().StringP("cond-format-file", "", "", `YAML file of conditional formatting rules. type "csvtk csv2xlsx -h" for details`)
+}
+
+func xlsxFreezePanes(rows, cols int) *excelize.Panes {
+	topLeftCell := fmt.Sprintf("%s%d", ExcelColumnIndex(cols), rows+1)
+	activePane := "bottomRight"
+	if cols == 0 {
+		activePane = "bottomLeft"
+	} else if rows == 0 {
+		activePane = "topRight"
+	}
+	return &excelize.Panes{
+		Freeze:      true,
+		Split:       false,
+		XSplit:      cols,
+		YSplit:      rows,
+		TopLeftCell: topLeftCell,
+		ActivePane:  activePane,
+	}
+}
+
+var xlsxDateLayouts = []string{"2006-01-02", "2006/01/02"}
+var xlsxDateTimeLayouts = []string{"2006-01-02 15:04:05", time.RFC3339}
 
+// parseXlsxDate parses a date or date-time, and reports whether it's a date.
+func parseXlsxDate(s string) (time.Time, bool, error) {
+	var t time.Time
+	var err error
+	if len(s) < 8 || s[0] < '0' || s[0] > '9' {
+		return t, false, fmt.Errorf("invalid date: %s", s)
+	}
+	for _, layout := range xlsxDateLayouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, true, nil
+		}
+	}
+	for _, layout := range xlsxDateTimeLayouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, false, nil
+		}
+	}
+	return t, false, err
+}
+
+// xlsxCondFormatRule is a conditional formatting rule for some columns.
+type xlsxCondFormatRule struct {
+	Columns   []string `yaml:"columns"`
+	Sheet     string   `yaml:"sheet"`
+	Criteria  string   `yaml:"criteria"`
+	Value     string   `yaml:"value"`
+	FillColor string   `yaml:"fill-color"`
+	FontColor string   `yaml:"font-color"`
+	Bold      bool     `yaml:"bold"`
+
+	format *excelize.ConditionalFormatOptions
+}
+
+var xlsxCondFormatTypes = map[string]bool{
+	"duplicate":     true,
+	"unique":        true,
+	"top":           true,
+	"bottom":        true,
+	"data_bar":      true,
+	"2_color_scale": true,
+	"3_color_scale": true,
+}
+
+// parseXlsxCondFormatRule parses a rule in the format of
+// "column:criteria:value:fill-color".
+func parseXlsxCondFormatRule(s string) (*xlsxCondFormatRule, error) {
+	items := strings.Split(s, ":")
+	if len(items) < 2 || len(items) > 4 {
+		return nil, fmt.Errorf(`invalid conditional formatting rule, "column:criteria:value:fill-color" expected: %s`, s)
+	}
+	rule := &xlsxCondFormatRule{Columns: []string{items[0]}, Criteria: items[1]}
+	if len(items) > 2 {
+		rule.Value = items[2]
+	}
+	if len(items) > 3 {
+		rule.FillColor = items[3]
+	}
+	return rule, rule.check()
+}
+
+func readXlsxCondFormatRules(file string) ([]*xlsxCondFormatRule, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read conditional formatting file: %s", err)
+	}
+	defer fh.Close()
+
+	var spec struct {
+		Rules []*xlsxCondFormatRule `yaml:"rules"`
+	}
+	if err = yaml.NewDecoder(fh).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("fail to parse conditional formatting file %s: %s", file, err)
+	}
+	for _, rule := range spec.Rules {
+		if err = rule.check(); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return spec.Rules, nil
+}
+
+func (rule *xlsxCondFormatRule) check() error {
+	if len(rule.Columns) == 0 {
+		return fmt.Errorf("no columns given in conditional formatting rule")
+	}
+	criteria := strings.ToLower(strings.TrimSpace(rule.Criteria))
+	format := &excelize.ConditionalFormatOptions{}
+	switch criteria {
+	case "between", "not between":
+		values := strings.Split(rule.Value, ",")
+		if len(values) != 2 {
+			return fmt.Errorf(`two values separated by comma needed for criteria "%s": %s`, criteria, rule.Value)
+		}
+		format.Type, format.Criteria = "cell", criteria
+		format.MinValue, format.MaxValue = values[0], values[1]
+	case ">", ">=", "<", "<=", "==", "!=":
+		if rule.Value == "" {
+			return fmt.Errorf(`value needed for criteria "%s"`, criteria)
+		}
+		format.Type, format.Criteria, format.Value = "cell", criteria, rule.Value
+		if _, err := strconv.ParseFloat(rule.Value, 64); err != nil {
+			format.Value = strconv.Quote(rule.Value)
+		}
+	default:
+		if !xlsxCondFormatTypes[criteria] {
+			return fmt.Errorf("unsupported criteria of conditional formatting rule: %s", rule.Criteria)
+		}
+		format.Type, format.Criteria = criteria, "="
+		switch criteria {
+		case "top", "bottom":
+			format.Value = "10"
+			if rule.Value != "" {
+				if _, err := strconv.Atoi(rule.Value); err != nil {
+					return fmt.Errorf(`integer needed for criteria "%s": %s`, criteria, rule.Value)
+				}
+				format.Value = rule.Value
+			}
+		case "data_bar":
+			format.MinType, format.MaxType = "min", "max"
+			format.BarColor = "#638EC6"
+			if rule.FillColor != "" {
+				format.BarColor = rule.FillColor
+			}
+		case "2_color_scale":
+			format.MinType, format.MaxType = "min", "max"
+			format.MinColor, format.MaxColor = "#F8696B", "#63BE7B"
+		case "3_color_scale":
+			format.MinType, format.MidType, format.MaxType = "min", "percentile", "max"
+			format.MidValue = "50"
+			format.MinColor, format.MidColor, format.MaxColor = "#F8696B", "#FFEB84", "#63BE7B"
+		}
+	}
+	rule.format = format
+	return nil
+}
+
+// apply adds the rule to the matched columns of a sheet, from row
+// firstRow to lastRow (1-based).
+func (rule *xlsxCondFormatRule) apply(xlsx *excelize.File, sheet string, header []string, firstRow, lastRow int) error {
+	if rule.Sheet != "" && rule.Sheet != sheet {
+		return nil
+	}
+
+	format := *rule.format
+	switch format.Type {
+	case "data_bar", "2_color_scale", "3_color_scale":
+	default:
+		fillColor := rule.FillColor
+		if fillColor == "" {
+			fillColor = "#FFEB9C"
+		}
+		style := &excelize.Style{
+			Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{fillColor}},
+		}
+		if rule.FontColor != "" || rule.Bold {
+			style.Font = &excelize.Font{Color: rule.FontColor, Bold: rule.Bold}
+		}
+		id, err := xlsx.NewConditionalStyle(style)
+		if err != nil {
+			return err
+		}
+		format.Format = id
+	}
+
+	var cols []int
+	var found bool
+	var c int
+	for _, col := range rule.Columns {
+		found = false
+		for i, name := range header {
+			if name == col {
+				cols = append(cols, i)
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		if reIntegers.MatchString(col) {
+			c, _ = strconv.Atoi(col)
+			if c > 0 {
+				cols = append(cols, c-1)
+				continue
+			}
+		}
+		return fmt.Errorf("column not found in sheet %s: %s", sheet, col)
+	}
+
+	var ref string
+	for _, c = range cols {
+		ref = fmt.Sprintf("%s%d:%s%d", ExcelColumnIndex(c), firstRow, ExcelColumnIndex(c), lastRow)
+		if err := xlsx.SetConditionalFormat(sheet, ref, []excelize.ConditionalFormatOptions{format}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func ExcelColumnIndex(col int) string {
@@ -0,0 +1,187 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// csv2yamlCmd represents the csv2yaml command
+var csv2yamlCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "csv2yaml",
+	Short: "convert CSV to YAML format",
+	Long: `convert CSV to YAML format
+
+Each record is converted to a mapping in a sequence, with keys in the
+order of columns. Records are outputted one by one.
+
+Values:
+  1. "true" and "false" (case-insensitive) are converted to booleans.
+  2. "", "na", "n/a", "none", "null", "." are converted to null,
+     unless -b/--blanks is given.
+  3. Numbers are converted to numbers for columns given by -n/--parse-num,
+     otherwise strings.
+
+This is the reverse operation of "csvtk yaml2csv".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		blanks := getFlagBool(cmd, "blanks")
+		parseNumAll, parseNumCols := getFlagParseNum(cmd, "parse-num")
+
+		if config.NoHeaderRow {
+			checkError(fmt.Errorf("header row needed for converting to YAML"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var buf bytes.Buffer
+		var parseNum bool
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk csv2yaml: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var header []string
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if header == nil {
+					header = record.All
+					continue
+				}
+				if len(record.All) != len(header) {
+					checkError(fmt.Errorf("[line %d] number of columns (%d) does not match the header row (%d)", record.Line, len(record.All), len(header)))
+				}
+
+				node := &yaml.Node{Kind: yaml.MappingNode}
+				for i, v := range record.All {
+					parseNum = parseNumAll
+					if !parseNum {
+						_, parseNum = parseNumCols[i+1]
+					}
+					node.Content = append(node.Content,
+						&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: header[i]},
+						yamlScalar(v, blanks, parseNum))
+				}
+
+				buf.Reset()
+				enc := yaml.NewEncoder(&buf)
+				enc.SetIndent(2)
+				checkError(enc.Encode(node))
+				checkError(enc.Close())
+
+				// as an item of a sequence
+				for i, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+					if i == 0 {
+						outfh.WriteString("- ")
+					} else {
+						outfh.WriteString("  ")
+					}
+					outfh.WriteString(line)
+					outfh.WriteString("\n")
+				}
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(csv2yamlCmd)
+	csv2yamlCmd.Flags().BoolP("blanks", "b", false, `do not convert "", "na", "n/a", "none", "null", "." to null`)
+	csv2yamlCmd.Flags().StringSliceP("parse-num", "n", []string{}, `parse numeric values for nth column, multiple values are supported and "a"/"all" for all columns`)
+}
+
+// getFlagParseNum parses the flag of column indexes for parsing numbers,
+// "a"/"all" for all columns.
+func getFlagParseNum(cmd *cobra.Command, flag string) (bool, map[int]struct{}) {
+	cols := make(map[int]struct{})
+	var n int
+	for _, c := range getFlagStringSlice(cmd, flag) {
+		c = strings.ToLower(c)
+		if c == "a" || c == "all" {
+			return true, cols
+		}
+		if !reIntegers.MatchString(c) {
+			checkError(fmt.Errorf("positive column index needed: %s", c))
+		}
+		n, _ = strconv.Atoi(c)
+		if n < 1 {
+			checkError(fmt.Errorf("positive column index needed: %s", c))
+		}
+		cols[n] = struct{}{}
+	}
+	return false, cols
+}
+
+// yamlScalar converts a value to a YAML scalar node.
+func yamlScalar(val string, blanks bool, parseNum bool) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: val}
+	switch strings.ToLower(val) {
+	case "true", "false":
+		node.Tag, node.Value = "!!bool", strings.ToLower(val)
+		return node
+	case "", "na", "n/a", "none", "null", ".":
+		if !blanks {
+			node.Tag, node.Value = "!!null", "null"
+		}
+		return node
+	}
+	if parseNum {
+		if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+			node.Tag = "!!int"
+		} else if _, err := strconv.ParseFloat(val, 64); err == nil {
+			node.Tag = "!!float"
+		}
+	}
+	return node
+}
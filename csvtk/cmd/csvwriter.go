@@ -0,0 +1,224 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// outputDialect controls quoting and escaping of CSV output, set by global flags.
+type outputDialect struct {
+	QuoteAll   bool
+	QuoteNever bool
+	Quote      rune
+	Backslash  bool // escaping quotes with backslashes instead of doubling them
+	CRLF       bool
+}
+
+var outDialect = outputDialect{Quote: '"'}
+
+// custom returns true if records can not be written by encoding/csv.
+func (d outputDialect) custom() bool {
+	return d.QuoteAll || d.QuoteNever || d.Quote != '"' || d.Backslash
+}
+
+// setOutputDialect sets the quoting and escaping of CSV output.
+func setOutputDialect(quoteAll, quoteNever bool, quote rune, escapeStyle string, crlf, lf bool) error {
+	if quoteAll && quoteNever {
+		return fmt.Errorf("flags --quote-all and --quote-never are exclusive")
+	}
+	if crlf && lf {
+		return fmt.Errorf("flags --crlf and --lf are exclusive")
+	}
+	if quote == '\r' || quote == '\n' || quote == utf8.RuneError {
+		return fmt.Errorf("invalid value of flag --quote-char: %q", quote)
+	}
+	d := outputDialect{QuoteAll: quoteAll, QuoteNever: quoteNever, Quote: quote, CRLF: crlf}
+	switch escapeStyle {
+	case "double":
+	case "backslash":
+		d.Backslash = true
+	default:
+		return fmt.Errorf("unsupported value of flag --escape-style: %s. available: double, backslash", escapeStyle)
+	}
+	outDialect = d
+	return nil
+}
+
+// csvWriter is the shared writer of CSV records, which behaves the same as
+// csv.Writer unless the output dialect is changed by global flags, e.g.,
+// --quote-all, --quote-never, --quote-char and --escape-style.
+// Comment lines kept by --comments keep are written before the first record.
+// Records written to an in-memory file, see wopen(), are passed as they are.
+type csvWriter struct {
+	*csv.Writer // Comma and UseCRLF are also used in the custom dialect
+
+	dialect  outputDialect
+	out      io.Writer
+	w        *bufio.Writer
+	err      error
+	comments bool // comment lines kept by --comments keep are not written yet
+	mem      *memFile
+}
+
+// newCSVWriter returns a csvWriter writing to w.
+func newCSVWriter(w io.Writer) *csvWriter {
+	writer := &csvWriter{Writer: csv.NewWriter(w), dialect: outDialect, out: w, comments: true}
+	writer.UseCRLF = outDialect.CRLF
+	if writer.mem = memFileOfWriter(w); writer.mem != nil {
+		return writer
+	}
+	if outDialect.custom() {
+		writer.w = bufio.NewWriter(w)
+	}
+	return writer
+}
+
+// Write writes a single record.
+func (w *csvWriter) Write(record []string) error {
+	if w.mem != nil {
+		w.mem.put(record)
+		return nil
+	}
+	if w.comments {
+		w.comments = false
+		if w.w != nil {
+			writeKeptComments(w.w)
+		} else {
+			writeKeptComments(w.out)
+		}
+	}
+	if w.w == nil {
+		return w.Writer.Write(record)
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	d := w.dialect
+	for i, field := range record {
+		if i > 0 {
+			w.w.WriteRune(w.Comma)
+		}
+
+		if !d.QuoteAll && !w.fieldNeedsQuotes(field) {
+			w.w.WriteString(field)
+			continue
+		}
+		if d.QuoteNever {
+			w.err = fmt.Errorf("field needs quoting but --quote-never is given: %q", field)
+			return w.err
+		}
+
+		w.w.WriteRune(d.Quote)
+		for _, r := range field {
+			switch {
+			case r == d.Quote:
+				if d.Backslash {
+					w.w.WriteByte('\\')
+				} else {
+					w.w.WriteRune(d.Quote)
+				}
+				w.w.WriteRune(r)
+			case r == '\\' && d.Backslash:
+				w.w.WriteString(`\\`)
+			case r == '\r':
+				if !w.UseCRLF {
+					w.w.WriteByte('\r')
+				}
+			case r == '\n' && w.UseCRLF:
+				w.w.WriteString("\r\n")
+			default:
+				w.w.WriteRune(r)
+			}
+		}
+		w.w.WriteRune(d.Quote)
+	}
+
+	if w.UseCRLF {
+		_, w.err = w.w.WriteString("\r\n")
+	} else {
+		w.err = w.w.WriteByte('\n')
+	}
+	return w.err
+}
+
+// WriteAll writes multiple records and flushes the writer.
+func (w *csvWriter) WriteAll(records [][]string) error {
+	if w.w == nil && w.mem == nil {
+		return w.Writer.WriteAll(records)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *csvWriter) Flush() {
+	if w.mem != nil {
+		return
+	}
+	if w.w == nil {
+		w.Writer.Flush()
+		return
+	}
+	if err := w.w.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *csvWriter) Error() error {
+	if w.w == nil && w.mem == nil {
+		return w.Writer.Error()
+	}
+	return w.err
+}
+
+// fieldNeedsQuotes is the same as the one of encoding/csv, but with the
+// quote character of the dialect, and backslashes for --escape-style
+// backslash.
+func (w *csvWriter) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` {
+		return true
+	}
+	if strings.ContainsRune(field, w.Comma) || strings.ContainsRune(field, w.dialect.Quote) ||
+		strings.ContainsAny(field, "\r\n") {
+		return true
+	}
+	if w.dialect.Backslash && strings.ContainsRune(field, '\\') {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
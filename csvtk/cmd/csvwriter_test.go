@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+// fields needing quotes or not in different dialects
+var csvWriterTestRecords = [][]string{
+	{"a", "b", "c"},
+	{"", "x y", " leading space"},
+	{"with,comma", "with\ttab", "with;semicolon"},
+	{`with "quotes"`, `it's`, `back\slash`},
+	{"new\nline", "carriage\rreturn", "crlf\r\nend"},
+	{`\.`, "\t", "trailing space "},
+	{"", "", ""},
+	{"unicode 中文", "émoji 😀", "a\u00a0b"},
+}
+
+// writeCSVRecords writes records with the output dialect.
+// The custom writer is always used if custom is true.
+func writeCSVRecords(t *testing.T, d outputDialect, comma rune, records [][]string, custom bool) (string, error) {
+	defer func(d outputDialect) { outDialect = d }(outDialect)
+	outDialect = d
+
+	var buf bytes.Buffer
+	w := newCSVWriter(&buf)
+	if custom && w.w == nil {
+		w.w = bufio.NewWriter(&buf)
+	}
+	w.Comma = comma
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return buf.String(), err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		t.Fatalf("failed to flush: %s", err)
+	}
+	return buf.String(), nil
+}
+
+func TestCSVWriterDefault(t *testing.T) {
+	for _, crlf := range []bool{false, true} {
+		for _, comma := range []rune{',', '\t', ';', '|'} {
+			var buf bytes.Buffer
+			w := csv.NewWriter(&buf)
+			w.Comma = comma
+			w.UseCRLF = crlf
+			if err := w.WriteAll(csvWriterTestRecords); err != nil {
+				t.Fatal(err)
+			}
+			expect := buf.String()
+
+			d := outputDialect{Quote: '"', CRLF: crlf}
+			for _, custom := range []bool{false, true} {
+				got, err := writeCSVRecords(t, d, comma, csvWriterTestRecords, custom)
+				if err != nil {
+					t.Fatalf("failed to write records: %s", err)
+				}
+				if got != expect {
+					t.Errorf("output of default dialect (crlf: %v, comma: %q, custom: %v) differs from encoding/csv:\nwant: %q\n got: %q",
+						crlf, comma, custom, expect, got)
+				}
+			}
+		}
+	}
+}
+
+func TestCSVWriterDialects(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect outputDialect
+		comma   rune
+		records [][]string
+		expect  string
+		err     bool
+	}{
+		{
+			name:    "quote all",
+			dialect: outputDialect{QuoteAll: true, Quote: '"'},
+			comma:   ',',
+			records: [][]string{{"a", "", "b,c", `d"e`}},
+			expect:  `"a","","b,c","d""e"` + "\n",
+		},
+		{
+			name:    "quote never",
+			dialect: outputDialect{QuoteNever: true, Quote: '"'},
+			comma:   ',',
+			records: [][]string{{"a", "", "b c", `it's`}},
+			expect:  "a,,b c,it's\n",
+		},
+		{
+			name:    "quote never with a delimiter",
+			dialect: outputDialect{QuoteNever: true, Quote: '"'},
+			comma:   ',',
+			records: [][]string{{"a", "b,c"}},
+			err:     true,
+		},
+		{
+			name:    "quote never with a quote",
+			dialect: outputDialect{QuoteNever: true, Quote: '"'},
+			comma:   ',',
+			records: [][]string{{`a"b`}},
+			err:     true,
+		},
+		{
+			name:    "quote never with a new line",
+			dialect: outputDialect{QuoteNever: true, Quote: '"'},
+			comma:   '\t',
+			records: [][]string{{"a\nb"}},
+			err:     true,
+		},
+		{
+			name:    "quote never with a quote in TSV",
+			dialect: outputDialect{QuoteNever: true, Quote: '"'},
+			comma:   '\t',
+			records: [][]string{{"a,b", `c"d`}},
+			err:     true,
+		},
+		{
+			name:    "quote char",
+			dialect: outputDialect{Quote: '\''},
+			comma:   ',',
+			records: [][]string{{"it's", `say "hi"`, "a,b", "x\ny"}},
+			expect:  `'it''s',say "hi",'a,b',` + "'x\ny'\n",
+		},
+		{
+			name:    "quote char and quote all",
+			dialect: outputDialect{QuoteAll: true, Quote: '|'},
+			comma:   ',',
+			records: [][]string{{"a", "b|c"}},
+			expect:  "|a|,|b||c|\n",
+		},
+		{
+			name:    "escape style double",
+			dialect: outputDialect{Quote: '"'},
+			comma:   ',',
+			records: [][]string{{`a"b`, `c\d`}},
+			expect:  `"a""b",c\d` + "\n",
+		},
+		{
+			name:    "escape style backslash",
+			dialect: outputDialect{Quote: '"', Backslash: true},
+			comma:   ',',
+			records: [][]string{{`a"b`, `c\d`, "e", `\`}},
+			expect:  `"a\"b","c\\d",e,"\\"` + "\n",
+		},
+		{
+			name:    "escape style backslash with quote char",
+			dialect: outputDialect{Quote: '\'', Backslash: true},
+			comma:   ',',
+			records: [][]string{{"it's", `"x"`}},
+			expect:  `'it\'s',"x"` + "\n",
+		},
+		{
+			name:    "crlf",
+			dialect: outputDialect{QuoteAll: true, Quote: '"', CRLF: true},
+			comma:   ',',
+			records: [][]string{{"a", "b\nc"}, {"d", "e\r\nf"}},
+			expect:  "\"a\",\"b\r\nc\"\r\n\"d\",\"e\r\nf\"\r\n",
+		},
+		{
+			name:    "lf",
+			dialect: outputDialect{QuoteAll: true, Quote: '"'},
+			comma:   ',',
+			records: [][]string{{"a", "b\nc"}, {"d", "e\r\nf"}},
+			expect:  "\"a\",\"b\nc\"\n\"d\",\"e\r\nf\"\n",
+		},
+		{
+			name:    "tab delimiter",
+			dialect: outputDialect{Quote: '\''},
+			comma:   '\t',
+			records: [][]string{{"a,b", "c\td", "it's"}},
+			expect:  "a,b\t'c\td'\t'it''s'\n",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := writeCSVRecords(t, c.dialect, c.comma, c.records, false)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: error expected, got output: %q", c.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("%s:\nwant: %q\n got: %q", c.name, c.expect, got)
+		}
+	}
+}
+
+func TestSetOutputDialect(t *testing.T) {
+	defer func(d outputDialect) { outDialect = d }(outDialect)
+
+	cases := []struct {
+		quoteAll, quoteNever bool
+		quote                rune
+		escapeStyle          string
+		crlf, lf             bool
+		expect               outputDialect
+		err                  bool
+	}{
+		{quote: '"', escapeStyle: "double", expect: outputDialect{Quote: '"'}},
+		{quote: '"', escapeStyle: "double", lf: true, expect: outputDialect{Quote: '"'}},
+		{quote: '"', escapeStyle: "double", crlf: true, expect: outputDialect{Quote: '"', CRLF: true}},
+		{quoteAll: true, quote: '\'', escapeStyle: "backslash",
+			expect: outputDialect{QuoteAll: true, Quote: '\'', Backslash: true}},
+		{quoteNever: true, quote: '"', escapeStyle: "double", expect: outputDialect{QuoteNever: true, Quote: '"'}},
+		{quoteAll: true, quoteNever: true, quote: '"', escapeStyle: "double", err: true},
+		{quote: '"', escapeStyle: "double", crlf: true, lf: true, err: true},
+		{quote: '"', escapeStyle: "none", err: true},
+		{quote: '\n', escapeStyle: "double", err: true},
+	}
+	for i, c := range cases {
+		outDialect = outputDialect{Quote: '"'}
+		err := setOutputDialect(c.quoteAll, c.quoteNever, c.quote, c.escapeStyle, c.crlf, c.lf)
+		if c.err {
+			if err == nil {
+				t.Errorf("case %d: error expected", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if outDialect != c.expect {
+			t.Errorf("case %d: want %+v, got %+v", i, c.expect, outDialect)
+		}
+		if outDialect.custom() != (c.quoteAll || c.quoteNever || c.quote != '"' || c.escapeStyle == "backslash") {
+			t.Errorf("case %d: unexpected custom dialect: %v", i, outDialect.custom())
+		}
+	}
+}
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"runtime"
 
@@ -78,11 +77,11 @@ Examples:
 		allowMissingColumn := getFlagBool(cmd, "allow-missing-col")
 		blankMissingColumn := getFlagBool(cmd, "blank-missing-col")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' { // default value, no other value given
 				writer.Comma = '\t'
@@ -0,0 +1,436 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"gitlab.com/metakeule/fmtdate"
+)
+
+// datecalcCmd represents the datecalc command
+var datecalcCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "datecalc",
+	Short: "date/time arithmetic: differences, durations, truncation, time zones, epochs and extraction",
+	Long: `date/time arithmetic: differences, durations, truncation, time zones, epochs and extraction
+
+Operations on the field given by -f/--field, applied in this order:
+
+  1. parse      dates are parsed by https://github.com/araddon/dateparse in
+                the time zone of -z/--time-zone, or from epochs with --from-epoch
+  2. --to-tz    convert to another time zone, e.g., "America/New_York"
+  3. --add      add a duration, e.g., "1d12h", "-2w", "1y6mo"
+  4. --trunc    truncate to the start of a unit: second, minute, hour, day, week,
+                month, year. Weeks start on Mondays
+  5. output     in --format (MS Excel (TM) syntax, see "csvtk fmtdate -h"), or
+                epochs with --to-epoch
+
+The field is only replaced when any of the flags above is given.
+
+New columns:
+
+  --diff FIELD     difference of the field minus FIELD in --unit, named by --diff-name
+  --extract PARTS  parts of dates, named "<field>_<part>". Parts: year, quarter,
+                   month, day, weekday, weekday_name, yearday, week, hour, minute, second
+
+Units of durations and differences:
+  ns, us, ms, s, m (minute), h, d, w, mo (month), y (year)
+
+Differences in months and years are whole calendar months and years.
+
+Values failed to parse are kept unchanged, with the new columns left empty.
+
+Examples:
+
+    csvtk datecalc -f end --diff start --unit d --diff-name days
+    csvtk datecalc -f dt --add 1d --trunc day --format YYYY-MM-DD
+    csvtk datecalc -f ts --from-epoch s --to-tz Asia/Shanghai
+    csvtk datecalc -f dt --extract year,month,weekday_name
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		field := getFlagString(cmd, "field")
+		if field == "" {
+			checkError(fmt.Errorf("flag -f (--field) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+
+		if timezone := getFlagString(cmd, "time-zone"); timezone != "" {
+			loc, err := time.LoadLocation(timezone)
+			if err != nil {
+				checkError(fmt.Errorf("setting time zone: %s", err))
+			}
+			time.Local = loc
+		}
+
+		var toLoc *time.Location
+		if tz := getFlagString(cmd, "to-tz"); tz != "" {
+			var err error
+			toLoc, err = time.LoadLocation(tz)
+			if err != nil {
+				checkError(fmt.Errorf("value of flag --to-tz: %s", err))
+			}
+		}
+
+		fromEpoch := getFlagString(cmd, "from-epoch")
+		toEpoch := getFlagString(cmd, "to-epoch")
+		for _, unit := range []string{fromEpoch, toEpoch} {
+			if unit != "" {
+				if _, ok := epochUnits[unit]; !ok {
+					checkError(fmt.Errorf("unsupported epoch unit: %s. available: s, ms, us, ns", unit))
+				}
+			}
+		}
+
+		var add dateDuration
+		if s := getFlagString(cmd, "add"); s != "" {
+			var err error
+			add, err = parseDateDuration(s)
+			checkError(err)
+		}
+
+		trunc := getFlagString(cmd, "trunc")
+		if trunc != "" && !dateFreqs[trunc] {
+			checkError(fmt.Errorf("unsupported unit of --trunc: %s. available: second, minute, hour, day, week, month, year", trunc))
+		}
+
+		outfmt := getFlagString(cmd, "format")
+		replace := fromEpoch != "" || toEpoch != "" || toLoc != nil || !add.isZero() || trunc != "" ||
+			cmd.Flags().Changed("format")
+
+		diffField := getFlagString(cmd, "diff")
+		diffName := getFlagString(cmd, "diff-name")
+		unit := getFlagString(cmd, "unit")
+		if _, ok := dateUnits[unit]; !ok {
+			checkError(fmt.Errorf("unsupported unit: %s. available: ns, us, ms, s, m, h, d, w, mo, y", unit))
+		}
+		decimals := getFlagInt(cmd, "decimals")
+
+		var parts []string
+		if s := getFlagString(cmd, "extract"); s != "" {
+			for _, p := range strings.Split(s, ",") {
+				p = strings.TrimSpace(p)
+				if _, ok := dateParts[p]; !ok {
+					checkError(fmt.Errorf("unsupported part of date: %s", p))
+				}
+				parts = append(parts, p)
+			}
+		}
+
+		if !replace && diffField == "" && len(parts) == 0 {
+			checkError(fmt.Errorf("no operation given"))
+		}
+
+		parse := func(s string) (time.Time, bool) {
+			s = strings.TrimSpace(s)
+			if fromEpoch != "" {
+				n, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return time.Time{}, false
+				}
+				ns := n * float64(epochUnits[fromEpoch])
+				if ns >= math.MaxInt64 || ns <= math.MinInt64 {
+					return time.Time{}, false
+				}
+				return time.Unix(0, int64(ns)).In(time.Local), true
+			}
+			t, err := dateparse.ParseLocal(s)
+			return t, err == nil
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk datecalc: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr:    field,
+				FuzzyFields: fuzzyFields,
+			})
+
+			checkFirstLine := true
+			var f, g int
+			var t time.Time
+			var ok bool
+			var cols []string
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					if len(record.Fields) != 1 {
+						checkError(fmt.Errorf("flag -f (--field) should match exactly one field: %s", field))
+					}
+					f = record.Fields[0]
+					if diffField != "" {
+						fields := selectFieldsByHeader(record.All, diffField, false)
+						if len(fields) != 1 {
+							checkError(fmt.Errorf("flag --diff should match exactly one field: %s", diffField))
+						}
+						g = fields[0]
+					}
+
+					if !config.NoHeaderRow || record.IsHeaderRow {
+						if config.NoOutHeader {
+							continue
+						}
+						header := record.All
+						if diffField != "" {
+							header = append(header, diffName)
+						}
+						for _, p := range parts {
+							header = append(header, record.All[f-1]+"_"+p)
+						}
+						checkError(writer.Write(header))
+						continue
+					}
+				}
+
+				cols = cols[:0]
+				t, ok = parse(record.All[f-1])
+
+				if diffField != "" {
+					t2, ok2 := parse(record.All[g-1])
+					if ok && ok2 {
+						cols = append(cols, dateDiff(t, t2, unit, decimals))
+					} else {
+						cols = append(cols, "")
+					}
+				}
+
+				if ok {
+					if toLoc != nil {
+						t = t.In(toLoc)
+					}
+					t = add.addTo(t)
+					if trunc != "" {
+						t = truncateDate(t, trunc)
+					}
+				}
+
+				for _, p := range parts {
+					if ok {
+						cols = append(cols, dateParts[p](t))
+					} else {
+						cols = append(cols, "")
+					}
+				}
+
+				if ok && replace {
+					if toEpoch != "" {
+						record.All[f-1] = strconv.FormatInt(t.UnixNano()/epochUnits[toEpoch], 10)
+					} else {
+						record.All[f-1] = fmtdate.Format(outfmt, t)
+					}
+				}
+
+				checkError(writer.Write(append(record.All, cols...)))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(datecalcCmd)
+	datecalcCmd.Flags().StringP("field", "f", "1", `select only one field. e.g -f 1 or -f columnA`)
+	datecalcCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*date"`)
+	datecalcCmd.Flags().StringP("time-zone", "z", "", `time zone of input dates, e.g., "Asia/Shanghai" or "America/Los_Angeles"`)
+	datecalcCmd.Flags().StringP("to-tz", "", "", `convert dates to this time zone`)
+	datecalcCmd.Flags().StringP("from-epoch", "", "", `parse values as epochs in this unit: s, ms, us, ns`)
+	datecalcCmd.Flags().StringP("to-epoch", "", "", `output epochs in this unit: s, ms, us, ns`)
+	datecalcCmd.Flags().StringP("add", "a", "", `add a duration, e.g., "1d12h", "-2w", "1y6mo"`)
+	datecalcCmd.Flags().StringP("trunc", "", "", `truncate dates to: second, minute, hour, day, week, month, year`)
+	datecalcCmd.Flags().StringP("format", "", "YYYY-MM-DD hh:mm:ss", `output date format in MS Excel (TM) syntax, type "csvtk fmtdate -h" for details`)
+	datecalcCmd.Flags().StringP("diff", "", "", `compute the difference of the field minus this field`)
+	datecalcCmd.Flags().StringP("diff-name", "", "diff", `column name of the difference`)
+	datecalcCmd.Flags().StringP("unit", "u", "d", `unit of the difference: ns, us, ms, s, m, h, d, w, mo, y`)
+	datecalcCmd.Flags().IntP("decimals", "n", -1, `number of decimals of the difference, -1 for the shortest representation`)
+	datecalcCmd.Flags().StringP("extract", "e", "", `extract parts of dates into new columns, e.g., year,month,weekday`)
+}
+
+var epochUnits = map[string]int64{
+	"s":  int64(time.Second),
+	"ms": int64(time.Millisecond),
+	"us": int64(time.Microsecond),
+	"ns": 1,
+}
+
+var dateUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"mo": 0, // calendar units
+	"y":  0,
+}
+
+var dateParts = map[string]func(time.Time) string{
+	"year":         func(t time.Time) string { return strconv.Itoa(t.Year()) },
+	"quarter":      func(t time.Time) string { return strconv.Itoa((int(t.Month())-1)/3 + 1) },
+	"month":        func(t time.Time) string { return strconv.Itoa(int(t.Month())) },
+	"day":          func(t time.Time) string { return strconv.Itoa(t.Day()) },
+	"weekday":      func(t time.Time) string { return strconv.Itoa(int(t.Weekday())) },
+	"weekday_name": func(t time.Time) string { return t.Weekday().String() },
+	"yearday":      func(t time.Time) string { return strconv.Itoa(t.YearDay()) },
+	"week":         func(t time.Time) string { _, w := t.ISOWeek(); return strconv.Itoa(w) },
+	"hour":         func(t time.Time) string { return strconv.Itoa(t.Hour()) },
+	"minute":       func(t time.Time) string { return strconv.Itoa(t.Minute()) },
+	"second":       func(t time.Time) string { return strconv.Itoa(t.Second()) },
+}
+
+// dateDuration is a duration with calendar parts.
+type dateDuration struct {
+	years, months, days int
+	d                   time.Duration
+}
+
+func (d dateDuration) isZero() bool {
+	return d.years == 0 && d.months == 0 && d.days == 0 && d.d == 0
+}
+
+func (d dateDuration) addTo(t time.Time) time.Time {
+	if d.years != 0 || d.months != 0 || d.days != 0 {
+		t = t.AddDate(d.years, d.months, d.days)
+	}
+	return t.Add(d.d)
+}
+
+var reDateDuration = regexp.MustCompile(`(\d+(?:\.\d+)?)(ns|us|ms|mo|[smhdwy])`)
+
+// parseDateDuration parses durations like "1y6mo", "-2w" and "1d12h".
+func parseDateDuration(s string) (dateDuration, error) {
+	var d dateDuration
+	str := strings.TrimSpace(s)
+
+	sign := 1
+	if strings.HasPrefix(str, "-") {
+		sign, str = -1, str[1:]
+	} else if strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+
+	locs := reDateDuration.FindAllStringSubmatchIndex(str, -1)
+	if len(locs) == 0 {
+		return d, fmt.Errorf("invalid duration: %s", s)
+	}
+	var end int
+	for _, loc := range locs {
+		if loc[0] != end {
+			return d, fmt.Errorf("invalid duration: %s", s)
+		}
+		end = loc[1]
+
+		n, _ := strconv.ParseFloat(str[loc[2]:loc[3]], 64)
+		unit := str[loc[4]:loc[5]]
+		switch unit {
+		case "y", "mo":
+			if n != math.Trunc(n) {
+				return d, fmt.Errorf("years and months should be integers: %s", s)
+			}
+			if unit == "y" {
+				d.years += sign * int(n)
+			} else {
+				d.months += sign * int(n)
+			}
+		case "d":
+			if n == math.Trunc(n) { // calendar days, robust to daylight saving time
+				d.days += sign * int(n)
+				continue
+			}
+			fallthrough
+		default:
+			d.d += time.Duration(float64(sign) * n * float64(dateUnits[unit]))
+		}
+	}
+	if end != len(str) {
+		return d, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+// dateDiff returns t1 - t2 in a unit.
+func dateDiff(t1, t2 time.Time, unit string, decimals int) string {
+	if unit == "mo" || unit == "y" {
+		sign := 1
+		if t1.Before(t2) {
+			t1, t2, sign = t2, t1, -1
+		}
+		months := (t1.Year()-t2.Year())*12 + int(t1.Month()) - int(t2.Month())
+		if months > 0 && t2.AddDate(0, months, 0).After(t1) { // not a whole month yet
+			months--
+		}
+		if unit == "y" {
+			return strconv.Itoa(sign * (months / 12))
+		}
+		return strconv.Itoa(sign * months)
+	}
+	v := float64(t1.Sub(t2)) / float64(dateUnits[unit])
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+// db2csvCmd represents the db2csv command
+var db2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "db2csv",
+	Short: "dump a table or query result of a SQLite database to CSV",
+	Long: `dump a table or query result of a SQLite database to CSV
+
+Examples:
+  csvtk db2csv --db data.db -n sales
+  csvtk db2csv --db data.db -s "select region, sum(amount) from sales group by region"
+  csvtk db2csv --db data.db --list
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		runtime.GOMAXPROCS(config.NumCPUs)
+		if len(args) > 0 {
+			checkError(fmt.Errorf("no positional arguments needed, please use --db for the database file"))
+		}
+
+		dbFile := getFlagString(cmd, "db")
+		if dbFile == "" {
+			checkError(fmt.Errorf("flag --db needed"))
+		}
+		if _, err := os.Stat(dbFile); err != nil {
+			checkError(err)
+		}
+		query := getFlagString(cmd, "query")
+		table := getFlagString(cmd, "table")
+		list := getFlagBool(cmd, "list")
+
+		n := 0
+		for _, v := range []bool{query != "", table != "", list} {
+			if v {
+				n++
+			}
+		}
+		if n != 1 {
+			checkError(fmt.Errorf("one of the flags -s/--query, -n/--table and --list needed"))
+		}
+
+		if list {
+			query = "SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name"
+		} else if table != "" {
+			query = "SELECT * FROM " + sqlQuoteIdentifier(table)
+		}
+
+		db, err := sql.Open("sqlite", dbFile+"?mode=ro")
+		checkError(err)
+		defer db.Close()
+
+		rows, err := db.Query(query)
+		if err != nil {
+			checkError(fmt.Errorf("failed to execute the query: %s", err))
+		}
+		defer rows.Close()
+
+		checkError(writeSQLRows(config, rows, getFlagString(cmd, "na")))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(db2csvCmd)
+	db2csvCmd.Flags().StringP("db", "", "", `SQLite database file`)
+	db2csvCmd.Flags().StringP("query", "s", "", `SQL query`)
+	db2csvCmd.Flags().StringP("table", "n", "", `table to dump`)
+	db2csvCmd.Flags().BoolP("list", "", false, `list tables`)
+	db2csvCmd.Flags().StringP("na", "", "", `content for NULL values`)
+}
@@ -0,0 +1,463 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// dbf2csvCmd represents the dbf2csv command
+var dbf2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "dbf2csv",
+	Short: "convert dBase/FoxPro DBF file to CSV",
+	Long: `convert dBase/FoxPro DBF file to CSV
+
+DBF files, including the attribute tables (.dbf) of shapefiles, from
+dBase III/IV and FoxPro/Visual FoxPro are supported.
+
+Code page:
+
+  The encoding of text is determined in the order of:
+    1. -e/--encoding, e.g., cp1252, 1251, cp866, gbk, big5, shift_jis, utf-8.
+    2. The .cpg file of a shapefile, e.g., data.cpg for data.dbf.
+    3. The language driver ID in the DBF header.
+    4. Latin-1 (ISO-8859-1) if none of the above is available.
+
+Field types:
+
+  C (character)   trailing spaces removed
+  N, F (numeric)  spaces removed
+  L (logical)     true, false, or empty for uninitialized values
+  D (date)        YYYY-MM-DD
+  T (datetime)    YYYY-MM-DD HH:MM:SS
+  I (integer), Y (currency), B/O (double) of Visual FoxPro
+  M, G, P (memo)  block numbers in the memo file, which is not read
+
+Deleted records are skipped unless --keep-deleted is given.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		encodingName := getFlagString(cmd, "encoding")
+		keepDeleted := getFlagBool(cmd, "keep-deleted")
+		listFields := getFlagBool(cmd, "list-fields")
+
+		file := files[0]
+		fh, err := ropenRaw(file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk dbf2csv: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		defer fh.Close()
+
+		dbf, err := newDBFReader(fh)
+		checkError(err)
+
+		var enc encoding.Encoding
+		if encodingName == "" && !isStdin(file) && !isURL(file) {
+			prefix, _ := filepathTrimExtension(file)
+			if data, err := os.ReadFile(prefix + ".cpg"); err == nil {
+				encodingName = strings.TrimSpace(string(data))
+				if config.Verbose {
+					log.Infof("encoding from .cpg file: %s", encodingName)
+				}
+			}
+		}
+		if encodingName != "" {
+			enc, err = dbfEncoding(encodingName)
+			checkError(err)
+		} else if enc = dbfLanguageDrivers[dbf.ldid]; enc == nil {
+			enc = charmap.ISO8859_1
+		}
+		dbf.decoder = enc.NewDecoder()
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if listFields {
+			checkError(writer.Write([]string{"name", "type", "length", "decimals"}))
+			for _, f := range dbf.fields {
+				checkError(writer.Write([]string{f.name, string(f.typ), strconv.Itoa(f.length), strconv.Itoa(f.decimals)}))
+			}
+			return
+		}
+
+		if !config.NoOutHeader {
+			names := make([]string, len(dbf.fields))
+			for i, f := range dbf.fields {
+				names[i] = f.name
+			}
+			checkError(writer.Write(names))
+		}
+
+		var record []string
+		var deleted bool
+		for {
+			record, deleted, err = dbf.Read()
+			if err == io.EOF {
+				break
+			}
+			checkError(err)
+			if deleted && !keepDeleted {
+				continue
+			}
+			checkError(writer.Write(record))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(dbf2csvCmd)
+	dbf2csvCmd.Flags().StringP("encoding", "e", "", "encoding (code page) of text, e.g., cp1252, 1251, gbk, utf-8. default: detected from the .cpg file or the DBF header")
+	dbf2csvCmd.Flags().BoolP("keep-deleted", "", false, "keep records marked as deleted")
+	dbf2csvCmd.Flags().BoolP("list-fields", "", false, "only list fields with types, lengths and decimal counts")
+}
+
+type dbfField struct {
+	name     string
+	typ      byte
+	length   int
+	decimals int
+}
+
+type dbfReader struct {
+	r          io.Reader
+	version    byte
+	numRecords int
+	recordLen  int
+	ldid       byte
+	fields     []dbfField
+
+	decoder *encoding.Decoder
+	buf     []byte
+	i       int
+}
+
+func newDBFReader(r io.Reader) (*dbfReader, error) {
+	header := make([]byte, 32)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("invalid DBF file: %s", err)
+	}
+	dbf := &dbfReader{
+		r:          r,
+		version:    header[0],
+		numRecords: int(binary.LittleEndian.Uint32(header[4:8])),
+		recordLen:  int(binary.LittleEndian.Uint16(header[10:12])),
+		ldid:       header[29],
+	}
+	headerLen := int(binary.LittleEndian.Uint16(header[8:10]))
+	if headerLen < 33 || dbf.recordLen < 1 {
+		return nil, fmt.Errorf("invalid DBF file: header length %d, record length %d", headerLen, dbf.recordLen)
+	}
+
+	rest := make([]byte, headerLen-32)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("invalid DBF file: %s", err)
+	}
+	var name []byte
+	var offset = 1 // deletion flag
+	for i := 0; i+32 <= len(rest) && rest[i] != 0x0D; i += 32 {
+		d := rest[i : i+32]
+		name = d[:11]
+		if j := bytes.IndexByte(name, 0); j >= 0 {
+			name = name[:j]
+		}
+		f := dbfField{
+			name:     strings.TrimSpace(string(name)),
+			typ:      d[11],
+			length:   int(d[16]),
+			decimals: int(d[17]),
+		}
+		if f.typ == 'C' && dbf.version != 0x30 && dbf.version != 0x31 { // lengths > 255 in Clipper/FoxPro
+			f.length += int(d[17]) << 8
+			f.decimals = 0
+		}
+		offset += f.length
+		dbf.fields = append(dbf.fields, f)
+	}
+	if len(dbf.fields) == 0 {
+		return nil, fmt.Errorf("invalid DBF file: no fields")
+	}
+	if offset > dbf.recordLen {
+		return nil, fmt.Errorf("invalid DBF file: sum of field lengths (%d) exceeds record length (%d)", offset, dbf.recordLen)
+	}
+	dbf.buf = make([]byte, dbf.recordLen)
+	return dbf, nil
+}
+
+// Read returns the next record, and whether it's marked as deleted.
+func (dbf *dbfReader) Read() ([]string, bool, error) {
+	if dbf.i >= dbf.numRecords {
+		return nil, false, io.EOF
+	}
+	n, err := io.ReadFull(dbf.r, dbf.buf)
+	if err != nil {
+		if n > 0 && dbf.buf[0] == 0x1A || err == io.EOF {
+			return nil, false, io.EOF
+		}
+		return nil, false, fmt.Errorf("failed to read record %d: %s", dbf.i+1, err)
+	}
+	if dbf.buf[0] == 0x1A {
+		return nil, false, io.EOF
+	}
+	dbf.i++
+
+	record := make([]string, len(dbf.fields))
+	offset := 1
+	var v []byte
+	for i, f := range dbf.fields {
+		v = dbf.buf[offset : offset+f.length]
+		offset += f.length
+		if record[i], err = dbf.value(f, v); err != nil {
+			return nil, false, fmt.Errorf("record %d, field %s: %s", dbf.i, f.name, err)
+		}
+	}
+	return record, dbf.buf[0] == '*', nil
+}
+
+func (dbf *dbfReader) value(f dbfField, v []byte) (string, error) {
+	switch f.typ {
+	case 'C':
+		s, err := dbf.decoder.Bytes(bytes.TrimRight(v, " \x00"))
+		return string(s), err
+	case 'N', 'F':
+		s := strings.TrimSpace(string(bytes.Trim(v, "\x00")))
+		if strings.Trim(s, "*") == "" { // overflow or null
+			return "", nil
+		}
+		return s, nil
+	case 'L':
+		switch v[0] {
+		case 'T', 't', 'Y', 'y':
+			return "true", nil
+		case 'F', 'f', 'N', 'n':
+			return "false", nil
+		}
+		return "", nil
+	case 'D':
+		s := strings.TrimSpace(string(v))
+		if len(s) != 8 || strings.Trim(s, "0") == "" {
+			return "", nil
+		}
+		return s[0:4] + "-" + s[4:6] + "-" + s[6:8], nil
+	case 'T':
+		if len(v) != 8 {
+			break
+		}
+		days := int64(binary.LittleEndian.Uint32(v[0:4]))
+		ms := int64(binary.LittleEndian.Uint32(v[4:8]))
+		if days == 0 && ms == 0 {
+			return "", nil
+		}
+		// Julian day number 2440588 is 1970-01-01
+		t := time.Unix((days-2440588)*86400, ms*int64(time.Millisecond)).UTC()
+		return t.Format("2006-01-02 15:04:05"), nil
+	case 'I':
+		if len(v) != 4 {
+			break
+		}
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(v))), 10), nil
+	case 'Y':
+		if len(v) != 8 {
+			break
+		}
+		return strconv.FormatFloat(float64(int64(binary.LittleEndian.Uint64(v)))/10000, 'f', -1, 64), nil
+	case 'B', 'O':
+		if len(v) != 8 { // B is memo in dBase
+			break
+		}
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(v)), 'f', -1, 64), nil
+	case 'M', 'G', 'P':
+		if len(v) == 4 {
+			n := binary.LittleEndian.Uint32(v)
+			if n == 0 {
+				return "", nil
+			}
+			return strconv.FormatUint(uint64(n), 10), nil
+		}
+		return strings.TrimSpace(string(v)), nil
+	}
+	return strings.TrimSpace(string(v)), nil
+}
+
+// dbfLanguageDrivers maps language driver IDs to encodings.
+var dbfLanguageDrivers = map[byte]encoding.Encoding{
+	0x01: charmap.CodePage437,
+	0x02: charmap.CodePage850,
+	0x03: charmap.Windows1252,
+	0x08: charmap.CodePage865,
+	0x0A: charmap.CodePage850,
+	0x0B: charmap.CodePage437,
+	0x0D: charmap.CodePage437,
+	0x0E: charmap.CodePage850,
+	0x0F: charmap.CodePage437,
+	0x10: charmap.CodePage850,
+	0x11: charmap.CodePage437,
+	0x13: japanese.ShiftJIS,
+	0x14: charmap.CodePage850,
+	0x15: charmap.CodePage437,
+	0x16: charmap.CodePage850,
+	0x17: charmap.CodePage865,
+	0x18: charmap.CodePage437,
+	0x19: charmap.CodePage437,
+	0x1A: charmap.CodePage850,
+	0x1B: charmap.CodePage437,
+	0x1D: charmap.CodePage850,
+	0x1F: charmap.CodePage852,
+	0x22: charmap.CodePage852,
+	0x24: charmap.CodePage860,
+	0x25: charmap.CodePage850,
+	0x26: charmap.CodePage866,
+	0x37: charmap.CodePage850,
+	0x40: charmap.CodePage852,
+	0x4D: simplifiedchinese.GBK,
+	0x4E: korean.EUCKR,
+	0x4F: traditionalchinese.Big5,
+	0x50: charmap.Windows874,
+	0x57: charmap.Windows1252,
+	0x58: charmap.Windows1252,
+	0x59: charmap.Windows1252,
+	0x64: charmap.CodePage852,
+	0x65: charmap.CodePage866,
+	0x66: charmap.CodePage865,
+	0x69: charmap.CodePage852,
+	0x78: traditionalchinese.Big5,
+	0x79: korean.EUCKR,
+	0x7A: simplifiedchinese.GBK,
+	0x7B: japanese.ShiftJIS,
+	0x7C: charmap.Windows874,
+	0x7D: charmap.Windows1255,
+	0x7E: charmap.Windows1256,
+	0x96: charmap.MacintoshCyrillic,
+	0x98: charmap.Macintosh,
+	0xC8: charmap.Windows1250,
+	0xC9: charmap.Windows1251,
+	0xCA: charmap.Windows1254,
+	0xCB: charmap.Windows1253,
+	0xCC: charmap.Windows1257,
+}
+
+// dbfCodePages maps code page numbers to encodings.
+var dbfCodePages = map[int]encoding.Encoding{
+	437:  charmap.CodePage437,
+	850:  charmap.CodePage850,
+	852:  charmap.CodePage852,
+	855:  charmap.CodePage855,
+	858:  charmap.CodePage858,
+	860:  charmap.CodePage860,
+	862:  charmap.CodePage862,
+	863:  charmap.CodePage863,
+	865:  charmap.CodePage865,
+	866:  charmap.CodePage866,
+	874:  charmap.Windows874,
+	932:  japanese.ShiftJIS,
+	936:  simplifiedchinese.GBK,
+	949:  korean.EUCKR,
+	950:  traditionalchinese.Big5,
+	1250: charmap.Windows1250,
+	1251: charmap.Windows1251,
+	1252: charmap.Windows1252,
+	1253: charmap.Windows1253,
+	1254: charmap.Windows1254,
+	1255: charmap.Windows1255,
+	1256: charmap.Windows1256,
+	1257: charmap.Windows1257,
+	1258: charmap.Windows1258,
+}
+
+// dbfEncoding returns the encoding by a name like cp1252, 1252, windows-1252,
+// "ANSI 1252" (in .cpg files), 88591 (ISO-8859-1), utf-8, or an IANA name.
+func dbfEncoding(name string) (encoding.Encoding, error) {
+	s := strings.ToLower(strings.TrimSpace(name))
+	if f := strings.Fields(s); len(f) > 1 {
+		s = f[len(f)-1]
+	}
+	switch s {
+	case "utf-8", "utf8":
+		return unicode.UTF8, nil
+	}
+	if strings.HasPrefix(s, "8859") && len(s) > 4 { // 88591 in .cpg files
+		s = "iso-8859-" + s[4:]
+	}
+	for _, prefix := range []string{"cp", "windows-", "ibm", "ldid/"} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if enc, ok := dbfCodePages[n]; ok {
+			return enc, nil
+		}
+		return nil, fmt.Errorf("unsupported code page: %s", name)
+	}
+	enc, err := ianaindex.IANA.Encoding(s)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported encoding: %s", name)
+	}
+	return enc, nil
+}
@@ -0,0 +1,454 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// dedupCmd represents the dedup command
+var dedupCmd = &cobra.Command{
+	GroupID: "set",
+
+	Use:   "dedup",
+	Short: "remove duplicated and near-duplicated rows with normalization and fuzzy matching",
+	Long: `remove duplicated and near-duplicated rows with normalization and fuzzy matching
+
+Rows are compared by the values of selected fields (-f/--fields, default all),
+after normalization:
+
+  trim      remove leading and trailing spaces
+  space     collapse consecutive spaces into one
+  casefold  convert to lower case
+  punct     remove punctuation and symbols
+  digits    remove digits
+  alnum     keep only letters and digits
+
+Normalizations given by -n/--normalize apply to all selected fields, and
+-N/--column-normalize sets them for a column, e.g., -N "name:trim,casefold,punct".
+
+Fuzzy matching:
+  Values of a column are treated as the same if their similarity (0-1)
+  is no less than the threshold given by --threshold, e.g., --threshold name:0.85.
+  Similarity metrics (-m/--metric): levenshtein (1 - edit distance / max length),
+  jaro-winkler. Values of other fields should be the same after normalization.
+  A row joins the first cluster whose first row matches it.
+
+Which row to keep for each cluster (-k/--keep):
+
+  first     the first row
+  last      the last row
+  best      the row with the most non-empty cells, the first one for ties
+
+Kept rows are outputted in their original order. Clusters with more than one
+row can be written to a file with --dup-file, with two extra columns of
+the cluster ID and whether the row is kept.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		keep := strings.ToLower(getFlagString(cmd, "keep"))
+		switch keep {
+		case "first", "last", "best":
+		default:
+			checkError(fmt.Errorf("invalid value of flag -k/--keep: %s. available: first, last, best", keep))
+		}
+		metric := strings.ToLower(getFlagString(cmd, "metric"))
+		similarity, ok := stringSimilarities[metric]
+		if !ok {
+			checkError(fmt.Errorf("invalid value of flag -m/--metric: %s. available: levenshtein, jaro-winkler", metric))
+		}
+		dupFile := getFlagString(cmd, "dup-file")
+
+		normAll, err := parseNormalizations(getFlagStringSlice(cmd, "normalize"))
+		checkError(err)
+		normCols := make(map[string][]func(string) string)
+		for _, s := range getFlagStringArray(cmd, "column-normalize") {
+			i := strings.LastIndex(s, ":")
+			if i <= 0 {
+				checkError(fmt.Errorf(`invalid value of flag -N/--column-normalize: %s, it should be like "name:trim,casefold"`, s))
+			}
+			normCols[s[:i]], err = parseNormalizations(strings.Split(s[i+1:], ","))
+			checkError(err)
+		}
+		thresholds := make(map[string]float64)
+		for _, s := range getFlagStringArray(cmd, "threshold") {
+			i := strings.LastIndex(s, ":")
+			var t float64
+			if i > 0 {
+				t, err = strconv.ParseFloat(s[i+1:], 64)
+			}
+			if i <= 0 || err != nil || t < 0 || t > 1 {
+				checkError(fmt.Errorf(`invalid value of flag --threshold: %s, it should be like "name:0.85"`, s))
+			}
+			thresholds[s[:i]] = t
+		}
+
+		file := files[0]
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+		if header == nil {
+			return
+		}
+
+		// fields to compare
+		var fields []int
+		if fieldStr == "" {
+			fields = make([]int, len(header))
+			for i := range fields {
+				fields[i] = i + 1
+			}
+		} else {
+			fields = selectFieldsByHeader(header, fieldStr, fuzzyFields)
+		}
+		colName := func(f int) string {
+			if config.NoHeaderRow {
+				return strconv.Itoa(f)
+			}
+			return header[f-1]
+		}
+		norms := make([][]func(string) string, len(fields))
+		var exactFields, fuzzyCols []int // indexes of fields
+		fieldNames := make(map[string]struct{}, len(fields))
+		for i, f := range fields {
+			name := colName(f)
+			fieldNames[name] = struct{}{}
+			if norms[i], ok = normCols[name]; !ok {
+				norms[i] = normAll
+			}
+			if _, ok = thresholds[name]; ok {
+				fuzzyCols = append(fuzzyCols, i)
+			} else {
+				exactFields = append(exactFields, i)
+			}
+		}
+		for name := range normCols {
+			if _, ok = fieldNames[name]; !ok {
+				checkError(fmt.Errorf("column in -N/--column-normalize not in selected fields: %s", name))
+			}
+		}
+		for name := range thresholds {
+			if _, ok = fieldNames[name]; !ok {
+				checkError(fmt.Errorf("column in --threshold not in selected fields: %s", name))
+			}
+		}
+
+		// clustering
+		values := make([][]string, len(data)) // normalized values
+		for r, record := range data {
+			values[r] = make([]string, len(fields))
+			for i, f := range fields {
+				values[r][i] = normalizeString(record[f-1], norms[i])
+			}
+		}
+
+		clusters := make([][]int, 0, len(data))
+		blocks := make(map[string][]int, len(data)) // exact key -> clusters
+		keyEncoder := &joinKeyEncoder{}
+		keyFields := make([]int, len(exactFields)) // 1-based, in normalized values
+		for i, j := range exactFields {
+			keyFields[i] = j + 1
+		}
+		var k string
+		var found bool
+		for r := range data {
+			k, _ = keyEncoder.key(values[r], keyFields)
+
+			found = false
+			for _, c := range blocks[k] {
+				first := clusters[c][0]
+				found = true
+				for _, j := range fuzzyCols {
+					if values[r][j] != values[first][j] &&
+						similarity(values[r][j], values[first][j]) < thresholds[colName(fields[j])] {
+						found = false
+						break
+					}
+				}
+				if found {
+					clusters[c] = append(clusters[c], r)
+					break
+				}
+			}
+			if !found {
+				blocks[k] = append(blocks[k], len(clusters))
+				clusters = append(clusters, []int{r})
+			}
+		}
+
+		// rows to keep
+		kept := make([]bool, len(data))
+		for _, rows := range clusters {
+			switch keep {
+			case "first":
+				kept[rows[0]] = true
+			case "last":
+				kept[rows[len(rows)-1]] = true
+			case "best":
+				best, bestN := rows[0], -1
+				for _, r := range rows {
+					n := 0
+					for _, v := range data[r] {
+						if strings.TrimSpace(v) != "" {
+							n++
+						}
+					}
+					if n > bestN {
+						best, bestN = r, n
+					}
+				}
+				kept[best] = true
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		setWriterComma := func(writer *csvWriter) {
+			if config.OutTabs || config.Tabs {
+				if config.OutDelimiter == ',' {
+					writer.Comma = '\t'
+				} else {
+					writer.Comma = config.OutDelimiter
+				}
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		}
+		setWriterComma(writer)
+
+		if !config.NoHeaderRow && !config.NoOutHeader {
+			checkError(writer.Write(header))
+		}
+		for r, record := range data {
+			if kept[r] {
+				checkError(writer.Write(record))
+			}
+		}
+		writer.Flush()
+		checkError(writer.Error())
+
+		if dupFile != "" {
+			dupfh, err := xopen.Wopen(dupFile)
+			checkError(err)
+			defer dupfh.Close()
+
+			writer := newCSVWriter(dupfh)
+			setWriterComma(writer)
+			if !config.NoHeaderRow && !config.NoOutHeader {
+				checkError(writer.Write(append([]string{"cluster", "kept"}, header...)))
+			}
+			var id int
+			for _, rows := range clusters {
+				if len(rows) == 1 {
+					continue
+				}
+				id++
+				for _, r := range rows {
+					checkError(writer.Write(append([]string{strconv.Itoa(id), strconv.FormatBool(kept[r])}, data[r]...)))
+				}
+			}
+			writer.Flush()
+			checkError(writer.Error())
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(dedupCmd)
+	dedupCmd.Flags().StringP("fields", "f", "", `fields to compare. e.g -f 1,2 or -f columnA,columnB (default: all fields)`)
+	dedupCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	dedupCmd.Flags().StringSliceP("normalize", "n", []string{}, `normalizations for all fields: trim, space, casefold, punct, digits, alnum`)
+	dedupCmd.Flags().StringArrayP("column-normalize", "N", []string{}, `normalizations for a column, e.g., "name:trim,casefold". multiple values supported`)
+	dedupCmd.Flags().StringArrayP("threshold", "", []string{}, `similarity threshold (0-1) of fuzzy matching for a column, e.g., "name:0.85". multiple values supported`)
+	dedupCmd.Flags().StringP("metric", "m", "levenshtein", `similarity metric for fuzzy matching: levenshtein, jaro-winkler`)
+	dedupCmd.Flags().StringP("keep", "k", "first", `which row to keep for each cluster: first, last, best`)
+	dedupCmd.Flags().StringP("dup-file", "", "", `file for saving clusters of duplicated rows`)
+}
+
+var stringNormalizations = map[string]func(string) string{
+	"trim":     strings.TrimSpace,
+	"space":    func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	"casefold": strings.ToLower,
+	"punct": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+				return -1
+			}
+			return r
+		}, s)
+	},
+	"digits": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return -1
+			}
+			return r
+		}, s)
+	},
+	"alnum": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, s)
+	},
+}
+
+func parseNormalizations(names []string) ([]func(string) string, error) {
+	norms := make([]func(string) string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		fn, ok := stringNormalizations[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid normalization: %s. available: trim, space, casefold, punct, digits, alnum", name)
+		}
+		norms = append(norms, fn)
+	}
+	return norms, nil
+}
+
+func normalizeString(s string, norms []func(string) string) string {
+	for _, fn := range norms {
+		s = fn(s)
+	}
+	return s
+}
+
+var stringSimilarities = map[string]func(a, b string) float64{
+	"levenshtein":  levenshteinSimilarity,
+	"jaro-winkler": jaroWinklerSimilarity,
+}
+
+// levenshteinSimilarity returns 1 - edit distance / max length.
+func levenshteinSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	var cost int
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost = 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	return 1 - float64(prev[len(rb)])/float64(maxLen)
+}
+
+// jaroWinklerSimilarity returns the Jaro-Winkler similarity.
+func jaroWinklerSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	window := len(ra)
+	if len(rb) > window {
+		window = len(rb)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	var matches int
+	for i := range ra {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(rb) {
+			hi = len(rb)
+		}
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	var transpositions, j int
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	var prefix int
+	for prefix < 4 && prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
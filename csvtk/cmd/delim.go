@@ -0,0 +1,131 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shenwei356/xopen"
+)
+
+var delimiterEscaper = strings.NewReplacer(`\t`, "\t", `\\`, `\`)
+
+// parseDelimiter parses the value of -d/--delimiter, where "\t" is
+// unescaped. A multiple-character delimiter is returned as a string, with
+// the rune being ','.
+func parseDelimiter(s string) (rune, string, error) {
+	s = delimiterEscaper.Replace(s)
+	switch utf8.RuneCountInString(s) {
+	case 0:
+		return 0, "", nil
+	case 1:
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, "", nil
+	}
+	if strings.ContainsAny(s, "\r\n") {
+		return 0, "", fmt.Errorf("invalid value of flag -d/--delimiter: %q", s)
+	}
+	return ',', s, nil
+}
+
+// splitDelimiter returns true if records should be split by a multiple-character
+// delimiter or a regular expression, rather than parsed by encoding/csv.
+func (config Config) splitDelimiter() bool {
+	return !config.Tabs && (config.DelimiterString != "" || config.DelimiterRegexp != nil)
+}
+
+// splitSource is a source of records split from lines by a multiple-character
+// delimiter or a regular expression. Quotes are not parsed, comment lines
+// and empty lines are skipped. With a regular expression, leading and
+// trailing spaces of lines are removed.
+type splitSource struct {
+	fh      *xopen.Reader
+	sep     string
+	re      *regexp.Regexp
+	comment string
+
+	reader *csv.Reader // only FieldsPerRecord is used
+	line   int
+}
+
+func newSplitSource(config Config, file string) (*splitSource, error) {
+	fh, err := ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	if err = captureComments(fh.Reader, config.commentPrefix()); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return &splitSource{
+		fh:      fh,
+		sep:     config.DelimiterString,
+		re:      config.DelimiterRegexp,
+		comment: config.commentPrefix(),
+	}, nil
+}
+
+func (s *splitSource) Read() ([]string, error) {
+	var line string
+	var err error
+	for {
+		line, err = s.fh.ReadString('\n')
+		if line == "" && err != nil {
+			return nil, err
+		}
+		s.line++
+
+		line = strings.TrimRight(line, "\r\n")
+		if s.re != nil {
+			line = strings.TrimSpace(line)
+		}
+		if line == "" {
+			continue
+		}
+		if s.comment != "" && strings.HasPrefix(line, s.comment) {
+			continue
+		}
+		break
+	}
+
+	var record []string
+	if s.re != nil {
+		record = s.re.Split(line, -1)
+	} else {
+		record = strings.Split(line, s.sep)
+	}
+
+	if s.reader != nil {
+		if s.reader.FieldsPerRecord == 0 {
+			s.reader.FieldsPerRecord = len(record)
+		} else if s.reader.FieldsPerRecord > 0 && len(record) != s.reader.FieldsPerRecord {
+			return record, &csv.ParseError{StartLine: s.line, Line: s.line, Column: 1, Err: csv.ErrFieldCount}
+		}
+	}
+	return record, nil
+}
+
+func (s *splitSource) Close() error {
+	return s.fh.Close()
+}
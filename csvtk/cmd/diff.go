@@ -0,0 +1,397 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/csvtk/pkg/csvtk"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	GroupID: "set",
+
+	Use:   "diff",
+	Short: "compare two CSV files by key columns and report added, removed and changed rows",
+	Long: `compare two CSV files by key columns and report added, removed and changed rows
+
+Records of the two files are matched by key columns (-f/--fields), and
+columns with the same names are compared. All columns are used as keys
+if -f/--fields is not given, where only added and removed rows are reported.
+Keys should be unique in each file.
+
+Output modes (-m/--output-mode):
+
+  summary   numbers of added, removed, changed and unchanged rows,
+            changed cells, and added and removed columns.
+  rows      added, removed and changed rows, with a status column "_diff"
+            of "added", "removed" or "changed". Values of changed rows
+            are from the second file.
+  cells     changed cells, with key columns, the column name,
+            the old value and the new value.
+  json      all the above in JSON format.
+
+The exit code is 1 if any difference is found, like "diff".
+Use --no-exit-code to always exit with 0.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) != 2 {
+			checkError(fmt.Errorf("two files needed"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		keysStr := getFlagString(cmd, "fields")
+		mode := strings.ToLower(getFlagString(cmd, "output-mode"))
+		switch mode {
+		case "summary", "rows", "cells", "json":
+		default:
+			checkError(fmt.Errorf("invalid output mode: %s. available: summary, rows, cells, json", mode))
+		}
+		ignoreCase := getFlagBool(cmd, "ignore-case")
+		noExitCode := getFlagBool(cmd, "no-exit-code")
+
+		headerA, dataA, err := readCSVAll(config, files[0])
+		checkError(err)
+		headerB, dataB, err := readCSVAll(config, files[1])
+		checkError(err)
+
+		d := &csvDiff{headerA: headerA, headerB: headerB, ignoreCase: ignoreCase}
+		checkError(d.compare(keysStr, dataA, dataB))
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		if mode == "json" {
+			data, err := json.MarshalIndent(d.toJSON(), "", "  ")
+			checkError(err)
+			outfh.Write(data)
+			outfh.WriteString("\n")
+		} else {
+			writer := newCSVWriter(outfh)
+			if config.OutTabs || config.Tabs {
+				if config.OutDelimiter == ',' {
+					writer.Comma = '\t'
+				} else {
+					writer.Comma = config.OutDelimiter
+				}
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+
+			switch mode {
+			case "summary":
+				if !config.NoOutHeader {
+					checkError(writer.Write([]string{"item", "count"}))
+				}
+				for _, item := range d.summary() {
+					checkError(writer.Write([]string{item.Key, strconv.Itoa(item.Value)}))
+				}
+			case "rows":
+				if !config.NoOutHeader {
+					checkError(writer.Write(append([]string{"_diff"}, d.columns...)))
+				}
+				for _, row := range d.rows {
+					checkError(writer.Write(append([]string{row.status}, row.values...)))
+				}
+			case "cells":
+				if !config.NoOutHeader {
+					items := make([]string, 0, len(d.keyCols)+3)
+					for _, i := range d.keyCols {
+						items = append(items, headerA[i])
+					}
+					checkError(writer.Write(append(items, "column", "old", "new")))
+				}
+				for _, c := range d.cells {
+					checkError(writer.Write(append(append([]string{}, c.key...), c.column, c.old, c.new)))
+				}
+			}
+			writer.Flush()
+			checkError(writer.Error())
+		}
+
+		if !noExitCode && d.different() {
+			exitCode = 1
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("fields", "f", "", `key columns for matching records. e.g -f 1 or -f id,date (default: all columns)`)
+	diffCmd.Flags().StringP("output-mode", "m", "summary", `output mode: summary, rows, cells, json`)
+	diffCmd.Flags().BoolP("ignore-case", "i", false, `ignore case when comparing values`)
+	diffCmd.Flags().BoolP("no-exit-code", "", false, `exit with 0 even if differences are found`)
+}
+
+// csvDiff is the result of comparing two tables.
+type csvDiff struct {
+	headerA, headerB []string
+	ignoreCase       bool
+
+	keyCols []int // 0-based indexes of key columns in headerA
+
+	columns        []string // all columns of A and then columns only in B
+	addedColumns   []string
+	removedColumns []string
+
+	rows  []csvDiffRow
+	cells []csvDiffCell
+
+	nAdded, nRemoved, nChanged, nUnchanged int
+}
+
+type csvDiffRow struct {
+	status string
+	values []string // values of all columns
+}
+
+type csvDiffCell struct {
+	key              []string
+	column, old, new string
+}
+
+func (d *csvDiff) different() bool {
+	return d.nAdded+d.nRemoved+d.nChanged+len(d.addedColumns)+len(d.removedColumns) > 0
+}
+
+func (d *csvDiff) compare(keysStr string, dataA, dataB [][]string) error {
+	idxB := make(map[string]int, len(d.headerB))
+	for i, c := range d.headerB {
+		idxB[c] = i
+	}
+	idxA := make(map[string]int, len(d.headerA))
+	for i, c := range d.headerA {
+		idxA[c] = i
+	}
+
+	// columns
+	common := make([][2]int, 0, len(d.headerA)) // indexes in A and B
+	d.columns = append(d.columns, d.headerA...)
+	for i, c := range d.headerA {
+		if j, ok := idxB[c]; ok {
+			common = append(common, [2]int{i, j})
+		} else {
+			d.removedColumns = append(d.removedColumns, c)
+		}
+	}
+	for _, c := range d.headerB {
+		if _, ok := idxA[c]; !ok {
+			d.addedColumns = append(d.addedColumns, c)
+			d.columns = append(d.columns, c)
+		}
+	}
+
+	// key columns
+	var keyColsB []int
+	if keysStr == "" {
+		for _, c := range common {
+			d.keyCols = append(d.keyCols, c[0])
+			keyColsB = append(keyColsB, c[1])
+		}
+	} else {
+		for _, f := range selectFieldsByHeader(d.headerA, keysStr, false) {
+			j, ok := idxB[d.headerA[f-1]]
+			if !ok {
+				return fmt.Errorf("key column not found in the second file: %s", d.headerA[f-1])
+			}
+			d.keyCols = append(d.keyCols, f-1)
+			keyColsB = append(keyColsB, j)
+		}
+	}
+	if len(d.keyCols) == 0 {
+		return fmt.Errorf("no common columns found")
+	}
+
+	keyEncoder := &joinKeyEncoder{csvtk.KeyEncoder{IgnoreCase: d.ignoreCase}}
+	fieldsA, fieldsB := make([]int, len(d.keyCols)), make([]int, len(keyColsB)) // 1-based
+	for i := range d.keyCols {
+		fieldsA[i], fieldsB[i] = d.keyCols[i]+1, keyColsB[i]+1
+	}
+	keyValues := func(record []string, fields []int) string {
+		items := make([]string, len(fields))
+		for i, f := range fields {
+			items[i] = record[f-1]
+		}
+		return strings.Join(items, ", ")
+	}
+
+	recordsB := make(map[string]int, len(dataB))
+	for i, record := range dataB {
+		key, _ := keyEncoder.key(record, fieldsB)
+		if _, ok := recordsB[key]; ok && keysStr != "" {
+			return fmt.Errorf("duplicated key in the second file: %s", keyValues(record, fieldsB))
+		}
+		recordsB[key] = i
+	}
+
+	// rows of A, in the order of A
+	matched := make(map[int]struct{}, len(dataB))
+	keysA := make(map[string]struct{}, len(dataA))
+	for _, record := range dataA {
+		key, _ := keyEncoder.key(record, fieldsA)
+		if _, ok := keysA[key]; ok && keysStr != "" {
+			return fmt.Errorf("duplicated key in the first file: %s", keyValues(record, fieldsA))
+		}
+		keysA[key] = struct{}{}
+
+		j, ok := recordsB[key]
+		if !ok {
+			d.nRemoved++
+			d.rows = append(d.rows, csvDiffRow{"removed", d.rowValues(record, nil)})
+			continue
+		}
+		matched[j] = struct{}{}
+		recordB := dataB[j]
+
+		var changed bool
+		for _, c := range common {
+			a, b := record[c[0]], recordB[c[1]]
+			if a == b || (d.ignoreCase && strings.EqualFold(a, b)) {
+				continue
+			}
+			changed = true
+			k := make([]string, len(d.keyCols))
+			for i, col := range d.keyCols {
+				k[i] = record[col]
+			}
+			d.cells = append(d.cells, csvDiffCell{k, d.headerA[c[0]], a, b})
+		}
+		if changed {
+			d.nChanged++
+			d.rows = append(d.rows, csvDiffRow{"changed", d.rowValues(recordB, idxB)})
+		} else {
+			d.nUnchanged++
+		}
+	}
+
+	for j, record := range dataB {
+		if _, ok := matched[j]; !ok {
+			d.nAdded++
+			d.rows = append(d.rows, csvDiffRow{"added", d.rowValues(record, idxB)})
+		}
+	}
+	return nil
+}
+
+// rowValues returns values of all columns. idxB is nil for records of A.
+func (d *csvDiff) rowValues(record []string, idxB map[string]int) []string {
+	values := make([]string, len(d.columns))
+	if idxB == nil {
+		copy(values, record)
+		return values
+	}
+	for i, c := range d.columns {
+		if j, ok := idxB[c]; ok {
+			values[i] = record[j]
+		}
+	}
+	return values
+}
+
+type csvDiffCount struct {
+	Key   string
+	Value int
+}
+
+func (d *csvDiff) summary() []csvDiffCount {
+	return []csvDiffCount{
+		{"added_rows", d.nAdded},
+		{"removed_rows", d.nRemoved},
+		{"changed_rows", d.nChanged},
+		{"unchanged_rows", d.nUnchanged},
+		{"changed_cells", len(d.cells)},
+		{"added_columns", len(d.addedColumns)},
+		{"removed_columns", len(d.removedColumns)},
+	}
+}
+
+func (d *csvDiff) toJSON() *jsonObject {
+	summary := &jsonObject{}
+	for _, item := range d.summary() {
+		summary.keys = append(summary.keys, item.Key)
+		summary.values = append(summary.values, item.Value)
+	}
+
+	rowObject := func(values []string) *jsonObject {
+		o := &jsonObject{keys: d.columns, values: make([]interface{}, len(values))}
+		for i, v := range values {
+			o.values[i] = v
+		}
+		return o
+	}
+	added := make([]interface{}, 0, d.nAdded)
+	removed := make([]interface{}, 0, d.nRemoved)
+	for _, row := range d.rows {
+		switch row.status {
+		case "added":
+			added = append(added, rowObject(row.values))
+		case "removed":
+			removed = append(removed, rowObject(row.values))
+		}
+	}
+
+	// changed cells grouped by keys
+	changed := make([]interface{}, 0, d.nChanged)
+	keyEncoder := &joinKeyEncoder{}
+	fields := make([]int, len(d.keyCols))
+	for i := range fields {
+		fields[i] = i + 1
+	}
+	var key, last string
+	var cells *jsonObject
+	for _, c := range d.cells {
+		key, _ = keyEncoder.key(c.key, fields)
+		if cells == nil || key != last {
+			last = key
+			k := &jsonObject{}
+			for i, col := range d.keyCols {
+				k.keys = append(k.keys, d.headerA[col])
+				k.values = append(k.values, c.key[i])
+			}
+			cells = &jsonObject{}
+			changed = append(changed, &jsonObject{keys: []string{"key", "cells"}, values: []interface{}{k, cells}})
+		}
+		cells.keys = append(cells.keys, c.column)
+		cells.values = append(cells.values, &jsonObject{keys: []string{"old", "new"}, values: []interface{}{c.old, c.new}})
+	}
+
+	nonNil := func(s []string) []string {
+		if s == nil {
+			return []string{}
+		}
+		return s
+	}
+	return &jsonObject{
+		keys: []string{"summary", "added_columns", "removed_columns", "added", "removed", "changed"},
+		values: []interface{}{summary, nonNil(d.addedColumns), nonNil(d.removedColumns),
+			added, removed, changed},
+	}
+}
@@ -22,8 +22,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"runtime"
+	"strings"
+	"sync"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/shenwei356/stable"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
@@ -38,6 +42,9 @@ var dimCmd = &cobra.Command{
 	Short:   "dimensions of CSV file",
 	Long: `dimensions of CSV file
 
+Multiple files are parsed in parallel with -j/--num-cpus workers,
+and results are output in the order of input files.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -48,8 +55,10 @@ var dimCmd = &cobra.Command{
 		cols := getFlagBool(cmd, "cols")
 		rows := getFlagBool(cmd, "rows")
 		noFiles := getFlagBool(cmd, "no-files")
+		details := getFlagBool(cmd, "details")
+		showTotal := getFlagBool(cmd, "total")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -63,99 +72,109 @@ var dimCmd = &cobra.Command{
 		}
 		if rows || cols {
 		} else if tabular {
-			outfh.WriteString("file\tnum_cols\tnum_rows\n")
+			if details {
+				outfh.WriteString("file\tnum_cols\tnum_rows\tsize\theader_fingerprint\n")
+			} else {
+				outfh.WriteString("file\tnum_cols\tnum_rows\n")
+			}
 		} else {
 			tbl = stable.New()
-			tbl.HeaderWithFormat([]stable.Column{
+			columns := []stable.Column{
 				{Header: "file"},
 				{Header: "num_cols", Align: stable.AlignRight, HumanizeNumbers: true},
 				{Header: "num_rows", Align: stable.AlignRight, HumanizeNumbers: true},
-			})
+			}
+			if details {
+				columns = append(columns,
+					stable.Column{Header: "size", Align: stable.AlignRight, HumanizeNumbers: true},
+					stable.Column{Header: "header_fingerprint"})
+			}
+			tbl.HeaderWithFormat(columns)
 			checkError(err)
 		}
 
-		for _, file := range files {
-			var numCols, numRows int
-
-			csvReader, err := newCSVReaderByConfig(config, file)
-			if err != nil {
-				if err == xopen.ErrNoContent {
-					if rows {
-						if noFiles {
-							outfh.WriteString(fmt.Sprintf("%d\n", numRows))
-						} else {
-							outfh.WriteString(fmt.Sprintf("%s\t%d\n", file, numRows))
-						}
-					} else if tabular {
-						if noFiles {
-							outfh.WriteString(fmt.Sprintf("%d\t%d\n", numCols, numRows))
-						} else {
-							outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\n", file, numCols, numRows))
-						}
-					} else {
-						tbl.AddRow([]interface{}{
-							file,
-							numCols,
-							numRows,
-						})
-					}
-
-					continue
-				} else {
-					checkError(err)
-				}
-			}
-
-			csvReader.Read(ReadOption{
-				FieldStr: "1-",
-			})
-
-			once := true
-			for record := range csvReader.Ch {
-				if record.Err != nil {
-					checkError(record.Err)
-				}
+		// files are parsed in parallel, results are output in order
+		results := make([]*dimResult, len(files))
+		tokens := make(chan int, config.NumCPUs)
+		var wg sync.WaitGroup
+		for i, file := range files {
+			wg.Add(1)
+			tokens <- 1
+			go func(i int, file string) {
+				defer func() {
+					wg.Done()
+					<-tokens
+				}()
+				results[i] = dimOfFile(&config, file, cols)
+			}(i, file)
+		}
+		wg.Wait()
 
-				numRows = record.Row
-
-				if once {
-					numCols = len(record.All)
-					if cols {
-						if noFiles {
-							outfh.WriteString(fmt.Sprintf("%d\n", numCols))
-						} else {
-							outfh.WriteString(fmt.Sprintf("%s\t%d\n", file, numCols))
-						}
-						break
-					}
-					once = false
-				}
+		total := dimResult{file: "total"}
+		var numColsTotal interface{}
+		if len(results) > 0 {
+			total.numCols, total.fingerprint = results[0].numCols, results[0].fingerprint
+			numColsTotal = total.numCols
+		}
+		for _, r := range results {
+			total.numRows += r.numRows
+			if r.size < 0 || total.size < 0 {
+				total.size = -1
+			} else {
+				total.size += r.size
 			}
-			if cols {
-				continue
+			if r.numCols != total.numCols {
+				numColsTotal = "-"
+			}
+			if r.fingerprint != results[0].fingerprint {
+				total.fingerprint = "-"
 			}
+		}
 
-			if rows {
+		dimSize := func(size int64) interface{} {
+			if size < 0 {
+				return "-"
+			}
+			return size
+		}
+		addRow := func(file string, numCols interface{}, numRows int, size interface{}, fingerprint string) {
+			if cols {
+				if noFiles {
+					outfh.WriteString(fmt.Sprintf("%v\n", numCols))
+				} else {
+					outfh.WriteString(fmt.Sprintf("%s\t%v\n", file, numCols))
+				}
+			} else if rows {
 				if noFiles {
 					outfh.WriteString(fmt.Sprintf("%d\n", numRows))
 				} else {
 					outfh.WriteString(fmt.Sprintf("%s\t%d\n", file, numRows))
 				}
 			} else if tabular {
+				var extra string
+				if details {
+					extra = fmt.Sprintf("\t%v\t%s", size, fingerprint)
+				}
 				if noFiles {
-					outfh.WriteString(fmt.Sprintf("%d\t%d\n", numCols, numRows))
+					outfh.WriteString(fmt.Sprintf("%v\t%d%s\n", numCols, numRows, extra))
 				} else {
-					outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\n", file, numCols, numRows))
+					outfh.WriteString(fmt.Sprintf("%s\t%v\t%d%s\n", file, numCols, numRows, extra))
 				}
 			} else {
-				tbl.AddRow([]interface{}{
-					file,
-					numCols,
-					numRows,
-				})
+				row := []interface{}{file, numCols, numRows}
+				if details {
+					row = append(row, size, fingerprint)
+				}
+				tbl.AddRow(row)
 			}
+		}
+
+		for _, r := range results {
+			addRow(r.file, r.numCols, r.numRows, dimSize(r.size), r.fingerprint)
+		}
 
-			readerReport(&config, csvReader, file)
+		if showTotal {
+			addRow(total.file, numColsTotal, total.numRows, dimSize(total.size), total.fingerprint)
 		}
 
 		if !(rows || cols) && !tabular {
@@ -164,11 +183,65 @@ var dimCmd = &cobra.Command{
 	},
 }
 
+// dimResult is the dimension of a file.
+type dimResult struct {
+	file             string
+	numCols, numRows int
+	size             int64 // -1 for stdin and remote files
+	fingerprint      string
+}
+
+// dimOfFile counts the columns and rows of a file.
+// Only the first row is read with onlyCols.
+func dimOfFile(config *Config, file string, onlyCols bool) *dimResult {
+	r := &dimResult{file: file, size: -1}
+	if !isStdin(file) && !isURL(file) {
+		if info, err := os.Stat(file); err == nil {
+			r.size = info.Size()
+		}
+	}
+
+	csvReader, err := newCSVReaderByConfig(*config, file)
+	if err != nil {
+		if err == xopen.ErrNoContent {
+			return r
+		}
+		checkError(err)
+	}
+
+	csvReader.Read(ReadOption{
+		FieldStr: "1-",
+	})
+
+	once := true
+	for record := range csvReader.Ch {
+		if record.Err != nil {
+			checkError(record.Err)
+		}
+
+		r.numRows = record.Row
+
+		if once {
+			r.numCols = len(record.All)
+			r.fingerprint = fmt.Sprintf("%016x", xxhash.Sum64String(strings.Join(record.All, "\t")))
+			if onlyCols {
+				return r
+			}
+			once = false
+		}
+	}
+
+	readerReport(config, csvReader, file)
+	return r
+}
+
 func init() {
 	dimCmd.Flags().BoolP("tabular", "", false, `output in machine-friendly tabular format`)
 	dimCmd.Flags().BoolP("cols", "", false, `only print number of columns (or using "csvtk ncol"`)
 	dimCmd.Flags().BoolP("rows", "", false, `only print number of rows (or using "csvtk nrow")`)
 	dimCmd.Flags().BoolP("no-files", "n", false, "do not print file names (only affect --cols and --rows)")
+	dimCmd.Flags().BoolP("details", "", false, `also output file sizes and fingerprints of header rows (the first rows), for checking if files share the same header`)
+	dimCmd.Flags().BoolP("total", "", false, `add a row of the total number of rows (and sizes). The number of columns and the fingerprint are "-" if they differ between files`)
 
 	RootCmd.AddCommand(dimCmd)
 
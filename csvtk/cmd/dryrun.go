@@ -0,0 +1,238 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// dryRun explains what a command would do, i.e., the flags given, the input
+// files, columns matched by the field selection of each file, and whether
+// records are streamed or kept in memory, and then exits without processing.
+func dryRun(cmd *cobra.Command, config Config) {
+	w := os.Stderr
+
+	fmt.Fprintf(w, "command: %s\n", cmd.CommandPath())
+
+	fmt.Fprintln(w, "flags:")
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name == "dry-run" {
+			return
+		}
+		name := "--" + f.Name
+		if f.Shorthand != "" {
+			name = "-" + f.Shorthand + "/" + name
+		}
+		fmt.Fprintf(w, "  %s: %s\n", name, f.Value.String())
+	})
+
+	files := getFileListFromArgsAndFile(cmd, cmd.Flags().Args(), true, "infile-list", true)
+
+	fmt.Fprintf(w, "memory: %s\n", dryRunMemory(cmd))
+
+	fieldStrs := dryRunFields(cmd)
+	var fuzzy bool
+	if cmd.Flags().Lookup("fuzzy-fields") != nil {
+		fuzzy = getFlagBool(cmd, "fuzzy-fields")
+	}
+
+	var fieldStr string
+	for i, file := range files {
+		if i < len(fieldStrs) {
+			fieldStr = fieldStrs[i]
+		}
+		dryRunFile(w, config, file, fieldStr, fuzzy)
+	}
+
+	removeInPlaceTemp()
+	os.Exit(0)
+}
+
+// dryRunFields returns the field selections of a command, one for each file
+// for join, or nil if the command does not select fields.
+func dryRunFields(cmd *cobra.Command) []string {
+	switch cmd.Name() {
+	case "join":
+		return getFlagSemicolonSeparatedStrings(cmd, "fields")
+	case "sort":
+		keys := getFlagStringSlice(cmd, "keys")
+		for i, key := range keys {
+			if j := strings.Index(key, ":"); j >= 0 {
+				keys[i] = key[:j]
+			}
+		}
+		return []string{strings.Join(keys, ",")}
+	}
+	if f := cmd.Flags().Lookup("fields"); f != nil && f.Value.Type() == "string" {
+		if s := getFlagString(cmd, "fields"); s != "" {
+			return []string{s}
+		}
+	}
+	return nil
+}
+
+// dryRunFile reads the header row of a file, and shows columns matched by
+// each selector of the field selection.
+func dryRunFile(w io.Writer, config Config, file string, fieldStr string, fuzzy bool) {
+	var size string
+	if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+		size = fmt.Sprintf(" (%s)", humanize.Bytes(uint64(fi.Size())))
+	}
+	fmt.Fprintf(w, "file: %s%s\n", file, size)
+
+	csvReader, err := newCSVReaderByConfig(config, file)
+	checkError(err)
+	first := dryRunFirstRow(csvReader, "", false)
+	if first == nil {
+		fmt.Fprintln(w, "  no records")
+		return
+	}
+
+	header := first.All
+	label := func(f int) string {
+		if config.NoHeaderRow {
+			return strconv.Itoa(f)
+		}
+		return fmt.Sprintf("%d (%s)", f, header[f-1])
+	}
+	labels := func(fields []int) string {
+		if len(fields) == 0 {
+			return "no columns"
+		}
+		s := make([]string, len(fields))
+		for i, f := range fields {
+			s[i] = label(f)
+		}
+		return strings.Join(s, ", ")
+	}
+
+	fmt.Fprintf(w, "  columns: %d\n", len(header))
+	if fieldStr == "" {
+		return
+	}
+	for _, s := range strings.Split(fieldStr, ",") {
+		if s == "" {
+			continue
+		}
+		var unselected string
+		if s[0] == '-' {
+			unselected = ", unselected"
+		}
+		fmt.Fprintf(w, "  selector %q: %s%s\n", s, labels(dryRunSelector(header, s, fuzzy)), unselected)
+	}
+
+	// the field selection is resolved in the same way as processing data
+	row := dryRunFirstRow(newSourceCSVReader(config, file, &sliceSource{records: [][]string{header}}), fieldStr, fuzzy)
+	var fields []int
+	if row != nil {
+		for _, f := range row.Fields {
+			if f > 0 && f <= len(header) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	fmt.Fprintf(w, "  selected: %s\n", labels(fields))
+}
+
+// dryRunFirstRow returns the first record of selected fields, or nil if no
+// records or no fields are selected.
+func dryRunFirstRow(csvReader *CSVReader, fieldStr string, fuzzy bool) *Record {
+	csvReader.Read(ReadOption{
+		FieldStr:           fieldStr,
+		FuzzyFields:        fuzzy,
+		AllowMissingColumn: true,
+	})
+	for record := range csvReader.Ch {
+		checkError(record.Err)
+		return &record
+	}
+	return nil
+}
+
+// dryRunSelector returns columns matched by a selector, i.e., a field, a
+// range of fields, a column name or a fuzzy column name. The leading "-" of
+// unselected column names is ignored.
+func dryRunSelector(header []string, s string, fuzzy bool) []int {
+	var fields []int
+	if f, err := strconv.Atoi(s); err == nil {
+		if f < 0 {
+			f = -f
+		}
+		if f >= 1 && f <= len(header) {
+			fields = append(fields, f)
+		}
+		return fields
+	}
+	if reIntegerRange.MatchString(s) {
+		for _, f := range fieldRange(len(header), strings.TrimPrefix(s, "-")) {
+			if f >= 1 && f <= len(header) {
+				fields = append(fields, f)
+			}
+		}
+		return fields
+	}
+	s = strings.TrimPrefix(s, "-")
+	re := fuzzyField2Regexp(s)
+	for i, col := range header {
+		if (fuzzy && re.MatchString(col)) || col == s {
+			fields = append(fields, i+1)
+		}
+	}
+	return fields
+}
+
+// dryRunMemory describes whether records are streamed or kept in memory.
+func dryRunMemory(cmd *cobra.Command) string {
+	switch cmd.Name() {
+	case "sort":
+		if getFlagString(cmd, "buffer-size") != "" {
+			return "bounded, sorted chunks of --buffer-size are spilled to temporary files"
+		}
+		return "in-memory, all records are kept in memory, use --buffer-size for bounded memory"
+	case "join":
+		if getFlagBool(cmd, "spill-to-disk") || getFlagBool(cmd, "outer-join") ||
+			len(getFlagCommaSeparatedInts(cmd, "keep-unmatched-of")) > 0 {
+			return "bounded, records are merged by keys with --buffer-size kept in memory"
+		}
+		return "in-memory, records of all files are kept in memory, use --spill-to-disk for bounded memory"
+	case "uniq":
+		if getFlagBool(cmd, "spill-to-disk") {
+			return "bounded, records are deduplicated with --buffer-size kept in memory"
+		}
+		return "streaming, with memory growing with the number of unique keys"
+	case "freq", "inter", "top":
+		return "streaming, with memory growing with the number of unique keys"
+	case "transpose", "spread", "pivot", "rank", "summary", "agg", "window",
+		"dedup", "diff", "corr", "cluster", "distance", "outlier", "interpolate",
+		"fold", "sql", "csv2md", "csv2rst", "csv2latex", "csv2html", "csv2json",
+		"csv2yaml", "csv2toml", "csv2xlsx", "bar", "box", "hist", "line",
+		"heatmap", "violin":
+		return "in-memory, all records are kept in memory"
+	}
+	return "streaming"
+}
@@ -0,0 +1,96 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dupColnamesPolicy is how duplicated column names in header rows are
+// handled, set by the global flag --on-dup-colnames.
+var dupColnamesPolicy = "keep"
+
+// setDupColnamesPolicy sets how duplicated column names are handled.
+func setDupColnamesPolicy(policy string) error {
+	switch policy {
+	case "keep", "error", "rename", "index":
+	default:
+		return fmt.Errorf("unsupported value of flag --on-dup-colnames: %s. available: keep, error, rename, index", policy)
+	}
+	dupColnamesPolicy = policy
+	return nil
+}
+
+// disambiguateColnames renames duplicated column names deterministically:
+// the first one is kept, and others are renamed to name_2, name_3, and so on,
+// skipping names existing in the header row. Duplicated names are also
+// returned.
+func disambiguateColnames(header []string) ([]string, []string) {
+	counts := make(map[string]int, len(header))
+	used := make(map[string]struct{}, len(header))
+	for _, col := range header {
+		used[col] = struct{}{}
+	}
+
+	var dups []string
+	names := make([]string, len(header))
+	for i, col := range header {
+		counts[col]++
+		if counts[col] == 1 {
+			names[i] = col
+			continue
+		}
+		if counts[col] == 2 {
+			dups = append(dups, col)
+		}
+
+		var name string
+		for k := counts[col]; ; k++ {
+			name = col + "_" + strconv.Itoa(k)
+			if _, ok := used[name]; !ok {
+				counts[col] = k
+				break
+			}
+		}
+		used[name] = struct{}{}
+		names[i] = name
+	}
+	return names, dups
+}
+
+// applyDupColnamesPolicy applies --on-dup-colnames to a header row, and
+// returns the header row for output and column names for selecting fields.
+func applyDupColnamesPolicy(header []string, file string) ([]string, []string) {
+	names, dups := disambiguateColnames(header)
+	if len(dups) == 0 {
+		return header, header
+	}
+	switch dupColnamesPolicy {
+	case "error":
+		checkError(fmt.Errorf("duplicated column names in file %s: %s", file, strings.Join(dups, ", ")))
+	case "rename":
+		return names, names
+	case "index":
+		return header, names
+	}
+	return header, header
+}
@@ -0,0 +1,203 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shenwei356/xopen"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// inEncoding is the encoding of input files, set by the global flag --in-encoding.
+var inEncoding encoding.Encoding
+
+// inEncodingAuto is true for --in-encoding auto.
+var inEncodingAuto bool
+
+// textEncoding returns an encoding by name, e.g., latin1, windows-1252,
+// gbk, shift-jis, utf-16le, or utf-8-bom for UTF-8 with a BOM.
+func textEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ReplaceAll(strings.ToLower(name), "_", "-") {
+	case "utf-8", "utf8":
+		return unicode.UTF8, nil
+	case "utf-8-bom", "utf8-bom":
+		return unicode.UTF8BOM, nil
+	case "utf-16", "utf16":
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), nil
+	case "utf-16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case "utf-16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	}
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	if enc, err := htmlindex.Get(name); err == nil {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s", name)
+}
+
+// setInputEncoding sets the encoding of input files, "" for UTF-8.
+func setInputEncoding(name string) error {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return nil
+	case "auto":
+		inEncodingAuto = true
+		return nil
+	}
+	enc, err := textEncoding(name)
+	if err != nil {
+		return err
+	}
+	inEncoding = enc
+	return nil
+}
+
+// decodingInput returns true if input files need transcoding.
+func decodingInput() bool {
+	return inEncoding != nil || inEncodingAuto
+}
+
+// decodeInput transcodes data of the input encoding to UTF-8, with BOMs
+// removed. For --in-encoding auto, the encoding is detected from the BOM,
+// or windows-1252 is assumed if the data is not valid UTF-8.
+func decodeInput(r io.Reader) io.Reader {
+	enc := inEncoding
+	if inEncodingAuto {
+		br := bufio.NewReaderSize(r, 1<<16)
+		data, _ := br.Peek(1 << 16)
+		enc = detectEncoding(data, len(data) < 1<<16)
+		r = br
+	}
+	if enc == nil {
+		return r
+	}
+	// a BOM overrides the given encoding
+	return transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder()))
+}
+
+// detectEncoding detects the encoding of a sample, nil for UTF-8 without
+// BOMs.
+func detectEncoding(data []byte, complete bool) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return unicode.UTF8BOM
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}), bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	}
+	if !complete { // the last rune may be truncated
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.RuneStart(data[len(data)-1]); i++ {
+			data = data[:len(data)-1]
+		}
+		if len(data) > 0 {
+			data = data[:len(data)-1]
+		}
+	}
+	if utf8.Valid(data) {
+		return nil
+	}
+	return charmap.Windows1252
+}
+
+var encodedOutput struct {
+	w    *os.File // write end of the pipe replacing os.Stdout
+	done chan error
+}
+
+// setOutputEncoding encodes the output, including stdout, with the given
+// encoding. Like setOutputCompression, os.Stdout is replaced with a pipe,
+// and "-" is returned as the output file, so it should be called after
+// setOutputCompression, to encode data before compressing.
+func setOutputEncoding(outFile string, name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return outFile, nil
+	}
+	if encodedOutput.w != nil { // already set
+		return "-", nil
+	}
+	enc, err := textEncoding(name)
+	if err != nil {
+		return outFile, err
+	}
+
+	var dst io.WriteCloser = os.Stdout
+	if !isStdin(outFile) {
+		if err = os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+			return outFile, err
+		}
+		if dst, err = xopen.Wopen(outFile); err != nil { // compressed by the file extension
+			return outFile, err
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return outFile, err
+	}
+	os.Stdout = w
+
+	encodedOutput.w = w
+	encodedOutput.done = make(chan error, 1)
+	go func() {
+		tw := transform.NewWriter(dst, enc.NewEncoder())
+		_, err := io.Copy(tw, r)
+		if err2 := tw.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to encode output as %s: %s", name, err)
+		}
+		if isStdin(outFile) { // a pipe of compression or the real stdout, closed by others
+		} else if err2 := dst.Close(); err == nil {
+			err = err2
+		}
+		encodedOutput.done <- err
+	}()
+
+	return "-", nil
+}
+
+// FinishOutputEncoding waits for the encoding of the output to finish.
+func FinishOutputEncoding() error {
+	if encodedOutput.w == nil {
+		return nil
+	}
+	if err := encodedOutput.w.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return <-encodedOutput.done
+}
@@ -0,0 +1,291 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	GroupID: "misc",
+
+	Use:   "exec",
+	Short: "execute a shell command for each row, and append its output",
+	Long: `execute a shell command for each row, and append its output
+
+Placeholders like {colname} or {1} in the command (-c/--command) are
+replaced with values of the columns, which are quoted for the shell
+unless --no-quote is given. Unknown placeholders are kept as they are.
+
+Commands are executed with "sh -c" (or --shell), by -j/--num-cpus
+workers in parallel, and the outputs are in the same order as the input.
+The stdout of each command, with trailing newlines removed, is appended
+as a new column (-n/--name), while the stderr is passed through.
+
+Failure policies (-e/--on-error) for commands with non-zero exit codes
+or timeout (--timeout):
+
+  fail    stop and report the error (default)
+  keep    keep the row with the output
+  skip    skip the row
+
+The exit code can also be appended with --exit-code-column.
+
+Examples:
+
+    csvtk exec -c "wc -l < {file}" -n lines files.csv
+    csvtk exec -j 8 -c "curl -s -o /dev/null -w '%{http_code}' {url}" \
+        -n status -e keep urls.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		command := getFlagString(cmd, "command")
+		if command == "" {
+			checkError(fmt.Errorf("flag -c (--command) needed"))
+		}
+		name := getFlagString(cmd, "name")
+		shell := getFlagString(cmd, "shell")
+		noQuote := getFlagBool(cmd, "no-quote")
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		checkError(err)
+		exitCodeColumn := getFlagString(cmd, "exit-code-column")
+		onError := strings.ToLower(getFlagString(cmd, "on-error"))
+		switch onError {
+		case "fail", "keep", "skip":
+		default:
+			checkError(fmt.Errorf("invalid value of flag -e/--on-error: %s. available: fail, keep, skip", onError))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		run := func(job *execJob) {
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			} else {
+				ctx, cancel = context.WithCancel(context.Background())
+			}
+			defer cancel()
+
+			var stdout bytes.Buffer
+			c := exec.CommandContext(ctx, shell, "-c", job.command)
+			c.Stdout = &stdout
+			c.Stderr = os.Stderr
+			job.err = c.Run()
+			if ctx.Err() == context.DeadlineExceeded {
+				job.err = fmt.Errorf("timeout after %s", timeout)
+			}
+			job.exitCode = 0
+			if job.err != nil {
+				job.exitCode = -1
+				if e, ok := job.err.(*exec.ExitError); ok {
+					job.exitCode = e.ExitCode()
+				}
+			}
+			job.output = strings.TrimRight(stdout.String(), "\r\n")
+		}
+
+		printHeaderRow := true
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk exec: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			// workers
+			jobs := make(chan *execJob, config.NumCPUs)
+			var wg sync.WaitGroup
+			for i := 0; i < config.NumCPUs; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for job := range jobs {
+						run(job)
+						close(job.done)
+					}
+				}()
+			}
+
+			// results in order
+			queue := make(chan *execJob, config.NumCPUs*4)
+			finished := make(chan int)
+			go func() {
+				for job := range queue {
+					<-job.done
+					if job.err != nil {
+						switch onError {
+						case "fail":
+							checkError(fmt.Errorf("[line %d] command failed: %s: %s", job.line, job.command, job.err))
+						case "skip":
+							continue
+						}
+					}
+					job.record = append(job.record, job.output)
+					if exitCodeColumn != "" {
+						job.record = append(job.record, strconv.Itoa(job.exitCode))
+					}
+					checkError(writer.Write(job.record))
+				}
+				finished <- 1
+			}()
+
+			var header []string
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header = record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+
+					if !config.NoHeaderRow {
+						if printHeaderRow && !config.NoOutHeader {
+							items := append(append([]string{}, record.All...), name)
+							if exitCodeColumn != "" {
+								items = append(items, exitCodeColumn)
+							}
+							checkError(writer.Write(items))
+						}
+						printHeaderRow = false
+						continue
+					}
+				}
+
+				job := &execJob{
+					line:    record.Line,
+					record:  record.All,
+					command: execFillPlaceholders(command, header, record.All, !noQuote),
+					done:    make(chan struct{}),
+				}
+				queue <- job
+				jobs <- job
+			}
+			close(jobs)
+			close(queue)
+			wg.Wait()
+			<-finished
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringP("command", "c", "", `command to execute, with placeholders like {colname} or {1}`)
+	execCmd.Flags().StringP("name", "n", "output", `name of the output column`)
+	execCmd.Flags().StringP("shell", "", "sh", `shell to execute commands with`)
+	execCmd.Flags().BoolP("no-quote", "", false, `do not quote values in placeholders for the shell`)
+	execCmd.Flags().DurationP("timeout", "", 0, `timeout of each command, e.g., 10s, 0 for no limit`)
+	execCmd.Flags().StringP("on-error", "e", "fail", `what to do when a command fails: fail, keep, skip`)
+	execCmd.Flags().StringP("exit-code-column", "", "", `name of the column of exit codes to append`)
+}
+
+type execJob struct {
+	line     int
+	record   []string
+	command  string
+	output   string
+	exitCode int
+	err      error
+	done     chan struct{}
+}
+
+var reExecPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// execFillPlaceholders replaces placeholders of column names or numbers
+// with values.
+func execFillPlaceholders(command string, header []string, record []string, quote bool) string {
+	return reExecPlaceholder.ReplaceAllStringFunc(command, func(s string) string {
+		key := s[1 : len(s)-1]
+		i := -1
+		for j, name := range header {
+			if name == key {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(record) {
+				i = n - 1
+			}
+		}
+		if i < 0 {
+			return s
+		}
+		if quote {
+			return "'" + strings.ReplaceAll(record[i], "'", `'\''`) + "'"
+		}
+		return record[i]
+	})
+}
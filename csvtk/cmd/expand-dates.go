@@ -0,0 +1,343 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"gitlab.com/metakeule/fmtdate"
+)
+
+// expandDatesCmd represents the expand-dates command
+var expandDatesCmd = &cobra.Command{
+	GroupID: "transform",
+
+	Use:   "expand-dates",
+	Short: "insert missing periods of a date/time field, optionally per group",
+	Long: `insert missing periods of a date/time field, optionally per group
+
+Records of each group are sorted by the date/time field, and records
+for missing periods between the first and last ones (or --start and
+--end) are inserted, with other fields filled with --fill, e.g., "NA"
+or "0". Values of group fields are kept in inserted records.
+
+Frequencies (--freq):
+  second, minute, hour, day, week (starting on Monday), month, year
+
+For month and year, periods are stepped by calendar months or years from
+the first date (or --start), and the day of inserted records is clamped to
+the end of shorter months, e.g., 2020-01-31, 2020-02-29, 2020-03-31.
+
+Date parsing is supported by: https://github.com/araddon/dateparse
+Dates of inserted records are formatted in the layout of the first
+date/time value, or --format in MS Excel (TM) syntax like "csvtk fmtdate".
+
+Examples:
+
+    csvtk expand-dates -f date --freq day -g station --fill NA data.csv
+    csvtk expand-dates -f month --freq month --fill 0 \
+        --start 2024-01 --end 2024-12 data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "field")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--field) needed"))
+		}
+		groupsStr := getFlagString(cmd, "groups")
+		freq := strings.ToLower(getFlagString(cmd, "freq"))
+		if _, ok := dateFreqs[freq]; !ok {
+			checkError(fmt.Errorf("invalid value of flag --freq: %s. available: second, minute, hour, day, week, month, year", freq))
+		}
+		fill := getFlagString(cmd, "fill")
+		outfmt := getFlagString(cmd, "format")
+		timezone := getFlagString(cmd, "time-zone")
+		if timezone != "" {
+			loc, err := time.LoadLocation(timezone)
+			if err != nil {
+				checkError(fmt.Errorf("setting time zone: %s", err))
+			}
+			time.Local = loc
+		}
+
+		var start, end, anchor time.Time
+		var err error
+		if s := getFlagString(cmd, "start"); s != "" {
+			anchor, err = dateparse.ParseLocal(s)
+			if err != nil {
+				checkError(fmt.Errorf("invalid value of flag --start: %s", s))
+			}
+			start = truncateDate(anchor, freq)
+		}
+		if s := getFlagString(cmd, "end"); s != "" {
+			end, err = dateparse.ParseLocal(s)
+			if err != nil {
+				checkError(fmt.Errorf("invalid value of flag --end: %s", s))
+			}
+			end = truncateDate(end, freq)
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk expand-dates: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		var field int
+		var groupFields []int
+		var layout string
+		records := make([][]string, 0, 1024)
+		times := make([]time.Time, 0, 1024)       // truncated
+		rawTimes := make([]time.Time, 0, 1024)    // for anchors of periods
+		partitions := make(map[string][]int, 128) // group -> indexes of records
+		groups := make([]string, 0, 128)          // groups in order of appearance
+		keyEncoder := &joinKeyEncoder{}
+		var group string
+		var t time.Time
+		var ok bool
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header := record.All
+				if config.NoHeaderRow {
+					header = make([]string, len(record.All))
+				}
+				fields := selectFieldsByHeader(header, fieldStr, false)
+				if len(fields) != 1 {
+					checkError(fmt.Errorf("only one date/time field allowed: %s", fieldStr))
+				}
+				field = fields[0]
+				if groupsStr != "" {
+					groupFields = selectFieldsByHeader(header, groupsStr, false)
+				}
+
+				if !config.NoHeaderRow {
+					if !config.NoOutHeader {
+						checkError(writer.Write(record.All))
+					}
+					continue
+				}
+			}
+
+			t, err = dateparse.ParseLocal(record.All[field-1])
+			if err != nil {
+				checkError(fmt.Errorf("[line %d] failed to parse date/time: %s", record.Line, record.All[field-1]))
+			}
+			if layout == "" && outfmt == "" {
+				layout, err = dateparse.ParseFormat(record.All[field-1])
+				checkError(err)
+			}
+
+			group, _ = keyEncoder.key(record.All, groupFields)
+			if _, ok = partitions[group]; !ok {
+				groups = append(groups, group)
+			}
+			partitions[group] = append(partitions[group], len(records))
+
+			records = append(records, record.All)
+			times = append(times, truncateDate(t, freq))
+			rawTimes = append(rawTimes, t)
+		}
+		readerReport(&config, csvReader, file)
+
+		formatDate := func(t time.Time) string {
+			if outfmt != "" {
+				return fmtdate.Format(outfmt, t)
+			}
+			return t.Format(layout)
+		}
+
+		var first, last, p, a time.Time
+		var k int
+		for _, group = range groups {
+			rows := partitions[group]
+			sort.SliceStable(rows, func(i, j int) bool { return times[rows[i]].Before(times[rows[j]]) })
+
+			first, last = times[rows[0]], times[rows[len(rows)-1]]
+			a = rawTimes[rows[0]]
+			if !start.IsZero() {
+				first, a = start, anchor
+			}
+			if !end.IsZero() {
+				last = end
+			}
+
+			k = 0
+			for ; k < len(rows) && times[rows[k]].Before(first); k++ { // out of range
+				checkError(writer.Write(records[rows[k]]))
+			}
+			for p = first; !p.After(last); p = nextDate(p, freq) {
+				if k < len(rows) && times[rows[k]].Equal(p) {
+					for ; k < len(rows) && times[rows[k]].Equal(p); k++ {
+						checkError(writer.Write(records[rows[k]]))
+					}
+					continue
+				}
+
+				items := make([]string, len(records[rows[0]]))
+				for i := range items {
+					items[i] = fill
+				}
+				for _, f := range groupFields {
+					items[f-1] = records[rows[0]][f-1]
+				}
+				items[field-1] = formatDate(periodDate(p, a, freq))
+				checkError(writer.Write(items))
+			}
+			for ; k < len(rows); k++ { // out of range
+				checkError(writer.Write(records[rows[k]]))
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(expandDatesCmd)
+
+	expandDatesCmd.Flags().StringP("field", "f", "", `the date/time field. e.g -f 1 or -f date`)
+	expandDatesCmd.Flags().StringP("groups", "g", "", `group via fields. e.g -g 1,2 or -g columnA,columnB`)
+	expandDatesCmd.Flags().StringP("freq", "", "day", `frequency: second, minute, hour, day, week, month, year`)
+	expandDatesCmd.Flags().StringP("fill", "", "", `content for other fields of inserted records, e.g., "NA" or "0"`)
+	expandDatesCmd.Flags().StringP("start", "", "", `the first period, default: the first one of each group`)
+	expandDatesCmd.Flags().StringP("end", "", "", `the last period, default: the last one of each group`)
+	expandDatesCmd.Flags().StringP("format", "", "", `output date format of inserted records in MS Excel (TM) syntax, type "csvtk fmtdate -h" for details`)
+	expandDatesCmd.Flags().StringP("time-zone", "z", "", `timezone aka "Asia/Shanghai" or "America/Los_Angeles" formatted time-zone`)
+}
+
+// dateFreqs are supported frequencies of date/time periods.
+var dateFreqs = map[string]bool{
+	"second": true,
+	"minute": true,
+	"hour":   true,
+	"day":    true,
+	"week":   true,
+	"month":  true,
+	"year":   true,
+}
+
+// truncateDate returns the start of the period containing t.
+func truncateDate(t time.Time, freq string) time.Time {
+	y, m, d := t.Date()
+	switch freq {
+	case "second":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// periodDate returns the date of an inserted record of the period starting
+// at p. Months and years are stepped from the anchor, i.e., the day (and the
+// month for years) and the time of the anchor are kept, with the day clamped
+// to the end of shorter months.
+func periodDate(p time.Time, anchor time.Time, freq string) time.Time {
+	y, m, _ := p.Date()
+	switch freq {
+	case "month":
+	case "year":
+		m = anchor.Month()
+	default:
+		return p
+	}
+	d := anchor.Day()
+	if n := time.Date(y, m+1, 0, 0, 0, 0, 0, p.Location()).Day(); d > n {
+		d = n
+	}
+	return time.Date(y, m, d, anchor.Hour(), anchor.Minute(), anchor.Second(), anchor.Nanosecond(), p.Location())
+}
+
+// nextDate returns the start of the next period.
+func nextDate(t time.Time, freq string) time.Time {
+	switch freq {
+	case "second":
+		return t.Add(time.Second)
+	case "minute":
+		return t.Add(time.Minute)
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
@@ -0,0 +1,196 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// explodeCmd represents the explode command
+var explodeCmd = &cobra.Command{
+	GroupID: "transform",
+
+	Use:   "explode",
+	Short: "split delimited cells of one or more fields into multiple rows",
+	Long: `split delimited cells of one or more fields into multiple rows
+
+Values of multiple fields are exploded in lockstep, i.e., the n-th values
+of all fields are in the same row. If the numbers of values differ,
+it reports an error by default, or fills missing values with --fill
+when -m/--mismatch fill is given.
+
+Example:
+
+    $ echo -ne "id,genes,scores\n1,a;b,0.1;0.2\n2,c,0.3\n" \
+        | csvtk explode -f genes,scores -s ";" --index-column idx \
+        | csvtk pretty
+    id   genes   scores   idx
+    1    a       0.1      1
+    1    b       0.2      2
+    2    c       0.3      1
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+
+		separater := getFlagString(cmd, "separater")
+		if separater == "" {
+			checkError(fmt.Errorf("flag -s (--separater) needed"))
+		}
+		trim := getFlagBool(cmd, "trim")
+		indexColumn := getFlagString(cmd, "index-column")
+		fill := getFlagString(cmd, "fill")
+		mismatch := strings.ToLower(getFlagString(cmd, "mismatch"))
+		switch mismatch {
+		case "error", "fill":
+		default:
+			checkError(fmt.Errorf("invalid value of flag -m/--mismatch: %s. available: error, fill", mismatch))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := true
+		var items []string
+		var values [][]string
+		var n, i, j int
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk explode: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr:    fieldStr,
+				FuzzyFields: fuzzyFields,
+
+				DoNotAllowDuplicatedColumnName: true,
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+					values = make([][]string, len(record.Fields))
+
+					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
+						if printHeaderRow && !config.NoOutHeader {
+							items = append(items[:0], record.All...)
+							if indexColumn != "" {
+								items = append(items, indexColumn)
+							}
+							checkError(writer.Write(items))
+						}
+						printHeaderRow = false
+						continue
+					}
+				}
+
+				n = 0
+				for i = range record.Fields {
+					values[i] = strings.Split(record.Selected[i], separater)
+					if len(values[i]) > n {
+						n = len(values[i])
+					}
+				}
+				if mismatch == "error" {
+					for i = range values {
+						if len(values[i]) != n {
+							checkError(fmt.Errorf("[line %d] numbers of values differ in fields to explode, you can use '-m fill' to fill missing values", record.Line))
+						}
+					}
+				}
+
+				for j = 0; j < n; j++ {
+					items = append(items[:0], record.All...)
+					for i = range values {
+						if j < len(values[i]) {
+							items[record.Fields[i]-1] = values[i][j]
+							if trim {
+								items[record.Fields[i]-1] = strings.TrimSpace(values[i][j])
+							}
+						} else {
+							items[record.Fields[i]-1] = fill
+						}
+					}
+					if indexColumn != "" {
+						items = append(items, strconv.Itoa(j+1))
+					}
+					checkError(writer.Write(items))
+				}
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(explodeCmd)
+
+	explodeCmd.Flags().StringP("fields", "f", "", `fields to explode in lockstep. e.g -f 1,2 or -f columnA,columnB`)
+	explodeCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	explodeCmd.Flags().StringP("separater", "s", ";", "separater of values in cells")
+	explodeCmd.Flags().BoolP("trim", "", false, "trim spaces around values")
+	explodeCmd.Flags().StringP("index-column", "", "", "name of the column to append, with the 1-based index of values")
+	explodeCmd.Flags().StringP("mismatch", "m", "error", "what to do when numbers of values differ in fields: error, fill")
+	explodeCmd.Flags().StringP("fill", "", "", `content for filling missing values with "-m fill"`)
+}
@@ -0,0 +1,183 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// exprFunctions are built-in functions of mutate2 and filter2, which,
+// unlike len() and ulen(), accept numeric fields as numbers.
+//
+// Empty cells are passed as empty strings, or nulls if the null coalescence
+// operator "??" is used, and both are treated as nulls by these functions.
+var exprFunctions = map[string]govaluate.ExpressionFunction{
+	"convert":  convertFunction,
+	"if":       ifFunction,
+	"coalesce": coalesceFunction,
+	"is_null":  isNullFunction,
+	"nullif":   nullIfFunction,
+	"case":     caseFunction,
+	"div":      divFunction,
+}
+
+var reExprFunctions = func() *regexp.Regexp {
+	names := make([]string, 0, len(exprFunctions))
+	for name := range exprFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return regexp.MustCompile(`\b(` + strings.Join(names, "|") + `)\(`)
+}()
+
+// isNullValue tells whether a value is a null or an empty string.
+func isNullValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && s == ""
+}
+
+// exprBool returns the value of a condition, where nulls are false.
+func exprBool(fn string, v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("%s(): condition is not boolean: %v", fn, v)
+}
+
+// exprFloat converts numbers and numeric strings to float64.
+func exprFloat(v interface{}) (float64, bool) {
+	switch a := v.(type) {
+	case float64:
+		return a, true
+	case string:
+		f, err := strconv.ParseFloat(removeComma(strings.TrimSpace(a)), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// if(cond, a, b) returns a if cond is true, otherwise b.
+func ifFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("if() needs 3 arguments: condition, value if true, value if false")
+	}
+	ok, err := exprBool("if", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
+// coalesce(a, b, ...) returns the first non-null value.
+func coalesceFunction(args ...interface{}) (interface{}, error) {
+	for _, v := range args {
+		if !isNullValue(v) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// is_null(a) tells whether a is a null or an empty string.
+func isNullFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("is_null() needs 1 argument")
+	}
+	return isNullValue(args[0]), nil
+}
+
+// nullif(a, b) returns a null if a equals b, otherwise a.
+func nullIfFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("nullif() needs 2 arguments")
+	}
+	a, b := args[0], args[1]
+	if fa, ok := exprFloat(a); ok {
+		if fb, ok := exprFloat(b); ok {
+			if fa == fb {
+				return nil, nil
+			}
+			return a, nil
+		}
+	}
+	if fmt.Sprint(a) == fmt.Sprint(b) {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// case(cond1, v1, cond2, v2, ..., default) returns the value of the first
+// true condition, or the optional default value.
+func caseFunction(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("case() needs at least 2 arguments: condition, value")
+	}
+	var ok bool
+	var err error
+	for i := 0; i+1 < len(args); i += 2 {
+		ok, err = exprBool("case", args[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return args[i+1], nil
+		}
+	}
+	if len(args)%2 == 1 {
+		return args[len(args)-1], nil
+	}
+	return nil, nil
+}
+
+// div(a, b[, default]) returns a/b, or the default value (null by default)
+// if b is zero or any of them is null or not a number.
+func divFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("div() needs 2 or 3 arguments: dividend, divisor[, default]")
+	}
+	var def interface{}
+	if len(args) == 3 {
+		def = args[2]
+	}
+	a, ok := exprFloat(args[0])
+	if !ok {
+		return def, nil
+	}
+	b, ok := exprFloat(args[1])
+	if !ok || b == 0 {
+		return def, nil
+	}
+	return a / b, nil
+}
@@ -0,0 +1,367 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// KeyedRecord is a CSV record along with the key used for sorting.
+type KeyedRecord struct {
+	Key    string
+	Record []string
+}
+
+// size roughly estimates the memory occupied by the record.
+func (r *KeyedRecord) size() int64 {
+	n := int64(len(r.Key)) + 64
+	for _, s := range r.Record {
+		n += int64(len(s)) + 16
+	}
+	return n
+}
+
+// RecordSorter sorts records with bounded memory. Records are buffered in
+// memory and spilled to sorted temporary files (runs) when the buffer is full.
+// All runs are merged when reading the sorted records.
+// Records with the same key keep their input order.
+type RecordSorter struct {
+	tmpDir  string // parent directory of temporary files
+	dir     string // directory of temporary files, created when needed
+	bufSize int64
+	less    func(a, b *KeyedRecord) bool
+
+	threads  int    // number of runs sorted and written concurrently
+	compress string // compression format of runs
+
+	buf   []*KeyedRecord
+	size  int64
+	runs  []string
+	files []*os.File // opened runs
+
+	tokens chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	err    error // error of spilling runs in background
+}
+
+// NewRecordSorter creates a RecordSorter. tmpDir is the directory to store
+// temporary files, os.TempDir() is used if it's empty.
+// Records are sorted by keys in lexicographic order if less is nil.
+func NewRecordSorter(tmpDir string, bufSize int64, less func(a, b *KeyedRecord) bool) *RecordSorter {
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	if less == nil {
+		less = func(a, b *KeyedRecord) bool { return a.Key < b.Key }
+	}
+	return &RecordSorter{
+		tmpDir:  tmpDir,
+		bufSize: bufSize,
+		less:    less,
+		threads: 1,
+		buf:     make([]*KeyedRecord, 0, 1024),
+	}
+}
+
+// SetThreads sets the number of runs sorted and written concurrently.
+// The buffer size is split among them, so the memory is still bounded.
+func (s *RecordSorter) SetThreads(threads int) {
+	if threads < 1 {
+		threads = 1
+	}
+	s.threads = threads
+	s.tokens = make(chan struct{}, threads)
+}
+
+// SetCompression sets the compression format of temporary files,
+// e.g., gzip, zstd, lz4. Temporary files are not compressed by default.
+func (s *RecordSorter) SetCompression(format string) error {
+	if format == "" || format == "none" {
+		s.compress = ""
+		return nil
+	}
+	if _, err := newCompressWriter(io.Discard, format, -1); err != nil {
+		return err
+	}
+	s.compress = format
+	return nil
+}
+
+// Add appends a record.
+func (s *RecordSorter) Add(r *KeyedRecord) error {
+	s.buf = append(s.buf, r)
+	s.size += r.size()
+	if s.size >= s.bufSize/int64(s.threads) {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *RecordSorter) sortBuffer(buf []*KeyedRecord) {
+	sort.SliceStable(buf, func(i, j int) bool { return s.less(buf[i], buf[j]) })
+}
+
+// spill writes sorted records in the buffer to a new run. With multiple
+// threads, the buffer is sorted and written in background.
+func (s *RecordSorter) spill() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if s.dir == "" {
+		s.dir, err = os.MkdirTemp(s.tmpDir, "csvtk-")
+		if err != nil {
+			return fmt.Errorf("create temporary directory: %s", err)
+		}
+	}
+
+	file := filepath.Join(s.dir, fmt.Sprintf("run%06d.gob", len(s.runs)))
+	s.runs = append(s.runs, file)
+	buf := s.buf
+	s.size = 0
+
+	if s.threads <= 1 {
+		err = s.writeRun(file, buf)
+		for i := range buf {
+			buf[i] = nil
+		}
+		s.buf = buf[:0]
+		return err
+	}
+
+	s.buf = make([]*KeyedRecord, 0, cap(buf))
+	s.tokens <- struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			s.wg.Done()
+			<-s.tokens
+		}()
+		if err := s.writeRun(file, buf); err != nil {
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = err
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	s.mu.Lock()
+	err = s.err
+	s.mu.Unlock()
+	return err
+}
+
+// writeRun sorts records and writes them to a file.
+func (s *RecordSorter) writeRun(file string, buf []*KeyedRecord) error {
+	s.sortBuffer(buf)
+
+	fh, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("create temporary file: %s", err)
+	}
+	w := bufio.NewWriterSize(fh, 1<<16)
+	var zw io.WriteCloser = nopWriteCloser{w}
+	if s.compress != "" {
+		if zw, err = newCompressWriter(w, s.compress, -1); err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	enc := gob.NewEncoder(zw)
+	for _, r := range buf {
+		if err = enc.Encode(r); err != nil {
+			fh.Close()
+			return fmt.Errorf("write temporary file %s: %s", file, err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		fh.Close()
+		return fmt.Errorf("write temporary file %s: %s", file, err)
+	}
+	if err = w.Flush(); err != nil {
+		fh.Close()
+		return fmt.Errorf("write temporary file %s: %s", file, err)
+	}
+	if err = fh.Close(); err != nil {
+		return fmt.Errorf("write temporary file %s: %s", file, err)
+	}
+	return nil
+}
+
+// Sort returns an iterator of sorted records. No records should be added after calling it.
+func (s *RecordSorter) Sort() (*SortedRecords, error) {
+	if len(s.runs) == 0 { // all in memory
+		s.sortBuffer(s.buf)
+		return &SortedRecords{buf: s.buf}, nil
+	}
+
+	if err := s.spill(); err != nil {
+		return nil, err
+	}
+	s.wg.Wait()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	h := make(runHeap, 0, len(s.runs))
+	var fh *os.File
+	var err error
+	for i, file := range s.runs {
+		fh, err = os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("open temporary file: %s", err)
+		}
+		s.files = append(s.files, fh)
+
+		r, err := newDecompressReader(bufio.NewReaderSize(fh, 1<<16), s.compress)
+		if err != nil {
+			return nil, fmt.Errorf("read temporary file %s: %s", file, err)
+		}
+		run := &runReader{idx: i, dec: gob.NewDecoder(r)}
+		ok, err := run.next()
+		if err != nil {
+			return nil, fmt.Errorf("read temporary file %s: %s", file, err)
+		}
+		if ok {
+			h = append(h, run)
+		}
+	}
+	h2 := &runHeap2{runHeap: h, less: s.less}
+	heap.Init(h2)
+
+	return &SortedRecords{heap: h2}, nil
+}
+
+// NumRuns returns the number of temporary files.
+func (s *RecordSorter) NumRuns() int {
+	return len(s.runs)
+}
+
+// Close removes all temporary files.
+func (s *RecordSorter) Close() error {
+	s.wg.Wait()
+	for _, fh := range s.files {
+		fh.Close()
+	}
+	s.files = nil
+	s.buf = nil
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	return err
+}
+
+// SortedRecords is an iterator of sorted records.
+type SortedRecords struct {
+	buf []*KeyedRecord // records sorted in memory
+	i   int
+
+	heap *runHeap2 // or merging runs
+}
+
+// Next returns the next record, and io.EOF is returned at the end.
+func (it *SortedRecords) Next() (*KeyedRecord, error) {
+	if it.heap == nil {
+		if it.i >= len(it.buf) {
+			return nil, io.EOF
+		}
+		r := it.buf[it.i]
+		it.buf[it.i] = nil
+		it.i++
+		return r, nil
+	}
+
+	if it.heap.Len() == 0 {
+		return nil, io.EOF
+	}
+	run := it.heap.runHeap[0]
+	r := run.cur
+	ok, err := run.next()
+	if err != nil {
+		return nil, fmt.Errorf("read temporary file: %s", err)
+	}
+	if ok {
+		heap.Fix(it.heap, 0)
+	} else {
+		heap.Pop(it.heap)
+	}
+	return r, nil
+}
+
+type runReader struct {
+	idx int
+	dec *gob.Decoder
+	cur *KeyedRecord
+}
+
+func (r *runReader) next() (bool, error) {
+	rec := &KeyedRecord{}
+	if err := r.dec.Decode(rec); err != nil {
+		if err == io.EOF {
+			r.cur = nil
+			return false, nil
+		}
+		return false, err
+	}
+	r.cur = rec
+	return true, nil
+}
+
+type runHeap []*runReader
+
+type runHeap2 struct {
+	runHeap
+	less func(a, b *KeyedRecord) bool
+}
+
+func (h runHeap2) Len() int      { return len(h.runHeap) }
+func (h runHeap2) Swap(i, j int) { h.runHeap[i], h.runHeap[j] = h.runHeap[j], h.runHeap[i] }
+func (h runHeap2) Less(i, j int) bool {
+	a, b := h.runHeap[i], h.runHeap[j]
+	if h.less(a.cur, b.cur) {
+		return true
+	}
+	if h.less(b.cur, a.cur) {
+		return false
+	}
+	return a.idx < b.idx // keep the input order
+}
+func (h *runHeap2) Push(x interface{}) { h.runHeap = append(h.runHeap, x.(*runReader)) }
+func (h *runHeap2) Pop() interface{} {
+	old := h.runHeap
+	n := len(old)
+	x := old[n-1]
+	h.runHeap = old[0 : n-1]
+	return x
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestRecordSorter(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "csvtk-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s\n", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	n := 1000
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%03d", rand.Intn(100))
+	}
+
+	for _, opt := range []struct {
+		bufSize  int64
+		threads  int
+		compress string
+	}{
+		{1, 1, ""}, {1000, 1, ""}, {1 << 30, 1, ""},
+		{1000, 4, ""}, {1000, 1, "gzip"}, {1000, 4, "lz4"},
+	} {
+		bufSize := opt.bufSize
+		s := NewRecordSorter(tmpDir, bufSize, nil)
+		s.SetThreads(opt.threads)
+		if err = s.SetCompression(opt.compress); err != nil {
+			t.Fatalf("failed to set compression: %s\n", err)
+		}
+		for i, key := range keys {
+			if err = s.Add(&KeyedRecord{Key: key, Record: []string{key, fmt.Sprintf("%d", i)}}); err != nil {
+				t.Fatalf("failed to add record: %s\n", err)
+			}
+		}
+		if bufSize == 1 && s.NumRuns() != n {
+			t.Errorf("number of runs: want %d, got %d\n", n, s.NumRuns())
+		}
+
+		it, err := s.Sort()
+		if err != nil {
+			t.Fatalf("failed to sort records: %s\n", err)
+		}
+
+		expect := make([]int, n)
+		for i := range expect {
+			expect[i] = i
+		}
+		sort.SliceStable(expect, func(i, j int) bool { return keys[expect[i]] < keys[expect[j]] })
+
+		var r *KeyedRecord
+		for i := 0; ; i++ {
+			r, err = it.Next()
+			if err == io.EOF {
+				if i != n {
+					t.Errorf("number of records: want %d, got %d\n", n, i)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read record: %s\n", err)
+			}
+			if r.Record[1] != fmt.Sprintf("%d", expect[i]) {
+				t.Fatalf("buffer size %d: %d-th record: want %d, got %s\n", bufSize, i, expect[i], r.Record[1])
+			}
+		}
+
+		if err = s.Close(); err != nil {
+			t.Errorf("failed to remove temporary files: %s\n", err)
+		}
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("temporary files not removed: %d left\n", len(entries))
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// fillCmd represents the fill command
+var fillCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "fill",
+	Short: "fill empty cells by forward/backward filling, a constant, or the mean/median",
+	Long: `fill empty cells by forward/backward filling, a constant, or the mean/median
+
+Methods (-m/--method):
+
+  forward/ffill    fill with the last non-empty value above
+  backward/bfill   fill with the next non-empty value below
+  value            fill with a constant given by -v/--value
+  mean             fill with the mean of numeric values of the column
+  median           fill with the median of numeric values of the column
+
+Values are filled within groups if -g/--groups is given.
+Cells are treated as empty if they are empty strings or values given
+by -n/--na-values, e.g., -n NA,N/A.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		groupsStr := getFlagString(cmd, "groups")
+		method := strings.ToLower(getFlagString(cmd, "method"))
+		switch method {
+		case "ffill":
+			method = "forward"
+		case "bfill":
+			method = "backward"
+		case "forward", "backward", "mean", "median":
+		case "value":
+			if !cmd.Flags().Changed("value") {
+				checkError(fmt.Errorf("flag -v/--value needed for method: value"))
+			}
+		default:
+			checkError(fmt.Errorf("invalid method: %s. available: forward/ffill, backward/bfill, value, mean, median", method))
+		}
+		value := getFlagString(cmd, "value")
+		limit := getFlagNonNegativeInt(cmd, "limit")
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+
+		naValues := map[string]struct{}{"": {}}
+		for _, s := range getFlagStringSlice(cmd, "na-values") {
+			naValues[s] = struct{}{}
+		}
+		isNA := func(s string) bool {
+			_, ok := naValues[s]
+			return ok
+		}
+
+		file := files[0]
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+		if header == nil {
+			return
+		}
+
+		var fields []int
+		if fieldStr == "" {
+			fields = make([]int, len(header))
+			for i := range fields {
+				fields[i] = i + 1
+			}
+		} else {
+			fields = selectFieldsByHeader(header, fieldStr, fuzzyFields)
+		}
+		var groupFields []int
+		if groupsStr != "" {
+			groupFields = selectFieldsByHeader(header, groupsStr, false)
+		}
+
+		// rows of groups
+		groups := make(map[string][]int, 8)
+		groupsOrder := make([]string, 0, 8)
+		groupKey := make([]string, len(groupFields))
+		for r, record := range data {
+			for i, f := range groupFields {
+				groupKey[i] = record[f-1]
+			}
+			key := strings.Join(groupKey, "_shenwei356_")
+			if _, ok := groups[key]; !ok {
+				groupsOrder = append(groupsOrder, key)
+			}
+			groups[key] = append(groups[key], r)
+		}
+
+		var nums []float64
+		for _, key := range groupsOrder {
+			rows := groups[key]
+			for _, f := range fields {
+				c := f - 1
+				switch method {
+				case "value":
+					for _, r := range rows {
+						if isNA(data[r][c]) {
+							data[r][c] = value
+						}
+					}
+				case "forward", "backward":
+					var last string
+					var has bool
+					var n int
+					for k := range rows {
+						r := rows[k]
+						if method == "backward" {
+							r = rows[len(rows)-1-k]
+						}
+						if !isNA(data[r][c]) {
+							last, has, n = data[r][c], true, 0
+							continue
+						}
+						if has && (limit == 0 || n < limit) {
+							data[r][c] = last
+							n++
+						}
+					}
+				case "mean", "median":
+					nums = nums[:0]
+					for _, r := range rows {
+						v := data[r][c]
+						if isNA(v) {
+							continue
+						}
+						if !reDigitals.MatchString(v) {
+							if ignore {
+								continue
+							}
+							checkError(fmt.Errorf("column %s has non-numeric data: %s, you can use flag -i/--ignore-non-numbers to skip these data", header[c], v))
+						}
+						x, err := strconv.ParseFloat(removeComma(v), 64)
+						checkError(err)
+						nums = append(nums, x)
+					}
+					if len(nums) == 0 {
+						continue
+					}
+					var fill string
+					if method == "mean" {
+						fill = fmt.Sprintf(decimalFormat, allStats["mean"](nums))
+					} else {
+						sort.Float64s(nums)
+						fill = fmt.Sprintf(decimalFormat, median(nums))
+					}
+					for _, r := range rows {
+						if isNA(data[r][c]) {
+							data[r][c] = fill
+						}
+					}
+				}
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if !config.NoHeaderRow && !config.NoOutHeader {
+			checkError(writer.Write(header))
+		}
+		for _, record := range data {
+			checkError(writer.Write(record))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(fillCmd)
+	fillCmd.Flags().StringP("fields", "f", "", `fields to fill. e.g -f 1,2 or -f columnA,columnB (default: all fields)`)
+	fillCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	fillCmd.Flags().StringP("groups", "g", "", `fill within groups via fields. e.g -g 1,2 or -g columnA,columnB`)
+	fillCmd.Flags().StringP("method", "m", "forward", `fill method: forward/ffill, backward/bfill, value, mean, median`)
+	fillCmd.Flags().StringP("value", "v", "", `constant value for the method "value"`)
+	fillCmd.Flags().StringSliceP("na-values", "n", []string{}, `values treated as empty besides empty strings, e.g., -n NA,N/A`)
+	fillCmd.Flags().IntP("limit", "", 0, `fill at most N consecutive empty cells for forward/backward filling, 0 for no limit`)
+	fillCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore non-numeric values for the mean/median`)
+	fillCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+}
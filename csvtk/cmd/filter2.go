@@ -21,8 +21,9 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"runtime"
 	"sort"
@@ -72,6 +73,61 @@ Custom functions:
   - len(), length of strings, e.g., len($1), len($a), len($1, $2)
   - ulen(), length of unicode strings/width of unicode strings rendered
     to a terminal, e.g., len("沈伟")==6, ulen("沈伟")==4
+  - convert(), convert units of length, mass, temperature, data sizes and
+    durations, e.g., convert($weight, 'lb', 'kg'). See "csvtk convert -h"
+  - if(cond, a, b), a if cond is true, otherwise b
+  - case(cond1, a, cond2, b, ..., default), value of the first true condition,
+    or default (null if not given)
+  - coalesce(a, b, ...), the first non-null value
+  - is_null(a), whether a is null
+  - nullif(a, b), null if a equals b, otherwise a
+  - div(a, b[, default]), safe division, default (null if not given) is
+    returned if b is zero or any of them is null or not a number
+
+Row-context functions:
+  - rownum(), row number, the header row not counted
+  - lag($a[, n]), value of column "a" of the n-th previous row (n=1 by default),
+    empty for the first n rows
+  - lead($a[, n]), value of column "a" of the n-th next row (n=1 by default),
+    empty for the last n rows
+  - groupidx($a), index of the row among rows with the same value of column "a",
+    starting from 1
+  These functions are computed from the input rows before filtering, e.g.,
+    csvtk filter2 -f '$price != coalesce(lag($price), $price)' for change points
+
+Aggregate functions:
+  - count(), sum(), mean(), std(), var(), min(), max(), median(), q1(), q3(),
+    and percentiles pN(), e.g., p95($a), of numeric values of a column,
+    where values that are not numbers are skipped. e.g.,
+    csvtk filter2 -f '$score > mean($score) + 2 * std($score)'
+  - They are computed in an extra pass of the file before filtering, and data
+    from stdin are saved in a temporary file.
+  - With --approx, they are estimated in one pass. The first --approx-rows
+    rows are buffered and evaluated with the aggregates of all of them, so
+    results are exact for inputs with no more rows. Later rows are evaluated
+    with running aggregates of all rows read so far, the current row
+    included, which might differ from the ones of the whole file, e.g., for
+    sorted data. Quantiles are estimated with t-digest.
+
+Null values:
+  - Empty cells are passed as empty strings (''), or nulls if the null
+    coalescence operator "??" is used. The functions above treat both of
+    them as nulls. Empty strings can not be compared with numbers, use
+    coalesce() to give a default value, e.g., coalesce($a, 0) > 6.
+  - Columns not existing in the header row are reported as errors.
+  - Null results are treated as false.
+
+User-defined functions (--udf):
+  Top-level functions in Starlark (a Python dialect) files are available
+  in expressions, e.g., normalize_sample_id($id). Numbers, strings,
+  booleans and None are converted between govaluate and Starlark.
+  Functions with names starting with "_" are private. See:
+
+    https://github.com/google/starlark-go/blob/master/doc/spec.md
+
+  # funcs.star
+  def normalize_sample_id(x):
+      return x.strip().upper().replace("-", "_")
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -157,25 +213,38 @@ Custom functions:
 			}
 		}
 
+		// functions added after the check above accept numbers as they are
+		for f, fn := range exprFunctions {
+			functions[f] = fn
+		}
+		containExprFuncs := reExprFunctions.MatchString(filterStr)
+
+		udfs, err := loadStarlarkUDFs(getFlagStringSlice(cmd, "udf"))
+		checkError(err)
+		for f, fn := range udfs {
+			if _, ok := functions[f]; ok {
+				checkError(fmt.Errorf("UDF conflicts with built-in function: %s", f))
+			}
+			functions[f] = fn
+		}
+
 		// -----------------------------------
 
 		hasNullCoalescence := reNullCoalescence.MatchString(filterStr)
 
-		var quote string
 		filterStr0 := filterStr
+		filterStr, rowCtx, err := parseRowContext(filterStr, true)
+		checkError(err)
+
 		filterStr = reFiler2VarSymbolStartsWithDigits.ReplaceAllString(filterStr, "shenwei_$1$2")
 		filterStr = reFilter2VarField.ReplaceAllString(filterStr, "shenwei$1")
 		// filterStr = reFilter2VarSymbol.ReplaceAllString(filterStr, "")
 
-		var filterStr1 string
-		var expression *govaluate.EvaluableExpression
-		var err error
-
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -192,7 +261,28 @@ Custom functions:
 
 		showRowNumber := printLineNumber || config.ShowRowNumber
 
+		approx := getFlagBool(cmd, "approx")
+		approxRows := getFlagPositiveInt(cmd, "approx-rows")
+
 		for _, file := range files {
+			if rowCtx != nil && rowCtx.hasAggregates() {
+				if approx {
+					rowCtx.initAggregates(true)
+					rowCtx.warmup = approxRows
+				} else {
+					if isStdin(file) { // it would be read twice
+						file, err = spoolStdin()
+						checkError(err)
+						defer os.Remove(file)
+					}
+					filterStr, err = rowCtx.precompute(config, file, filterStr, hasNullCoalescence)
+					checkError(err)
+					if len(rowCtx.calls) == 0 {
+						rowCtx = nil
+					}
+				}
+			}
+
 			csvReader, err := newCSVReaderByConfig(config, file)
 
 			if err != nil {
@@ -214,193 +304,195 @@ Custom functions:
 				DoNotAllowDuplicatedColumnName: true,
 			})
 
-			var parameters map[string]string
-			var parameters2 map[string]interface{}
-
-			var flag bool
-			var col string
-			var fieldTmp int
-			var value string
-			var result interface{}
-			var N int64
-			var i int
-			var ok bool
-			var valueFloat float64
 			var colnames2fileds map[string][]int // column name -> []field
 			var colnamesMap map[string]*regexp.Regexp
 
-			var selectWithColnames bool
-
-			keys := make([]string, 0, 8)
+			writeHeader := func(record Record) { // do not replace head line
+				colnames2fileds = make(map[string][]int, len(record.Selected))
+				colnamesMap = make(map[string]*regexp.Regexp, len(record.Selected))
+				for i, col := range record.Selected {
+					if _, ok := colnames2fileds[col]; !ok {
+						colnames2fileds[col] = []int{record.Fields[i]}
+					} else {
+						colnames2fileds[col] = append(colnames2fileds[col], record.Fields[i])
+					}
+					colnamesMap[col] = fuzzyField2Regexp(col)
+				}
 
-			checkFirstLine := true
-			for record := range csvReader.Ch {
-				if record.Err != nil {
-					checkError(record.Err)
+				if config.NoOutHeader {
+					return
 				}
+				if showRowNumber {
+					unshift(&record.All, "row")
+				}
+				checkError(writer.Write(record.All))
+			}
 
-				if checkFirstLine {
-					checkFirstLine = false
+			filter := func() func(*Record) bool {
+				parameters := make(map[string]string, 8)
+				parameters2 := map[string]interface{}{"shenweiNULL": nil}
+
+				var flag bool
+				var col string
+				var fieldTmp int
+				var value string
+				var result interface{}
+				var valueFloat float64
+				var selectWithColnames bool
+				var filterStr1 string
+				var expression *govaluate.EvaluableExpression
+				var quote string
+				var err error
+				keys := make([]string, 0, 8)
+
+				return func(record *Record) bool {
+					if rowCtx != nil && record.Err == nil {
+						for i, v := range rowCtx.values(record) {
+							parameters[rowCtx.calls[i].placeholder] = exprValue(v, digitsAsString || containCustomFuncs, hasNullCoalescence)
+						}
+					}
 
+					// prepaire parameters
 					selectWithColnames = record.SelectWithColnames
-
-					parameters = make(map[string]string, len(record.All))
-					parameters2 = make(map[string]interface{}, len(record.All))
-					parameters2["shenweiNULL"] = nil
-
-					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
-						colnames2fileds = make(map[string][]int, len(record.Selected))
-
-						colnamesMap = make(map[string]*regexp.Regexp, len(record.Selected))
-						for i, col = range record.Selected {
-							if _, ok = colnames2fileds[col]; !ok {
-								colnames2fileds[col] = []int{record.Fields[i]}
+					if !selectWithColnames {
+						for _, fieldTmp = range record.Fields {
+							value = record.All[fieldTmp-1]
+							col = strconv.Itoa(fieldTmp)
+							if varType[col] == 1 {
+								col = "${" + col + "}"
 							} else {
-								colnames2fileds[col] = append(colnames2fileds[col], record.Fields[i])
+								col = fmt.Sprintf("shenwei%d", fieldTmp)
 							}
-							colnamesMap[col] = fuzzyField2Regexp(col)
-						}
 
-						if config.NoOutHeader {
-							continue
-						}
-						if showRowNumber {
-							unshift(&record.All, "row")
-						}
-						checkError(writer.Write(record.All))
-						continue
-					}
-				}
-
-				N++
-
-				// prepaire parameters
-				if !selectWithColnames {
-					for _, fieldTmp = range record.Fields {
-						value = record.All[fieldTmp-1]
-						col = strconv.Itoa(fieldTmp)
-						if varType[col] == 1 {
-							col = "${" + col + "}"
-						} else {
-							col = fmt.Sprintf("shenwei%d", fieldTmp)
-						}
+							quote = `'`
 
-						quote = `'`
-
-						if reDigitals.MatchString(value) {
-							if digitsAsString || containCustomFuncs {
-								parameters[col] = quote + value + quote
-							} else {
-								valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
-								parameters[col] = fmt.Sprintf("%.16f", valueFloat)
-							}
-						} else {
-							if value == "" && hasNullCoalescence {
-								parameters[col] = "shenweiNULL"
-							} else {
-								if strings.Contains(value, `'`) {
-									value = strings.ReplaceAll(value, `'`, `\'`)
+							if reDigitals.MatchString(value) {
+								if digitsAsString || containCustomFuncs {
+									parameters[col] = quote + value + quote
+								} else {
+									valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
+									parameters[col] = fmt.Sprintf("%.16f", valueFloat)
 								}
-								if strings.Contains(value, `"`) {
-									value = strings.ReplaceAll(value, `"`, `\"`)
+							} else {
+								if value == "" && hasNullCoalescence {
+									parameters[col] = "shenweiNULL"
+								} else {
+									if strings.Contains(value, `'`) {
+										value = strings.ReplaceAll(value, `'`, `\'`)
+									}
+									if strings.Contains(value, `"`) {
+										value = strings.ReplaceAll(value, `"`, `\"`)
+									}
+
+									parameters[col] = quote + value + quote
 								}
-
-								parameters[col] = quote + value + quote
 							}
 						}
-					}
-				} else {
-					for col = range colnamesMap {
-						value = record.All[colnames2fileds[col][0]-1]
-
-						if reFiler2ColSymbolStartsWithDigits.MatchString(col) {
-							col = fmt.Sprintf("shenwei_%s", col)
-						} else if varType[col] == 1 {
-							col = "${" + col + "}"
-						} else {
-							col = "$" + col
-						}
-
-						quote = `'`
-
-						if reDigitals.MatchString(value) {
-							if digitsAsString || containCustomFuncs {
-								parameters[col] = quote + value + quote
+					} else {
+						for col = range colnamesMap {
+							value = record.All[colnames2fileds[col][0]-1]
+
+							if reFiler2ColSymbolStartsWithDigits.MatchString(col) {
+								col = fmt.Sprintf("shenwei_%s", col)
+							} else if varType[col] == 1 {
+								col = "${" + col + "}"
 							} else {
-								valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
-								parameters[col] = fmt.Sprintf("%.16f", valueFloat)
+								col = "$" + col
 							}
-						} else {
-							if value == "" && hasNullCoalescence {
-								parameters[col] = "shenweiNULL"
-							} else {
-								if strings.Contains(value, `'`) {
-									value = strings.ReplaceAll(value, `'`, `\'`)
+
+							quote = `'`
+
+							if reDigitals.MatchString(value) {
+								if digitsAsString || containCustomFuncs {
+									parameters[col] = quote + value + quote
+								} else {
+									valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
+									parameters[col] = fmt.Sprintf("%.16f", valueFloat)
 								}
-								if strings.Contains(value, `"`) {
-									value = strings.ReplaceAll(value, `"`, `\"`)
+							} else {
+								if value == "" && hasNullCoalescence {
+									parameters[col] = "shenweiNULL"
+								} else {
+									if strings.Contains(value, `'`) {
+										value = strings.ReplaceAll(value, `'`, `\'`)
+									}
+									if strings.Contains(value, `"`) {
+										value = strings.ReplaceAll(value, `"`, `\"`)
+									}
+
+									parameters[col] = quote + value + quote
 								}
-
-								parameters[col] = quote + value + quote
 							}
 						}
 					}
-				}
 
-				// sort variable names by length, so we can replace variables in the right order.
-				// e.g., for -e '$reads_mapped/$reads', we should firstly replace $reads_mapped then $reads.
-				keys = keys[:0]
-				for col = range parameters {
-					keys = append(keys, col)
-				}
-				sort.Slice(keys, func(i, j int) bool {
-					return len(keys[i]) > len(keys[j])
-				})
-
-				// replace variable with column data
-				filterStr1 = filterStr
-				for _, col = range keys {
-					filterStr1 = strings.ReplaceAll(filterStr1, col, parameters[col])
-				}
-
-				// evaluate
-				if containCustomFuncs {
-					expression, err = govaluate.NewEvaluableExpressionWithFunctions(filterStr1, functions)
-				} else {
-					expression, err = govaluate.NewEvaluableExpression(filterStr1)
-				}
-				checkError(err)
+					// sort variable names by length, so we can replace variables in the right order.
+					// e.g., for -e '$reads_mapped/$reads', we should firstly replace $reads_mapped then $reads.
+					keys = keys[:0]
+					for col = range parameters {
+						keys = append(keys, col)
+					}
+					sort.Slice(keys, func(i, j int) bool {
+						return len(keys[i]) > len(keys[j])
+					})
+
+					// replace variable with column data
+					filterStr1 = filterStr
+					for _, col = range keys {
+						filterStr1 = strings.ReplaceAll(filterStr1, col, parameters[col])
+					}
 
-				// check result
-				flag = false
+					// evaluate
+					if containCustomFuncs || containExprFuncs || len(udfs) > 0 {
+						expression, err = govaluate.NewEvaluableExpressionWithFunctions(filterStr1, functions)
+					} else {
+						expression, err = govaluate.NewEvaluableExpression(filterStr1)
+					}
+					checkError(err)
 
-				if hasNullCoalescence {
-					result, err = expression.Evaluate(parameters2)
-				} else {
-					result, err = expression.Evaluate(emptyParams)
-				}
-				if err != nil {
+					// check result
 					flag = false
-					if config.Verbose {
-						log.Warningf("row %d: %s", N, err)
+
+					if hasNullCoalescence {
+						result, err = expression.Evaluate(parameters2)
+					} else {
+						result, err = expression.Evaluate(emptyParams)
 					}
-					continue
-				}
-				switch result.(type) {
-				case bool:
-					if result.(bool) {
-						flag = true
+					if err != nil {
+						flag = false
+						if config.Verbose {
+							log.Warningf("row %d: %s", record.Row, err)
+						}
+						return false
+					}
+					switch result.(type) {
+					case bool:
+						if result.(bool) {
+							flag = true
+						}
+					case nil:
+					default:
+						checkError(fmt.Errorf("filter is not boolean expression: %s", filterStr0))
 					}
-				default:
-					checkError(fmt.Errorf("filter is not boolean expression: %s", filterStr0))
-				}
 
-				if !flag {
-					continue
+					if !flag {
+						return false
+					}
+					if showRowNumber {
+						unshift(&record.All, strconv.Itoa(record.Row))
+					}
+					return true
 				}
+			}
 
-				if showRowNumber {
-					unshift(&record.All, strconv.Itoa(record.Row))
+			ch := csvReader.Ch
+			if rowCtx != nil {
+				ch = rowCtx.records(ch, config.NoHeaderRow)
+			}
+
+			for record := range parallelRecords(ch, config.NumCPUs, config.NoHeaderRow, writeHeader, filter) {
+				if record.Err != nil {
+					checkError(record.Err)
 				}
 				checkError(writer.Write(record.All))
 			}
@@ -415,6 +507,9 @@ func init() {
 	filter2Cmd.Flags().StringP("filter", "f", "", `awk-like filter condition. e.g. '$age>12' or '$1 > $3' or '$name=="abc"' or '$1 % 2 == 0'`)
 	filter2Cmd.Flags().BoolP("line-number", "n", false, `print line number as the first column ("n")`)
 	filter2Cmd.Flags().BoolP("numeric-as-string", "s", false, `treat even numeric fields as strings to avoid converting big numbers into scientific notation`)
+	filter2Cmd.Flags().StringSliceP("udf", "", []string{}, `Starlark files of user-defined functions, multiple values supported`)
+	filter2Cmd.Flags().BoolP("approx", "", false, `estimate aggregate functions in one pass, instead of an extra pass of the file`)
+	filter2Cmd.Flags().IntP("approx-rows", "", 10000, `number of the first rows buffered for estimating aggregate functions with --approx`)
 }
 
 var reFilter2 = regexp.MustCompile(`\$\{([^}]+?)\}|\$([^ +-/*&\|^%><!~=()"']+)`)
@@ -426,3 +521,17 @@ var reFilter2VarField = regexp.MustCompile(`\$(\d+)`)
 // special colname starting with digits, e.g., 123abc
 var reFiler2VarSymbolStartsWithDigits = regexp.MustCompile(`\$(\d+)([^\d +-/*&\|^%><!~=()"']+)`) // for preprocess expression
 var reFiler2ColSymbolStartsWithDigits = regexp.MustCompile(`^(\d+)([^\d +-/*&\|^%><!~=()"']+)`)  // for preparing paramters
+
+// spoolStdin saves data from stdin to a temporary file, for reading it more than once.
+func spoolStdin() (string, error) {
+	fh, err := os.CreateTemp("", "csvtk-stdin-")
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	if _, err = io.Copy(fh, os.Stdin); err != nil {
+		os.Remove(fh.Name())
+		return "", err
+	}
+	return fh.Name(), nil
+}
@@ -27,7 +27,6 @@ import (
 	"regexp"
 	"runtime"
 
-	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 )
 
@@ -85,11 +84,11 @@ Limitation:
 		}
 		_buf := make([]byte, bufferSize)
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		fh, err := xopen.Ropen(files[0])
+		fh, err := ropen(files[0])
 		checkError(err)
 		defer func() {
 			checkError(fh.Close())
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"runtime"
 	"time"
@@ -104,11 +103,11 @@ Placeholders:
 
 		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -141,34 +140,31 @@ Placeholders:
 				FuzzyFields: fuzzyFields,
 			})
 
-			checkFirstLine := true
-			var f int
-			for record := range csvReader.Ch {
-				if record.Err != nil {
-					checkError(record.Err)
-				}
-
-				if checkFirstLine {
-					checkFirstLine = false
-
-					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
-						if config.NoOutHeader {
-							continue
+			format := func() func(*Record) bool {
+				return func(record *Record) bool {
+					for _, f := range record.Fields {
+						t, err := dateparse.ParseLocal(record.All[f-1])
+						if err != nil {
+							if !keepUnparsed {
+								record.All[f-1] = ""
+							}
+						} else {
+							record.All[f-1] = fmtdate.Format(outfmt, t)
 						}
-						checkError(writer.Write(record.All))
-						continue
 					}
+					return true
 				}
+			}
 
-				for _, f = range record.Fields {
-					t, err := dateparse.ParseLocal(record.All[f-1])
-					if err != nil {
-						if !keepUnparsed {
-							record.All[f-1] = ""
-						}
-					} else {
-						record.All[f-1] = fmtdate.Format(outfmt, t)
-					}
+			writeHeader := func(record Record) { // do not replace head line
+				if !config.NoOutHeader {
+					checkError(writer.Write(record.All))
+				}
+			}
+
+			for record := range parallelRecords(csvReader.Ch, config.NumCPUs, config.NoHeaderRow, writeHeader, format) {
+				if record.Err != nil {
+					checkError(record.Err)
 				}
 				checkError(writer.Write(record.All))
 			}
@@ -21,8 +21,8 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
+	"math"
 	"runtime"
 	"sort"
 	"strconv"
@@ -31,6 +31,7 @@ import (
 	"github.com/shenwei356/util/stringutil"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"gonum.org/v1/gonum/floats"
 )
 
 // freqCmd represents the freq command
@@ -41,6 +42,31 @@ var freqCmd = &cobra.Command{
 	Short: "frequencies of selected fields",
 	Long: `frequencies of selected fields
 
+Numeric binning (for a single numeric field):
+  -b/--bins N|auto    N equal-width bins between the minimum and maximum,
+                      "auto" for the number of bins by Sturges' rule
+  -B/--breaks LIST    explicit breakpoints, e.g., 0,10,50,100
+
+  Bins are left-closed intervals like "[0,10)" by default, or right-closed
+  like "(0,10]" with --right-closed, and are output in order, including
+  empty ones. Non-numeric values and values out of the breakpoints are
+  skipped.
+
+Long tail of keys:
+  --top N             only output the N most frequent keys, in descending
+                      order of frequency, or sorted by key with -k
+  --other             collapse the rest keys into an "other" bucket
+
+Extra columns:
+  -c/--cumulative     cumulative counts
+  -p/--percent        percentages (and cumulative percentages with -c)
+  --bar               ASCII bars scaled to --bar-width
+
+Examples:
+
+    csvtk freq -f age -b auto -c -p --bar data.csv
+    csvtk freq -f city --top 10 --other -p data.csv
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -61,11 +87,59 @@ var freqCmd = &cobra.Command{
 
 		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		binsStr := getFlagString(cmd, "bins")
+		breaksStr := getFlagStringSlice(cmd, "breaks")
+		rightClosed := getFlagBool(cmd, "right-closed")
+		top := getFlagNonNegativeInt(cmd, "top")
+		other := getFlagBool(cmd, "other")
+		cumulative := getFlagBool(cmd, "cumulative")
+		percent := getFlagBool(cmd, "percent")
+		bar := getFlagBool(cmd, "bar")
+		barWidth := getFlagPositiveInt(cmd, "bar-width")
+		decimalWidth := getFlagNonNegativeInt(cmd, "decimal-width")
+		decimalFormat := fmt.Sprintf("%%.%df", decimalWidth)
+
+		var nBins int
+		var err error
+		var breaks []float64
+		if binsStr != "" && len(breaksStr) > 0 {
+			checkError(fmt.Errorf("flag -b/--bins and -B/--breaks are exclusive"))
+		}
+		if binsStr != "" && binsStr != "auto" {
+			nBins, err = strconv.Atoi(binsStr)
+			if err != nil || nBins <= 0 {
+				checkError(fmt.Errorf(`value of flag -b/--bins should be a positive integer or "auto": %s`, binsStr))
+			}
+		}
+		if len(breaksStr) > 0 {
+			if len(breaksStr) < 2 {
+				checkError(fmt.Errorf("at least two breakpoints needed: %s", breaksStr))
+			}
+			breaks = make([]float64, len(breaksStr))
+			for i, s := range breaksStr {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					checkError(fmt.Errorf("invalid breakpoint: %s", s))
+				}
+				if i > 0 && v <= breaks[i-1] {
+					checkError(fmt.Errorf("breakpoints should be in ascending order: %s", breaksStr))
+				}
+				breaks[i] = v
+			}
+		}
+		binning := binsStr != "" || breaks != nil
+		if binning && top > 0 {
+			checkError(fmt.Errorf("flag --top is not supported for numeric binning"))
+		}
+		if other && top == 0 {
+			checkError(fmt.Errorf("flag --other needs --top"))
+		}
+
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -109,6 +183,9 @@ var freqCmd = &cobra.Command{
 
 		var key string
 		var N int
+		var header []string
+		var values []float64 // for numeric binning
+		var nSkipped int
 
 		checkFirstLine := true
 		for record := range csvReader.Ch {
@@ -118,71 +195,222 @@ var freqCmd = &cobra.Command{
 
 			if checkFirstLine {
 				checkFirstLine = false
+				if binning && len(record.Selected) != 1 {
+					checkError(fmt.Errorf("only one field allowed for numeric binning"))
+				}
 				if !config.NoHeaderRow || record.IsHeaderRow {
-					if config.NoOutHeader {
-						continue
-					}
-					checkError(writer.Write(append(record.Selected, "frequency")))
+					header = record.Selected
 					continue
 				}
 			}
 
 			N++
 
+			if binning {
+				if !reDigitals.MatchString(record.Selected[0]) {
+					nSkipped++
+					continue
+				}
+				v, err := strconv.ParseFloat(removeComma(record.Selected[0]), 64)
+				checkError(err)
+				values = append(values, v)
+				continue
+			}
+
 			key = strings.Join(record.Selected, "_shenwei356_")
 			counter[key]++
 			orders[key] = N
 		}
 
-		var items []string
-		if sortByFreq {
-			counts := make([]stringutil.StringCount, len(counter))
-			i := 0
-			for key, count := range counter {
-				counts[i] = stringutil.StringCount{Key: key, Count: count}
-				i++
-			}
-			if reverse {
-				sort.Sort(stringutil.ReversedStringCountList{counts})
-			} else {
-				sort.Sort(stringutil.StringCountList(counts))
+		readerReport(&config, csvReader, file)
+
+		if header != nil && !config.NoOutHeader {
+			header = append(header, "frequency")
+			if cumulative {
+				header = append(header, "cumulative")
 			}
-			for _, count := range counts {
-				items = strings.Split(count.Key, "_shenwei356_")
-				items = append(items, strconv.Itoa(counter[count.Key]))
-				checkError(writer.Write(items))
+			if percent {
+				header = append(header, "percentage")
+				if cumulative {
+					header = append(header, "cumulative_percentage")
+				}
 			}
-		} else if sortByKey {
-			keys := make([]string, len(counter))
-			i := 0
-			for key := range counter {
-				keys[i] = key
-				i++
+			if bar {
+				header = append(header, "bar")
 			}
+			checkError(writer.Write(header))
+		}
 
-			sort.Strings(keys)
-			if reverse {
-				stringutil.ReverseStringSliceInplace(keys)
+		var rows []freqRow
+		if binning {
+			rows, nSkipped = freqBins(values, nBins, breaks, rightClosed, decimalWidth, nSkipped)
+			if nSkipped > 0 && config.Verbose {
+				log.Warningf("csvtk freq: %d non-numeric values or values out of breakpoints skipped", nSkipped)
 			}
-
-			for _, key := range keys {
-				items = strings.Split(key, "_shenwei356_")
-				items = append(items, strconv.Itoa(counter[key]))
-				checkError(writer.Write(items))
+		} else if top > 0 {
+			rows = freqRows(counter, orders, true, false, true) // in descending order
+			if len(rows) > top {
+				var n int
+				for _, row := range rows[top:] {
+					n += row.count
+				}
+				rows = rows[:top]
+				if other {
+					keys := make([]string, len(rows[0].keys))
+					keys[0] = "other"
+					rows = append(rows, freqRow{keys, n})
+				}
+			}
+			kept := rows // without the "other" bucket
+			if len(kept) > top {
+				kept = kept[:top]
+			}
+			if sortByKey {
+				sort.SliceStable(kept, func(i, j int) bool {
+					if reverse {
+						return strings.Join(kept[i].keys, "_shenwei356_") > strings.Join(kept[j].keys, "_shenwei356_")
+					}
+					return strings.Join(kept[i].keys, "_shenwei356_") < strings.Join(kept[j].keys, "_shenwei356_")
+				})
+			} else if reverse {
+				for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+					kept[i], kept[j] = kept[j], kept[i]
+				}
 			}
 		} else {
-			orderedKey := stringutil.SortCountOfString(orders, false)
-			for _, o := range orderedKey {
-				items = strings.Split(o.Key, "_shenwei356_")
-				items = append(items, strconv.Itoa(counter[o.Key]))
-				checkError(writer.Write(items))
+			rows = freqRows(counter, orders, sortByFreq, sortByKey, reverse)
+		}
+
+		var maxCount int
+		for _, row := range rows {
+			if row.count > maxCount {
+				maxCount = row.count
 			}
 		}
 
-		readerReport(&config, csvReader, file)
+		var cum int
+		var items []string
+		for _, row := range rows {
+			cum += row.count
+			items = append(row.keys, strconv.Itoa(row.count))
+			if cumulative {
+				items = append(items, strconv.Itoa(cum))
+			}
+			if percent {
+				items = append(items, fmt.Sprintf(decimalFormat, freqPercent(row.count, N)))
+				if cumulative {
+					items = append(items, fmt.Sprintf(decimalFormat, freqPercent(cum, N)))
+				}
+			}
+			if bar {
+				items = append(items, freqBar(row.count, maxCount, barWidth))
+			}
+			checkError(writer.Write(items))
+		}
 	},
 }
 
+// freqRow is a key (or a bin) and its frequency.
+type freqRow struct {
+	keys  []string
+	count int
+}
+
+// freqRows returns rows sorted by frequency, by key, or by the orders of keys.
+func freqRows(counter map[string]int, orders map[string]int, sortByFreq bool, sortByKey bool, reverse bool) []freqRow {
+	rows := make([]freqRow, 0, len(counter))
+	if sortByFreq {
+		counts := make([]stringutil.StringCount, len(counter))
+		i := 0
+		for key, count := range counter {
+			counts[i] = stringutil.StringCount{Key: key, Count: count}
+			i++
+		}
+		if reverse {
+			sort.Sort(stringutil.ReversedStringCountList{counts})
+		} else {
+			sort.Sort(stringutil.StringCountList(counts))
+		}
+		for _, count := range counts {
+			rows = append(rows, freqRow{strings.Split(count.Key, "_shenwei356_"), counter[count.Key]})
+		}
+	} else if sortByKey {
+		keys := make([]string, len(counter))
+		i := 0
+		for key := range counter {
+			keys[i] = key
+			i++
+		}
+
+		sort.Strings(keys)
+		if reverse {
+			stringutil.ReverseStringSliceInplace(keys)
+		}
+
+		for _, key := range keys {
+			rows = append(rows, freqRow{strings.Split(key, "_shenwei356_"), counter[key]})
+		}
+	} else {
+		orderedKey := stringutil.SortCountOfString(orders, false)
+		for _, o := range orderedKey {
+			rows = append(rows, freqRow{strings.Split(o.Key, "_shenwei356_"), counter[o.Key]})
+		}
+	}
+	return rows
+}
+
+// freqBins counts values in bins, and returns the rows of all bins and
+// the number of skipped values.
+func freqBins(values []float64, nBins int, breaks []float64, rightClosed bool, decimalWidth int, nSkipped int) ([]freqRow, int) {
+	if breaks == nil {
+		if len(values) == 0 {
+			return nil, nSkipped
+		}
+		min, max := floats.Min(values), floats.Max(values)
+		if nBins == 0 { // Sturges' rule
+			nBins = int(math.Ceil(math.Log2(float64(len(values))))) + 1
+		}
+		breaks = equalWidthBreaks(min, max, nBins)
+	}
+
+	counts := make([]int, len(breaks)-1)
+	for _, v := range values {
+		if k := findBin(breaks, v, rightClosed); k >= 0 {
+			counts[k]++
+		} else {
+			nSkipped++
+		}
+	}
+
+	rows := make([]freqRow, len(counts))
+	var a, b string
+	for i, n := range counts {
+		a = formatBreak(breaks[i], decimalWidth)
+		b = formatBreak(breaks[i+1], decimalWidth)
+		if rightClosed {
+			rows[i] = freqRow{[]string{"(" + a + "," + b + "]"}, n}
+		} else {
+			rows[i] = freqRow{[]string{"[" + a + "," + b + ")"}, n}
+		}
+	}
+	return rows, nSkipped
+}
+
+func freqPercent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+// freqBar returns an ASCII bar of n, scaled by max to the width.
+func freqBar(n, max, width int) string {
+	if max == 0 {
+		return ""
+	}
+	return strings.Repeat("#", int(math.Round(float64(n)/float64(max)*float64(width))))
+}
+
 func init() {
 	RootCmd.AddCommand(freqCmd)
 	freqCmd.Flags().StringP("fields", "f", "1", `select these fields as the key. e.g -f 1,2 or -f columnA,columnB`)
@@ -191,4 +419,14 @@ func init() {
 	freqCmd.Flags().BoolP("sort-by-freq", "n", false, `sort by frequency`)
 	freqCmd.Flags().BoolP("sort-by-key", "k", false, `sort by key`)
 	freqCmd.Flags().BoolP("reverse", "r", false, `reverse order while sorting`)
+	freqCmd.Flags().StringP("bins", "b", "", `bin a numeric field into N equal-width bins, or "auto" for Sturges' rule`)
+	freqCmd.Flags().StringSliceP("breaks", "B", []string{}, `bin a numeric field with explicit breakpoints in ascending order, e.g., 0,10,50,100`)
+	freqCmd.Flags().BoolP("right-closed", "", false, `bins are right-closed intervals like "(0,10]"`)
+	freqCmd.Flags().IntP("top", "", 0, `only output the N most frequent keys, 0 for all`)
+	freqCmd.Flags().BoolP("other", "", false, `collapse keys out of --top into an "other" bucket`)
+	freqCmd.Flags().BoolP("cumulative", "c", false, `add a column of cumulative counts`)
+	freqCmd.Flags().BoolP("percent", "p", false, `add a column of percentages`)
+	freqCmd.Flags().BoolP("bar", "", false, `add a column of ASCII bars`)
+	freqCmd.Flags().IntP("bar-width", "", 40, `width of the longest ASCII bar`)
+	freqCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
 }
@@ -0,0 +1,350 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// fwf2csvCmd represents the fwf2csv command
+var fwf2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "fwf2csv",
+	Short: "convert fixed-width format to CSV",
+	Long: `convert fixed-width format to CSV
+
+Column boundaries can be given in three ways:
+
+  1. -w/--widths, widths of all columns, e.g., -w 5,10,3.
+  2. -s/--spec, a column-spec file. Each line defines a column with a name
+     and a 1-based inclusive character range, or a name and a width
+     (the column starts right after the previous one). Fields can be
+     separated by tab, comma or spaces. Blank lines and lines starting
+     with "#" are ignored. E.g.,
+
+        id     1   5
+        name   6  15
+        score  3
+
+  3. Auto-detection (default). The first -n/--buf-lines lines are scanned,
+     and a column starts at every position where a non-blank character
+     follows a position that is blank in all lines.
+
+Notes:
+  1. Positions and widths are counted in characters, not bytes.
+  2. Values are trimmed of leading and trailing spaces unless --no-trim
+     is given.
+  3. The first line is treated as the header row unless -H/--no-header-row
+     is given. Column names in the spec file replace the header row.
+  4. Empty lines and lines starting with the comment char are skipped.
+  5. The header row is only outputted once for multiple files.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		widths := getFlagCommaSeparatedInts(cmd, "widths")
+		specFile := getFlagString(cmd, "spec")
+		bufLines := getFlagNonNegativeInt(cmd, "buf-lines")
+		noTrim := getFlagBool(cmd, "no-trim")
+
+		if len(widths) > 0 && specFile != "" {
+			checkError(fmt.Errorf("flag -w/--widths and -s/--spec are incompatible"))
+		}
+
+		var cols []fwfColumn
+		var err error
+		if len(widths) > 0 {
+			cols, err = fwfColumnsFromWidths(widths)
+			checkError(err)
+		} else if specFile != "" {
+			cols, err = readFWFSpec(specFile)
+			checkError(err)
+		}
+
+		var names []string
+		if len(cols) > 0 && cols[0].Name != "" {
+			names = make([]string, len(cols))
+			for i, c := range cols {
+				names[i] = c.Name
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		var headerWritten bool
+		if names != nil && config.NoHeaderRow {
+			checkError(writer.Write(names))
+			headerWritten = true
+		}
+
+		var buf []string
+		var line string
+		var _cols []fwfColumn
+		var record []string
+		var firstLine bool
+		for _, file := range files {
+			fh, err := ropen(file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk fwf2csv: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			scanner := bufio.NewScanner(fh)
+			scanner.Buffer(make([]byte, 1<<20), 1<<30)
+
+			_cols = cols
+			buf = buf[:0]
+			firstLine = true
+
+			handle := func(line string) {
+				if firstLine {
+					firstLine = false
+					if !config.NoHeaderRow {
+						if !headerWritten {
+							if names != nil {
+								record = names
+							} else {
+								record = splitFWFLine(line, _cols, true)
+							}
+							checkError(writer.Write(record))
+							headerWritten = true
+						}
+						return
+					}
+				}
+				checkError(writer.Write(splitFWFLine(line, _cols, !noTrim)))
+			}
+
+			for scanner.Scan() {
+				line = strings.TrimRight(scanner.Text(), "\r\n")
+				if len(strings.TrimSpace(line)) == 0 || rune(line[0]) == config.CommentChar {
+					continue
+				}
+
+				if _cols == nil { // auto-detection
+					buf = append(buf, line)
+					if bufLines == 0 || len(buf) < bufLines {
+						continue
+					}
+					_cols = detectFWFColumns(buf)
+					for _, line = range buf {
+						handle(line)
+					}
+					buf = buf[:0]
+					continue
+				}
+
+				handle(line)
+			}
+			checkError(scanner.Err())
+
+			if _cols == nil && len(buf) > 0 {
+				_cols = detectFWFColumns(buf)
+				for _, line = range buf {
+					handle(line)
+				}
+			}
+
+			checkError(fh.Close())
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(fwf2csvCmd)
+	fwf2csvCmd.Flags().StringP("widths", "w", "", "widths of all columns, separated by commas, e.g., 5,10,3")
+	fwf2csvCmd.Flags().StringP("spec", "s", "", `column-spec file, type "csvtk fwf2csv -h" for the format`)
+	fwf2csvCmd.Flags().IntP("buf-lines", "n", 1000, "the number of lines to detect column boundaries (0 for all lines)")
+	fwf2csvCmd.Flags().BoolP("no-trim", "", false, "do not trim leading and trailing spaces of values")
+}
+
+// fwfColumn is a column in fixed-width format, with 0-based start
+// (inclusive) and end (exclusive) positions. End < 0 means the end of line.
+type fwfColumn struct {
+	Name       string
+	Start, End int
+}
+
+func fwfColumnsFromWidths(widths []int) ([]fwfColumn, error) {
+	cols := make([]fwfColumn, len(widths))
+	var start int
+	for i, w := range widths {
+		if w <= 0 {
+			return nil, fmt.Errorf("column width should be positive: %d", w)
+		}
+		cols[i] = fwfColumn{Start: start, End: start + w}
+		start += w
+	}
+	return cols, nil
+}
+
+func readFWFSpec(file string) ([]fwfColumn, error) {
+	fh, err := ropen(file)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read column-spec file: %s", err)
+	}
+	defer fh.Close()
+
+	cols := make([]fwfColumn, 0, 8)
+	scanner := bufio.NewScanner(fh)
+	var line string
+	var items []string
+	var start, end, lineNum int
+	var prevEnd int
+	for scanner.Scan() {
+		lineNum++
+		line = strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.Contains(line, "\t") {
+			items = strings.Split(line, "\t")
+		} else if strings.Contains(line, ",") {
+			items = strings.Split(line, ",")
+		} else {
+			items = strings.Fields(line)
+		}
+		for i, item := range items {
+			items[i] = strings.TrimSpace(item)
+		}
+		switch len(items) {
+		case 2:
+			w, err := strconv.Atoi(items[1])
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("column-spec file %s: line %d: invalid width: %s", file, lineNum, items[1])
+			}
+			start, end = prevEnd, prevEnd+w
+		case 3:
+			start, err = strconv.Atoi(items[1])
+			if err != nil || start <= 0 {
+				return nil, fmt.Errorf("column-spec file %s: line %d: invalid start position: %s", file, lineNum, items[1])
+			}
+			end, err = strconv.Atoi(items[2])
+			if err != nil || end < start {
+				return nil, fmt.Errorf("column-spec file %s: line %d: invalid end position: %s", file, lineNum, items[2])
+			}
+			start--
+		default:
+			return nil, fmt.Errorf("column-spec file %s: line %d: two (name, width) or three (name, start, end) fields expected: %s", file, lineNum, line)
+		}
+		cols = append(cols, fwfColumn{Name: items[0], Start: start, End: end})
+		prevEnd = end
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns defined in column-spec file: %s", file)
+	}
+	return cols, nil
+}
+
+// detectFWFColumns finds column boundaries from lines. A column starts
+// where a non-blank character follows a position blank in all lines.
+func detectFWFColumns(lines []string) []fwfColumn {
+	var maxLen int
+	blank := make([]bool, 0, 128)
+	var i int
+	var r rune
+	for _, line := range lines {
+		i = 0
+		for _, r = range line {
+			if i >= maxLen {
+				blank = append(blank, true)
+				maxLen++
+			}
+			if r != ' ' && r != '\t' {
+				blank[i] = false
+			}
+			i++
+		}
+	}
+
+	cols := make([]fwfColumn, 0, 8)
+	for i = 0; i < maxLen; i++ {
+		if blank[i] || (i > 0 && !blank[i-1]) {
+			continue
+		}
+		if len(cols) > 0 {
+			cols[len(cols)-1].End = i
+		}
+		cols = append(cols, fwfColumn{Start: i, End: -1})
+	}
+	if len(cols) == 0 {
+		cols = append(cols, fwfColumn{Start: 0, End: -1})
+	}
+	return cols
+}
+
+func splitFWFLine(line string, cols []fwfColumn, trim bool) []string {
+	runes := []rune(line)
+	n := len(runes)
+	record := make([]string, len(cols))
+	var start, end int
+	for i, c := range cols {
+		start, end = c.Start, c.End
+		if end < 0 || end > n {
+			end = n
+		}
+		if start >= n || start >= end {
+			continue
+		}
+		if trim {
+			record[i] = strings.TrimSpace(string(runes[start:end]))
+		} else {
+			record[i] = string(runes[start:end])
+		}
+	}
+	return record
+}
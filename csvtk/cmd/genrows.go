@@ -0,0 +1,532 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"gitlab.com/metakeule/fmtdate"
+)
+
+// genrowsCmd represents the genrows command
+var genrowsCmd = &cobra.Command{
+	GroupID: "misc",
+
+	Use:     "genrows",
+	Aliases: []string{"fake"},
+	Short:   "generate synthetic rows from column specifications",
+	Long: `generate synthetic rows from column specifications
+
+Columns are specified by -c/--column in the format of "name:type[:arguments]",
+multiple values are supported. They can also be given in a file via
+-s/--spec-file, one specification per line, with blank lines and lines
+starting with "#" ignored.
+
+Types:
+
+  seq[:start[,step]]          sequential integers, default 1,1
+  int:min,max                 integers from a uniform distribution
+  float:min,max               floats from a uniform distribution (alias: uniform)
+  normal:mean,sd              floats from a normal distribution (alias: gauss)
+  lognormal:mu,sigma          floats from a log-normal distribution
+  exp:rate                    floats from an exponential distribution
+  poisson:lambda              integers from a Poisson distribution
+  bool[:p]                    "true" with a probability of p (default 0.5)
+  choice:a[=w],b[=w],...      categorical values with optional weights
+  regex:pattern               strings matching a regular expression
+  date:start,end[,format]     dates from a uniform distribution, in the format of
+                              MS Excel (TM) syntax, default: YYYY-MM-DD
+  uuid                        random UUIDs (version 4)
+  const:value                 a constant value
+  corr:column,r[,mean,sd]     floats from a normal distribution, correlated with
+                              a previous numeric column with a Pearson
+                              correlation coefficient of r
+
+Attention:
+
+  1. Unbounded repetitions of regular expressions (*, +, {n,}) are limited
+     by --max-repeat.
+  2. Columns for "corr" must be numeric ones of types other than "seq" and
+     be specified before the correlated column.
+  3. Outputs are reproducible with the same -S/--rand-seed.
+
+Examples:
+
+  csvtk genrows -n 5 -c id:seq -c age:int:18,90 -c region:choice:EU=3,US=2,AS=1 \
+      -c code:regex:'[A-Z]{3}-\d{4}' -c income:corr:age,0.6,50000,8000
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+
+		n := getFlagNonNegativeInt(cmd, "num-rows")
+		specs := getFlagStringArray(cmd, "column")
+		specFile := getFlagString(cmd, "spec-file")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+		maxRepeat := getFlagNonNegativeInt(cmd, "max-repeat")
+		rnd := rand.New(rand.NewSource(getFlagInt64(cmd, "rand-seed")))
+
+		if specFile != "" {
+			fh, err := xopen.Ropen(specFile)
+			checkError(err)
+			scanner := bufio.NewScanner(fh)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || line[0] == '#' {
+					continue
+				}
+				specs = append(specs, line)
+			}
+			checkError(scanner.Err())
+			checkError(fh.Close())
+		}
+		if len(specs) == 0 {
+			checkError(fmt.Errorf("flag -c/--column or -s/--spec-file needed"))
+		}
+
+		columns := make([]*genColumn, 0, len(specs))
+		colIndex := make(map[string]int, len(specs))
+		for _, spec := range specs {
+			col, err := parseGenColumn(spec, colIndex, columns)
+			checkError(err)
+			if _, ok := colIndex[col.name]; ok {
+				checkError(fmt.Errorf("duplicated column name: %s", col.name))
+			}
+			col.decimalFormat = decimalFormat
+			col.maxRepeat = maxRepeat
+			colIndex[col.name] = len(columns)
+			columns = append(columns, col)
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		record := make([]string, len(columns))
+		if !config.NoOutHeader {
+			for i, col := range columns {
+				record[i] = col.name
+			}
+			checkError(writer.Write(record))
+		}
+
+		zs := make([]float64, len(columns))
+		for r := 0; r < n; r++ {
+			for i, col := range columns {
+				record[i], zs[i] = col.generate(rnd, r, zs)
+			}
+			checkError(writer.Write(record))
+		}
+	},
+}
+
+// genColumn is a column of generated values.
+type genColumn struct {
+	name string
+	kind string
+
+	a, b, c, d float64 // numeric arguments
+
+	values  []string  // for choice
+	weights []float64 // cumulative weights for choice
+
+	re     *syntax.Regexp // for regex
+	layout string         // for date
+
+	ref int // index of the referenced column for corr
+
+	decimalFormat string
+	maxRepeat     int
+}
+
+func parseGenColumn(spec string, colIndex map[string]int, columns []*genColumn) (*genColumn, error) {
+	items := strings.SplitN(spec, ":", 3)
+	if len(items) < 2 || items[0] == "" {
+		return nil, fmt.Errorf(`invalid column specification: %s, format: "name:type[:arguments]"`, spec)
+	}
+	col := &genColumn{name: items[0], kind: strings.ToLower(items[1])}
+	var arg string
+	if len(items) == 3 {
+		arg = items[2]
+	}
+
+	// numeric arguments
+	parseNums := func(min, max int) ([]float64, error) {
+		var nums []float64
+		if arg != "" {
+			for _, s := range strings.Split(arg, ",") {
+				v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid numeric argument in column specification: %s", spec)
+				}
+				nums = append(nums, v)
+			}
+		}
+		if len(nums) < min || len(nums) > max {
+			if min == max {
+				return nil, fmt.Errorf("%d numeric argument(s) needed for type %s: %s", min, col.kind, spec)
+			}
+			return nil, fmt.Errorf("%d-%d numeric arguments needed for type %s: %s", min, max, col.kind, spec)
+		}
+		return nums, nil
+	}
+
+	var nums []float64
+	var err error
+	switch col.kind {
+	case "seq":
+		if nums, err = parseNums(0, 2); err != nil {
+			return nil, err
+		}
+		col.a, col.b = 1, 1
+		if len(nums) > 0 {
+			col.a = nums[0]
+		}
+		if len(nums) > 1 {
+			col.b = nums[1]
+		}
+	case "int", "float", "uniform":
+		if col.kind == "uniform" {
+			col.kind = "float"
+		}
+		if nums, err = parseNums(2, 2); err != nil {
+			return nil, err
+		}
+		col.a, col.b = nums[0], nums[1]
+		if col.a > col.b {
+			return nil, fmt.Errorf("min should not be greater than max: %s", spec)
+		}
+		if col.kind == "int" {
+			col.a, col.b = math.Ceil(col.a), math.Floor(col.b)
+		}
+	case "normal", "gauss", "lognormal":
+		if col.kind == "gauss" {
+			col.kind = "normal"
+		}
+		if nums, err = parseNums(2, 2); err != nil {
+			return nil, err
+		}
+		col.a, col.b = nums[0], nums[1]
+		if col.b < 0 {
+			return nil, fmt.Errorf("standard deviation should not be negative: %s", spec)
+		}
+	case "exp", "poisson":
+		if nums, err = parseNums(1, 1); err != nil {
+			return nil, err
+		}
+		col.a = nums[0]
+		if col.a <= 0 {
+			return nil, fmt.Errorf("the rate/lambda should be positive: %s", spec)
+		}
+	case "bool":
+		if nums, err = parseNums(0, 1); err != nil {
+			return nil, err
+		}
+		col.a = 0.5
+		if len(nums) > 0 {
+			col.a = nums[0]
+		}
+		if col.a < 0 || col.a > 1 {
+			return nil, fmt.Errorf("the probability should be in range of [0, 1]: %s", spec)
+		}
+	case "choice":
+		if arg == "" {
+			return nil, fmt.Errorf("values needed for type choice: %s", spec)
+		}
+		var sum float64
+		for _, s := range strings.Split(arg, ",") {
+			w := 1.0
+			if i := strings.LastIndexByte(s, '='); i >= 0 {
+				w, err = strconv.ParseFloat(s[i+1:], 64)
+				if err != nil || w < 0 {
+					return nil, fmt.Errorf("invalid weight of value %s: %s", s[:i], spec)
+				}
+				s = s[:i]
+			}
+			sum += w
+			col.values = append(col.values, s)
+			col.weights = append(col.weights, sum)
+		}
+		if sum == 0 {
+			return nil, fmt.Errorf("the sum of weights should be positive: %s", spec)
+		}
+	case "regex":
+		if arg == "" {
+			return nil, fmt.Errorf("pattern needed for type regex: %s", spec)
+		}
+		col.re, err = syntax.Parse(arg, syntax.Perl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %s: %s", arg, err)
+		}
+	case "date":
+		items = strings.SplitN(arg, ",", 3)
+		if len(items) < 2 {
+			return nil, fmt.Errorf("start and end dates needed for type date: %s", spec)
+		}
+		var start, end time.Time
+		if start, err = dateparse.ParseLocal(items[0]); err != nil {
+			return nil, fmt.Errorf("invalid start date: %s", items[0])
+		}
+		if end, err = dateparse.ParseLocal(items[1]); err != nil {
+			return nil, fmt.Errorf("invalid end date: %s", items[1])
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("the end date should not be before the start date: %s", spec)
+		}
+		col.a, col.b = float64(start.Unix()), float64(end.Unix())
+		col.layout = "YYYY-MM-DD"
+		if len(items) == 3 {
+			col.layout = items[2]
+		}
+	case "uuid":
+	case "const":
+		col.values = []string{arg}
+	case "corr":
+		items = strings.Split(arg, ",")
+		if len(items) != 2 && len(items) != 4 {
+			return nil, fmt.Errorf(`type corr needs arguments of "column,r[,mean,sd]": %s`, spec)
+		}
+		i, ok := colIndex[items[0]]
+		if !ok {
+			return nil, fmt.Errorf("column %s for type corr should be specified before: %s", items[0], spec)
+		}
+		switch columns[i].kind {
+		case "seq", "choice", "regex", "date", "uuid", "const":
+			return nil, fmt.Errorf("column %s of type %s can not be used for type corr", items[0], columns[i].kind)
+		}
+		col.ref = i
+		arg = strings.Join(items[1:], ",")
+		if nums, err = parseNums(1, 3); err != nil {
+			return nil, err
+		}
+		col.c, col.a, col.b = nums[0], 0, 1
+		if len(nums) == 3 {
+			col.a, col.b = nums[1], nums[2]
+		}
+		if col.c < -1 || col.c > 1 {
+			return nil, fmt.Errorf("the correlation coefficient should be in range of [-1, 1]: %s", spec)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type: %s. available: seq, int, float, normal, lognormal, exp, poisson, bool, choice, regex, date, uuid, const, corr", col.kind)
+	}
+	return col, nil
+}
+
+// generate returns a value of the r-th row and its z-score
+// used for correlated columns.
+func (col *genColumn) generate(rnd *rand.Rand, r int, zs []float64) (string, float64) {
+	switch col.kind {
+	case "seq":
+		return strconv.FormatFloat(col.a+float64(r)*col.b, 'f', -1, 64), 0
+	case "int":
+		v := col.a + float64(rnd.Int63n(int64(col.b-col.a)+1))
+		var z float64
+		if w := col.b - col.a + 1; w > 1 {
+			z = (v - (col.a+col.b)/2) / math.Sqrt((w*w-1)/12)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), z
+	case "float":
+		u := rnd.Float64()
+		return fmt.Sprintf(col.decimalFormat, col.a+u*(col.b-col.a)), (u - 0.5) * math.Sqrt(12)
+	case "normal":
+		z := rnd.NormFloat64()
+		return fmt.Sprintf(col.decimalFormat, col.a+col.b*z), z
+	case "lognormal":
+		z := rnd.NormFloat64()
+		return fmt.Sprintf(col.decimalFormat, math.Exp(col.a+col.b*z)), z
+	case "exp":
+		v := rnd.ExpFloat64()
+		return fmt.Sprintf(col.decimalFormat, v/col.a), v - 1
+	case "poisson":
+		v := poissonRand(rnd, col.a)
+		return strconv.Itoa(v), (float64(v) - col.a) / math.Sqrt(col.a)
+	case "bool":
+		if rnd.Float64() < col.a {
+			if col.a == 1 {
+				return "true", 0
+			}
+			return "true", (1 - col.a) / math.Sqrt(col.a*(1-col.a))
+		}
+		if col.a == 0 {
+			return "false", 0
+		}
+		return "false", -col.a / math.Sqrt(col.a*(1-col.a))
+	case "choice":
+		x := rnd.Float64() * col.weights[len(col.weights)-1]
+		for i, w := range col.weights {
+			if x < w {
+				return col.values[i], 0
+			}
+		}
+		return col.values[len(col.values)-1], 0
+	case "regex":
+		var buf strings.Builder
+		genRegexString(rnd, col.re, &buf, col.maxRepeat)
+		return buf.String(), 0
+	case "date":
+		t := time.Unix(int64(col.a)+rnd.Int63n(int64(col.b-col.a)+1), 0)
+		return fmtdate.Format(col.layout, t), 0
+	case "uuid":
+		var u [16]byte
+		rnd.Read(u[:])
+		u[6] = (u[6] & 0x0f) | 0x40
+		u[8] = (u[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), 0
+	case "const":
+		return col.values[0], 0
+	case "corr":
+		z := col.c*zs[col.ref] + math.Sqrt(1-col.c*col.c)*rnd.NormFloat64()
+		return fmt.Sprintf(col.decimalFormat, col.a+col.b*z), z
+	}
+	return "", 0
+}
+
+// poissonRand returns a random integer from a Poisson distribution,
+// with the normal approximation for large lambda.
+func poissonRand(rnd *rand.Rand, lambda float64) int {
+	if lambda > 30 {
+		v := math.Round(lambda + math.Sqrt(lambda)*rnd.NormFloat64())
+		if v < 0 {
+			return 0
+		}
+		return int(v)
+	}
+	l := math.Exp(-lambda)
+	k := 0
+	p := rnd.Float64()
+	for p > l {
+		k++
+		p *= rnd.Float64()
+	}
+	return k
+}
+
+// genRegexString writes a random string matching the regular expression.
+func genRegexString(rnd *rand.Rand, re *syntax.Regexp, buf *strings.Builder, maxRepeat int) {
+	repeat := func(min, max int) {
+		if max < 0 {
+			max = min + maxRepeat
+		}
+		n := min
+		if max > min {
+			n += rnd.Intn(max - min + 1)
+		}
+		for i := 0; i < n; i++ {
+			genRegexString(rnd, re.Sub[0], buf, maxRepeat)
+		}
+	}
+
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			buf.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		buf.WriteRune(randRuneOfClass(rnd, re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		buf.WriteByte(byte(' ' + rnd.Intn('~'-' '+1)))
+	case syntax.OpCapture:
+		genRegexString(rnd, re.Sub[0], buf, maxRepeat)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			genRegexString(rnd, sub, buf, maxRepeat)
+		}
+	case syntax.OpAlternate:
+		genRegexString(rnd, re.Sub[rnd.Intn(len(re.Sub))], buf, maxRepeat)
+	case syntax.OpStar:
+		repeat(0, -1)
+	case syntax.OpPlus:
+		repeat(1, -1)
+	case syntax.OpQuest:
+		repeat(0, 1)
+	case syntax.OpRepeat:
+		repeat(re.Min, re.Max)
+	}
+}
+
+// randRuneOfClass returns a random rune of a character class given in
+// ranges of pairs, printable ASCII characters are preferred.
+func randRuneOfClass(rnd *rand.Rand, ranges []rune) rune {
+	if len(ranges) == 0 {
+		return 0
+	}
+	pick := func(ranges []rune) rune {
+		var total int
+		for i := 0; i < len(ranges); i += 2 {
+			total += int(ranges[i+1]-ranges[i]) + 1
+		}
+		x := rnd.Intn(total)
+		for i := 0; i < len(ranges); i += 2 {
+			w := int(ranges[i+1]-ranges[i]) + 1
+			if x < w {
+				return ranges[i] + rune(x)
+			}
+			x -= w
+		}
+		return ranges[0]
+	}
+
+	ascii := make([]rune, 0, len(ranges))
+	for i := 0; i < len(ranges); i += 2 {
+		lo, hi := max(ranges[i], ' '), min(ranges[i+1], '~')
+		if lo <= hi {
+			ascii = append(ascii, lo, hi)
+		}
+	}
+	if len(ascii) > 0 {
+		return pick(ascii)
+	}
+	return pick(ranges)
+}
+
+func init() {
+	RootCmd.AddCommand(genrowsCmd)
+	genrowsCmd.Flags().IntP("num-rows", "n", 10, `number of rows to generate`)
+	genrowsCmd.Flags().StringArrayP("column", "c", []string{}, `column specification in the format of "name:type[:arguments]", multiple values supported`)
+	genrowsCmd.Flags().StringP("spec-file", "s", "", `file of column specifications, one per line`)
+	genrowsCmd.Flags().Int64P("rand-seed", "S", 11, `rand seed`)
+	genrowsCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+	genrowsCmd.Flags().IntP("max-repeat", "", 10, `maximum number of repetitions for unbounded repeats in regular expressions`)
+}
@@ -0,0 +1,181 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// geoDistanceCmd represents the geo distance command
+var geoDistanceCmd = &cobra.Command{
+	Use:   "distance",
+	Short: "haversine distance between two coordinate pairs",
+	Long: `haversine distance between two coordinate pairs
+
+The distance is computed between coordinates of -a/--from and -b/--to,
+or a fixed point given by -p/--point.
+
+Examples:
+
+    csvtk geo distance -a lat1,lon1 -b lat2,lon2 -u km data.csv
+    csvtk geo distance -a lat,lon -p 48.8566,2.3522 -n to_paris data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fromStr := getFlagString(cmd, "from")
+		if fromStr == "" {
+			checkError(fmt.Errorf("flag -a (--from) needed"))
+		}
+		toStr := getFlagString(cmd, "to")
+		pointStr := getFlagString(cmd, "point")
+		if (toStr == "") == (pointStr == "") {
+			checkError(fmt.Errorf("one and only one of -b/--to and -p/--point needed"))
+		}
+		var pLat, pLon float64
+		if pointStr != "" {
+			items := strings.Split(pointStr, ",")
+			var ok bool
+			if len(items) == 2 {
+				pLat, pLon, ok = parseLatLon(items[0], items[1])
+			}
+			if !ok {
+				checkError(fmt.Errorf("invalid value of flag -p/--point: %s", pointStr))
+			}
+		}
+		unit := strings.ToLower(getFlagString(cmd, "unit"))
+		scale, ok := geoDistanceUnits[unit]
+		if !ok {
+			checkError(fmt.Errorf("invalid value of flag -u/--unit: %s. available: km, m, mi, nmi", unit))
+		}
+		name := getFlagString(cmd, "name")
+		if name == "" {
+			name = "distance"
+		}
+		na := getFlagString(cmd, "na")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := true
+		var lat1, lon1, lat2, lon2 int
+		var y1, x1, y2, x2 float64
+		var ok1, ok2 bool
+		items := make([]string, 0, 64)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk geo distance: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					lat1, lon1 = geoCoordFields(header, "from", fromStr)
+					if toStr != "" {
+						lat2, lon2 = geoCoordFields(header, "to", toStr)
+					}
+
+					if !config.NoHeaderRow {
+						if printHeaderRow && !config.NoOutHeader {
+							items = append(items[:0], record.All...)
+							items = append(items, name)
+							checkError(writer.Write(items))
+						}
+						printHeaderRow = false
+						continue
+					}
+				}
+
+				items = append(items[:0], record.All...)
+				y1, x1, ok1 = parseLatLon(record.All[lat1-1], record.All[lon1-1])
+				if toStr != "" {
+					y2, x2, ok2 = parseLatLon(record.All[lat2-1], record.All[lon2-1])
+				} else {
+					y2, x2, ok2 = pLat, pLon, true
+				}
+				if ok1 && ok2 {
+					items = append(items, fmt.Sprintf(decimalFormat, haversine(y1, x1, y2, x2)*scale))
+				} else {
+					items = append(items, na)
+				}
+				checkError(writer.Write(items))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	geoCmd.AddCommand(geoDistanceCmd)
+
+	geoDistanceCmd.Flags().StringP("from", "a", "", `fields of latitude and longitude of the start points, e.g., -a lat1,lon1`)
+	geoDistanceCmd.Flags().StringP("to", "b", "", `fields of latitude and longitude of the end points, e.g., -b lat2,lon2`)
+	geoDistanceCmd.Flags().StringP("point", "p", "", `a fixed end point of latitude and longitude, e.g., -p 48.8566,2.3522`)
+	geoDistanceCmd.Flags().StringP("unit", "u", "km", `unit of distances: km, m, mi (miles), nmi (nautical miles)`)
+	geoDistanceCmd.Flags().IntP("decimal-width", "w", 3, "limit floats to N decimal points")
+}
@@ -0,0 +1,260 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// geoZonesData is derived from zone.tab and iso3166.tab of the IANA time zone
+// database (public domain), with coordinates converted to decimal degrees.
+//
+//go:embed geodata/zones.tsv
+var geoZonesData string
+
+// geoZone is a reference city of a timezone.
+type geoZone struct {
+	lat, lon float64
+	values   map[string]string
+}
+
+// geoNearestAttributes are attributes available for "csvtk geo nearest".
+var geoNearestAttributes = []string{"country_code", "country", "timezone", "distance"}
+
+// geoNearestCmd represents the geo nearest command
+var geoNearestCmd = &cobra.Command{
+	Use:   "nearest",
+	Short: "country and timezone of the nearest reference city, an offline approximation",
+	Long: `country and timezone of the nearest reference city, an offline approximation
+
+Each point is assigned the country and timezone of the nearest reference
+city of the IANA time zone database (zone.tab, ~400 cities, bundled in
+the binary), and no files or network access are needed.
+
+This is NOT a point-in-polygon lookup, as no boundaries are bundled.
+Points near borders may get the neighbouring country or timezone, e.g.,
+Strasbourg (48.58,7.75) is nearer to Busingen (DE, Europe/Busingen) than
+to Paris, and Windsor, Ontario (42.30,-83.02) is nearer to Detroit (US,
+America/Detroit) than to Toronto. Use "csvtk geo tag" with a GeoJSON file
+of boundaries for exact reverse lookup.
+
+Attributes (-a/--attributes):
+  country_code  ISO 3166 alpha-2 code, e.g., FR
+  country       country name, e.g., France
+  timezone      IANA timezone, e.g., Europe/Paris
+  distance      distance in km to the nearest reference city
+
+Points farther than --max-distance from all reference cities get
+the value of --na.
+
+Examples:
+
+    csvtk geo nearest -c lat,lon data.csv
+    csvtk geo nearest -c lat,lon -a country,timezone -n ctry,tz data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		coordStr := getFlagString(cmd, "coord")
+		if coordStr == "" {
+			checkError(fmt.Errorf("flag -c (--coord) needed"))
+		}
+		attrs := getFlagStringSlice(cmd, "attributes")
+		if len(attrs) == 0 {
+			checkError(fmt.Errorf("flag -a (--attributes) needed"))
+		}
+		for _, a := range attrs {
+			if !slices.Contains(geoNearestAttributes, a) {
+				checkError(fmt.Errorf("invalid value of flag -a (--attributes): %s. available: %s",
+					a, strings.Join(geoNearestAttributes, ", ")))
+			}
+		}
+		names := attrs
+		if nameStr := getFlagString(cmd, "name"); nameStr != "" {
+			names = strings.Split(nameStr, ",")
+			if len(names) != len(attrs) {
+				checkError(fmt.Errorf("numbers of names (%d) and attributes (%d) do not match", len(names), len(attrs)))
+			}
+		}
+		maxDist := getFlagFloat64(cmd, "max-distance")
+		if maxDist < 0 {
+			checkError(fmt.Errorf("value of flag --max-distance should not be negative: %f", maxDist))
+		}
+		decimalWidth := getFlagNonNegativeInt(cmd, "decimal-width")
+		decimalFormat := fmt.Sprintf("%%.%df", decimalWidth)
+		na := getFlagString(cmd, "na")
+
+		zones, err := readGeoZones(geoZonesData)
+		checkError(err)
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := true
+		var lat, lon int
+		var y, x, d, dMin float64
+		var ok bool
+		var nearest *geoZone
+		items := make([]string, 0, 64)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk geo nearest: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					lat, lon = geoCoordFields(header, "coord", coordStr)
+
+					if !config.NoHeaderRow {
+						if printHeaderRow && !config.NoOutHeader {
+							items = append(items[:0], record.All...)
+							items = append(items, names...)
+							checkError(writer.Write(items))
+						}
+						printHeaderRow = false
+						continue
+					}
+				}
+
+				nearest = nil
+				if y, x, ok = parseLatLon(record.All[lat-1], record.All[lon-1]); ok {
+					dMin = math.Inf(1)
+					for _, z := range zones {
+						if d = haversine(y, x, z.lat, z.lon); d < dMin {
+							dMin, nearest = d, z
+						}
+					}
+					if maxDist > 0 && dMin > maxDist {
+						nearest = nil
+					}
+				}
+
+				items = append(items[:0], record.All...)
+				for _, a := range attrs {
+					switch {
+					case nearest == nil:
+						items = append(items, na)
+					case a == "distance":
+						items = append(items, fmt.Sprintf(decimalFormat, dMin))
+					default:
+						items = append(items, nearest.values[a])
+					}
+				}
+				checkError(writer.Write(items))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+// readGeoZones parses the bundled TSV data of reference cities.
+func readGeoZones(data string) ([]*geoZone, error) {
+	lines := strings.Split(strings.TrimRight(data, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("no bundled geo data")
+	}
+	colnames := strings.Split(lines[0], "\t")
+	zones := make([]*geoZone, 0, len(lines)-1)
+	var err error
+	for i, line := range lines[1:] {
+		items := strings.Split(line, "\t")
+		if len(items) != len(colnames) {
+			return nil, fmt.Errorf("invalid bundled geo data at line %d: %s", i+2, line)
+		}
+		z := &geoZone{values: make(map[string]string, len(colnames))}
+		for j, col := range colnames {
+			switch col {
+			case "latitude":
+				z.lat, err = strconv.ParseFloat(items[j], 64)
+			case "longitude":
+				z.lon, err = strconv.ParseFloat(items[j], 64)
+			default:
+				z.values[col] = items[j]
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid bundled geo data at line %d: %s", i+2, line)
+			}
+		}
+		zones = append(zones, z)
+	}
+	return zones, nil
+}
+
+func init() {
+	geoCmd.AddCommand(geoNearestCmd)
+
+	geoNearestCmd.Flags().StringP("coord", "c", "", `fields of latitude and longitude, e.g., -c lat,lon`)
+	geoNearestCmd.Flags().StringSliceP("attributes", "a", []string{"country_code", "country", "timezone"},
+		`attributes to append, available: country_code, country, timezone, distance`)
+	geoNearestCmd.Flags().Float64P("max-distance", "", 1500, `maximum distance (km) to the nearest reference city, 0 for no limit`)
+	geoNearestCmd.Flags().IntP("decimal-width", "w", 2, `limit floats to N decimal points for distance`)
+}
@@ -0,0 +1,190 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// geoTagCmd represents the geo tag command
+var geoTagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "tag points with regions of polygons in a GeoJSON file",
+	Long: `tag points with regions of polygons in a GeoJSON file
+
+Polygons and multipolygons of features in the GeoJSON file (-g/--geojson)
+are used, and the value of a feature property (-p/--property) is appended
+for each point in the feature, or the 1-based index of the feature if
+the property is not given. Points in no feature get the value of --na.
+
+This also works for exact reverse lookup of countries or timezones with
+boundary files, while "csvtk geo nearest" only approximates them with the
+nearest reference city, e.g.,
+
+    csvtk geo tag -c lat,lon -g ne_110m_admin_0_countries.geojson \
+        -p ADMIN -n country data.csv
+    csvtk geo tag -c lat,lon -g combined.json -p tzid -n timezone data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		coordStr := getFlagString(cmd, "coord")
+		if coordStr == "" {
+			checkError(fmt.Errorf("flag -c (--coord) needed"))
+		}
+		geoFile := getFlagString(cmd, "geojson")
+		if geoFile == "" {
+			checkError(fmt.Errorf("flag -g (--geojson) needed"))
+		}
+		property := getFlagString(cmd, "property")
+		all := getFlagBool(cmd, "all")
+		sep := getFlagString(cmd, "separater")
+		name := getFlagString(cmd, "name")
+		if name == "" {
+			name = property
+			if name == "" {
+				name = "region"
+			}
+		}
+		na := getFlagString(cmd, "na")
+
+		regions, err := readGeoRegions(geoFile)
+		checkError(err)
+		tags := make([]string, len(regions))
+		for i, r := range regions {
+			if property != "" {
+				tags[i] = r.property(property)
+			} else {
+				tags[i] = strconv.Itoa(i + 1)
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := true
+		var lat, lon int
+		var y, x float64
+		var ok bool
+		items := make([]string, 0, 64)
+		matched := make([]string, 0, 4)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk geo tag: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					lat, lon = geoCoordFields(header, "coord", coordStr)
+
+					if !config.NoHeaderRow {
+						if printHeaderRow && !config.NoOutHeader {
+							items = append(items[:0], record.All...)
+							items = append(items, name)
+							checkError(writer.Write(items))
+						}
+						printHeaderRow = false
+						continue
+					}
+				}
+
+				matched = matched[:0]
+				if y, x, ok = parseLatLon(record.All[lat-1], record.All[lon-1]); ok {
+					for i, r := range regions {
+						if r.contains(x, y) {
+							matched = append(matched, tags[i])
+							if !all {
+								break
+							}
+						}
+					}
+				}
+
+				items = append(items[:0], record.All...)
+				if len(matched) == 0 {
+					items = append(items, na)
+				} else {
+					items = append(items, strings.Join(matched, sep))
+				}
+				checkError(writer.Write(items))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	geoCmd.AddCommand(geoTagCmd)
+
+	geoTagCmd.Flags().StringP("coord", "c", "", `fields of latitude and longitude, e.g., -c lat,lon`)
+	geoTagCmd.Flags().StringP("geojson", "g", "", `GeoJSON file of polygons or multipolygons`)
+	geoTagCmd.Flags().StringP("property", "p", "", `feature property to append, default: the 1-based index of the feature`)
+	geoTagCmd.Flags().BoolP("all", "a", false, `append all matched features instead of the first one`)
+	geoTagCmd.Flags().StringP("separater", "s", ";", `separater of multiple matched features for -a/--all`)
+}
@@ -0,0 +1,263 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// geoCmd represents the geo command
+var geoCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "geo",
+	Short: "geospatial utilities for latitude/longitude fields",
+	Long: `geospatial utilities for latitude/longitude fields
+
+Coordinates are decimal degrees in WGS84, e.g., 48.8566,2.3522.
+Records with empty or invalid coordinates get the value of --na.
+
+Reverse lookup of countries, timezones or any other regions is done by
+"csvtk geo tag" with a GeoJSON file of boundaries, e.g., countries from
+Natural Earth (https://www.naturalearthdata.com) or timezones from
+timezone-boundary-builder (https://github.com/evansiroky/timezone-boundary-builder).
+Without boundary files, "csvtk geo nearest" approximates them with the
+country and timezone of the nearest reference city, which may be wrong
+near borders.
+
+`,
+}
+
+func init() {
+	RootCmd.AddCommand(geoCmd)
+
+	geoCmd.PersistentFlags().StringP("name", "n", "", `name of the new column`)
+	geoCmd.PersistentFlags().StringP("na", "", "", `content for records with invalid coordinates or no result`)
+}
+
+// geoCoordFields returns the latitude and longitude fields of a flag value
+// like "lat,lon".
+func geoCoordFields(header []string, flag, value string) (int, int) {
+	fields := selectFieldsByHeader(header, value, false)
+	if len(fields) != 2 {
+		checkError(fmt.Errorf("two fields of latitude and longitude needed for flag --%s: %s", flag, value))
+	}
+	return fields[0], fields[1]
+}
+
+// parseLatLon parses a pair of latitude and longitude.
+func parseLatLon(lat, lon string) (float64, float64, bool) {
+	y, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil || y < -90 || y > 90 {
+		return 0, 0, false
+	}
+	x, err := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err != nil || x < -180 || x > 180 {
+		return 0, 0, false
+	}
+	return y, x, true
+}
+
+// earthRadius is the mean radius of the Earth in kilometers.
+const earthRadius = 6371.0088
+
+var geoDistanceUnits = map[string]float64{
+	"km":  1,
+	"m":   1000,
+	"mi":  1 / 1.609344,
+	"nmi": 1 / 1.852,
+}
+
+// haversine returns the great-circle distance in kilometers.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// geoRegion is a (multi)polygon feature of a GeoJSON file.
+type geoRegion struct {
+	properties map[string]interface{}
+	polygons   [][][][2]float64 // polygon -> ring -> point (lon, lat)
+
+	minX, minY, maxX, maxY float64 // bounding box
+}
+
+// contains checks whether the point is in the region, with the first ring
+// of a polygon as the exterior ring and the others as holes.
+func (r *geoRegion) contains(x, y float64) bool {
+	if x < r.minX || x > r.maxX || y < r.minY || y > r.maxY {
+		return false
+	}
+	for _, polygon := range r.polygons {
+		if len(polygon) == 0 || !ringContains(polygon[0], x, y) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, x, y) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains checks whether the point is in the ring with ray casting.
+func ringContains(ring [][2]float64, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func (r *geoRegion) property(key string) string {
+	v, ok := r.properties[key]
+	if !ok || v == nil {
+		return ""
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+type geoJSONGeometry struct {
+	Type        string             `json:"type"`
+	Coordinates json.RawMessage    `json:"coordinates"`
+	Geometries  []*geoJSONGeometry `json:"geometries"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   *geoJSONGeometry       `json:"geometry"`
+	Features   []*geoJSONFeature      `json:"features"`
+
+	// for a GeoJSON file of a single geometry
+	Coordinates json.RawMessage    `json:"coordinates"`
+	Geometries  []*geoJSONGeometry `json:"geometries"`
+}
+
+// readGeoRegions reads polygons and multipolygons from a GeoJSON file,
+// which could be a FeatureCollection, a Feature or a geometry.
+func readGeoRegions(file string) ([]*geoRegion, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var root geoJSONFeature
+	dec := json.NewDecoder(fh)
+	dec.UseNumber()
+	if err = dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to parse GeoJSON file %s: %s", file, err)
+	}
+
+	var features []*geoJSONFeature
+	switch root.Type {
+	case "FeatureCollection":
+		features = root.Features
+	case "Feature":
+		features = []*geoJSONFeature{&root}
+	default: // a geometry
+		g := &geoJSONGeometry{Type: root.Type, Coordinates: root.Coordinates, Geometries: root.Geometries}
+		features = []*geoJSONFeature{{Type: "Feature", Geometry: g}}
+	}
+
+	regions := make([]*geoRegion, 0, len(features))
+	for i, f := range features {
+		if f.Geometry == nil {
+			continue
+		}
+		r := &geoRegion{properties: f.Properties,
+			minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+		if err = r.addGeometry(f.Geometry); err != nil {
+			return nil, fmt.Errorf("feature #%d in %s: %s", i+1, file, err)
+		}
+		if len(r.polygons) > 0 {
+			regions = append(regions, r)
+		}
+	}
+	return regions, nil
+}
+
+func (r *geoRegion) addGeometry(g *geoJSONGeometry) error {
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return err
+		}
+		r.addPolygon(polygon)
+	case "MultiPolygon":
+		var polygons [][][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return err
+		}
+		for _, polygon := range polygons {
+			r.addPolygon(polygon)
+		}
+	case "GeometryCollection":
+		for _, g2 := range g.Geometries {
+			if err := r.addGeometry(g2); err != nil {
+				return err
+			}
+		}
+	}
+	// other geometries like points and lines are ignored
+	return nil
+}
+
+func (r *geoRegion) addPolygon(polygon [][][2]float64) {
+	if len(polygon) == 0 {
+		return
+	}
+	for _, p := range polygon[0] {
+		r.minX, r.maxX = math.Min(r.minX, p[0]), math.Max(r.maxX, p[0])
+		r.minY, r.maxY = math.Min(r.minY, p[1]), math.Max(r.maxY, p[1])
+	}
+	r.polygons = append(r.polygons, polygon)
+}
@@ -22,7 +22,6 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/csv"
 	"fmt"
 	"io"
 	"regexp"
@@ -139,20 +138,20 @@ Attentions:
 
 		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
 
-		var writer *csv.Writer
+		var writer *csvWriter
 		var outfhStd io.Writer
 		var outfhFile *xopen.Writer
 		var err error
 		isstdin := isStdin(config.OutFile)
 		if isstdin {
 			outfhStd = colorable.NewColorableStdout()
-			writer = csv.NewWriter(outfhStd)
+			writer = newCSVWriter(outfhStd)
 		} else {
 			noHighlight = true
-			outfhFile, err = xopen.Wopen(config.OutFile)
+			outfhFile, err = wopen(config.OutFile)
 			checkError(err)
 			defer outfhFile.Close()
-			writer = csv.NewWriter(outfhFile)
+			writer = newCSVWriter(outfhFile)
 		}
 
 		if config.OutTabs || config.Tabs {
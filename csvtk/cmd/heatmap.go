@@ -0,0 +1,424 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// heatmapCmd represents the heatmap command
+var heatmapCmd = &cobra.Command{
+	Use:   "heatmap",
+	Short: "plot heatmap",
+	Long: `plot heatmap
+
+Input formats:
+
+  1. Matrix (default): the first column contains row names,
+     and other columns are numeric values, e.g., the output of
+     "csvtk corr --out-format matrix".
+  2. Long format: given -x/--data-field-x, -y/--data-field-y and
+     -z/--value-field, e.g., the output of "csvtk corr --out-format long".
+     Rows and columns are in the order of their first appearance.
+     Missing cells and non-numeric values are drawn in gray.
+
+Color scale:
+
+  --palette       bluered (diverging, default), heat, kindlmann,
+                  blackbody, extended-blackbody
+  --z-min/--z-max range of the color scale, default: range of values
+  --reverse-palette
+
+Notes:
+
+  1. Output file can be set by flag -o/--out-file.
+  2. File format is determined by the out file suffix.
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, and html
+  3. If flag -o/--out-file not set (default), image is written to stdout,
+     you can display the image by pipping to "display" command of Imagemagic
+     or just redirect to file.
+  4. The html format outputs an interactive chart, see "csvtk plot -h".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		plotConfig := getPlotConfigs(cmd)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		dataFieldXStr := getFlagString(cmd, "data-field-x")
+		dataFieldYStr := getFlagString(cmd, "data-field-y")
+		valueFieldStr := getFlagString(cmd, "value-field")
+		long := dataFieldXStr != "" || dataFieldYStr != "" || valueFieldStr != ""
+		if long {
+			for _, f := range [][2]string{
+				{"-x (--data-field-x)", dataFieldXStr},
+				{"-y (--data-field-y)", dataFieldYStr},
+				{"-z (--value-field)", valueFieldStr},
+			} {
+				if f[1] == "" {
+					checkError(fmt.Errorf("flag %s needed for the long format", f[0]))
+				}
+				if strings.Contains(f[1], ",") {
+					checkError(fmt.Errorf("only one field allowed for flag %s", f[0]))
+				}
+				if f[1][0] == '-' {
+					checkError(fmt.Errorf("unselect not allowed for flag %s", f[0]))
+				}
+			}
+			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr + "," + valueFieldStr
+		} else {
+			plotConfig.fieldStr = "1-"
+		}
+
+		pal, err := heatmapPalette(getFlagString(cmd, "palette"))
+		checkError(err)
+		if getFlagBool(cmd, "reverse-palette") {
+			colors := pal.Colors()
+			reversed := make(heatmapColors, len(colors))
+			for i, c := range colors {
+				reversed[len(colors)-1-i] = c
+			}
+			pal = reversed
+		}
+		zminStr := getFlagString(cmd, "z-min")
+		zmaxStr := getFlagString(cmd, "z-max")
+		showValues := getFlagBool(cmd, "show-values")
+		decimalWidth := getFlagNonNegativeInt(cmd, "decimal-width")
+
+		file := files[0]
+		headerRow, fields, data, _, _, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, false)
+		checkError(err)
+
+		// =======================================
+
+		var rowNames, colNames []string
+		var grid [][]float64 // rows of values
+		if long {
+			rowIndex := make(map[string]int)
+			colIndex := make(map[string]int)
+			type cell struct {
+				r, c int
+				v    float64
+			}
+			cells := make([]cell, 0, len(data))
+			var ok bool
+			var r, c int
+			for _, d := range data {
+				if c, ok = colIndex[d[0]]; !ok {
+					c = len(colNames)
+					colIndex[d[0]] = c
+					colNames = append(colNames, d[0])
+				}
+				if r, ok = rowIndex[d[1]]; !ok {
+					r = len(rowNames)
+					rowIndex[d[1]] = r
+					rowNames = append(rowNames, d[1])
+				}
+				v, err := strconv.ParseFloat(removeComma(d[2]), 64)
+				if err != nil {
+					v = math.NaN()
+				}
+				cells = append(cells, cell{r, c, v})
+			}
+			grid = make([][]float64, len(rowNames))
+			for r = range grid {
+				grid[r] = make([]float64, len(colNames))
+				for c = range grid[r] {
+					grid[r][c] = math.NaN()
+				}
+			}
+			for _, cl := range cells {
+				grid[cl.r][cl.c] = cl.v
+			}
+
+			if plotConfig.xlab == "" && len(headerRow) > 0 {
+				plotConfig.xlab = headerRow[0]
+			}
+			if plotConfig.ylab == "" && len(headerRow) > 1 {
+				plotConfig.ylab = headerRow[1]
+			}
+		} else {
+			if len(fields) < 2 {
+				checkError(fmt.Errorf("at least two columns needed for the matrix format"))
+			}
+			colNames = make([]string, len(fields)-1)
+			for i, f := range fields[1:] {
+				if len(headerRow) > 0 {
+					colNames[i] = headerRow[i+1]
+				} else {
+					colNames[i] = strconv.Itoa(f)
+				}
+			}
+			rowNames = make([]string, len(data))
+			grid = make([][]float64, len(data))
+			for r, d := range data {
+				rowNames[r] = d[0]
+				grid[r] = make([]float64, len(d)-1)
+				for c, s := range d[1:] {
+					v, err := strconv.ParseFloat(removeComma(s), 64)
+					if err != nil {
+						v = math.NaN()
+					}
+					grid[r][c] = v
+				}
+			}
+		}
+		if len(rowNames) == 0 || len(colNames) == 0 {
+			checkError(fmt.Errorf("no data to plot"))
+		}
+
+		h := plotter.NewHeatMap(heatmapGrid(grid), pal)
+		h.NaN = heatmapNaNColor
+		if zminStr != "" {
+			h.Min, err = strconv.ParseFloat(zminStr, 64)
+			if err != nil {
+				checkError(fmt.Errorf("value of flag --%s should be float", "z-min"))
+			}
+		}
+		if zmaxStr != "" {
+			h.Max, err = strconv.ParseFloat(zmaxStr, 64)
+			if err != nil {
+				checkError(fmt.Errorf("value of flag --%s should be float", "z-max"))
+			}
+		}
+		if h.Min > h.Max {
+			checkError(fmt.Errorf("value of --z-min should not be greater than --z-max"))
+		}
+		// values out of the range are drawn with the colors of the extremes
+		h.Underflow = pal.Colors()[0]
+		h.Overflow = pal.Colors()[len(pal.Colors())-1]
+
+		p := plot.New()
+		p.Add(h)
+
+		if showValues {
+			labels := plotter.XYLabels{}
+			for r, row := range grid {
+				for c, v := range row {
+					if math.IsNaN(v) {
+						continue
+					}
+					labels.XYs = append(labels.XYs, plotter.XY{X: float64(c), Y: float64(len(grid) - 1 - r)})
+					labels.Labels = append(labels.Labels, strconv.FormatFloat(v, 'f', decimalWidth, 64))
+				}
+			}
+			l, err := plotter.NewLabels(labels)
+			checkError(err)
+			for i := range l.TextStyle {
+				l.TextStyle[i].Font.Size = plotConfig.tickLabelSize * 0.8
+				l.TextStyle[i].XAlign = draw.XCenter
+				l.TextStyle[i].YAlign = draw.YCenter
+			}
+			p.Add(l)
+		}
+
+		ticksX := make([]plot.Tick, len(colNames))
+		for i, name := range colNames {
+			ticksX[i] = plot.Tick{Value: float64(i), Label: name}
+		}
+		ticksY := make([]plot.Tick, len(rowNames))
+		for i, name := range rowNames {
+			ticksY[i] = plot.Tick{Value: float64(len(rowNames) - 1 - i), Label: name}
+		}
+		p.X.Tick.Marker = plot.ConstantTicks(ticksX)
+		p.Y.Tick.Marker = plot.ConstantTicks(ticksY)
+		p.X.Padding, p.Y.Padding = 0, 0
+
+		if plotConfig.html {
+			values := make([]vegaObj, 0, len(rowNames)*len(colNames))
+			for r, row := range grid {
+				for c, v := range row {
+					if math.IsNaN(v) {
+						continue
+					}
+					values = append(values, vegaObj{"x": colNames[c], "y": rowNames[r], "z": v})
+				}
+			}
+			spec := newVegaLiteSpec(plotConfig, values)
+			colors := pal.Colors()
+			const nColors = 9
+			scheme := make([]string, nColors)
+			for k := range scheme {
+				scheme[k] = vegaColor(colors[k*(len(colors)-1)/(nColors-1)])
+			}
+			x := vegaObj{"field": "x", "type": "nominal", "sort": colNames, "title": vegaTitle(plotConfig.xlab)}
+			if getFlagBool(cmd, "rotate-labels") {
+				x["axis"] = vegaObj{"labelAngle": -45}
+			}
+			encoding := vegaObj{
+				"x": x,
+				"y": vegaObj{"field": "y", "type": "nominal", "sort": rowNames, "title": vegaTitle(plotConfig.ylab)},
+			}
+			rect := vegaObj{
+				"mark": vegaObj{"type": "rect", "tooltip": true},
+				"encoding": vegaObj{
+					"color": vegaObj{
+						"field": "z", "type": "quantitative", "title": nil,
+						"scale": vegaObj{"domain": []float64{h.Min, h.Max}, "range": scheme, "clamp": true},
+					},
+				},
+			}
+			spec["encoding"] = encoding
+			spec["config"].(vegaObj)["view"] = vegaObj{"fill": vegaColor(heatmapNaNColor)}
+			if showValues {
+				text := vegaObj{
+					"mark": vegaObj{"type": "text", "fontSize": float64(plotConfig.tickLabelSize) * 0.8},
+					"encoding": vegaObj{
+						"text": vegaObj{"field": "z", "type": "quantitative", "format": fmt.Sprintf(".%df", decimalWidth)},
+					},
+				}
+				spec["layer"] = []vegaObj{rect, text}
+			} else {
+				spec["mark"] = rect["mark"]
+				encoding["color"] = rect["encoding"].(vegaObj)["color"]
+			}
+			writePlotHTML(config.OutFile, plotConfig, spec)
+			return
+		}
+
+		p.Title.Text = plotConfig.title
+		p.Title.TextStyle.Font.Size = plotConfig.titleSize
+		p.X.Label.Text = plotConfig.xlab
+		p.Y.Label.Text = plotConfig.ylab
+		p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
+		p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
+		p.X.Width = plotConfig.axisWidth
+		p.Y.Width = plotConfig.axisWidth
+		p.X.Tick.Width = plotConfig.tickWidth
+		p.Y.Tick.Width = plotConfig.tickWidth
+		p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
+		p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
+		if getFlagBool(cmd, "rotate-labels") {
+			p.X.Tick.Label.Rotation = math.Pi / 4
+			p.X.Tick.Label.XAlign = draw.XRight
+			p.X.Tick.Label.YAlign = draw.YCenter
+		}
+
+		if plotConfig.scaleLnX || plotConfig.scaleLnY {
+			log.Warning("flag --x-scale-ln and --y-scale-ln ignored for command heatmap")
+		}
+		if plotConfig.xminStr != "" || plotConfig.xmaxStr != "" || plotConfig.yminStr != "" || plotConfig.ymaxStr != "" {
+			log.Warning("flag --x-min, --x-max, --y-min and --y-max ignored for command heatmap")
+		}
+
+		// legend of the color scale
+		l := plot.NewLegend()
+		l.TextStyle.Font.Size = plotConfig.tickLabelSize
+		thumbs := plotter.PaletteThumbnailers(pal)
+		const nLegend = 5
+		for k := nLegend - 1; k >= 0; k-- {
+			l.Add(fmt.Sprintf("%.3g", h.Min+(h.Max-h.Min)*float64(k)/(nLegend-1)),
+				thumbs[k*(len(thumbs)-1)/(nLegend-1)])
+		}
+		l.Top = true
+
+		// Save image
+		format := plotConfig.format
+		if !isStdin(config.OutFile) {
+			format = strings.ToLower(strings.TrimPrefix(filepath.Ext(config.OutFile), "."))
+		}
+		c, err := draw.NewFormattedCanvas(plotConfig.width*vg.Inch, plotConfig.height*vg.Inch, format)
+		checkError(err)
+		dc := draw.New(c)
+		r := l.Rectangle(dc)
+		l.YOffs = -p.Title.TextStyle.FontExtents().Height
+		l.Draw(dc)
+		p.Draw(draw.Crop(dc, 0, -(r.Max.X-r.Min.X)-vg.Millimeter*2, 0, 0))
+
+		if isStdin(config.OutFile) {
+			_, err = c.WriteTo(os.Stdout)
+			checkError(err)
+		} else {
+			fh, err := os.Create(config.OutFile)
+			checkError(err)
+			_, err = c.WriteTo(fh)
+			checkError(err)
+			checkError(fh.Close())
+		}
+	},
+}
+
+// heatmapGrid implements plotter.GridXYZ, with the first row at the top.
+type heatmapGrid [][]float64
+
+func (g heatmapGrid) Dims() (c, r int)   { return len(g[0]), len(g) }
+func (g heatmapGrid) Z(c, r int) float64 { return g[len(g)-1-r][c] }
+func (g heatmapGrid) X(c int) float64    { return float64(c) }
+func (g heatmapGrid) Y(r int) float64    { return float64(r) }
+
+var heatmapNaNColor = color.Gray{Y: 200}
+
+// heatmapColors implements palette.Palette.
+type heatmapColors []color.Color
+
+func (c heatmapColors) Colors() []color.Color { return c }
+
+// heatmapPalette returns a palette by name.
+func heatmapPalette(name string) (palette.Palette, error) {
+	const n = 255
+	switch strings.ToLower(name) {
+	case "bluered":
+		return moreland.SmoothBlueRed().Palette(n), nil
+	case "heat":
+		return palette.Heat(n, 1), nil
+	case "kindlmann":
+		return moreland.Kindlmann().Palette(n), nil
+	case "blackbody":
+		return moreland.BlackBody().Palette(n), nil
+	case "extended-blackbody":
+		return moreland.ExtendedBlackBody().Palette(n), nil
+	}
+	return nil, fmt.Errorf("unsupported palette: %s. available: bluered, heat, kindlmann, blackbody, extended-blackbody", name)
+}
+
+func init() {
+	plotCmd.AddCommand(heatmapCmd)
+	heatmapCmd.Flags().StringP("data-field-x", "x", "", `column index or column name of X (columns of the heatmap) for the long format`)
+	heatmapCmd.Flags().StringP("data-field-y", "y", "", `column index or column name of Y (rows of the heatmap) for the long format`)
+	heatmapCmd.Flags().StringP("value-field", "z", "", `column index or column name of values for the long format`)
+
+	heatmapCmd.Flags().StringP("palette", "", "bluered", `color palette: bluered, heat, kindlmann, blackbody, extended-blackbody`)
+	heatmapCmd.Flags().BoolP("reverse-palette", "", false, `reverse the color palette`)
+	heatmapCmd.Flags().StringP("z-min", "", "", `minimum value of the color scale`)
+	heatmapCmd.Flags().StringP("z-max", "", "", `maximum value of the color scale`)
+	heatmapCmd.Flags().BoolP("show-values", "", false, `show values in cells`)
+	heatmapCmd.Flags().IntP("decimal-width", "", 2, `limit floats to N decimal points for --show-values`)
+	heatmapCmd.Flags().BoolP("rotate-labels", "", false, `rotate labels of X axis`)
+}
@@ -24,6 +24,7 @@ import (
 	"bufio"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -43,7 +44,8 @@ import (
 func checkError(err error) {
 	if err != nil {
 		log.Error(err)
-		os.Exit(-1)
+		removeInPlaceTemp()
+		exit(-1)
 	}
 }
 
@@ -53,10 +55,10 @@ func getFileList(args []string, checkFile bool) []string {
 		files = append(files, "-")
 	} else {
 		for _, file := range args {
-			if isStdin(file) {
+			if isStdin(file) || isMemFile(file) {
 				continue
 			}
-			if !checkFile {
+			if !checkFile || isURL(file) {
 				continue
 			}
 			if _, err := os.Stat(file); os.IsNotExist(err) {
@@ -88,7 +90,7 @@ func getFileListFromFile(file string, checkFile bool) ([]string, error) {
 		if strings.TrimSpace(_file) == "" {
 			continue
 		}
-		if checkFile && !isStdin(_file) {
+		if checkFile && !isStdin(_file) && !isURL(_file) {
 			if _, err = os.Stat(_file); os.IsNotExist(err) {
 				return lists, fmt.Errorf("check file '%s': %s", _file, err)
 			}
@@ -234,6 +236,12 @@ func getFlagStringSlice(cmd *cobra.Command, flag string) []string {
 	return value
 }
 
+func getFlagStringArray(cmd *cobra.Command, flag string) []string {
+	value, err := cmd.Flags().GetStringArray(flag)
+	checkError(err)
+	return value
+}
+
 func getFlagStringSliceAsInts(cmd *cobra.Command, flag string) []int {
 	values, err := cmd.Flags().GetStringSlice(flag)
 	checkError(err)
@@ -265,11 +273,14 @@ type Config struct {
 
 	NumCPUs int
 
-	Delimiter    rune
-	OutDelimiter rune
+	Delimiter       rune
+	DelimiterString string         // multiple-character delimiter of input
+	DelimiterRegexp *regexp.Regexp // regular expression of input delimiters
+	OutDelimiter    rune
 	// QuoteChar   rune
-	CommentChar rune
-	LazyQuotes  bool
+	CommentChar   rune
+	CommentPrefix string // prefix of multiple characters of comment lines
+	LazyQuotes    bool
 
 	Tabs        bool
 	OutTabs     bool
@@ -283,6 +294,8 @@ type Config struct {
 	IgnoreEmptyRow   bool
 	IgnoreIllegalRow bool
 
+	InFormat string
+
 	Version bool
 }
 
@@ -295,7 +308,7 @@ func isTrue(s string) bool {
 }
 
 func getConfigs(cmd *cobra.Command) Config {
-	if getFlagBool(cmd, "version") {
+	if !inProcess && getFlagBool(cmd, "version") {
 		fmt.Printf("csvtk v%s\n", VERSION)
 		os.Exit(0)
 	}
@@ -303,28 +316,85 @@ func getConfigs(cmd *cobra.Command) Config {
 	var val string
 
 	var tabs bool
-	if val = os.Getenv("CSVTK_T"); val != "" {
+	if val = os.Getenv("CSVTK_T"); val != "" && !inProcess {
 		tabs = isTrue(val)
-	} else if os.Args[0] == "tsvtk" {
+	} else if os.Args[0] == "tsvtk" && !inProcess {
 		tabs = true
 	} else {
 		tabs = getFlagBool(cmd, "tabs")
 	}
 
 	var noHeaderRow bool
-	if val = os.Getenv("CSVTK_H"); val != "" {
+	if val = os.Getenv("CSVTK_H"); val != "" && !inProcess {
 		noHeaderRow = isTrue(val)
 	} else {
 		noHeaderRow = getFlagBool(cmd, "no-header-row")
 	}
 
 	var verbose bool
-	if val = os.Getenv("CSVTK_QUIET"); val != "" {
+	if val = os.Getenv("CSVTK_QUIET"); val != "" && !inProcess {
 		verbose = !isTrue(val)
 	} else {
 		verbose = !getFlagBool(cmd, "quiet")
 	}
 
+	inFormat := strings.ToLower(getFlagString(cmd, "in-format"))
+	switch inFormat {
+	case "csv", "jsonl", "parquet", "arrow", "xlsx":
+	case "tsv":
+		inFormat = "csv"
+		tabs = true
+	default:
+		checkError(fmt.Errorf("unsupported input format: %s. available: csv, tsv, jsonl, parquet, arrow, xlsx", inFormat))
+	}
+	badRowsMode := strings.ToLower(getFlagString(cmd, "errors"))
+
+	outFile := getFlagString(cmd, "out-file")
+	var err error
+	// global settings are set once by the parent command of subcommands run
+	// in the same process
+	if !inProcess {
+		checkError(setInputCompression(strings.ToLower(getFlagString(cmd, "in-compress"))))
+		setProgress(getFlagBool(cmd, "progress"))
+		checkError(setDupColnamesPolicy(strings.ToLower(getFlagString(cmd, "on-dup-colnames"))))
+		checkError(setLogFormat(strings.ToLower(getFlagString(cmd, "log-format"))))
+		checkError(setMaxErrors(getFlagInt(cmd, "max-errors")))
+		checkError(setBadRows(badRowsMode, getFlagString(cmd, "bad-rows")))
+
+		if cmd.Flags().Changed("in-place") {
+			outFile, err = setInPlace(cmd, outFile, getFlagString(cmd, "in-place"))
+			checkError(err)
+		}
+		if isObjectURL(outFile) {
+			outFile, err = objectOutputFile(outFile)
+			checkError(err)
+		}
+		outFile, err = setOutputCompression(outFile, strings.ToLower(getFlagString(cmd, "compress")), getFlagInt(cmd, "compress-level"))
+		checkError(err)
+		outFile, err = setOutputEncoding(outFile, getFlagString(cmd, "out-encoding"))
+		checkError(err)
+		checkError(setOutputDialect(getFlagBool(cmd, "quote-all"), getFlagBool(cmd, "quote-never"), getFlagRune(cmd, "quote-char"),
+			strings.ToLower(getFlagString(cmd, "escape-style")), getFlagBool(cmd, "crlf"), getFlagBool(cmd, "lf")))
+		checkError(setInputEncoding(getFlagString(cmd, "in-encoding")))
+
+		httpTimeout, err := cmd.Flags().GetDuration("http-timeout")
+		checkError(err)
+		checkError(setHTTPClient(getFlagStringArray(cmd, "http-header"), httpTimeout, getFlagInt(cmd, "http-retries")))
+
+		checkError(setComments(strings.ToLower(getFlagString(cmd, "comments")), getFlagString(cmd, "comments-file"), outFile))
+	}
+
+	commentChar, commentPrefix := parseCommentChar(getFlagString(cmd, "comment-char"))
+
+	delimiter, delimiterString, err := parseDelimiter(getFlagString(cmd, "delimiter"))
+	checkError(err)
+	var delimiterRegexp *regexp.Regexp
+	if expr := getFlagString(cmd, "delim-regex"); expr != "" {
+		if delimiterRegexp, err = regexp.Compile(expr); err != nil {
+			checkError(fmt.Errorf("invalid value of flag --delim-regex: %s", err))
+		}
+	}
+
 	threads := getFlagPositiveInt(cmd, "num-cpus")
 	if threads >= 1000 {
 		checkError(fmt.Errorf("are your seriously? %d threads? It will exhaust your RAM", threads))
@@ -332,15 +402,18 @@ func getConfigs(cmd *cobra.Command) Config {
 		threads = runtime.NumCPU()
 	}
 
-	return Config{
+	config := Config{
 		Verbose: verbose,
 		NumCPUs: threads,
 
-		Delimiter:    getFlagRune(cmd, "delimiter"),
-		OutDelimiter: getFlagRune(cmd, "out-delimiter"),
+		Delimiter:       delimiter,
+		DelimiterString: delimiterString,
+		DelimiterRegexp: delimiterRegexp,
+		OutDelimiter:    getFlagRune(cmd, "out-delimiter"),
 		// QuoteChar:   getFlagRune(cmd, "quote-char"),
-		CommentChar: getFlagRune(cmd, "comment-char"),
-		LazyQuotes:  getFlagBool(cmd, "lazy-quotes"),
+		CommentChar:   commentChar,
+		CommentPrefix: commentPrefix,
+		LazyQuotes:    getFlagBool(cmd, "lazy-quotes"),
 
 		Tabs:        tabs,
 		OutTabs:     getFlagBool(cmd, "out-tabs"),
@@ -349,18 +422,76 @@ func getConfigs(cmd *cobra.Command) Config {
 
 		ShowRowNumber: getFlagBool(cmd, "show-row-number"),
 
-		OutFile: getFlagString(cmd, "out-file"),
+		OutFile: outFile,
 
 		IgnoreEmptyRow:   getFlagBool(cmd, "ignore-empty-row"),
-		IgnoreIllegalRow: getFlagBool(cmd, "ignore-illegal-row"),
+		IgnoreIllegalRow: getFlagBool(cmd, "ignore-illegal-row") || badRowsMode == "skip",
+
+		InFormat: inFormat,
+	}
+
+	if getFlagBool(cmd, "sniff") {
+		applySniffedDialect(cmd, &config)
+	}
+
+	if !inProcess && getFlagBool(cmd, "dry-run") {
+		dryRun(cmd, config)
 	}
+
+	return config
 }
 
 func newCSVReaderByConfig(config Config, file string) (*CSVReader, error) {
+	if mf := getMemFile(file); mf != nil {
+		return newSourceCSVReader(config, file, mf), nil
+	}
+	switch config.InFormat {
+	case "parquet":
+		source, err := newParquetSource(file, "")
+		if err != nil {
+			return nil, err
+		}
+		return newArrowCSVReader(config, source), nil
+	case "arrow":
+		source, err := newArrowIPCSource(file, "")
+		if err != nil {
+			return nil, err
+		}
+		return newArrowCSVReader(config, source), nil
+	case "jsonl":
+		source, err := newJSONLSource(config, file)
+		if err != nil {
+			return nil, err
+		}
+		return newSourceCSVReader(config, file, source), nil
+	case "xlsx":
+		source, err := newXLSXSource(file)
+		if err != nil {
+			return nil, err
+		}
+		return newSourceCSVReader(config, file, source), nil
+	}
+
+	if config.splitDelimiter() {
+		source, err := newSplitSource(config, file)
+		if err != nil {
+			return nil, err
+		}
+		reader := newSourceCSVReader(config, file, source)
+		source.reader = reader.Reader
+		return reader, nil
+	}
+
 	reader, err := NewCSVReader(file)
 	if err != nil {
 		return nil, err
 	}
+	if err = captureComments(reader.fh.Reader, config.commentPrefix()); err != nil {
+		return nil, err
+	}
+	if config.CommentPrefix != "" {
+		reader.Reader = csv.NewReader(newCommentFilter(reader.fh, config.CommentPrefix))
+	}
 	if config.Tabs {
 		reader.Reader.Comma = '\t'
 	} else {
@@ -378,14 +509,14 @@ func newCSVReaderByConfig(config Config, file string) (*CSVReader, error) {
 
 // NewCSVWriterChanByConfig returns a chanel which you can send record to write
 func NewCSVWriterChanByConfig(config Config) (chan []string, error) {
-	outfh, err := xopen.Wopen(config.OutFile)
+	outfh, err := wopen(config.OutFile)
 	if err != nil {
 		return nil, err
 	}
 
 	ch := make(chan []string, config.NumCPUs)
 
-	writer := csv.NewWriter(outfh)
+	writer := newCSVWriter(outfh)
 	if config.OutTabs {
 		writer.Comma = '\t'
 	} else {
@@ -548,6 +679,50 @@ func readDataFrame(config Config, file string, ignoreCase bool) ([]string, map[s
 	return colnames, colname2headerRow, df, nil
 }
 
+// readHeaderRow returns the first row of a file, comment lines are skipped.
+func readHeaderRow(config Config, file string) ([]string, error) {
+	if config.splitDelimiter() {
+		source, err := newSplitSource(config, file)
+		if err != nil {
+			return nil, err
+		}
+		defer source.Close()
+		record, err := source.Read()
+		if err == io.EOF {
+			return nil, xopen.ErrNoContent
+		}
+		return record, err
+	}
+
+	fh, err := ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var r io.Reader = fh
+	if config.CommentPrefix != "" {
+		r = newCommentFilter(fh, config.CommentPrefix)
+	}
+	reader := csv.NewReader(r)
+	if config.Tabs {
+		reader.Comma = '\t'
+	} else {
+		reader.Comma = config.Delimiter
+	}
+	reader.Comment = config.CommentChar
+	reader.LazyQuotes = config.LazyQuotes
+
+	record, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, xopen.ErrNoContent
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
 func parseCSVfile(cmd *cobra.Command, config Config, file string,
 	fieldStr string, fuzzyFields bool, returnSelectedData, returnAllData bool) ([]string, []int, [][]string, []string, [][]string, error) {
 
@@ -803,3 +978,62 @@ func makeOutDir(outDir string, force bool, logname string, verbose bool) {
 		log.Errorf("%s should not be current directory", logname)
 	}
 }
+
+// types of columns inferred from values
+const (
+	colTypeString = iota
+	colTypeInt
+	colTypeFloat
+	colTypeBool
+)
+
+// inferColumnType infers the type of the j-th column from all non-empty values.
+// Columns with no non-empty values are treated as strings.
+func inferColumnType(data [][]string, j int) int {
+	t := -1
+	var v string
+	var err error
+	for _, record := range data {
+		if j >= len(record) {
+			continue
+		}
+		v = record[j]
+		if v == "" {
+			continue
+		}
+		if t == -1 {
+			if isBoolValue(v) {
+				t = colTypeBool
+			} else {
+				t = colTypeInt
+			}
+		}
+		switch t {
+		case colTypeBool:
+			if !isBoolValue(v) {
+				return colTypeString
+			}
+			continue
+		case colTypeInt:
+			if _, err = strconv.ParseInt(v, 10, 64); err == nil {
+				continue
+			}
+			t = colTypeFloat
+		}
+		if _, err = strconv.ParseFloat(v, 64); err != nil {
+			return colTypeString
+		}
+	}
+	if t == -1 {
+		return colTypeString
+	}
+	return t
+}
+
+func isBoolValue(v string) bool {
+	switch v {
+	case "true", "false", "TRUE", "FALSE", "True", "False":
+		return true
+	}
+	return false
+}
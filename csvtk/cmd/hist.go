@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"sort"
@@ -46,10 +47,12 @@ Notes:
 
   1. Output file can be set by flag -o/--out-file.
   2. File format is determined by the out file suffix.
-     Supported formats: eps, jpg|jpeg, pdf, png, svg, and tif|tiff
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, html, and terminal
   3. If flag -o/--out-file not set (default), image is written to stdout,
      you can display the image by pipping to "display" command of Imagemagic
      or just redirect to file.
+  4. The html format outputs an interactive chart, see "csvtk plot -h".
+  5. The terminal format draws the plot in the terminal, see "csvtk plot -h".
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -75,7 +78,7 @@ Notes:
 		}
 
 		file := files[0]
-		headerRow, fields, data, _, _, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, false)
+		headerRow, fields, data, headerRowAll, dataAll, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, plotConfig.facetFieldStr != "")
 
 		if err != nil {
 			// if err == xopen.ErrNoContent {
@@ -85,96 +88,161 @@ Notes:
 			checkError(err)
 		}
 
-		// =======================================
+		build := func(data [][]string) *plot.Plot {
+			// =======================================
 
-		if plotConfig.groupFieldStr != "" {
-			log.Warning("flag -g (--group-field) ignored for command hist")
-		}
-		if plotConfig.ylab == "" {
-			plotConfig.ylab = "Count"
-		}
+			if plotConfig.groupFieldStr != "" {
+				log.Warning("flag -g (--group-field) ignored for command hist")
+			}
+			if plotConfig.ylab == "" {
+				plotConfig.ylab = "Count"
+			}
 
-		if plotConfig.xlab == "" && plotConfig.groupFieldStr == "" && len(headerRow) > 0 {
-			plotConfig.xlab = headerRow[0]
-		}
+			if plotConfig.xlab == "" && plotConfig.groupFieldStr == "" && len(headerRow) > 0 {
+				plotConfig.xlab = headerRow[0]
+			}
 
-		bins := getFlagPositiveInt(cmd, "bins")
-		colorIndex := getFlagPositiveInt(cmd, "color-index")
-		if colorIndex > 7 {
-			checkError(fmt.Errorf("unsupported color index"))
-		}
+			bins := getFlagPositiveInt(cmd, "bins")
+			colorIndex := getFlagPositiveInt(cmd, "color-index")
+			if colorIndex > 7 {
+				checkError(fmt.Errorf("unsupported color index"))
+			}
 
-		v := make(plotter.Values, 0, len(data))
-		var f float64
-		var ok bool
-		for _, d := range data {
-			if skipNA {
-				if _, ok = naMap[strings.ToLower(d[0])]; ok {
-					continue
+			v := make(plotter.Values, 0, len(data))
+			var f float64
+			var ok bool
+			for _, d := range data {
+				if skipNA {
+					if _, ok = naMap[strings.ToLower(d[0])]; ok {
+						continue
+					}
+				}
+				f, err = strconv.ParseFloat(d[0], 64)
+				if err != nil {
+					if len(headerRow) > 0 {
+						checkError(fmt.Errorf("fail to parse data: %s at column: %s. please choose the right column by flag -f (--data-field)", d[0], headerRow[0]))
+					} else {
+						checkError(fmt.Errorf("fail to parse data: %s at column: %d. please choose the right column by flag -f (--data-field)", d[0], fields[0]))
+					}
 				}
+				v = append(v, f)
 			}
-			f, err = strconv.ParseFloat(d[0], 64)
-			if err != nil {
-				if len(headerRow) > 0 {
-					checkError(fmt.Errorf("fail to parse data: %s at column: %s. please choose the right column by flag -f (--data-field)", d[0], headerRow[0]))
-				} else {
-					checkError(fmt.Errorf("fail to parse data: %s at column: %d. please choose the right column by flag -f (--data-field)", d[0], fields[0]))
+
+			percentiles := getFlagBool(cmd, "percentiles")
+			if percentiles {
+				sort.Float64s(v)
+				plotConfig.xlab = fmt.Sprintf("%s\nP99=%.3f P95=%.3f\nMEAN=%.3f STDDEV=%.3f\n", plotConfig.xlab, getPercentile(0.99, v), getPercentile(0.95, v), getPercentile(0.5, v), stat.StdDev(v, nil))
+			}
+
+			if plotConfig.html {
+				values := make([]vegaObj, len(v))
+				for i, f := range v {
+					values[i] = vegaObj{"value": f}
 				}
+				spec := newVegaLiteSpec(plotConfig, values)
+				spec["mark"] = vegaObj{"type": "bar", "tooltip": true, "color": vegaColor(plotutil.Color(colorIndex - 1))}
+				x := vegaQuantitative("value", plotConfig.xlab, plotConfig.scaleLnX,
+					plotConfig.xminStr, plotConfig.xmin, plotConfig.xmaxStr, plotConfig.xmax)
+				x["bin"] = vegaObj{"maxbins": bins}
+				y := vegaQuantitative("value", plotConfig.ylab, plotConfig.scaleLnY,
+					plotConfig.yminStr, plotConfig.ymin, plotConfig.ymaxStr, plotConfig.ymax)
+				y["aggregate"] = "count"
+				spec["encoding"] = vegaObj{"x": x, "y": y}
+				vegaAddZoom(spec, "y")
+				writePlotHTML(config.OutFile, plotConfig, spec)
+				return nil
 			}
-			v = append(v, f)
-		}
 
-		percentiles := getFlagBool(cmd, "percentiles")
-		if percentiles {
-			sort.Float64s(v)
-			plotConfig.xlab = fmt.Sprintf("%s\nP99=%.3f P95=%.3f\nMEAN=%.3f STDDEV=%.3f\n", plotConfig.xlab, getPercentile(0.99, v), getPercentile(0.95, v), getPercentile(0.5, v), stat.StdDev(v, nil))
-		}
+			if plotConfig.terminal {
+				if w, _ := termSize(plotConfig); bins > w-10 {
+					bins = w - 10
+				}
+				h, err := plotter.NewHist(v, bins)
+				checkError(err)
+				var ymax float64
+				for _, b := range h.Bins {
+					ymax = math.Max(ymax, b.Weight)
+				}
+				xmin, xmax := h.Bins[0].Min, h.Bins[len(h.Bins)-1].Max
+				if plotConfig.xminStr != "" {
+					xmin = plotConfig.xmin
+				}
+				if plotConfig.xmaxStr != "" {
+					xmax = plotConfig.xmax
+				}
+				if plotConfig.scaleLnX || plotConfig.scaleLnY {
+					log.Warning("flag --x-scale-ln and --y-scale-ln ignored for the terminal format")
+				}
+				tp := newTermPlot(plotConfig, xmin, xmax, 0, ymax)
+				for _, b := range h.Bins {
+					c0, c1 := tp.col(b.Min), tp.col(b.Max)
+					if c1 == c0 {
+						c1++
+					}
+					tp.Bar(max(c0, 0), c1, 0, b.Weight, colorIndex-1)
+				}
+				writeTermPlot(config.OutFile, tp)
+				return nil
+			}
 
-		p := plot.New()
+			p := plot.New()
 
-		h, err := plotter.NewHist(v, bins)
-		if err != nil {
-			checkError(err)
-		}
+			h, err := plotter.NewHist(v, bins)
+			if err != nil {
+				checkError(err)
+			}
 
-		// h.Normalize(1)
-		h.FillColor = plotutil.Color(colorIndex - 1)
-		h.LineStyle.Width = lineWidth
-		p.Add(h)
-
-		p.Title.Text = plotConfig.title
-		p.Title.TextStyle.Font.Size = plotConfig.titleSize
-		p.X.Label.Text = plotConfig.xlab
-		p.Y.Label.Text = plotConfig.ylab
-		p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.X.Width = plotConfig.axisWidth
-		p.Y.Width = plotConfig.axisWidth
-		p.X.Tick.Width = plotConfig.tickWidth
-		p.Y.Tick.Width = plotConfig.tickWidth
-		p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
-		p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
-
-		if plotConfig.scaleLnX {
-			p.X.Scale = plot.LogScale{}
-			p.X.Tick.Marker = plot.LogTicks{Prec: -1}
-		}
-		if plotConfig.scaleLnY {
-			p.Y.Scale = plot.LogScale{}
-			p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
-		}
+			// h.Normalize(1)
+			h.FillColor = plotutil.Color(colorIndex - 1)
+			h.LineStyle.Width = lineWidth
+			p.Add(h)
 
-		if plotConfig.xminStr != "" {
-			p.X.Min = plotConfig.xmin
-		}
-		if plotConfig.xmaxStr != "" {
-			p.X.Max = plotConfig.xmax
+			p.Title.Text = plotConfig.title
+			p.Title.TextStyle.Font.Size = plotConfig.titleSize
+			p.X.Label.Text = plotConfig.xlab
+			p.Y.Label.Text = plotConfig.ylab
+			p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.X.Width = plotConfig.axisWidth
+			p.Y.Width = plotConfig.axisWidth
+			p.X.Tick.Width = plotConfig.tickWidth
+			p.Y.Tick.Width = plotConfig.tickWidth
+			p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
+
+			if plotConfig.scaleLnX {
+				p.X.Scale = plot.LogScale{}
+				p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+			if plotConfig.scaleLnY {
+				p.Y.Scale = plot.LogScale{}
+				p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+
+			if plotConfig.xminStr != "" {
+				p.X.Min = plotConfig.xmin
+			}
+			if plotConfig.xmaxStr != "" {
+				p.X.Max = plotConfig.xmax
+			}
+			if plotConfig.yminStr != "" {
+				p.Y.Min = plotConfig.ymin
+			}
+			if plotConfig.ymaxStr != "" {
+				p.Y.Max = plotConfig.ymax
+			}
+
+			return p
 		}
-		if plotConfig.yminStr != "" {
-			p.Y.Min = plotConfig.ymin
+
+		if plotConfig.facetFieldStr != "" {
+			plotFacets(config, plotConfig, headerRowAll, data, dataAll, build)
+			return
 		}
-		if plotConfig.ymaxStr != "" {
-			p.Y.Max = plotConfig.ymax
+
+		p := build(data)
+		if p == nil { // html or terminal format
+			return
 		}
 
 		// Save image
@@ -0,0 +1,277 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// html2csvCmd represents the html2csv command
+var html2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "html2csv",
+	Short: "extract a table from HTML to CSV",
+	Long: `extract a table from HTML to CSV
+
+The input can be a local file or a http(s) URL. Tables are numbered in
+the order of appearance in the document, starting from 1, and tables
+nested in other tables are counted too. Use --list to list all tables.
+
+Notes:
+  1. Texts of cells are extracted with spaces collapsed, and <br> are
+     converted to spaces.
+  2. Cells spanning multiple columns (colspan) or rows (rowspan) are
+     repeated in all spanned positions.
+  3. Rows are padded with empty cells to the same number of columns.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		tableIndex := getFlagPositiveInt(cmd, "table-index")
+		list := getFlagBool(cmd, "list")
+
+		file := files[0]
+		fh, err := ropen(file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk html2csv: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		doc, err := html.Parse(fh)
+		checkError(err)
+		checkError(fh.Close())
+
+		tables := findHTMLTables(doc, nil)
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if list {
+			checkError(writer.Write([]string{"index", "rows", "columns", "id", "caption"}))
+			var rows [][]string
+			var ncols int
+			var id, caption string
+			for i, table := range tables {
+				rows = htmlTableRows(table)
+				ncols = 0
+				if len(rows) > 0 {
+					ncols = len(rows[0])
+				}
+				id, caption = "", ""
+				for _, a := range table.Attr {
+					if a.Key == "id" {
+						id = a.Val
+					}
+				}
+				for c := table.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type == html.ElementNode && c.DataAtom == atom.Caption {
+						caption = htmlText(c)
+						break
+					}
+				}
+				checkError(writer.Write([]string{fmt.Sprintf("%d", i+1), fmt.Sprintf("%d", len(rows)), fmt.Sprintf("%d", ncols), id, caption}))
+			}
+			return
+		}
+
+		if tableIndex > len(tables) {
+			checkError(fmt.Errorf("table %d not found, %d tables in total: %s", tableIndex, len(tables), file))
+		}
+
+		for i, row := range htmlTableRows(tables[tableIndex-1]) {
+			if i == 0 && config.NoOutHeader {
+				continue
+			}
+			checkError(writer.Write(row))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(html2csvCmd)
+	html2csvCmd.Flags().IntP("table-index", "n", 1, "index of the table to extract (1-based)")
+	html2csvCmd.Flags().BoolP("list", "", false, "list all tables with numbers of rows and columns")
+}
+
+// findHTMLTables returns all <table> elements in document order.
+func findHTMLTables(n *html.Node, tables []*html.Node) []*html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Table {
+		tables = append(tables, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		tables = findHTMLTables(c, tables)
+	}
+	return tables
+}
+
+// htmlTableRowNodes returns <tr> elements of a table, excluding those of
+// nested tables.
+func htmlTableRowNodes(n *html.Node, rows []*html.Node) []*html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Tr:
+			rows = append(rows, c)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			rows = htmlTableRowNodes(c, rows)
+		}
+	}
+	return rows
+}
+
+// htmlTableRows extracts texts of cells of a table, with colspan and rowspan
+// expanded.
+func htmlTableRows(table *html.Node) [][]string {
+	trs := htmlTableRowNodes(table, nil)
+	rows := make([][]string, len(trs))
+
+	// cells spanning rows below: column -> remaining rows and text
+	type span struct {
+		n    int
+		text string
+	}
+	spans := make(map[int]*span)
+
+	var ncols int
+	var col, colspan, rowspan int
+	var text string
+	for i, tr := range trs {
+		row := make([]string, 0, ncols)
+		col = 0
+		fillSpans := func() {
+			for {
+				s, ok := spans[col]
+				if !ok || s.n == 0 {
+					return
+				}
+				row = append(row, s.text)
+				s.n--
+				col++
+			}
+		}
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || (c.DataAtom != atom.Td && c.DataAtom != atom.Th) {
+				continue
+			}
+			fillSpans()
+
+			text = htmlText(c)
+			colspan, rowspan = 1, 1
+			for _, a := range c.Attr {
+				switch a.Key {
+				case "colspan":
+					fmt.Sscanf(a.Val, "%d", &colspan)
+				case "rowspan":
+					fmt.Sscanf(a.Val, "%d", &rowspan)
+				}
+			}
+			if colspan < 1 {
+				colspan = 1
+			}
+			if rowspan < 1 {
+				rowspan = 1
+			}
+			for k := 0; k < colspan; k++ {
+				row = append(row, text)
+				if rowspan > 1 {
+					spans[col] = &span{n: rowspan - 1, text: text}
+				}
+				col++
+			}
+		}
+		fillSpans()
+
+		if len(row) > ncols {
+			ncols = len(row)
+		}
+		rows[i] = row
+	}
+
+	for i, row := range rows {
+		for len(row) < ncols {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// htmlText returns the text of a node, with spaces collapsed.
+func htmlText(n *html.Node) string {
+	var sb strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Br:
+				sb.WriteString(" ")
+				return
+			case atom.Script, atom.Style:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
@@ -0,0 +1,136 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// inPlaceNoBackup is the value of --in-place given without a suffix of backup files.
+const inPlaceNoBackup = "none"
+
+// For in-place editing, the output is written to a temporary file in the
+// directory of the input file, which replaces the input file after the
+// command succeeds, with an optional backup.
+var inPlace struct {
+	file   string // the input file
+	tmp    string // the temporary output file
+	suffix string // suffix of the backup file, "" for no backup
+}
+
+// setInPlace checks the input file and returns the temporary output file.
+func setInPlace(cmd *cobra.Command, outFile string, suffix string) (string, error) {
+	if outFile != "-" {
+		return "", fmt.Errorf("the flag --in-place is incompatible with -o/--out-file")
+	}
+
+	files := getFileListFromArgsAndFile(cmd, cmd.Flags().Args(), true, "infile-list", true)
+	if len(files) != 1 {
+		return "", fmt.Errorf("the flag --in-place needs exactly one input file, %d given", len(files))
+	}
+	file := files[0]
+	if isStdin(file) || isURL(file) || isObjectURL(file) {
+		return "", fmt.Errorf("the flag --in-place only supports local files: %s", file)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("the flag --in-place only supports regular files: %s", file)
+	}
+
+	if suffix == inPlaceNoBackup {
+		suffix = ""
+	}
+
+	// the base name is kept as the suffix, so that the compression format is kept
+	fh, err := os.CreateTemp(filepath.Dir(file), ".csvtk-*-"+filepath.Base(file))
+	if err != nil {
+		return "", err
+	}
+	fh.Close()
+	if err = os.Chmod(fh.Name(), info.Mode().Perm()); err != nil {
+		os.Remove(fh.Name())
+		return "", err
+	}
+
+	inPlace.file, inPlace.tmp, inPlace.suffix = file, fh.Name(), suffix
+	return inPlace.tmp, nil
+}
+
+// FinishInPlace replaces the input file with the output,
+// after backing up the input file if needed.
+func FinishInPlace() error {
+	if inPlace.tmp == "" {
+		return nil
+	}
+	defer removeInPlaceTemp()
+
+	if inPlace.suffix != "" {
+		backup := inPlace.file + inPlace.suffix
+		os.Remove(backup)
+		if err := os.Link(inPlace.file, backup); err != nil { // hard links are not supported
+			if err = copyFile(inPlace.file, backup); err != nil {
+				return fmt.Errorf("backing up %s: %s", inPlace.file, err)
+			}
+		}
+	}
+	if err := os.Rename(inPlace.tmp, inPlace.file); err != nil {
+		return err
+	}
+	inPlace.tmp = ""
+	return nil
+}
+
+// removeInPlaceTemp removes the temporary output file, e.g., when the command fails.
+func removeInPlaceTemp() {
+	if inPlace.tmp != "" {
+		os.Remove(inPlace.tmp)
+		inPlace.tmp = ""
+	}
+}
+
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	info, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,367 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// inProcess is true when subcommands are run in the same process by
+// "csvtk pipeline" or "csvtk repl". Global settings like output compression,
+// the output dialect and the handling of bad rows are only set by the parent
+// command, and environment variables are not used by subcommands.
+var inProcess bool
+
+// exit is os.Exit, which is replaced by "csvtk repl" to stop the failed
+// command instead of the whole process.
+var exit = os.Exit
+
+// newInProcessCommand returns a copy of a csvtk subcommand with flags parsed
+// from args. A copy is used as the flags of a cobra command are shared, and
+// the same command might be run more than once, or concurrently.
+// The subcommand is run with c.Run(c, c.Flags().Args()).
+func newInProcessCommand(args []string) (*cobra.Command, error) {
+	tmpl, rest, err := RootCmd.Find(args)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == RootCmd {
+		return nil, fmt.Errorf("subcommand needed")
+	}
+	if tmpl.Run == nil {
+		return nil, fmt.Errorf("subcommand of %s needed", tmpl.CommandPath())
+	}
+
+	c := &cobra.Command{Use: tmpl.Use}
+	c.Run = func(cmd *cobra.Command, args []string) {
+		if help, _ := cmd.Flags().GetBool("help"); help {
+			tmpl.Help()
+			return
+		}
+		tmpl.Run(cmd, args)
+	}
+	// parents are needed for cmd.CommandPath()
+	child := c
+	for p := tmpl.Parent(); p != nil; p = p.Parent() {
+		parent := &cobra.Command{Use: p.Use}
+		parent.AddCommand(child)
+		child = parent
+	}
+
+	fs := c.Flags()
+	add := func(f *pflag.Flag) {
+		if err == nil && fs.Lookup(f.Name) == nil {
+			err = copyFlag(fs, f)
+		}
+	}
+	tmpl.LocalFlags().VisitAll(add)
+	tmpl.InheritedFlags().VisitAll(add)
+	if err != nil {
+		return nil, err
+	}
+	if fs.Lookup("help") == nil {
+		fs.BoolP("help", "h", false, "help for "+tmpl.Name())
+	}
+	fs.SetOutput(io.Discard)
+	if err = fs.Parse(rest); err != nil {
+		return nil, fmt.Errorf("%s: %s", tmpl.CommandPath(), err)
+	}
+	return c, nil
+}
+
+// inProcessArgs returns the positional arguments of a subcommand reading
+// the file instead of stdin.
+func inProcessArgs(args []string, file string) []string {
+	if len(args) == 0 {
+		return []string{file}
+	}
+	args = append([]string(nil), args...)
+	for i, arg := range args {
+		if isStdin(arg) {
+			args[i] = file
+		}
+	}
+	return args
+}
+
+// copyFlag adds a flag to fs with the same name, type and default value,
+// but its own value.
+func copyFlag(fs *pflag.FlagSet, f *pflag.Flag) error {
+	short := f.Shorthand
+	if short != "" && fs.ShorthandLookup(short) != nil { // shadowed
+		short = ""
+	}
+
+	var err error
+	switch f.Value.Type() {
+	case "string":
+		fs.StringP(f.Name, short, f.DefValue, f.Usage)
+	case "bool":
+		var v bool
+		v, err = strconv.ParseBool(f.DefValue)
+		fs.BoolP(f.Name, short, v, f.Usage)
+	case "int":
+		var v int
+		v, err = strconv.Atoi(f.DefValue)
+		fs.IntP(f.Name, short, v, f.Usage)
+	case "int64":
+		var v int64
+		v, err = strconv.ParseInt(f.DefValue, 10, 64)
+		fs.Int64P(f.Name, short, v, f.Usage)
+	case "float64":
+		var v float64
+		v, err = strconv.ParseFloat(f.DefValue, 64)
+		fs.Float64P(f.Name, short, v, f.Usage)
+	case "duration":
+		var v time.Duration
+		v, err = time.ParseDuration(f.DefValue)
+		fs.DurationP(f.Name, short, v, f.Usage)
+	case "stringSlice", "stringArray":
+		v := []string{}
+		if s := strings.TrimSuffix(strings.TrimPrefix(f.DefValue, "["), "]"); s != "" {
+			v, err = csv.NewReader(strings.NewReader(s)).Read()
+		}
+		if f.Value.Type() == "stringSlice" {
+			fs.StringSliceP(f.Name, short, v, f.Usage)
+		} else {
+			fs.StringArrayP(f.Name, short, v, f.Usage)
+		}
+	default:
+		return fmt.Errorf("unsupported type of flag --%s: %s", f.Name, f.Value.Type())
+	}
+	if err != nil {
+		return fmt.Errorf("invalid default value of flag --%s: %s", f.Name, f.DefValue)
+	}
+	fs.Lookup(f.Name).NoOptDefVal = f.NoOptDefVal
+	return nil
+}
+
+// memFilePrefix is the prefix of names of in-memory files, which pass
+// records between subcommands run in the same process.
+const memFilePrefix = "csvtk-memory:"
+
+var memFiles = struct {
+	sync.Mutex
+	n       int
+	files   map[string]*memFile
+	writers map[*xopen.Writer]*memFile
+}{
+	files:   make(map[string]*memFile),
+	writers: make(map[*xopen.Writer]*memFile),
+}
+
+// memFile is an in-memory file of records. It's read as a recordSource,
+// and written by csvWriter with records, or by other writers in bytes,
+// which are parsed as CSV records. Records written are sent to the reader
+// via a channel.
+type memFile struct {
+	name string
+
+	records [][]string
+	i       int
+
+	ch   chan []string
+	done chan struct{} // closed when the reader finishes
+	once sync.Once
+
+	pw     *io.PipeWriter // for bytes written
+	parsed chan error
+}
+
+// newMemFile creates an in-memory file passing records from a writer to a
+// reader, e.g., between steps of a pipeline.
+func newMemFile() *memFile {
+	f := &memFile{ch: make(chan []string, 128), done: make(chan struct{})}
+	registerMemFile(f)
+	return f
+}
+
+// newMemFileOf creates an in-memory file for reading the given records,
+// which are not changed.
+func newMemFileOf(records [][]string) *memFile {
+	f := &memFile{records: records, done: make(chan struct{})}
+	registerMemFile(f)
+	return f
+}
+
+func registerMemFile(f *memFile) {
+	memFiles.Lock()
+	memFiles.n++
+	f.name = fmt.Sprintf("%s%d", memFilePrefix, memFiles.n)
+	memFiles.files[f.name] = f
+	memFiles.Unlock()
+}
+
+// isMemFile checks if a file is an in-memory file.
+func isMemFile(file string) bool {
+	return strings.HasPrefix(file, memFilePrefix)
+}
+
+// getMemFile returns an in-memory file, or nil if it does not exist.
+func getMemFile(file string) *memFile {
+	if !isMemFile(file) {
+		return nil
+	}
+	memFiles.Lock()
+	defer memFiles.Unlock()
+	return memFiles.files[file]
+}
+
+// memFileOfWriter returns the in-memory file of a writer created by wopen,
+// or nil for other writers.
+func memFileOfWriter(w io.Writer) *memFile {
+	fh, ok := w.(*xopen.Writer)
+	if !ok {
+		return nil
+	}
+	memFiles.Lock()
+	defer memFiles.Unlock()
+	return memFiles.writers[fh]
+}
+
+// writer returns a writer of bytes, see wopen().
+func (f *memFile) writer() *xopen.Writer {
+	fh := &xopen.Writer{Writer: bufio.NewWriter(f)}
+	memFiles.Lock()
+	memFiles.writers[fh] = f
+	memFiles.Unlock()
+	return fh
+}
+
+// Read returns the next record, and io.EOF at the end.
+func (f *memFile) Read() ([]string, error) {
+	if f.ch == nil {
+		if f.i >= len(f.records) {
+			return nil, io.EOF
+		}
+		f.i++
+		// commands might change the record
+		return append([]string(nil), f.records[f.i-1]...), nil
+	}
+	record, ok := <-f.ch
+	if !ok {
+		return nil, io.EOF
+	}
+	return record, nil
+}
+
+// Close is called when the reader finishes, and later records written are
+// discarded.
+func (f *memFile) Close() error {
+	f.once.Do(func() { close(f.done) })
+	return nil
+}
+
+// put writes a record.
+func (f *memFile) put(record []string) {
+	record = append([]string(nil), record...)
+	select {
+	case f.ch <- record:
+	case <-f.done:
+	}
+}
+
+// Write writes bytes, which are parsed as CSV records.
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.pw == nil {
+		var pr *io.PipeReader
+		pr, f.pw = io.Pipe()
+		f.parsed = make(chan error, 1)
+		go func() {
+			reader := csv.NewReader(pr)
+			reader.FieldsPerRecord = -1
+			var err error
+			var record []string
+			for {
+				if record, err = reader.Read(); err != nil {
+					break
+				}
+				f.put(record)
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			pr.CloseWithError(err)
+			f.parsed <- err
+		}()
+	}
+	return f.pw.Write(p)
+}
+
+// closeWrite is called when the writer finishes.
+func (f *memFile) closeWrite() error {
+	var err error
+	if f.pw != nil {
+		f.pw.Close()
+		err = <-f.parsed
+	}
+	if f.ch != nil {
+		close(f.ch)
+	}
+	return err
+}
+
+// remove removes the file from the registry.
+func (f *memFile) remove() {
+	f.Close()
+	memFiles.Lock()
+	delete(memFiles.files, f.name)
+	for w, f2 := range memFiles.writers {
+		if f2 == f {
+			delete(memFiles.writers, w)
+		}
+	}
+	memFiles.Unlock()
+}
+
+// csvReader returns the records in the CSV format, for commands reading
+// bytes of input files.
+func (f *memFile) csvReader() io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		writer := csv.NewWriter(pw)
+		for {
+			record, err := f.Read()
+			if err != nil {
+				break
+			}
+			if err = writer.Write(record); err != nil {
+				break
+			}
+		}
+		writer.Flush()
+		f.Close()
+		pw.CloseWithError(writer.Error())
+	}()
+	return pr
+}
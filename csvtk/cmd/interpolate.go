@@ -0,0 +1,301 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// interpolateCmd represents the interpolate command
+var interpolateCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:     "interpolate",
+	Aliases: []string{"interp"},
+	Short:   "interpolate empty cells of numeric fields",
+	Long: `interpolate empty cells of numeric fields
+
+Methods (-m/--method):
+
+  linear    linear interpolation between the two nearest known values
+  nearest   the nearest known value, the previous one for ties
+  spline    natural cubic spline through all known values
+
+Values are interpolated along the row order, or along the values of
+an explicit x field (-x/--x-field), within groups if -g/--groups is
+given. Empty cells before the first or after the last known value are
+kept unless -e/--extrapolate is given, which fills them with the nearest
+known values.
+
+Cells are treated as empty if they are empty strings or values given
+by -n/--na-values, e.g., -n NA,N/A.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		xStr := getFlagString(cmd, "x-field")
+		groupsStr := getFlagString(cmd, "groups")
+		method := strings.ToLower(getFlagString(cmd, "method"))
+		switch method {
+		case "linear", "nearest", "spline":
+		default:
+			checkError(fmt.Errorf("invalid method: %s. available: linear, nearest, spline", method))
+		}
+		extrapolate := getFlagBool(cmd, "extrapolate")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+
+		naValues := map[string]struct{}{"": {}}
+		for _, s := range getFlagStringSlice(cmd, "na-values") {
+			naValues[s] = struct{}{}
+		}
+		isNA := func(s string) bool {
+			_, ok := naValues[s]
+			return ok
+		}
+		parseNum := func(column, s string) float64 {
+			if !reDigitals.MatchString(s) {
+				checkError(fmt.Errorf("column %s has non-numeric data: %s, you can use flag -n/--na-values to treat it as empty", column, s))
+			}
+			v, err := strconv.ParseFloat(removeComma(s), 64)
+			checkError(err)
+			return v
+		}
+
+		file := files[0]
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+		if header == nil {
+			return
+		}
+
+		fields := selectFieldsByHeader(header, fieldStr, fuzzyFields)
+		var xField int
+		if xStr != "" {
+			xFields := selectFieldsByHeader(header, xStr, false)
+			if len(xFields) != 1 {
+				checkError(fmt.Errorf("only one x field allowed: %s", xStr))
+			}
+			xField = xFields[0]
+		}
+		var groupFields []int
+		if groupsStr != "" {
+			groupFields = selectFieldsByHeader(header, groupsStr, false)
+		}
+
+		// rows of groups
+		groups := make(map[string][]int, 8)
+		groupsOrder := make([]string, 0, 8)
+		groupKey := make([]string, len(groupFields))
+		for r, record := range data {
+			for i, f := range groupFields {
+				groupKey[i] = record[f-1]
+			}
+			key := strings.Join(groupKey, "_shenwei356_")
+			if _, ok := groups[key]; !ok {
+				groupsOrder = append(groupsOrder, key)
+			}
+			groups[key] = append(groups[key], r)
+		}
+
+		var xs, ys []float64
+		var x float64
+		for _, key := range groupsOrder {
+			rows := groups[key]
+
+			// x values
+			xOf := make(map[int]float64, len(rows))
+			for k, r := range rows {
+				if xField == 0 {
+					xOf[r] = float64(k + 1)
+				} else if !isNA(data[r][xField-1]) {
+					xOf[r] = parseNum(header[xField-1], data[r][xField-1])
+				}
+			}
+			if xField > 0 {
+				sort.SliceStable(rows, func(i, j int) bool {
+					xi, oki := xOf[rows[i]]
+					xj, okj := xOf[rows[j]]
+					if oki && okj {
+						return xi < xj
+					}
+					return oki && !okj
+				})
+			}
+
+			for _, f := range fields {
+				c := f - 1
+
+				xs, ys = xs[:0], ys[:0]
+				for _, r := range rows {
+					if x, ok := xOf[r]; ok && !isNA(data[r][c]) {
+						if len(xs) > 0 && x == xs[len(xs)-1] { // duplicated x
+							continue
+						}
+						xs = append(xs, x)
+						ys = append(ys, parseNum(header[c], data[r][c]))
+					}
+				}
+				if len(xs) == 0 {
+					continue
+				}
+
+				var spline *cubicSpline
+				if method == "spline" && len(xs) > 2 {
+					spline = newCubicSpline(xs, ys)
+				}
+
+				var ok bool
+				for _, r := range rows {
+					if !isNA(data[r][c]) {
+						continue
+					}
+					if x, ok = xOf[r]; !ok {
+						continue
+					}
+					if x < xs[0] || x > xs[len(xs)-1] {
+						if !extrapolate {
+							continue
+						}
+						if x < xs[0] {
+							data[r][c] = fmt.Sprintf(decimalFormat, ys[0])
+						} else {
+							data[r][c] = fmt.Sprintf(decimalFormat, ys[len(ys)-1])
+						}
+						continue
+					}
+
+					// xs[i-1] < x <= xs[i]
+					i := sort.SearchFloat64s(xs, x)
+					if xs[i] == x {
+						data[r][c] = fmt.Sprintf(decimalFormat, ys[i])
+						continue
+					}
+					switch {
+					case method == "nearest":
+						if x-xs[i-1] <= xs[i]-x {
+							data[r][c] = fmt.Sprintf(decimalFormat, ys[i-1])
+						} else {
+							data[r][c] = fmt.Sprintf(decimalFormat, ys[i])
+						}
+					case spline != nil:
+						data[r][c] = fmt.Sprintf(decimalFormat, spline.at(i-1, x))
+					default:
+						data[r][c] = fmt.Sprintf(decimalFormat,
+							ys[i-1]+(ys[i]-ys[i-1])*(x-xs[i-1])/(xs[i]-xs[i-1]))
+					}
+				}
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if !config.NoHeaderRow && !config.NoOutHeader {
+			checkError(writer.Write(header))
+		}
+		for _, record := range data {
+			checkError(writer.Write(record))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(interpolateCmd)
+	interpolateCmd.Flags().StringP("fields", "f", "", `numeric fields to interpolate. e.g -f 1,2 or -f columnA,columnB`)
+	interpolateCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	interpolateCmd.Flags().StringP("x-field", "x", "", `numeric field of x values, default: the row order`)
+	interpolateCmd.Flags().StringP("groups", "g", "", `interpolate within groups via fields. e.g -g 1,2 or -g columnA,columnB`)
+	interpolateCmd.Flags().StringP("method", "m", "linear", `interpolation method: linear, nearest, spline`)
+	interpolateCmd.Flags().BoolP("extrapolate", "e", false, `fill leading and trailing empty cells with the nearest known values`)
+	interpolateCmd.Flags().StringSliceP("na-values", "n", []string{}, `values treated as empty besides empty strings, e.g., -n NA,N/A`)
+	interpolateCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+}
+
+// cubicSpline is a natural cubic spline.
+type cubicSpline struct {
+	xs, ys []float64
+	m      []float64 // second derivatives
+}
+
+func newCubicSpline(xs, ys []float64) *cubicSpline {
+	n := len(xs)
+	m := make([]float64, n)
+	// solve the tridiagonal system with the Thomas algorithm
+	c := make([]float64, n)
+	d := make([]float64, n)
+	for i := 1; i < n-1; i++ {
+		h0, h1 := xs[i]-xs[i-1], xs[i+1]-xs[i]
+		a, b, cc := h0, 2*(h0+h1), h1
+		r := 6 * ((ys[i+1]-ys[i])/h1 - (ys[i]-ys[i-1])/h0)
+		if i > 1 {
+			b -= a * c[i-1]
+			r -= a * d[i-1]
+		}
+		c[i] = cc / b
+		d[i] = r / b
+	}
+	for i := n - 2; i > 0; i-- {
+		m[i] = d[i] - c[i]*m[i+1]
+	}
+	return &cubicSpline{xs: xs, ys: ys, m: m}
+}
+
+// at returns the value at x in the interval [xs[i], xs[i+1]].
+func (s *cubicSpline) at(i int, x float64) float64 {
+	h := s.xs[i+1] - s.xs[i]
+	a := (s.xs[i+1] - x) / h
+	b := (x - s.xs[i]) / h
+	return a*s.ys[i] + b*s.ys[i+1] +
+		((a*a*a-a)*s.m[i]+(b*b*b-b)*s.m[i+1])*h*h/6
+}
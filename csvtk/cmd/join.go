@@ -21,12 +21,19 @@
 package cmd
 
 import (
-	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/Knetic/govaluate"
+	"github.com/dustin/go-humanize"
+	"github.com/shenwei356/csvtk/pkg/csvtk"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 )
@@ -45,6 +52,22 @@ Attention:
   1. Multiple keys supported
   2. Default operation is inner join, use --left-join for left join 
      and --outer-join for outer join.
+  3. By default, files are read one by one, and only the joined data and
+     the file being joined are kept in memory. Output records are in the
+     order of the first file, followed by unmatched records of other files
+     kept by -O/--outer-join or --keep-unmatched-of, in order of appearance.
+  4. For large files, use --spill-to-disk to sort records of each file by
+     keys with temporary files, and then merge all files in one k-way merge,
+     with memory bounded by --buffer-size, e.g., for outer join of many
+     large files. Output records are ordered by keys in this mode.
+  5. Non-equi join of two files is supported by --where, an expression
+     evaluated for each pair of records with equal keys. Columns of the two
+     files are referred as "a.column" and "b.column", or "a.${column name}"
+     for names with special charactors, and "a.1" for the first column.
+     If -f/--fields is not given, all pairs of records are evaluated, e.g.,
+       csvtk join --where 'a.start <= b.pos && b.pos <= a.end && a.chr == b.chr'
+     Left join (-L) keeps records of the first file with no pair satisfying
+     the expression. Outer join is not supported.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -55,6 +78,12 @@ Attention:
 		}
 		runtime.GOMAXPROCS(config.NumCPUs)
 		allFields := getFlagSemicolonSeparatedStrings(cmd, "fields")
+		if getFlagBool(cmd, "natural") {
+			if cmd.Flags().Changed("fields") {
+				checkError(fmt.Errorf("flag --natural and -f/--fields are exclusive"))
+			}
+			allFields = []string{naturalJoinFields(config, files)}
+		}
 		if len(allFields) == 0 {
 			checkError(fmt.Errorf("flag -f (--fields) needed"))
 		} else if len(allFields) == 1 {
@@ -86,29 +115,98 @@ Attention:
 		keepUnmatched := getFlagBool(cmd, "keep-unmatched")
 		outerJoin := getFlagBool(cmd, "outer-join")
 		na := getFlagString(cmd, "na")
+		naValues := strings.Split(na, ";")
+		if len(naValues) != len(files) { // the same value for all files, which could contain ";"
+			naValues = make([]string, len(files))
+			for i := range files {
+				naValues[i] = na
+			}
+		}
 		ignoreNull := getFlagBool(cmd, "ignore-null")
+		keySep := getFlagString(cmd, "key-sep")
+		keyTransforms, err := csvtk.ParseKeyTransforms(getFlagCommaSeparatedStrings(cmd, "key-transform"))
+		checkError(err)
+
+		// columns to keep of each file
+		keepFields := make([][]string, len(files))
+		var j, n int
+		for _, val := range getFlagSemicolonSeparatedStrings(cmd, "keep-fields") {
+			j = strings.Index(val, ":")
+			if j <= 0 || j == len(val)-1 {
+				checkError(fmt.Errorf(`invalid value of flag --keep-fields: %s. e.g., --keep-fields "2:colA,colB;3:score"`, val))
+			}
+			n, err = strconv.Atoi(val[:j])
+			if err != nil || n < 1 || n > len(files) {
+				checkError(fmt.Errorf("file index in flag --keep-fields should be an integer in range of [1, %d]: %s", len(files), val[:j]))
+			}
+			keepFields[n-1] = strings.Split(val[j+1:], ",")
+		}
+
+		var stats *joinStats
+		statsFile := getFlagString(cmd, "stats-file")
+		if getFlagBool(cmd, "stats") || statsFile != "" {
+			stats = newJoinStats(files)
+			defer stats.report(getFlagBool(cmd, "stats"), statsFile)
+		}
+
+		spillToDisk := getFlagBool(cmd, "spill-to-disk")
+		tmpDir := getFlagString(cmd, "temp-dir")
+		var bufferSize int64
+		if spillToDisk {
+			bufferSize, err = ParseByteSize(getFlagString(cmd, "buffer-size"))
+			checkError(err)
+			if bufferSize <= 0 {
+				checkError(fmt.Errorf("value of flag --buffer-size should be greater than 0"))
+			}
+		}
 
 		if outerJoin && leftJoin {
 			checkError(fmt.Errorf("flag -O/--out-join and -L/--left-join are exclusive"))
 		}
 
+		// keep unmatched records of these files
+		keepUnmatchedOf := make([]bool, len(files))
+		var keepOthers bool // keep unmatched records of files other than the first one
+		for _, n := range getFlagCommaSeparatedInts(cmd, "keep-unmatched-of") {
+			if n < 1 || n > len(files) {
+				checkError(fmt.Errorf("value of flag --keep-unmatched-of should be in range of [1, %d]: %d", len(files), n))
+			}
+			keepUnmatchedOf[n-1] = true
+			if n > 1 {
+				keepOthers = true
+			}
+		}
+
 		if outerJoin {
 			keepUnmatched = true
-			for _, file := range files {
-				if isStdin(file) {
-					checkError(fmt.Errorf("stdin not allowed when using -O/--outer-join"))
-				}
+			keepOthers = true
+			for i := range keepUnmatchedOf {
+				keepUnmatchedOf[i] = true
 			}
 		}
 		if leftJoin {
 			keepUnmatched = true
 		}
+		// non-equi join
+		var predicate *joinPredicate
+		var crossJoin bool
+		if where := getFlagString(cmd, "where"); where != "" {
+			if len(files) != 2 {
+				checkError(fmt.Errorf("flag --where only supports two files"))
+			}
+			if keepOthers || spillToDisk {
+				checkError(fmt.Errorf("flag --where is not supported for outer join or --spill-to-disk"))
+			}
+			predicate, err = newJoinPredicate(where)
+			checkError(err)
+			crossJoin = !cmd.Flags().Changed("fields") && !getFlagBool(cmd, "natural")
+		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -123,69 +221,103 @@ Attention:
 			checkError(writer.Error())
 		}()
 
-		var HeaderRow []string
-		var newColname string
-		var prefixedHeaderRow []string
-		if filenameAsPrefix {
-			prefixedHeaderRow = make([]string, 0, 128)
+		header := &joinHeader{
+			filenameAsPrefix: filenameAsPrefix,
+			trimExtension:    trimeExtention,
+			onlyDuplicates:   onlyDuplicates,
+			suffixes:         suffixes,
 		}
-		var suffixedHeaderRow []string
-		if addSuffix {
-			suffixedHeaderRow = make([]string, 0, 128)
+
+		if spillToDisk {
+			joinBySorting(config, files, header, writer, joinOpts{
+				Fields:          allFields,
+				FuzzyFields:     fuzzyFields,
+				KeepFields:      keepFields,
+				IgnoreCase:      ignoreCase,
+				IgnoreNull:      ignoreNull,
+				KeySep:          keySep,
+				KeyTransforms:   keyTransforms,
+				KeepUnmatched:   keepUnmatched,
+				KeepUnmatchedOf: keepUnmatchedOf,
+				NA:              naValues,
+				TmpDir:          tmpDir,
+				BufferSize:      bufferSize,
+				Stats:           stats,
+			})
+			return
 		}
-		var Data [][]string
-		var Fields []int
-		firstFile := true
-		var withHeaderRow bool
 
+		keyEncoder := &joinKeyEncoder{csvtk.KeyEncoder{Sep: keySep, IgnoreCase: ignoreCase, IgnoreNull: ignoreNull, Transforms: keyTransforms}}
 		var key string
-		var items []string
+		var null, ok bool
 
-		var keys map[string]bool
-		if outerJoin {
-			keys = make(map[string]bool)
-			for i, file := range files {
-				_, fields, _, _, data, err := parseCSVfile(cmd, config,
-					file, allFields[i], fuzzyFields, false, true)
-
-				if err != nil {
-					if err == xopen.ErrNoContent {
-						if config.Verbose {
-							log.Warningf("csvtk join: skipping empty input file: %s", file)
+		// Files are read one by one, and only the joined data are kept in memory.
+		// To keep unmatched records of files other than the first one, all
+		// unmatched records are kept tentatively, and those with keys not
+		// existing in any of these files are removed in the end.
+		var Data [][]string
+		var Fields []int                 // key fields of the first file, also the ones of Data
+		var Nulls []bool                 // NULL keys in Data, only for records of the first file
+		var complete []bool              // whether records in Data are matched in all files, only for keepOthers
+		var naRecord []string            // NA values of all columns of Data
+		var keptKeys map[string]struct{} // unmatched records of these keys are kept, only for keepOthers
+		if keepOthers {
+			keptKeys = make(map[string]struct{}, 1024)
+		}
+		var keyCounts []map[string]int // number of records of each key in each file, for stats
+		if stats != nil {
+			keyCounts = make([]map[string]int, len(files))
+		}
+		first := true
+		var keepFirst bool // keep unmatched records of the first file
+		var records, records2 [][]string
+		var record2 []string
+		var keys []string
+		var nulls []bool
+		var matched bool
+		for i, file := range files {
+			keep := keepUnmatchedOf[i] || (first && keepUnmatched)
+			var counts map[string]int
+			if stats != nil {
+				counts = make(map[string]int, 1024)
+			}
+			records, keys, nulls = nil, nil, nil // records in order, only for the first file or keepOthers
+			keysMaps := make(map[string][][]string)
+			var ncols int
+
+			headerRow, fields, err := readJoinInput(config, file, allFields[i], fuzzyFields, keepFields[i],
+				func(record []string, fields []int) {
+					ncols = len(record)
+					if crossJoin { // all pairs of records are candidates
+						fields = nil
+					}
+					key, null = keyEncoder.key(record, fields)
+					if stats != nil {
+						stats.Files[i].Rows++
+						if null {
+							stats.Files[i].NullKeyRows++
+						} else {
+							counts[key]++
 						}
-						continue
 					}
-					checkError(err)
-				}
-
-				var ok bool
-				for _, record := range data {
-					items = make([]string, len(fields))
-					for i, f := range fields {
-						items[i] = record[f-1]
+					if keepOthers && keep && !null {
+						keptKeys[key] = struct{}{}
 					}
-					key = strings.Join(items, "_shenwei356_")
-					if ignoreNull && key == "" { // skip empty cell
-						continue
+
+					if first {
+						records = append(records, record)
+						nulls = append(nulls, null)
+						return
 					}
-					if ignoreCase {
-						key = strings.ToLower(key)
+					if null { // skip empty cell
+						return
 					}
-					if _, ok = keys[key]; ok {
-						continue
+					keysMaps[key] = append(keysMaps[key], record)
+					if keepOthers {
+						records = append(records, record)
+						keys = append(keys, key)
 					}
-					keys[key] = false
-				}
-			}
-		}
-
-		var f int
-		var ok bool
-		mColnames := make(map[string]interface{}, 8)
-		for i, file := range files {
-			_, fields, _, headerRow, data, err := parseCSVfile(cmd, config,
-				file, allFields[i], fuzzyFields, false, true)
-
+				})
 			if err != nil {
 				if err == xopen.ErrNoContent {
 					if config.Verbose {
@@ -196,180 +328,38 @@ Attention:
 				checkError(err)
 			}
 
-			if len(data) == 0 {
+			if ncols == 0 {
 				if config.Verbose {
 					log.Warningf("no data found in file: %s", file)
 				}
 				continue
 			}
-			if firstFile {
-				HeaderRow, Data, Fields = headerRow, data, fields
-				if filenameAsPrefix {
-					fieldsMap1 := make(map[int]interface{}, len(fields))
-					for _, f = range fields {
-						fieldsMap1[f] = struct{}{}
-					}
-
-					if len(headerRow) == 0 { // no header row, we still create column names with the file name
-						if len(Data) > 0 {
-							iKey := 1
-							var Colname string
-							for f = range Data[0] {
-								if _, ok = fieldsMap1[f+1]; ok { //  the  field  of keys
-									prefixedHeaderRow = append(prefixedHeaderRow, fmt.Sprintf("key%d", iKey))
-									iKey++
-									continue
-								}
-								fbase := filepath.Base(file)
-								if trimeExtention {
-									fbase, _, _ = filepathTrimExtension2(fbase, nil)
-								}
-
-								Colname = fmt.Sprintf("c%d", f+1)
-								if onlyDuplicates {
-									if _, ok = mColnames[Colname]; ok {
-										newColname = fmt.Sprintf("%s-%s", fbase, Colname)
-									} else {
-										newColname = Colname
-										mColnames[Colname] = struct{}{}
-									}
-								} else {
-									newColname = fmt.Sprintf("%s-%s", fbase, Colname)
-								}
-
-								prefixedHeaderRow = append(prefixedHeaderRow, newColname)
-							}
-						}
-					} else {
-						var Colname string
-						for f, Colname = range headerRow {
-							if _, ok = fieldsMap1[f+1]; ok { //  the  field  of keys
-								prefixedHeaderRow = append(prefixedHeaderRow, Colname)
-								continue
-							}
-							fbase := filepath.Base(file)
-							if trimeExtention {
-								fbase, _, _ = filepathTrimExtension2(fbase, nil)
-							}
-
-							if onlyDuplicates {
-								if _, ok = mColnames[Colname]; ok {
-									newColname = fmt.Sprintf("%s-%s", fbase, Colname)
-								} else {
-									newColname = Colname
-									mColnames[Colname] = struct{}{}
-								}
-							} else {
-								newColname = fmt.Sprintf("%s-%s", fbase, Colname)
-							}
-
-							prefixedHeaderRow = append(prefixedHeaderRow, newColname)
-						}
-					}
-				}
-				if addSuffix {
-					fieldsMap1 := make(map[int]interface{}, len(fields))
-					for _, f = range fields {
-						fieldsMap1[f] = struct{}{}
-					}
-
-					if len(headerRow) == 0 { // no header row, we still create column names with the file name
-						if len(Data) > 0 {
-							iKey := 1
-							var Colname string
-							for f = range Data[0] {
-								if _, ok = fieldsMap1[f+1]; ok { //  the  field  of keys
-									suffixedHeaderRow = append(suffixedHeaderRow, fmt.Sprintf("key%d", iKey))
-									iKey++
-									continue
-								}
-
-								Colname = fmt.Sprintf("c%d", f+1)
-								if onlyDuplicates {
-									if _, ok = mColnames[Colname]; ok {
-										newColname = fmt.Sprintf("%s-%s", Colname, suffixes[i])
-									} else {
-										newColname = Colname
-										mColnames[Colname] = struct{}{}
-									}
-								} else {
-									newColname = fmt.Sprintf("%s-%s", Colname, suffixes[i])
-								}
-
-								suffixedHeaderRow = append(suffixedHeaderRow, newColname)
-							}
-						}
-					} else {
-						var Colname string
-						for f, Colname = range headerRow {
-							if _, ok = fieldsMap1[f+1]; ok { //  the  field  of keys
-								suffixedHeaderRow = append(suffixedHeaderRow, Colname)
-								continue
-							}
-
-							if onlyDuplicates {
-								if _, ok = mColnames[Colname]; ok {
-									newColname = fmt.Sprintf("%s-%s", Colname, suffixes[i])
-								} else {
-									newColname = Colname
-									mColnames[Colname] = struct{}{}
-								}
-							} else {
-								newColname = fmt.Sprintf("%s-%s", Colname, suffixes[i])
-							}
-
-							suffixedHeaderRow = append(suffixedHeaderRow, newColname)
-						}
-					}
-				}
 
-				firstFile = false
-				if len(HeaderRow) > 0 {
-					withHeaderRow = true
-				}
-
-				if !outerJoin {
-					continue
-				}
+			if crossJoin {
+				fields = nil
+			}
+			if predicate != nil {
+				checkError(predicate.setColumns(i, file, headerRow, ncols))
+			}
 
-				var nCols int
-				items = make([]string, len(fields))
-				for _, record := range Data {
-					nCols = len(record)
-					for i, f := range fields {
-						items[i] = record[f-1]
-					}
-					key = strings.Join(items, "_shenwei356_")
-					if ignoreNull && key == "" { // skip empty cell
-						continue
-					}
-					if ignoreCase {
-						key = strings.ToLower(key)
-					}
-					keys[key] = true
-				}
+			header.add(i, file, headerRow, fields, ncols)
+			if stats != nil {
+				keyCounts[i] = counts
+			}
 
-				fieldsMap := make(map[int]struct{}, len(fields))
-				for _, f := range fields {
-					fieldsMap[f] = struct{}{}
+			if first {
+				first, keepFirst = false, keep
+				Data, Fields, Nulls = records, fields, nulls
+				naRecord = make([]string, ncols)
+				for f := range naRecord {
+					naRecord[f] = naValues[i]
 				}
-				for key, ok = range keys {
-					if !ok {
-						record := make([]string, nCols)
-						items2 := strings.Split(key, "_shenwei356_")
-						j := 0
-						for i = range record {
-							if _, ok = fieldsMap[i+1]; ok {
-								record[i] = items2[j]
-								j++
-							} else {
-								record[i] = na
-							}
-						}
-						Data = append(Data, record)
+				if keepOthers {
+					complete = make([]bool, len(Data))
+					for r := range complete {
+						complete[r] = true
 					}
 				}
-
 				continue
 			}
 
@@ -378,177 +368,120 @@ Attention:
 			for _, f := range fields {
 				fieldsMap[f] = struct{}{}
 			}
-			// csv to map
-			keysMaps := make(map[string][][]string)
-			items = make([]string, len(fields))
-			for _, record := range data {
-				for i, f := range fields {
-					items[i] = record[f-1]
-				}
-				key = strings.Join(items, "_shenwei356_")
-				if ignoreNull && key == "" { // skip empty cell
+			nNonKeys := ncols - len(fieldsMap)
+
+			Data2 := make([][]string, 0, len(Data))
+			var complete2 []bool
+			var keysInData map[string]struct{}
+			if keepOthers {
+				complete2 = make([]bool, 0, len(Data))
+				keysInData = make(map[string]struct{}, len(Data))
+			}
+			for r, record0 := range Data {
+				if Nulls != nil && Nulls[r] { // skip empty cell
 					continue
 				}
-				if ignoreCase {
-					key = strings.ToLower(key)
-				}
-				if _, ok = keysMaps[key]; !ok {
-					keysMaps[key] = [][]string{}
+				key, _ = keyEncoder.key(record0, Fields)
+				if keepOthers {
+					keysInData[key] = struct{}{}
 				}
-				keysMaps[key] = append(keysMaps[key], record)
-			}
-
-			Data2 := [][]string{}
-			var colname string
-			if withHeaderRow {
-				newHeaderRow := HeaderRow
-				for f, colname = range headerRow {
-					if _, ok = fieldsMap[f+1]; !ok {
-						newHeaderRow = append(newHeaderRow, colname)
-
-						if filenameAsPrefix {
-							fbase := filepath.Base(file)
-							if trimeExtention {
-								fbase, _, _ = filepathTrimExtension2(fbase, nil)
-							}
-
-							if onlyDuplicates {
-								if _, ok = mColnames[colname]; ok {
-									newColname = fmt.Sprintf("%s-%s", fbase, colname)
-								} else {
-									newColname = colname
-									mColnames[colname] = struct{}{}
-								}
-							} else {
-								newColname = fmt.Sprintf("%s-%s", fbase, colname)
-							}
+				matched = false
+				if records2, ok = keysMaps[key]; ok {
+					for _, record2 = range records2 {
+						if predicate != nil && !predicate.eval(record0, record2) {
+							continue
+						}
+						matched = true
 
-							prefixedHeaderRow = append(prefixedHeaderRow, newColname)
-						} else if addSuffix {
-							if onlyDuplicates {
-								if _, ok = mColnames[colname]; ok {
-									newColname = fmt.Sprintf("%s-%s", colname, suffixes[i])
-								} else {
-									newColname = colname
-									mColnames[colname] = struct{}{}
-								}
-							} else {
-								newColname = fmt.Sprintf("%s-%s", colname, suffixes[i])
+						record := make([]string, len(record0), len(record0)+nNonKeys)
+						copy(record, record0)
+						for f, v := range record2 {
+							if _, ok = fieldsMap[f+1]; !ok {
+								record = append(record, v)
 							}
-
-							suffixedHeaderRow = append(suffixedHeaderRow, newColname)
 						}
-
+						Data2 = append(Data2, record)
+						if keepOthers {
+							complete2 = append(complete2, complete[r])
+						}
 					}
 				}
-				HeaderRow = newHeaderRow
-			} else if filenameAsPrefix {
-				if len(Data) > 0 {
-					var Colname string
-					for f, colname = range data[0] {
-						if _, ok = fieldsMap[f+1]; !ok {
-							fbase := filepath.Base(file)
-							if trimeExtention {
-								fbase, _, _ = filepathTrimExtension2(fbase, nil)
-							}
-
-							Colname = fmt.Sprintf("c%d", f+1)
-							if onlyDuplicates {
-								if _, ok = mColnames[Colname]; ok {
-									newColname = fmt.Sprintf("%s-%s", fbase, Colname)
-								} else {
-									newColname = Colname
-									mColnames[Colname] = struct{}{}
-								}
-							} else {
-								newColname = fmt.Sprintf("%s-%s", fbase, Colname)
-							}
+				if matched || !(keepFirst || keepOthers) {
+					continue
+				}
+				record := make([]string, len(record0), len(record0)+nNonKeys)
+				copy(record, record0)
+				for k := 0; k < nNonKeys; k++ {
+					record = append(record, naValues[i])
+				}
+				Data2 = append(Data2, record)
+				if keepOthers {
+					complete2 = append(complete2, false)
+				}
+			}
 
-							prefixedHeaderRow = append(prefixedHeaderRow, newColname)
-						}
+			// records with keys not existing in previous files, in order of appearance
+			if keepOthers {
+				for r, record2 := range records {
+					if _, ok = keysInData[keys[r]]; ok {
+						continue
 					}
-				}
-			} else if addSuffix {
-				if len(Data) > 0 {
-					var Colname string
-					for f, colname = range data[0] {
+					record := make([]string, len(naRecord), len(naRecord)+nNonKeys)
+					copy(record, naRecord)
+					for k, f := range Fields {
+						record[f-1] = record2[fields[k]-1]
+					}
+					for f, v := range record2 {
 						if _, ok = fieldsMap[f+1]; !ok {
-							Colname = fmt.Sprintf("c%d", f+1)
-							if onlyDuplicates {
-								if _, ok = mColnames[Colname]; ok {
-									newColname = fmt.Sprintf("%s-%s", Colname, suffixes[i])
-								} else {
-									newColname = Colname
-									mColnames[Colname] = struct{}{}
-								}
-							} else {
-								newColname = fmt.Sprintf("%s-%s", Colname, suffixes[i])
-							}
-
-							suffixedHeaderRow = append(suffixedHeaderRow, newColname)
+							record = append(record, v)
 						}
 					}
+					Data2 = append(Data2, record)
+					complete2 = append(complete2, false)
 				}
 			}
 
-			items = make([]string, len(Fields))
-			var records [][]string
-			var record2 []string
-			for _, record0 := range Data {
-				for i, f := range Fields {
-					items[i] = record0[f-1]
-				}
-				key = strings.Join(items, "_shenwei356_")
-				if ignoreNull && key == "" { // skip empty cell
-					continue
-				}
-				if ignoreCase {
-					key = strings.ToLower(key)
-				}
-				if records, ok = keysMaps[key]; ok {
-					for _, record2 = range records {
-						record := make([]string, len(record0))
-						copy(record, record0)
-						for f, v := range record2 {
-							if _, ok = fieldsMap[f+1]; !ok {
-								record = append(record, v)
-							}
-						}
-						Data2 = append(Data2, record)
-					}
-				} else {
-					if keepUnmatched {
-						record := make([]string, len(record0))
-						copy(record, record0)
-						for i = 1; i <= len(data[0])-len(fieldsMap); i++ {
-							record = append(record, na)
-						}
-						Data2 = append(Data2, record)
+			for k := 0; k < nNonKeys; k++ {
+				naRecord = append(naRecord, naValues[i])
+			}
+			Data, Nulls, complete = Data2, nil, complete2
+		}
+
+		// remove unmatched records of keys not existing in any kept files
+		if keepOthers {
+			n := 0
+			for r, record := range Data {
+				if !complete[r] {
+					key, _ = keyEncoder.key(record, Fields)
+					if _, ok = keptKeys[key]; !ok {
+						continue
 					}
 				}
+				Data[n] = record
+				n++
 			}
-			Data = Data2
+			Data = Data[:n]
 		}
 
 		if !config.NoOutHeader {
-			if withHeaderRow {
-				if filenameAsPrefix {
-					checkError(writer.Write(prefixedHeaderRow))
-				} else if addSuffix {
-					checkError(writer.Write(suffixedHeaderRow))
-				} else {
-					checkError(writer.Write(HeaderRow))
-				}
-			} else if filenameAsPrefix {
-				checkError(writer.Write(prefixedHeaderRow))
-			} else if addSuffix {
-				checkError(writer.Write(suffixedHeaderRow))
+			if headerRow := header.row(); headerRow != nil {
+				checkError(writer.Write(headerRow))
 			}
 		}
 		for _, record := range Data {
 			checkError(writer.Write(record))
 		}
 
+		if stats != nil {
+			stats.countKeys(keyCounts)
+			outKeys := make(map[string]struct{}, len(Data))
+			for _, record := range Data {
+				key, _ = keyEncoder.key(record, Fields)
+				outKeys[key] = struct{}{}
+			}
+			stats.OutputRows = int64(len(Data))
+			stats.OutputKeys = int64(len(outKeys))
+		}
 	},
 }
 
@@ -558,14 +491,804 @@ func init() {
 		`if given one, we think all the files have the same key columns. `+
 		`Fields of different files should be separated by ";", e.g -f "1;2" or -f "A,B;C,D" or -f id`)
 	joinCmd.Flags().BoolP("ignore-case", "i", false, `ignore case`)
+	joinCmd.Flags().BoolP("natural", "", false, `natural join, using column names shared by all files as key fields, exclusive with -f/--fields`)
 	joinCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
 	joinCmd.Flags().BoolP("keep-unmatched", "k", false, `keep unmatched data of the first file (left join)`)
 	joinCmd.Flags().BoolP("left-join", "L", false, `left join, equals to -k/--keep-unmatched, exclusive with --outer-join`)
 	joinCmd.Flags().BoolP("outer-join", "O", false, `outer join, exclusive with --left-join`)
-	joinCmd.Flags().StringP("na", "", "", "content for filling NA data")
-	joinCmd.Flags().BoolP("ignore-null", "n", false, "do not match NULL values")
+	joinCmd.Flags().StringP("na", "", "", `content for filling NA data. values for different files could be separated by ";", e.g., --na "NA;0;-", `+
+		`the value is used for all files if the number of values does not match the number of files`)
+	joinCmd.Flags().StringP("keep-unmatched-of", "", "", `keep unmatched data of these files (1-based indexes), e.g., --keep-unmatched-of 1,3. `+
+		`"-k" equals to "--keep-unmatched-of 1", and "-O" keeps unmatched data of all files`)
+	joinCmd.Flags().BoolP("ignore-null", "n", false, "do not match NULL values, i.e., records with any empty key field")
+	joinCmd.Flags().StringP("key-sep", "", "", "separator for joining values of multiple key fields into a key, "+
+		"an error is reported if any value contains it. by default, an internal encoding is used which never collides with real data")
+	joinCmd.Flags().StringP("key-transform", "", "", `comma separated functions applied to values of key fields in order before comparison, `+
+		`output values are not changed. available: trim, lower, upper, strip-zeros (leading zeros), numeric (compare as numbers). `+
+		`e.g., --key-transform trim,upper`)
 	joinCmd.Flags().BoolP("prefix-filename", "p", false, "add each filename as a prefix to each colname. if there's no header row, we'll add one")
 	joinCmd.Flags().BoolP("prefix-trim-ext", "e", false, "trim extension when adding filename as colname prefix")
 	joinCmd.Flags().BoolP("only-duplicates", "P", false, "add filenames as colname prefixes or add custom suffixes only for duplicated colnames")
 	joinCmd.Flags().StringSliceP("suffix", "s", []string{}, "add suffixes to colnames from each file")
+
+	joinCmd.Flags().StringP("keep-fields", "", "", `only keep key columns and these columns of some files, to reduce memory usage, `+
+		`e.g., --keep-fields "2:colA,colB;3:score" keeps "colA" and "colB" of the 2nd file and "score" of the 3rd file. `+
+		`column numbers are also supported, and fuzzy names for -F/--fuzzy-fields`)
+	joinCmd.Flags().StringP("where", "", "", `expression evaluated for each pair of records with equal keys (all pairs if -f/--fields is not given) of two files, `+
+		`columns are referred as "a.column" and "b.column", e.g., --where 'a.start <= b.pos && b.pos <= a.end'`)
+	joinCmd.Flags().BoolP("stats", "", false, `print statistics to stderr, including numbers of rows read from each file, matched and unmatched rows, `+
+		`rows expanded by duplicated keys, and peak memory`)
+	joinCmd.Flags().StringP("stats-file", "", "", `write statistics to a JSON file`)
+	joinCmd.Flags().BoolP("spill-to-disk", "", false, "sort records by keys with temporary files and merge them, for large files which could not fit in RAM. "+
+		"output records are ordered by keys")
+	joinCmd.Flags().StringP("buffer-size", "", "256M", `size of records of all files kept in memory before spilling to disk, supported units: K, M, G`)
+	joinCmd.Flags().StringP("temp-dir", "", "", `directory for temporary files (default: the system temporary directory)`)
+}
+
+// naturalJoinFields returns the column names shared by all files,
+// in the order of the first file.
+func naturalJoinFields(config Config, files []string) string {
+	if config.NoHeaderRow {
+		checkError(fmt.Errorf("flag --natural is not allowed with -H/--no-header-row"))
+	}
+
+	var shared []string
+	var counts map[string]int
+	var n int
+	for _, file := range files {
+		if isStdin(file) {
+			checkError(fmt.Errorf("stdin not allowed when using --natural"))
+		}
+		headerRow, err := readHeaderRow(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk join: skipping empty input file: %s", file)
+				}
+				continue
+			}
+			checkError(err)
+		}
+
+		if shared == nil {
+			shared = headerRow
+			counts = make(map[string]int, len(headerRow))
+		}
+		n++
+		seen := make(map[string]struct{}, len(headerRow))
+		for _, col := range headerRow {
+			if _, ok := seen[col]; ok {
+				continue
+			}
+			seen[col] = struct{}{}
+			counts[col]++
+		}
+	}
+
+	fields := make([]string, 0, len(shared))
+	for _, col := range shared {
+		if counts[col] == n {
+			if strings.Contains(col, ",") {
+				checkError(fmt.Errorf("shared column name with comma is not supported by --natural: %s", col))
+			}
+			fields = append(fields, col)
+			counts[col] = 0 // in case of duplicated column names
+		}
+	}
+	if len(fields) == 0 {
+		checkError(fmt.Errorf("no shared column names found in all files"))
+	}
+
+	if config.Verbose {
+		log.Infof("key fields detected for natural join: %s", strings.Join(fields, ", "))
+	}
+	return strings.Join(fields, ",")
+}
+
+// joinHeader builds the header row of joined data.
+type joinHeader struct {
+	filenameAsPrefix bool
+	trimExtension    bool
+	onlyDuplicates   bool
+	suffixes         []string
+
+	added         bool
+	withHeaderRow bool // whether the first file has a header row
+	headerRow     []string
+	renamed       []string // column names with filename prefixes or suffixes
+	colnames      map[string]interface{}
+}
+
+func (h *joinHeader) renaming() bool {
+	return h.filenameAsPrefix || len(h.suffixes) > 0
+}
+
+func (h *joinHeader) rename(i int, file string, colname string) string {
+	if h.onlyDuplicates {
+		if h.colnames == nil {
+			h.colnames = make(map[string]interface{}, 8)
+		}
+		if _, ok := h.colnames[colname]; !ok {
+			h.colnames[colname] = struct{}{}
+			return colname
+		}
+	}
+
+	if h.filenameAsPrefix {
+		fbase := filepath.Base(file)
+		if h.trimExtension {
+			fbase, _, _ = filepathTrimExtension2(fbase, nil)
+		}
+		return fmt.Sprintf("%s-%s", fbase, colname)
+	}
+	return fmt.Sprintf("%s-%s", colname, h.suffixes[i])
+}
+
+// add appends column names of the i-th file.
+// fields are the key fields (1-based), and ncols is the number of columns.
+func (h *joinHeader) add(i int, file string, headerRow []string, fields []int, ncols int) {
+	isKey := make(map[int]struct{}, len(fields))
+	for _, f := range fields {
+		isKey[f] = struct{}{}
+	}
+	var ok bool
+
+	if !h.added { // the first file
+		h.added = true
+		h.withHeaderRow = len(headerRow) > 0
+		h.headerRow = make([]string, len(headerRow), len(headerRow)+128)
+		copy(h.headerRow, headerRow)
+
+		if !h.renaming() {
+			return
+		}
+		h.renamed = make([]string, 0, 128)
+
+		if h.withHeaderRow {
+			for f, colname := range headerRow {
+				if _, ok = isKey[f+1]; ok { //  the  field  of keys
+					h.renamed = append(h.renamed, colname)
+					continue
+				}
+				h.renamed = append(h.renamed, h.rename(i, file, colname))
+			}
+			return
+		}
+
+		// no header row, we still create column names with the file name
+		iKey := 1
+		for f := 0; f < ncols; f++ {
+			if _, ok = isKey[f+1]; ok {
+				h.renamed = append(h.renamed, fmt.Sprintf("key%d", iKey))
+				iKey++
+				continue
+			}
+			h.renamed = append(h.renamed, h.rename(i, file, fmt.Sprintf("c%d", f+1)))
+		}
+		return
+	}
+
+	if h.withHeaderRow {
+		for f, colname := range headerRow {
+			if _, ok = isKey[f+1]; ok {
+				continue
+			}
+			h.headerRow = append(h.headerRow, colname)
+			if h.renaming() {
+				h.renamed = append(h.renamed, h.rename(i, file, colname))
+			}
+		}
+		return
+	}
+
+	if !h.renaming() {
+		return
+	}
+	for f := 0; f < ncols; f++ {
+		if _, ok = isKey[f+1]; ok {
+			continue
+		}
+		h.renamed = append(h.renamed, h.rename(i, file, fmt.Sprintf("c%d", f+1)))
+	}
+}
+
+// row returns the header row, nil for no header row.
+func (h *joinHeader) row() []string {
+	if h.renaming() {
+		return h.renamed
+	}
+	if h.withHeaderRow {
+		return h.headerRow
+	}
+	return nil
+}
+
+// joinKeyEncoder encodes values of key fields into a key, see
+// csvtk.KeyEncoder. Errors are reported and the program exits.
+type joinKeyEncoder struct {
+	csvtk.KeyEncoder
+}
+
+// key returns the key of a record, and whether it's NULL.
+// fields are 1-based.
+func (e *joinKeyEncoder) key(record []string, fields []int) (string, bool) {
+	key, null, err := e.Key(record, fields)
+	checkError(err)
+	return key, null
+}
+
+type joinOpts struct {
+	Fields          []string // key fields of all files
+	FuzzyFields     bool
+	KeepFields      [][]string // columns to keep of each file
+	IgnoreCase      bool
+	IgnoreNull      bool
+	KeySep          string
+	KeyTransforms   []func(string) string
+	KeepUnmatched   bool     // keep unmatched records of the first file
+	KeepUnmatchedOf []bool   // keep unmatched records of these files
+	NA              []string // content for filling NA data of each file
+
+	TmpDir     string
+	BufferSize int64
+
+	Stats *joinStats // nil for no statistics
+}
+
+// joinInput is a file with records sorted by keys.
+type joinInput struct {
+	idx    int // index in the file list
+	file   string
+	fields []int // key fields
+	nonKey []int // 0-based indexes of non-key columns
+	ncols  int
+
+	sorter  *RecordSorter
+	records *SortedRecords
+	cur     *KeyedRecord
+}
+
+func (in *joinInput) next() {
+	var err error
+	in.cur, err = in.records.Next()
+	if err == io.EOF {
+		in.cur = nil
+		return
+	}
+	checkError(err)
+}
+
+// readJoinInput reads a file and calls fn for each data record, with key fields (1-based).
+// If keepFields is not empty, only key columns and these columns are kept,
+// and key fields are the positions in the kept columns.
+func readJoinInput(config Config, file string, fieldStr string, fuzzyFields bool,
+	keepFields []string, fn func(record []string, fields []int)) ([]string, []int, error) {
+
+	csvReader, err := newCSVReaderByConfig(config, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	csvReader.Read(ReadOption{
+		FieldStr:    fieldStr,
+		FuzzyFields: fuzzyFields,
+
+		DoNotAllowDuplicatedColumnName: true,
+	})
+
+	var headerRow []string
+	var fields []int
+	var cols []int // 0-based indexes of columns to keep, nil for all
+	checkFirstLine := true
+	for record := range csvReader.Ch {
+		if record.Err != nil {
+			checkError(record.Err)
+		}
+
+		if checkFirstLine {
+			checkFirstLine = false
+			fields = record.Fields
+			isHeaderRow := !config.NoHeaderRow || record.IsHeaderRow
+
+			if len(keepFields) > 0 {
+				cols, fields = joinKeptColumns(file, record.All, isHeaderRow, fields, keepFields, fuzzyFields)
+			}
+
+			if isHeaderRow {
+				headerRow = projectRecord(record.All, cols)
+				continue
+			}
+		}
+
+		fn(projectRecord(record.All, cols), fields)
+	}
+	readerReport(&config, csvReader, file)
+
+	return headerRow, fields, nil
+}
+
+// joinKeptColumns returns 0-based indexes of key columns and columns in keepFields,
+// and the new positions (1-based) of key fields in these columns.
+func joinKeptColumns(file string, row []string, isHeaderRow bool, fields []int,
+	keepFields []string, fuzzyFields bool) ([]int, []int) {
+
+	selected := make(map[int]struct{}, len(fields)+len(keepFields))
+	for _, f := range fields {
+		selected[f-1] = struct{}{}
+	}
+
+	var matched bool
+	for _, col := range keepFields {
+		if reIntegers.MatchString(col) {
+			f, _ := strconv.Atoi(col)
+			if f < 1 || f > len(row) {
+				checkError(fmt.Errorf(`field (%d) out of range (%d) in file: %s`, f, len(row), file))
+			}
+			selected[f-1] = struct{}{}
+			continue
+		}
+
+		if !isHeaderRow {
+			checkError(fmt.Errorf("column names are not allowed in flag --keep-fields for files without header row: %s", col))
+		}
+		matched = false
+		if fuzzyFields {
+			re := fuzzyField2Regexp(col)
+			for i, colname := range row {
+				if re.MatchString(colname) {
+					selected[i] = struct{}{}
+					matched = true
+				}
+			}
+		} else {
+			for i, colname := range row {
+				if colname == col {
+					selected[i] = struct{}{}
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			checkError(fmt.Errorf(`column "%s" not existed in file: %s`, col, file))
+		}
+	}
+
+	cols := make([]int, 0, len(selected))
+	for i := range selected {
+		cols = append(cols, i)
+	}
+	sort.Ints(cols)
+
+	pos := make(map[int]int, len(cols))
+	for j, i := range cols {
+		pos[i] = j
+	}
+	fields2 := make([]int, len(fields))
+	for k, f := range fields {
+		fields2[k] = pos[f-1] + 1
+	}
+	return cols, fields2
+}
+
+// projectRecord returns values of selected columns, or the record itself for nil cols.
+// Values are copied so that the memory of the whole record can be released.
+func projectRecord(record []string, cols []int) []string {
+	if cols == nil {
+		return record
+	}
+	record2 := make([]string, len(cols))
+	for j, i := range cols {
+		record2[j] = strings.Clone(record[i])
+	}
+	return record2
+}
+
+// joinBySorting sorts records of each file by keys with temporary files,
+// and then merges them. Each file is read only once.
+func joinBySorting(config Config, files []string, header *joinHeader, writer *csvWriter, opts joinOpts) {
+	inputs := make([]*joinInput, 0, len(files))
+	defer func() {
+		for _, in := range inputs {
+			checkError(in.sorter.Close())
+		}
+	}()
+
+	keyEncoder := &joinKeyEncoder{csvtk.KeyEncoder{Sep: opts.KeySep, IgnoreCase: opts.IgnoreCase, IgnoreNull: opts.IgnoreNull,
+		Transforms: opts.KeyTransforms}}
+
+	// the buffer is shared by all files
+	bufSize := opts.BufferSize / int64(len(files))
+	if bufSize < 1 {
+		bufSize = 1
+	}
+
+	var key string
+	var null bool
+	for i, file := range files {
+		in := &joinInput{
+			idx:    i,
+			file:   file,
+			sorter: NewRecordSorter(opts.TmpDir, bufSize, nil),
+		}
+		headerRow, fields, err := readJoinInput(config, file, opts.Fields[i], opts.FuzzyFields, opts.KeepFields[i],
+			func(record []string, fields []int) {
+				if in.ncols == 0 {
+					in.ncols = len(record)
+				}
+				if opts.Stats != nil {
+					opts.Stats.Files[i].Rows++
+				}
+
+				key, null = keyEncoder.key(record, fields)
+				if null { // skip empty cell
+					if opts.Stats != nil {
+						opts.Stats.Files[i].NullKeyRows++
+					}
+					return
+				}
+				checkError(in.sorter.Add(&KeyedRecord{Key: key, Record: record}))
+			})
+		if err != nil {
+			checkError(in.sorter.Close())
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk join: skipping empty input file: %s", file)
+				}
+				continue
+			}
+			checkError(err)
+		}
+		in.fields = fields
+
+		if in.ncols == 0 {
+			if config.Verbose {
+				log.Warningf("no data found in file: %s", file)
+			}
+			checkError(in.sorter.Close())
+			continue
+		}
+
+		isKey := make(map[int]struct{}, len(in.fields))
+		for _, f := range in.fields {
+			isKey[f] = struct{}{}
+		}
+		in.nonKey = make([]int, 0, in.ncols)
+		for f := 0; f < in.ncols; f++ {
+			if _, ok := isKey[f+1]; !ok {
+				in.nonKey = append(in.nonKey, f)
+			}
+		}
+
+		header.add(i, file, headerRow, in.fields, in.ncols)
+		inputs = append(inputs, in)
+	}
+
+	if !config.NoOutHeader {
+		if headerRow := header.row(); headerRow != nil {
+			checkError(writer.Write(headerRow))
+		}
+	}
+
+	if len(inputs) == 0 {
+		return
+	}
+
+	// start position of each file in the output record
+	offsets := make([]int, len(inputs))
+	width := inputs[0].ncols
+	var err error
+	for j, in := range inputs {
+		if j > 0 {
+			offsets[j] = width
+			width += len(in.nonKey)
+		}
+
+		in.records, err = in.sorter.Sort()
+		checkError(err)
+		in.next()
+
+		if config.Verbose && in.sorter.NumRuns() > 0 {
+			log.Infof("%d temporary files created for file: %s", in.sorter.NumRuns(), in.file)
+		}
+	}
+
+	first := inputs[0]
+	row := make([]string, width)
+	groups := make([][][]string, len(inputs)) // records sharing the same key in each file
+
+	var emit func(j int)
+	emit = func(j int) {
+		if j == len(inputs) {
+			checkError(writer.Write(row))
+			if opts.Stats != nil {
+				opts.Stats.OutputRows++
+			}
+			return
+		}
+		in := inputs[j]
+		if len(groups[j]) == 0 { // unmatched
+			for k := range in.nonKey {
+				row[offsets[j]+k] = opts.NA[in.idx]
+			}
+			emit(j + 1)
+			return
+		}
+		for _, record := range groups[j] {
+			if j == 0 {
+				copy(row, record)
+			} else {
+				for k, f := range in.nonKey {
+					row[offsets[j]+k] = record[f]
+				}
+			}
+			emit(j + 1)
+		}
+	}
+
+	var found, matchedAll, keep bool
+	var src int
+	for {
+		// the smallest key
+		found = false
+		for _, in := range inputs {
+			if in.cur != nil && (!found || in.cur.Key < key) {
+				key = in.cur.Key
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+
+		matchedAll = true
+		src = -1
+		for j, in := range inputs {
+			groups[j] = groups[j][:0]
+			for in.cur != nil && in.cur.Key == key {
+				groups[j] = append(groups[j], in.cur.Record)
+				in.next()
+			}
+			if len(groups[j]) == 0 {
+				matchedAll = false
+			} else if src < 0 {
+				src = j
+			}
+		}
+
+		if opts.Stats != nil {
+			for j, in := range inputs {
+				fs := opts.Stats.Files[in.idx]
+				if matchedAll {
+					fs.MatchedRows += int64(len(groups[j]))
+				} else {
+					fs.UnmatchedRows += int64(len(groups[j]))
+				}
+				if len(groups[j]) > 1 {
+					fs.DuplicatedKeys++
+				}
+			}
+		}
+
+		if !matchedAll {
+			keep = opts.KeepUnmatched && len(groups[0]) > 0
+			for j, in := range inputs {
+				if keep {
+					break
+				}
+				keep = opts.KeepUnmatchedOf[in.idx] && len(groups[j]) > 0
+			}
+			if !keep {
+				continue
+			}
+		}
+
+		if len(groups[0]) == 0 {
+			// a record of the first file with only key columns
+			record := make([]string, first.ncols)
+			for f := range record {
+				record[f] = opts.NA[first.idx]
+			}
+			srcRecord := groups[src][0]
+			for k, f := range first.fields {
+				record[f-1] = srcRecord[inputs[src].fields[k]-1]
+			}
+			groups[0] = append(groups[0], record)
+		}
+
+		emit(0)
+		if opts.Stats != nil {
+			opts.Stats.OutputKeys++
+		}
+	}
+}
+
+// joinPredicate is an expression evaluated for each pair of records of two files,
+// where columns of the two files are referred as "a.column" and "b.column".
+type joinPredicate struct {
+	where  string
+	expr   *govaluate.EvaluableExpression
+	vars   []*joinPredicateVar
+	params map[string]interface{}
+}
+
+type joinPredicateVar struct {
+	name   string // variable name in the expression
+	alias  int    // 0 for "a", 1 for "b"
+	column string
+	idx    int // 0-based index of the column
+}
+
+// string constants are matched to skip column references in them
+var reJoinPredicateVar = regexp.MustCompile(`'(?:\\.|[^'])*'|"(?:\\.|[^"])*"|\b([ab])\.(\$\{[^{}]+\}|\w+)`)
+
+func newJoinPredicate(where string) (*joinPredicate, error) {
+	p := &joinPredicate{where: where, params: make(map[string]interface{})}
+	vars := make(map[string]*joinPredicateVar)
+	expr := reJoinPredicateVar.ReplaceAllStringFunc(where, func(s string) string {
+		m := reJoinPredicateVar.FindStringSubmatch(s)
+		if m[1] == "" { // string constant
+			return s
+		}
+		if v, ok := vars[s]; ok {
+			return v.name
+		}
+		column := m[2]
+		if strings.HasPrefix(column, "${") {
+			column = column[2 : len(column)-1]
+		}
+		v := &joinPredicateVar{
+			name:   fmt.Sprintf("csvtk_join_var%d", len(p.vars)),
+			alias:  int(m[1][0] - 'a'),
+			column: column,
+		}
+		vars[s] = v
+		p.vars = append(p.vars, v)
+		return v.name
+	})
+	if len(p.vars) == 0 {
+		return nil, fmt.Errorf(`no columns referred in the expression of --where, please use "a.column" and "b.column": %s`, where)
+	}
+
+	var err error
+	p.expr, err = govaluate.NewEvaluableExpression(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression of --where: %s: %s", where, err)
+	}
+	return p, nil
+}
+
+// setColumns locates columns referred by the alias of the i-th file,
+// by column names, or column numbers if the file has no header row.
+func (p *joinPredicate) setColumns(i int, file string, headerRow []string, ncols int) error {
+	colnames := make(map[string]int, len(headerRow))
+	for j, colname := range headerRow {
+		colnames[colname] = j
+	}
+	var ok bool
+	var n int
+	var err error
+	for _, v := range p.vars {
+		if v.alias != i {
+			continue
+		}
+		if v.idx, ok = colnames[v.column]; ok {
+			continue
+		}
+		n, err = strconv.Atoi(v.column)
+		if err != nil || n < 1 || n > ncols {
+			return fmt.Errorf("column %q referred in --where not found in file: %s", v.column, file)
+		}
+		v.idx = n - 1
+	}
+	return nil
+}
+
+// eval evaluates the expression for a pair of records.
+func (p *joinPredicate) eval(records ...[]string) bool {
+	var value string
+	for _, v := range p.vars {
+		value = records[v.alias][v.idx]
+		if reDigitals.MatchString(value) {
+			if f, err := strconv.ParseFloat(removeComma(value), 64); err == nil {
+				p.params[v.name] = f
+				continue
+			}
+		}
+		p.params[v.name] = value
+	}
+	result, err := p.expr.Evaluate(p.params)
+	if err != nil {
+		checkError(fmt.Errorf("failed to evaluate the expression of --where: %s: %s", p.where, err))
+	}
+	ok, isBool := result.(bool)
+	if !isBool {
+		checkError(fmt.Errorf("the expression of --where should return a boolean value: %s", p.where))
+	}
+	return ok
+}
+
+// joinStats is the statistics of a join.
+type joinStats struct {
+	Files        []*joinFileStats `json:"files"`
+	OutputRows   int64            `json:"output_rows"`
+	OutputKeys   int64            `json:"output_keys"`
+	ExpandedRows int64            `json:"expanded_rows"` // extra output rows caused by duplicated keys
+	PeakMemory   uint64           `json:"peak_memory"`   // bytes of memory obtained from the OS
+}
+
+type joinFileStats struct {
+	File           string `json:"file"`
+	Rows           int64  `json:"rows"`
+	NullKeyRows    int64  `json:"null_key_rows"`
+	MatchedRows    int64  `json:"matched_rows"` // rows with keys existing in all other files
+	UnmatchedRows  int64  `json:"unmatched_rows"`
+	DuplicatedKeys int64  `json:"duplicated_keys"` // keys shared by multiple rows
+}
+
+func newJoinStats(files []string) *joinStats {
+	s := &joinStats{Files: make([]*joinFileStats, len(files))}
+	for i, file := range files {
+		s.Files[i] = &joinFileStats{File: file}
+	}
+	return s
+}
+
+// countKeys computes matched and unmatched rows from numbers of records
+// of each key in each file. nil maps are for files with no data.
+func (s *joinStats) countKeys(keyCounts []map[string]int) {
+	var all, ok bool
+	for i, counts := range keyCounts {
+		if counts == nil {
+			continue
+		}
+		fs := s.Files[i]
+		for key, n := range counts {
+			all = true
+			for j, counts2 := range keyCounts {
+				if j == i || counts2 == nil {
+					continue
+				}
+				if _, ok = counts2[key]; !ok {
+					all = false
+					break
+				}
+			}
+			if all {
+				fs.MatchedRows += int64(n)
+			} else {
+				fs.UnmatchedRows += int64(n)
+			}
+			if n > 1 {
+				fs.DuplicatedKeys++
+			}
+		}
+	}
+}
+
+// report prints the statistics to stderr, and/or writes them to a JSON file.
+func (s *joinStats) report(toStderr bool, file string) {
+	s.ExpandedRows = s.OutputRows - s.OutputKeys
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s.PeakMemory = m.Sys
+
+	if toStderr {
+		for _, fs := range s.Files {
+			log.Infof("join stats: %s: rows: %d, matched rows: %d, unmatched rows: %d, rows with NULL keys: %d, duplicated keys: %d",
+				fs.File, fs.Rows, fs.MatchedRows, fs.UnmatchedRows, fs.NullKeyRows, fs.DuplicatedKeys)
+		}
+		log.Infof("join stats: output rows: %d, output keys: %d, rows expanded by duplicated keys: %d",
+			s.OutputRows, s.OutputKeys, s.ExpandedRows)
+		log.Infof("join stats: peak memory: %s", humanize.Bytes(s.PeakMemory))
+	}
+
+	if file != "" {
+		outfh, err := xopen.Wopen(file)
+		checkError(err)
+		defer outfh.Close()
+
+		data, err := json.MarshalIndent(s, "", "  ")
+		checkError(err)
+		_, err = outfh.Write(append(data, '\n'))
+		checkError(err)
+	}
 }
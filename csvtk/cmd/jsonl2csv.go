@@ -0,0 +1,423 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// jsonl2csvCmd represents the jsonl2csv command
+var jsonl2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "jsonl2csv",
+	Short: "convert JSON Lines (NDJSON) to CSV format",
+	Long: `convert JSON Lines (NDJSON) to CSV format
+
+Each line (or each top-level value in concatenated JSON) should be a JSON object.
+Nested objects are flattened with keys joined by --flatten-sep, e.g.,
+{"user": {"name": "a", "id": 1}} is converted to columns "user.name" and "user.id".
+
+Arrays are handled according to --array-mode:
+  join      join elements with --array-sep, nested values are output as JSON
+  explode   output one row for each element, arrays of objects are flattened
+  json      output arrays as JSON text
+
+Columns are ordered by their first appearance, so all records are kept in
+memory. Use -k/--keys to choose columns, and records are converted in a
+streaming way in this case.
+
+Null values and missing keys are converted to empty strings, or the value of --na.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		keys := getFlagCommaSeparatedStrings(cmd, "keys")
+		na := getFlagString(cmd, "na")
+		f := &jsonFlattener{
+			sep:      getFlagString(cmd, "flatten-sep"),
+			arraySep: getFlagString(cmd, "array-sep"),
+			mode:     strings.ToLower(getFlagString(cmd, "array-mode")),
+			index:    make(map[string]int, 64),
+		}
+		switch f.mode {
+		case "join", "explode", "json":
+		default:
+			checkError(fmt.Errorf("invalid value of flag --array-mode: %s. available: join, explode, json", f.mode))
+		}
+		streaming := len(keys) > 0
+		for _, key := range keys {
+			f.addKey(key)
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if streaming && !config.NoOutHeader {
+			checkError(writer.Write(keys))
+		}
+
+		toRecord := func(row map[string]string, record []string) []string {
+			record = record[:0]
+			var v string
+			var ok bool
+			for _, key := range f.keys {
+				if v, ok = row[key]; !ok {
+					v = na
+				}
+				record = append(record, v)
+			}
+			return record
+		}
+
+		rows := make([]map[string]string, 0, 1024)
+		record := make([]string, 0, 64)
+		for _, file := range files {
+			fh, err := ropen(file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk jsonl2csv: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			dec := json.NewDecoder(bufio.NewReader(fh))
+			dec.UseNumber()
+			var n int
+			for {
+				v, err := decodeOrderedJSON(dec)
+				if err == io.EOF {
+					break
+				}
+				n++
+				if err != nil {
+					checkError(fmt.Errorf("[%s] failed to parse the %d-th JSON value: %s", file, n, err))
+				}
+				obj, ok := v.(*jsonObject)
+				if !ok {
+					checkError(fmt.Errorf("[%s] the %d-th JSON value is not an object", file, n))
+				}
+
+				for _, row := range f.flatten(obj, "", !streaming) {
+					if streaming {
+						checkError(writer.Write(toRecord(row, record)))
+					} else {
+						rows = append(rows, row)
+					}
+				}
+			}
+			checkError(fh.Close())
+		}
+
+		if streaming {
+			return
+		}
+		if !config.NoOutHeader && len(f.keys) > 0 {
+			checkError(writer.Write(f.keys))
+		}
+		for _, row := range rows {
+			checkError(writer.Write(toRecord(row, record)))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(jsonl2csvCmd)
+	jsonl2csvCmd.Flags().StringP("flatten-sep", "s", ".", `separator for joining keys of nested objects`)
+	jsonl2csvCmd.Flags().StringP("array-mode", "a", "join", `how to handle arrays: join, explode, json`)
+	jsonl2csvCmd.Flags().StringP("array-sep", "S", ";", `separator for joining elements of arrays in the "join" mode`)
+	jsonl2csvCmd.Flags().StringP("keys", "k", "", `comma separated (flattened) keys to output, records are converted in a streaming way if given`)
+	jsonl2csvCmd.Flags().StringP("na", "", "", `content for null values and missing keys`)
+}
+
+// jsonFlattener flattens JSON objects into rows.
+type jsonFlattener struct {
+	sep      string
+	arraySep string
+	mode     string // how to handle arrays: join, explode, json
+
+	keys  []string // keys in order of first appearance
+	index map[string]int
+}
+
+func (f *jsonFlattener) addKey(key string) {
+	if _, ok := f.index[key]; !ok {
+		f.index[key] = len(f.keys)
+		f.keys = append(f.keys, key)
+	}
+}
+
+// flatten returns rows of a JSON value. There are multiple rows only for
+// exploded arrays. Keys are recorded if addKeys is true.
+func (f *jsonFlattener) flatten(v interface{}, prefix string, addKeys bool) []map[string]string {
+	switch v := v.(type) {
+	case *jsonObject:
+		rows := []map[string]string{{}}
+		for i, key := range v.keys {
+			if prefix != "" {
+				key = prefix + f.sep + key
+			}
+			rows = crossJSONRows(rows, f.flatten(v.values[i], key, addKeys))
+		}
+		return rows
+	case []interface{}:
+		if f.mode == "explode" {
+			if len(v) == 0 {
+				return f.flatten(nil, prefix, addKeys)
+			}
+			rows := make([]map[string]string, 0, len(v))
+			for _, e := range v {
+				rows = append(rows, f.flatten(e, prefix, addKeys)...)
+			}
+			return rows
+		}
+		if addKeys {
+			f.addKey(prefix)
+		}
+		if f.mode == "json" {
+			return []map[string]string{{prefix: jsonText(v)}}
+		}
+		items := make([]string, len(v))
+		for i, e := range v {
+			switch e.(type) {
+			case *jsonObject, []interface{}:
+				items[i] = jsonText(e)
+			default:
+				items[i] = jsonScalar2String(e)
+			}
+		}
+		return []map[string]string{{prefix: strings.Join(items, f.arraySep)}}
+	case nil:
+		if addKeys {
+			f.addKey(prefix)
+		}
+		return []map[string]string{{}}
+	}
+
+	if addKeys {
+		f.addKey(prefix)
+	}
+	return []map[string]string{{prefix: jsonScalar2String(v)}}
+}
+
+// jsonObject is a JSON object with keys in the original order.
+type jsonObject struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+	b.WriteString("}")
+	return []byte(b.String()), nil
+}
+
+// decodeOrderedJSON decodes the next JSON value, where objects are
+// returned as *jsonObject to keep the order of keys.
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		o := &jsonObject{}
+		for dec.More() {
+			t, err = dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key of object: %v", t)
+			}
+			v, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			o.keys = append(o.keys, key)
+			o.values = append(o.values, v)
+		}
+		if _, err = dec.Token(); err != nil { // }
+			return nil, err
+		}
+		return o, nil
+	case json.Delim('['):
+		a := make([]interface{}, 0, 8)
+		for dec.More() {
+			v, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		if _, err = dec.Token(); err != nil { // ]
+			return nil, err
+		}
+		return a, nil
+	}
+	return t, nil
+}
+
+// crossJSONRows returns the cartesian product of two lists of rows.
+func crossJSONRows(a, b []map[string]string) []map[string]string {
+	if len(b) == 1 {
+		for _, row := range a {
+			for k, v := range b[0] {
+				row[k] = v
+			}
+		}
+		return a
+	}
+	rows := make([]map[string]string, 0, len(a)*len(b))
+	for _, r1 := range a {
+		for _, r2 := range b {
+			row := make(map[string]string, len(r1)+len(r2))
+			for k, v := range r1 {
+				row[k] = v
+			}
+			for k, v := range r2 {
+				row[k] = v
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func jsonScalar2String(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func jsonText(v interface{}) string {
+	data, err := json.Marshal(v)
+	checkError(err)
+	return string(data)
+}
+
+// newJSONLSource creates a source of records from a JSON Lines file,
+// with default options of jsonl2csv. All records are loaded into memory
+// to collect the keys.
+func newJSONLSource(config Config, file string) (*sliceSource, error) {
+	fh, err := ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	f := &jsonFlattener{sep: ".", arraySep: ";", mode: "join", index: make(map[string]int, 64)}
+
+	rows := make([]map[string]string, 0, 1024)
+	dec := json.NewDecoder(fh)
+	dec.UseNumber()
+	var n int
+	for {
+		v, err := decodeOrderedJSON(dec)
+		if err == io.EOF {
+			break
+		}
+		n++
+		if err != nil {
+			fh.Close()
+			return nil, fmt.Errorf("[%s] failed to parse the %d-th JSON value: %s", file, n, err)
+		}
+		obj, ok := v.(*jsonObject)
+		if !ok {
+			fh.Close()
+			return nil, fmt.Errorf("[%s] the %d-th JSON value is not an object", file, n)
+		}
+		rows = append(rows, f.flatten(obj, "", true)...)
+	}
+	if err = fh.Close(); err != nil {
+		return nil, err
+	}
+
+	records := make([][]string, 0, len(rows)+1)
+	if !config.NoHeaderRow {
+		records = append(records, f.keys)
+	}
+	for _, row := range rows {
+		record := make([]string, len(f.keys))
+		for i, key := range f.keys {
+			record[i] = row[key]
+		}
+		records = append(records, record)
+	}
+	return &sliceSource{records: records}, nil
+}
@@ -22,19 +22,26 @@ package cmd
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/araddon/dateparse"
 	"github.com/shenwei356/util/stringutil"
 	"github.com/spf13/cobra"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/text"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
 )
 
 // lineCmd represents the line command
@@ -47,10 +54,33 @@ Notes:
 
   1. Output file can be set by flag -o/--out-file.
   2. File format is determined by the out file suffix.
-     Supported formats: eps, jpg|jpeg, pdf, png, svg, and tif|tiff
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, html, and terminal
   3. If flag -o/--out-file not set (default), image is written to stdout,
      you can display the image by pipping to "display" command of Imagemagic
      or just redirect to file.
+  4. The html format outputs an interactive chart, see "csvtk plot -h".
+  5. The terminal format draws the plot in the terminal, see "csvtk plot -h".
+
+Multiple series:
+
+  Multiple columns can be given to -y/--data-field-y, e.g., -y a,b, each
+  column is plotted as a series. Columns in --data-field-y2 are plotted
+  against a secondary Y axis on the right side.
+
+Time series:
+
+  X values are parsed as date/time with --time-format, which could be
+    - "auto": parsed automatically, supported by https://github.com/araddon/dateparse
+    - a layout of Go, e.g., "2006-01-02 15:04:05"
+    - a strftime pattern, e.g., "%Y-%m-%d %H:%M:%S"
+  Times without time zones are treated as UTC.
+
+  Values of a series can be resampled into fixed-width bins of X with
+  --resample WIDTH:OP, e.g., "1h:mean", "15m:max", "1d:sum". For times,
+  WIDTH is a duration with units of ms, s, m, h, d and w, bins are aligned
+  to the Unix epoch (UTC). For numbers, WIDTH is a number.
+  OP is one of the numeric operations of "csvtk summary", e.g., sum, mean,
+  median, min, max and countn.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -86,14 +116,28 @@ Notes:
 		if dataFieldYStr == "" {
 			checkError(fmt.Errorf("flag -y (--data-field-y) needed"))
 		}
-		if strings.Contains(dataFieldYStr, ",") {
-			checkError(fmt.Errorf("only one field allowed for flag -y (--data-field-y)"))
-		}
-		if dataFieldXStr[0] == '-' {
+		if dataFieldYStr[0] == '-' {
 			checkError(fmt.Errorf("unselect not allowed for flag -y (--data-field-y)"))
 		}
+		nY := len(strings.Split(dataFieldYStr, ","))
+
+		dataFieldY2Str := getFlagString(cmd, "data-field-y2")
+		var nY2 int
+		if dataFieldY2Str != "" {
+			if dataFieldY2Str[0] == '-' {
+				checkError(fmt.Errorf("unselect not allowed for flag --data-field-y2"))
+			}
+			if plotConfig.scaleLnY {
+				checkError(fmt.Errorf("can't use --data-field-y2 and --y-scale-ln together"))
+			}
+			nY2 = len(strings.Split(dataFieldY2Str, ","))
+			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr + "," + dataFieldY2Str
+		} else {
+			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr
+		}
 
 		groupFieldStr := getFlagString(cmd, "group-field")
+		var iGroup int
 		if len(groupFieldStr) > 0 {
 			if strings.Contains(groupFieldStr, ",") {
 				checkError(fmt.Errorf("only one field allowed for flag --group-field"))
@@ -101,9 +145,8 @@ Notes:
 			if groupFieldStr[0] == '-' {
 				checkError(fmt.Errorf("unselect not allowed for flag --group-field"))
 			}
-			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr + "," + groupFieldStr
-		} else {
-			plotConfig.fieldStr = dataFieldXStr + "," + dataFieldYStr
+			plotConfig.fieldStr += "," + groupFieldStr
+			iGroup = 1 + nY + nY2
 		}
 
 		skipNA := getFlagBool(cmd, "skip-na")
@@ -121,8 +164,29 @@ Notes:
 			checkError(fmt.Errorf("can't use --data-field-x-nominal and --x-scale-ln together"))
 		}
 
+		timeFormat := getFlagString(cmd, "time-format")
+		isTime := timeFormat != ""
+		if isTime && nominal {
+			checkError(fmt.Errorf("can't use --data-field-x-nominal and --time-format together"))
+		}
+		var parseTime func(string) (float64, error)
+		if isTime {
+			parseTime = lineTimeParser(timeFormat)
+		}
+
+		var resampleWidth float64
+		var resampleFunc func([]float64) float64
+		if resample := getFlagString(cmd, "resample"); resample != "" {
+			if nominal {
+				checkError(fmt.Errorf("can't use --data-field-x-nominal and --resample together"))
+			}
+			var err error
+			resampleWidth, resampleFunc, err = parseLineResample(resample, isTime)
+			checkError(err)
+		}
+
 		file := files[0]
-		headerRow, fields, data, _, _, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, false)
+		headerRow, fields, data, headerRowAll, dataAll, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, plotConfig.facetFieldStr != "")
 
 		if err != nil {
 			// if err == xopen.ErrNoContent {
@@ -132,204 +196,477 @@ Notes:
 			checkError(err)
 		}
 
-		var xNominalValues []string
-		if nominal {
-			// Collect unique values
-			xNominalValues = make([]string, 0, len(data)/4) // Assume a quarter of the data is unique
-			for _, d := range data {
-				i, found := slices.BinarySearch(xNominalValues, d[0])
-				if !found {
-					// 0 alloc insert slice trick https://go.dev/wiki/SliceTricks#insert
-					xNominalValues = append(xNominalValues, "")
-					copy(xNominalValues[i+1:], xNominalValues[i:])
-					xNominalValues[i] = d[0]
-				}
-			}
+		if nY2 > 0 && plotConfig.facetFieldStr != "" {
+			checkError(fmt.Errorf("flag --data-field-y2 is not supported with --facet-by"))
 		}
 
-		// =======================================
-
-		groups := make(map[string]plotter.XYs)
-		groupOrderMap := make(map[string]int)
-		var x, y float64
-		var ok bool
-		var order int
-		var groupName string
+		var y2Axis *lineY2Axis
+		build := func(data [][]string) *plot.Plot {
+			nFields := 1 + nY + nY2
+			if iGroup > 0 {
+				nFields++
+			}
+			if (nY > 1 || nY2 > 0) && len(fields) != nFields {
+				checkError(fmt.Errorf("ranges or duplicated columns are not allowed for -y (--data-field-y) and --data-field-y2"))
+			}
 
-		for _, d := range data {
-			if skipNA {
-				if _, ok = naMap[strings.ToLower(d[0])]; ok {
-					continue
+			var xNominalValues []string
+			if nominal {
+				// Collect unique values
+				xNominalValues = make([]string, 0, len(data)/4) // Assume a quarter of the data is unique
+				for _, d := range data {
+					i, found := slices.BinarySearch(xNominalValues, d[0])
+					if !found {
+						// 0 alloc insert slice trick https://go.dev/wiki/SliceTricks#insert
+						xNominalValues = append(xNominalValues, "")
+						copy(xNominalValues[i+1:], xNominalValues[i:])
+						xNominalValues[i] = d[0]
+					}
 				}
 			}
 
-			if !nominal {
-				// X is considered a coordinate
-				x, err = strconv.ParseFloat(d[0], 64)
-				if err != nil {
-					if len(headerRow) > 0 {
-						checkError(fmt.Errorf("fail to parse X value: %s at column: %s. please choose the right column by flag --data-field-x or use --data-field-x-nominal", d[0], headerRow[0]))
-					} else {
-						checkError(fmt.Errorf("fail to parse X value: %s at column: %d. please choose the right column by flag --data-field-x or use --data-field-x-nominal", d[0], fields[0]))
-					}
+			// names of Y columns, for naming series of multiple columns
+			yNames := make([]string, nY+nY2)
+			for i := range yNames {
+				if len(headerRow) > i+1 {
+					yNames[i] = headerRow[i+1]
+				} else if len(fields) > i+1 {
+					yNames[i] = strconv.Itoa(fields[i+1])
 				}
-			} else {
-				// X is considered a nominal value
-				x = float64(slices.Index(xNominalValues, d[0]))
 			}
-			if len(d) > 1 {
+
+			// =======================================
+
+			groups := make(map[string]plotter.XYs)
+			groupOrderMap := make(map[string]int)
+			groupY2 := make(map[string]bool) // series on the secondary Y axis
+			var x, y float64
+			var ok bool
+			var order int
+			var groupName, seriesName string
+
+			for _, d := range data {
 				if skipNA {
-					if _, ok = naMap[strings.ToLower(d[1])]; ok {
+					if _, ok = naMap[strings.ToLower(d[0])]; ok {
 						continue
 					}
 				}
-				y, err = strconv.ParseFloat(d[1], 64)
-			} else {
-				y, err = strconv.ParseFloat(d[0], 64)
-			}
-			if err != nil {
-				if len(headerRow) > 0 {
-					checkError(fmt.Errorf("fail to parse Y value: %s at column: %s. please choose the right column by flag --data-field-y", d[1], headerRow[1]))
+
+				if isTime {
+					x, err = parseTime(d[0])
+					if err != nil {
+						checkError(fmt.Errorf("fail to parse date/time value: %s with --time-format: %s", d[0], timeFormat))
+					}
+				} else if !nominal {
+					// X is considered a coordinate
+					x, err = strconv.ParseFloat(d[0], 64)
+					if err != nil {
+						if len(headerRow) > 0 {
+							checkError(fmt.Errorf("fail to parse X value: %s at column: %s. please choose the right column by flag --data-field-x or use --data-field-x-nominal", d[0], headerRow[0]))
+						} else {
+							checkError(fmt.Errorf("fail to parse X value: %s at column: %d. please choose the right column by flag --data-field-x or use --data-field-x-nominal", d[0], fields[0]))
+						}
+					}
 				} else {
-					checkError(fmt.Errorf("fail to parse Y value: %s at column: %d. please choose the right column by flag --data-field-y", d[1], fields[1]))
+					// X is considered a nominal value
+					x = float64(slices.Index(xNominalValues, d[0]))
+				}
+				if plotConfig.scaleLnX && x <= 0 {
+					checkError(fmt.Errorf("non-positive X value: %s can't be plotted with --x-scale-ln", d[0]))
+				}
+
+				if iGroup > 0 {
+					groupName = d[iGroup]
+				} else {
+					groupName = ""
+				}
+
+				for j := 1; j <= nY+nY2; j++ {
+					var s string
+					if len(d) > j {
+						s = d[j]
+					} else {
+						s = d[0]
+					}
+					if skipNA {
+						if _, ok = naMap[strings.ToLower(s)]; ok {
+							continue
+						}
+					}
+					y, err = strconv.ParseFloat(s, 64)
+					if err != nil {
+						if len(headerRow) > j {
+							checkError(fmt.Errorf("fail to parse Y value: %s at column: %s. please choose the right column by flag --data-field-y", s, headerRow[j]))
+						} else {
+							checkError(fmt.Errorf("fail to parse Y value: %s at column: %d. please choose the right column by flag --data-field-y", s, fields[j]))
+						}
+					}
+					if plotConfig.scaleLnY && y <= 0 {
+						checkError(fmt.Errorf("non-positive Y value: %s can't be plotted with --y-scale-ln", s))
+					}
+
+					switch {
+					case nY+nY2 == 1:
+						seriesName = groupName
+					case iGroup > 0:
+						seriesName = yNames[j-1] + " (" + groupName + ")"
+					default:
+						seriesName = yNames[j-1]
+					}
+					groups[seriesName] = append(groups[seriesName], plotter.XY{X: x, Y: y})
+					if _, ok = groupOrderMap[seriesName]; !ok {
+						groupOrderMap[seriesName] = order
+						order++
+						groupY2[seriesName] = j > nY
+					}
 				}
 			}
 
-			if len(d) > 2 {
-				groupName = d[2]
-			} else {
-				groupName = ""
+			if resampleFunc != nil {
+				for g, v := range groups {
+					groups[g] = resampleXYs(v, resampleWidth, resampleFunc)
+				}
 			}
-			if _, ok = groups[groupName]; !ok {
-				groups[groupName] = make(plotter.XYs, 0)
+
+			var groupOrders []stringutil.StringCount
+			for g := range groupOrderMap {
+				groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
 			}
-			groups[groupName] = append(groups[groupName], struct{ X, Y float64 }{X: x, Y: y})
-			if _, ok = groupOrderMap[groupName]; !ok {
-				groupOrderMap[groupName] = order
-				order++
+			sort.Sort(stringutil.StringCountList(groupOrders))
+
+			// the secondary Y axis, values are transformed into the range of the primary Y axis
+			if nY2 > 0 {
+				y2Axis = newLineY2Axis(groups, groupY2, plotConfig)
+				y2Axis.label = getFlagString(cmd, "y2lab")
+				if y2Axis.label == "" && nY2 == 1 {
+					y2Axis.label = yNames[nY]
+				}
 			}
-		}
 
-		p := plot.New()
+			if plotConfig.ylab == "" {
+				if nY > 1 || nY2 > 0 {
+					plotConfig.ylab = strings.Join(yNames[:nY], ", ")
+				} else if len(headerRow) > 1 {
+					plotConfig.ylab = headerRow[1]
+				} else {
+					plotConfig.ylab = "Y Values"
+				}
+			}
+			if plotConfig.xlab == "" {
+				if len(headerRow) > 0 {
+					plotConfig.xlab = headerRow[0]
+				} else {
+					plotConfig.xlab = "X Values"
+				}
+			}
 
-		var groupOrders []stringutil.StringCount
-		for g := range groupOrderMap {
-			groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
-		}
-		sort.Sort(stringutil.StringCountList(groupOrders))
+			addLegend := len(groupOrders) > 1
 
-		i := colorIndex - 1
-		addLegend := len(groupOrders) > 1
-		for _, gor := range groupOrders {
-			v := groups[gor.Key]
+			if plotConfig.html {
+				values := make([]vegaObj, 0, len(data))
+				groupNames := make([]string, len(groupOrders))
+				for i, gor := range groupOrders {
+					groupNames[i] = gor.Key
+					axis := 1
+					if groupY2[gor.Key] {
+						axis = 2
+					}
+					for _, xy := range groups[gor.Key] {
+						value := vegaObj{"x": xy.X, "y": xy.Y, "group": gor.Key, "axis": axis}
+						if nominal {
+							value["x"] = xNominalValues[int(xy.X)]
+						} else if isTime {
+							value["x"] = math.Round(xy.X * 1000) // milliseconds
+						}
+						values = append(values, value)
+					}
+				}
+				spec := newVegaLiteSpec(plotConfig, values)
+				colors := vegaPlotutilColors(colorIndex-1, len(groupNames))
+
+				// one layer for each Y axis
+				layer := func(axis int, yTitle string, ymin string, ymax string) vegaObj {
+					mark := vegaObj{"tooltip": true}
+					if scatter {
+						mark["type"] = "point"
+						mark["filled"] = true
+					} else {
+						mark["type"] = "line"
+						mark["point"] = true
+						mark["strokeWidth"] = float64(lineWidth)
+					}
+					var x vegaObj
+					switch {
+					case nominal:
+						x = vegaObj{"field": "x", "type": "ordinal", "sort": xNominalValues, "title": vegaTitle(plotConfig.xlab)}
+					case isTime:
+						x = vegaObj{"field": "x", "type": "temporal", "title": vegaTitle(plotConfig.xlab)}
+						if plotConfig.scaleLnX {
+							x["scale"] = vegaObj{"type": "log", "base": math.E}
+						}
+					default:
+						x = vegaQuantitative("x", plotConfig.xlab, plotConfig.scaleLnX,
+							plotConfig.xminStr, plotConfig.xmin, plotConfig.xmaxStr, plotConfig.xmax)
+					}
+					y := vegaQuantitative("y", yTitle, plotConfig.scaleLnY,
+						ymin, plotConfig.ymin, ymax, plotConfig.ymax)
+					if axis == 2 {
+						y["axis"] = vegaObj{"orient": "right"}
+					}
+					unit := vegaObj{
+						"mark":      mark,
+						"encoding":  vegaObj{"x": x, "y": y},
+						"transform": []vegaObj{{"filter": fmt.Sprintf("datum.axis == %d", axis)}},
+					}
+					if addLegend {
+						vegaAddLegendToggle(unit, unit["encoding"].(vegaObj), "group", groupNames, colors)
+					} else {
+						mark["color"] = colors[0]
+					}
+					return unit
+				}
 
-			// sort by x
-			if !scatter {
-				sort.Slice(v, func(i, j int) bool {
-					return v[i].X < v[j].X
-				})
+				zoom := []string{"x", "y"}
+				if nominal {
+					zoom = []string{"y"}
+				}
+				if y2Axis == nil {
+					for k, v := range layer(1, plotConfig.ylab, plotConfig.yminStr, plotConfig.ymaxStr) {
+						spec[k] = v
+					}
+					vegaAddZoom(spec, zoom...)
+				} else {
+					layer1 := layer(1, plotConfig.ylab, plotConfig.yminStr, plotConfig.ymaxStr)
+					layer2 := layer(2, y2Axis.label, "", "")
+					if addLegend { // the legend parameter is defined once
+						delete(layer2, "params")
+					}
+					vegaAddZoom(layer1, "x")
+					spec["layer"] = []vegaObj{layer1, layer2}
+					spec["resolve"] = vegaObj{"scale": vegaObj{"y": "independent"}}
+				}
+				writePlotHTML(config.OutFile, plotConfig, spec)
+				return nil
 			}
 
-			g := gor.Key
-			if !scatter {
-				lines, points, err := plotter.NewLinePoints(v)
-				checkError(err)
-				lines.Color = plotutil.Color(i)
-				lines.LineStyle.Dashes = plotutil.Dashes(i)
-				lines.LineStyle.Width = lineWidth
-				points.Shape = plotutil.Shape(i)
-				points.Color = plotutil.Color(i)
-				points.Radius = pointSize
-				p.Add(lines, points)
-				if addLegend {
-					p.Legend.Add(g, lines, points)
+			if plotConfig.terminal {
+				if y2Axis != nil {
+					log.Warning("the secondary Y axis is not supported in the terminal format, all series are plotted against the primary Y axis")
 				}
-			} else {
-				points, err := plotter.NewScatter(v)
-				checkError(err)
-				points.Shape = plotutil.Shape(i)
-				points.Color = plotutil.Color(i)
-				points.Radius = pointSize
-				p.Add(points)
-				if addLegend {
-					p.Legend.Add(g, points)
+				if plotConfig.scaleLnX || plotConfig.scaleLnY {
+					log.Warning("flag --x-scale-ln and --y-scale-ln ignored for the terminal format")
+				}
+				xmin, xmax := math.Inf(1), math.Inf(-1)
+				ymin, ymax := math.Inf(1), math.Inf(-1)
+				for _, v := range groups {
+					for _, xy := range v {
+						xmin, xmax = math.Min(xmin, xy.X), math.Max(xmax, xy.X)
+						ymin, ymax = math.Min(ymin, xy.Y), math.Max(ymax, xy.Y)
+					}
 				}
+				if math.IsInf(xmin, 0) {
+					checkError(fmt.Errorf("no data to plot"))
+				}
+				if plotConfig.xminStr != "" {
+					xmin = plotConfig.xmin
+				}
+				if plotConfig.xmaxStr != "" {
+					xmax = plotConfig.xmax
+				}
+				if plotConfig.yminStr != "" {
+					ymin = plotConfig.ymin
+				}
+				if plotConfig.ymaxStr != "" {
+					ymax = plotConfig.ymax
+				}
+
+				tp := newTermPlot(plotConfig, xmin, xmax, ymin, ymax)
+				if nominal {
+					tp.xTickLabel = func(x float64) string {
+						i := int(math.Round(x))
+						if i < 0 || i >= len(xNominalValues) {
+							return ""
+						}
+						return xNominalValues[i]
+					}
+				} else if isTime {
+					layout := getFlagString(cmd, "time-tick-format")
+					if layout == "" {
+						layout = lineTimeTickLayout(xmax - xmin)
+					} else if strings.Contains(layout, "%") {
+						layout = strftime2layout(layout)
+					}
+					tp.xTickLabel = func(x float64) string { return lineUnixTime(x).Format(layout) }
+				}
+				for i, gor := range groupOrders {
+					v := groups[gor.Key]
+					if !scatter {
+						sort.Slice(v, func(i, j int) bool {
+							return v[i].X < v[j].X
+						})
+					}
+					tp.Line(v, colorIndex-1+i, scatter)
+					tp.AddLegend(gor.Key, colorIndex-1+i)
+				}
+				writeTermPlot(config.OutFile, tp)
+				return nil
 			}
 
-			i++
-		}
-		if lineWidth > pointSize {
-			p.Legend.Padding = lineWidth
-		} else {
-			p.Legend.Padding = pointSize
-		}
-		p.Legend.Top = getFlagBool(cmd, "legend-top")
-		p.Legend.Left = getFlagBool(cmd, "legend-left")
+			p := plot.New()
 
-		if plotConfig.ylab == "" {
-			if len(headerRow) > 1 {
-				plotConfig.ylab = headerRow[1]
-			} else {
-				plotConfig.ylab = "Y Values"
+			i := colorIndex - 1
+			for _, gor := range groupOrders {
+				v := groups[gor.Key]
+
+				// sort by x
+				if !scatter {
+					sort.Slice(v, func(i, j int) bool {
+						return v[i].X < v[j].X
+					})
+				}
+				if y2Axis != nil && groupY2[gor.Key] {
+					v = y2Axis.transform(v)
+				}
+
+				g := gor.Key
+				if !scatter {
+					lines, points, err := plotter.NewLinePoints(v)
+					checkError(err)
+					lines.Color = plotutil.Color(i)
+					lines.LineStyle.Dashes = plotutil.Dashes(i)
+					lines.LineStyle.Width = lineWidth
+					points.Shape = plotutil.Shape(i)
+					points.Color = plotutil.Color(i)
+					points.Radius = pointSize
+					p.Add(lines, points)
+					if addLegend {
+						p.Legend.Add(g, lines, points)
+					}
+				} else {
+					points, err := plotter.NewScatter(v)
+					checkError(err)
+					points.Shape = plotutil.Shape(i)
+					points.Color = plotutil.Color(i)
+					points.Radius = pointSize
+					p.Add(points)
+					if addLegend {
+						p.Legend.Add(g, points)
+					}
+				}
+
+				i++
 			}
-		}
-		if plotConfig.xlab == "" {
-			if len(headerRow) > 0 {
-				plotConfig.xlab = headerRow[0]
+			if lineWidth > pointSize {
+				p.Legend.Padding = lineWidth
 			} else {
-				plotConfig.xlab = "X Values"
-			}
-		}
-
-		p.Title.Text = plotConfig.title
-		p.Title.TextStyle.Font.Size = plotConfig.titleSize
-		p.X.Label.Text = plotConfig.xlab
-		p.Y.Label.Text = plotConfig.ylab
-		p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
-		p.X.Width = plotConfig.axisWidth
-		p.Y.Width = plotConfig.axisWidth
-		p.X.Tick.Width = plotConfig.tickWidth
-		p.Y.Tick.Width = plotConfig.tickWidth
-		p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
-		p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
-
-		if plotConfig.scaleLnX {
-			p.X.Scale = plot.LogScale{}
-			p.X.Tick.Marker = plot.LogTicks{Prec: -1}
-		}
-		if plotConfig.scaleLnY {
-			p.Y.Scale = plot.LogScale{}
-			p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
-		}
-		if nominal {
-			p.X.Tick.Marker = plot.TickerFunc(func(min, max float64) []plot.Tick {
-				ticks := plot.DefaultTicks{}.Ticks(min, max)
-				for i, t := range ticks {
-					if t.Label == "" { // Skip minor ticks, they are fine.
-						continue
+				p.Legend.Padding = pointSize
+			}
+			p.Legend.Top = getFlagBool(cmd, "legend-top")
+			p.Legend.Left = getFlagBool(cmd, "legend-left")
+
+			p.Title.Text = plotConfig.title
+			p.Title.TextStyle.Font.Size = plotConfig.titleSize
+			p.X.Label.Text = plotConfig.xlab
+			p.Y.Label.Text = plotConfig.ylab
+			p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.X.Width = plotConfig.axisWidth
+			p.Y.Width = plotConfig.axisWidth
+			p.X.Tick.Width = plotConfig.tickWidth
+			p.Y.Tick.Width = plotConfig.tickWidth
+			p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
+
+			if plotConfig.scaleLnX {
+				p.X.Scale = plot.LogScale{}
+				p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+			if plotConfig.scaleLnY {
+				p.Y.Scale = plot.LogScale{}
+				p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+			if nominal {
+				p.X.Tick.Marker = plot.TickerFunc(func(min, max float64) []plot.Tick {
+					ticks := plot.DefaultTicks{}.Ticks(min, max)
+					for i, t := range ticks {
+						if t.Label == "" { // Skip minor ticks, they are fine.
+							continue
+						}
+						ticks[i].Label = xNominalValues[int(t.Value)]
 					}
-					ticks[i].Label = xNominalValues[int(t.Value)]
+					return ticks
+				})
+			}
+
+			if plotConfig.xminStr != "" {
+				p.X.Min = plotConfig.xmin
+			}
+			if plotConfig.xmaxStr != "" {
+				p.X.Max = plotConfig.xmax
+			}
+			if plotConfig.yminStr != "" {
+				p.Y.Min = plotConfig.ymin
+			}
+			if plotConfig.ymaxStr != "" {
+				p.Y.Max = plotConfig.ymax
+			}
+
+			if isTime {
+				layout := getFlagString(cmd, "time-tick-format")
+				if layout == "" {
+					layout = lineTimeTickLayout(p.X.Max - p.X.Min)
+				} else if strings.Contains(layout, "%") {
+					layout = strftime2layout(layout)
 				}
-				return ticks
-			})
-		}
+				ticker := plot.Ticker(lineTimeTicks{})
+				if plotConfig.scaleLnX {
+					ticker = plot.LogTicks{Prec: -1}
+				}
+				p.X.Tick.Marker = plot.TimeTicks{Ticker: ticker, Format: layout, Time: lineUnixTime}
+			}
 
-		if plotConfig.xminStr != "" {
-			p.X.Min = plotConfig.xmin
-		}
-		if plotConfig.xmaxStr != "" {
-			p.X.Max = plotConfig.xmax
+			if y2Axis != nil {
+				p.Y.Min, p.Y.Max = y2Axis.min1, y2Axis.max1
+				y2Axis.setStyles(p)
+				p.Add(y2Axis)
+			}
+
+			return p
 		}
-		if plotConfig.yminStr != "" {
-			p.Y.Min = plotConfig.ymin
+
+		if plotConfig.facetFieldStr != "" {
+			plotFacets(config, plotConfig, headerRowAll, data, dataAll, build)
+			return
 		}
-		if plotConfig.ymaxStr != "" {
-			p.Y.Max = plotConfig.ymax
+
+		p := build(data)
+		if p == nil { // html or terminal format
+			return
 		}
 
 		// Save image
-		if isStdin(config.OutFile) {
+		if y2Axis != nil {
+			// leave space for the secondary Y axis on the right side
+			format := plotConfig.format
+			if !isStdin(config.OutFile) {
+				format = strings.ToLower(strings.TrimPrefix(filepath.Ext(config.OutFile), "."))
+			}
+			c, err := draw.NewFormattedCanvas(plotConfig.width*vg.Inch, plotConfig.height*vg.Inch, format)
+			checkError(err)
+			dc := draw.New(c)
+			p.Draw(draw.Crop(dc, 0, -y2Axis.width(), 0, 0))
+
+			if isStdin(config.OutFile) {
+				_, err = c.WriteTo(os.Stdout)
+				checkError(err)
+			} else {
+				fh, err := os.Create(config.OutFile)
+				checkError(err)
+				_, err = c.WriteTo(fh)
+				checkError(err)
+				checkError(fh.Close())
+			}
+		} else if isStdin(config.OutFile) {
 			fh, err := p.WriterTo(plotConfig.width*vg.Inch,
 				plotConfig.height*vg.Inch,
 				plotConfig.format)
@@ -344,10 +681,275 @@ Notes:
 	},
 }
 
+// lineTimeParser returns a function parsing date/time values into seconds
+// since the Unix epoch.
+func lineTimeParser(format string) func(string) (float64, error) {
+	if strings.ToLower(format) == "auto" {
+		return func(s string) (float64, error) {
+			t, err := dateparse.ParseIn(s, time.UTC)
+			if err != nil {
+				return 0, err
+			}
+			return float64(t.UnixNano()) / 1e9, nil
+		}
+	}
+	layout := format
+	if strings.Contains(layout, "%") {
+		layout = strftime2layout(layout)
+	}
+	return func(s string) (float64, error) {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return 0, err
+		}
+		return float64(t.UnixNano()) / 1e9, nil
+	}
+}
+
+func lineUnixTime(t float64) time.Time {
+	sec := math.Floor(t)
+	return time.Unix(int64(sec), int64((t-sec)*1e9)).UTC()
+}
+
+// lineTimeTickLayout chooses the layout of tick labels by the time span in seconds.
+func lineTimeTickLayout(span float64) string {
+	switch {
+	case span >= 2*365*86400:
+		return "2006-01"
+	case span >= 2*86400:
+		return "2006-01-02"
+	case span >= 2*3600:
+		return "01-02 15:04"
+	case span >= 2:
+		return "15:04:05"
+	}
+	return "15:04:05.000"
+}
+
+// lineTimeSteps are steps of time ticks in seconds.
+var lineTimeSteps = []float64{
+	1, 2, 5, 10, 15, 30,
+	60, 2 * 60, 5 * 60, 10 * 60, 15 * 60, 30 * 60,
+	3600, 2 * 3600, 3 * 3600, 6 * 3600, 12 * 3600,
+	86400, 2 * 86400, 7 * 86400, 14 * 86400,
+}
+
+// lineTimeTicks places time ticks at multiples of common time steps,
+// and falls back to plot.DefaultTicks for long or short time spans.
+type lineTimeTicks struct{}
+
+func (lineTimeTicks) Ticks(min, max float64) []plot.Tick {
+	const maxTicks = 7
+	for _, step := range lineTimeSteps {
+		if (max-min)/step > maxTicks {
+			continue
+		}
+		if (max-min)/step < 2 {
+			break
+		}
+		var ticks []plot.Tick
+		for v := math.Ceil(min/step) * step; v <= max; v += step {
+			ticks = append(ticks, plot.Tick{Value: v, Label: "-"}) // labels are set by plot.TimeTicks
+		}
+		return ticks
+	}
+	return plot.DefaultTicks{}.Ticks(min, max)
+}
+
+var reLineResampleWidth = regexp.MustCompile(`^(\d+(\.\d+)?)(d|w)$`)
+
+// parseLineResample parses the value of --resample, e.g., "1h:mean".
+func parseLineResample(s string, isTime bool) (float64, func([]float64) float64, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 || i == len(s)-1 {
+		return 0, nil, fmt.Errorf(`invalid value of --resample: %s, e.g., "1h:mean"`, s)
+	}
+	widthStr, op := s[:i], s[i+1:]
+
+	fn, ok := allStats[op]
+	if !ok {
+		ops := make([]string, 0, len(allStats))
+		for k := range allStats {
+			ops = append(ops, k)
+		}
+		sort.Strings(ops)
+		return 0, nil, fmt.Errorf("unsupported operation of --resample: %s. available: %s", op, strings.Join(ops, ", "))
+	}
+
+	var width float64
+	var err error
+	if isTime {
+		if m := reLineResampleWidth.FindStringSubmatch(widthStr); m != nil {
+			width, _ = strconv.ParseFloat(m[1], 64)
+			if m[3] == "d" {
+				width *= 86400
+			} else {
+				width *= 7 * 86400
+			}
+		} else {
+			var d time.Duration
+			d, err = time.ParseDuration(widthStr)
+			width = d.Seconds()
+		}
+	} else {
+		width, err = strconv.ParseFloat(widthStr, 64)
+	}
+	if err != nil || width <= 0 {
+		return 0, nil, fmt.Errorf("invalid width of --resample: %s", widthStr)
+	}
+	return width, fn, nil
+}
+
+// resampleXYs aggregates Y values in bins of X with the given width,
+// X of a bin is its start.
+func resampleXYs(xys plotter.XYs, width float64, fn func([]float64) float64) plotter.XYs {
+	sort.Slice(xys, func(i, j int) bool { return xys[i].X < xys[j].X })
+
+	resampled := make(plotter.XYs, 0, 8)
+	var ys []float64
+	bin := math.NaN()
+	var b float64
+	for _, xy := range xys {
+		b = math.Floor(xy.X/width) * width
+		if b != bin {
+			if len(ys) > 0 {
+				resampled = append(resampled, plotter.XY{X: bin, Y: fn(ys)})
+			}
+			bin = b
+			ys = ys[:0]
+		}
+		ys = append(ys, xy.Y)
+	}
+	if len(ys) > 0 {
+		resampled = append(resampled, plotter.XY{X: bin, Y: fn(ys)})
+	}
+	return resampled
+}
+
+// lineY2Axis draws the secondary Y axis on the right side of the data area.
+// Values of series on the axis are linearly transformed into the range
+// of the primary Y axis.
+type lineY2Axis struct {
+	min, max   float64 // range of the secondary Y axis
+	min1, max1 float64 // range of the primary Y axis
+
+	label      string
+	lineStyle  draw.LineStyle
+	tickStyle  draw.LineStyle
+	tickLength vg.Length
+	tickLabel  text.Style
+	labelStyle text.Style
+	padding    vg.Length
+}
+
+func newLineY2Axis(groups map[string]plotter.XYs, groupY2 map[string]bool, plotConfig *plotConfigs) *lineY2Axis {
+	a := &lineY2Axis{
+		min: math.Inf(1), max: math.Inf(-1),
+		min1: math.Inf(1), max1: math.Inf(-1),
+	}
+	for g, v := range groups {
+		for _, xy := range v {
+			if groupY2[g] {
+				a.min, a.max = math.Min(a.min, xy.Y), math.Max(a.max, xy.Y)
+			} else {
+				a.min1, a.max1 = math.Min(a.min1, xy.Y), math.Max(a.max1, xy.Y)
+			}
+		}
+	}
+	if plotConfig.yminStr != "" {
+		a.min1 = plotConfig.ymin
+	}
+	if plotConfig.ymaxStr != "" {
+		a.max1 = plotConfig.ymax
+	}
+	if math.IsInf(a.min, 0) { // no values
+		a.min, a.max = 0, 1
+	}
+	if math.IsInf(a.min1, 0) {
+		a.min1, a.max1 = a.min, a.max
+	}
+	if a.max == a.min {
+		a.min, a.max = a.min-0.5, a.max+0.5
+	}
+	if a.max1 == a.min1 {
+		a.min1, a.max1 = a.min1-0.5, a.max1+0.5
+	}
+	return a
+}
+
+// transform maps values of the secondary Y axis to the primary one.
+func (a *lineY2Axis) transform(v plotter.XYs) plotter.XYs {
+	t := make(plotter.XYs, len(v))
+	for i, xy := range v {
+		t[i] = plotter.XY{X: xy.X, Y: a.to1(xy.Y)}
+	}
+	return t
+}
+
+func (a *lineY2Axis) to1(y float64) float64 {
+	return a.min1 + (y-a.min)*(a.max1-a.min1)/(a.max-a.min)
+}
+
+// setStyles copies styles of the primary Y axis.
+func (a *lineY2Axis) setStyles(p *plot.Plot) {
+	a.lineStyle = p.Y.LineStyle
+	a.tickStyle = p.Y.Tick.LineStyle
+	a.tickLength = p.Y.Tick.Length
+	a.tickLabel = p.Y.Tick.Label
+	a.tickLabel.XAlign = draw.XLeft
+	a.tickLabel.YAlign = draw.YCenter
+	a.labelStyle = p.Y.Label.TextStyle
+	a.labelStyle.Rotation = -math.Pi / 2
+	a.labelStyle.XAlign = draw.XCenter
+	a.labelStyle.YAlign = draw.YBottom
+	a.padding = p.Y.Padding
+}
+
+// width returns the width needed on the right side of the data area.
+func (a *lineY2Axis) width() vg.Length {
+	var w vg.Length
+	for _, t := range (plot.DefaultTicks{}).Ticks(a.min, a.max) {
+		if t.IsMinor() {
+			continue
+		}
+		w = vg.Length(math.Max(float64(w), float64(a.tickLabel.Width(t.Label))))
+	}
+	w += a.padding + a.tickLength*2
+	if a.label != "" {
+		w += a.labelStyle.Height(a.label) * 1.5
+	}
+	return w
+}
+
+func (a *lineY2Axis) Plot(c draw.Canvas, plt *plot.Plot) {
+	_, trY := plt.Transforms(&c)
+	x := c.Max.X + a.padding
+	c.StrokeLine2(a.lineStyle, x, trY(a.min1), x, trY(a.max1))
+
+	var w vg.Length
+	for _, t := range (plot.DefaultTicks{}).Ticks(a.min, a.max) {
+		y := trY(a.to1(t.Value))
+		if t.IsMinor() {
+			c.StrokeLine2(a.tickStyle, x, y, x+a.tickLength/2, y)
+			continue
+		}
+		c.StrokeLine2(a.tickStyle, x, y, x+a.tickLength, y)
+		c.FillText(a.tickLabel, vg.Point{X: x + a.tickLength*2, Y: y}, t.Label)
+		w = vg.Length(math.Max(float64(w), float64(a.tickLabel.Width(t.Label))))
+	}
+	if a.label != "" {
+		c.FillText(a.labelStyle,
+			vg.Point{X: x + a.tickLength*2 + w + a.labelStyle.Height(a.label)*0.25, Y: (trY(a.min1) + trY(a.max1)) / 2},
+			a.label)
+	}
+}
+
 func init() {
 	plotCmd.AddCommand(lineCmd)
 	lineCmd.Flags().StringP("data-field-x", "x", "", `column index or column name of X for command line`)
-	lineCmd.Flags().StringP("data-field-y", "y", "", `column index or column name of Y for command line`)
+	lineCmd.Flags().StringP("data-field-y", "y", "", `column index or column name of Y for command line, multiple columns supported, e.g., -y a,b`)
+	lineCmd.Flags().StringP("data-field-y2", "", "", `column(s) plotted against the secondary Y axis on the right side`)
+	lineCmd.Flags().StringP("y2lab", "", "", "label text of the secondary Y axis")
 
 	lineCmd.Flags().BoolP("legend-top", "", false, "locate legend along the top edge of the plot")
 	lineCmd.Flags().BoolP("legend-left", "", false, "locate legend along the left edge of the plot")
@@ -358,4 +960,8 @@ func init() {
 	lineCmd.Flags().IntP("color-index", "", 1, `color index, 1-7`)
 
 	lineCmd.Flags().BoolP("data-field-x-nominal", "", false, `data field X is treated as a nominal field`)
+
+	lineCmd.Flags().StringP("time-format", "", "", `data field X is date/time in this format: "auto", a layout of Go, or a strftime pattern`)
+	lineCmd.Flags().StringP("time-tick-format", "", "", `format of date/time tick labels, a layout of Go or a strftime pattern. default: chosen by the time span`)
+	lineCmd.Flags().StringP("resample", "", "", `resample Y values of each series in bins of X, in the format of WIDTH:OP, e.g., "1h:mean"`)
 }
@@ -0,0 +1,169 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shenwei356/go-logging"
+)
+
+// setLogFormat sets the format of warnings and errors on stderr, "text" or "json".
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+	case "json":
+		backend := logging.NewLogBackend(os.Stderr, "", 0)
+		logging.SetBackend(logging.NewBackendFormatter(backend, jsonLogFormatter{}))
+	default:
+		return fmt.Errorf("unsupported log format: %s. available: text, json", format)
+	}
+	return nil
+}
+
+// maxErrors is the number of bad rows reported before exiting, 0 for no limit.
+var maxErrors = 1
+
+// numErrors is the number of bad rows reported.
+var numErrors atomic.Int64
+
+// setMaxErrors sets the number of bad rows reported before exiting.
+func setMaxErrors(n int) error {
+	if n < 0 {
+		return fmt.Errorf("value of flag --max-errors should be >= 0: %d", n)
+	}
+	maxErrors = n
+	return nil
+}
+
+// RecordError is an error of a row in a file.
+type RecordError struct {
+	File   string
+	Row    int // the number of records read, including the header row
+	Line   int // line number in the file, 0 for unknown
+	Column int // 1-based column, 0 for unknown
+	Err    error
+}
+
+func newRecordError(file string, row int, err error) *RecordError {
+	e := &RecordError{File: file, Row: row, Err: err}
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		e.Line, e.Column = perr.Line, perr.Column
+	}
+	return e
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("file '%s': %s", e.File, e.Err)
+}
+
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// reportRecordError logs an error of a bad row, and exits if the number of
+// bad rows reaches --max-errors, or it returns false if the error should be
+// handled by the caller as before, i.e., --max-errors 1.
+func reportRecordError(err *RecordError) bool {
+	if maxErrors == 1 {
+		return false
+	}
+	log.Error(err)
+	exitCode = 1
+	if n := numErrors.Add(1); maxErrors > 0 && n >= int64(maxErrors) {
+		log.Errorf("stopped after %d errors (--max-errors)", n)
+		removeInPlaceTemp()
+		exit(-1)
+	}
+	return true
+}
+
+// errorClass returns the class of an error, for structured logs.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, csv.ErrFieldCount):
+		return "field_count"
+	case errors.Is(err, csv.ErrQuote):
+		return "quote"
+	case errors.Is(err, csv.ErrBareQuote):
+		return "bare_quote"
+	case errors.Is(err, strconv.ErrSyntax), errors.Is(err, strconv.ErrRange):
+		return "number"
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return "file"
+	}
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return "parse"
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return "io"
+	}
+	return "error"
+}
+
+// jsonLog is a warning or error in JSON format.
+type jsonLog struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Class   string `json:"class,omitempty"`
+	File    string `json:"file,omitempty"`
+	Row     int    `json:"row,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// jsonLogFormatter formats log records as JSON lines.
+type jsonLogFormatter struct{}
+
+func (jsonLogFormatter) Format(calldepth int, r *logging.Record, output io.Writer) error {
+	l := jsonLog{
+		Level:   strings.ToLower(r.Level.String()),
+		Message: r.Message(),
+	}
+	for _, arg := range r.Args {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+		var rerr *RecordError
+		if errors.As(err, &rerr) {
+			l.Message = rerr.Err.Error()
+			l.File, l.Row, l.Line, l.Column = rerr.File, rerr.Row, rerr.Line, rerr.Column
+		}
+		if r.Level <= logging.ERROR {
+			l.Class = errorClass(err)
+		}
+		break
+	}
+	if l.Class == "" && r.Level <= logging.ERROR {
+		l.Class = "error"
+	}
+	return json.NewEncoder(output).Encode(l)
+}
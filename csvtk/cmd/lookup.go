@@ -0,0 +1,275 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/csvtk/pkg/csvtk"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// lookupCmd represents the lookup command
+var lookupCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "lookup",
+	Short: "map values by keys from mapping files, and replace or append them",
+	Long: `map values by keys from mapping files, and replace or append them
+
+Mapping files are given by -m/--map in the format of "fields:file",
+multiple values are supported and applied in order, so later lookups can
+use columns appended by former ones. Mapping files are read in the same
+format of the input file, i.e., with the header row unless -H is given.
+
+In a mapping file, the first N columns are keys, where N is the number of
+key fields given in "fields", and the remaining columns are values, e.g.,
+
+  code,country,continent
+  CN,China,Asia
+  DE,Germany,Europe
+
+Modes:
+
+  1. By default, value columns are appended to the input, with names from
+     the mapping file.
+  2. With -R/--replace, the key field is replaced by the value, where only
+     one key field and one value column are allowed.
+
+Missing keys are filled with --default, and in the replace mode, original
+values are kept if --keep-missing is given.
+
+Examples:
+
+  csvtk lookup -m code:countries.csv -m country:capitals.csv data.csv
+  csvtk lookup -m code:countries.csv -R --keep-missing data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		maps := getFlagStringArray(cmd, "map")
+		if len(maps) == 0 {
+			checkError(fmt.Errorf("flag -m/--map needed"))
+		}
+		replace := getFlagBool(cmd, "replace")
+		defaultValue := getFlagString(cmd, "default")
+		keepMissing := getFlagBool(cmd, "keep-missing")
+		ignoreCase := getFlagBool(cmd, "ignore-case")
+
+		// read mapping files
+		lookups := make([]*csvLookup, len(maps))
+		for i, m := range maps {
+			items := strings.SplitN(m, ":", 2)
+			if len(items) != 2 || items[0] == "" || items[1] == "" {
+				checkError(fmt.Errorf(`invalid value of -m/--map: %s, format: "fields:file"`, m))
+			}
+			lk, err := readCSVLookup(config, items[1], strings.Count(items[0], ",")+1, ignoreCase)
+			checkError(err)
+			if replace && len(lk.names) != 1 {
+				checkError(fmt.Errorf("only one key field and one value column are allowed for -R/--replace: %s", m))
+			}
+			lk.fieldStr = items[0]
+			lookups[i] = lk
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk lookup: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+
+			DoNotAllowDuplicatedColumnName: true,
+		})
+
+		var key string
+		var row []string
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				var header []string
+				hasHeader := !config.NoHeaderRow || record.IsHeaderRow
+				if hasHeader {
+					header = append(header, record.All...)
+				} else {
+					for i := range record.All {
+						header = append(header, fmt.Sprintf("c%d", i+1))
+					}
+				}
+				for _, lk := range lookups {
+					lk.fields = selectFieldsByHeader(header, lk.fieldStr, false)
+					if len(lk.fields) != lk.nKeys {
+						checkError(fmt.Errorf("%d key fields expected for mapping file %s, %d found: %s", lk.nKeys, lk.file, len(lk.fields), lk.fieldStr))
+					}
+					if replace {
+						continue
+					}
+					for _, name := range lk.names {
+						if !hasHeader {
+							name = fmt.Sprintf("c%d", len(header)+1)
+						}
+						for _, col := range header {
+							if col == name {
+								checkError(fmt.Errorf("column %s from mapping file %s existed in the input", name, lk.file))
+							}
+						}
+						header = append(header, name)
+					}
+				}
+
+				if hasHeader {
+					if !config.NoOutHeader {
+						checkError(writer.Write(header))
+					}
+					continue
+				}
+			}
+
+			row = append(row[:0], record.All...)
+			for _, lk := range lookups {
+				key, _ = lk.keyEncoder.key(row, lk.fields)
+				values, ok := lk.values[key]
+
+				if replace {
+					if ok {
+						row[lk.fields[0]-1] = values[0]
+					} else if !keepMissing {
+						row[lk.fields[0]-1] = defaultValue
+					}
+					continue
+				}
+				if ok {
+					row = append(row, values...)
+				} else {
+					for range lk.names {
+						row = append(row, defaultValue)
+					}
+				}
+			}
+			checkError(writer.Write(row))
+		}
+		readerReport(&config, csvReader, file)
+	},
+}
+
+// csvLookup is a mapping from keys to values.
+type csvLookup struct {
+	file     string
+	fieldStr string // key fields in the input
+	fields   []int
+	nKeys    int
+
+	names      []string // names of value columns
+	values     map[string][]string
+	keyEncoder *joinKeyEncoder
+}
+
+// readCSVLookup reads a mapping file, in which the first nKeys columns are
+// keys and the remaining columns are values. Only the first record is used
+// for duplicated keys.
+func readCSVLookup(config Config, file string, nKeys int, ignoreCase bool) (*csvLookup, error) {
+	header, data, err := readCSVAll(config, file)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("empty mapping file: %s", file)
+	}
+	if len(header) <= nKeys {
+		return nil, fmt.Errorf("mapping file %s should have more than %d columns", file, nKeys)
+	}
+
+	lk := &csvLookup{
+		file:       file,
+		nKeys:      nKeys,
+		names:      header[nKeys:],
+		values:     make(map[string][]string, len(data)),
+		keyEncoder: &joinKeyEncoder{csvtk.KeyEncoder{IgnoreCase: ignoreCase}},
+	}
+	keyFields := make([]int, nKeys)
+	for i := range keyFields {
+		keyFields[i] = i + 1
+	}
+	var key string
+	var dups int
+	for _, record := range data {
+		key, _ = lk.keyEncoder.key(record, keyFields)
+		if _, ok := lk.values[key]; ok {
+			dups++
+			continue
+		}
+		lk.values[key] = record[nKeys:]
+	}
+	if dups > 0 && config.Verbose {
+		log.Warningf("%d records with duplicated keys ignored in mapping file: %s", dups, file)
+	}
+	return lk, nil
+}
+
+func init() {
+	RootCmd.AddCommand(lookupCmd)
+	lookupCmd.Flags().StringArrayP("map", "m", []string{}, `mapping file in the format of "fields:file", e.g., -m code:countries.csv or -m "year,month:holidays.csv", multiple values supported`)
+	lookupCmd.Flags().BoolP("replace", "R", false, `replace the key field with the value, instead of appending value columns`)
+	lookupCmd.Flags().StringP("default", "", "", `default value for missing keys`)
+	lookupCmd.Flags().BoolP("keep-missing", "k", false, `keep original values of missing keys in the replace mode`)
+	lookupCmd.Flags().BoolP("ignore-case", "i", false, `ignore case of keys`)
+}
@@ -0,0 +1,268 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// md2csvCmd represents the md2csv command
+var md2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "md2csv",
+	Short: "convert markdown table to CSV",
+	Long: `convert markdown table to CSV
+
+GitHub-flavored Markdown (GFM) tables are parsed, i.e., a header row,
+followed by a delimiter row (e.g., "| :--- | ---: |"), and data rows.
+Leading and trailing pipes are optional.
+
+Attention:
+
+  1. The input can be a Markdown document with multiple tables, use
+     -n/--table-index to choose one, and --list to list all tables.
+  2. Escaped pipes ("\|") are unescaped, other contents are kept as they are.
+  3. Following the GFM spec, rows with fewer cells are padded with empty
+     cells, and excess cells are ignored.
+  4. Use --alignments to output the alignments (left, center, right, or
+     empty) of columns as the first row.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		tableIndex := getFlagPositiveInt(cmd, "table-index")
+		list := getFlagBool(cmd, "list")
+		alignments := getFlagBool(cmd, "alignments")
+
+		file := files[0]
+		fh, err := ropen(file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk md2csv: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		tables, err := parseMarkdownTables(fh)
+		checkError(err)
+		checkError(fh.Close())
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if list {
+			checkError(writer.Write([]string{"index", "line", "rows", "columns", "header"}))
+			for i, t := range tables {
+				checkError(writer.Write([]string{
+					fmt.Sprintf("%d", i+1),
+					fmt.Sprintf("%d", t.line),
+					fmt.Sprintf("%d", len(t.rows)),
+					fmt.Sprintf("%d", len(t.header)),
+					strings.Join(t.header, ", "),
+				}))
+			}
+			return
+		}
+
+		if tableIndex > len(tables) {
+			checkError(fmt.Errorf("table %d not found, %d tables in total: %s", tableIndex, len(tables), file))
+		}
+		t := tables[tableIndex-1]
+
+		if alignments {
+			checkError(writer.Write(t.aligns))
+		}
+		if !config.NoOutHeader {
+			checkError(writer.Write(t.header))
+		}
+		for _, row := range t.rows {
+			checkError(writer.Write(row))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(md2csvCmd)
+	md2csvCmd.Flags().IntP("table-index", "n", 1, "index of the table to extract (1-based)")
+	md2csvCmd.Flags().BoolP("list", "", false, "list all tables with line numbers and numbers of rows and columns")
+	md2csvCmd.Flags().BoolP("alignments", "a", false, "output alignments of columns as the first row")
+}
+
+type markdownTable struct {
+	line   int // line number of the header row
+	header []string
+	aligns []string
+	rows   [][]string
+}
+
+var reMarkdownDelimiterCell = regexp.MustCompile(`^:?-+:?$`)
+
+// splitMarkdownRow splits a table row into cells, with escaped pipes unescaped.
+func splitMarkdownRow(line string) []string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "|") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	cells := make([]string, 0, 8)
+	var sb strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			sb.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		default:
+			sb.WriteByte(line[i])
+		}
+	}
+	cells = append(cells, strings.TrimSpace(sb.String()))
+	return cells
+}
+
+// markdownAlignments parses a delimiter row, it returns nil for invalid rows.
+func markdownAlignments(line string) []string {
+	if !strings.Contains(line, "-") {
+		return nil
+	}
+	cells := splitMarkdownRow(line)
+	aligns := make([]string, len(cells))
+	var left, right bool
+	for i, c := range cells {
+		if !reMarkdownDelimiterCell.MatchString(c) {
+			return nil
+		}
+		left, right = c[0] == ':', c[len(c)-1] == ':'
+		switch {
+		case left && right:
+			aligns[i] = "center"
+		case left:
+			aligns[i] = "left"
+		case right:
+			aligns[i] = "right"
+		}
+	}
+	return aligns
+}
+
+// parseMarkdownTables parses all GFM tables of a Markdown document.
+// Tables in fenced code blocks are ignored.
+func parseMarkdownTables(fh *xopen.Reader) ([]*markdownTable, error) {
+	tables := make([]*markdownTable, 0, 1)
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 1<<16), 1<<30)
+
+	var t *markdownTable
+	var prev string
+	var lineNum int
+	var line, fence string
+	var row, aligns, header []string
+	for scanner.Scan() {
+		lineNum++
+		line = strings.TrimRight(scanner.Text(), "\r\n")
+		trimmed := strings.TrimSpace(line)
+
+		// fenced code blocks
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			t, prev = nil, ""
+			continue
+		}
+
+		if t != nil {
+			if trimmed == "" || !strings.Contains(line, "|") {
+				t = nil
+				prev = line
+				continue
+			}
+			row = splitMarkdownRow(line)
+			if len(row) > len(t.header) {
+				row = row[:len(t.header)]
+			}
+			for len(row) < len(t.header) {
+				row = append(row, "")
+			}
+			t.rows = append(t.rows, row)
+			continue
+		}
+
+		if prev != "" && strings.Contains(prev, "|") {
+			if aligns = markdownAlignments(line); aligns != nil {
+				header = splitMarkdownRow(prev)
+				if len(header) == len(aligns) {
+					t = &markdownTable{line: lineNum - 1, header: header, aligns: aligns}
+					tables = append(tables, t)
+					prev = ""
+					continue
+				}
+			}
+		}
+		prev = line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
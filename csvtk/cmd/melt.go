@@ -0,0 +1,304 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// meltCmd represents the melt command
+var meltCmd = &cobra.Command{
+	GroupID: "transform",
+
+	Use:   "melt",
+	Short: "unpivot columns into variable-value pairs, with value-column groups supported",
+	Long: `unpivot columns into variable-value pairs, with value-column groups supported
+
+Columns given by -f/--value-vars are unpivoted into a variable column
+(--var-name) and a value column (--value-name), and columns given by
+-i/--id-vars are kept. If only one of them is given, all the other columns
+are used for the other one.
+
+Value-column groups:
+  Columns like "x_2020,x_2021,y_2020,y_2021" can be melted into columns "x"
+  and "y" with a variable column of "2020" and "2021", by splitting column
+  names with --name-sep "_" (at the last occurrence), or with a regular
+  expression of --name-regexp, where the first capture group is the new value
+  column and the second one is the variable, e.g., '^(.+)_(\d+)$'.
+  Missing values are filled with the value of --na.
+
+Examples:
+
+    csvtk melt -i id -f 2- --var-name year --value-name score
+    csvtk melt -i id -F -f "x_*,y_*" --name-sep _ --var-name year
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		if config.NoHeaderRow {
+			checkError(fmt.Errorf("flag -H/--no-header-row not allowed"))
+		}
+
+		idVars := getFlagString(cmd, "id-vars")
+		valueVars := getFlagString(cmd, "value-vars")
+		if idVars == "" && valueVars == "" {
+			checkError(fmt.Errorf("at least one of flags -i/--id-vars and -f/--value-vars needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		varName := getFlagString(cmd, "var-name")
+		valueName := getFlagString(cmd, "value-name")
+		na := getFlagString(cmd, "na")
+
+		nameSep := getFlagString(cmd, "name-sep")
+		nameRegexp := getFlagString(cmd, "name-regexp")
+		if nameSep != "" && nameRegexp != "" {
+			checkError(fmt.Errorf("flags --name-sep and --name-regexp are exclusive"))
+		}
+		var reName *regexp.Regexp
+		if nameRegexp != "" {
+			var err error
+			reName, err = regexp.Compile(nameRegexp)
+			checkError(err)
+			if reName.NumSubexp() < 2 {
+				checkError(fmt.Errorf("two capture groups needed in --name-regexp: %s", nameRegexp))
+			}
+		}
+		grouping := nameSep != "" || reName != nil
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk melt: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+
+			DoNotAllowDuplicatedColumnName: true,
+		})
+
+		var idFields, valueFields []int
+		var stems, variables []string // value columns and variables of value-column groups
+		var cells [][]int             // variable -> stem -> field
+		var header, items []string
+		var i, j, f int
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header = record.All
+				if idVars != "" {
+					idFields = selectFieldsByHeader(header, idVars, fuzzyFields)
+				}
+				if valueVars != "" {
+					valueFields = selectFieldsByHeader(header, valueVars, fuzzyFields)
+				}
+				if idVars == "" {
+					idFields = meltOtherFields(len(header), valueFields)
+				} else if valueVars == "" {
+					valueFields = meltOtherFields(len(header), idFields)
+				} else {
+					m := make(map[int]struct{}, len(idFields))
+					for _, f = range idFields {
+						m[f] = struct{}{}
+					}
+					for _, f = range valueFields {
+						if _, ok := m[f]; ok {
+							checkError(fmt.Errorf("column %s is in both id-vars and value-vars", header[f-1]))
+						}
+					}
+				}
+				if len(valueFields) == 0 {
+					checkError(fmt.Errorf("no value columns matched in file: %s", file))
+				}
+
+				if grouping {
+					stems, variables, cells = meltGroupValueFields(header, valueFields, nameSep, reName)
+					items = make([]string, len(idFields)+1+len(stems))
+				} else {
+					items = make([]string, len(idFields)+2)
+				}
+
+				if !config.NoOutHeader {
+					for i, f = range idFields {
+						items[i] = header[f-1]
+					}
+					items[len(idFields)] = varName
+					if grouping {
+						copy(items[len(idFields)+1:], stems)
+					} else {
+						items[len(idFields)+1] = valueName
+					}
+					checkError(writer.Write(items))
+				}
+				continue
+			}
+
+			for i, f = range idFields {
+				items[i] = record.All[f-1]
+			}
+
+			if !grouping {
+				for _, f = range valueFields {
+					items[len(idFields)] = header[f-1]
+					items[len(idFields)+1] = record.All[f-1]
+					checkError(writer.Write(items))
+				}
+				continue
+			}
+
+			for i = range variables {
+				items[len(idFields)] = variables[i]
+				for j, f = range cells[i] {
+					if f == 0 {
+						items[len(idFields)+1+j] = na
+					} else {
+						items[len(idFields)+1+j] = record.All[f-1]
+					}
+				}
+				checkError(writer.Write(items))
+			}
+		}
+
+		readerReport(&config, csvReader, file)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(meltCmd)
+	meltCmd.Flags().StringP("id-vars", "i", "", `fields to keep. e.g -i 1,2 or -i columnA,columnB (default: columns not in -f/--value-vars)`)
+	meltCmd.Flags().StringP("value-vars", "f", "", `fields to unpivot. e.g -f 3-5 or -f columnC,columnD (default: columns not in -i/--id-vars)`)
+	meltCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "x_*"`)
+	meltCmd.Flags().StringP("var-name", "", "variable", `name of the variable column to create in output`)
+	meltCmd.Flags().StringP("value-name", "", "value", `name of the value column to create in output, ignored for value-column groups`)
+	meltCmd.Flags().StringP("name-sep", "", "", `separator for splitting names of value columns into value-column groups and variables`)
+	meltCmd.Flags().StringP("name-regexp", "", "", `regular expression with two capture groups for splitting names of value columns into value-column groups and variables`)
+	meltCmd.Flags().StringP("na", "", "", `content for filling missing values in value-column groups`)
+}
+
+// meltOtherFields returns fields not in the given ones.
+func meltOtherFields(n int, fields []int) []int {
+	m := make(map[int]struct{}, len(fields))
+	for _, f := range fields {
+		m[f] = struct{}{}
+	}
+	others := make([]int, 0, n-len(m))
+	for f := 1; f <= n; f++ {
+		if _, ok := m[f]; !ok {
+			others = append(others, f)
+		}
+	}
+	return others
+}
+
+// meltGroupValueFields splits names of value columns into new value columns
+// (stems) and variables, and returns fields of each cell, where 0 means missing.
+func meltGroupValueFields(header []string, fields []int, sep string, re *regexp.Regexp) ([]string, []string, [][]int) {
+	stems := make([]string, 0, 4)
+	variables := make([]string, 0, 8)
+	stemsIdx := make(map[string]int, 4)
+	variablesIdx := make(map[string]int, 8)
+	type cell struct{ stem, variable, field int }
+	cells := make([]cell, 0, len(fields))
+
+	var stem, variable string
+	for _, f := range fields {
+		name := header[f-1]
+		if re != nil {
+			found := re.FindStringSubmatch(name)
+			if found == nil {
+				checkError(fmt.Errorf("column name not matched by --name-regexp: %s", name))
+			}
+			stem, variable = found[1], found[2]
+		} else {
+			i := strings.LastIndex(name, sep)
+			if i < 0 {
+				checkError(fmt.Errorf("separator %q not found in column name: %s", sep, name))
+			}
+			stem, variable = name[:i], name[i+len(sep):]
+		}
+
+		if _, ok := stemsIdx[stem]; !ok {
+			stemsIdx[stem] = len(stems)
+			stems = append(stems, stem)
+		}
+		if _, ok := variablesIdx[variable]; !ok {
+			variablesIdx[variable] = len(variables)
+			variables = append(variables, variable)
+		}
+		cells = append(cells, cell{stemsIdx[stem], variablesIdx[variable], f})
+	}
+
+	table := make([][]int, len(variables))
+	for i := range table {
+		table[i] = make([]int, len(stems))
+	}
+	for _, c := range cells {
+		if table[c.variable][c.stem] > 0 {
+			checkError(fmt.Errorf("duplicated value column for %s and %s: %s", stems[c.stem], variables[c.variable], header[c.field-1]))
+		}
+		table[c.variable][c.stem] = c.field
+	}
+	return stems, variables, table
+}
@@ -0,0 +1,252 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"container/heap"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// mergeSortedCmd represents the merge-sorted command
+var mergeSortedCmd = &cobra.Command{
+	GroupID: "order",
+
+	Use:   "merge-sorted",
+	Short: "merge sorted CSV/TSV files into one sorted output",
+	Long: `merge sorted CSV/TSV files into one sorted output
+
+Input files should be sorted by the same keys, e.g., with "csvtk sort".
+Records are merged with a heap-based k-way merge, only the current record
+of each file is kept in memory. Records with the same keys are output in
+the order of input files.
+
+All input files should have the same header row, which is output once.
+
+Sort types of keys are the same as "csvtk sort" except the user-defined
+order: "N" for natural order, "n" for number, "d" for date/time and "r"
+for reverse.
+
+Every record is compared with the previous one of the same file, and a
+warning is given for each file not sorted by the keys, as the output would
+not be sorted either. Use -c/--check to stop with an error instead.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		keys := getFlagStringSlice(cmd, "keys")
+		ignoreCase := getFlagBool(cmd, "ignore-case")
+		check := getFlagBool(cmd, "check")
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		// open all files and read the first records
+		var headerRow []string
+		var headerFile string
+		var sortTypes []sortType
+		h := &mergeHeap{}
+		for i, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk merge-sorted: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+
+				DoNotAllowDuplicatedColumnName: true,
+			})
+
+			src := &mergeSource{idx: i, file: file, reader: csvReader}
+			record, ok := <-csvReader.Ch
+			if ok {
+				checkError(record.Err)
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					if headerFile == "" {
+						headerRow, headerFile = record.All, file
+					} else if strings.Join(record.All, "\t") != strings.Join(headerRow, "\t") {
+						checkError(fmt.Errorf("header rows of files %s and %s are different", headerFile, file))
+					}
+				} else {
+					src.cur, src.line = record.All, record.Line
+				}
+			}
+
+			if sortTypes == nil {
+				header := headerRow
+				if header == nil && src.cur != nil {
+					header = make([]string, len(src.cur))
+					for j := range header {
+						header[j] = fmt.Sprintf("c%d", j+1)
+					}
+				}
+				if header != nil {
+					sortTypes = parseMergeSortKeys(header, keys, ignoreCase)
+					h.less = func(a, b []string) bool {
+						return compareBySortTypes(sortTypes, a, b) < 0
+					}
+				}
+			}
+
+			if src.cur != nil || src.next() {
+				h.sources = append(h.sources, src)
+			} else {
+				readerReport(&config, csvReader, file)
+			}
+		}
+
+		if headerRow != nil && !config.NoOutHeader {
+			checkError(writer.Write(headerRow))
+		}
+		if len(h.sources) == 0 {
+			return
+		}
+		heap.Init(h)
+
+		var src *mergeSource
+		for h.Len() > 0 {
+			src = h.sources[0]
+			checkError(writer.Write(src.cur))
+
+			if !src.next() {
+				readerReport(&config, src.reader, src.file)
+				heap.Pop(h)
+				continue
+			}
+			if h.less(src.cur, src.prev) {
+				if check {
+					checkError(fmt.Errorf("file %s is not sorted by the keys at line %d", src.file, src.line))
+				}
+				if !src.unsorted {
+					log.Warningf("file %s is not sorted by the keys at line %d, the output is not sorted", src.file, src.line)
+					src.unsorted = true
+				}
+			}
+			heap.Fix(h, 0)
+		}
+	},
+}
+
+// parseMergeSortKeys parses keys in the format of "csvtk sort".
+func parseMergeSortKeys(header []string, keys []string, ignoreCase bool) []sortType {
+	sortTypes := make([]sortType, 0, len(keys))
+	for _, key := range keys {
+		t, err := parseSortKey(key)
+		checkError(err)
+		if t.UserDefined {
+			checkError(fmt.Errorf(`user-defined order not supported: "%s"`, key))
+		}
+		fields := selectFieldsByHeader(header, t.FieldStr, false)
+		if len(fields) != 1 {
+			checkError(fmt.Errorf(`invalid key: "%s"`, key))
+		}
+		t.Index = fields[0] - 1
+		t.IgnoreCase = ignoreCase
+		sortTypes = append(sortTypes, t)
+	}
+	return sortTypes
+}
+
+// mergeSource is an input file with its current and previous records.
+type mergeSource struct {
+	idx    int
+	file   string
+	reader *CSVReader
+	cur    []string
+	prev   []string
+	line   int
+
+	unsorted bool // disorder found and reported
+}
+
+// next reads the next record, and returns false at the end of the file.
+func (s *mergeSource) next() bool {
+	record, ok := <-s.reader.Ch
+	s.prev = s.cur
+	if !ok {
+		s.cur = nil
+		return false
+	}
+	checkError(record.Err)
+	s.cur, s.line = record.All, record.Line
+	return true
+}
+
+type mergeHeap struct {
+	sources []*mergeSource
+	less    func(a, b []string) bool
+}
+
+func (h mergeHeap) Len() int      { return len(h.sources) }
+func (h mergeHeap) Swap(i, j int) { h.sources[i], h.sources[j] = h.sources[j], h.sources[i] }
+func (h mergeHeap) Less(i, j int) bool {
+	a, b := h.sources[i], h.sources[j]
+	if h.less(a.cur, b.cur) {
+		return true
+	}
+	if h.less(b.cur, a.cur) {
+		return false
+	}
+	return a.idx < b.idx // keep the input order
+}
+func (h *mergeHeap) Push(x interface{}) { h.sources = append(h.sources, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := h.sources
+	n := len(old)
+	x := old[n-1]
+	h.sources = old[0 : n-1]
+	return x
+}
+
+func init() {
+	RootCmd.AddCommand(mergeSortedCmd)
+	mergeSortedCmd.Flags().StringSliceP("keys", "k", []string{"1"}, `keys (multiple values supported). sort type supported, "N" for natural order, "n" for number, "d" for date/time and "r" for reverse. e.g., "-k 1" or "-k A:r" or ""-k 1:nr -k 2"`)
+	mergeSortedCmd.Flags().BoolP("ignore-case", "i", false, "ignore-case")
+	mergeSortedCmd.Flags().BoolP("check", "c", false, "stop with an error if any input file is not sorted by the keys")
+}
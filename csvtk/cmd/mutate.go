@@ -21,10 +21,11 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"regexp"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
@@ -38,6 +39,14 @@ var mutateCmd = &cobra.Command{
 	Short: "create new column from selected fields by regular expression",
 	Long: `create new column from selected fields by regular expression
 
+Multiple new columns can be created at once from a pattern with multiple
+capture groups, with column names separated by commas, where the N-th column
+is filled with the N-th capture group. If -n/--name is not given, names of
+named capture groups are used. e.g.,
+
+    csvtk mutate -f range -p '(\d+)-(\d+)' -n start,end
+    csvtk mutate -f range -p '(?P<start>\d+)-(?P<end>\d+)'
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -72,11 +81,6 @@ var mutateCmd = &cobra.Command{
 			checkError(fmt.Errorf(`value of -p (--pattern) must contains "(" and ")" to capture data which is used to create new column`))
 		}
 
-		name := getFlagString(cmd, "name")
-		if !config.NoHeaderRow && name == "" && !config.NoOutHeader {
-			checkError(fmt.Errorf("flag -n (--name) needed"))
-		}
-
 		p := pattern
 		if ignoreCase {
 			p = "(?i)" + p
@@ -84,6 +88,23 @@ var mutateCmd = &cobra.Command{
 		patternRegexp, err := regexp.Compile(p)
 		checkError(err)
 
+		name := getFlagString(cmd, "name")
+		names := []string{name}
+		if name == "" && patternRegexp.NumSubexp() > 1 {
+			if subNames := patternRegexp.SubexpNames()[1:]; !slices.Contains(subNames, "") {
+				names = subNames
+			}
+		} else if patternRegexp.NumSubexp() > 1 && strings.Contains(name, ",") {
+			names = strings.Split(name, ",")
+			if len(names) > patternRegexp.NumSubexp() {
+				checkError(fmt.Errorf("%d column names given, but only %d capture groups in the pattern", len(names), patternRegexp.NumSubexp()))
+			}
+		}
+		if !config.NoHeaderRow && names[0] == "" && !config.NoOutHeader {
+			checkError(fmt.Errorf("flag -n (--name) needed"))
+		}
+		values := make([]string, len(names))
+
 		remove := getFlagBool(cmd, "remove")
 
 		fieldStr := getFlagString(cmd, "fields")
@@ -91,11 +112,11 @@ var mutateCmd = &cobra.Command{
 			checkError(fmt.Errorf("flag -f (--fields) needed"))
 		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -135,8 +156,29 @@ var mutateCmd = &cobra.Command{
 			var colnames2fileds map[string][]int // column name -> []field
 			var ok bool
 			var f int
-			var value string
+			var i int
 			var handleHeaderRow bool
+			// insertColumns inserts new columns at the position of "at", "after" or "before"
+			insertColumns := func(record2 []string, cols []string) []string {
+				if after != "" {
+					if _fields, ok = colnames2fileds[after]; ok {
+						at = _fields[len(_fields)-1] + 1
+					} else {
+						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, after, file))
+					}
+				} else if before != "" {
+					if _fields, ok = colnames2fileds[before]; ok {
+						at = _fields[0]
+					} else {
+						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, before, file))
+					}
+				}
+				if at > 0 && at <= len(record2)+1 {
+					return slices.Insert(record2, at-1, cols...)
+				}
+				return append(record2, cols...)
+			}
+
 			checkFirstLine := true
 			for record := range csvReader.Ch {
 				if record.Err != nil {
@@ -181,27 +223,7 @@ var mutateCmd = &cobra.Command{
 				}
 
 				if handleHeaderRow {
-					record2 = append(record2, name)
-					if after != "" {
-						if _fields, ok = colnames2fileds[after]; ok {
-							at = _fields[len(_fields)-1] + 1
-						} else {
-							checkError(fmt.Errorf(`column "%s" not existed in file: %s`, after, file))
-						}
-						copy(record2[at:], record2[at-1:len(record2)-1])
-						record2[at-1] = name
-					} else if before != "" {
-						if _fields, ok = colnames2fileds[before]; ok {
-							at = _fields[0]
-						} else {
-							checkError(fmt.Errorf(`column "%s" not existed in file: %s`, before, file))
-						}
-						copy(record2[at:], record2[at-1:len(record2)-1])
-						record2[at-1] = name
-					} else if at > 0 && at <= len(record2) {
-						copy(record2[at:], record2[at-1:len(record2)-1])
-						record2[at-1] = name
-					}
+					record2 = insertColumns(record2, names)
 
 					handleHeaderRow = false
 					if !config.NoOutHeader {
@@ -212,37 +234,20 @@ var mutateCmd = &cobra.Command{
 
 				f = record.Fields[0] - 1
 
-				if patternRegexp.MatchString(record.All[f]) {
-					found := patternRegexp.FindAllStringSubmatch(record.All[f], -1)
-					value = found[0][1]
-				} else {
-					if naUnmatched {
-						value = ""
-					} else {
-						value = record.All[f]
+				if found := patternRegexp.FindStringSubmatch(record.All[f]); found != nil {
+					for i = range values {
+						values[i] = found[i+1]
 					}
-				}
-				record2 = append(record2, value)
-				if after != "" {
-					if _fields, ok = colnames2fileds[after]; ok {
-						at = _fields[len(_fields)-1] + 1
-					} else {
-						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, after, file))
-					}
-					copy(record2[at:], record2[at-1:len(record2)-1])
-					record2[at-1] = value
-				} else if before != "" {
-					if _fields, ok = colnames2fileds[before]; ok {
-						at = _fields[0]
-					} else {
-						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, before, file))
+				} else {
+					for i = range values {
+						if naUnmatched {
+							values[i] = ""
+						} else {
+							values[i] = record.All[f]
+						}
 					}
-					copy(record2[at:], record2[at-1:len(record2)-1])
-					record2[at-1] = value
-				} else if at > 0 && at <= len(record2) {
-					copy(record2[at:], record2[at-1:len(record2)-1])
-					record2[at-1] = value
 				}
+				record2 = insertColumns(record2, values)
 
 				checkError(writer.Write(record2))
 			}
@@ -256,7 +261,7 @@ func init() {
 	RootCmd.AddCommand(mutateCmd)
 	mutateCmd.Flags().StringP("fields", "f", "1", `select only these fields. e.g -f 1,2 or -f columnA,columnB`)
 	mutateCmd.Flags().StringP("pattern", "p", "^(.+)$", `search regular expression with capture bracket. e.g.`)
-	mutateCmd.Flags().StringP("name", "n", "", `new column name`)
+	mutateCmd.Flags().StringP("name", "n", "", `new column name, or names separated by commas for multiple capture groups`)
 	mutateCmd.Flags().BoolP("ignore-case", "i", false, "ignore case")
 	mutateCmd.Flags().BoolP("na", "", false, "for unmatched data, use blank instead of original data")
 	mutateCmd.Flags().BoolP("remove", "R", false, `remove input column`)
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"regexp"
 	"runtime"
@@ -68,10 +67,59 @@ Supported operators and types:
   Ternary conditional: ? :
   Null coalescence: ??
 
+Multiple new columns:
+  Expressions in the form of "name=expression" separated by semicolons
+  create multiple new columns in one pass, where -n/--name is not needed.
+  They are evaluated in order, and later expressions can reference earlier
+  new columns, e.g.,
+
+    csvtk mutate2 -e 'total=$price*$qty; margin=($price-$cost)/$price'
+
 Custom functions:
   - len(), length of strings, e.g., len($1), len($a), len($1, $2)
   - ulen(), length of unicode strings/width of unicode strings rendered
     to a terminal, e.g., len("沈伟")==6, ulen("沈伟")==4
+  - convert(), convert units of length, mass, temperature, data sizes and
+    durations, e.g., convert($weight, 'lb', 'kg'). See "csvtk convert -h"
+  - if(cond, a, b), a if cond is true, otherwise b
+  - case(cond1, a, cond2, b, ..., default), value of the first true condition,
+    or default (null if not given)
+  - coalesce(a, b, ...), the first non-null value
+  - is_null(a), whether a is null
+  - nullif(a, b), null if a equals b, otherwise a
+  - div(a, b[, default]), safe division, default (null if not given) is
+    returned if b is zero or any of them is null or not a number
+
+Row-context functions:
+  - rownum(), row number, the header row not counted
+  - lag($a[, n]), value of column "a" of the n-th previous row (n=1 by default),
+    empty for the first n rows
+  - lead($a[, n]), value of column "a" of the n-th next row (n=1 by default),
+    empty for the last n rows
+  - groupidx($a), index of the row among rows with the same value of column "a",
+    starting from 1
+  These functions are computed from the input rows before evaluating, e.g.,
+    csvtk mutate2 -n delta -e '$value - coalesce(lag($value), $value)'
+
+Null values:
+  - Empty cells are passed as empty strings (''), or nulls if the null
+    coalescence operator "??" is used. The functions above treat both of
+    them as nulls. Empty strings can not be compared with numbers, use
+    coalesce() to give a default value, e.g., coalesce($a, 0) > 6.
+  - Columns not existing in the header row are reported as errors.
+  - Null results are outputted as empty strings.
+
+User-defined functions (--udf):
+  Top-level functions in Starlark (a Python dialect) files are available
+  in expressions, e.g., normalize_sample_id($id). Numbers, strings,
+  booleans and None are converted between govaluate and Starlark.
+  Functions with names starting with "_" are private. See:
+
+    https://github.com/google/starlark-go/blob/master/doc/spec.md
+
+  # funcs.star
+  def normalize_sample_id(x):
+      return x.strip().upper().replace("-", "_")
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -101,15 +149,28 @@ Custom functions:
 		runtime.GOMAXPROCS(config.NumCPUs)
 
 		name := getFlagString(cmd, "name")
-		if !config.NoHeaderRow && name == "" && !config.NoOutHeader {
-			checkError(fmt.Errorf("falg -n (--name) needed"))
+		exprStr := getFlagString(cmd, "expression")
+		if exprStr == "" {
+			checkError(fmt.Errorf("flag -e (--expression) needed"))
 		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		// multiple new columns, e.g., -e 'total=$price*$qty; margin=($price-$cost)/$price'
+		names, exprs, err := parseMutate2Assignments(exprStr)
+		checkError(err)
+		if names == nil {
+			if !config.NoHeaderRow && name == "" && !config.NoOutHeader {
+				checkError(fmt.Errorf("falg -n (--name) needed"))
+			}
+			names = []string{name}
+		} else {
+			exprStr = strings.Join(exprs, mutate2ExprSep)
+		}
+
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -124,11 +185,6 @@ Custom functions:
 			checkError(writer.Error())
 		}()
 
-		exprStr := getFlagString(cmd, "expression")
-		if exprStr == "" {
-			checkError(fmt.Errorf("flag -e (--expression) needed"))
-		}
-
 		// custom functions
 		functions := map[string]govaluate.ExpressionFunction{
 			"len": func(args ...interface{}) (interface{}, error) {
@@ -173,6 +229,21 @@ Custom functions:
 			}
 		}
 
+		// functions added after the check above accept numbers as they are
+		for f, fn := range exprFunctions {
+			functions[f] = fn
+		}
+		containExprFuncs := reExprFunctions.MatchString(exprStr)
+
+		udfs, err := loadStarlarkUDFs(getFlagStringSlice(cmd, "udf"))
+		checkError(err)
+		for f, fn := range udfs {
+			if _, ok := functions[f]; ok {
+				checkError(fmt.Errorf("UDF conflicts with built-in function: %s", f))
+			}
+			functions[f] = fn
+		}
+
 		decimalWidth := getFlagNonNegativeInt(cmd, "decimal-width")
 		decimalFormat := fmt.Sprintf("%%.%df", decimalWidth)
 
@@ -195,13 +266,13 @@ Custom functions:
 
 		hasNullCoalescence := reNullCoalescence.MatchString(exprStr)
 
-		var quote string
+		exprStr, rowCtx, err := parseRowContext(exprStr, false)
+		checkError(err)
+
 		exprStr = reFiler2VarSymbolStartsWithDigits.ReplaceAllString(exprStr, "shenwei_$1$2")
 		exprStr = reFilter2VarField.ReplaceAllString(exprStr, "shenwei$1")
 		// exprStr = reFilter2VarSymbol.ReplaceAllString(exprStr, "")
-
-		var exprStr1 string
-		var expression *govaluate.EvaluableExpression
+		exprStrs := strings.Split(exprStr, mutate2ExprSep)
 
 		fuzzyFields := false
 
@@ -226,227 +297,216 @@ Custom functions:
 				DoNotAllowDuplicatedColumnName: true,
 			})
 
-			var parameters map[string]string
-			var parameters2 map[string]interface{}
-
-			var col string
-			var fieldTmp int
-			var _fields []int
-			var i int
-			var ok bool
-			var value string
-			var valueFloat float64
-			var result interface{}
 			var colnames2fileds map[string][]int // column name -> []field
 			var colnamesMap map[string]*regexp.Regexp
-			var selectWithColnames bool
-			var record2 []string // for output
-			keys := make([]string, 0, 8)
 
-			checkFirstLine := true
-			for record := range csvReader.Ch {
-				if record.Err != nil {
-					checkError(record.Err)
+			// insertColumn inserts the new columns at the position of "at"
+			insertColumn := func(record []string, values ...string) []string {
+				for i, value := range values {
+					record = append(record, value)
+					if at > 0 && at+i <= len(record) {
+						copy(record[at+i:], record[at+i-1:len(record)-1])
+						record[at+i-1] = value
+					}
 				}
+				return record
+			}
 
-				if checkFirstLine {
-					checkFirstLine = false
-
-					selectWithColnames = record.SelectWithColnames
+			writeHeader := func(record Record) { // do not replace head line
+				colnames2fileds = make(map[string][]int, len(record.Selected))
+				colnamesMap = make(map[string]*regexp.Regexp, len(record.Selected))
+				for i, col := range record.Selected {
+					if _, ok := colnames2fileds[col]; !ok {
+						colnames2fileds[col] = []int{record.Fields[i]}
+					} else {
+						colnames2fileds[col] = append(colnames2fileds[col], record.Fields[i])
+					}
 
-					parameters = make(map[string]string, len(record.All))
-					parameters2 = make(map[string]interface{}, len(record.All))
-					parameters2["shenweiNULL"] = nil
+					colnamesMap[col] = fuzzyField2Regexp(col)
+				}
 
-					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
-						colnames2fileds = make(map[string][]int, len(record.Selected))
+				if after != "" {
+					if _fields, ok := colnames2fileds[after]; ok {
+						at = _fields[len(_fields)-1] + 1
+					} else {
+						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, after, file))
+					}
+				} else if before != "" {
+					if _fields, ok := colnames2fileds[before]; ok {
+						at = _fields[0]
+					} else {
+						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, before, file))
+					}
+				}
 
-						colnamesMap = make(map[string]*regexp.Regexp, len(record.Selected))
-						for i, col = range record.Selected {
-							if _, ok = colnames2fileds[col]; !ok {
-								colnames2fileds[col] = []int{record.Fields[i]}
-							} else {
-								colnames2fileds[col] = append(colnames2fileds[col], record.Fields[i])
-							}
+				if !config.NoOutHeader {
+					checkError(writer.Write(insertColumn(record.All, names...)))
+				}
+			}
 
-							colnamesMap[col] = fuzzyField2Regexp(col)
+			mutate := func() func(*Record) bool {
+				parameters := make(map[string]string, 8)
+				parameters2 := map[string]interface{}{"shenweiNULL": nil}
+
+				var col string
+				var fieldTmp int
+				var value string
+				var valueFloat float64
+				var result interface{}
+				var selectWithColnames bool
+				var exprStr1 string
+				var expression *govaluate.EvaluableExpression
+				var quote string
+				var err error
+				keys := make([]string, 0, 8)
+				values := make([]string, 0, len(exprStrs))
+
+				return func(record *Record) bool {
+					if rowCtx != nil && record.Err == nil {
+						for i, v := range rowCtx.values(record) {
+							parameters[rowCtx.calls[i].placeholder] = exprValue(v, digitsAsString || containCustomFuncs, hasNullCoalescence)
 						}
+					}
 
-						value = name
-						record2 = record.All
-						record2 = append(record2, value)
-
-						if after != "" {
-							if _fields, ok = colnames2fileds[after]; ok {
-								at = _fields[len(_fields)-1] + 1
-							} else {
-								checkError(fmt.Errorf(`column "%s" not existed in file: %s`, after, file))
-							}
-							copy(record2[at:], record2[at-1:len(record2)-1])
-							record2[at-1] = value
-						} else if before != "" {
-							if _fields, ok = colnames2fileds[before]; ok {
-								at = _fields[0]
+					// prepare parameters
+					selectWithColnames = record.SelectWithColnames
+					if !selectWithColnames {
+						for _, fieldTmp = range record.Fields {
+							value = record.All[fieldTmp-1]
+							col = strconv.Itoa(fieldTmp)
+							if varType[col] == 1 {
+								col = "${" + col + "}"
 							} else {
-								checkError(fmt.Errorf(`column "%s" not existed in file: %s`, before, file))
+								col = fmt.Sprintf("shenwei%d", fieldTmp)
 							}
-							copy(record2[at:], record2[at-1:len(record2)-1])
-							record2[at-1] = value
-						} else if at > 0 && at <= len(record2) {
-							copy(record2[at:], record2[at-1:len(record2)-1])
-							record2[at-1] = value
-						}
-
-						if !config.NoOutHeader {
-							checkError(writer.Write(record2))
-						}
-
-						continue
-					}
-				}
-
-				// prepare parameters
-				if !selectWithColnames {
-					for _, fieldTmp = range record.Fields {
-						value = record.All[fieldTmp-1]
-						col = strconv.Itoa(fieldTmp)
-						if varType[col] == 1 {
-							col = "${" + col + "}"
-						} else {
-							col = fmt.Sprintf("shenwei%d", fieldTmp)
-						}
 
-						quote = `'`
+							quote = `'`
 
-						if reDigitals.MatchString(value) {
-							if digitsAsString || containCustomFuncs {
-								parameters[col] = quote + value + quote
-							} else {
-								valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
-								parameters[col] = fmt.Sprintf("%.16f", valueFloat)
-							}
-						} else {
-							if value == "" && hasNullCoalescence {
-								parameters[col] = "shenweiNULL"
-							} else {
-								if strings.Contains(value, `'`) {
-									value = strings.ReplaceAll(value, `'`, `\'`)
+							if reDigitals.MatchString(value) {
+								if digitsAsString || containCustomFuncs {
+									parameters[col] = quote + value + quote
+								} else {
+									valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
+									parameters[col] = fmt.Sprintf("%.16f", valueFloat)
 								}
-								if strings.Contains(value, `"`) {
-									value = strings.ReplaceAll(value, `"`, `\"`)
+							} else {
+								if value == "" && hasNullCoalescence {
+									parameters[col] = "shenweiNULL"
+								} else {
+									if strings.Contains(value, `'`) {
+										value = strings.ReplaceAll(value, `'`, `\'`)
+									}
+									if strings.Contains(value, `"`) {
+										value = strings.ReplaceAll(value, `"`, `\"`)
+									}
+
+									parameters[col] = quote + value + quote
 								}
-
-								parameters[col] = quote + value + quote
 							}
 						}
-					}
-				} else {
-					for col = range colnamesMap {
-						value = record.All[colnames2fileds[col][0]-1]
-
-						if reFiler2ColSymbolStartsWithDigits.MatchString(col) {
-							col = fmt.Sprintf("shenwei_%s", col)
-						} else if varType[col] == 1 {
-							col = "${" + col + "}"
-						} else {
-							col = "$" + col
-						}
-
-						quote = `'`
+					} else {
+						for col = range colnamesMap {
+							value = record.All[colnames2fileds[col][0]-1]
 
-						if reDigitals.MatchString(value) {
-							if digitsAsString || containCustomFuncs {
-								parameters[col] = quote + value + quote
+							if reFiler2ColSymbolStartsWithDigits.MatchString(col) {
+								col = fmt.Sprintf("shenwei_%s", col)
+							} else if varType[col] == 1 {
+								col = "${" + col + "}"
 							} else {
-								valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
-								parameters[col] = fmt.Sprintf("%.16f", valueFloat)
+								col = "$" + col
 							}
-						} else {
-							if value == "" && hasNullCoalescence {
-								parameters[col] = "shenweiNULL"
-							} else {
-								if strings.Contains(value, `'`) {
-									value = strings.ReplaceAll(value, `'`, `\'`)
+
+							quote = `'`
+
+							if reDigitals.MatchString(value) {
+								if digitsAsString || containCustomFuncs {
+									parameters[col] = quote + value + quote
+								} else {
+									valueFloat, _ = strconv.ParseFloat(removeComma(value), 64)
+									parameters[col] = fmt.Sprintf("%.16f", valueFloat)
 								}
-								if strings.Contains(value, `"`) {
-									value = strings.ReplaceAll(value, `"`, `\"`)
+							} else {
+								if value == "" && hasNullCoalescence {
+									parameters[col] = "shenweiNULL"
+								} else {
+									if strings.Contains(value, `'`) {
+										value = strings.ReplaceAll(value, `'`, `\'`)
+									}
+									if strings.Contains(value, `"`) {
+										value = strings.ReplaceAll(value, `"`, `\"`)
+									}
+
+									parameters[col] = quote + value + quote
 								}
-
-								parameters[col] = quote + value + quote
 							}
 						}
 					}
-				}
-
-				// sort variable names by length, so we can replace variables in the right order.
-				// e.g., for -e '$reads_mapped/$reads', we should firstly replace $reads_mapped then $reads.
-				keys = keys[:0]
-				for col = range parameters {
-					keys = append(keys, col)
-				}
-				sort.Slice(keys, func(i, j int) bool {
-					return len(keys[i]) > len(keys[j])
-				})
-
-				// replace variable with column data
-				exprStr1 = exprStr
-				for _, col = range keys {
-					exprStr1 = strings.ReplaceAll(exprStr1, col, parameters[col])
-				}
 
-				// evaluate
-				if containCustomFuncs {
-					expression, err = govaluate.NewEvaluableExpressionWithFunctions(exprStr1, functions)
-				} else {
-					expression, err = govaluate.NewEvaluableExpression(exprStr1)
-				}
-				checkError(err)
+					// sort variable names by length, so we can replace variables in the right order.
+					// e.g., for -e '$reads_mapped/$reads', we should firstly replace $reads_mapped then $reads.
+					keys = keys[:0]
+					for col = range parameters {
+						keys = append(keys, col)
+					}
+					sort.Slice(keys, func(i, j int) bool {
+						return len(keys[i]) > len(keys[j])
+					})
+
+					values = values[:0]
+					for _, exprStr0 := range exprStrs {
+						// replace variable with column data
+						exprStr1 = exprStr0
+						for _, col = range keys {
+							exprStr1 = strings.ReplaceAll(exprStr1, col, parameters[col])
+						}
 
-				// check result
-				if hasNullCoalescence {
-					result, err = expression.Evaluate(parameters2)
-				} else {
-					result, err = expression.Evaluate(emptyParams)
-				}
-				if err != nil {
-					checkError(fmt.Errorf("data: %s, err: %s", record.All, err))
-				}
-				switch result.(type) {
-				case bool:
-					value = fmt.Sprintf("%v", result)
-				case float32, float64:
-					value = fmt.Sprintf(decimalFormat, result)
-				case int, int32, int64:
-					value = fmt.Sprintf("%d", result)
-				default:
-					value = fmt.Sprintf("%s", result)
-				}
+						// evaluate
+						if containCustomFuncs || containExprFuncs || len(udfs) > 0 {
+							expression, err = govaluate.NewEvaluableExpressionWithFunctions(exprStr1, functions)
+						} else {
+							expression, err = govaluate.NewEvaluableExpression(exprStr1)
+						}
+						checkError(err)
 
-				record2 = record.All
-				record2 = append(record2, value)
+						// check result
+						if hasNullCoalescence {
+							result, err = expression.Evaluate(parameters2)
+						} else {
+							result, err = expression.Evaluate(emptyParams)
+						}
+						if err != nil {
+							checkError(fmt.Errorf("data: %s, err: %s", record.All, err))
+						}
+						switch result.(type) {
+						case bool:
+							value = fmt.Sprintf("%v", result)
+						case float32, float64:
+							value = fmt.Sprintf(decimalFormat, result)
+						case int, int32, int64:
+							value = fmt.Sprintf("%d", result)
+						case nil:
+							value = ""
+						default:
+							value = fmt.Sprintf("%s", result)
+						}
 
-				if after != "" {
-					if _fields, ok = colnames2fileds[after]; ok {
-						at = _fields[len(_fields)-1] + 1
-					} else {
-						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, after, file))
-					}
-					copy(record2[at:], record2[at-1:len(record2)-1])
-					record2[at-1] = value
-				} else if before != "" {
-					if _fields, ok = colnames2fileds[before]; ok {
-						at = _fields[0]
-					} else {
-						checkError(fmt.Errorf(`column "%s" not existed in file: %s`, before, file))
+						values = append(values, value)
 					}
-					copy(record2[at:], record2[at-1:len(record2)-1])
-					record2[at-1] = value
-				} else if at > 0 && at <= len(record2) {
-					copy(record2[at:], record2[at-1:len(record2)-1])
-					record2[at-1] = value
+					record.All = insertColumn(record.All, values...)
+					return true
 				}
+			}
+
+			ch := csvReader.Ch
+			if rowCtx != nil {
+				ch = rowCtx.records(ch, config.NoHeaderRow)
+			}
 
-				checkError(writer.Write(record2))
+			for record := range parallelRecords(ch, config.NumCPUs, config.NoHeaderRow, writeHeader, mutate) {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+				checkError(writer.Write(record.All))
 			}
 
 			readerReport(&config, csvReader, file)
@@ -457,12 +517,117 @@ Custom functions:
 func init() {
 	RootCmd.AddCommand(mutate2Cmd)
 	mutate2Cmd.Flags().StringP("expression", "e", "", `arithmetic/string expressions. e.g. "'string'", '"abc"', ' $a + "-" + $b ', '$1 + $2', '$a / $b', ' $1 > 100 ? "big" : "small" '`)
-	mutate2Cmd.Flags().StringP("name", "n", "", `new column name`)
+	mutate2Cmd.Flags().StringP("name", "n", "", `new column name, not needed for multiple new columns in the form of 'name=expression'`)
 	mutate2Cmd.Flags().BoolP("numeric-as-string", "s", false, `treat even numeric fields as strings to avoid converting big numbers into scientific notation`)
 	mutate2Cmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
 	mutate2Cmd.Flags().IntP("at", "", 0, "where the new column should appear, 1 for the 1st column, 0 for the last column")
 	mutate2Cmd.Flags().StringP("after", "", "", "insert the new column right after the given column name")
 	mutate2Cmd.Flags().StringP("before", "", "", "insert the new column right before the given column name")
+	mutate2Cmd.Flags().StringSliceP("udf", "", []string{}, `Starlark files of user-defined functions, multiple values supported`)
 }
 
 var reNullCoalescence = regexp.MustCompile(`\?\?`)
+
+// mutate2ExprSep joins multiple expressions for preprocessing them at once.
+const mutate2ExprSep = " \x00 "
+
+// parseMutate2Assignments parses multiple assignments separated by semicolons,
+// e.g., 'total=$price*$qty; margin=($price-$cost)/$price'. References of
+// earlier new columns are replaced with their expressions. It returns nil
+// names for a single expression without assignment.
+func parseMutate2Assignments(s string) ([]string, []string, error) {
+	parts := make([]string, 0, 4)
+	var quote rune
+	var brace bool
+	var start int
+	var prev rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote && prev != '\\' {
+				quote = 0
+			}
+		case brace:
+			if c == '}' {
+				brace = false
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '{' && prev == '$':
+			brace = true
+		case c == ';':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+		prev = c
+	}
+	parts = append(parts, s[start:])
+
+	names := make([]string, 0, len(parts))
+	exprs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		i := mutate2AssignmentIndex(part)
+		if i < 0 {
+			if len(parts) == 1 {
+				return nil, nil, nil
+			}
+			return nil, nil, fmt.Errorf("multiple expressions should be in the form of 'name=expression': %s", strings.TrimSpace(part))
+		}
+		name := strings.TrimSpace(part[:i])
+		if name == "" || strings.ContainsAny(name, `$'"()`) {
+			return nil, nil, fmt.Errorf("invalid column name in: %s", strings.TrimSpace(part))
+		}
+		names = append(names, name)
+		exprs = append(exprs, strings.TrimSpace(part[i+1:]))
+	}
+	if len(names) == 0 {
+		return nil, nil, nil
+	}
+
+	// replace references of earlier new columns
+	defined := make(map[string]string, len(names))
+	for i, expr := range exprs {
+		exprs[i] = reFilter2.ReplaceAllStringFunc(expr, func(v string) string {
+			if e, ok := defined[exprFieldName(v)]; ok {
+				if reFilter2.FindString(e) == e { // a single variable
+					return e
+				}
+				return "(" + e + ")"
+			}
+			return v
+		})
+		defined[names[i]] = exprs[i]
+	}
+	return names, exprs, nil
+}
+
+// mutate2AssignmentIndex returns the index of "=" of an assignment, which is
+// not a part of "==", "=~", "!=", "<=" or ">=", or -1 if not found.
+func mutate2AssignmentIndex(s string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == quote && s[i-1] != '\\' {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '=':
+			if i+1 < len(s) && (s[i+1] == '=' || s[i+1] == '~') {
+				return -1
+			}
+			if i > 0 && strings.IndexByte("!<>=", s[i-1]) >= 0 {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"regexp"
 	"runtime"
@@ -139,11 +138,11 @@ type mutate3Opts struct {
 }
 
 func doMutate3(config Config, opts mutate3Opts) {
-	outfh, err := xopen.Wopen(config.OutFile)
+	outfh, err := wopen(config.OutFile)
 	checkError(err)
 	defer outfh.Close()
 
-	writer := csv.NewWriter(outfh)
+	writer := newCSVWriter(outfh)
 	if config.OutTabs || config.Tabs {
 		if config.OutDelimiter == ',' {
 			writer.Comma = '\t'
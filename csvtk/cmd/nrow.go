@@ -45,7 +45,7 @@ var nrowCmd = &cobra.Command{
 
 		printFileName := getFlagBool(cmd, "file-name")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -0,0 +1,299 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// numfmtCmd represents the numfmt command
+var numfmtCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "numfmt",
+	Short: "format numbers with thousands separators, percents, currencies and human-readable sizes",
+	Long: `format numbers with thousands separators, percents, currencies and human-readable sizes
+
+Styles (-s/--style):
+  number      1234567.891 -> 1,234,567.891
+  percent     0.1234      -> 12.34%  (values are multiplied by 100 unless -r/--raw-percent)
+  currency    1234.5      -> $1,234.50
+  sci         1234567.891 -> 1.23e+06
+  si          1500000     -> 1.5M    (base 1000)
+  iec         3435973837  -> 3.2Gi   (base 1024), 3.2GiB with -u B
+
+Locales (-L/--locale), which can be overridden by --decimal-sep and
+--thousands-sep:
+  en    1,234.5
+  de    1.234,5
+  fr    1 234,5
+  ch    1'234.5
+
+Decimals (-n/--decimals): -1 for the shortest representation, except for
+the style currency (2) and styles si/iec (1, trailing zeros removed).
+
+Values that are not numbers are kept unchanged.
+
+Examples:
+
+    csvtk numfmt -f price -s currency --currency '€' --currency-suffix -L de
+    csvtk numfmt -f size -s iec -u B
+    csvtk numfmt -f ratio -s percent -n 1
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+
+		style := strings.ToLower(getFlagString(cmd, "style"))
+		switch style {
+		case "number", "percent", "currency", "sci", "si", "iec":
+		default:
+			checkError(fmt.Errorf("unsupported style: %s. available: number, percent, currency, sci, si, iec", style))
+		}
+
+		locale := strings.ToLower(getFlagString(cmd, "locale"))
+		decimalSep, thousandsSeps, ok := castLocales(locale)
+		if !ok {
+			checkError(fmt.Errorf("unsupported locale: %s. available: en, de, fr, ch", locale))
+		}
+		thousandsSep := thousandsSeps[0]
+		if cmd.Flags().Changed("decimal-sep") {
+			decimalSep = getFlagString(cmd, "decimal-sep")
+		}
+		if cmd.Flags().Changed("thousands-sep") {
+			thousandsSep = getFlagString(cmd, "thousands-sep")
+		}
+		if getFlagBool(cmd, "no-grouping") {
+			thousandsSep = ""
+		}
+
+		nf := &numberFormatter{
+			style:          style,
+			decimals:       getFlagInt(cmd, "decimals"),
+			decimalSep:     decimalSep,
+			thousandsSep:   thousandsSep,
+			currency:       getFlagString(cmd, "currency"),
+			currencySuffix: getFlagBool(cmd, "currency-suffix"),
+			rawPercent:     getFlagBool(cmd, "raw-percent"),
+			unit:           getFlagString(cmd, "unit"),
+		}
+		if nf.decimals < -1 {
+			checkError(fmt.Errorf("value of flag -n/--decimals should be >= -1"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk numfmt: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr:    fieldStr,
+				FuzzyFields: fuzzyFields,
+			})
+
+			checkFirstLine := true
+			var f int
+			var v float64
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					if !config.NoHeaderRow || record.IsHeaderRow {
+						if config.NoOutHeader {
+							continue
+						}
+						checkError(writer.Write(record.All))
+						continue
+					}
+				}
+
+				for _, f = range record.Fields {
+					v, err = strconv.ParseFloat(strings.TrimSpace(record.All[f-1]), 64)
+					if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+						continue
+					}
+					record.All[f-1] = nf.format(v)
+				}
+				checkError(writer.Write(record.All))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(numfmtCmd)
+	numfmtCmd.Flags().StringP("fields", "f", "1", `select only these fields. e.g -f 1,2 or -f columnA,columnB`)
+	numfmtCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	numfmtCmd.Flags().StringP("style", "s", "number", `style: number, percent, currency, sci, si, iec`)
+	numfmtCmd.Flags().IntP("decimals", "n", -1, `number of decimals, -1 for the default of the style`)
+	numfmtCmd.Flags().StringP("locale", "L", "en", `locale of numbers: en, de, fr, ch`)
+	numfmtCmd.Flags().StringP("decimal-sep", "", ".", `decimal separator, overriding --locale`)
+	numfmtCmd.Flags().StringP("thousands-sep", "", ",", `thousands separator, overriding --locale`)
+	numfmtCmd.Flags().BoolP("no-grouping", "G", false, `do not add thousands separators`)
+	numfmtCmd.Flags().StringP("currency", "c", "$", `currency symbol for the style currency`)
+	numfmtCmd.Flags().BoolP("currency-suffix", "", false, `put the currency symbol after numbers, e.g., "1.234,50 €"`)
+	numfmtCmd.Flags().BoolP("raw-percent", "r", false, `values are already percents, do not multiply them by 100`)
+	numfmtCmd.Flags().StringP("unit", "u", "", `unit appended to the styles si and iec, e.g., "B" for "3.2GiB"`)
+}
+
+// numberFormatter formats numbers in a style.
+type numberFormatter struct {
+	style          string
+	decimals       int
+	decimalSep     string
+	thousandsSep   string
+	currency       string
+	currencySuffix bool
+	rawPercent     bool
+	unit           string
+}
+
+var siPrefixes = []string{"", "k", "M", "G", "T", "P", "E", "Z", "Y"}
+var iecPrefixes = []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"}
+
+func (nf *numberFormatter) format(v float64) string {
+	switch nf.style {
+	case "percent":
+		if !nf.rawPercent {
+			v *= 100
+			// remove the noise of multiplication, e.g., 0.07*100 = 7.000000000000001
+			v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 15, 64), 64)
+		}
+		return nf.localize(strconv.FormatFloat(v, 'f', nf.decimals, 64)) + "%"
+	case "currency":
+		decimals := nf.decimals
+		if decimals < 0 {
+			decimals = 2
+		}
+		var sign string
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		s := nf.localize(strconv.FormatFloat(v, 'f', decimals, 64))
+		if nf.currencySuffix {
+			return sign + s + " " + nf.currency
+		}
+		return sign + nf.currency + s
+	case "sci":
+		s := strconv.FormatFloat(v, 'e', nf.decimals, 64)
+		if nf.decimalSep != "." {
+			s = strings.Replace(s, ".", nf.decimalSep, 1)
+		}
+		return s
+	case "si", "iec":
+		base, prefixes := 1000.0, siPrefixes
+		if nf.style == "iec" {
+			base, prefixes = 1024.0, iecPrefixes
+		}
+		var i int
+		a := math.Abs(v)
+		for a >= base && i < len(prefixes)-1 {
+			a /= base
+			v /= base
+			i++
+		}
+		var s string
+		if nf.decimals < 0 {
+			s = strconv.FormatFloat(v, 'f', 1, 64)
+			s = strings.TrimSuffix(s, ".0")
+		} else {
+			s = strconv.FormatFloat(v, 'f', nf.decimals, 64)
+		}
+		return nf.localize(s) + prefixes[i] + nf.unit
+	}
+	return nf.localize(strconv.FormatFloat(v, 'f', nf.decimals, 64))
+}
+
+// localize adds thousands separators to a number formatted by strconv and
+// replaces the decimal point.
+func (nf *numberFormatter) localize(s string) string {
+	var sign string
+	if s != "" && s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+
+	if nf.thousandsSep != "" && len(intPart) > 3 {
+		var b strings.Builder
+		n := len(intPart) % 3
+		if n > 0 {
+			b.WriteString(intPart[:n])
+		}
+		for i := n; i < len(intPart); i += 3 {
+			if b.Len() > 0 {
+				b.WriteString(nf.thousandsSep)
+			}
+			b.WriteString(intPart[i : i+3])
+		}
+		intPart = b.String()
+	}
+
+	if hasFrac {
+		return sign + intPart + nf.decimalSep + fracPart
+	}
+	return sign + intPart
+}
@@ -0,0 +1,199 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/azureblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/s3blob"
+)
+
+// objectSchemes maps schemes of object-store URLs to schemes of gocloud.dev/blob.
+var objectSchemes = map[string]string{
+	"s3": "s3",
+	"gs": "gs",
+	"az": "azblob",
+}
+
+// isObjectURL returns true if the file is an object-store URL,
+// i.e., s3://bucket/key, gs://bucket/key, or az://container/key.
+func isObjectURL(file string) bool {
+	i := strings.Index(file, "://")
+	if i <= 0 {
+		return false
+	}
+	_, ok := objectSchemes[file[:i]]
+	return ok
+}
+
+// parseObjectURL splits an object-store URL into the bucket URL for
+// gocloud.dev/blob and the key.
+func parseObjectURL(file string) (string, string, error) {
+	u, err := url.Parse(file)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid object-store URL: %s", file)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid object-store URL, <scheme>://<bucket>/<key> expected: %s", file)
+	}
+	bucket := objectSchemes[u.Scheme] + "://" + u.Host
+	if u.RawQuery != "" {
+		bucket += "?" + u.RawQuery
+	}
+	return bucket, key, nil
+}
+
+// objectReader closes both the object reader and the bucket.
+type objectReader struct {
+	*blob.Reader
+	bucket *blob.Bucket
+}
+
+func (r *objectReader) Close() error {
+	err := r.Reader.Close()
+	if err2 := r.bucket.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// openObject opens an object for streaming reading, with ambient credentials.
+func openObject(file string) (io.ReadCloser, error) {
+	bucketURL, key, err := parseObjectURL(file)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, bucketURL)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open bucket %s: %s", bucketURL, err)
+	}
+	r, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		bucket.Close()
+		return nil, fmt.Errorf("fail to read %s: %s", file, err)
+	}
+	return &objectReader{Reader: r, bucket: bucket}, nil
+}
+
+// uploadObject uploads a local file to an object-store URL.
+func uploadObject(localFile string, file string) error {
+	bucketURL, key, err := parseObjectURL(file)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, bucketURL)
+	if err != nil {
+		return fmt.Errorf("fail to open bucket %s: %s", bucketURL, err)
+	}
+	defer bucket.Close()
+
+	fh, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	w, err := bucket.NewWriter(ctx, key, nil)
+	if err != nil {
+		return fmt.Errorf("fail to write %s: %s", file, err)
+	}
+	if _, err = io.Copy(w, fh); err != nil {
+		w.Close()
+		return fmt.Errorf("fail to write %s: %s", file, err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("fail to write %s: %s", file, err)
+	}
+	return nil
+}
+
+// Outputs to object-store URLs are written to temporary files first,
+// which are uploaded after the command succeeds.
+var objectOutputs = struct {
+	sync.Mutex
+	tmpDir string
+	files  map[string]string // object-store URL -> temporary file
+}{files: make(map[string]string)}
+
+// objectOutputFile returns a temporary file for an object-store URL,
+// with the same base name so that the compression format is kept.
+func objectOutputFile(file string) (string, error) {
+	_, key, err := parseObjectURL(file)
+	if err != nil {
+		return "", err
+	}
+
+	objectOutputs.Lock()
+	defer objectOutputs.Unlock()
+
+	if tmp, ok := objectOutputs.files[file]; ok {
+		return tmp, nil
+	}
+	if objectOutputs.tmpDir == "" {
+		dir, err := os.MkdirTemp("", "csvtk-output-")
+		if err != nil {
+			return "", err
+		}
+		objectOutputs.tmpDir = dir
+	}
+	dir, err := os.MkdirTemp(objectOutputs.tmpDir, "")
+	if err != nil {
+		return "", err
+	}
+	tmp := filepath.Join(dir, filepath.Base(key))
+	objectOutputs.files[file] = tmp
+	return tmp, nil
+}
+
+// UploadObjectOutputs uploads outputs to object-store URLs,
+// and removes the temporary files.
+func UploadObjectOutputs() error {
+	objectOutputs.Lock()
+	defer objectOutputs.Unlock()
+
+	if objectOutputs.tmpDir == "" {
+		return nil
+	}
+	defer os.RemoveAll(objectOutputs.tmpDir)
+
+	for file, tmp := range objectOutputs.files {
+		if _, err := os.Stat(tmp); os.IsNotExist(err) { // no output
+			continue
+		}
+		if err := uploadObject(tmp, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// outlierCmd represents the outlier command
+var outlierCmd = &cobra.Command{
+	GroupID: "set",
+
+	Use:     "outlier",
+	Aliases: []string{"outliers"},
+	Short:   "detect outliers of numeric fields, and flag or remove them",
+	Long: `detect outliers of numeric fields, and flag or remove them
+
+Methods (-m/--method) and the default thresholds (--threshold):
+
+  zscore      |x - mean| / stdev > 3
+  mad         modified z-score: 0.6745 * |x - median| / MAD > 3.5
+  iqr         x < Q1 - 1.5 * IQR or x > Q3 + 1.5 * IQR
+  percentile  x < the --lower percentile (1) or x > the --upper percentile (99)
+
+Statistics are computed within groups if -g/--groups is given.
+A record is an outlier if the value of any selected field is an outlier.
+
+Actions (-a/--action):
+
+  flag     append a column (-n/--name) of "true" or "false" (default)
+  remove   remove outliers
+  keep     only keep outliers
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		groupsStr := getFlagString(cmd, "groups")
+		method := strings.ToLower(getFlagString(cmd, "method"))
+		threshold := getFlagFloat64(cmd, "threshold")
+		switch method {
+		case "zscore":
+			if !cmd.Flags().Changed("threshold") {
+				threshold = 3
+			}
+		case "mad":
+			if !cmd.Flags().Changed("threshold") {
+				threshold = 3.5
+			}
+		case "iqr":
+			if !cmd.Flags().Changed("threshold") {
+				threshold = 1.5
+			}
+		case "percentile":
+		default:
+			checkError(fmt.Errorf("invalid method: %s. available: zscore, mad, iqr, percentile", method))
+		}
+		if threshold < 0 {
+			checkError(fmt.Errorf("value of --threshold should not be negative: %f", threshold))
+		}
+		lower := getFlagFloat64(cmd, "lower")
+		upper := getFlagFloat64(cmd, "upper")
+		if lower < 0 || upper > 100 || lower >= upper {
+			checkError(fmt.Errorf("invalid values of --lower (%f) and --upper (%f), 0 <= lower < upper <= 100 required", lower, upper))
+		}
+		action := strings.ToLower(getFlagString(cmd, "action"))
+		switch action {
+		case "flag", "remove", "keep":
+		default:
+			checkError(fmt.Errorf("invalid action: %s. available: flag, remove, keep", action))
+		}
+		name := getFlagString(cmd, "name")
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+
+		file := files[0]
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+		if header == nil {
+			return
+		}
+
+		fields := selectFieldsByHeader(header, fieldStr, fuzzyFields)
+		var groupFields []int
+		if groupsStr != "" {
+			groupFields = selectFieldsByHeader(header, groupsStr, false)
+		}
+
+		// rows of groups
+		groups := make(map[string][]int, 8)
+		groupsOrder := make([]string, 0, 8)
+		groupKey := make([]string, len(groupFields))
+		for r, record := range data {
+			for i, f := range groupFields {
+				groupKey[i] = record[f-1]
+			}
+			key := strings.Join(groupKey, "_shenwei356_")
+			if _, ok := groups[key]; !ok {
+				groupsOrder = append(groupsOrder, key)
+			}
+			groups[key] = append(groups[key], r)
+		}
+
+		outliers := make([]bool, len(data))
+		var nums, sorted, devs []float64
+		var valid []bool
+		for _, key := range groupsOrder {
+			rows := groups[key]
+			for _, f := range fields {
+				c := f - 1
+
+				nums = nums[:0]
+				valid = valid[:0]
+				sorted = sorted[:0]
+				for _, r := range rows {
+					v := data[r][c]
+					if !reDigitals.MatchString(v) {
+						if ignore {
+							nums = append(nums, 0)
+							valid = append(valid, false)
+							continue
+						}
+						checkError(fmt.Errorf("column %s has non-numeric data: %s, you can use flag -i/--ignore-non-numbers to skip these data", header[c], v))
+					}
+					x, err := strconv.ParseFloat(removeComma(v), 64)
+					checkError(err)
+					nums = append(nums, x)
+					valid = append(valid, true)
+					sorted = append(sorted, x)
+				}
+				if len(sorted) == 0 {
+					continue
+				}
+				sort.Float64s(sorted)
+
+				// a function returning whether x is an outlier
+				var isOutlier func(x float64) bool
+				switch method {
+				case "zscore":
+					mean := allStats["mean"](sorted)
+					sd := allStats["stdev"](sorted)
+					isOutlier = func(x float64) bool {
+						return sd > 0 && math.Abs(x-mean)/sd > threshold
+					}
+				case "mad":
+					med := median(sorted)
+					devs = devs[:0]
+					for _, x := range sorted {
+						devs = append(devs, math.Abs(x-med))
+					}
+					sort.Float64s(devs)
+					mad := median(devs)
+					isOutlier = func(x float64) bool {
+						return mad > 0 && 0.6745*math.Abs(x-med)/mad > threshold
+					}
+				case "iqr":
+					q1 := percentileValue(sorted, 0.25)
+					q3 := percentileValue(sorted, 0.75)
+					iqr := q3 - q1
+					isOutlier = func(x float64) bool {
+						return x < q1-threshold*iqr || x > q3+threshold*iqr
+					}
+				case "percentile":
+					lo := outlierPercentile(sorted, lower/100)
+					hi := outlierPercentile(sorted, upper/100)
+					isOutlier = func(x float64) bool {
+						return x < lo || x > hi
+					}
+				}
+
+				for k, r := range rows {
+					if valid[k] && isOutlier(nums[k]) {
+						outliers[r] = true
+					}
+				}
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if !config.NoHeaderRow && !config.NoOutHeader {
+			if action == "flag" {
+				header = append(header, name)
+			}
+			checkError(writer.Write(header))
+		}
+		for r, record := range data {
+			switch action {
+			case "flag":
+				checkError(writer.Write(append(record, strconv.FormatBool(outliers[r]))))
+			case "remove":
+				if !outliers[r] {
+					checkError(writer.Write(record))
+				}
+			case "keep":
+				if outliers[r] {
+					checkError(writer.Write(record))
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(outlierCmd)
+	outlierCmd.Flags().StringP("fields", "f", "", `numeric fields to check. e.g -f 1,2 or -f columnA,columnB`)
+	outlierCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	outlierCmd.Flags().StringP("groups", "g", "", `detect outliers within groups via fields. e.g -g 1,2 or -g columnA,columnB`)
+	outlierCmd.Flags().StringP("method", "m", "iqr", `detection method: zscore, mad, iqr, percentile`)
+	outlierCmd.Flags().Float64P("threshold", "", 0, `threshold of the method, default: 3 for zscore, 3.5 for mad, 1.5 for iqr`)
+	outlierCmd.Flags().Float64P("lower", "", 1, `lower percentile cutoff (0-100) for the method percentile`)
+	outlierCmd.Flags().Float64P("upper", "", 99, `upper percentile cutoff (0-100) for the method percentile`)
+	outlierCmd.Flags().StringP("action", "a", "flag", `action for outliers: flag, remove, keep`)
+	outlierCmd.Flags().StringP("name", "n", "is_outlier", `name of the flag column`)
+	outlierCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore non-numeric values like "NA" or "N/A"`)
+}
+
+// outlierPercentile returns the percentile (0-1) of sorted values.
+func outlierPercentile(sorted []float64, p float64) float64 {
+	if p >= 1 {
+		return sorted[len(sorted)-1]
+	}
+	return percentileValue(sorted, p)
+}
@@ -0,0 +1,117 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+// parallelChunkSize is the number of records in a chunk processed by a worker.
+const parallelChunkSize = 1024
+
+// parallelRecords processes records from ch in chunks by threads workers,
+// and sends them to the returned channel in the input order.
+//
+// The header row (the first record unless noHeaderRow is true) is passed
+// to onHeader before any other record is processed, so it can be used to
+// set up states shared by workers. newFunc is called once for each worker
+// to create a function for processing a record, so workers do not share
+// any mutable state. Records for which the function returns false are
+// dropped, and records with errors are passed through unprocessed.
+func parallelRecords(ch chan Record, threads int, noHeaderRow bool,
+	onHeader func(Record), newFunc func() func(*Record) bool) chan Record {
+	out := make(chan Record, parallelChunkSize)
+	if threads < 1 {
+		threads = 1
+	}
+
+	type chunk struct {
+		records []Record
+		keep    []bool
+		done    chan struct{}
+	}
+	newChunk := func() *chunk {
+		return &chunk{
+			records: make([]Record, 0, parallelChunkSize),
+			keep:    make([]bool, 0, parallelChunkSize),
+			done:    make(chan struct{}),
+		}
+	}
+
+	jobs := make(chan *chunk, threads)
+	queue := make(chan *chunk, threads*2) // chunks in order
+
+	go func() {
+		for c := range queue {
+			<-c.done
+			for i, record := range c.records {
+				if c.keep[i] {
+					out <- record
+				}
+			}
+		}
+		close(out)
+	}()
+
+	go func() {
+		first := true
+		started := false
+		c := newChunk()
+		send := func() {
+			if !started { // workers are started after the header row is handled
+				started = true
+				for i := 0; i < threads; i++ {
+					go func() {
+						fn := newFunc()
+						for c := range jobs {
+							for i := range c.records {
+								c.keep[i] = c.keep[i] || fn(&c.records[i])
+							}
+							close(c.done)
+						}
+					}()
+				}
+			}
+			queue <- c
+			jobs <- c
+		}
+
+		for record := range ch {
+			if first {
+				first = false
+				if record.Err == nil && (!noHeaderRow || record.IsHeaderRow) {
+					onHeader(record)
+					continue
+				}
+			}
+
+			c.records = append(c.records, record)
+			c.keep = append(c.keep, record.Err != nil)
+			if len(c.records) == parallelChunkSize {
+				send()
+				c = newChunk()
+			}
+		}
+		if len(c.records) > 0 {
+			send()
+		}
+		close(jobs)
+		close(queue)
+	}()
+
+	return out
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallelRecords(t *testing.T) {
+	errBad := errors.New("bad row")
+	isBad := func(i int) bool { return i%1000 == 999 }
+
+	for _, n := range []int{0, 1, parallelChunkSize - 1, parallelChunkSize, parallelChunkSize*2 + 1, 5000} {
+		for _, threads := range []int{0, 1, 4, 8} {
+			for _, noHeaderRow := range []bool{false, true} {
+				ch := make(chan Record, 64)
+				go func() {
+					if !noHeaderRow {
+						ch <- Record{All: []string{"id"}}
+					}
+					for i := 0; i < n; i++ {
+						record := Record{Row: i + 1, All: []string{strconv.Itoa(i)}}
+						if isBad(i) {
+							record.Err = errBad
+						}
+						ch <- record
+					}
+					close(ch)
+				}()
+
+				var header []string
+				var prefix string // set by onHeader, read by workers
+				var workers int32
+				onHeader := func(record Record) {
+					if header != nil {
+						t.Errorf("onHeader called more than once")
+					}
+					header = record.All
+					prefix = record.All[0] + ":"
+				}
+				newFunc := func() func(*Record) bool {
+					atomic.AddInt32(&workers, 1)
+					return func(record *Record) bool {
+						if noHeaderRow {
+							record.All[0] = "_:" + record.All[0]
+						} else {
+							record.All[0] = prefix + record.All[0]
+						}
+						return (record.Row-1)%2 == 0 // odd rows are dropped
+					}
+				}
+
+				var got []Record
+				for record := range parallelRecords(ch, threads, noHeaderRow, onHeader, newFunc) {
+					got = append(got, record)
+				}
+
+				name := "n=" + strconv.Itoa(n) + ",threads=" + strconv.Itoa(threads) + ",noHeaderRow=" + strconv.FormatBool(noHeaderRow)
+				if noHeaderRow && header != nil {
+					t.Errorf("%s: onHeader should not be called", name)
+				}
+				if !noHeaderRow && (len(header) != 1 || header[0] != "id") {
+					t.Errorf("%s: header row: want [id], got %v", name, header)
+				}
+				if w := int(atomic.LoadInt32(&workers)); n > 0 && (w < 1 || w > max(threads, 1)) {
+					t.Errorf("%s: number of workers: want 1-%d, got %d", name, max(threads, 1), w)
+				}
+
+				j := 0
+				for i := 0; i < n; i++ {
+					if !isBad(i) && i%2 == 1 {
+						continue
+					}
+					if j >= len(got) {
+						t.Errorf("%s: missing record of row %d", name, i+1)
+						break
+					}
+					record := got[j]
+					j++
+					if record.Row != i+1 {
+						t.Errorf("%s: records out of order: want row %d, got %d", name, i+1, record.Row)
+						break
+					}
+					if isBad(i) { // records with errors are passed through unprocessed
+						if record.Err != errBad || record.All[0] != strconv.Itoa(i) {
+							t.Errorf("%s: record with error should be passed through: %v", name, record)
+						}
+						continue
+					}
+					expect := "id:" + strconv.Itoa(i)
+					if noHeaderRow {
+						expect = "_:" + strconv.Itoa(i)
+					}
+					if record.All[0] != expect {
+						t.Errorf("%s: want %s, got %s", name, expect, record.All[0])
+					}
+				}
+				if j != len(got) {
+					t.Errorf("%s: number of records: want %d, got %d", name, j, len(got))
+				}
+			}
+		}
+	}
+}
+
+func TestParallelRecordsHeaderRowWithNoHeaderRow(t *testing.T) {
+	// the first record is still passed to onHeader if it's marked as the header row by the reader
+	ch := make(chan Record, 3)
+	ch <- Record{IsHeaderRow: true, All: []string{"id"}}
+	ch <- Record{Row: 1, All: []string{"1"}}
+	ch <- Record{Row: 2, All: []string{"2"}}
+	close(ch)
+
+	var header []string
+	out := parallelRecords(ch, 2, true, func(record Record) { header = record.All },
+		func() func(*Record) bool { return func(*Record) bool { return true } })
+	var rows []int
+	for record := range out {
+		rows = append(rows, record.Row)
+	}
+	if len(header) != 1 || header[0] != "id" {
+		t.Errorf("header row: want [id], got %v", header)
+	}
+	if len(rows) != 2 || rows[0] != 1 || rows[1] != 2 {
+		t.Errorf("rows: want [1 2], got %v", rows)
+	}
+}
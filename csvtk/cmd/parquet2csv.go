@@ -0,0 +1,146 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/spf13/cobra"
+)
+
+// parquet2csvCmd represents the parquet2csv command
+var parquet2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "parquet2csv",
+	Short: "convert Parquet to CSV format",
+	Long: `convert Parquet to CSV format
+
+Notes:
+  1. Null values are converted to empty strings, or the value of --na.
+  2. Stdin and http(s) URLs are supported, but the whole file is loaded into memory.
+  3. All commands can read Parquet files directly with the global flag
+     "--in-format parquet".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		na := getFlagString(cmd, "na")
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := !config.NoOutHeader
+		var record []string
+		for _, file := range files {
+			source, err := newParquetSource(file, na)
+			checkError(err)
+
+			if printHeaderRow {
+				checkError(writer.Write(source.colnames))
+				printHeaderRow = false // only print the header row of the first file
+			}
+			for {
+				record, err = source.Read()
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+				checkError(writer.Write(record))
+			}
+			checkError(source.Close())
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(parquet2csvCmd)
+	parquet2csvCmd.Flags().StringP("na", "", "", `content for null values`)
+}
+
+// newParquetSource creates a source of records from a Parquet file.
+// The whole file is loaded into memory for stdin, URLs and compressed files.
+func newParquetSource(filename string, na string) (*arrowSource, error) {
+	var r parquet.ReaderAtSeeker
+	var fh *os.File
+	if isStdin(filename) || isURL(filename) || inCompressed() {
+		data, err := readAllDecompressed(filename)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	} else {
+		var err error
+		fh, err = os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		r = fh
+	}
+
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		if fh != nil {
+			fh.Close()
+		}
+		return nil, fmt.Errorf("failed to read Parquet file %s: %s", filename, err)
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1 << 14}, memory.DefaultAllocator)
+	if err != nil {
+		pf.Close()
+		return nil, fmt.Errorf("failed to read Parquet file %s: %s", filename, err)
+	}
+	reader, err := fr.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		pf.Close()
+		return nil, fmt.Errorf("failed to read Parquet file %s: %s", filename, err)
+	}
+
+	return newArrowSource(filename, na, reader, pf.Close), nil // pf.Close() also closes the file
+}
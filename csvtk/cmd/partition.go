@@ -0,0 +1,305 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// partitionCmd represents the partition command
+var partitionCmd = &cobra.Command{
+	GroupID: "set",
+
+	Use:   "partition",
+	Short: "partition CSV/TSV into Hive-style directories according to column values",
+	Long: `partition CSV/TSV into Hive-style directories according to column values
+
+Rows are written to files in directories named by the values of partition
+columns, e.g., "out/region=EU/year=2023/part-000.csv.gz".
+
+Notes:
+
+  1. The output directory should be given by -o/--out-file.
+  2. Partition columns are removed from the output files, use -k/--keep-columns
+     to keep them.
+  3. Empty values are written to directories of the value given by
+     -n/--null-value. Special characters in values, e.g., "/", "=" and "%",
+     are escaped like Hive, e.g., "a/b" -> "a%2Fb".
+  4. A new file is created every -m/--max-rows rows for each partition.
+  5. Files of different partitions are compressed in parallel with -j/--num-cpus
+     threads, the format is given by -c/--codec, instead of the global flag
+     --compress.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.Flags().Changed("compress") || cmd.Flags().Changed("compress-level") {
+			checkError(fmt.Errorf("flags --compress and --compress-level are not supported, please use -c/--codec and -L/--level"))
+		}
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "fields")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--fields) needed"))
+		}
+		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
+		keepColumns := getFlagBool(cmd, "keep-columns")
+		maxRows := getFlagNonNegativeInt(cmd, "max-rows")
+		bufRows := getFlagPositiveInt(cmd, "buf-rows")
+		nullValue := getFlagString(cmd, "null-value")
+		prefix := getFlagString(cmd, "prefix")
+		force := getFlagBool(cmd, "force")
+		codec := strings.ToLower(getFlagString(cmd, "codec"))
+		level := getFlagInt(cmd, "level")
+		ext, ok := compressionFormats[codec]
+		if !ok {
+			checkError(fmt.Errorf("unsupported compression format: %s. available: gzip, zstd, bzip2, xz, lz4, none", codec))
+		}
+		if _, err := newCompressWriter(io.Discard, codec, level); err != nil {
+			checkError(err)
+		}
+		if config.OutTabs || config.Tabs {
+			ext = ".tsv" + ext
+		} else {
+			ext = ".csv" + ext
+		}
+
+		if config.OutFile == "-" {
+			checkError(fmt.Errorf("output directory should be given by -o/--out-file"))
+		}
+		outdir := config.OutFile
+		makeOutDir(outdir, force, "-o/--out-file", true)
+
+		comma := config.OutDelimiter
+		if (config.OutTabs || config.Tabs) && comma == ',' {
+			comma = '\t'
+		}
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		checkError(err)
+
+		csvReader.Read(ReadOption{
+			FieldStr:    fieldStr,
+			FuzzyFields: fuzzyFields,
+
+			DoNotAllowDuplicatedColumnName: true,
+		})
+
+		var wg sync.WaitGroup
+		tokens := make(chan int, config.NumCPUs)
+		partitions := make(map[string]*csvPartition, 64)
+
+		var fields []int
+		var names []string
+		var header []string
+		var keep []int // indexes of columns to output
+		var key string
+		row := make([]string, 0, 64)
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+				fields = record.Fields
+
+				isPartition := make(map[int]bool, len(fields))
+				for _, f := range fields {
+					isPartition[f-1] = true
+				}
+				for i := range record.All {
+					if keepColumns || !isPartition[i] {
+						keep = append(keep, i)
+					}
+				}
+				if len(keep) == 0 {
+					checkError(fmt.Errorf("no columns left after removing partition columns, please use -k/--keep-columns"))
+				}
+
+				names = make([]string, len(fields))
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					for i, f := range fields {
+						names[i] = record.All[f-1]
+					}
+					if !config.NoOutHeader {
+						header = make([]string, len(keep))
+						for i, j := range keep {
+							header[i] = record.All[j]
+						}
+					}
+					continue
+				}
+				for i, f := range fields {
+					names[i] = fmt.Sprintf("c%d", f)
+				}
+			}
+
+			row = row[:0]
+			for i, f := range fields {
+				v := record.All[f-1]
+				if v == "" {
+					v = nullValue
+				} else {
+					v = hiveEscape(v)
+				}
+				row = append(row, names[i]+"="+v)
+			}
+			key = filepath.Join(row...)
+
+			p, ok := partitions[key]
+			if !ok {
+				p = &csvPartition{
+					dir:  filepath.Join(outdir, key),
+					ch:   make(chan [][]string, 2),
+					rows: make([][]string, 0, bufRows),
+				}
+				partitions[key] = p
+
+				wg.Add(1)
+				go func(p *csvPartition) {
+					defer wg.Done()
+					p.write(header, prefix, ext, codec, level, comma, maxRows, tokens)
+				}(p)
+			}
+
+			values := make([]string, len(keep))
+			for i, j := range keep {
+				values[i] = record.All[j]
+			}
+			p.rows = append(p.rows, values)
+			if len(p.rows) == bufRows {
+				p.ch <- p.rows
+				p.rows = make([][]string, 0, bufRows)
+			}
+		}
+
+		for _, p := range partitions {
+			if len(p.rows) > 0 {
+				p.ch <- p.rows
+			}
+			close(p.ch)
+		}
+		wg.Wait()
+
+		readerReport(&config, csvReader, file)
+	},
+}
+
+// csvPartition is a partition of rows, which are received from ch
+// and written to files in dir.
+type csvPartition struct {
+	dir  string
+	ch   chan [][]string
+	rows [][]string // buffered rows
+}
+
+func (p *csvPartition) write(header []string, prefix string, ext string,
+	codec string, level int, comma rune, maxRows int, tokens chan int) {
+	checkError(os.MkdirAll(p.dir, 0777))
+
+	var fh *os.File
+	var bw *bufio.Writer
+	var zw io.WriteCloser
+	var writer *csvWriter
+	var err error
+
+	closeFile := func() {
+		writer.Flush()
+		checkError(writer.Error())
+		checkError(zw.Close())
+		checkError(bw.Flush())
+		checkError(fh.Close())
+	}
+
+	var nFiles, n int
+	for rows := range p.ch {
+		tokens <- 1
+		for _, row := range rows {
+			if writer == nil || (maxRows > 0 && n == maxRows) {
+				if writer != nil {
+					closeFile()
+				}
+				fh, err = os.Create(filepath.Join(p.dir, fmt.Sprintf("%s-%03d%s", prefix, nFiles, ext)))
+				checkError(err)
+				bw = bufio.NewWriterSize(fh, os.Getpagesize())
+				zw, err = newCompressWriter(bw, codec, level)
+				checkError(err)
+				writer = newCSVWriter(zw)
+				writer.Comma = comma
+				if header != nil {
+					checkError(writer.Write(header))
+				}
+				nFiles++
+				n = 0
+			}
+			checkError(writer.Write(row))
+			n++
+		}
+		<-tokens
+	}
+	if writer != nil {
+		closeFile()
+	}
+}
+
+// hiveEscape escapes special characters in a partition value like Hive.
+func hiveEscape(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte(`"#%'*/:=?\{[]^`, c) >= 0 {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func init() {
+	RootCmd.AddCommand(partitionCmd)
+	partitionCmd.Flags().StringP("fields", "f", "", `comma separated partition fields, column name or index. e.g. -f 1-3 or -f region,year or -F -f "group*"`)
+	partitionCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
+	partitionCmd.Flags().BoolP("keep-columns", "k", false, `keep partition columns in output files`)
+	partitionCmd.Flags().IntP("max-rows", "m", 0, `maximum number of rows per file, 0 for no limit`)
+	partitionCmd.Flags().StringP("codec", "c", "gzip", `compression format of output files: gzip, zstd, bzip2, xz, lz4, none`)
+	partitionCmd.Flags().IntP("level", "L", -1, `compression level, -1 for the default level of each format`)
+	partitionCmd.Flags().StringP("null-value", "n", "__HIVE_DEFAULT_PARTITION__", `directory value for empty values`)
+	partitionCmd.Flags().StringP("prefix", "p", "part", `prefix of output file names`)
+	partitionCmd.Flags().IntP("buf-rows", "b", 1000, `buffering N rows for every partition before writing to file`)
+	partitionCmd.Flags().BoolP("force", "", false, `overwrite existing output directory (given by -o).`)
+}
@@ -0,0 +1,315 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// pipelineCmd represents the pipeline command
+var pipelineCmd = &cobra.Command{
+	GroupID: "misc",
+
+	Use:   "pipeline",
+	Short: "run a pipeline of csvtk subcommands defined in a YAML file",
+	Long: `run a pipeline of csvtk subcommands defined in a YAML file
+
+A pipeline is defined in a YAML file given by -p/--pipeline, e.g.,
+
+  input: data.csv.gz        # optional, overridden by input files from arguments
+  steps:
+    - cmd: filter2
+      flags:
+        filter: '$age > 30'
+    - cmd: mutate2
+      flags:
+        name: decade
+        expression: '$age / 10'
+    - cmd: sort
+      flags:
+        keys: [decade:n, name]  # lists are for flags with multiple values
+    - cmd: head
+      args: [-n, 10]            # or raw arguments
+
+Flags are given by their long names or shorthands, "true" of boolean
+flags is converted to "--flag", and "false" to "--flag=false".
+
+Steps are run in parallel in the same process, and records are passed
+between them in memory, in the same way as "csvtk a | csvtk b" but without
+a shell, child processes or parsing the CSV format again. So all steps
+except the last one should output CSV records.
+
+Global flags of input (e.g., -t, -d, --in-format) are applied to the first
+step, global flags of output (e.g., -T, -D, -o) are applied to the last
+step, and -H, -q and -j are applied to all steps. Other global flags (e.g.,
+--compress, --quote-all, --errors, --dry-run) are applied once by the
+pipeline itself.
+
+The pipeline stops once a step fails. Use -n/--print to print the
+commands of steps without running them.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+
+		pipelineFile := getFlagString(cmd, "pipeline")
+		if pipelineFile == "" {
+			checkError(fmt.Errorf("flag -p/--pipeline needed"))
+		}
+		printSteps := getFlagBool(cmd, "print")
+
+		pipeline, err := readCSVPipeline(pipelineFile)
+		checkError(err)
+
+		files := args
+		if len(files) == 0 && getFlagString(cmd, "infile-list") == "" && len(pipeline.Input) > 0 {
+			files = pipeline.Input
+		} else {
+			files = getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		}
+
+		// global flags for steps
+		var inFlags, outFlags, allFlags []string
+		if config.Tabs {
+			inFlags = append(inFlags, "--tabs")
+		}
+		if config.NoHeaderRow {
+			allFlags = append(allFlags, "--no-header-row")
+		}
+		if !config.Verbose {
+			allFlags = append(allFlags, "--quiet")
+		}
+		cmd.InheritedFlags().VisitAll(func(f *pflag.Flag) {
+			if !f.Changed {
+				return
+			}
+			var values []string
+			if v, ok := f.Value.(pflag.SliceValue); ok {
+				values = v.GetSlice()
+			} else {
+				values = []string{f.Value.String()}
+			}
+			var flags *[]string
+			switch f.Name {
+			case "delimiter", "delim-regex", "comment-char", "lazy-quotes", "in-format",
+				"ignore-empty-row", "ignore-illegal-row", "errors", "sniff":
+				flags = &inFlags
+			case "out-tabs", "out-delimiter", "delete-header", "out-file", "show-row-number":
+				flags = &outFlags
+			case "num-cpus":
+				flags = &allFlags
+			default: // applied by the pipeline
+				return
+			}
+			for _, v := range values {
+				*flags = append(*flags, "--"+f.Name+"="+v)
+			}
+		})
+
+		n := len(pipeline.Steps)
+		cmds := make([]*cobra.Command, n)
+		for i, step := range pipeline.Steps {
+			stepArgs := append(strings.Fields(step.Cmd), step.args...)
+			stepArgs = append(stepArgs, allFlags...)
+			if i == 0 {
+				stepArgs = append(stepArgs, inFlags...)
+			}
+			if i == n-1 {
+				stepArgs = append(stepArgs, outFlags...)
+			}
+			if i == 0 && len(files) > 0 {
+				stepArgs = append(stepArgs, "--")
+				stepArgs = append(stepArgs, files...)
+			}
+
+			if printSteps {
+				quoted := make([]string, len(stepArgs))
+				for j, a := range stepArgs {
+					if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`*?!#&;|<>(){}[]~") {
+						a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+					}
+					quoted[j] = a
+				}
+				fmt.Printf("step %d: csvtk %s\n", i+1, strings.Join(quoted, " "))
+				continue
+			}
+
+			if cmds[i], err = newInProcessCommand(stepArgs); err != nil {
+				checkError(fmt.Errorf("step %d (%s): %s", i+1, step.Cmd, err))
+			}
+		}
+		if printSteps {
+			return
+		}
+
+		// steps are linked by in-memory files, and the last step writes to the
+		// output file of the pipeline, which might be compressed or uploaded.
+		inProcess = true
+		links := make([]*memFile, n-1)
+		for i := range links {
+			links[i] = newMemFile()
+			cmds[i].Flags().Set("out-file", links[i].name)
+		}
+		cmds[n-1].Flags().Set("out-file", config.OutFile)
+
+		var wg sync.WaitGroup
+		for i, c := range cmds {
+			wg.Add(1)
+			go func(i int, c *cobra.Command) {
+				defer wg.Done()
+				stepArgs := c.Flags().Args()
+				if i > 0 {
+					stepArgs = inProcessArgs(stepArgs, links[i-1].name)
+				}
+				c.Run(c, stepArgs)
+				if i < n-1 {
+					if err := links[i].closeWrite(); err != nil {
+						checkError(fmt.Errorf("step %d (%s): the output is not in CSV format: %s", i+1, pipeline.Steps[i].Cmd, err))
+					}
+				}
+				if i > 0 {
+					links[i-1].Close()
+				}
+			}(i, c)
+		}
+		wg.Wait()
+	},
+}
+
+// csvPipeline is a pipeline defined in a YAML file.
+type csvPipeline struct {
+	Input csvPipelineInput   `yaml:"input"`
+	Steps []*csvPipelineStep `yaml:"steps"`
+}
+
+// csvPipelineInput is one or more input files.
+type csvPipelineInput []string
+
+func (in *csvPipelineInput) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*in = []string{node.Value}
+		return nil
+	}
+	var files []string
+	if err := node.Decode(&files); err != nil {
+		return err
+	}
+	*in = files
+	return nil
+}
+
+// csvPipelineStep is a step of a pipeline.
+type csvPipelineStep struct {
+	Cmd   string    `yaml:"cmd"`
+	Flags yaml.Node `yaml:"flags"`
+	Args  []string  `yaml:"args"`
+
+	args []string // arguments converted from flags and args
+}
+
+// check checks the step and converts flags to arguments.
+func (step *csvPipelineStep) check() error {
+	step.Cmd = strings.TrimSpace(step.Cmd)
+	if step.Cmd == "" {
+		return fmt.Errorf("cmd needed")
+	}
+	switch strings.Fields(step.Cmd)[0] {
+	case "pipeline", "repl", "serve":
+		return fmt.Errorf("command not allowed in pipelines: %s", step.Cmd)
+	}
+
+	step.args = step.args[:0]
+	if step.Flags.Kind != 0 {
+		if step.Flags.Kind != yaml.MappingNode {
+			return fmt.Errorf("flags of %s should be a mapping", step.Cmd)
+		}
+		content := step.Flags.Content
+		for i := 0; i+1 < len(content); i += 2 {
+			name, value := content[i].Value, content[i+1]
+			prefix := "--"
+			if len(name) == 1 {
+				prefix = "-"
+			}
+			switch value.Kind {
+			case yaml.ScalarNode:
+				if value.Tag == "!!bool" {
+					if b, _ := strconv.ParseBool(value.Value); b {
+						step.args = append(step.args, prefix+name)
+					} else {
+						step.args = append(step.args, prefix+name+"=false")
+					}
+					continue
+				}
+				step.args = append(step.args, prefix+name, value.Value)
+			case yaml.SequenceNode:
+				for _, v := range value.Content {
+					if v.Kind != yaml.ScalarNode {
+						return fmt.Errorf("invalid value of flag %s of %s", name, step.Cmd)
+					}
+					step.args = append(step.args, prefix+name, v.Value)
+				}
+			default:
+				return fmt.Errorf("invalid value of flag %s of %s", name, step.Cmd)
+			}
+		}
+	}
+	step.args = append(step.args, step.Args...)
+	return nil
+}
+
+func readCSVPipeline(file string) (*csvPipeline, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read pipeline file: %s", err)
+	}
+	defer fh.Close()
+
+	var pipeline csvPipeline
+	if err = yaml.NewDecoder(fh).Decode(&pipeline); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty pipeline file: %s", file)
+		}
+		return nil, fmt.Errorf("fail to parse pipeline file %s: %s", file, err)
+	}
+	if len(pipeline.Steps) == 0 {
+		return nil, fmt.Errorf("no steps found in pipeline file: %s", file)
+	}
+	for i, step := range pipeline.Steps {
+		if err = step.check(); err != nil {
+			return nil, fmt.Errorf("%s: step %d: %s", file, i+1, err)
+		}
+	}
+	return &pipeline, nil
+}
+
+func init() {
+	RootCmd.AddCommand(pipelineCmd)
+	pipelineCmd.Flags().StringP("pipeline", "p", "", `pipeline file in YAML format`)
+	pipelineCmd.Flags().BoolP("print", "n", false, `print commands of steps without running them`)
+}
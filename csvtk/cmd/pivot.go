@@ -0,0 +1,284 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/util/stringutil"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// pivotCmd represents the pivot command
+var pivotCmd = &cobra.Command{
+	GroupID: "transform",
+
+	Use:     "pivot",
+	Aliases: []string{"crosstab"},
+	Short:   "create a pivot table (crosstab) with aggregated values",
+	Long: `create a pivot table (crosstab) with aggregated values
+
+Records are grouped by the row fields (-r/--rows), and the values of
+the column field (-c/--cols) become new columns, where each cell is
+the aggregation (-a/--agg) of values (-v/--value) sharing the same row keys
+and column value. E.g.,
+
+    csvtk pivot -r region -c month -v sales -a sum --fill 0
+
+Other columns are dropped. Rows and new columns are in the order of their
+first appearance, use -S/--sort-cols to sort new columns. Cells without
+any value are filled with the value of --fill.
+
+Attention:
+
+  1. Flag -v/--value is not needed for "count", where rows are counted.
+  2. Use "csvtk spread" to spread key-value pairs without aggregation.
+
+Available aggregations:
+
+  # numeric/statistical operations
+  countn (count numeric values), min, max, sum, argmin, argmax,
+  mean, stdev, variance, median, q1, q2, q3,
+  entropy (Shannon entropy),
+  prod (product of the elements)
+
+  # textual/numeric operations
+  count, first, last, rand, unique/uniq, collapse, countunique
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldRows := getFlagString(cmd, "rows")
+		fieldCol := getFlagString(cmd, "cols")
+		fieldValue := getFlagString(cmd, "value")
+		agg := strings.ToLower(getFlagString(cmd, "agg"))
+		if fieldRows == "" {
+			checkError(fmt.Errorf("flag -r/--rows needed"))
+		}
+		if fieldCol == "" {
+			checkError(fmt.Errorf("flag -c/--cols needed"))
+		}
+		if strings.Contains(fieldCol, ",") {
+			checkError(fmt.Errorf("only one field allowed for flag -c/--cols"))
+		}
+		if strings.Contains(fieldValue, ",") {
+			checkError(fmt.Errorf("only one field allowed for flag -v/--value"))
+		}
+		fu, numeric := allStats[agg]
+		fu2, textual := allStats2[agg]
+		if !(numeric || textual) {
+			checkError(fmt.Errorf("invalid aggregation: %s. available: %s", agg, strings.Join(allStatsList, ", ")))
+		}
+		if fieldValue == "" {
+			if agg != "count" {
+				checkError(fmt.Errorf("flag -v/--value needed for aggregation: %s", agg))
+			}
+			fieldValue = fieldCol
+		}
+
+		fill := getFlagString(cmd, "fill")
+		sortCols := getFlagBool(cmd, "sort-cols")
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+		separater = getFlagString(cmd, "separater")
+		statsRand = rand.New(rand.NewSource(getFlagInt64(cmd, "rand-seed")))
+
+		// numeric fill values are formatted like aggregated values
+		if numeric && reDigitals.MatchString(fill) {
+			if v, err := strconv.ParseFloat(removeComma(fill), 64); err == nil {
+				switch agg {
+				case "countn", "argmin", "argmax":
+					fill = fmt.Sprintf("%.0f", v)
+				default:
+					fill = fmt.Sprintf(decimalFormat, v)
+				}
+			}
+		}
+
+		nRowFields := len(strings.Split(fieldRows, ","))
+		fieldStr := fieldRows + "," + fieldCol + "," + fieldValue
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk pivot: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: fieldStr,
+		})
+
+		data := make(map[string]map[string][]string) // row keys -> column -> []value
+		rowsOrder := make(map[string]int, 128)
+		colsOrder := make(map[string]int, 128)
+		var rowKey, col, val string
+		var ok bool
+
+		checkFirstLine := true
+		var HeaderRow []string
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				fieldsMap := make(map[int]struct{}, len(record.Fields))
+				for _, f := range record.Fields[:nRowFields+1] {
+					fieldsMap[f] = struct{}{}
+				}
+				if len(fieldsMap) != nRowFields+1 {
+					checkError(fmt.Errorf("row fields and the column field should not overlap"))
+				}
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					HeaderRow = make([]string, nRowFields)
+					copy(HeaderRow, record.Selected[:nRowFields])
+					continue
+				}
+			}
+
+			rowKey = strings.Join(record.Selected[:nRowFields], "_shenwei356_")
+			col, val = record.Selected[nRowFields], record.Selected[nRowFields+1]
+
+			if _, ok = rowsOrder[rowKey]; !ok {
+				rowsOrder[rowKey] = record.Row
+				data[rowKey] = make(map[string][]string, 8)
+			}
+			if _, ok = colsOrder[col]; !ok {
+				colsOrder[col] = record.Row
+			}
+			data[rowKey][col] = append(data[rowKey][col], val)
+		}
+		readerReport(&config, csvReader, file)
+
+		cols := make([]string, 0, len(colsOrder))
+		for _, o := range stringutil.SortCountOfString(colsOrder, false) {
+			cols = append(cols, o.Key)
+		}
+		if sortCols {
+			sort.Strings(cols)
+		}
+
+		if HeaderRow == nil {
+			HeaderRow = make([]string, nRowFields)
+		}
+		if !config.NoOutHeader {
+			checkError(writer.Write(append(HeaderRow, cols...)))
+		}
+
+		var vals []string
+		var nums []float64
+		var v float64
+		for _, o := range stringutil.SortCountOfString(rowsOrder, false) {
+			items := strings.Split(o.Key, "_shenwei356_")
+			for _, col = range cols {
+				if vals, ok = data[o.Key][col]; !ok {
+					items = append(items, fill)
+					continue
+				}
+				if textual {
+					items = append(items, fu2(vals))
+					continue
+				}
+
+				nums = nums[:0]
+				for _, val = range vals {
+					if !reDigitals.MatchString(val) {
+						if ignore {
+							continue
+						}
+						checkError(fmt.Errorf("non-numeric value: %s, you can use flag -i/--ignore-non-numbers to skip these data", val))
+					}
+					v, err = strconv.ParseFloat(removeComma(val), 64)
+					checkError(err)
+					nums = append(nums, v)
+				}
+				if len(nums) == 0 {
+					items = append(items, fill)
+					continue
+				}
+				switch agg {
+				case "countn", "argmin", "argmax":
+					items = append(items, fmt.Sprintf("%.0f", fu(nums)))
+				case "median", "q1", "q2", "q3":
+					sort.Float64s(nums)
+					fallthrough
+				default:
+					items = append(items, fmt.Sprintf(decimalFormat, fu(nums)))
+				}
+			}
+			checkError(writer.Write(items))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pivotCmd)
+
+	pivotCmd.Flags().StringP("rows", "r", "", `fields of row keys. e.g -r 1,2 or -r columnA,columnB`)
+	pivotCmd.Flags().StringP("cols", "c", "", `field of which values become new columns. e.g -c 3 or -c columnC`)
+	pivotCmd.Flags().StringP("value", "v", "", `field of values to aggregate. e.g -v 4 or -v columnD`)
+	pivotCmd.Flags().StringP("agg", "a", "sum", `aggregation of values, see the available aggregations in the usage`)
+	pivotCmd.Flags().StringP("fill", "", "", "content for filling cells without any value, numbers are formatted like aggregated values")
+	pivotCmd.Flags().BoolP("sort-cols", "S", false, `sort new columns in lexicographical order`)
+	pivotCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore non-numeric values like "NA" or "N/A"`)
+	pivotCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+	pivotCmd.Flags().StringP("separater", "s", "; ", "separater for collapsed data")
+	pivotCmd.Flags().Int64P("rand-seed", "", 11, `rand seed for aggregation "rand"`)
+}
@@ -22,11 +22,16 @@ package cmd
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
 )
 
 // plotCmd represents the seq command
@@ -41,10 +46,22 @@ Notes:
 
   1. Output file can be set by flag -o/--out-file.
   2. File format is determined by the out file suffix.
-     Supported formats: eps, jpg|jpeg, pdf, png, svg, and tif|tiff
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, html, and terminal
   3. If flag -o/--out-file not set (default), image is written to stdout,
      you can display the image by pipping to "display" command of Imagemagic
      or just redirect to file.
+  4. The html format (--format html or a .html out file) outputs an
+     interactive chart with zooming, tooltips and legend toggling. The data
+     and the Vega-Lite specification are embedded in a single HTML file,
+     while the Vega JavaScript libraries are loaded from a CDN when viewing.
+  5. The terminal format (--format terminal) draws plots in the terminal
+     with Unicode characters and ANSI colors, supported by line, bar and
+     hist. Colors are disabled when the output is not a terminal or the
+     environment variable NO_COLOR is set.
+  6. Faceted plots (small multiples) are supported by hist, box, line, bar
+     and violin. With --facet-by, a subplot is plotted for each value of the
+     column, in a grid of --facet-cols columns, in a single image. The
+     flags --width and --height set the size of each subplot.
 
 `,
 }
@@ -77,7 +94,13 @@ func init() {
 	plotCmd.PersistentFlags().BoolP("x-scale-ln", "", false, "scale the X axis by the natural log")
 	plotCmd.PersistentFlags().BoolP("y-scale-ln", "", false, "scale the Y axis by the natural log")
 
-	plotCmd.PersistentFlags().StringP("format", "", "png", `image format for stdout when flag -o/--out-file not given. available values: eps, jpg|jpeg, pdf, png, svg, and tif|tiff.`)
+	plotCmd.PersistentFlags().StringP("format", "", "png", `image format for stdout when flag -o/--out-file not given. available values: eps, jpg|jpeg, pdf, png, svg, tif|tiff, html, and terminal.`)
+	plotCmd.PersistentFlags().IntP("term-width", "", 0, `width of plots in the terminal format, in characters. default: width of the terminal`)
+	plotCmd.PersistentFlags().IntP("term-height", "", 0, `height of plots in the terminal format, in lines. default: height of the terminal, at most 25`)
+
+	plotCmd.PersistentFlags().StringP("facet-by", "", "", `column index or column name for faceting, a subplot is plotted for each value of the column`)
+	plotCmd.PersistentFlags().IntP("facet-cols", "", 0, `number of columns of subplots for --facet-by. default: the square root of the number of subplots`)
+	plotCmd.PersistentFlags().BoolP("facet-free-scales", "", false, `do not share the ranges of axes among subplots`)
 
 	plotCmd.PersistentFlags().StringSliceP("na-values", "", []string{"", "NA", "N/A"}, `NA values, case ignored`)
 	plotCmd.PersistentFlags().BoolP("skip-na", "", false, "skip NA values in --na-values")
@@ -160,10 +183,43 @@ func getPlotConfigs(cmd *cobra.Command) *plotConfigs {
 
 	config.format = getFlagString(cmd, "format")
 	switch strings.ToLower(config.format) {
-	case "eps", "jpg", "jpeg", "pdf", "png", "svg", "tif", "tiff":
+	case "eps", "jpg", "jpeg", "pdf", "png", "svg", "tif", "tiff", "html", "terminal":
 	default:
-		checkError(fmt.Errorf("invalid image format. available format: eps, jpg|jpeg, pdf, png, svg, and tif|tiff"))
+		checkError(fmt.Errorf("invalid image format. available format: eps, jpg|jpeg, pdf, png, svg, tif|tiff, html, and terminal"))
+	}
+	config.html = isHTMLPlot(config.format, getFlagString(cmd, "out-file"))
+
+	config.terminal = strings.ToLower(config.format) == "terminal"
+	if config.terminal {
+		switch cmd.Name() {
+		case "line", "bar", "hist":
+		default:
+			checkError(fmt.Errorf("terminal format is only supported by commands: line, bar, and hist"))
+		}
+		config.html = false
+	}
+	config.termWidth = getFlagNonNegativeInt(cmd, "term-width")
+	config.termHeight = getFlagNonNegativeInt(cmd, "term-height")
+
+	config.facetFieldStr = getFlagString(cmd, "facet-by")
+	if config.facetFieldStr != "" {
+		switch cmd.Name() {
+		case "hist", "box", "line", "bar", "violin":
+		default:
+			checkError(fmt.Errorf("flag --facet-by is only supported by commands: hist, box, line, bar, and violin"))
+		}
+		if config.html || config.terminal {
+			checkError(fmt.Errorf("flag --facet-by is not supported for the html and terminal formats"))
+		}
+		if strings.Contains(config.facetFieldStr, ",") {
+			checkError(fmt.Errorf("only one field allowed for flag --facet-by"))
+		}
+		if config.facetFieldStr[0] == '-' {
+			checkError(fmt.Errorf("unselect not allowed for flag --facet-by"))
+		}
 	}
+	config.facetCols = getFlagNonNegativeInt(cmd, "facet-cols")
+	config.facetFreeScales = getFlagBool(cmd, "facet-free-scales")
 
 	return config
 }
@@ -178,4 +234,120 @@ type plotConfigs struct {
 	xmin, xmax, ymin, ymax                float64
 	xminStr, xmaxStr, yminStr, ymaxStr    string
 	format                                string
+	html, terminal                        bool
+	termWidth, termHeight                 int
+	facetFieldStr                         string
+	facetCols                             int
+	facetFreeScales                       bool
+}
+
+// plotFacets plots a subplot for each value of the facet column, in the
+// order of appearance, and saves them in a grid in a single image.
+// The function build plots a subplot with the selected data of rows.
+func plotFacets(config Config, plotConfig *plotConfigs, headerRowAll []string,
+	data [][]string, dataAll [][]string, build func([][]string) *plot.Plot) {
+	header := headerRowAll
+	if header == nil && len(dataAll) > 0 {
+		header = make([]string, len(dataAll[0]))
+	}
+	fields := selectFieldsByHeader(header, plotConfig.facetFieldStr, false)
+	if len(fields) != 1 {
+		checkError(fmt.Errorf("only one field allowed for flag --facet-by"))
+	}
+	col := fields[0] - 1
+
+	names := make([]string, 0, 8)
+	facets := make(map[string][][]string)
+	var name string
+	var ok bool
+	for i, d := range dataAll {
+		name = d[col]
+		if _, ok = facets[name]; !ok {
+			names = append(names, name)
+		}
+		facets[name] = append(facets[name], data[i])
+	}
+	if len(names) == 0 {
+		checkError(fmt.Errorf("no data to plot"))
+	}
+
+	// options like labels might be changed when plotting
+	saved := *plotConfig
+	plots := make([]*plot.Plot, len(names))
+	for i, name := range names {
+		*plotConfig = saved
+		plotConfig.title = name
+		plots[i] = build(facets[name])
+	}
+	*plotConfig = saved
+
+	if !plotConfig.facetFreeScales {
+		xmin, xmax := plots[0].X.Min, plots[0].X.Max
+		ymin, ymax := plots[0].Y.Min, plots[0].Y.Max
+		for _, p := range plots[1:] {
+			xmin, xmax = math.Min(xmin, p.X.Min), math.Max(xmax, p.X.Max)
+			ymin, ymax = math.Min(ymin, p.Y.Min), math.Max(ymax, p.Y.Max)
+		}
+		for _, p := range plots {
+			p.X.Min, p.X.Max = xmin, xmax
+			p.Y.Min, p.Y.Max = ymin, ymax
+		}
+	}
+
+	cols := plotConfig.facetCols
+	if cols == 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(plots)))))
+	}
+	if cols > len(plots) {
+		cols = len(plots)
+	}
+	rows := (len(plots) + cols - 1) / cols
+	grid := make([][]*plot.Plot, rows)
+	for r := range grid {
+		grid[r] = make([]*plot.Plot, cols)
+		for c := range grid[r] {
+			if i := r*cols + c; i < len(plots) {
+				grid[r][c] = plots[i]
+			}
+		}
+	}
+
+	width := plotConfig.width * vg.Inch * vg.Length(cols)
+	height := plotConfig.height * vg.Inch * vg.Length(rows)
+	format := plotConfig.format
+	if !isStdin(config.OutFile) {
+		format = strings.ToLower(strings.TrimPrefix(filepath.Ext(config.OutFile), "."))
+	}
+	c, err := draw.NewFormattedCanvas(width, height, format)
+	checkError(err)
+	dc := draw.New(c)
+
+	if plotConfig.title != "" {
+		style := plots[0].Title.TextStyle
+		style.Font.Size = plotConfig.titleSize
+		style.XAlign, style.YAlign = draw.XCenter, draw.YTop
+		dc.FillText(style, vg.Point{X: width / 2, Y: dc.Max.Y}, plotConfig.title)
+		dc = draw.Crop(dc, 0, 0, 0, -style.Height(plotConfig.title)*1.5)
+	}
+
+	tiles := draw.Tiles{Rows: rows, Cols: cols, PadX: vg.Millimeter * 4, PadY: vg.Millimeter * 4}
+	canvases := plot.Align(grid, tiles, dc)
+	for r := range grid {
+		for c := range grid[r] {
+			if grid[r][c] != nil {
+				grid[r][c].Draw(canvases[r][c])
+			}
+		}
+	}
+
+	if isStdin(config.OutFile) {
+		_, err = c.WriteTo(os.Stdout)
+		checkError(err)
+	} else {
+		fh, err := os.Create(config.OutFile)
+		checkError(err)
+		_, err = c.WriteTo(fh)
+		checkError(err)
+		checkError(fh.Close())
+	}
 }
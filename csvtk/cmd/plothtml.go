@@ -0,0 +1,187 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"gonum.org/v1/plot/plotutil"
+)
+
+// vegaObj is a JSON object of a Vega-Lite specification.
+type vegaObj map[string]interface{}
+
+// plotHTMLTemplate is the page of HTML output. The data and the Vega-Lite
+// specification are embedded in the page, while the JavaScript libraries
+// are loaded from a CDN when the page is opened.
+const plotHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>%s</title>
+  <script src="https://cdn.jsdelivr.net/npm/vega@5"></script>
+  <script src="https://cdn.jsdelivr.net/npm/vega-lite@5"></script>
+  <script src="https://cdn.jsdelivr.net/npm/vega-embed@6"></script>
+</head>
+<body>
+  <div id="vis"></div>
+  <script>
+    var spec = %s;
+    vegaEmbed("#vis", spec).catch(console.error);
+  </script>
+</body>
+</html>
+`
+
+// isHTMLPlot tells whether the plot should be written as an interactive HTML page.
+func isHTMLPlot(format string, outFile string) bool {
+	if !isStdin(outFile) {
+		outFile = strings.ToLower(outFile)
+		return strings.HasSuffix(outFile, ".html") || strings.HasSuffix(outFile, ".htm")
+	}
+	return strings.ToLower(format) == "html"
+}
+
+// newVegaLiteSpec creates a specification with the data and the common
+// options of plot commands. Sizes in points are used as pixels.
+func newVegaLiteSpec(plotConfig *plotConfigs, values []vegaObj) vegaObj {
+	spec := vegaObj{
+		"$schema": "https://vega.github.io/schema/vega-lite/v5.json",
+		"width":   math.Round(float64(plotConfig.width) * 72),
+		"height":  math.Round(float64(plotConfig.height) * 72),
+		"data":    vegaObj{"values": values},
+		"config": vegaObj{
+			"title": vegaObj{"fontSize": float64(plotConfig.titleSize)},
+			"axis": vegaObj{
+				"titleFontSize": float64(plotConfig.labelSize),
+				"labelFontSize": float64(plotConfig.tickLabelSize),
+			},
+		},
+	}
+	if plotConfig.title != "" {
+		spec["title"] = plotConfig.title
+	}
+	return spec
+}
+
+// vegaTitle splits a multi-line label.
+func vegaTitle(s string) interface{} {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "\n") {
+		return strings.Split(s, "\n")
+	}
+	return s
+}
+
+// vegaQuantitative returns the encoding of a quantitative field,
+// with the log scale and the range of the axis.
+func vegaQuantitative(field string, title string, scaleLn bool, minStr string, min float64, maxStr string, max float64) vegaObj {
+	scale := vegaObj{}
+	if scaleLn {
+		scale["type"] = "log"
+		scale["base"] = math.E
+	}
+	if minStr != "" {
+		scale["domainMin"] = min
+		scale["zero"] = false
+	}
+	if maxStr != "" {
+		scale["domainMax"] = max
+	}
+	enc := vegaObj{"field": field, "type": "quantitative", "title": vegaTitle(title)}
+	if len(scale) > 0 {
+		enc["scale"] = scale
+	}
+	return enc
+}
+
+// vegaAddLegendToggle colors marks by groups, and clicking on the legend
+// highlights the selected groups.
+func vegaAddLegendToggle(spec vegaObj, encoding vegaObj, field string, groups []string, colors []string) {
+	encoding["color"] = vegaObj{
+		"field": field,
+		"type":  "nominal",
+		"title": nil,
+		"scale": vegaObj{"domain": groups, "range": colors},
+	}
+	encoding["opacity"] = vegaObj{
+		"condition": vegaObj{"param": "legend", "value": 1},
+		"value":     0.15,
+	}
+	vegaAddParam(spec, vegaObj{
+		"name":   "legend",
+		"select": vegaObj{"type": "point", "fields": []string{field}},
+		"bind":   "legend",
+	})
+}
+
+// vegaAddZoom makes the axes of continuous channels zoomable and pannable.
+func vegaAddZoom(spec vegaObj, channels ...string) {
+	vegaAddParam(spec, vegaObj{
+		"name":   "zoom",
+		"select": vegaObj{"type": "interval", "encodings": channels},
+		"bind":   "scales",
+	})
+}
+
+func vegaAddParam(spec vegaObj, param vegaObj) {
+	params, _ := spec["params"].([]vegaObj)
+	spec["params"] = append(params, param)
+}
+
+// vegaPlotutilColors returns n colors of plotutil.Color starting from i,
+// the same as static images.
+func vegaPlotutilColors(i int, n int) []string {
+	colors := make([]string, n)
+	for j := range colors {
+		colors[j] = vegaColor(plotutil.Color(i + j))
+	}
+	return colors
+}
+
+// vegaColor returns the hex code of a color.
+func vegaColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// writePlotHTML writes the specification as a HTML page.
+func writePlotHTML(file string, plotConfig *plotConfigs, spec vegaObj) {
+	data, err := json.Marshal(spec)
+	checkError(err)
+
+	title := plotConfig.title
+	if title == "" {
+		title = "csvtk plot"
+	}
+
+	outfh, err := xopen.Wopen(file)
+	checkError(err)
+	defer outfh.Close()
+
+	_, err = fmt.Fprintf(outfh, plotHTMLTemplate, html.EscapeString(title), data)
+	checkError(err)
+}
@@ -0,0 +1,423 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/shenwei356/xopen"
+	"golang.org/x/term"
+	"gonum.org/v1/plot/plotter"
+)
+
+// termColors are colors of series in terminal plots, in a similar order of plotutil.Color.
+var termColors = []*color.Color{
+	color.New(color.FgHiRed),
+	color.New(color.FgHiGreen),
+	color.New(color.FgHiBlue),
+	color.New(color.FgHiYellow),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiCyan),
+	color.New(color.FgRed),
+}
+
+// termBlocks are vertical blocks of 0-8 eighths.
+var termBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// termHBlocks are horizontal blocks of 0-8 eighths.
+var termHBlocks = []rune(" ▏▎▍▌▋▊▉█")
+
+// termSize returns the size of plots in terminals, which is the size of
+// the terminal by default.
+func termSize(plotConfig *plotConfigs) (int, int) {
+	w, h := plotConfig.termWidth, plotConfig.termHeight
+	tw, th, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		tw, th = 80, 24
+	}
+	if w == 0 {
+		w = tw
+	}
+	if h == 0 {
+		h = th - 4
+		if h > 25 {
+			h = 25
+		}
+	}
+	if w < 20 {
+		w = 20
+	}
+	if h < 8 {
+		h = 8
+	}
+	return w, h
+}
+
+// termPlot is a plot drawn with Unicode characters in terminals.
+// Lines and points are drawn with Braille patterns of 2x4 dots in a cell,
+// bars are drawn with block elements.
+type termPlot struct {
+	width, height int // size of the data area in characters
+	runes         [][]rune
+	colors        [][]int // indexes of termColors, -1 for the default color
+	dots          [][]uint8
+
+	title, xlab, ylab      string
+	xmin, xmax, ymin, ymax float64
+
+	xTickLabel  func(float64) string // labels of X ticks
+	xCategories []string             // labels under bars, replacing X ticks
+	legend      []string
+	legendColor []int
+
+	yLabels     []string
+	yLabelWidth int
+}
+
+// newTermPlot creates a plot with the ranges of axes.
+func newTermPlot(plotConfig *plotConfigs, xmin, xmax, ymin, ymax float64) *termPlot {
+	if xmin == xmax {
+		xmin, xmax = xmin-0.5, xmax+0.5
+	}
+	if ymin == ymax {
+		ymin, ymax = ymin-0.5, ymax+0.5
+	}
+	tp := &termPlot{
+		title: plotConfig.title, xlab: plotConfig.xlab, ylab: plotConfig.ylab,
+		xmin: xmin, xmax: xmax, ymin: ymin, ymax: ymax,
+		xTickLabel: termNumber,
+	}
+
+	w, h := termSize(plotConfig)
+	lines := 3 // x axis, x ticks and the legend
+	if tp.title != "" {
+		lines++
+	}
+	if tp.ylab != "" {
+		lines++
+	}
+	if tp.xlab != "" {
+		lines++
+	}
+	tp.height = h - lines
+	if tp.height < 4 {
+		tp.height = 4
+	}
+
+	// labels of Y at the top, middle and bottom rows
+	tp.yLabels = make([]string, tp.height)
+	for _, r := range []int{0, tp.height / 2, tp.height - 1} {
+		tp.yLabels[r] = termNumber(tp.ymax - (tp.ymax-tp.ymin)*float64(r)/float64(tp.height-1))
+		if len(tp.yLabels[r]) > tp.yLabelWidth {
+			tp.yLabelWidth = len(tp.yLabels[r])
+		}
+	}
+	tp.width = w - tp.yLabelWidth - 2
+	if tp.width < 10 {
+		tp.width = 10
+	}
+
+	tp.runes = make([][]rune, tp.height)
+	tp.colors = make([][]int, tp.height)
+	tp.dots = make([][]uint8, tp.height)
+	for r := range tp.runes {
+		tp.runes[r] = make([]rune, tp.width)
+		tp.colors[r] = make([]int, tp.width)
+		tp.dots[r] = make([]uint8, tp.width)
+		for c := range tp.runes[r] {
+			tp.runes[r][c] = ' '
+			tp.colors[r][c] = -1
+		}
+	}
+	return tp
+}
+
+// termNumber formats numbers in axes.
+func termNumber(v float64) string {
+	if v == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// col returns the column of X, in [0, width].
+func (tp *termPlot) col(x float64) int {
+	return int(math.Round((x - tp.xmin) / (tp.xmax - tp.xmin) * float64(tp.width)))
+}
+
+// dotX returns the column of dots of X.
+func (tp *termPlot) dotX(x float64) int {
+	return int(math.Round((x - tp.xmin) / (tp.xmax - tp.xmin) * float64(tp.width*2-1)))
+}
+
+// dotY returns the row of dots of Y, from the bottom.
+func (tp *termPlot) dotY(y float64) int {
+	return int(math.Round((y - tp.ymin) / (tp.ymax - tp.ymin) * float64(tp.height*4-1)))
+}
+
+// termDotBits are bits of Braille dots, indexed by [x][y from the top].
+var termDotBits = [2][4]uint8{{0x01, 0x02, 0x04, 0x40}, {0x08, 0x10, 0x20, 0x80}}
+
+func (tp *termPlot) dot(x, y int, color int) {
+	if x < 0 || y < 0 || x >= tp.width*2 || y >= tp.height*4 {
+		return
+	}
+	c, r := x/2, tp.height-1-y/4
+	tp.dots[r][c] |= termDotBits[x%2][3-y%4]
+	tp.runes[r][c] = rune(0x2800 + int(tp.dots[r][c]))
+	tp.colors[r][c] = color
+}
+
+// line draws a line between two dots with Bresenham's algorithm.
+func (tp *termPlot) line(x0, y0, x1, y1 int, color int) {
+	dx, dy := x1-x0, y1-y0
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx - dy
+	for {
+		tp.dot(x0, y0, color)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 > -dy {
+			e -= dy
+			x0 += sx
+		}
+		if e2 < dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// Line draws a series, points are connected unless scatter is true.
+func (tp *termPlot) Line(xys plotter.XYs, color int, scatter bool) {
+	for i, xy := range xys {
+		x, y := tp.dotX(xy.X), tp.dotY(xy.Y)
+		if scatter || i == 0 {
+			tp.dot(x, y, color)
+			continue
+		}
+		tp.line(tp.dotX(xys[i-1].X), tp.dotY(xys[i-1].Y), x, y, color)
+	}
+}
+
+// Bar draws a vertical bar in columns [c0, c1) from y0 to y1.
+// The bottom of a bar is aligned to cells, so stacked bars do not overlap.
+func (tp *termPlot) Bar(c0, c1 int, y0, y1 float64, color int) {
+	scale := float64(tp.height*8) / (tp.ymax - tp.ymin)
+	b := int(math.Round((math.Max(y0, tp.ymin) - tp.ymin) * scale))
+	t := int(math.Round((math.Min(y1, tp.ymax) - tp.ymin) * scale))
+	if b%8 != 0 {
+		b += 8 - b%8
+	}
+	for r := b / 8; r*8 < t && r < tp.height; r++ {
+		n := t - r*8
+		if n > 8 {
+			n = 8
+		}
+		for c := c0; c < c1 && c < tp.width; c++ {
+			tp.runes[tp.height-1-r][c] = termBlocks[n]
+			tp.colors[tp.height-1-r][c] = color
+		}
+	}
+}
+
+// AddLegend adds an item of the legend.
+func (tp *termPlot) AddLegend(name string, color int) {
+	tp.legend = append(tp.legend, name)
+	tp.legendColor = append(tp.legendColor, color)
+}
+
+// termColored writes text with a color.
+func termColored(w io.Writer, s string, c int) {
+	if c < 0 {
+		fmt.Fprint(w, s)
+		return
+	}
+	termColors[c%len(termColors)].Fprint(w, s)
+}
+
+// termPad pads text to the width, in the center or on the left.
+func termPad(s string, width int, center bool) string {
+	n := utf8.RuneCountInString(s)
+	if n >= width {
+		return string([]rune(s)[:width])
+	}
+	if center {
+		l := (width - n) / 2
+		return strings.Repeat(" ", l) + s + strings.Repeat(" ", width-n-l)
+	}
+	return strings.Repeat(" ", width-n) + s
+}
+
+// Render writes the plot.
+func (tp *termPlot) Render(w io.Writer) {
+	indent := strings.Repeat(" ", tp.yLabelWidth+1)
+	if tp.title != "" {
+		fmt.Fprintln(w, indent+strings.TrimRight(termPad(tp.title, tp.width, true), " "))
+	}
+	if tp.ylab != "" {
+		fmt.Fprintln(w, strings.ReplaceAll(tp.ylab, "\n", " "))
+	}
+
+	var buf strings.Builder
+	for r := range tp.runes {
+		if tp.yLabels[r] != "" {
+			fmt.Fprintf(w, "%s ┤", termPad(tp.yLabels[r], tp.yLabelWidth, false))
+		} else {
+			fmt.Fprintf(w, "%s│", indent)
+		}
+		// write runs of the same color
+		for c := 0; c < tp.width; {
+			color := tp.colors[r][c]
+			buf.Reset()
+			for ; c < tp.width && tp.colors[r][c] == color; c++ {
+				buf.WriteRune(tp.runes[r][c])
+			}
+			termColored(w, buf.String(), color)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, indent+"└"+strings.Repeat("─", tp.width))
+
+	// labels of X
+	if tp.xCategories != nil {
+		slot := tp.width / len(tp.xCategories)
+		buf.Reset()
+		for _, s := range tp.xCategories {
+			buf.WriteString(termPad(s, slot, true))
+		}
+		fmt.Fprintln(w, indent+" "+strings.TrimRight(buf.String(), " "))
+	} else {
+		left, mid, right := tp.xTickLabel(tp.xmin), tp.xTickLabel((tp.xmin+tp.xmax)/2), tp.xTickLabel(tp.xmax)
+		line := left
+		line += strings.Repeat(" ", max(1, tp.width/2-utf8.RuneCountInString(mid)/2-utf8.RuneCountInString(line))) + mid
+		line += strings.Repeat(" ", max(1, tp.width-utf8.RuneCountInString(line)-utf8.RuneCountInString(right))) + right
+		fmt.Fprintln(w, indent+" "+line)
+	}
+	if tp.xlab != "" {
+		fmt.Fprintln(w, indent+" "+strings.TrimRight(termPad(strings.ReplaceAll(strings.TrimSpace(tp.xlab), "\n", " "), tp.width, true), " "))
+	}
+
+	if len(tp.legend) > 1 {
+		fmt.Fprint(w, indent+" ")
+		for i, name := range tp.legend {
+			if i > 0 {
+				fmt.Fprint(w, "  ")
+			}
+			termColored(w, "■", tp.legendColor[i])
+			fmt.Fprint(w, " "+name)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeTermPlot writes the plot to the file.
+func writeTermPlot(file string, tp *termPlot) {
+	outfh, err := xopen.Wopen(file)
+	checkError(err)
+	defer outfh.Close()
+
+	w := bufio.NewWriter(outfh)
+	tp.Render(w)
+	checkError(w.Flush())
+}
+
+// writeTermHBars writes horizontal bars of groups, one line for each bar.
+func writeTermHBars(file string, plotConfig *plotConfigs, labels []string, groupNames []string,
+	groups [][]float64, firstColor int) {
+	outfh, err := xopen.Wopen(file)
+	checkError(err)
+	defer outfh.Close()
+	w := bufio.NewWriter(outfh)
+
+	width, _ := termSize(plotConfig)
+	var maxValue float64
+	var labelWidth, valueWidth int
+	for _, l := range labels {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(l))
+	}
+	for _, values := range groups {
+		for _, v := range values {
+			maxValue = math.Max(maxValue, v)
+			valueWidth = max(valueWidth, len(termNumber(v)))
+		}
+	}
+	barWidth := width - labelWidth - valueWidth - 3
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	if plotConfig.title != "" {
+		fmt.Fprintln(w, plotConfig.title)
+	}
+	for j, l := range labels {
+		for i, values := range groups {
+			if i == 0 {
+				fmt.Fprintf(w, "%s │", termPad(l, labelWidth, false))
+			} else {
+				fmt.Fprintf(w, "%s │", strings.Repeat(" ", labelWidth))
+			}
+			n := 0
+			if maxValue > 0 && values[j] > 0 {
+				n = int(math.Round(values[j] / maxValue * float64(barWidth*8)))
+			}
+			bar := strings.Repeat(string(termHBlocks[8]), n/8)
+			if n%8 > 0 {
+				bar += string(termHBlocks[n%8])
+			}
+			termColored(w, bar, firstColor+i)
+			fmt.Fprintf(w, " %s\n", termNumber(values[j]))
+		}
+	}
+	if len(groupNames) > 1 {
+		fmt.Fprint(w, strings.Repeat(" ", labelWidth+2))
+		for i, name := range groupNames {
+			if i > 0 {
+				fmt.Fprint(w, "  ")
+			}
+			termColored(w, "■", firstColor+i)
+			fmt.Fprint(w, " "+name)
+		}
+		fmt.Fprintln(w)
+	}
+	checkError(w.Flush())
+}
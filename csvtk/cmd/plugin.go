@@ -0,0 +1,183 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// pluginPrefix is the prefix of executables of plugins.
+const pluginPrefix = "csvtk-"
+
+// pluginsCmd represents the plugins command
+var pluginsCmd = &cobra.Command{
+	GroupID: "misc",
+
+	Use:   "plugins",
+	Short: "list plugins found in PATH",
+	Long: `list plugins found in PATH
+
+Plugins are executables named "csvtk-<name>" in the directories of the
+environment variable PATH, which are run as "csvtk <name>", like plugins
+of git and kubectl, e.g., "csvtk-geocode" is run by "csvtk geocode ...".
+Built-in commands can not be overridden by plugins.
+
+Arguments are passed to plugins as they are, including global flags,
+e.g., "csvtk -t geocode -f address" runs "csvtk-geocode -t -f address".
+Plugins can also read these environment variables:
+
+  CSVTK_BIN          path of the csvtk executable, for calling csvtk
+  CSVTK_PLUGIN_NAME  name of the plugin
+
+Plugins written in Go can use the package
+github.com/shenwei356/csvtk/pkg/csvtk for reading and writing CSV/TSV data.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins := findPlugins()
+		if len(plugins) == 0 {
+			fmt.Println("no plugins found in PATH")
+			return
+		}
+		names := make([]string, 0, len(plugins))
+		for name := range plugins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\n", name, plugins[name])
+		}
+	},
+}
+
+// findPlugins returns plugins found in PATH, the first one is used for
+// plugins with the same name.
+func findPlugins() map[string]string {
+	plugins := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || e.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if _, err = exec.LookPath(path); err != nil { // not executable
+				continue
+			}
+			name = strings.TrimPrefix(name, pluginPrefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if name == "" {
+				continue
+			}
+			if _, ok := plugins[name]; ok {
+				continue
+			}
+			if c, _, err := RootCmd.Find([]string{name}); err == nil && c != RootCmd {
+				continue // built-in commands
+			}
+			plugins[name] = path
+		}
+	}
+	return plugins
+}
+
+// pluginArgs returns the plugin name and arguments without it, if the
+// first non-flag argument is not a built-in command.
+func pluginArgs(args []string) (string, []string) {
+	flags := RootCmd.PersistentFlags()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return "", nil
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if c, _, err := RootCmd.Find([]string{arg}); err == nil && c != RootCmd {
+				return "", nil
+			}
+			if arg == "help" || arg == "completion" || strings.ContainsAny(arg, `/\`) {
+				return "", nil
+			}
+			return arg, append(append([]string{}, args[:i]...), args[i+1:]...)
+		}
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		// skip the value of a flag
+		var fl *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			fl = flags.Lookup(arg[2:])
+		} else if len(arg) == 2 {
+			fl = flags.ShorthandLookup(arg[1:])
+		}
+		if fl != nil && fl.NoOptDefVal == "" {
+			i++
+		}
+	}
+	return "", nil
+}
+
+// runPlugin runs a plugin if the command is not a built-in one and a plugin
+// is found. It returns false if no plugin is run.
+func runPlugin(args []string) bool {
+	name, pargs := pluginArgs(args)
+	if name == "" {
+		return false
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return false
+	}
+
+	c := exec.Command(path, pargs...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Env = os.Environ()
+	if exe, err := os.Executable(); err == nil {
+		c.Env = append(c.Env, "CSVTK_BIN="+exe)
+	}
+	c.Env = append(c.Env, "CSVTK_PLUGIN_NAME="+name)
+	if err = c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		checkError(fmt.Errorf("fail to run plugin %s: %s", name, err))
+	}
+	return true
+}
+
+func init() {
+	RootCmd.AddCommand(pluginsCmd)
+}
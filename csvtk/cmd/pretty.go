@@ -22,12 +22,16 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 
+	"github.com/fatih/color"
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-runewidth"
 	"github.com/shenwei356/stable"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
@@ -66,8 +70,41 @@ How to:
           -m 1- -r -1  # all columns are center-aligned, except the last column
                        # which is right-aligned. -r overides -m.
          
+     1c. Columns only containing numbers can be automatically aligned right
+         (--align-numbers).
+     1d. Widths of some columns can also be given in the format of COL:WIDTH,
+         e.g., -W desc:30 -w name:10.
   2. Remaining rows are read and immediately outputted, one by one, till the end.
 
+Wide tables:
+
+  Tables wider than --split-width are split into segments of columns, with
+  key columns (-k/--key-cols) repeated in every segment. Tables wider than
+  --transpose-width are transposed, with columns named by values of key
+  columns or row numbers. All rows are kept in memory in these cases.
+
+Colors:
+
+  Colors are only used when writing to terminal.
+
+    --theme bold|dark|light   # colored header, and shading of alternate rows
+    --color 'status=FAIL:red' # color cells matching rules, in the format of
+                              # COL OP VALUE:COLOR. Operators: =, !=, >, >=,
+                              # <, <=, ~ (regular expression)
+
+Sparklines:
+
+  Numeric columns selected by --spark are shown with bars, which are scaled
+  to the range of each column, for a quick scan of trends. The minimum and
+  maximum values are highlighted in blue and red respectively in terminal.
+  All rows are kept in memory in this case.
+
+        name   score
+        ----   --------
+        A      ▄    3
+        B      █   10
+        C      ▁ -2.5
+
 Styles:
 
   Some preset styles are provided (-S/--style).
@@ -165,19 +202,41 @@ Styles:
 		alignRights := getFlagStringSlice(cmd, "align-right")
 		alignCenters := getFlagStringSlice(cmd, "align-center")
 		separator := getFlagString(cmd, "separator")
-		minWidths := getFlagStringSliceAsInts(cmd, "min-width")
-		maxWidths := getFlagStringSliceAsInts(cmd, "max-width")
+		minWidths, minWidthsOfCols := getFlagPrettyWidths(cmd, "min-width")
+		maxWidths, maxWidthsOfCols := getFlagPrettyWidths(cmd, "max-width")
 		bufRows := getFlagNonNegativeInt(cmd, "buf-rows")
 		style := getFlagString(cmd, "style")
 		clip := getFlagBool(cmd, "clip")
 		clipMark := getFlagString(cmd, "clip-mark")
+		sparks := getFlagStringSlice(cmd, "spark")
+		alignNumbers := getFlagBool(cmd, "align-numbers")
+		themeName := getFlagString(cmd, "theme")
+		colorRuleStrs := getFlagStringSlice(cmd, "color")
+		keyCols := getFlagStringSlice(cmd, "key-cols")
+		splitWidth := getFlagNonNegativeInt(cmd, "split-width")
+		transposeWidth := getFlagNonNegativeInt(cmd, "transpose-width")
 		wrapDelimiter := getFlagString(cmd, "wrap-delimiter")
 
 		if len(wrapDelimiter) != 1 {
 			checkError(fmt.Errorf("the value of flag -x/--wrap-delimiter should be a single character: %s", wrapDelimiter))
 		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		var theme *prettyTheme
+		if themeName != "" {
+			var ok bool
+			if theme, ok = prettyThemes[strings.ToLower(themeName)]; !ok {
+				checkError(fmt.Errorf("theme not available: %s. available vaules: bold, dark, light", themeName))
+			}
+		}
+
+		colorRules := make([]*prettyColorRule, len(colorRuleStrs))
+		for i, r := range colorRuleStrs {
+			rule, err := parsePrettyColorRule(r)
+			checkError(err)
+			colorRules[i] = rule
+		}
+
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -223,37 +282,127 @@ Styles:
 			style = "default"
 		}
 
-		tbl := stable.New()
-
-		tbl.WrapDelimiter(rune(wrapDelimiter[0]))
-
-		if _style, ok := styles[strings.ToLower(style)]; ok {
-			tbl.Style(_style)
-		} else {
+		tblStyle, ok := styles[strings.ToLower(style)]
+		if !ok {
 			checkError(fmt.Errorf("style not available: %s. available vaules: default, plain, simple, 3line, grid, light, bold, double", style))
 		}
 
-		if len(minWidths) == 1 {
-			tbl.MinWidth(minWidths[0])
+		_bufRow := uint(bufRows)
+		if bufRows == 0 {
+			_bufRow = math.MaxUint
 		}
-		if len(maxWidths) == 1 {
-			tbl.MaxWidth(maxWidths[0])
+
+		// colors are only used for terminal output
+		colored := isStdin(config.OutFile) && !color.NoColor
+		var w io.Writer = outfh
+		var pw *prettyColorWriter
+		if colored {
+			pw = newPrettyColorWriter(colorable.NewColorableStdout(), tblStyle, theme)
+			w = pw
 		}
 
-		if clip {
-			tbl.ClipCell(clipMark)
+		newTable := func() *stable.Table {
+			tbl := stable.New()
+			tbl.WrapDelimiter(rune(wrapDelimiter[0]))
+			tbl.Style(tblStyle)
+			if len(minWidths) == 1 {
+				tbl.MinWidth(minWidths[0])
+			}
+			if len(maxWidths) == 1 {
+				tbl.MaxWidth(maxWidths[0])
+			}
+			if clip {
+				tbl.ClipCell(clipMark)
+			}
+			tbl.Writer(w, _bufRow)
+			return tbl
 		}
+		tbl := newTable()
 
-		_bufRow := uint(bufRows)
-		if bufRows == 0 {
-			_bufRow = math.MaxUint
+		var globalMaxWidth int
+		if len(maxWidths) == 1 {
+			globalMaxWidth = maxWidths[0]
 		}
 
-		tbl.Writer(outfh, _bufRow)
+		// wide tables are split or transposed
+		wide := splitWidth > 0 || transposeWidth > 0
+		var keyFields []int
 
 		checkFirstLine := true
 		var hasHeaderRow bool
 		var header []stable.Column
+
+		// row markers of the theme
+		markHeader := func(header []stable.Column) {
+			if colored && theme != nil && theme.Header != nil && len(header) > 0 && header[0].Header != "" {
+				header[0].Header = string(rune(prettyMarkHeader)) + header[0].Header
+			}
+		}
+		markRow := func(row []string, i int) {
+			if colored && theme != nil && theme.Shade != nil && len(row) > 0 {
+				if i&1 == 1 {
+					row[0] = string(rune(prettyMarkShade)) + row[0]
+				} else {
+					row[0] = string(rune(prettyMarkRow)) + row[0]
+				}
+			}
+		}
+
+		// rows are kept in memory before the header is set, i.e., the numeric
+		// columns are checked with --align-numbers. And all rows are kept to
+		// compute the ranges of sparkline columns, or to split or transpose
+		// wide tables.
+		var headerPending bool
+		var sparkFields []int
+		var rows [][]string
+		var nRows int
+		var tblUsed bool
+		flushRows := func() {
+			if headerPending && alignNumbers {
+				for i, numeric := range prettyNumericColumns(rows, len(header)) {
+					if numeric && header[i].Align == 0 {
+						header[i].Align = stable.AlignRight
+					}
+				}
+			}
+			for _, i := range sparkFields {
+				prettySparkline(rows, i, colored)
+			}
+			if headerPending && wide && prettyWide(w, newTable, header, hasHeaderRow, rows, keyFields,
+				tblStyle, globalMaxWidth, splitWidth, transposeWidth, markHeader, markRow) {
+				headerPending = false
+				rows = nil
+				return
+			}
+
+			if headerPending {
+				markHeader(header)
+				tbl.HeaderWithFormat(header)
+				headerPending = false
+			}
+			tblUsed = true
+			for _, row := range rows {
+				markRow(row, nRows)
+				nRows++
+				tbl.AddRowStringSlice(row)
+			}
+			rows = nil
+		}
+		addRow := func(row []string) {
+			if colored {
+				prettyColorCells(row, colorRules)
+			}
+			if headerPending || len(sparkFields) > 0 || wide {
+				rows = append(rows, row)
+				if len(sparkFields) == 0 && !wide && bufRows > 0 && len(rows) >= bufRows {
+					flushRows()
+				}
+				return
+			}
+			markRow(row, nRows)
+			nRows++
+			tbl.AddRowStringSlice(row)
+		}
 		var negativeField = regexp.MustCompile(`^(-\d+)$`)
 		for record := range csvReader.Ch {
 			if record.Err != nil {
@@ -328,9 +477,8 @@ Styles:
 					}
 				}
 
-				var _range []int
-
-				for _, col = range alignCenters {
+				fieldsOf := func(col string) []int {
+					var _range []int
 					if negativeField.MatchString(col) { // negatvie field
 						found := negativeField.FindAllStringSubmatch(col, -1)
 						f, _ := strconv.Atoi(found[0][1])
@@ -340,44 +488,89 @@ Styles:
 					} else { // colname
 						_range = colnames2fileds[col]
 					}
-					for _, i = range _range {
-						if config.ShowRowNumber {
-							i++
-						}
+					if !config.ShowRowNumber {
+						return _range
+					}
+					fields := make([]int, len(_range))
+					for j, f := range _range {
+						fields[j] = f + 1
+					}
+					return fields
+				}
+
+				for _, cw := range minWidthsOfCols {
+					for _, i = range fieldsOf(cw.col) {
+						header[i-1].MinWidth = cw.width
+					}
+				}
+				for _, cw := range maxWidthsOfCols {
+					for _, i = range fieldsOf(cw.col) {
+						header[i-1].MaxWidth = cw.width
+					}
+				}
+
+				for _, col = range alignCenters {
+					for _, i = range fieldsOf(col) {
 						header[i-1].Align = stable.AlignCenter
 					}
 				}
 
 				for _, col = range alignRights {
-					if negativeField.MatchString(col) { // negatvie field
-						found := negativeField.FindAllStringSubmatch(col, -1)
-						f, _ := strconv.Atoi(found[0][1])
-						_range = []int{len(record.All) + 1 + f}
-					} else if reIntegerRange.MatchString(col) { // field range
-						_range = fieldRange(len(record.All), col)
-					} else { // colname
-						_range = colnames2fileds[col]
+					for _, i = range fieldsOf(col) {
+						header[i-1].Align = stable.AlignRight
+					}
+				}
+
+				for _, col = range sparks {
+					_range := fieldsOf(col)
+					if len(_range) == 0 {
+						checkError(fmt.Errorf("column not found for --spark: %s", col))
 					}
 					for _, i = range _range {
-						if config.ShowRowNumber {
-							i++
-						}
-						header[i-1].Align = stable.AlignRight
+						sparkFields = append(sparkFields, i-1)
 					}
 				}
 
-				tbl.HeaderWithFormat(header)
+				for _, rule := range colorRules {
+					for _, i = range fieldsOf(rule.col) {
+						rule.fields = append(rule.fields, i-1)
+					}
+				}
+
+				for _, col = range keyCols {
+					_range := fieldsOf(col)
+					if len(_range) == 0 {
+						checkError(fmt.Errorf("column not found for -k/--key-cols: %s", col))
+					}
+					for _, i = range _range {
+						keyFields = append(keyFields, i-1)
+					}
+				}
+
+				headerPending = true
+				if !alignNumbers && !wide {
+					flushRows()
+				}
 
 				if !hasHeaderRow {
-					tbl.AddRowStringSlice(record.Selected)
+					addRow(record.Selected)
 				}
 
 				continue
 			}
 
-			tbl.AddRowStringSlice(record.Selected)
+			addRow(record.Selected)
+		}
+
+		if headerPending || len(rows) > 0 {
+			flushRows()
+		}
+		if tblUsed {
+			tbl.Flush()
+		}
+		if colored {
+			checkError(pw.Flush())
 		}
-		tbl.Flush()
 
 		readerReport(&config, csvReader, file)
 	},
@@ -388,12 +581,229 @@ func init() {
 	prettyCmd.Flags().StringP("separator", "s", "   ", "fields/columns separator")
 	prettyCmd.Flags().StringSliceP("align-right", "r", []string{}, `align right for selected columns (field index/range or column name, type "csvtk pretty -h" for examples)`)
 	prettyCmd.Flags().StringSliceP("align-center", "m", []string{}, `align right for selected columns (field index/range or column name, type "csvtk pretty -h" for examples)`)
-	prettyCmd.Flags().StringSliceP("min-width", "w", []string{}, "min width, multiple values (min widths for each column, 0 for no limit) should be separated by commas. E.g., -w 0,10,10 limits the min widths of 2nd and 3rd columns")
-	prettyCmd.Flags().StringSliceP("max-width", "W", []string{}, "max width, multiple values (max widths for each column, 0 for no limit) should be separated by commas. E.g., -W 40,20,0 limits the max widths of 1st and 2nd columns")
+	prettyCmd.Flags().StringSliceP("min-width", "w", []string{}, "min width, multiple values (min widths for each column, 0 for no limit) should be separated by commas. E.g., -w 0,10,10 limits the min widths of 2nd and 3rd columns. Widths of some columns can also be given in the format of COL:WIDTH, e.g., -w name:10")
+	prettyCmd.Flags().StringSliceP("max-width", "W", []string{}, "max width, multiple values (max widths for each column, 0 for no limit) should be separated by commas. E.g., -W 40,20,0 limits the max widths of 1st and 2nd columns. Widths of some columns can also be given in the format of COL:WIDTH, e.g., -W desc:30")
 
 	prettyCmd.Flags().StringP("wrap-delimiter", "x", " ", "delimiter for wrapping cells")
 	prettyCmd.Flags().IntP("buf-rows", "n", 1024, "the number of rows to determine the min and max widths (0 for all rows)")
 	prettyCmd.Flags().StringP("style", "S", "", "output syle. available vaules: default, plain, simple, 3line, grid, light, round, bold, double. check https://github.com/shenwei356/stable")
 	prettyCmd.Flags().BoolP("clip", "", false, "clip longer cell instead of wrapping")
 	prettyCmd.Flags().StringP("clip-mark", "", "...", "clip mark")
+	prettyCmd.Flags().BoolP("align-numbers", "", false, `align right for columns only containing numbers, which are checked with the first -n/--buf-rows rows. -m/-r overide it`)
+	prettyCmd.Flags().StringP("theme", "", "", `color theme for terminal output, for the header and alternate rows. available values: bold, dark, light`)
+	prettyCmd.Flags().StringSliceP("color", "", []string{}, `color cells matching rules in the format of COL OP VALUE:COLOR for terminal output, multiple values supported. Operators: =, !=, >, >=, <, <=, ~ (regular expression). Colors: red, green, yellow, blue, magenta, cyan, white. E.g., --color 'status=FAIL:red' --color 'p<0.05:green'. Use double quotation marks for values containing comma`)
+	prettyCmd.Flags().StringSliceP("key-cols", "k", []string{}, `key columns (field index/range or column name) repeated in every segment of a split table, or used to name columns of a transposed table`)
+	prettyCmd.Flags().IntP("split-width", "", 0, `split the table into segments of columns, if it's wider than this value. 0 for no splitting. All rows are kept in memory`)
+	prettyCmd.Flags().IntP("transpose-width", "", 0, `transpose the table, if it's wider than this value. 0 for no transposition. All rows are kept in memory`)
+	prettyCmd.Flags().StringSliceP("spark", "", []string{}, `show sparkline bars for selected numeric columns (field index/range or column name), minimum and maximum values are highlighted in terminal. All rows are kept in memory`)
+}
+
+// prettyColumnWidth is a width of a column given in the format of COL:WIDTH.
+type prettyColumnWidth struct {
+	col   string
+	width int
+}
+
+// getFlagPrettyWidths returns widths given as numbers and widths of columns.
+func getFlagPrettyWidths(cmd *cobra.Command, flag string) ([]int, []prettyColumnWidth) {
+	values := getFlagStringSlice(cmd, flag)
+
+	widths := make([]int, 0, len(values))
+	cols := make([]prettyColumnWidth, 0, len(values))
+	var i, w int
+	var err error
+	for _, s := range values {
+		i = strings.LastIndex(s, ":")
+		w, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			checkError(fmt.Errorf("the value of %s should be a number or in the format of COL:WIDTH: %s", flag, s))
+		}
+		if i < 0 {
+			widths = append(widths, w)
+		} else {
+			cols = append(cols, prettyColumnWidth{col: s[:i], width: w})
+		}
+	}
+	return widths, cols
+}
+
+// prettyWide splits a wide table into segments of columns, with key columns
+// repeated in every segment, or transposes it. It returns false if the table
+// is not wider than the thresholds.
+func prettyWide(w io.Writer, newTable func() *stable.Table, header []stable.Column, hasHeaderRow bool,
+	rows [][]string, keys []int, style *stable.TableStyle, maxWidth, splitWidth, transposeWidth int,
+	markHeader func([]stable.Column), markRow func([]string, int)) bool {
+
+	sepWidth := runewidth.StringWidth(style.DataRow.Sep)
+	extra := runewidth.StringWidth(style.DataRow.Begin) + runewidth.StringWidth(style.DataRow.End) - sepWidth
+	columnWidths := func() ([]int, int) {
+		widths := make([]int, len(header))
+		total := extra
+		for i, c := range header {
+			widths[i] = runewidth.StringWidth(c.Header)
+			for _, row := range rows {
+				if i < len(row) {
+					widths[i] = max(widths[i], runewidth.StringWidth(row[i]))
+				}
+			}
+			if c.MaxWidth > 0 {
+				widths[i] = min(widths[i], c.MaxWidth)
+			} else if maxWidth > 0 {
+				widths[i] = min(widths[i], maxWidth)
+			}
+			widths[i] = max(widths[i], c.MinWidth) + 2*runewidth.StringWidth(style.Padding) + sepWidth
+			total += widths[i]
+		}
+		return widths, total
+	}
+	widths, total := columnWidths()
+
+	var transposed bool
+	if transposeWidth > 0 && total > transposeWidth {
+		var names []string
+		if hasHeaderRow {
+			names = make([]string, len(header))
+			for i, c := range header {
+				names[i] = c.Header
+			}
+		}
+		names, rows = transposeTable(names, rows, keys)
+
+		header = make([]stable.Column, len(names))
+		for i, name := range names {
+			_, header[i].Header = prettyUnmark(name)
+		}
+		hasHeaderRow, keys, transposed = true, []int{0}, true
+		widths, total = columnWidths()
+	}
+
+	segments := [][]int{nil}
+	if splitWidth > 0 && total > splitWidth {
+		segments = splitTableColumns(widths, keys, extra, splitWidth)
+	} else if !transposed {
+		return false
+	} else {
+		for i := range header {
+			segments[0] = append(segments[0], i)
+		}
+	}
+
+	for k, cols := range segments {
+		if k > 0 {
+			w.Write([]byte("\n"))
+		}
+		tbl := newTable()
+		_header := make([]stable.Column, len(cols))
+		for j, c := range cols {
+			_header[j] = header[c]
+		}
+		if hasHeaderRow {
+			markHeader(_header)
+		}
+		tbl.HeaderWithFormat(_header)
+		for i, row := range rows {
+			_row := make([]string, len(cols))
+			for j, c := range cols {
+				if c < len(row) {
+					_row[j] = row[c]
+				}
+			}
+			markRow(_row, i)
+			tbl.AddRowStringSlice(_row)
+		}
+		tbl.Flush()
+	}
+	return true
+}
+
+// splitTableColumns splits columns into segments no wider than maxWidth,
+// key columns are repeated at the beginning of every segment.
+// widths are widths of columns including separators, and extra is the width
+// of other parts of a row.
+func splitTableColumns(widths []int, keys []int, extra, maxWidth int) [][]int {
+	isKey := make([]bool, len(widths))
+	w0 := extra
+	for _, k := range keys {
+		isKey[k] = true
+		w0 += widths[k]
+	}
+
+	segments := make([][]int, 0, 8)
+	var segment []int
+	var w int
+	for i, cw := range widths {
+		if isKey[i] {
+			continue
+		}
+		if segment != nil && w+cw > maxWidth {
+			segments = append(segments, segment)
+			segment = nil
+		}
+		if segment == nil {
+			segment = append(make([]int, 0, len(keys)+8), keys...)
+			w = w0
+		}
+		segment = append(segment, i)
+		w += cw
+	}
+	if segment != nil {
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		segments = append(segments, append([]int{}, keys...))
+	}
+	return segments
+}
+
+// transposeTable transposes a table, the first column of the result is
+// the column names, or field indexes if the header is nil. Columns are
+// named with values of key columns joined by "/", or row numbers.
+func transposeTable(header []string, rows [][]string, keys []int) ([]string, [][]string) {
+	ncols := len(header)
+	for _, row := range rows {
+		ncols = max(ncols, len(row))
+	}
+	isKey := make([]bool, ncols)
+	for _, k := range keys {
+		if k < ncols {
+			isKey[k] = true
+		}
+	}
+
+	header2 := make([]string, 1, len(rows)+1)
+	header2[0] = "field"
+	labels := make([]string, 0, len(keys))
+	for i, row := range rows {
+		if len(keys) == 0 {
+			header2 = append(header2, strconv.Itoa(i+1))
+			continue
+		}
+		labels = labels[:0]
+		for _, k := range keys {
+			if k < len(row) {
+				labels = append(labels, row[k])
+			}
+		}
+		header2 = append(header2, strings.Join(labels, "/"))
+	}
+
+	rows2 := make([][]string, 0, ncols)
+	for j := 0; j < ncols; j++ {
+		if isKey[j] {
+			continue
+		}
+		row2 := make([]string, len(rows)+1)
+		if j < len(header) {
+			row2[0] = header[j]
+		} else {
+			row2[0] = strconv.Itoa(j + 1)
+		}
+		for i, row := range rows {
+			if j < len(row) {
+				row2[i+1] = row[j]
+			}
+		}
+		rows2 = append(rows2, row2)
+	}
+	return header2, rows2
 }
@@ -0,0 +1,419 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-runewidth"
+	"github.com/shenwei356/stable"
+)
+
+// Cells to color are marked with a leading control character, which is
+// replaced with ANSI escape codes after the table is rendered.
+// stable computes column widths with len(), while control characters have
+// a display width of 0, so the columns are still aligned, at the cost of
+// at most one more space in a column.
+//
+// Cell markers color a cell till the next column separator, and row markers,
+// which are put in the first cell, style the whole line, including wrapped
+// lines of the row.
+const (
+	prettyMarkCell   = 0x01 // 0x01-0x07 for cell colors, see prettyColorNames
+	prettyMarkHeader = 0x1c
+	prettyMarkShade  = 0x1d
+	prettyMarkRow    = 0x1e
+)
+
+var prettyColorNames = []string{"red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+var prettyColorAttrs = []color.Attribute{
+	color.FgHiRed, color.FgHiGreen, color.FgHiYellow, color.FgHiBlue,
+	color.FgHiMagenta, color.FgHiCyan, color.FgHiWhite,
+}
+
+// prettyColorMark returns the marker of a color.
+func prettyColorMark(name string) (string, bool) {
+	for i, c := range prettyColorNames {
+		if c == strings.ToLower(name) {
+			return string(rune(prettyMarkCell + i)), true
+		}
+	}
+	return "", false
+}
+
+var prettyMarkMin, _ = prettyColorMark("blue")
+var prettyMarkMax, _ = prettyColorMark("red")
+
+func prettyIsCellMark(r rune) bool {
+	return r >= prettyMarkCell && r < prettyMarkCell+rune(len(prettyColorNames))
+}
+
+func prettyIsMark(r rune) bool {
+	return prettyIsCellMark(r) || (r >= prettyMarkHeader && r <= prettyMarkRow)
+}
+
+// prettyUnmark splits a cell into markers and the text.
+func prettyUnmark(s string) (string, string) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !prettyIsMark(r) })
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// prettyTheme defines styles of the header and alternate rows.
+type prettyTheme struct {
+	Header []color.Attribute
+	Shade  []color.Attribute
+}
+
+var prettyThemes = map[string]*prettyTheme{
+	"bold": {
+		Header: []color.Attribute{color.Bold},
+	},
+	"dark": {
+		Header: []color.Attribute{color.Bold, color.FgHiCyan},
+		Shade:  []color.Attribute{48, 5, 236},
+	},
+	"light": {
+		Header: []color.Attribute{color.Bold, color.FgBlue},
+		Shade:  []color.Attribute{48, 5, 254},
+	},
+}
+
+// prettyColorWriter replaces markers with colors, line by line.
+type prettyColorWriter struct {
+	w     *bufio.Writer
+	style *stable.TableStyle
+	theme *prettyTheme
+
+	border string // characters of lines between rows
+
+	line  []byte
+	buf   bytes.Buffer
+	row   byte // the row marker of current row
+	attrs []color.Attribute
+}
+
+func newPrettyColorWriter(w io.Writer, style *stable.TableStyle, theme *prettyTheme) *prettyColorWriter {
+	if theme == nil {
+		theme = &prettyTheme{}
+	}
+	var border strings.Builder
+	for _, l := range []stable.LineStyle{style.LineTop, style.LineBelowHeader, style.LineBetweenRows, style.LineBottom} {
+		border.WriteString(l.Begin + l.Hline + l.Sep + l.End)
+	}
+	return &prettyColorWriter{w: bufio.NewWriter(w), style: style, theme: theme, border: border.String()}
+}
+
+func (pw *prettyColorWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var i int
+	for len(p) > 0 {
+		i = bytes.IndexByte(p, '\n')
+		if i < 0 {
+			pw.line = append(pw.line, p...)
+			break
+		}
+		pw.line = append(pw.line, p[:i]...)
+		if err := pw.writeLine(); err != nil {
+			return 0, err
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// writeLine colors a cell from its marker to the next column separator,
+// and styles the line according to the row marker.
+func (pw *prettyColorWriter) writeLine() error {
+	line := string(pw.line)
+	pw.line = pw.line[:0]
+
+	if i := strings.IndexAny(line, string([]rune{prettyMarkHeader, prettyMarkShade, prettyMarkRow})); i >= 0 {
+		pw.row = line[i]
+		line = line[:i] + line[i+1:]
+	} else if pw.border != "" && strings.Trim(line, pw.border) == "" {
+		pw.row = 0
+	}
+	var rowAttrs []color.Attribute
+	switch pw.row {
+	case prettyMarkHeader:
+		rowAttrs = pw.theme.Header
+	case prettyMarkShade:
+		rowAttrs = pw.theme.Shade
+	}
+
+	buf := &pw.buf
+	buf.Reset()
+	var i, j int
+	for {
+		i = strings.IndexFunc(line, prettyIsCellMark)
+		if i < 0 {
+			pw.write(line, rowAttrs, -1)
+			break
+		}
+		pw.write(line[:i], rowAttrs, -1)
+		c := int(line[i] - prettyMarkCell)
+		line = line[i+1:]
+
+		j = pw.cellEnd(line)
+		pw.write(line[:j], rowAttrs, c)
+		line = line[j:]
+	}
+	buf.WriteByte('\n')
+
+	_, err := pw.w.Write(buf.Bytes())
+	return err
+}
+
+// write writes text with the row style and the cell color.
+func (pw *prettyColorWriter) write(s string, rowAttrs []color.Attribute, c int) {
+	if s == "" {
+		return
+	}
+	pw.attrs = append(pw.attrs[:0], rowAttrs...)
+	if c >= 0 {
+		pw.attrs = append(pw.attrs, prettyColorAttrs[c])
+	}
+	if len(pw.attrs) == 0 {
+		pw.buf.WriteString(s)
+		return
+	}
+	pw.buf.WriteString(color.New(pw.attrs...).Sprint(s))
+}
+
+// cellEnd returns the end position of the first cell in a line.
+func (pw *prettyColorWriter) cellEnd(line string) int {
+	j := len(line)
+	for _, s := range []string{pw.style.DataRow.Sep, pw.style.DataRow.End} {
+		if s == "" {
+			continue
+		}
+		if k := strings.Index(line, s); k >= 0 && k < j {
+			j = k
+		}
+	}
+	if k := strings.IndexFunc(line, prettyIsCellMark); k >= 0 && k < j {
+		j = k
+	}
+	return j
+}
+
+// Flush writes the remaining data.
+func (pw *prettyColorWriter) Flush() error {
+	if len(pw.line) > 0 {
+		pw.w.Write(pw.line)
+		pw.line = pw.line[:0]
+	}
+	return pw.w.Flush()
+}
+
+// prettyColorRule colors cells of a column matching a condition.
+type prettyColorRule struct {
+	col   string
+	op    string
+	value string
+	num   float64
+	re    *regexp.Regexp
+	mark  string
+
+	fields []int // 0-based indexes of columns
+}
+
+var rePrettyColorRule = regexp.MustCompile(`^(.+?)(!=|>=|<=|=|>|<|~)(.*):(\w+)$`)
+
+// parsePrettyColorRule parses a rule in the format of COL OP VALUE:COLOR.
+func parsePrettyColorRule(s string) (*prettyColorRule, error) {
+	found := rePrettyColorRule.FindStringSubmatch(s)
+	if found == nil {
+		return nil, fmt.Errorf("invalid value of --color: %s, the format should be COL OP VALUE:COLOR, e.g., status=FAIL:red", s)
+	}
+	rule := &prettyColorRule{col: found[1], op: found[2], value: found[3]}
+	var ok bool
+	if rule.mark, ok = prettyColorMark(found[4]); !ok {
+		return nil, fmt.Errorf("invalid color in --color: %s, available values: %s", found[4], strings.Join(prettyColorNames, ", "))
+	}
+	var err error
+	switch rule.op {
+	case ">", ">=", "<", "<=":
+		if rule.num, err = strconv.ParseFloat(rule.value, 64); err != nil {
+			return nil, fmt.Errorf("a number is needed for the operator %s in --color: %s", rule.op, s)
+		}
+	case "~":
+		if rule.re, err = regexp.Compile(rule.value); err != nil {
+			return nil, fmt.Errorf("invalid regular expression in --color: %s: %s", s, err)
+		}
+	}
+	return rule, nil
+}
+
+// match checks if a cell matches the condition.
+func (rule *prettyColorRule) match(cell string) bool {
+	switch rule.op {
+	case "=":
+		return cell == rule.value
+	case "!=":
+		return cell != rule.value
+	case "~":
+		return rule.re.MatchString(cell)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+	if err != nil {
+		return false
+	}
+	switch rule.op {
+	case ">":
+		return v > rule.num
+	case ">=":
+		return v >= rule.num
+	case "<":
+		return v < rule.num
+	default:
+		return v <= rule.num
+	}
+}
+
+// prettyColorCells marks cells matching the rules, the first matched rule wins.
+func prettyColorCells(row []string, rules []*prettyColorRule) {
+	var marks, text string
+	for _, rule := range rules {
+		for _, f := range rule.fields {
+			if f >= len(row) {
+				continue
+			}
+			marks, text = prettyUnmark(row[f])
+			if strings.IndexFunc(marks, prettyIsCellMark) >= 0 {
+				continue
+			}
+			if rule.match(text) {
+				row[f] = marks + rule.mark + text
+			}
+		}
+	}
+}
+
+// prettyNumericColumns returns whether each column only contains numbers,
+// empty cells are ignored.
+func prettyNumericColumns(rows [][]string, ncols int) []bool {
+	numeric := make([]bool, ncols)
+	nonEmpty := make([]bool, ncols)
+	for i := range numeric {
+		numeric[i] = true
+	}
+	var text string
+	var err error
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= ncols || !numeric[i] {
+				continue
+			}
+			_, text = prettyUnmark(cell)
+			text = strings.TrimSpace(text)
+			if text == "" {
+				continue
+			}
+			nonEmpty[i] = true
+			if _, err = strconv.ParseFloat(text, 64); err != nil {
+				numeric[i] = false
+			}
+		}
+	}
+	for i := range numeric {
+		numeric[i] = numeric[i] && nonEmpty[i]
+	}
+	return numeric
+}
+
+var prettySparks = []rune("▁▂▃▄▅▆▇█")
+
+// prettySparkline prepends a bar to numeric cells of the given column,
+// the height of which is scaled to the range of the column, so the column
+// reads as a vertical sparkline. Values are right-aligned after the bars.
+// Minimum and maximum values are marked to be colored, if the cells are
+// not colored yet.
+func prettySparkline(rows [][]string, field int, mark bool) {
+	min, max := math.Inf(1), math.Inf(-1)
+	values := make([]float64, len(rows))
+	var width, w int
+	var v float64
+	var text string
+	var err error
+	for i, row := range rows {
+		values[i] = math.NaN()
+		if field >= len(row) {
+			continue
+		}
+		_, text = prettyUnmark(row[field])
+		v, err = strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		values[i] = v
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+		if w = runewidth.StringWidth(text); w > width {
+			width = w
+		}
+	}
+
+	n := len(prettySparks) - 1
+	var spark rune
+	var marks string
+	for i, row := range rows {
+		if field >= len(row) {
+			continue
+		}
+		marks, text = prettyUnmark(row[field])
+		v = values[i]
+		if math.IsNaN(v) {
+			row[field] = marks + "  " + text
+			continue
+		}
+
+		if max > min {
+			spark = prettySparks[int((v-min)/(max-min)*float64(n)+0.5)]
+		} else {
+			spark = prettySparks[n/2]
+		}
+
+		if mark && max > min && strings.IndexFunc(marks, prettyIsCellMark) < 0 {
+			if v == min {
+				marks += prettyMarkMin
+			} else if v == max {
+				marks += prettyMarkMax
+			}
+		}
+		row[field] = marks + string(spark) + " " + strings.Repeat(" ", width-runewidth.StringWidth(text)) + text
+	}
+}
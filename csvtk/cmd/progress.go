@@ -0,0 +1,115 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// showProgress is set by the global flag --progress.
+var showProgress bool
+
+// setProgress sets whether to show progress bars of reading input files.
+func setProgress(show bool) {
+	showProgress = show
+}
+
+// progressBytes shows the bytes read, with the percentage and ETA.
+const progressBytes pb.ProgressBarTemplate = `{{with string . "prefix"}}{{.}} {{end}}{{counters . }} {{bar . }} {{percent . }} {{speed . }} {{rtime . "ETA %s"}}`
+
+// progressRows shows the number of rows read, for inputs of unknown sizes.
+const progressRows pb.ProgressBarTemplate = `{{with string . "prefix"}}{{.}} {{end}}{{counters . }} rows {{speed . "%s rows/s"}} {{etime . "%s elapsed"}}`
+
+// progressReader updates a progress bar while reading the underlying data.
+// Bytes are counted if the size is known, otherwise rows are counted by
+// CSVReader via progressAddRow.
+type progressReader struct {
+	io.ReadCloser
+	bar      *pb.ProgressBar
+	rows     bool
+	finished atomic.Bool
+}
+
+// currentProgress is the progress of the file being read.
+var currentProgress atomic.Pointer[progressReader]
+
+// newProgressReader creates a progressReader for a file, size <= 0 for
+// unknown sizes.
+func newProgressReader(rc io.ReadCloser, file string, size int64) *progressReader {
+	r := &progressReader{ReadCloser: rc, rows: size <= 0}
+
+	name := filepath.Base(file)
+	if isStdin(file) {
+		name = "stdin"
+	}
+	if r.rows {
+		r.bar = progressRows.New(0)
+	} else {
+		r.bar = progressBytes.New(0)
+		r.bar.SetTotal(size)
+		r.bar.Set(pb.Bytes, true)
+	}
+	r.bar.SetWriter(os.Stderr)
+	r.bar.Set(pb.ReturnSymbol, "\r") // also for redirected stderr
+	r.bar.Set("prefix", name)
+	r.bar.Start()
+
+	if p := currentProgress.Swap(r); p != nil {
+		p.finish()
+	}
+	return r
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if !r.rows {
+		r.bar.Add(n)
+	}
+	if err == io.EOF {
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *progressReader) Close() error {
+	r.finish()
+	return r.ReadCloser.Close()
+}
+
+func (r *progressReader) finish() {
+	if r.finished.CompareAndSwap(false, true) {
+		r.bar.Finish()
+	}
+}
+
+// progressAddRow counts a row for the file of unknown size being read.
+func progressAddRow() {
+	if !showProgress {
+		return
+	}
+	if r := currentProgress.Load(); r != nil && r.rows && !r.finished.Load() {
+		r.bar.Increment()
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// rankCmd represents the rank command
+var rankCmd = &cobra.Command{
+	GroupID: "order",
+
+	Use:   "rank",
+	Short: "rank rows by selected fields, with tie methods and partitioning",
+	Long: `rank rows by selected fields, with tie methods and partitioning
+
+Keys:
+  Rows are ranked by one or more keys in ascending order, with sort types
+  like "csvtk sort": "n" for number and "r" for reverse,
+  e.g., -k score:nr -k name.
+
+Tie methods (-m/--method):
+  min      the lowest rank of tied rows, e.g., 1, 2, 2, 4 (default)
+  max      the highest rank of tied rows, e.g., 1, 3, 3, 4
+  dense    like min, but without gaps, e.g., 1, 2, 2, 3
+  average  the average rank of tied rows, e.g., 1, 2.5, 2.5, 4
+  first    ranks in the order they appear, e.g., 1, 2, 3, 4
+
+Percentile ranks (-p/--percentile) are rank/N, where N is the number of
+rows in the partition, or the number of distinct values for "dense".
+
+Rows are outputted in the input order, or sorted by partitions and
+ranks with -s/--sort, which is handy before "csvtk head" per group.
+
+Examples:
+
+    csvtk rank -k score:nr -g class -m dense -p data.csv
+    csvtk rank -k score:nr -g class -s data.csv | csvtk filter -f "rank<=3"
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		keys := getFlagStringSlice(cmd, "keys")
+		if len(keys) == 0 {
+			checkError(fmt.Errorf("flag -k (--keys) needed"))
+		}
+		groupsStr := getFlagString(cmd, "groups")
+		method := strings.ToLower(getFlagString(cmd, "method"))
+		switch method {
+		case "min", "max", "dense", "average", "first":
+		default:
+			checkError(fmt.Errorf("invalid value of flag -m/--method: %s. available: min, max, dense, average, first", method))
+		}
+		name := getFlagString(cmd, "name")
+		if name == "" {
+			checkError(fmt.Errorf("flag -n (--name) should not be empty"))
+		}
+		percentile := getFlagBool(cmd, "percentile")
+		pctName := getFlagString(cmd, "percentile-name")
+		sortOutput := getFlagBool(cmd, "sort")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+
+		rankKeys := make([]*rankKey, 0, len(keys))
+		for _, key := range keys {
+			k, err := parseRankKey(key)
+			checkError(err)
+			rankKeys = append(rankKeys, k)
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk rank: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		var groupFields []int
+		records := make([][]string, 0, 1024)
+		partitions := make(map[string][]int, 128) // group -> indexes of records
+		groups := make([]string, 0, 128)          // groups in order of appearance
+		groupKey := make([]string, 0, 8)
+		var group string
+		var ok bool
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header := record.All
+				if config.NoHeaderRow {
+					header = make([]string, len(record.All))
+				}
+				if groupsStr != "" {
+					groupFields = selectFieldsByHeader(header, groupsStr, false)
+				}
+				for _, k := range rankKeys {
+					fields := selectFieldsByHeader(header, k.column, false)
+					if len(fields) != 1 {
+						checkError(fmt.Errorf("only one column allowed in a key: %s", k.column))
+					}
+					k.field = fields[0]
+				}
+
+				if !config.NoHeaderRow {
+					if !config.NoOutHeader {
+						items := make([]string, 0, len(header)+2)
+						items = append(items, header...)
+						items = append(items, name)
+						if percentile {
+							items = append(items, pctName)
+						}
+						checkError(writer.Write(items))
+					}
+					continue
+				}
+			}
+
+			groupKey = groupKey[:0]
+			for _, f := range groupFields {
+				groupKey = append(groupKey, record.All[f-1])
+			}
+			group = strings.Join(groupKey, "_shenwei356_")
+			if _, ok = partitions[group]; !ok {
+				groups = append(groups, group)
+			}
+			partitions[group] = append(partitions[group], len(records))
+
+			records = append(records, record.All)
+		}
+		readerReport(&config, csvReader, file)
+
+		ranks := make([]string, len(records))
+		pcts := make([]string, len(records))
+		sorted := make([]int, 0, len(records))
+		for _, group = range groups {
+			rows := partitions[group]
+			idx, values, n := rankRows(records, rows, rankKeys, method)
+			for k, r := range rows {
+				if method == "average" {
+					ranks[r] = strconv.FormatFloat(values[k], 'f', -1, 64)
+				} else {
+					ranks[r] = strconv.Itoa(int(values[k]))
+				}
+				if percentile {
+					pcts[r] = fmt.Sprintf(decimalFormat, values[k]/float64(n))
+				}
+			}
+			for _, k := range idx {
+				sorted = append(sorted, rows[k])
+			}
+		}
+
+		if !sortOutput {
+			for i := range sorted {
+				sorted[i] = i
+			}
+		}
+
+		items := make([]string, 0, 64)
+		for _, i := range sorted {
+			items = append(items[:0], records[i]...)
+			items = append(items, ranks[i])
+			if percentile {
+				items = append(items, pcts[i])
+			}
+			checkError(writer.Write(items))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rankCmd)
+
+	rankCmd.Flags().StringSliceP("keys", "k", []string{}, `keys to rank by (multiple values supported). sort type supported, "n" for number and "r" for reverse. e.g., "-k 1" or "-k A:r" or "-k 1:nr -k 2"`)
+	rankCmd.Flags().StringP("groups", "g", "", `partition via fields. e.g -g 1,2 or -g columnA,columnB`)
+	rankCmd.Flags().StringP("method", "m", "min", `method for ties: min, max, dense, average, first`)
+	rankCmd.Flags().StringP("name", "n", "rank", `name of the rank column to append`)
+	rankCmd.Flags().BoolP("percentile", "p", false, `append a column of percentile ranks`)
+	rankCmd.Flags().StringP("percentile-name", "", "percentile", `name of the percentile rank column`)
+	rankCmd.Flags().BoolP("sort", "s", false, `output rows sorted by partitions and ranks`)
+	rankCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+}
+
+// rankKey is a key for ranking, like "score:nr".
+type rankKey struct {
+	column  string
+	field   int
+	number  bool
+	reverse bool
+}
+
+func parseRankKey(s string) (*rankKey, error) {
+	k := &rankKey{column: s}
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		k.column = s[:i]
+		switch s[i+1:] {
+		case "":
+		case "n":
+			k.number = true
+		case "r":
+			k.reverse = true
+		case "nr", "rn":
+			k.number, k.reverse = true, true
+		default:
+			return nil, fmt.Errorf("invalid sort type in key: %s. available: n, r, nr", s)
+		}
+	}
+	if k.column == "" {
+		return nil, fmt.Errorf("column needed in key: %s", s)
+	}
+	return k, nil
+}
+
+// rankRows ranks records in a partition. It returns indexes of rows in the
+// ranked order, ranks of rows, and the denominator of percentile ranks.
+func rankRows(records [][]string, rows []int, keys []*rankKey, method string) ([]int, []float64, int) {
+	nums := make([][]float64, len(keys))
+	var err error
+	for j, key := range keys {
+		if !key.number {
+			continue
+		}
+		nums[j] = make([]float64, len(rows))
+		for k, r := range rows {
+			val := records[r][key.field-1]
+			if nums[j][k], err = strconv.ParseFloat(removeComma(val), 64); err != nil {
+				checkError(fmt.Errorf("non-numeric value in column %s: %s", key.column, val))
+			}
+		}
+	}
+
+	cmp := func(a, b int) int {
+		var c int
+		for j, key := range keys {
+			if key.number {
+				switch {
+				case nums[j][a] < nums[j][b]:
+					c = -1
+				case nums[j][a] > nums[j][b]:
+					c = 1
+				default:
+					c = 0
+				}
+			} else {
+				c = strings.Compare(records[rows[a]][key.field-1], records[rows[b]][key.field-1])
+			}
+			if c != 0 {
+				if key.reverse {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	}
+
+	idx := make([]int, len(rows))
+	for k := range idx {
+		idx[k] = k
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return cmp(idx[i], idx[j]) < 0 })
+
+	ranks := make([]float64, len(rows))
+	var dRank int
+	var i, j, t int
+	for i = 0; i < len(idx); i = j {
+		for j = i + 1; j < len(idx) && cmp(idx[i], idx[j]) == 0; j++ {
+		}
+		dRank++
+		for t = i; t < j; t++ {
+			switch method {
+			case "min":
+				ranks[idx[t]] = float64(i + 1)
+			case "max":
+				ranks[idx[t]] = float64(j)
+			case "dense":
+				ranks[idx[t]] = float64(dRank)
+			case "average":
+				ranks[idx[t]] = float64(i+1+j) / 2
+			case "first":
+				ranks[idx[t]] = float64(t + 1)
+			}
+		}
+	}
+
+	if method == "dense" {
+		return idx, ranks, dRank
+	}
+	return idx, ranks, len(rows)
+}
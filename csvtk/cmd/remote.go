@@ -0,0 +1,138 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isURL returns true if the file is a http(s) URL or an object-store URL.
+func isURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") ||
+		isObjectURL(file)
+}
+
+// httpTransport adds custom headers to requests and retries failed ones.
+type httpTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+	retries int
+}
+
+func (t *httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	wait := time.Second
+	for i := 0; ; i++ {
+		r := req.Clone(req.Context())
+		for k, vs := range t.headers {
+			r.Header.Del(k)
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+
+		resp, err = t.base.RoundTrip(r)
+		if err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		if i >= t.retries || req.Body != nil {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Warningf("retrying (%d/%d) in %s: %s", i+1, t.retries, wait, err)
+		} else {
+			log.Warningf("retrying (%d/%d) in %s: %s: %s", i+1, t.retries, wait, req.URL, resp.Status)
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// setHTTPClient sets the default HTTP client, which is also used by xopen,
+// for reading http(s) URLs.
+// The timeout is for connecting and waiting for response headers,
+// not for transferring the whole file.
+func setHTTPClient(headers []string, timeout time.Duration, retries int) error {
+	if retries < 0 {
+		return fmt.Errorf("value of flag --http-retries should not be negative: %d", retries)
+	}
+
+	_headers := make(http.Header, len(headers))
+	var i int
+	for _, h := range headers {
+		i = strings.Index(h, ":")
+		if i <= 0 {
+			return fmt.Errorf(`invalid HTTP header, "Name: value" expected: %s`, h)
+		}
+		_headers.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if timeout > 0 {
+		base.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+		base.TLSHandshakeTimeout = timeout
+		base.ResponseHeaderTimeout = timeout
+	}
+
+	http.DefaultClient = &http.Client{
+		Transport: &httpTransport{base: base, headers: _headers, retries: retries},
+	}
+	return nil
+}
+
+// openURL opens a http(s) URL or an object-store URL for streaming reading.
+func openURL(url string) (io.ReadCloser, error) {
+	if isObjectURL(url) {
+		return openObject(url)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("http error downloading %s. status: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// readURL reads the whole content of a URL, it's used for formats
+// needing random access, like Parquet and XLSX.
+func readURL(url string) ([]byte, error) {
+	rc, err := openURL(url)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,281 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// reorderCmd represents the reorder command
+var reorderCmd = &cobra.Command{
+	GroupID: "order",
+
+	Use:   "reorder",
+	Short: "reorder columns by relative positions, names or another file",
+	Long: `reorder columns by relative positions, names or another file
+
+Operations are applied in the order of:
+
+  1. -L/--like FILE        match the column order of another file, with
+                           columns not in FILE kept after them
+  2. -a/--alphabetical     sort columns by names
+  3. -s/--to-front LIST    move columns to the front, e.g., -s id,date
+  4. -e/--to-back LIST     move columns to the back
+  5. -m/--move RULE        move a column after/before another one,
+                           e.g., -m price:after:name -m id:before:date,
+                           multiple values supported and applied in order
+
+Columns can be given by names, or by numbers of the original file.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		likeFile := getFlagString(cmd, "like")
+		alphabetical := getFlagBool(cmd, "alphabetical")
+		toFront := getFlagString(cmd, "to-front")
+		toBack := getFlagString(cmd, "to-back")
+		moves := getFlagStringArray(cmd, "move")
+		if likeFile == "" && !alphabetical && toFront == "" && toBack == "" && len(moves) == 0 {
+			checkError(fmt.Errorf("at least one of -L/--like, -a/--alphabetical, -s/--to-front, -e/--to-back and -m/--move needed"))
+		}
+		if alphabetical && config.NoHeaderRow {
+			checkError(fmt.Errorf("flag -a/--alphabetical is not allowed with -H/--no-header-row"))
+		}
+
+		// column names of the reference file
+		var likeHeader []string
+		if likeFile != "" {
+			if config.NoHeaderRow {
+				checkError(fmt.Errorf("flag -L/--like is not allowed with -H/--no-header-row"))
+			}
+			csvReader, err := newCSVReaderByConfig(config, likeFile)
+			checkError(err)
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+				if likeHeader == nil {
+					likeHeader = append([]string{}, record.All...)
+				}
+			}
+			if likeHeader == nil {
+				checkError(fmt.Errorf("no header row found in %s", likeFile))
+			}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		printHeaderRow := true
+		var order []int // 0-based indexes of the original columns
+		items := make([]string, 0, 64)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk reorder: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					order = reorderColumns(header, likeHeader, alphabetical, toFront, toBack, moves)
+
+					if !config.NoHeaderRow {
+						if printHeaderRow && !config.NoOutHeader {
+							items = items[:0]
+							for _, i := range order {
+								items = append(items, record.All[i])
+							}
+							checkError(writer.Write(items))
+						}
+						printHeaderRow = false
+						continue
+					}
+				}
+
+				items = items[:0]
+				for _, i := range order {
+					items = append(items, record.All[i])
+				}
+				checkError(writer.Write(items))
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reorderCmd)
+
+	reorderCmd.Flags().StringP("like", "L", "", `match the column order of another file`)
+	reorderCmd.Flags().BoolP("alphabetical", "a", false, `sort columns by names`)
+	reorderCmd.Flags().StringP("to-front", "s", "", `move columns to the front, e.g., -s id,date`)
+	reorderCmd.Flags().StringP("to-back", "e", "", `move columns to the back, e.g., -e note`)
+	reorderCmd.Flags().StringArrayP("move", "m", []string{}, `move a column after/before another one, e.g., -m price:after:name. multiple values supported`)
+}
+
+// reorderColumns returns 0-based indexes of columns in the new order.
+func reorderColumns(header []string, likeHeader []string, alphabetical bool,
+	toFront, toBack string, moves []string) []int {
+	order := make([]int, len(header))
+	for i := range order {
+		order[i] = i
+	}
+
+	// moveTo moves columns (0-based) to the position pos of the order.
+	moveTo := func(cols []int, pos int) {
+		moved := make(map[int]bool, len(cols))
+		for _, c := range cols {
+			moved[c] = true
+		}
+		rest := make([]int, 0, len(order))
+		var n int // number of moved columns before pos
+		for k, c := range order {
+			if moved[c] {
+				if k < pos {
+					n++
+				}
+				continue
+			}
+			rest = append(rest, c)
+		}
+		pos -= n
+		order = append(append(append(make([]int, 0, len(order)), rest[:pos]...), cols...), rest[pos:]...)
+	}
+	indexOf := func(c int) int {
+		for k, c2 := range order {
+			if c2 == c {
+				return k
+			}
+		}
+		return -1
+	}
+	columns := func(s string) []int {
+		fields := selectFieldsByHeader(header, s, false)
+		cols := make([]int, len(fields))
+		for i, f := range fields {
+			cols[i] = f - 1
+		}
+		return cols
+	}
+
+	if likeHeader != nil {
+		rank := make(map[string]int, len(likeHeader))
+		for i, name := range likeHeader {
+			if _, ok := rank[name]; !ok {
+				rank[name] = i
+			}
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			ri, oki := rank[header[order[i]]]
+			rj, okj := rank[header[order[j]]]
+			if oki && okj {
+				return ri < rj
+			}
+			return oki && !okj
+		})
+	}
+	if alphabetical {
+		sort.SliceStable(order, func(i, j int) bool { return header[order[i]] < header[order[j]] })
+	}
+	if toFront != "" {
+		moveTo(columns(toFront), 0)
+	}
+	if toBack != "" {
+		moveTo(columns(toBack), len(order))
+	}
+	for _, m := range moves {
+		var col, anchor string
+		var after bool
+		if i := strings.Index(m, ":after:"); i > 0 {
+			col, anchor, after = m[:i], m[i+7:], true
+		} else if i := strings.Index(m, ":before:"); i > 0 {
+			col, anchor = m[:i], m[i+8:]
+		} else {
+			checkError(fmt.Errorf(`invalid value of flag -m/--move: %s, e.g., "price:after:name" or "id:before:date"`, m))
+		}
+		cols := columns(col)
+		anchors := columns(anchor)
+		if len(anchors) != 1 {
+			checkError(fmt.Errorf("only one anchor column allowed for -m/--move: %s", m))
+		}
+		for _, c := range cols {
+			if c == anchors[0] {
+				checkError(fmt.Errorf("the column to move is the anchor column: %s", m))
+			}
+		}
+		pos := indexOf(anchors[0])
+		if after {
+			pos++
+		}
+		moveTo(cols, pos)
+	}
+	return order
+}
@@ -0,0 +1,477 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/stable"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// replHelp is the help message of special commands.
+const replHelp = `Special commands:
+
+  :keep            use the last output as the input of following commands
+  :undo            revert the last :keep
+  :reset           revert to the original data
+  :show            preview the current data
+  :rows N          set the number of previewed rows
+  :write FILE      write the last output, or the current data if no commands
+                   are run after loading or :keep. suffixes like .gz are supported
+  :history         show the command history
+  :help            show this help message
+  :quit            quit, or press Ctrl-D
+
+`
+
+// replCmd represents the repl command
+var replCmd = &cobra.Command{
+	GroupID: "misc",
+
+	Use:   "repl",
+	Short: "interactive mode for running successive commands on a file in memory",
+	Long: `interactive mode for running successive commands on a file in memory
+
+The input file is read once and kept in memory, then csvtk subcommands can
+be run on it successively, with the first rows of outputs previewed.
+Commands are given without "csvtk" and the input file, e.g.,
+
+  csvtk> filter2 -f '$age > 30'
+  csvtk> :keep
+  csvtk> freq -f region -nr
+  csvtk> :write result.csv
+
+Commands are run in the same process, with the data passed to them as
+parsed records in memory, so please do not use "-t" in commands, while "-T"
+is still available for outputs. Global flags like --quote-all given to
+"csvtk repl" apply to all commands.
+
+` + replHelp + `Up and down arrow keys can be used to browse the command history.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		file := files[0]
+		if isStdin(file) {
+			checkError(fmt.Errorf("the input file should not be stdin, which is used for reading commands"))
+		}
+
+		previewRows := getFlagNonNegativeInt(cmd, "rows")
+		maxWidth := getFlagNonNegativeInt(cmd, "max-width")
+
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+		if header == nil {
+			checkError(fmt.Errorf("no data found in file: %s", file))
+		}
+
+		r := &csvREPL{
+			noHeaderRow: config.NoHeaderRow,
+			previewRows: previewRows,
+			maxWidth:    maxWidth,
+		}
+		if config.NoHeaderRow {
+			header = nil
+		}
+		r.original = &replTable{header: header, rows: data}
+		r.current = r.original
+		fmt.Printf("%d rows and %d columns loaded from %s, type :help for help\n", len(data), len(r.original.columns()), file)
+
+		// read commands
+		var readLine func() (string, error)
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			t := term.NewTerminal(struct {
+				io.Reader
+				io.Writer
+			}{os.Stdin, os.Stdout}, "csvtk> ")
+			readLine = func() (string, error) {
+				state, err := term.MakeRaw(int(os.Stdin.Fd()))
+				if err != nil {
+					return "", err
+				}
+				defer term.Restore(int(os.Stdin.Fd()), state)
+				if w, _, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
+					t.SetSize(w, 0)
+				}
+				return t.ReadLine()
+			}
+		} else {
+			scanner := bufio.NewScanner(os.Stdin)
+			scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+			readLine = func() (string, error) {
+				if !scanner.Scan() {
+					if err := scanner.Err(); err != nil {
+						return "", err
+					}
+					return "", io.EOF
+				}
+				return scanner.Text(), nil
+			}
+		}
+
+		for {
+			line, err := readLine()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			r.history = append(r.history, line)
+			if !r.run(line) {
+				break
+			}
+		}
+	},
+}
+
+// replTable is a table in memory. header is nil for data without header row.
+type replTable struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *replTable) columns() []string {
+	if t.header != nil {
+		return t.header
+	}
+	var n int
+	if len(t.rows) > 0 {
+		n = len(t.rows[0])
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("c%d", i+1)
+	}
+	return names
+}
+
+func (t *replTable) csv() []byte {
+	var buf bytes.Buffer
+	writer := newCSVWriter(&buf)
+	if t.header != nil {
+		writer.Write(t.header)
+	}
+	writer.WriteAll(t.rows)
+	return buf.Bytes()
+}
+
+// csvREPL is the state of an interactive session.
+type csvREPL struct {
+	noHeaderRow bool
+	previewRows int
+	maxWidth    int
+
+	original *replTable
+	current  *replTable
+	undo     []*replTable
+
+	lastOutput []byte     // raw output of the last command
+	lastTable  *replTable // parsed output of the last command, nil for non-tabular output
+	hasOutput  bool
+
+	history []string
+}
+
+// run runs a line of command, and returns false for quitting.
+func (r *csvREPL) run(line string) bool {
+	args, err := splitREPLArgs(line)
+	if err != nil {
+		log.Error(err)
+		return true
+	}
+	if len(args) == 0 {
+		return true
+	}
+
+	switch args[0] {
+	case ":quit", ":q", ":exit", "quit", "exit":
+		return false
+	case ":help", "help":
+		fmt.Print(replHelp)
+	case ":keep":
+		if !r.hasOutput {
+			log.Error("no outputs to keep")
+		} else if r.lastTable == nil {
+			log.Error("the last output is not a CSV table")
+		} else {
+			r.undo = append(r.undo, r.current)
+			r.current, r.hasOutput = r.lastTable, false
+			fmt.Printf("%d rows kept\n", len(r.current.rows))
+		}
+	case ":undo":
+		if len(r.undo) == 0 {
+			log.Error("nothing to undo")
+		} else {
+			r.current = r.undo[len(r.undo)-1]
+			r.undo = r.undo[:len(r.undo)-1]
+			r.hasOutput = false
+			fmt.Printf("%d rows restored\n", len(r.current.rows))
+		}
+	case ":reset":
+		r.undo = append(r.undo, r.current)
+		r.current, r.hasOutput = r.original, false
+		fmt.Printf("%d rows restored\n", len(r.current.rows))
+	case ":show":
+		r.preview(r.current)
+	case ":rows":
+		if len(args) != 2 {
+			log.Error("usage: :rows N")
+			break
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Errorf("invalid number of rows: %s", args[1])
+			break
+		}
+		r.previewRows = n
+	case ":write", ":w":
+		if len(args) != 2 {
+			log.Error("usage: :write FILE")
+			break
+		}
+		data := r.lastOutput
+		if !r.hasOutput {
+			data = r.current.csv()
+		}
+		if err := replWriteFile(args[1], data); err != nil {
+			log.Error(err)
+			break
+		}
+		fmt.Printf("written to %s\n", args[1])
+	case ":history":
+		for i, h := range r.history {
+			fmt.Printf("%5d  %s\n", i+1, h)
+		}
+	default:
+		if strings.HasPrefix(args[0], ":") {
+			log.Errorf("unknown command: %s, type :help for help", args[0])
+			break
+		}
+		if args[0] == "csvtk" {
+			args = args[1:]
+		}
+		if len(args) > 0 && args[0] == "repl" {
+			log.Error("nested repl is not allowed")
+			break
+		}
+		r.exec(args)
+	}
+	return true
+}
+
+// exec runs a subcommand in the same process, with the current data passed
+// in memory as the input. The output is captured from stdout.
+func (r *csvREPL) exec(args []string) {
+	c, err := newInProcessCommand(args)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	// the data are passed as records, and -t is only for the input file
+	c.Flags().Set("tabs", "false")
+	if r.noHeaderRow {
+		c.Flags().Set("no-header-row", "true")
+	}
+
+	records := r.current.rows
+	if r.current.header != nil {
+		records = append([][]string{r.current.header}, records...)
+	}
+	input := newMemFileOf(records)
+	defer input.remove()
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var stdout bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&stdout, pr)
+		pr.Close()
+		close(copied)
+	}()
+
+	stdout0 := os.Stdout
+	os.Stdout, inProcess = pw, true
+	failed := make(chan struct{}, 1)
+	exit = func(code int) { // only the failed command is stopped
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+		runtime.Goexit()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(c, inProcessArgs(c.Flags().Args(), input.name))
+	}()
+
+	var ok bool
+	select {
+	case <-done:
+		select {
+		case <-failed:
+		default:
+			ok = true
+		}
+	case <-failed:
+	}
+
+	os.Stdout, inProcess, exit = stdout0, false, os.Exit
+	pw.Close()
+	<-copied
+	exitCode = 0
+	numErrors.Store(0)
+	if !ok {
+		return
+	}
+
+	r.lastOutput, r.lastTable, r.hasOutput = stdout.Bytes(), nil, true
+
+	// try to parse the output as a CSV table
+	reader := csv.NewReader(bytes.NewReader(r.lastOutput))
+	records, err = reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		os.Stdout.Write(r.lastOutput)
+		return
+	}
+	t := &replTable{rows: records}
+	if !r.noHeaderRow {
+		t.header, t.rows = records[0], records[1:]
+	}
+	r.lastTable = t
+	r.preview(t)
+}
+
+// preview prints the first rows of a table.
+func (r *csvREPL) preview(t *replTable) {
+	tbl := stable.New()
+	columns := t.columns()
+	header := make([]stable.Column, len(columns))
+	for i, col := range columns {
+		header[i].Header = col
+	}
+	tbl.HeaderWithFormat(header)
+	if r.maxWidth > 0 {
+		tbl.MaxWidth(r.maxWidth)
+		tbl.ClipCell("...")
+	}
+	for i, row := range t.rows {
+		if i == r.previewRows {
+			break
+		}
+		tbl.AddRowStringSlice(row)
+	}
+	os.Stdout.Write(tbl.Render(stable.StyleSimple))
+	fmt.Printf("%d rows and %d columns\n", len(t.rows), len(columns))
+}
+
+// replWriteFile writes data to a file, compressed according to the suffix.
+func replWriteFile(file string, data []byte) error {
+	outfh, err := xopen.Wopen(file)
+	if err != nil {
+		return err
+	}
+	if _, err = outfh.Write(data); err != nil {
+		outfh.Close()
+		return err
+	}
+	return outfh.Close()
+}
+
+// splitREPLArgs splits a command line into arguments like a shell,
+// supporting single quotes, double quotes and backslash escapes.
+func splitREPLArgs(s string) ([]string, error) {
+	var args []string
+	var buf strings.Builder
+	var inArg, escaped bool
+	var quote rune
+	for _, c := range s {
+		switch {
+		case escaped:
+			buf.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				buf.WriteRune(c)
+			}
+		case c == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				buf.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, buf.String())
+				buf.Reset()
+				inArg = false
+			}
+		default:
+			buf.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote: %c", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("unfinished escape at the end of line")
+	}
+	if inArg {
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+func init() {
+	RootCmd.AddCommand(replCmd)
+	replCmd.Flags().IntP("rows", "n", 10, `number of previewed rows`)
+	replCmd.Flags().IntP("max-width", "w", 40, `maximum width of previewed cells, 0 for no limit`)
+}
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"regexp"
 	"runtime"
@@ -169,11 +168,11 @@ Special replacement symbols:
 
 		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -213,133 +212,137 @@ Special replacement symbols:
 				DoNotAllowDuplicatedColumnName: true,
 			})
 
-			var i int
-			var r string
-			var ok bool
-			var found []string
-			var founds [][]string
-			var k string
-			nr := startNum
-
-			var group string
-			groupColData := make([]string, groupCols)
-			var mg map[string]int
-			if replaceWithGNR {
-				mg = make(map[string]int)
+			// record numbers are assigned sequentially
+			threads := config.NumCPUs
+			if replaceWithNR || _replaceWithXNR {
+				threads = 1
 			}
-			var me map[string]int
-			if replaceWithENR {
-				me = make(map[string]int)
-			}
-
-			var iGroup, gnr, enr, rnr int
-			iGroup = startNum - incrNum
-			rnr = startNum - incrNum
-			groupPre := "_shenwei356__"
-
-			var fields []int
 
-			checkFirstLine := true
-			for record := range csvReader.Ch {
-				if record.Err != nil {
-					checkError(record.Err)
+			replace := func() func(*Record) bool {
+				var i int
+				var r string
+				var ok bool
+				var found []string
+				var founds [][]string
+				var k string
+				nr := startNum
+
+				var group string
+				groupColData := make([]string, groupCols)
+				var mg map[string]int
+				if replaceWithGNR {
+					mg = make(map[string]int)
+				}
+				var me map[string]int
+				if replaceWithENR {
+					me = make(map[string]int)
 				}
 
-				if checkFirstLine {
-					checkFirstLine = false
+				var iGroup, gnr, enr, rnr int
+				iGroup = startNum - incrNum
+				rnr = startNum - incrNum
+				groupPre := "_shenwei356__"
 
-					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
-						if config.NoOutHeader {
-							continue
-						}
-						checkError(writer.Write(record.All))
-						continue
-					}
-				}
+				var fields []int
 
-				if _replaceWithXNR {
-					fields = record.Fields[:len(record.Fields)-groupCols]
-					for i := 0; i < groupCols; i++ {
-						groupColData[i] = record.All[record.Fields[len(record.Fields)-groupCols+i]-1]
-					}
-					group = strings.Join(groupColData, "_shenwei356_")
+				return func(record *Record) bool {
+					if _replaceWithXNR {
+						fields = record.Fields[:len(record.Fields)-groupCols]
+						for i := 0; i < groupCols; i++ {
+							groupColData[i] = record.All[record.Fields[len(record.Fields)-groupCols+i]-1]
+						}
+						group = strings.Join(groupColData, "_shenwei356_")
 
-					if replaceWithGNR {
-						if _, ok = mg[group]; !ok {
-							mg[group] = startNum - incrNum
+						if replaceWithGNR {
+							if _, ok = mg[group]; !ok {
+								mg[group] = startNum - incrNum
+							}
+							mg[group] += incrNum
+							gnr = mg[group]
 						}
-						mg[group] += incrNum
-						gnr = mg[group]
-					}
-					if replaceWithENR {
-						if _, ok = me[group]; !ok {
-							iGroup += incrNum
-							me[group] = iGroup
+						if replaceWithENR {
+							if _, ok = me[group]; !ok {
+								iGroup += incrNum
+								me[group] = iGroup
+							}
+							enr = me[group]
 						}
-						enr = me[group]
-					}
-					if replaceWithRNR {
-						if group != groupPre {
-							rnr += incrNum
+						if replaceWithRNR {
+							if group != groupPre {
+								rnr += incrNum
+							}
+							groupPre = group
 						}
-						groupPre = group
+					} else {
+						fields = record.Fields
 					}
-				} else {
-					fields = record.Fields
-				}
 
-				for _, i = range fields {
-					i--
+					for _, i = range fields {
+						i--
 
-					r = replacement
+						r = replacement
 
-					r = reTab.ReplaceAllString(r, "\t")
-
-					if replaceWithNR {
-						r = reNR.ReplaceAllString(r, fmt.Sprintf(nrFormat, nr))
-					}
+						r = reTab.ReplaceAllString(r, "\t")
 
-					if replaceWithGNR {
-						r = reGNR.ReplaceAllString(r, fmt.Sprintf(nrFormat, gnr))
-					}
+						if replaceWithNR {
+							r = reNR.ReplaceAllString(r, fmt.Sprintf(nrFormat, nr))
+						}
 
-					if replaceWithENR {
-						r = reENR.ReplaceAllString(r, fmt.Sprintf(nrFormat, enr))
-					}
+						if replaceWithGNR {
+							r = reGNR.ReplaceAllString(r, fmt.Sprintf(nrFormat, gnr))
+						}
 
-					if replaceWithRNR {
-						r = reRNR.ReplaceAllString(r, fmt.Sprintf(nrFormat, rnr))
-					}
+						if replaceWithENR {
+							r = reENR.ReplaceAllString(r, fmt.Sprintf(nrFormat, enr))
+						}
 
-					if replaceWithKV {
-						founds = patternRegexp.FindAllStringSubmatch(record.All[i], -1)
-						if len(founds) > 1 {
-							checkError(fmt.Errorf(`pattern "%s" matches multiple targets in "%s", this will cause chaos`, p, record.All[i]))
+						if replaceWithRNR {
+							r = reRNR.ReplaceAllString(r, fmt.Sprintf(nrFormat, rnr))
 						}
-						if len(founds) > 0 {
-							found = founds[0]
-							if keyCaptIdx > len(found)-1 {
-								checkError(fmt.Errorf("value of flag -I (--key-capt-idx) overflows"))
-							}
-							k = string(found[keyCaptIdx])
-							if ignoreCase {
-								k = strings.ToLower(k)
+
+						if replaceWithKV {
+							founds = patternRegexp.FindAllStringSubmatch(record.All[i], -1)
+							if len(founds) > 1 {
+								checkError(fmt.Errorf(`pattern "%s" matches multiple targets in "%s", this will cause chaos`, p, record.All[i]))
 							}
-							if _, ok = kvs[k]; ok {
-								r = reKV.ReplaceAllString(r, kvs[k])
-							} else if keepKey {
-								r = reKV.ReplaceAllString(r, found[keyCaptIdx])
-							} else {
-								r = reKV.ReplaceAllString(r, keyMissRepl)
+							if len(founds) > 0 {
+								found = founds[0]
+								if keyCaptIdx > len(found)-1 {
+									checkError(fmt.Errorf("value of flag -I (--key-capt-idx) overflows"))
+								}
+								k = string(found[keyCaptIdx])
+								if ignoreCase {
+									k = strings.ToLower(k)
+								}
+								if _, ok = kvs[k]; ok {
+									r = reKV.ReplaceAllString(r, kvs[k])
+								} else if keepKey {
+									r = reKV.ReplaceAllString(r, found[keyCaptIdx])
+								} else {
+									r = reKV.ReplaceAllString(r, keyMissRepl)
+								}
 							}
 						}
+
+						record.All[i] = patternRegexp.ReplaceAllString(record.All[i], r)
 					}
 
-					record.All[i] = patternRegexp.ReplaceAllString(record.All[i], r)
+					nr++
+					return true
 				}
-				checkError(writer.Write(record.All))
+			}
+
+			writeHeader := func(record Record) { // do not replace head line
+				if !config.NoOutHeader {
+					checkError(writer.Write(record.All))
+				}
+			}
 
-				nr++
+			for record := range parallelRecords(csvReader.Ch, threads, config.NoHeaderRow, writeHeader, replace) {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+				checkError(writer.Write(record.All))
 			}
 
 			readerReport(&config, csvReader, file)
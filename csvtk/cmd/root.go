@@ -24,8 +24,10 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -65,6 +67,20 @@ Attention:
      Please use "csvtk fix-quotes" to fix it, and use "csvtk del-quotes" to reset to the
      original format as needed.
 
+Remote files:
+
+  Input files can be http(s) URLs, and input and output files can be
+  object-store URLs with ambient credentials (environment variables,
+  config files or instance roles of the cloud providers):
+
+  - "s3://bucket/key.csv.gz" for AWS S3
+  - "gs://bucket/key.csv.gz" for Google Cloud Storage
+  - "az://container/key.csv.gz" for Azure Blob Storage,
+    with the account name given by "AZURE_STORAGE_ACCOUNT"
+
+  Outputs to object stores are written to temporary files and uploaded
+  after the command finishes.
+
 Environment variables for frequently used global flags:
 
   - "CSVTK_T" for flag "-t/--tabs"
@@ -86,13 +102,35 @@ which sets "-t/--tabs" by default.
 	},
 }
 
+// exitCode is the exit code after the command finishes successfully,
+// e.g., 1 for differences found by "csvtk diff".
+var exitCode int
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	if runPlugin(os.Args[1:]) {
+		return
+	}
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
+		removeInPlaceTemp()
 		os.Exit(-1)
 	}
+	checkError(FinishOutputEncoding())
+	checkError(FinishOutputCompression())
+	checkError(CloseBadRows())
+	checkError(UploadObjectOutputs())
+	if exitCode != 0 { // errors reported, the input file is kept
+		if inPlace.tmp != "" {
+			log.Warningf("input file not modified due to errors: %s", inPlace.file)
+		}
+		removeInPlaceTemp()
+	}
+	checkError(FinishInPlace())
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
 
 func init() {
@@ -135,31 +173,66 @@ func init() {
 	if defaultThreads > 4 {
 		defaultThreads = 4
 	}
-	RootCmd.PersistentFlags().IntP("num-cpus", "j", defaultThreads, `number of CPUs to use`)
+	RootCmd.PersistentFlags().IntP("num-cpus", "j", defaultThreads, `number of CPUs to use, also the number of workers for processing rows in parallel in some commands (alias: --jobs)`)
 
 	RootCmd.PersistentFlags().BoolP("quiet", "", false, "be quiet and do not show extra information and warnings")
 
-	RootCmd.PersistentFlags().StringP("delimiter", "d", ",", `delimiting character of the input CSV file`)
+	RootCmd.PersistentFlags().StringP("delimiter", "d", ",", `delimiting character of the input CSV file. Multiple-character delimiters are supported, e.g., "||" and "\t|\t", where quotes are not parsed`)
+	RootCmd.PersistentFlags().StringP("delim-regex", "", "", `regular expression of delimiters of input files, e.g., '\s{2,}' for whitespace-aligned reports, where quotes are not parsed, and leading and trailing spaces of lines are removed`)
 	RootCmd.PersistentFlags().StringP("out-delimiter", "D", ",", `delimiting character of the output CSV file, e.g., -D $'\t' for tab`)
 	// RootCmd.PersistentFlags().StringP("quote-char", "q", `"`, `character used to quote strings in the input CSV file`)
-	RootCmd.PersistentFlags().StringP("comment-char", "C", `#`, "lines starting with commment-character will be ignored. "+
+	RootCmd.PersistentFlags().StringP("comment-char", "C", `#`, "lines starting with commment-character will be ignored. a prefix of multiple characters is also supported, e.g., '##' for VCF files. "+
 		`if your header row starts with '#', please assign "-C" another rare symbol, e.g. '$'`)
+	RootCmd.PersistentFlags().StringP("comments", "", "strip", `how to handle comment lines at the top of input files, e.g., metadata lines of VCF files with -C '##': "strip", "keep" (written before the CSV output), or "sidecar" (written to --comments-file). Only comment lines of the first file having them are kept`)
+	RootCmd.PersistentFlags().StringP("comments-file", "", "", `sidecar file of comment lines for --comments sidecar (default: the out file plus ".comments")`)
 	RootCmd.PersistentFlags().BoolP("lazy-quotes", "l", false, `if given, a quote may appear in an unquoted field and a non-doubled quote may appear in a quoted field`)
 
 	RootCmd.PersistentFlags().BoolP("tabs", "t", false, `specifies that the input CSV file is delimited with tabs. Overrides "-d"`)
 	RootCmd.PersistentFlags().BoolP("out-tabs", "T", false, `specifies that the output is delimited with tabs. Overrides "-D"`)
 	RootCmd.PersistentFlags().BoolP("no-header-row", "H", false, `specifies that the input CSV file does not have header row`)
 	RootCmd.PersistentFlags().BoolP("delete-header", "U", false, `do not output header row`)
-	RootCmd.PersistentFlags().StringP("out-file", "o", "-", `out file ("-" for stdout, suffix .gz for gzipped out)`)
+	RootCmd.PersistentFlags().StringP("out-file", "o", "-", `out file ("-" for stdout, suffix .gz for gzipped out, s3://, gs:// and az:// URLs for object stores)`)
+	RootCmd.PersistentFlags().StringP("compress", "", "", `compression format of output: gzip, zstd, bzip2, xz, lz4, none. default: detected by the suffix of the out file (.gz, .zst, .bz2, .xz, .lz4)`)
+	RootCmd.PersistentFlags().IntP("compress-level", "", -1, `compression level of output, -1 for the default level of each format. gzip/bzip2: 1-9, zstd: 1-22, lz4: 0-9`)
+	RootCmd.PersistentFlags().BoolP("quote-all", "", false, `quote all fields in the CSV output`)
+	RootCmd.PersistentFlags().BoolP("quote-never", "", false, `never quote fields in the CSV output, and exit with an error if a field needs quoting`)
+	RootCmd.PersistentFlags().StringP("quote-char", "", `"`, `character for quoting fields in the CSV output`)
+	RootCmd.PersistentFlags().StringP("escape-style", "", "double", `how quote characters in quoted fields of the CSV output are escaped: "double" (doubled quotes) or "backslash" (backslashes, with backslashes escaped too)`)
+	RootCmd.PersistentFlags().BoolP("crlf", "", false, `use \r\n as the line terminator of the CSV output`)
+	RootCmd.PersistentFlags().BoolP("lf", "", false, `use \n as the line terminator of the CSV output (default)`)
 
 	RootCmd.PersistentFlags().BoolP("show-row-number", "Z", false, `show row number as the first column, with header row skipped`)
 
 	RootCmd.PersistentFlags().BoolP("ignore-empty-row", "E", false, `ignore empty rows`)
 	RootCmd.PersistentFlags().BoolP("ignore-illegal-row", "I", false, `ignore illegal rows. You can also use 'csvtk fix' to fix files with different numbers of columns in rows`)
+	RootCmd.PersistentFlags().StringP("in-format", "", "csv", `format of input files: csv, tsv, jsonl, parquet, arrow (Arrow IPC stream or file/Feather V2), xlsx (the first sheet)`)
+	RootCmd.PersistentFlags().StringP("in-compress", "", "auto", `compression format of input files: auto (detected by magic numbers), gzip, zstd, bzip2, xz, lz4, none`)
+	RootCmd.PersistentFlags().StringP("on-dup-colnames", "", "keep", `how to handle duplicated column names in header rows: "keep" (selecting a name matches all its columns in some commands, or the first one in others), "error", "rename" (renaming them to name_2, name_3, ... in the output too), or "index" (selecting them by name_2, name_3, ..., with the header row unchanged)`)
+	RootCmd.PersistentFlags().StringP("log-format", "", "text", `format of warnings and errors on stderr, "text" or "json". JSON lines contain the level, message, and error class, file, row and column if available`)
+	RootCmd.PersistentFlags().IntP("max-errors", "", 1, `number of bad rows reported before exiting, bad rows are skipped if it's not 1 and the exit code is 1. 0 for no limit`)
+	RootCmd.PersistentFlags().StringP("errors", "", "fail", `how to handle malformed rows, e.g., with wrong numbers of fields or unparsable quotes: "fail", "skip" (same as -I/--ignore-illegal-row), or "quarantine" for writing them to --bad-rows with the reason`)
+	RootCmd.PersistentFlags().StringP("bad-rows", "", "", `file of malformed rows for --errors quarantine, with columns of file, row, line, column, reason (error class), message, and fields of the row`)
+	RootCmd.PersistentFlags().BoolP("sniff", "", false, `detect the delimiter and the header row from the first local input file, unless -t/-d or -H are given. Use "csvtk sniff" to show the detected dialect`)
+	RootCmd.PersistentFlags().StringP("in-place", "", "", `edit the input file in place: the output is written to a temporary file which replaces the input file after the command succeeds. Use --in-place=SUFFIX (e.g., --in-place=.bak) to keep a backup. Only one input file is allowed`)
+	RootCmd.PersistentFlags().Lookup("in-place").NoOptDefVal = inPlaceNoBackup
+	RootCmd.PersistentFlags().BoolP("dry-run", "", false, `parse flags, show columns matched by the field selection of each input file and whether records are streamed or kept in memory, then exit without processing`)
+	RootCmd.PersistentFlags().StringP("in-encoding", "", "", `encoding of input files, transcoded to UTF-8 on the fly, e.g., latin1, windows-1252, gbk, shift-jis, utf-16le. BOMs are removed. "auto" for detecting UTF-8/UTF-16 by BOMs, and windows-1252 is assumed for data that are not valid UTF-8`)
+	RootCmd.PersistentFlags().StringP("out-encoding", "", "", `encoding of the output, e.g., latin1, windows-1252, gbk, shift-jis, utf-16 (with a BOM), utf-8-bom`)
+	RootCmd.PersistentFlags().BoolP("progress", "", false, `show progress bars of reading input files on stderr, with the percentage and ETA if the file size is known, or the number of rows otherwise`)
 	RootCmd.PersistentFlags().StringP("infile-list", "X", "", "file of input files list (one file per line), if given, they are appended to files from cli arguments")
+	RootCmd.PersistentFlags().StringArrayP("http-header", "", []string{}, `HTTP header for reading http(s) URLs, e.g., --http-header "Authorization: Bearer xxx", multiple values supported`)
+	RootCmd.PersistentFlags().DurationP("http-timeout", "", 30*time.Second, `timeout of connecting and waiting for response headers for reading http(s) URLs, 0 for no limit`)
+	RootCmd.PersistentFlags().IntP("http-retries", "", 3, `the number of retries for failed requests of http(s) URLs`)
 
 	RootCmd.PersistentFlags().BoolP("version", "V", false, "print version information")
 
+	RootCmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "jobs" {
+			name = "num-cpus"
+		}
+		return pflag.NormalizedName(name)
+	})
+
 	RootCmd.CompletionOptions.DisableDefaultCmd = true
 	RootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
 	RootCmd.SetUsageTemplate(usageTemplate(""))
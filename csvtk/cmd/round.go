@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"regexp"
 	"runtime"
@@ -63,11 +62,11 @@ var roundCmd = &cobra.Command{
 
 		fuzzyFields := getFlagBool(cmd, "fuzzy-fields")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -100,41 +99,38 @@ var roundCmd = &cobra.Command{
 				FuzzyFields: fuzzyFields,
 			})
 
-			var found []string
-			var founds [][]string
-			var fvalue float64
-
-			checkFirstLine := true
-			for record := range csvReader.Ch {
-				if record.Err != nil {
-					checkError(record.Err)
-				}
-
-				if checkFirstLine {
-					checkFirstLine = false
-
-					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
-						if config.NoOutHeader {
-							continue
+			round := func() func(*Record) bool {
+				var found []string
+				var founds [][]string
+				var fvalue float64
+				return func(record *Record) bool {
+					for _, f := range record.Fields {
+						founds = reDigitalsCapt.FindAllStringSubmatch(record.All[f-1], -1)
+						if len(founds) > 0 {
+							found = founds[0]
+							if found[2] == "" { // not scientific notation
+								fvalue, _ = strconv.ParseFloat(found[1], 64)
+								record.All[f-1] = fmt.Sprintf(decimalFormat, fvalue)
+							} else if found[1] == "" { // e20
+							} else {
+								fvalue, _ = strconv.ParseFloat(found[1], 64)
+								record.All[f-1] = fmt.Sprintf(decimalFormat, fvalue) + found[2]
+							}
 						}
-						checkError(writer.Write(record.All))
-						continue
 					}
+					return true
+				}
+			}
+
+			writeHeader := func(record Record) { // do not replace head line
+				if !config.NoOutHeader {
+					checkError(writer.Write(record.All))
 				}
+			}
 
-				for _, f := range record.Fields {
-					founds = reDigitalsCapt.FindAllStringSubmatch(record.All[f-1], -1)
-					if len(founds) > 0 {
-						found = founds[0]
-						if found[2] == "" { // not scientific notation
-							fvalue, _ = strconv.ParseFloat(found[1], 64)
-							record.All[f-1] = fmt.Sprintf(decimalFormat, fvalue)
-						} else if found[1] == "" { // e20
-						} else {
-							fvalue, _ = strconv.ParseFloat(found[1], 64)
-							record.All[f-1] = fmt.Sprintf(decimalFormat, fvalue) + found[2]
-						}
-					}
+			for record := range parallelRecords(csvReader.Ch, config.NumCPUs, config.NoHeaderRow, writeHeader, round) {
+				if record.Err != nil {
+					checkError(record.Err)
 				}
 				checkError(writer.Write(record.All))
 			}
@@ -0,0 +1,392 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// rowContext holds calls of row-context functions in an expression of
+// filter2 or mutate2, i.e., rownum(), lag(), lead() and groupidx(), whose
+// values depend on positions and neighboring rows.
+//
+// Values are computed sequentially by rowContext.records() and appended
+// to record.All, so the expression can still be evaluated in parallel.
+// They are taken back by rowContext.values() before evaluating.
+type rowContext struct {
+	calls   []*rowContextCall
+	maxLag  int
+	maxLead int
+
+	// number of first rows buffered for estimating aggregate functions in
+	// one pass, before they are evaluated with the estimates
+	warmup int
+}
+
+type rowContextCall struct {
+	fn          string // rownum, lag, lead, groupidx, or aggregate
+	field       string // column name or field number
+	n           int    // offset of lag and lead
+	op          string // operation of aggregate, in the name of "csvtk summary"
+	placeholder string
+
+	col    int            // 0-based column index
+	groups map[string]int // for groupidx
+	acc    *summaryAcc    // for aggregate
+}
+
+var reRowContextFunc = regexp.MustCompile(`\brownum\(\s*\)|\b(lag|lead|groupidx)\(\s*(\$\{[^}]+\}|\$[^\s,()]+)\s*(?:,\s*(\d+)\s*)?\)`)
+
+var reExprAggregate = regexp.MustCompile(`\b(count|sum|mean|std|stdev|var|variance|min|max|median|q1|q3|p\d+(?:\.\d+)?)\(\s*(\$\{[^}]+\}|\$[^\s,()]+)\s*\)`)
+
+var exprAggregateOps = map[string]string{"std": "stdev", "var": "variance"}
+
+// parseRowContext replaces calls of row-context functions with placeholders,
+// including aggregate functions if aggregates is true.
+func parseRowContext(expr string, aggregates bool) (string, *rowContext, error) {
+	ctx := &rowContext{}
+	var err error
+	if aggregates {
+		expr = reExprAggregate.ReplaceAllStringFunc(expr, func(s string) string {
+			m := reExprAggregate.FindStringSubmatch(s)
+			call := &rowContextCall{
+				fn:          "aggregate",
+				field:       exprFieldName(m[2]),
+				op:          m[1],
+				placeholder: fmt.Sprintf("shenweiCTX%d", len(ctx.calls)),
+			}
+			if op, ok := exprAggregateOps[call.op]; ok {
+				call.op = op
+			}
+			ctx.calls = append(ctx.calls, call)
+			return call.placeholder
+		})
+	}
+	expr = reRowContextFunc.ReplaceAllStringFunc(expr, func(s string) string {
+		m := reRowContextFunc.FindStringSubmatch(s)
+		call := &rowContextCall{fn: "rownum", placeholder: fmt.Sprintf("shenweiCTX%d", len(ctx.calls))}
+		if m[1] != "" {
+			call.fn = m[1]
+			call.field = exprFieldName(m[2])
+			call.n = 1
+			if m[3] != "" {
+				call.n, _ = strconv.Atoi(m[3])
+			}
+			switch call.fn {
+			case "lag":
+				if call.n > ctx.maxLag {
+					ctx.maxLag = call.n
+				}
+			case "lead":
+				if call.n > ctx.maxLead {
+					ctx.maxLead = call.n
+				}
+			case "groupidx":
+				if m[3] != "" {
+					err = fmt.Errorf("groupidx() accepts only one argument: %s", s)
+				}
+				call.groups = make(map[string]int, 1024)
+			}
+		}
+		ctx.calls = append(ctx.calls, call)
+		return call.placeholder
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(ctx.calls) == 0 {
+		return expr, nil, nil
+	}
+	return expr, ctx, nil
+}
+
+// exprFieldName returns the column name or field number of a variable,
+// e.g., $a, ${a b} or $1.
+func exprFieldName(s string) string {
+	s = strings.TrimPrefix(s, "$")
+	if strings.HasPrefix(s, "{") {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// hasAggregates tells whether there are aggregate functions.
+func (ctx *rowContext) hasAggregates() bool {
+	for _, call := range ctx.calls {
+		if call.fn == "aggregate" {
+			return true
+		}
+	}
+	return false
+}
+
+// initAggregates creates accumulators of aggregate functions. Quantiles
+// are estimated with t-digest if approx is true.
+func (ctx *rowContext) initAggregates(approx bool) {
+	for _, call := range ctx.calls {
+		if call.fn == "aggregate" {
+			call.acc = newSummaryAcc(newSummaryNeeds([]string{call.op}, approx), 200)
+		}
+	}
+}
+
+// add adds a value to the accumulator of an aggregate function,
+// values that are not numbers are skipped.
+func (call *rowContextCall) add(s string) {
+	if v, err := strconv.ParseFloat(removeComma(strings.TrimSpace(s)), 64); err == nil {
+		call.acc.addNumber(v, math.NaN())
+	}
+}
+
+// aggregate returns the value of an aggregate function, empty for no values.
+func (call *rowContextCall) aggregate() string {
+	var v float64
+	if call.op == "count" {
+		v = call.acc.n
+	} else {
+		v = call.acc.number(call.op)
+	}
+	if call.acc.n == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// precompute computes aggregate functions in a pass of the file, and
+// replaces their placeholders in the expression with the values.
+func (ctx *rowContext) precompute(config Config, file string, expr string, nullable bool) (string, error) {
+	ctx.initAggregates(false)
+
+	csvReader, err := newCSVReaderByConfig(config, file)
+	if err != nil {
+		if err == xopen.ErrNoContent {
+			return expr, nil
+		}
+		return "", err
+	}
+	csvReader.Read(ReadOption{
+		FieldStr: "1-",
+	})
+
+	first := true
+	for record := range csvReader.Ch {
+		if record.Err != nil {
+			return "", record.Err
+		}
+		if first {
+			first = false
+			if err = ctx.resolve(record.All, !config.NoHeaderRow || record.IsHeaderRow); err != nil {
+				return "", err
+			}
+			if !config.NoHeaderRow || record.IsHeaderRow {
+				continue
+			}
+		}
+		for _, call := range ctx.calls {
+			if call.fn == "aggregate" {
+				call.add(record.All[call.col])
+			}
+		}
+	}
+
+	calls := ctx.calls[:0]
+	for _, call := range ctx.calls {
+		if call.fn != "aggregate" {
+			calls = append(calls, call)
+			continue
+		}
+		expr = strings.ReplaceAll(expr, call.placeholder, "("+exprValue(call.aggregate(), false, nullable)+")")
+	}
+	ctx.calls = calls
+	return expr, nil
+}
+
+// resolve finds column indexes of fields from the header row, or
+// uses field numbers when there's no header row.
+func (ctx *rowContext) resolve(header []string, hasHeader bool) error {
+	for _, call := range ctx.calls {
+		if call.fn == "rownum" {
+			continue
+		}
+		call.col = -1
+		if f, err := strconv.Atoi(call.field); err == nil {
+			call.col = f - 1
+		} else if hasHeader {
+			for i, col := range header {
+				if col == call.field {
+					call.col = i
+					break
+				}
+			}
+		}
+		if call.col < 0 || call.col >= len(header) {
+			if call.fn == "aggregate" {
+				return fmt.Errorf("%s(): column not found: %s", call.op, call.field)
+			}
+			return fmt.Errorf("%s(): column not found: %s", call.fn, call.field)
+		}
+	}
+	return nil
+}
+
+// records computes values of row-context functions sequentially and
+// appends them to record.All. Values of lag and lead out of the range of
+// rows are empty strings. Aggregate functions, left for filter2 --approx,
+// are estimated from rows read so far, and the first ctx.warmup rows are
+// buffered until all of them are read.
+func (ctx *rowContext) records(ch chan Record, noHeaderRow bool) chan Record {
+	out := make(chan Record, parallelChunkSize)
+
+	go func() {
+		defer close(out)
+
+		first := true
+		var history [][]string // previous rows and the current row, for lag
+		var pending []Record   // rows waiting for following rows, for lead
+
+		emit := func(record Record, next []Record) {
+			for _, call := range ctx.calls {
+				var v string
+				switch call.fn {
+				case "rownum":
+					v = strconv.Itoa(record.Row)
+				case "lag":
+					if i := len(history) - 1 - call.n; i >= 0 { // the last one is the current row
+						v = history[i][call.col]
+					}
+				case "lead":
+					if call.n <= len(next) {
+						v = next[call.n-1].All[call.col]
+					}
+				case "groupidx":
+					key := record.All[call.col]
+					call.groups[key]++
+					v = strconv.Itoa(call.groups[key])
+				case "aggregate": // estimates from rows read so far
+					v = call.aggregate()
+				}
+				record.All = append(record.All, v)
+			}
+			out <- record
+		}
+
+		push := func(record Record) {
+			if ctx.maxLag > 0 {
+				if len(history) == ctx.maxLag+1 {
+					history = append(history[:0], history[1:]...)
+				}
+				history = append(history, append([]string{}, record.All...)) // record.All may be changed by workers
+			}
+		}
+
+		next := func(record Record) {
+			pending = append(pending, record)
+			if len(pending) > ctx.maxLead {
+				push(pending[0])
+				emit(pending[0], pending[1:])
+				pending = pending[1:]
+			}
+		}
+
+		aggregates := ctx.hasAggregates()
+		var warm []Record // the first rows, for estimating aggregate functions
+		warming := aggregates && ctx.warmup > 0
+		for record := range ch {
+			if record.Err != nil {
+				out <- record
+				continue
+			}
+			if first {
+				first = false
+				checkError(ctx.resolve(record.All, !noHeaderRow || record.IsHeaderRow))
+				if !noHeaderRow || record.IsHeaderRow {
+					out <- record
+					continue
+				}
+			}
+
+			if aggregates {
+				for _, call := range ctx.calls {
+					if call.fn == "aggregate" {
+						call.add(record.All[call.col])
+					}
+				}
+			}
+			if warming {
+				warm = append(warm, record)
+				if len(warm) < ctx.warmup {
+					continue
+				}
+				warming = false
+				for _, r := range warm {
+					next(r)
+				}
+				warm = nil
+				continue
+			}
+			next(record)
+		}
+		for _, r := range warm {
+			next(r)
+		}
+		for i := range pending {
+			push(pending[i])
+			emit(pending[i], pending[i+1:])
+		}
+	}()
+
+	return out
+}
+
+// values takes values of row-context functions back from record.All.
+func (ctx *rowContext) values(record *Record) []string {
+	n := len(record.All) - len(ctx.calls)
+	values := record.All[n:]
+	record.All = record.All[:n:n]
+	return values
+}
+
+// exprValue formats a value for substituting variables in expressions,
+// in the same way as fields in filter2 and mutate2.
+func exprValue(value string, asString bool, nullable bool) string {
+	if reDigitals.MatchString(value) {
+		if asString {
+			return `'` + value + `'`
+		}
+		v, _ := strconv.ParseFloat(removeComma(value), 64)
+		return fmt.Sprintf("%.16f", v)
+	}
+	if value == "" && nullable {
+		return "shenweiNULL"
+	}
+	if strings.Contains(value, `'`) {
+		value = strings.ReplaceAll(value, `'`, `\'`)
+	}
+	if strings.Contains(value, `"`) {
+		value = strings.ReplaceAll(value, `"`, `\"`)
+	}
+	return `'` + value + `'`
+}
@@ -21,10 +21,12 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
+	"math"
 	"math/rand"
 	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
@@ -35,8 +37,28 @@ var sampleCmd = &cobra.Command{
 	GroupID: "set",
 
 	Use:   "sample",
-	Short: "sampling by proportion",
-	Long: `sampling by proportion
+	Short: "sampling by proportion or number, optionally stratified by groups",
+	Long: `sampling by proportion or number, optionally stratified by groups
+
+Modes:
+  1. -p/--proportion: each record is outputted with a probability of p.
+  2. -N/--number: exactly N records are sampled with reservoir sampling,
+     which works for streams of unknown length.
+  3. -b/--by -p/--proportion: stratified sampling. round(p*n) records
+     (at least one) are sampled from each group of n records, keeping
+     the proportions of groups. All records are kept in memory.
+  4. -b/--by -N/--number: at most N records are sampled from each group
+     with reservoir sampling.
+
+Records are outputted in the input order, and the results are
+reproducible with the same -s/--rand-seed.
+
+Examples:
+
+    csvtk sample -p 0.1 data.csv
+    csvtk sample -N 1000 -s 1 data.csv
+    csvtk sample -b class -p 0.1 data.csv
+    csvtk sample -b class -N 100 data.csv
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -47,23 +69,31 @@ var sampleCmd = &cobra.Command{
 		proportion := getFlagFloat64(cmd, "proportion")
 		printLineNumber := getFlagBool(cmd, "line-number")
 
-		if proportion == 0 {
-			checkError(fmt.Errorf("flag -p (--proportion) needed"))
+		number := getFlagNonNegativeInt(cmd, "number")
+		byStr := getFlagString(cmd, "by")
+
+		if proportion == 0 && number == 0 {
+			checkError(fmt.Errorf("flag -p (--proportion) or -N (--number) needed"))
+		}
+		if proportion != 0 && number != 0 {
+			checkError(fmt.Errorf("flag -p (--proportion) and -N (--number) are incompatible"))
 		}
-		if proportion <= 0 || proportion > 1 {
+		if number == 0 && (proportion <= 0 || proportion > 1) {
 			checkError(fmt.Errorf("value of -p (--proportion) (%f) should be in range of (0, 1]", proportion))
 		}
+		streaming := number == 0 && byStr == ""
 
 		outAll := proportion == 1
 
 		seed := getFlagInt64(cmd, "rand-seed")
-		rand.Seed(seed)
+		rand.Seed(seed)                       // sampling by proportion, keeping the draws of previous versions
+		rnd := rand.New(rand.NewSource(seed)) // stratified and reservoir sampling
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -78,6 +108,17 @@ var sampleCmd = &cobra.Command{
 			checkError(writer.Error())
 		}()
 
+		var byFields []int
+		groups := make([]string, 0, 128) // groups in order of appearance
+		samples := make(map[string]*sampleReservoir, 128)
+		groupKey := make([]string, 0, 8)
+		var group string
+		var res *sampleReservoir
+		var ok bool
+		var j int
+		var idx int // index of records
+		printHeaderRow := true
+
 		for _, file := range files {
 			csvReader, err := newCSVReaderByConfig(config, file)
 
@@ -105,29 +146,103 @@ var sampleCmd = &cobra.Command{
 				if checkFirstLine {
 					checkFirstLine = false
 
+					if byStr != "" && byFields == nil {
+						header := record.All
+						if config.NoHeaderRow {
+							header = make([]string, len(record.All))
+						}
+						byFields = selectFieldsByHeader(header, byStr, false)
+					}
+
 					if !config.NoHeaderRow || record.IsHeaderRow { // do not replace head line
-						if config.NoOutHeader {
+						if config.NoOutHeader || !printHeaderRow {
 							continue
 						}
+						printHeaderRow = streaming
 						checkError(writer.Write(record.Selected))
 						continue
 					}
 				}
 
-				if outAll || rand.Float64() <= proportion {
-					checkError(writer.Write(record.Selected))
+				if streaming {
+					if outAll || rand.Float64() <= proportion {
+						checkError(writer.Write(record.Selected))
+					}
+					continue
+				}
+
+				groupKey = groupKey[:0]
+				for _, f := range byFields {
+					groupKey = append(groupKey, record.All[f-1])
 				}
+				group = strings.Join(groupKey, "_shenwei356_")
+				if res, ok = samples[group]; !ok {
+					res = &sampleReservoir{}
+					samples[group] = res
+					groups = append(groups, group)
+				}
+
+				res.n++
+				if number == 0 { // keep all records for sampling by proportion
+					res.records = append(res.records, sampleRecord{idx, record.Selected})
+				} else if len(res.records) < number {
+					res.records = append(res.records, sampleRecord{idx, record.Selected})
+				} else if j = rnd.Intn(res.n); j < number {
+					res.records[j] = sampleRecord{idx, record.Selected}
+				}
+				idx++
 			}
 
 			readerReport(&config, csvReader, file)
 		}
+
+		if streaming {
+			return
+		}
+
+		var n int
+		result := make([]sampleRecord, 0, 1024)
+		for _, group = range groups {
+			res = samples[group]
+			if number == 0 {
+				n = int(math.Round(proportion * float64(res.n)))
+				if n == 0 {
+					n = 1
+				}
+				rnd.Shuffle(len(res.records), func(i, j int) {
+					res.records[i], res.records[j] = res.records[j], res.records[i]
+				})
+				result = append(result, res.records[:n]...)
+			} else {
+				result = append(result, res.records...)
+			}
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].idx < result[j].idx })
+		for _, r := range result {
+			checkError(writer.Write(r.record))
+		}
 	},
 }
 
+// sampleRecord is a sampled record with its index in input.
+type sampleRecord struct {
+	idx    int
+	record []string
+}
+
+// sampleReservoir holds sampled records of a group,
+// and n is the number of all records of the group.
+type sampleReservoir struct {
+	n       int
+	records []sampleRecord
+}
+
 func init() {
 	RootCmd.AddCommand(sampleCmd)
 
 	sampleCmd.Flags().Int64P("rand-seed", "s", 11, "rand seed")
 	sampleCmd.Flags().Float64P("proportion", "p", 0, "sample by proportion")
+	sampleCmd.Flags().IntP("number", "N", 0, "sample exactly N records (per group with -b/--by) with reservoir sampling")
+	sampleCmd.Flags().StringP("by", "b", "", `stratify via fields. e.g -b 1,2 or -b columnA,columnB`)
 	sampleCmd.Flags().BoolP("line-number", "n", false, `print line number as the first column ("row")`)
 }
@@ -0,0 +1,364 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shenwei356/stable"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:     "schema",
+	Aliases: []string{"infer"},
+	Short:   "infer column types and report null counts, distinct counts and ranges",
+	Long: `infer column types and report null counts, distinct counts and ranges
+
+Types are inferred from non-null values, in the order of:
+
+  int       integers, e.g., 1, -20
+  float     numbers, e.g., 0.1, 1e-5
+  bool      true, false, yes, no (case-insensitive)
+  date      e.g., 2006-01-02, 2006/01/02
+  datetime  e.g., 2006-01-02 15:04:05, 2006-01-02T15:04:05Z07:00
+  string    others, or columns with only null values
+
+Null values are empty cells and values given by -n/--na-values.
+Minimum and maximum values are compared by the inferred types, and false
+is less than true for bool.
+
+Output formats (--format):
+  pretty    human-readable table (default)
+  csv       CSV/TSV, affected by global flags like "-T" and "-D"
+  json      JSON array of columns
+
+Use --sample N to scan only the first N records of huge files.
+
+Examples:
+
+    csvtk schema data.csv
+    csvtk schema --sample 10000 --format json data.csv.gz
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		format := strings.ToLower(getFlagString(cmd, "format"))
+		switch format {
+		case "pretty", "csv", "json":
+		default:
+			checkError(fmt.Errorf("invalid value of flag --format: %s. available: pretty, csv, json", format))
+		}
+		sample := getFlagNonNegativeInt(cmd, "sample")
+		nExamples := getFlagNonNegativeInt(cmd, "examples")
+		naValues := make(map[string]struct{})
+		for _, s := range getFlagStringSlice(cmd, "na-values") {
+			naValues[s] = struct{}{}
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk schema: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		var columns []*schemaColumn
+		var n int
+		var ok bool
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				columns = make([]*schemaColumn, len(record.All))
+				for i, name := range record.All {
+					if config.NoHeaderRow {
+						name = fmt.Sprintf("c%d", i+1)
+					}
+					columns[i] = newSchemaColumn(name)
+				}
+				if !config.NoHeaderRow {
+					continue
+				}
+			}
+
+			if sample > 0 && n >= sample {
+				break
+			}
+			n++
+
+			for i, val := range record.All {
+				if _, ok = naValues[val]; ok || val == "" {
+					columns[i].nulls++
+					continue
+				}
+				columns[i].add(val, nExamples)
+			}
+		}
+		readerReport(&config, csvReader, file)
+
+		switch format {
+		case "json":
+			list := make([]schemaColumnInfo, len(columns))
+			for i, c := range columns {
+				list[i] = c.info()
+			}
+			data, err := json.MarshalIndent(list, "", "  ")
+			checkError(err)
+			outfh.Write(data)
+			outfh.WriteString("\n")
+		case "csv":
+			writer := newCSVWriter(outfh)
+			if config.OutTabs || config.Tabs {
+				if config.OutDelimiter == ',' {
+					writer.Comma = '\t'
+				} else {
+					writer.Comma = config.OutDelimiter
+				}
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+			if !config.NoOutHeader {
+				checkError(writer.Write([]string{"column", "type", "nulls", "distinct", "min", "max", "examples"}))
+			}
+			for _, c := range columns {
+				info := c.info()
+				checkError(writer.Write([]string{info.Column, info.Type,
+					strconv.Itoa(info.Nulls), strconv.Itoa(info.Distinct),
+					info.Min, info.Max, strings.Join(info.Examples, "; ")}))
+			}
+			writer.Flush()
+			checkError(writer.Error())
+		default:
+			style := &stable.TableStyle{
+				Name: "plain",
+
+				HeaderRow: stable.RowStyle{Begin: "", Sep: "  ", End: ""},
+				DataRow:   stable.RowStyle{Begin: "", Sep: "  ", End: ""},
+				Padding:   "",
+			}
+			tbl := stable.New()
+			tbl.HeaderWithFormat([]stable.Column{
+				{Header: "column"},
+				{Header: "type"},
+				{Header: "nulls", Align: stable.AlignRight, HumanizeNumbers: true},
+				{Header: "distinct", Align: stable.AlignRight, HumanizeNumbers: true},
+				{Header: "min"},
+				{Header: "max"},
+				{Header: "examples"},
+			})
+			for _, c := range columns {
+				info := c.info()
+				tbl.AddRow([]interface{}{info.Column, info.Type, info.Nulls, info.Distinct,
+					info.Min, info.Max, strings.Join(info.Examples, "; ")})
+			}
+			outfh.Write(tbl.Render(style))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(schemaCmd)
+
+	schemaCmd.Flags().StringP("format", "", "pretty", `output format: pretty, csv, json`)
+	schemaCmd.Flags().IntP("sample", "", 0, `only scan the first N records, 0 for all`)
+	schemaCmd.Flags().IntP("examples", "e", 3, `the maximum number of example values`)
+	schemaCmd.Flags().StringSliceP("na-values", "n", []string{"NA", "N/A", "null", "NULL"}, `values treated as null besides empty strings`)
+}
+
+// schemaColumn holds the statistics of a column for type inference.
+type schemaColumn struct {
+	name     string
+	nulls    int
+	distinct map[string]struct{}
+	examples []string
+
+	// whether all non-null values could be of these types
+	isInt, isFloat, isBool, isDate, isTime bool
+
+	minS, maxS     string
+	minF, maxF     float64
+	minFs, maxFs   string
+	minT, maxT     time.Time
+	minTs, maxTs   string
+	minB, maxB     bool
+	minBs, maxBs   string
+	hasNum, hasTim bool
+	hasBool        bool
+}
+
+// schemaColumnInfo is the output of a column.
+type schemaColumnInfo struct {
+	Column   string   `json:"column"`
+	Type     string   `json:"type"`
+	Nulls    int      `json:"nulls"`
+	Distinct int      `json:"distinct"`
+	Min      string   `json:"min"`
+	Max      string   `json:"max"`
+	Examples []string `json:"examples"`
+}
+
+func newSchemaColumn(name string) *schemaColumn {
+	return &schemaColumn{
+		name:     name,
+		distinct: make(map[string]struct{}, 1024),
+		examples: make([]string, 0, 4),
+		isInt:    true,
+		isFloat:  true,
+		isBool:   true,
+		isDate:   true,
+		isTime:   true,
+	}
+}
+
+func (c *schemaColumn) add(val string, nExamples int) {
+	if _, ok := c.distinct[val]; !ok {
+		c.distinct[val] = struct{}{}
+		if len(c.examples) < nExamples {
+			c.examples = append(c.examples, val)
+		}
+	}
+
+	if len(c.distinct) == 1 || val < c.minS {
+		c.minS = val
+	}
+	if len(c.distinct) == 1 || val > c.maxS {
+		c.maxS = val
+	}
+
+	if c.isInt {
+		if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+			c.isInt = false
+		}
+	}
+	if c.isFloat {
+		if !reDigitals.MatchString(val) {
+			c.isFloat = false
+		} else if f, err := strconv.ParseFloat(val, 64); err != nil {
+			c.isFloat = false
+		} else {
+			if !c.hasNum || f < c.minF {
+				c.minF, c.minFs = f, val
+			}
+			if !c.hasNum || f > c.maxF {
+				c.maxF, c.maxFs = f, val
+			}
+			c.hasNum = true
+		}
+	}
+	if c.isBool {
+		var b bool
+		switch strings.ToLower(val) {
+		case "true", "yes":
+			b = true
+		case "false", "no":
+		default:
+			c.isBool = false
+		}
+		if c.isBool { // false < true
+			if !c.hasBool || (!b && c.minB) {
+				c.minB, c.minBs = b, val
+			}
+			if !c.hasBool || (b && !c.maxB) {
+				c.maxB, c.maxBs = b, val
+			}
+			c.hasBool = true
+		}
+	}
+	if c.isTime {
+		if t, isDate, err := parseXlsxDate(val); err != nil {
+			c.isDate, c.isTime = false, false
+		} else {
+			if !isDate {
+				c.isDate = false
+			}
+			if !c.hasTim || t.Before(c.minT) {
+				c.minT, c.minTs = t, val
+			}
+			if !c.hasTim || t.After(c.maxT) {
+				c.maxT, c.maxTs = t, val
+			}
+			c.hasTim = true
+		}
+	}
+}
+
+func (c *schemaColumn) info() schemaColumnInfo {
+	info := schemaColumnInfo{
+		Column:   c.name,
+		Type:     "string",
+		Nulls:    c.nulls,
+		Distinct: len(c.distinct),
+		Min:      c.minS,
+		Max:      c.maxS,
+		Examples: c.examples,
+	}
+	if len(c.distinct) == 0 {
+		return info
+	}
+	switch {
+	case c.isInt:
+		info.Type, info.Min, info.Max = "int", c.minFs, c.maxFs
+	case c.isFloat:
+		info.Type, info.Min, info.Max = "float", c.minFs, c.maxFs
+	case c.isBool:
+		info.Type, info.Min, info.Max = "bool", c.minBs, c.maxBs
+	case c.isDate:
+		info.Type, info.Min, info.Max = "date", c.minTs, c.maxTs
+	case c.isTime:
+		info.Type, info.Min, info.Max = "datetime", c.minTs, c.maxTs
+	}
+	return info
+}
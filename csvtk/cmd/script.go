@@ -0,0 +1,404 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// scriptCmd represents the script command
+var scriptCmd = &cobra.Command{
+	GroupID: "edit",
+
+	Use:   "script",
+	Short: "transform rows with Starlark scripts",
+	Long: `transform rows with Starlark scripts
+
+The script, given by -e/--expr or -s/--script-file, is run for every row,
+in Starlark, a dialect of Python: https://github.com/google/starlark-go
+
+Predeclared variables and functions:
+
+  row        the current row. Fields are accessed by row.name or row["name"]
+             for names which are not identifiers, and new columns are created
+             by assigning values to new fields
+  nr         the row number, starting from 1
+  header     column names of the input, a tuple
+  emit(x)    output a row or a dict, which can be called multiple times
+  skip()     skip the current row
+
+The current row is output after the script finishes if neither emit() nor
+skip() is called.
+
+Values of numbers are converted to int or float, unless -S/--numeric-as-string
+is given. Columns of the output are the ones of the first output row, and
+missing fields in other rows are left empty.
+
+Examples:
+
+  csvtk script -e 'row.total = row.price * row.qty'
+  csvtk script -e 'if row.qty > 0: row.unit = row.price / row.qty
+else: skip()'
+  csvtk script -e 'for t in row.tags.split(";"): emit({"id": row.id, "tag": t})'
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		src := getFlagString(cmd, "expr")
+		scriptFile := getFlagString(cmd, "script-file")
+		filename := "expr"
+		if scriptFile != "" {
+			if src != "" {
+				checkError(fmt.Errorf("flags -e/--expr and -s/--script-file are exclusive"))
+			}
+			data, err := os.ReadFile(scriptFile)
+			checkError(err)
+			src, filename = string(data), scriptFile
+		} else if src == "" {
+			checkError(fmt.Errorf("flag -e/--expr or -s/--script-file needed"))
+		}
+		numericAsString := getFlagBool(cmd, "numeric-as-string")
+		decimalWidth := getFlagInt(cmd, "decimal-width")
+
+		predeclared := starlark.StringDict{"row": nil, "nr": nil, "header": nil, "emit": nil, "skip": nil}
+		_, prog, err := starlark.SourceProgramOptions(starlarkFileOptions, filename, src, predeclared.Has)
+		checkError(err)
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk script: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+
+			DoNotAllowDuplicatedColumnName: true,
+		})
+
+		var header []string
+		var headerTuple starlark.Tuple
+
+		// output
+		var outHeader []string
+		var outIndex map[string]int
+		var out []string
+		// raw values are written for unchanged fields of rows
+		write := func(names []string, values []starlark.Value, raw []string) error {
+			if outHeader == nil {
+				outHeader = append([]string{}, names...)
+				outIndex = make(map[string]int, len(names))
+				for i, name := range names {
+					outIndex[name] = i
+				}
+				out = make([]string, len(names))
+				if !config.NoHeaderRow && !config.NoOutHeader {
+					checkError(writer.Write(outHeader))
+				}
+			}
+			for i := range out {
+				out[i] = ""
+			}
+			for i, name := range names {
+				j, ok := outIndex[name]
+				if !ok {
+					return fmt.Errorf("column %s not existed in the first output row, please create it for all rows", name)
+				}
+				if i < len(raw) && values[i] == nil {
+					out[j] = raw[i]
+				} else {
+					out[j] = starlarkValueString(values[i], decimalWidth)
+				}
+			}
+			checkError(writer.Write(out))
+			return nil
+		}
+
+		var emitted, skipped bool
+		emit := starlark.NewBuiltin("emit", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var x starlark.Value
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+				return nil, err
+			}
+			emitted = true
+			switch x := x.(type) {
+			case *scriptRow:
+				return starlark.None, write(x.names, x.changedValues(), x.raw)
+			case *starlark.Dict:
+				names := make([]string, 0, x.Len())
+				values := make([]starlark.Value, 0, x.Len())
+				for _, item := range x.Items() {
+					k, ok := starlark.AsString(item[0])
+					if !ok {
+						return nil, fmt.Errorf("emit: keys of dict should be strings, got %s", item[0].Type())
+					}
+					names = append(names, k)
+					values = append(values, item[1])
+				}
+				return starlark.None, write(names, values, nil)
+			}
+			return nil, fmt.Errorf("emit: row or dict expected, got %s", x.Type())
+		})
+		skip := starlark.NewBuiltin("skip", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			skipped = true
+			return starlark.None, nil
+		})
+
+		thread := &starlark.Thread{Name: "csvtk script"}
+		var nr int
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					header = record.All
+				} else {
+					header = make([]string, len(record.All))
+					for i := range header {
+						header[i] = fmt.Sprintf("c%d", i+1)
+					}
+				}
+				headerTuple = make(starlark.Tuple, len(header))
+				for i, col := range header {
+					headerTuple[i] = starlark.String(col)
+				}
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					continue
+				}
+			}
+
+			nr++
+			row := newScriptRow(header, record.All, numericAsString)
+			emitted, skipped = false, false
+			predeclared["row"] = row
+			predeclared["nr"] = starlark.MakeInt(nr)
+			predeclared["header"] = headerTuple
+			predeclared["emit"] = emit
+			predeclared["skip"] = skip
+			if _, err = prog.Init(thread, predeclared); err != nil {
+				if evalErr, ok := err.(*starlark.EvalError); ok {
+					checkError(fmt.Errorf("row %d: %s", nr, evalErr.Backtrace()))
+				}
+				checkError(fmt.Errorf("row %d: %s", nr, err))
+			}
+			if !emitted && !skipped {
+				checkError(write(row.names, row.changedValues(), row.raw))
+			}
+		}
+		readerReport(&config, csvReader, file)
+	},
+}
+
+// starlarkFileOptions allows top-level control flows in scripts.
+var starlarkFileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+	Recursion:       true,
+}
+
+// stringToStarlark converts a string to an int or float if it's numeric.
+func stringToStarlark(s string, numericAsString bool) starlark.Value {
+	if numericAsString || !reDigitals.MatchString(s) {
+		return starlark.String(s)
+	}
+	s2 := removeComma(s)
+	if i, err := strconv.ParseInt(s2, 10, 64); err == nil {
+		return starlark.MakeInt64(i)
+	}
+	if f, err := strconv.ParseFloat(s2, 64); err == nil {
+		return starlark.Float(f)
+	}
+	return starlark.String(s)
+}
+
+// starlarkValueString formats a value, with floats formatted with
+// decimalWidth decimal points, or the shortest representation if it's negative.
+func starlarkValueString(v starlark.Value, decimalWidth int) string {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return ""
+	case starlark.String:
+		return string(v)
+	case starlark.Int:
+		return v.String()
+	case starlark.Float:
+		return strconv.FormatFloat(float64(v), 'f', decimalWidth, 64)
+	case starlark.Bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return v.String()
+}
+
+// scriptRow is a row in Starlark, with fields accessed as attributes
+// or keys, and new fields appended as new columns.
+type scriptRow struct {
+	names   []string
+	values  []starlark.Value
+	raw     []string // original values
+	changed []bool
+	index   map[string]int
+	frozen  bool
+}
+
+func newScriptRow(header []string, record []string, numericAsString bool) *scriptRow {
+	r := &scriptRow{
+		names:   append(make([]string, 0, len(header)+4), header...),
+		values:  make([]starlark.Value, len(header), len(header)+4),
+		raw:     record,
+		changed: make([]bool, len(header), len(header)+4),
+		index:   make(map[string]int, len(header)+4),
+	}
+	for i, name := range header {
+		r.index[name] = i
+		r.values[i] = stringToStarlark(record[i], numericAsString)
+	}
+	return r
+}
+
+func (r *scriptRow) String() string {
+	var buf strings.Builder
+	buf.WriteString("row(")
+	for i, name := range r.names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(strconv.Quote(name))
+		buf.WriteString("=")
+		buf.WriteString(r.values[i].String())
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
+func (r *scriptRow) Type() string          { return "row" }
+func (r *scriptRow) Freeze()               { r.frozen = true }
+func (r *scriptRow) Truth() starlark.Bool  { return len(r.names) > 0 }
+func (r *scriptRow) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: row") }
+func (r *scriptRow) AttrNames() []string   { return r.names }
+
+func (r *scriptRow) Attr(name string) (starlark.Value, error) {
+	if i, ok := r.index[name]; ok {
+		return r.values[i], nil
+	}
+	return nil, nil // AttributeError
+}
+
+func (r *scriptRow) SetField(name string, v starlark.Value) error {
+	if r.frozen {
+		return fmt.Errorf("cannot set field of frozen row")
+	}
+	if i, ok := r.index[name]; ok {
+		r.values[i], r.changed[i] = v, true
+		return nil
+	}
+	r.index[name] = len(r.names)
+	r.names = append(r.names, name)
+	r.values = append(r.values, v)
+	r.changed = append(r.changed, true)
+	return nil
+}
+
+// changedValues returns values with unchanged ones of the input as nil.
+func (r *scriptRow) changedValues() []starlark.Value {
+	values := make([]starlark.Value, len(r.values))
+	for i, v := range r.values {
+		if r.changed[i] {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func (r *scriptRow) Get(k starlark.Value) (starlark.Value, bool, error) {
+	name, ok := starlark.AsString(k)
+	if !ok {
+		return nil, false, fmt.Errorf("row keys should be strings, got %s", k.Type())
+	}
+	if i, ok := r.index[name]; ok {
+		return r.values[i], true, nil
+	}
+	return nil, false, nil
+}
+
+func (r *scriptRow) SetKey(k, v starlark.Value) error {
+	name, ok := starlark.AsString(k)
+	if !ok {
+		return fmt.Errorf("row keys should be strings, got %s", k.Type())
+	}
+	return r.SetField(name, v)
+}
+
+func init() {
+	RootCmd.AddCommand(scriptCmd)
+	scriptCmd.Flags().StringP("expr", "e", "", `Starlark script`)
+	scriptCmd.Flags().StringP("script-file", "s", "", `file of Starlark script`)
+	scriptCmd.Flags().BoolP("numeric-as-string", "S", false, `treat numeric fields as strings`)
+	scriptCmd.Flags().IntP("decimal-width", "w", -1, "limit floats to N decimal points, -1 for the shortest representation")
+}
@@ -0,0 +1,487 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	GroupID: "misc",
+
+	Use:   "serve [directory]",
+	Short: "serve CSV/TSV files in a directory over HTTP with a web UI",
+	Long: `serve CSV/TSV files in a directory over HTTP with a web UI
+
+Files with suffixes of .csv and .tsv, optionally compressed (e.g., .csv.gz),
+in the directory (default: the current directory) and its subdirectories
+are served. Files ending with .tsv are read as tab-delimited files.
+
+The web UI shows paginated tables, with column sorting by clicking the
+headers, a quick search across all columns and filters of columns.
+
+Endpoints:
+
+  /                     list of files
+  /view?file=FILE       table view of a file
+  /api/files            list of files in JSON
+  /api/rows?file=FILE   rows of a file in JSON, or CSV with format=csv
+
+Parameters of /api/rows:
+
+  offset      the number of rows to skip, default 0
+  limit       the number of rows to return, default: -n/--page-size
+  sort        the column to sort by, values are compared as numbers if
+              both values are numeric
+  order       the sort order: asc or desc
+  q           case-insensitive text to search in all columns
+  filter      filter in the format of "column:text", for rows with
+              the column containing the case-insensitive text,
+              multiple values supported
+  format      output format: json or csv
+
+Files are read when requested and cached in memory, and reloaded when
+they are modified.
+
+Attention:
+
+  1. The server is listening on localhost by default, use -a/--addr
+     like "0.0.0.0:8080" to expose it to other machines.
+  2. There is no authentication, please do not serve sensitive data.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		if len(args) > 1 {
+			checkError(fmt.Errorf("no more than one directory should be given"))
+		}
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		info, err := os.Stat(dir)
+		checkError(err)
+		if !info.IsDir() {
+			checkError(fmt.Errorf("not a directory: %s", dir))
+		}
+
+		addr := getFlagString(cmd, "addr")
+		pageSize := getFlagPositiveInt(cmd, "page-size")
+
+		s := &csvServer{
+			config:   config,
+			dir:      dir,
+			pageSize: pageSize,
+			tables:   make(map[string]*serveTable, 8),
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", s.handleIndex)
+		mux.HandleFunc("/view", s.handleView)
+		mux.HandleFunc("/api/files", s.handleFiles)
+		mux.HandleFunc("/api/rows", s.handleRows)
+
+		if config.Verbose {
+			log.Infof("serving %s on http://%s", dir, addr)
+		}
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		checkError(server.ListenAndServe())
+	},
+}
+
+// serveTable is a cached table.
+type serveTable struct {
+	modTime time.Time
+	header  []string
+	rows    [][]string
+}
+
+type csvServer struct {
+	config   Config
+	dir      string
+	pageSize int
+
+	mu     sync.Mutex
+	tables map[string]*serveTable
+}
+
+// files returns relative paths of CSV/TSV files in the directory.
+func (s *csvServer) files() ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != s.dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if serveFileType(path) != "" {
+			rel, err := filepath.Rel(s.dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// serveFileType returns "csv" or "tsv" for supported files, or an empty string.
+func serveFileType(file string) string {
+	file = strings.ToLower(file)
+	if ext := compressionFormats[compressionFormatByExt(file)]; ext != "" {
+		file = strings.TrimSuffix(file, ext)
+	}
+	switch filepath.Ext(file) {
+	case ".csv":
+		return "csv"
+	case ".tsv":
+		return "tsv"
+	}
+	return ""
+}
+
+// table returns the table of a file, which is read or reloaded if necessary.
+func (s *csvServer) table(file string) (*serveTable, error) {
+	if file == "" || serveFileType(file) == "" {
+		return nil, fmt.Errorf("unsupported file: %s", file)
+	}
+	path := filepath.Join(s.dir, filepath.FromSlash(filepath.Clean("/"+file)))
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %s", file)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tables[path]; ok && t.modTime.Equal(info.ModTime()) {
+		return t, nil
+	}
+
+	config := s.config
+	config.Tabs = serveFileType(file) == "tsv"
+	if config.Tabs {
+		config.Delimiter = '\t'
+	} else {
+		config.Delimiter = ','
+	}
+	header, rows, err := readCSVAll(config, path)
+	if err != nil {
+		return nil, err
+	}
+	t := &serveTable{modTime: info.ModTime(), header: header, rows: rows}
+	s.tables[path] = t
+	return t, nil
+}
+
+func (s *csvServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	files, err := s.files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveIndexTemplate.Execute(w, map[string]interface{}{"Dir": s.dir, "Files": files})
+}
+
+func (s *csvServer) handleView(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if _, err := s.table(file); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveViewTemplate.Execute(w, map[string]interface{}{"File": file, "PageSize": s.pageSize})
+}
+
+func (s *csvServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := s.files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func (s *csvServer) handleRows(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	file := query.Get("file")
+	t, err := s.table(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	badRequest := func(format string, a ...interface{}) {
+		http.Error(w, fmt.Sprintf(format, a...), http.StatusBadRequest)
+	}
+	colIndex := func(col string) int {
+		for i, c := range t.header {
+			if c == col {
+				return i
+			}
+		}
+		return -1
+	}
+
+	offset, limit := 0, s.pageSize
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			badRequest("invalid offset: %s", v)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			badRequest("invalid limit: %s", v)
+			return
+		}
+	}
+
+	// filtering
+	type colFilter struct {
+		i    int
+		text string
+	}
+	var filters []colFilter
+	for _, f := range query["filter"] {
+		i := strings.LastIndexByte(f, ':')
+		if i < 0 {
+			badRequest(`invalid filter: %s, format: "column:text"`, f)
+			return
+		}
+		c := colIndex(f[:i])
+		if c < 0 {
+			badRequest("column not found: %s", f[:i])
+			return
+		}
+		if f[i+1:] != "" {
+			filters = append(filters, colFilter{c, strings.ToLower(f[i+1:])})
+		}
+	}
+	q := strings.ToLower(query.Get("q"))
+
+	rows := t.rows
+	if q != "" || len(filters) > 0 {
+		rows = make([][]string, 0, 1024)
+		for _, row := range t.rows {
+			ok := true
+			for _, f := range filters {
+				if !strings.Contains(strings.ToLower(row[f.i]), f.text) {
+					ok = false
+					break
+				}
+			}
+			if ok && q != "" {
+				ok = false
+				for _, v := range row {
+					if strings.Contains(strings.ToLower(v), q) {
+						ok = true
+						break
+					}
+				}
+			}
+			if ok {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	// sorting
+	if col := query.Get("sort"); col != "" {
+		c := colIndex(col)
+		if c < 0 {
+			badRequest("column not found: %s", col)
+			return
+		}
+		desc := strings.ToLower(query.Get("order")) == "desc"
+		if len(rows) == len(t.rows) {
+			rows = append([][]string(nil), rows...)
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := rows[i][c], rows[j][c]
+			if desc {
+				a, b = b, a
+			}
+			x, errx := strconv.ParseFloat(removeComma(a), 64)
+			y, erry := strconv.ParseFloat(removeComma(b), 64)
+			if errx == nil && erry == nil {
+				return x < y
+			}
+			return a < b
+		})
+	}
+
+	total := len(rows)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	rows = rows[offset:end]
+
+	switch strings.ToLower(query.Get("format")) {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		if rows == nil {
+			rows = [][]string{}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"file":   file,
+			"header": t.header,
+			"total":  total,
+			"offset": offset,
+			"limit":  limit,
+			"rows":   rows,
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := newCSVWriter(w)
+		writer.Write(t.header)
+		writer.WriteAll(rows)
+	default:
+		badRequest("unsupported format: %s, available: json, csv", query.Get("format"))
+	}
+}
+
+var serveIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>csvtk serve: {{.Dir}}</title>
+<style>body{font-family:sans-serif;margin:2em}li{margin:.3em 0}</style>
+</head>
+<body>
+<h2>Files in {{.Dir}}</h2>
+<ul>
+{{range .Files}}<li><a href="/view?file={{.}}">{{.}}</a> (<a href="/api/rows?file={{.}}&format=csv&limit=1000000000">csv</a>)</li>
+{{else}}<li>no CSV/TSV files found</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+var serveViewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>csvtk serve: {{.File}}</title>
+<style>
+body{font-family:sans-serif;margin:2em}
+table{border-collapse:collapse;font-size:14px}
+th,td{border:1px solid #ccc;padding:3px 8px;text-align:left;white-space:nowrap}
+th{background:#f0f0f0;cursor:pointer}
+th input{width:90%;font-size:12px}
+#bar{margin:1em 0}
+</style>
+</head>
+<body>
+<p><a href="/">files</a> / {{.File}}</p>
+<div id="bar">
+<input id="q" placeholder="search all columns">
+<button id="prev">&lt; prev</button>
+<span id="info"></span>
+<button id="next">next &gt;</button>
+</div>
+<table><thead><tr id="head"></tr><tr id="filters"></tr></thead><tbody id="body"></tbody></table>
+<script>
+const file = {{.File}}, limit = {{.PageSize}};
+let offset = 0, total = 0, sortCol = "", order = "asc", header = null, timer = null;
+const filters = {};
+
+function load() {
+  const p = new URLSearchParams({file: file, offset: offset, limit: limit});
+  if (sortCol) { p.set("sort", sortCol); p.set("order", order); }
+  const q = document.getElementById("q").value;
+  if (q) p.set("q", q);
+  for (const [col, text] of Object.entries(filters)) { if (text) p.append("filter", col + ":" + text); }
+  fetch("/api/rows?" + p).then(r => r.json()).then(d => {
+    total = d.total;
+    if (header === null) { header = d.header; renderHeader(); }
+    const body = document.getElementById("body");
+    body.innerHTML = "";
+    for (const row of d.rows) {
+      const tr = document.createElement("tr");
+      for (const v of row) { const td = document.createElement("td"); td.textContent = v; tr.appendChild(td); }
+      body.appendChild(tr);
+    }
+    document.getElementById("info").textContent =
+      (total ? offset + 1 : 0) + "-" + Math.min(offset + limit, total) + " of " + total;
+  });
+}
+
+function renderHeader() {
+  const head = document.getElementById("head"), fs = document.getElementById("filters");
+  head.innerHTML = ""; fs.innerHTML = "";
+  for (const col of header) {
+    const th = document.createElement("th");
+    th.textContent = col + (col === sortCol ? (order === "asc" ? " ▲" : " ▼") : "");
+    th.onclick = () => {
+      if (sortCol === col) { order = order === "asc" ? "desc" : "asc"; } else { sortCol = col; order = "asc"; }
+      offset = 0; renderHeader(); load();
+    };
+    head.appendChild(th);
+    const td = document.createElement("th"), input = document.createElement("input");
+    input.placeholder = "filter"; input.value = filters[col] || "";
+    input.oninput = () => { filters[col] = input.value; offset = 0; delay(); };
+    td.appendChild(input); fs.appendChild(td);
+  }
+}
+
+function delay() { clearTimeout(timer); timer = setTimeout(load, 300); }
+document.getElementById("q").oninput = () => { offset = 0; delay(); };
+document.getElementById("prev").onclick = () => { if (offset > 0) { offset = Math.max(0, offset - limit); load(); } };
+document.getElementById("next").onclick = () => { if (offset + limit < total) { offset += limit; load(); } };
+load();
+</script>
+</body>
+</html>
+`))
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringP("addr", "a", "127.0.0.1:8080", `address to listen on`)
+	serveCmd.Flags().IntP("page-size", "n", 50, `number of rows per page`)
+}
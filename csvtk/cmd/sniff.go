@@ -0,0 +1,432 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shenwei356/stable"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// sniffCmd represents the sniff command
+var sniffCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:   "sniff",
+	Short: "detect the delimiter, quote character, header row, encoding and line terminator",
+	Long: `detect the delimiter, quote character, header row, encoding and line terminator
+
+The dialect is detected from a sample of each file (-s/--sample-size), and
+the column "flags" gives the flags to read the file with csvtk.
+Use the global flag --sniff to apply the detected dialect of the first input
+file automatically in all commands, unless -t/-d or -H are given.
+
+Delimiters tested: ",", "\t", ";", "|", ":" and " ".
+Encodings detected: ascii, utf-8, utf-8-bom, utf-16le, utf-16be, or
+unknown (not UTF-8, e.g., latin1 or gbk), which can be transcoded to UTF-8
+with the global flag --in-encoding.
+
+Examples:
+
+    $ csvtk sniff data.txt
+    file       delimiter   quote   header   encoding   line_terminator   columns   flags
+    data.txt   ;           "       true     utf-8      CRLF              4         -d ';'
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		tabular := getFlagBool(cmd, "tabular")
+		sampleSize := getFlagPositiveInt(cmd, "sample-size")
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		header := []string{"file", "delimiter", "quote", "header", "encoding", "line_terminator", "columns", "flags"}
+		var tbl *stable.Table
+		if tabular {
+			outfh.WriteString(strings.Join(header, "\t") + "\n")
+		} else {
+			tbl = stable.New()
+			tbl.Header(header)
+		}
+
+		for _, file := range files {
+			d, err := sniffFile(file, sampleSize)
+			checkError(err)
+
+			row := []string{file, d.delimiterName(), d.quoteName(), strconv.FormatBool(d.Header),
+				d.Encoding, d.LineTerminator, strconv.Itoa(d.Columns), d.flags()}
+			if tabular {
+				outfh.WriteString(strings.Join(row, "\t") + "\n")
+			} else {
+				items := make([]interface{}, len(row))
+				for i, v := range row {
+					items[i] = v
+				}
+				tbl.AddRow(items)
+			}
+		}
+
+		if !tabular {
+			outfh.Write(tbl.Render(&stable.TableStyle{
+				Name: "plain",
+
+				HeaderRow: stable.RowStyle{Begin: "", Sep: "   ", End: ""},
+				DataRow:   stable.RowStyle{Begin: "", Sep: "   ", End: ""},
+				Padding:   "",
+			}))
+		}
+	},
+}
+
+func init() {
+	sniffCmd.Flags().BoolP("tabular", "", false, `output in machine-friendly tabular format`)
+	sniffCmd.Flags().IntP("sample-size", "s", 65536, `size of the sample of each file in bytes`)
+
+	RootCmd.AddCommand(sniffCmd)
+}
+
+// csvDialect is the dialect of a CSV file.
+type csvDialect struct {
+	Delimiter      rune
+	Quote          rune // 0 for no quotes
+	Header         bool
+	Encoding       string
+	LineTerminator string // LF, CRLF or CR
+	Columns        int
+}
+
+func (d csvDialect) delimiterName() string {
+	switch d.Delimiter {
+	case '\t':
+		return `\t`
+	case ' ':
+		return "space"
+	}
+	return string(d.Delimiter)
+}
+
+func (d csvDialect) quoteName() string {
+	if d.Quote == 0 {
+		return "none"
+	}
+	return string(d.Quote)
+}
+
+// flags returns the flags of csvtk to read the file.
+func (d csvDialect) flags() string {
+	flags := make([]string, 0, 2)
+	switch d.Delimiter {
+	case ',':
+	case '\t':
+		flags = append(flags, "-t")
+	default:
+		flags = append(flags, fmt.Sprintf("-d '%c'", d.Delimiter))
+	}
+	if !d.Header {
+		flags = append(flags, "-H")
+	}
+	switch {
+	case strings.HasPrefix(d.Encoding, "utf-16"):
+		flags = append(flags, "--in-encoding utf-16")
+	case d.Encoding == "unknown":
+		flags = append(flags, "--in-encoding auto")
+	}
+	return strings.Join(flags, " ")
+}
+
+// sniffFile detects the dialect of a file from a sample of the given size.
+func sniffFile(file string, sampleSize int) (csvDialect, error) {
+	fh, err := ropenRaw(file)
+	if err != nil {
+		if err == xopen.ErrNoContent {
+			return sniffDialect(nil, true), nil
+		}
+		return csvDialect{}, err
+	}
+	defer fh.Close()
+
+	data, err := io.ReadAll(io.LimitReader(fh, int64(sampleSize)+1))
+	if err != nil {
+		return csvDialect{}, err
+	}
+	complete := len(data) <= sampleSize
+	if !complete {
+		data = data[:sampleSize]
+	}
+	return sniffDialect(data, complete), nil
+}
+
+var sniffDelimiters = []rune{',', '\t', ';', '|', ':', ' '}
+
+// sniffDialect detects the dialect from a sample. The last line is ignored
+// if the sample is not complete.
+func sniffDialect(data []byte, complete bool) csvDialect {
+	d := csvDialect{Delimiter: ',', Header: true}
+
+	// encoding
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		d.Encoding = "utf-8-bom"
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		d.Encoding = "utf-16le"
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		d.Encoding = "utf-16be"
+	}
+	if d.Encoding == "" {
+		ascii := true
+		for _, b := range data {
+			if b >= utf8.RuneSelf {
+				ascii = false
+				break
+			}
+		}
+		switch {
+		case ascii:
+			d.Encoding = "ascii"
+		case utf8.Valid(data) || (!complete && utf8.Valid(data[:bytes.LastIndexByte(data, '\n')+1])):
+			d.Encoding = "utf-8"
+		default:
+			d.Encoding = "unknown"
+		}
+	}
+	if strings.HasPrefix(d.Encoding, "utf-16") {
+		if !complete && len(data)%2 == 1 {
+			data = data[:len(data)-1]
+		}
+		enc, _ := textEncoding("utf-16")
+		data, _ = enc.NewDecoder().Bytes(data)
+	}
+
+	// line terminator
+	crlf := bytes.Count(data, []byte("\r\n"))
+	lf := bytes.Count(data, []byte("\n")) - crlf
+	cr := bytes.Count(data, []byte("\r")) - crlf
+	switch {
+	case crlf > 0 && crlf >= lf && crlf >= cr:
+		d.LineTerminator = "CRLF"
+	case cr > lf:
+		d.LineTerminator = "CR"
+		data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	default:
+		d.LineTerminator = "LF"
+	}
+
+	if !complete {
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			data = data[:i+1]
+		}
+	}
+
+	// quote character, which starts or ends fields
+	var quotes [2]int // ", '
+	for i, b := range data {
+		if b != '"' && b != '\'' {
+			continue
+		}
+		if i > 0 && i < len(data)-1 && !sniffIsBoundary(data[i-1]) && !sniffIsBoundary(data[i+1]) {
+			continue
+		}
+		if b == '"' {
+			quotes[0]++
+		} else {
+			quotes[1]++
+		}
+	}
+	switch {
+	case quotes[0] > 0 && quotes[0] >= quotes[1]:
+		d.Quote = '"'
+	case quotes[1] > 0:
+		d.Quote = '\''
+	}
+
+	// delimiter, which occurs the same times in most lines
+	lines := sniffLineCounts(data, d.Quote)
+	var best float64
+	for _, delim := range sniffDelimiters {
+		freq := make(map[int]int, 8)
+		for _, counts := range lines {
+			freq[counts[delim]]++
+		}
+		var mode, n int
+		for c, m := range freq {
+			if c > 0 && (m > n || (m == n && c > mode)) {
+				mode, n = c, m
+			}
+		}
+		if mode == 0 {
+			continue
+		}
+		if score := float64(n) / float64(len(lines)); score > best {
+			best = score
+			d.Delimiter = delim
+		}
+	}
+
+	// header row
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = d.Delimiter
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	records := make([][]string, 0, 64)
+	for len(records) < 64 {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+	if len(records) > 0 {
+		d.Columns = len(records[0])
+	}
+	d.Header = sniffHeader(records)
+
+	return d
+}
+
+func sniffIsBoundary(b byte) bool {
+	switch b {
+	case '\n', '\r', ',', '\t', ';', '|', ':', ' ':
+		return true
+	}
+	return false
+}
+
+// sniffLineCounts counts candidate delimiters out of quotes in each line.
+func sniffLineCounts(data []byte, quote rune) []map[rune]int {
+	lines := make([]map[rune]int, 0, 64)
+	counts := make(map[rune]int, len(sniffDelimiters))
+	var quoted bool
+	for _, r := range string(data) {
+		switch {
+		case quote != 0 && r == quote:
+			quoted = !quoted
+		case quoted:
+		case r == '\n':
+			lines = append(lines, counts)
+			counts = make(map[rune]int, len(sniffDelimiters))
+		case r == '\r':
+		default:
+			counts[r]++
+		}
+	}
+	if len(counts) > 0 {
+		lines = append(lines, counts)
+	}
+	return lines
+}
+
+// sniffHeader votes for a header row by columns: a column votes for it if
+// the first value is not a number while others are, or the length of the
+// first value differs from others which have the same length.
+func sniffHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return true
+	}
+	header := records[0]
+	var votes int
+	for j, h := range header {
+		numeric, sameLen := true, true
+		n := -1
+		for _, record := range records[1:] {
+			if j >= len(record) {
+				continue
+			}
+			v := record[j]
+			if !reDigitals.MatchString(strings.TrimSpace(v)) {
+				numeric = false
+			}
+			if n < 0 {
+				n = len(v)
+			} else if len(v) != n {
+				sameLen = false
+			}
+		}
+		if n < 0 {
+			continue
+		}
+		switch {
+		case numeric:
+			if reDigitals.MatchString(strings.TrimSpace(h)) {
+				votes--
+			} else {
+				votes++
+			}
+		case sameLen:
+			if len(h) != n {
+				votes++
+			} else {
+				votes--
+			}
+		}
+	}
+	return votes >= 0
+}
+
+// applySniffedDialect detects the dialect of the first local input file and
+// applies the delimiter and the header row, unless they are given by flags.
+func applySniffedDialect(cmd *cobra.Command, config *Config) {
+	if config.InFormat != "csv" {
+		return
+	}
+	var file string
+	for _, f := range cmd.Flags().Args() {
+		if !isStdin(f) && !isMemFile(f) && !isURL(f) && !isObjectURL(f) {
+			file = f
+			break
+		}
+	}
+	if file == "" {
+		if config.Verbose {
+			log.Warningf("flag --sniff ignored: no local input files")
+		}
+		return
+	}
+
+	d, err := sniffFile(file, 65536)
+	checkError(err)
+
+	if !cmd.Flags().Changed("tabs") && !cmd.Flags().Changed("delimiter") && !config.Tabs {
+		if d.Delimiter == '\t' {
+			config.Tabs = true
+		} else {
+			config.Delimiter = d.Delimiter
+		}
+	}
+	if !cmd.Flags().Changed("no-header-row") && os.Getenv("CSVTK_H") == "" {
+		config.NoHeaderRow = !d.Header
+	}
+	if config.Verbose {
+		log.Infof("dialect sniffed from %s: delimiter: %s, header row: %v", file, d.delimiterName(), d.Header)
+	}
+}
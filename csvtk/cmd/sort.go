@@ -21,18 +21,26 @@
 package cmd
 
 import (
-	"encoding/csv"
+	"cmp"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/araddon/dateparse"
+	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 	"github.com/shenwei356/breader"
-	"github.com/shenwei356/util/stringutil"
+	"github.com/shenwei356/natsort"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
-	"github.com/twotwotwo/sorts"
 )
 
 // sortCmd represents the sort command
@@ -43,6 +51,30 @@ var sortCmd = &cobra.Command{
 	Short: "sort by selected fields",
 	Long: `sort by selected fields
 
+Sort types, appended to keys after ":", e.g., "-k name:N -k score:nr":
+
+  N          natural order, e.g., chr2 < chr10
+  n          number
+  d          date/time, parsed automatically
+  t=LAYOUT   date/time in a Go layout, e.g., "-k date:t=2006-01-02"
+  v          version, e.g., 1.2.0-rc.1 < 1.2.0 < 1.10.0
+  h          human-readable size, e.g., 800M < 1.5G
+  u          user-defined order, with level files given by -L/--levels
+  r          reverse, alone or combined with others, e.g., nr, Nr, tr=LAYOUT
+
+Multiple keys are compared in order, each with its own direction, and
+records with the same keys keep their input order.
+
+All records are loaded into memory by default. For files larger than the
+memory, use --buffer-size to sort them with bounded memory: records are
+buffered, sorted in chunks by -j/--num-cpus threads, written to compressed
+temporary files (--temp-dir, --temp-compress), and merged at last. Records
+with the same keys keep their input order in this mode.
+
+Examples:
+
+    csvtk sort -k 1 -k 2:nr big.tsv.gz -t --buffer-size 2G --temp-dir /tmp
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -93,63 +125,28 @@ var sortCmd = &cobra.Command{
 
 		sortTypes := []sortType{}
 		fieldsStrs := []string{}
-		var i int
-		var _key, _type string
 		for _, key := range keys {
-			i = strings.LastIndexByte(key, ':')
-			if i < 0 || i == len(key)-1 {
-				_key = key
-				fieldsStrs = append(fieldsStrs, _key)
-				sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: false, Reverse: false})
-			} else if i == 0 {
-				checkError(fmt.Errorf(`invalid key: "%s"`, key))
-			} else {
-				_key = key[:i]
-				fieldsStrs = append(fieldsStrs, _key)
-				_type = key[i+1:]
-				switch _type {
-				case "N":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Natural: true, Reverse: false})
-				case "Nr", "rN":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Natural: true, Reverse: true})
-				case "n":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: true, Reverse: false})
-				case "r":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: false, Reverse: true})
-				case "nr", "rn":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: true, Reverse: true})
-				case "d":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Date: true, Reverse: false})
-				case "dr":
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Date: true, Reverse: true})
-				case "u":
-					if _, ok := levelsMap[_key]; !ok {
-						checkError(fmt.Errorf("level file not provided for field: %s", _key))
-					}
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: false, Reverse: false, UserDefined: true, Levels: levelsMap[_key]})
-				case "ur", "ru":
-					if _, ok := levelsMap[_key]; !ok {
-						checkError(fmt.Errorf("level file not provided for field: %s", _key))
-					}
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: false, Reverse: true, UserDefined: true, Levels: levelsMap[_key]})
-				default:
-					// checkError(fmt.Errorf("invalid sort type: %s", _type))
-					_key = key
-					fieldsStrs[len(fieldsStrs)-1] = _key
-					sortTypes = append(sortTypes, sortType{FieldStr: _key, Number: false, Reverse: false})
+			t, err := parseSortKey(key)
+			checkError(err)
+			if t.UserDefined {
+				if _, ok := levelsMap[t.FieldStr]; !ok {
+					checkError(fmt.Errorf("level file not provided for field: %s", t.FieldStr))
 				}
+				t.Levels = levelsMap[t.FieldStr]
 			}
+			fieldsStrs = append(fieldsStrs, t.FieldStr)
+			sortTypes = append(sortTypes, t)
 		}
 
 		fieldsStr := strings.Join(fieldsStrs, ",")
 
 		fuzzyFields := false
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -165,6 +162,95 @@ var sortCmd = &cobra.Command{
 		}()
 
 		file := files[0]
+
+		// external sorting with bounded memory
+		if bufferSizeStr := getFlagString(cmd, "buffer-size"); bufferSizeStr != "" {
+			bufferSize, err := ParseByteSize(bufferSizeStr)
+			checkError(err)
+			if bufferSize <= 0 {
+				checkError(fmt.Errorf("value of flag --buffer-size should be greater than 0"))
+			}
+
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk sort: skipping empty input file: %s", file)
+					}
+					return
+				}
+				checkError(err)
+			}
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			var headerRow []string
+			var sortTypes2 []sortType
+			sorter := NewRecordSorter(getFlagString(cmd, "temp-dir"), bufferSize,
+				func(a, b *KeyedRecord) bool { return compareBySortTypes(sortTypes2, a.Record, b.Record) < 0 })
+			sorter.SetThreads(config.NumCPUs)
+			checkError(sorter.SetCompression(getFlagString(cmd, "temp-compress")))
+
+			var n int
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					if !config.NoHeaderRow || record.IsHeaderRow {
+						headerRow = record.All
+					}
+					for _, t := range sortTypes {
+						if !reDigitals.MatchString(t.FieldStr) && slices.Index(headerRow, t.FieldStr) < 0 {
+							checkError(fmt.Errorf("filed %s not matched in file: %s", t.FieldStr, file))
+						}
+					}
+					sortTypes2 = sortTypesByHeader(sortTypes, headerRow, ignoreCase)
+					for _, t := range sortTypes2 {
+						if t.Index < 0 || t.Index >= len(record.All) {
+							checkError(fmt.Errorf("filed %d out of range in file: %s", t.Index+1, file))
+						}
+					}
+					if headerRow != nil {
+						continue
+					}
+				}
+
+				checkError(sorter.Add(&KeyedRecord{Record: record.All}))
+				n++
+			}
+			readerReport(&config, csvReader, file)
+
+			if n == 0 {
+				log.Warningf("no data to sort from file: %s", file)
+			}
+			if len(headerRow) > 0 && !config.NoOutHeader {
+				checkError(writer.Write(headerRow))
+			}
+
+			records, err := sorter.Sort()
+			checkError(err)
+			if config.Verbose && sorter.NumRuns() > 0 {
+				log.Infof("%d records sorted with %d temporary files", n, sorter.NumRuns())
+			}
+			var r *KeyedRecord
+			for {
+				r, err = records.Next()
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+				checkError(writer.Write(r.Record))
+			}
+			checkError(sorter.Close())
+			return
+		}
+
 		colnames, fields, _, headerRow, data, err := parseCSVfile(cmd, config,
 			file, fieldsStr, fuzzyFields, false, true)
 
@@ -200,63 +286,65 @@ var sortCmd = &cobra.Command{
 			}
 		}
 
-		var list []stringutil.MultiKeyStringSlice // data
+		sortTypes2 := sortTypesByHeader(sortTypes, headerRow, ignoreCase)
 
-		sortTypes2 := make([]stringutil.SortType, len(sortTypes))
-		var field int
-		for i, t := range sortTypes {
-			if len(headerRow) > 0 {
-				if reDigitals.MatchString(t.FieldStr) {
-					field, err = strconv.Atoi(t.FieldStr)
-					checkError(err)
-					field--
-				} else {
-					for f, col := range headerRow {
-						if col == t.FieldStr {
-							field = f
-							break
-						}
-					}
-				}
-			} else {
-				field, err = strconv.Atoi(t.FieldStr)
-				checkError(err)
-				field--
-			}
-
-			sortTypes2[i] = stringutil.SortType{
-				Index:       field,
-				IgnoreCase:  ignoreCase,
-				Natural:     t.Natural,
-				Number:      t.Number,
-				Date:        t.Date,
-				Reverse:     t.Reverse,
-				UserDefined: t.UserDefined,
-				Levels:      t.Levels,
-			}
-		}
-
-		list = make([]stringutil.MultiKeyStringSlice, len(data))
-		for i, record := range data {
-			list[i] = stringutil.MultiKeyStringSlice{SortTypes: &sortTypes2, Value: record}
-		}
-		sorts.Quicksort(stringutil.MultiKeyStringSliceList(list))
+		sort.SliceStable(data, func(i, j int) bool {
+			return compareBySortTypes(sortTypes2, data[i], data[j]) < 0
+		})
 
 		if len(headerRow) > 0 && !config.NoOutHeader {
 			checkError(writer.Write(headerRow))
 		}
-		for _, s := range list {
-			checkError(writer.Write(s.Value))
+		for _, record := range data {
+			checkError(writer.Write(record))
 		}
 
 	},
 }
 
+// sortTypesByHeader returns sort types with indexes of fields, where
+// column names are replaced by their indexes in the header row.
+func sortTypesByHeader(sortTypes []sortType, headerRow []string, ignoreCase bool) []sortType {
+	sortTypes2 := make([]sortType, len(sortTypes))
+	var field int
+	var err error
+	for i, t := range sortTypes {
+		if len(headerRow) > 0 {
+			if reDigitals.MatchString(t.FieldStr) {
+				field, err = strconv.Atoi(t.FieldStr)
+				checkError(err)
+				field--
+			} else {
+				for f, col := range headerRow {
+					if col == t.FieldStr {
+						field = f
+						break
+					}
+				}
+			}
+		} else {
+			field, err = strconv.Atoi(t.FieldStr)
+			checkError(err)
+			field--
+		}
+
+		t.Index = field
+		t.IgnoreCase = ignoreCase
+		sortTypes2[i] = t
+	}
+	return sortTypes2
+}
+
 type sortType struct {
 	FieldStr    string
+	Index       int // 0-based index of the field
+	IgnoreCase  bool
 	Natural     bool
 	Number      bool
 	Date        bool
+	Layout      string // layout of dates, parsed automatically if empty
+	Version     bool
+	HumanSize   bool
 	Reverse     bool
 	UserDefined bool
 	Levels      map[string]int
@@ -264,7 +352,203 @@ type sortType struct {
 
 func init() {
 	RootCmd.AddCommand(sortCmd)
-	sortCmd.Flags().StringSliceP("keys", "k", []string{"1"}, `keys (multiple values supported). sort type supported, "N" for natural order, "n" for number, "d" for date/time, "u" for user-defined order and "r" for reverse. e.g., "-k 1" or "-k A:r" or ""-k 1:nr -k 2"`)
+	sortCmd.Flags().StringSliceP("keys", "k", []string{"1"}, `keys (multiple values supported). sort type supported, "N" for natural order, "n" for number, "d" for date/time, "t=LAYOUT" for date/time in a Go layout, "v" for version, "h" for human-readable size, "u" for user-defined order and "r" for reverse. e.g., "-k 1" or "-k A:r" or ""-k 1:nr -k 2" or "-k date:t=2006-01-02"`)
 	sortCmd.Flags().StringSliceP("levels", "L", []string{}, `user-defined level file (one level per line, multiple values supported). format: <field>:<level-file>.  e.g., "-k name:u -L name:level.txt"`)
 	sortCmd.Flags().BoolP("ignore-case", "i", false, "ignore-case")
+	sortCmd.Flags().StringP("buffer-size", "", "", `sort with bounded memory: size of records kept in memory before spilling sorted chunks to temporary files, supported units: K, M, G. e.g., 2G`)
+	sortCmd.Flags().StringP("temp-dir", "", "", `directory of temporary files, default: the system temporary directory`)
+	sortCmd.Flags().StringP("temp-compress", "", "lz4", `compression format of temporary files: gzip, zstd, lz4, none`)
+}
+
+var reSortKeyLayout = regexp.MustCompile(`^(.+?):(t|tr|rt)=(.+)$`)
+
+// parseSortKey parses a key like "name", "1:nr" or "date:t=2006-01-02".
+// Unknown sort types are treated as a part of the field, e.g., "a:b".
+func parseSortKey(key string) (sortType, error) {
+	if m := reSortKeyLayout.FindStringSubmatch(key); m != nil {
+		return sortType{FieldStr: m[1], Date: true, Layout: m[3], Reverse: m[2] != "t"}, nil
+	}
+
+	t := sortType{FieldStr: key}
+	i := strings.LastIndexByte(key, ':')
+	if i < 0 || i == len(key)-1 {
+		return t, nil
+	}
+	if i == 0 {
+		return t, fmt.Errorf(`invalid key: "%s"`, key)
+	}
+	_type := key[i+1:]
+	if len(_type) == 2 && _type[0] == 'r' { // "rn" -> "nr"
+		_type = _type[1:] + "r"
+	}
+	switch strings.TrimSuffix(_type, "r") {
+	case "N":
+		t.Natural = true
+	case "n":
+		t.Number = true
+	case "d":
+		t.Date = true
+	case "v":
+		t.Version = true
+	case "h":
+		t.HumanSize = true
+	case "u":
+		t.UserDefined = true
+	case "":
+	default:
+		return t, nil
+	}
+	t.Reverse = _type[len(_type)-1] == 'r'
+	t.FieldStr = key[:i]
+	return t, nil
+}
+
+// compareBySortTypes compares two records by keys, and returns
+// -1, 0 or 1. 0 is returned for records with the same keys,
+// which is needed for stable sorting and merging.
+func compareBySortTypes(sortTypes []sortType, a, b []string) int {
+	var v int
+	for _, t := range sortTypes {
+		x, y := a[t.Index], b[t.Index]
+		if t.IgnoreCase {
+			x, y = strings.ToLower(x), strings.ToLower(y)
+		}
+		switch {
+		case t.Number:
+			fx, err := strconv.ParseFloat(removeComma(x), 64)
+			if err != nil || math.IsNaN(fx) {
+				fx = math.MaxFloat64
+			}
+			fy, err := strconv.ParseFloat(removeComma(y), 64)
+			if err != nil || math.IsNaN(fy) {
+				fy = math.MaxFloat64
+			}
+			v = cmp.Compare(fx, fy)
+		case t.HumanSize:
+			v = cmp.Compare(parseHumanSize(x), parseHumanSize(y))
+		case t.Date:
+			var tx, ty time.Time
+			var errx, erry error
+			if t.Layout != "" {
+				tx, errx = time.Parse(t.Layout, x)
+				ty, erry = time.Parse(t.Layout, y)
+			} else {
+				tx, errx = dateparse.ParseLocal(x)
+				ty, erry = dateparse.ParseLocal(y)
+			}
+			if errx != nil || erry != nil {
+				v = cmp.Compare(x, y)
+			} else {
+				v = tx.Compare(ty)
+			}
+		case t.Version:
+			v = compareVersions(x, y)
+		case t.UserDefined:
+			lx, okx := t.Levels[x]
+			ly, oky := t.Levels[y]
+			switch {
+			case okx && oky:
+				v = cmp.Compare(lx, ly)
+			case okx: // values not in levels come last
+				v = -1
+			case oky:
+				v = 1
+			default:
+				v = strings.Compare(x, y)
+			}
+		case t.Natural:
+			if v = strings.Compare(x, y); v != 0 {
+				if natsort.Compare(x, y, false) {
+					v = -1
+				} else {
+					v = 1
+				}
+			}
+		default:
+			v = strings.Compare(x, y)
+		}
+		if v != 0 {
+			if t.Reverse {
+				return -v
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// parseHumanSize parses sizes like "800M", "1.5G" or "2 GiB".
+// Invalid values are treated as the largest ones.
+func parseHumanSize(s string) float64 {
+	if v, err := strconv.ParseFloat(removeComma(s), 64); err == nil {
+		return v
+	}
+	v, err := humanize.ParseBigBytes(strings.TrimSpace(s))
+	if err != nil {
+		return math.MaxFloat64
+	}
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+// compareVersions compares versions like "v1.2.10" or "1.0.0-rc.1",
+// where numeric parts are compared as numbers and pre-release versions
+// come before the release. Build metadata after "+" is ignored.
+func compareVersions(a, b string) int {
+	trim := func(s string) (string, string) {
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+		if i := strings.IndexByte(s, '+'); i >= 0 {
+			s = s[:i]
+		}
+		if i := strings.IndexByte(s, '-'); i >= 0 {
+			return s[:i], s[i+1:]
+		}
+		return s, ""
+	}
+	coreA, preA := trim(a)
+	coreB, preB := trim(b)
+
+	if v := compareVersionParts(strings.Split(coreA, "."), strings.Split(coreB, "."), "0"); v != 0 {
+		return v
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareVersionParts(strings.Split(preA, "."), strings.Split(preB, "."), "")
+}
+
+// compareVersionParts compares parts one by one, missing parts are
+// replaced with pad. Numeric parts are smaller than non-numeric ones.
+func compareVersionParts(a, b []string, pad string) int {
+	n := max(len(a), len(b))
+	var x, y string
+	for i := 0; i < n; i++ {
+		x, y = pad, pad
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x == y {
+			continue
+		}
+		ix, errx := strconv.ParseUint(x, 10, 64)
+		iy, erry := strconv.ParseUint(y, 10, 64)
+		switch {
+		case errx == nil && erry == nil:
+			return cmp.Compare(ix, iy)
+		case errx == nil && y != "":
+			return -1
+		case erry == nil && x != "":
+			return 1
+		}
+		return strings.Compare(x, y)
+	}
+	return 0
 }
@@ -27,7 +27,6 @@ import (
 	"strings"
 
 	"github.com/shenwei356/util/stringutil"
-	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 )
 
@@ -54,7 +53,7 @@ var space2tabCmd = &cobra.Command{
 			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
 		}
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
@@ -63,7 +62,7 @@ var space2tabCmd = &cobra.Command{
 		var scanner *bufio.Scanner
 		var line string
 		for _, file := range files {
-			fh, err := xopen.Ropen(file)
+			fh, err := ropen(file)
 			checkError(err)
 
 			scanner = bufio.NewScanner(fh)
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -257,7 +256,7 @@ func appendRows(config Config,
 	checkError(err)
 	defer outfh.Close()
 
-	writer := csv.NewWriter(outfh)
+	writer := newCSVWriter(outfh)
 	if config.OutTabs || config.Tabs {
 		if config.OutDelimiter == ',' {
 			writer.Comma = '\t'
@@ -0,0 +1,399 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	_ "modernc.org/sqlite"
+)
+
+// sqlCmd represents the sql command
+var sqlCmd = &cobra.Command{
+	GroupID: "set",
+
+	Use:   "sql",
+	Short: "query CSV/TSV files with SQL",
+	Long: `query CSV/TSV files with SQL
+
+Files are loaded into an in-memory SQLite database, and then the query is
+executed. SQL syntax: https://www.sqlite.org/lang_select.html
+
+Table names:
+  1. The base name of a file without extensions (.csv, .tsv, .txt,
+     .parquet and compression extensions), with characters other than
+     letters, digits and underscores replaced with "_", e.g., "a" for
+     "data/a.csv.gz".
+     The table name of stdin is "stdin".
+  2. File names given in the command line are also replaced with the table
+     names in the query, e.g., "select * from a.csv".
+  3. Custom names can be given by -n/--table-names.
+
+Column names:
+  1. Column names are the same as the header row. Please quote names with
+     special charactors with double quotes, e.g., "first name".
+  2. For files without header row (-H), column names are c1, c2, ...
+
+Column types:
+  Columns with all non-empty values being integers or floats are stored as
+  INTEGER or REAL, where empty values are NULL, so numeric comparisons and
+  aggregations work as expected. Other columns are stored as TEXT.
+  Use --all-text to store all columns as TEXT.
+
+Examples:
+  csvtk sql -q "select a.id, sum(b.x) from a.csv a join b.csv b using(id) group by 1" a.csv b.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		query := getFlagString(cmd, "query")
+		if query == "" {
+			checkError(fmt.Errorf("flag -q (--query) needed"))
+		}
+		tableNames := getFlagCommaSeparatedStrings(cmd, "table-names")
+		if len(tableNames) > 0 && len(tableNames) != len(files) {
+			checkError(fmt.Errorf("number of table names (%d) should be equal to number of files (%d)", len(tableNames), len(files)))
+		}
+		allText := getFlagBool(cmd, "all-text")
+		na := getFlagString(cmd, "na")
+
+		db, err := sql.Open("sqlite", ":memory:")
+		checkError(err)
+		defer db.Close()
+		db.SetMaxOpenConns(1) // every connection has its own in-memory database
+
+		tables := make(map[string]string, len(files)) // file -> table name
+		var table string
+		var ok bool
+		for i, file := range files {
+			if len(tableNames) > 0 {
+				table = tableNames[i]
+			} else {
+				table = sqlTableName(file)
+			}
+			if _, ok = tables[file]; ok {
+				checkError(fmt.Errorf("duplicated file: %s", file))
+			}
+			tables[file] = table
+
+			checkError(loadCSVToSQLite(config, db, file, table, sqliteLoadOptions{AllText: allText}))
+		}
+
+		query = sqlReplaceFileNames(query, tables)
+
+		rows, err := db.Query(query)
+		if err != nil {
+			checkError(fmt.Errorf("failed to execute the query: %s", err))
+		}
+		defer rows.Close()
+
+		checkError(writeSQLRows(config, rows, na))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(sqlCmd)
+	sqlCmd.Flags().StringP("query", "q", "", `SQL query, e.g., -q "select * from a.csv"`)
+	sqlCmd.Flags().StringP("table-names", "n", "", `comma separated table names for all files, in the same order of files`)
+	sqlCmd.Flags().BoolP("all-text", "", false, `store all columns as TEXT, no type inference`)
+	sqlCmd.Flags().StringP("na", "", "", `content for NULL values`)
+}
+
+var reSQLTableNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+var reSQLTableNameExt = regexp.MustCompile(`(?i)(\.(csv|tsv|txt|tab|parquet))?(\.(gz|xz|zst|bz2))?$`)
+
+// sqlTableName returns a table name from a file name.
+func sqlTableName(file string) string {
+	if isStdin(file) {
+		return "stdin"
+	}
+	name := reSQLTableNameExt.ReplaceAllString(filepath.Base(file), "")
+	name = reSQLTableNameInvalidChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "t" + name
+	}
+	return name
+}
+
+// sqlQuoteIdentifier quotes a table or column name.
+func sqlQuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlReplaceFileNames replaces file names in the query with table names,
+// string literals and quoted identifiers are not changed.
+func sqlReplaceFileNames(query string, tables map[string]string) string {
+	files := make([]string, 0, len(tables))
+	for file := range tables {
+		if file == "-" || file == tables[file] {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return query
+	}
+	sort.Slice(files, func(i, j int) bool { return len(files[i]) > len(files[j]) }) // longer names first
+	patterns := make([]string, len(files))
+	for i, file := range files {
+		patterns[i] = regexp.QuoteMeta(file)
+	}
+	re := regexp.MustCompile(`'(?:[^']|'')*'|"(?:[^"]|"")*"|(` + strings.Join(patterns, "|") + `)`)
+	isNamePart := func(c byte) bool {
+		return c == '_' || c == '.' || c == '/' || c == '-' ||
+			('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+	}
+
+	var b strings.Builder
+	var start int
+	for _, loc := range re.FindAllStringSubmatchIndex(query, -1) {
+		if loc[2] < 0 { // string literal or quoted identifier
+			continue
+		}
+		if (loc[2] > 0 && isNamePart(query[loc[2]-1])) || (loc[3] < len(query) && isNamePart(query[loc[3]])) {
+			continue // part of another name
+		}
+		b.WriteString(query[start:loc[2]])
+		b.WriteString(sqlQuoteIdentifier(tables[query[loc[2]:loc[3]]]))
+		start = loc[3]
+	}
+	b.WriteString(query[start:])
+	return b.String()
+}
+
+// writeSQLRows writes rows of a query result.
+func writeSQLRows(config Config, rows *sql.Rows, na string) error {
+	outfh, err := wopen(config.OutFile)
+	if err != nil {
+		return err
+	}
+	defer outfh.Close()
+
+	writer := newCSVWriter(outfh)
+	if config.OutTabs || config.Tabs {
+		if config.OutDelimiter == ',' {
+			writer.Comma = '\t'
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+	} else {
+		writer.Comma = config.OutDelimiter
+	}
+
+	colnames, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if !config.NoOutHeader {
+		if err = writer.Write(colnames); err != nil {
+			return err
+		}
+	}
+
+	values := make([]interface{}, len(colnames))
+	pointers := make([]interface{}, len(colnames))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(colnames))
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = sqlValue2String(v, na)
+		}
+		if err = writer.Write(record); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type sqliteLoadOptions struct {
+	AllText   bool       // store all columns as TEXT
+	Replace   bool       // drop the existing table
+	Append    bool       // insert into the existing table
+	BatchSize int        // number of rows in a transaction, 0 for all
+	Indexes   [][]string // columns of indexes to create
+}
+
+// loadCSVToSQLite loads a CSV/TSV file into a table.
+func loadCSVToSQLite(config Config, db *sql.DB, file string, table string, opts sqliteLoadOptions) error {
+	colnames, data, err := readCSVAll(config, file)
+	if err != nil {
+		return err
+	}
+	if colnames == nil {
+		if config.Verbose {
+			log.Warningf("skipping empty input file: %s", file)
+		}
+		return nil
+	}
+
+	// column types
+	types := make([]string, len(colnames))
+	for j := range colnames {
+		types[j] = "TEXT"
+		if !opts.AllText {
+			types[j] = sqlColumnType(data, j)
+		}
+	}
+
+	if opts.Replace {
+		if _, err = db.Exec("DROP TABLE IF EXISTS " + sqlQuoteIdentifier(table)); err != nil {
+			return fmt.Errorf("failed to drop table %s: %s", table, err)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("CREATE TABLE ")
+	if opts.Append {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	b.WriteString(sqlQuoteIdentifier(table) + " (")
+	for j, colname := range colnames {
+		if j > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(sqlQuoteIdentifier(colname) + " " + types[j])
+	}
+	b.WriteString(")")
+	if _, err = db.Exec(b.String()); err != nil {
+		return fmt.Errorf("failed to create table %s for file %s: %s", table, file, err)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(data)
+	}
+	quotedColnames := make([]string, len(colnames))
+	for j, colname := range colnames {
+		quotedColnames[j] = sqlQuoteIdentifier(colname)
+	}
+	query := "INSERT INTO " + sqlQuoteIdentifier(table) + " (" + strings.Join(quotedColnames, ", ") +
+		") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(colnames)), ", ") + ")"
+	for start := 0; start < len(data); start += batchSize {
+		end := start + batchSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err = insertSQLiteRows(db, query, data[start:end], types); err != nil {
+			return fmt.Errorf("failed to insert data of file %s: %s", file, err)
+		}
+	}
+
+	for _, columns := range opts.Indexes {
+		quoted := make([]string, len(columns))
+		for j, col := range columns {
+			quoted[j] = sqlQuoteIdentifier(col)
+		}
+		index := sqlQuoteIdentifier("idx_" + table + "_" + strings.Join(columns, "_"))
+		if _, err = db.Exec("CREATE INDEX IF NOT EXISTS " + index + " ON " + sqlQuoteIdentifier(table) +
+			" (" + strings.Join(quoted, ", ") + ")"); err != nil {
+			return fmt.Errorf("failed to create index on %s(%s): %s", table, strings.Join(columns, ", "), err)
+		}
+	}
+	return nil
+}
+
+// insertSQLiteRows inserts rows in a transaction.
+func insertSQLiteRows(db *sql.DB, query string, data [][]string, types []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	values := make([]interface{}, len(types))
+	for _, record := range data {
+		for j := range values {
+			if j >= len(record) {
+				values[j] = nil
+				continue
+			}
+			if types[j] != "TEXT" && record[j] == "" {
+				values[j] = nil
+			} else {
+				values[j] = record[j]
+			}
+		}
+		if _, err = stmt.Exec(values...); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	stmt.Close()
+	return tx.Commit()
+}
+
+// sqlColumnType infers the type of the j-th column: INTEGER, REAL, or TEXT.
+func sqlColumnType(data [][]string, j int) string {
+	switch inferColumnType(data, j) {
+	case colTypeInt:
+		return "INTEGER"
+	case colTypeFloat:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+func sqlValue2String(v interface{}, na string) string {
+	switch v := v.(type) {
+	case nil:
+		return na
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -21,10 +21,10 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -38,6 +38,10 @@ import (
 
 var separater string
 
+// statsRand is the random source of operation "rand", seeded by commands
+// with their rand seed flag.
+var statsRand = rand.New(rand.NewSource(11))
+
 // summaryCmd represents the stat2 command
 var summaryCmd = &cobra.Command{
 	GroupID: "info",
@@ -56,11 +60,35 @@ Available operations:
   # provided by github.com/gonum/stat and github.com/gonum/floats
   countn (count numeric values), min, max, sum, argmin, argmax,
   mean, stdev, variance, median, q1, q2, q3,
+  pN (the N-th percentile, e.g., p5, p95, p99, p99.9),
+  hmean (harmonic mean), gmean (geometric mean),
+  skewness, kurtosis (excess kurtosis),
   entropy (Shannon entropy), 
   prod (product of the elements)
 
+  # weighted operations, with weights in the field of --weight-field
+  wmean (weighted mean), wsum (weighted sum)
+
   # textual/numeric operations
-  count, first, last, rand, unique/uniq, collapse, countunique
+  count, first, last, rand, unique/uniq, collapse, countunique,
+  mode (the most frequent value)
+
+Different operations can be applied to different fields in one pass,
+e.g., -f price:wmean,price:p95,qty:sum,name:mode --weight-field qty.
+
+Memory usage:
+
+  Data are aggregated in one pass with streaming algorithms, e.g.,
+  Welford's method for variance, skewness and kurtosis, so the memory
+  usage depends on the number of groups rather than rows, except for:
+
+    1. quantiles (median, q1, q2, q3 and pN), which keep all numbers
+       of the field. Use -a/--approx-quantiles to estimate them with
+       t-digest in bounded memory instead.
+    2. rand and collapse, which keep all values of the field.
+    3. uniq, countunique and mode, which keep distinct values.
+
+  Use --chunk-progress to show the progress for huge files.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -81,8 +109,12 @@ Available operations:
 		if separater == "" {
 			checkError(fmt.Errorf("flag -s (--separater) needed"))
 		}
-		seed := getFlagInt64(cmd, "rand-seed")
-		rand.Seed(seed)
+		statsRand = rand.New(rand.NewSource(getFlagInt64(cmd, "rand-seed")))
+
+		weightField := getFlagString(cmd, "weight-field")
+		approx := getFlagBool(cmd, "approx-quantiles")
+		compression := getFlagFloat64(cmd, "compression")
+		chunkProgress := getFlagNonNegativeInt(cmd, "chunk-progress")
 
 		ops := getFlagStringSlice(cmd, "fields")
 		if len(ops) == 0 {
@@ -127,9 +159,14 @@ Available operations:
 
 				_, ok1 := allStats[items[1]]  // for numbers
 				_, ok2 := allStats2[items[1]] // for strings
-				if !(ok1 || ok2) {
+				_, ok3 := allStatsWeighted[items[1]]
+				_, ok4 := parsePercentileOp(items[1])
+				if !(ok1 || ok2 || ok3 || ok4) {
 					checkError(fmt.Errorf(`invalid operation: %s. run "csvtk summary --help" for help`, items[1]))
 				}
+				if ok3 && weightField == "" {
+					checkError(fmt.Errorf(`flag --weight-field needed for operation: %s`, items[1]))
+				}
 				if _, ok := stats[items[0]]; !ok {
 					stats[items[0]] = make([]string, 0, 1)
 				}
@@ -152,14 +189,17 @@ Available operations:
 		} else {
 			tmp = fieldsStrsD
 		}
+		if weightField != "" {
+			tmp = append(tmp, weightField)
+		}
 
 		fieldsStr := strings.Join(tmp, ",")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -199,10 +239,9 @@ Available operations:
 
 		var HeaderRow []string
 
-		// group -> field -> data
-		data := make(map[string]map[int][]float64) // for numbers
-		data2 := make(map[string]map[int][]string) // for strings
-		scientifc := make(map[string]map[int]byte) // for numbers
+		// group -> field -> accumulator
+		accs := make(map[string]map[int]*summaryAcc)
+		needs := make(map[int]summaryNeeds)
 
 		fieldsG := []int{}
 		fieldsD := []int{}
@@ -212,7 +251,12 @@ Available operations:
 		var e error
 		var ok bool
 		var group string
-		var needParseDigits bool
+		var w float64
+		var acc *summaryAcc
+		var nd summaryNeeds
+		var accsG map[int]*summaryAcc
+		var nRows int
+		numFieldsG := len(fieldsStrsG)
 
 		var hasHeaderLine bool
 		checkFirstLine := true
@@ -225,8 +269,8 @@ Available operations:
 			if checkFirstLine {
 				checkFirstLine = false
 
-				fieldsD = append(fieldsD, record.Fields[:numFieldsD]...) //  copy
-				fieldsG = append(fieldsG, record.Fields[numFieldsD:]...) //  copy
+				fieldsD = append(fieldsD, record.Fields[:numFieldsD]...)                      //  copy
+				fieldsG = append(fieldsG, record.Fields[numFieldsD:numFieldsD+numFieldsG]...) //  copy
 
 				fieldsDUniq = make([]int, len(fieldsD))
 				copy(fieldsDUniq, fieldsD)
@@ -239,6 +283,9 @@ Available operations:
 						statsI[f] = append(statsI[f], statsList[i][1])
 					}
 				}
+				for f, ops := range statsI {
+					needs[f] = newSummaryNeeds(ops, approx)
+				}
 
 				if !config.NoHeaderRow || record.IsHeaderRow {
 					HeaderRow = record.All
@@ -247,30 +294,37 @@ Available operations:
 				}
 			}
 
-			group = strings.Join(record.Selected[numFieldsD:], "_shenwei356_")
-			if _, ok = data[group]; !ok {
-				data[group] = make(map[int][]float64, 1024)
-				scientifc[group] = make(map[int]byte)
-			}
-			if _, ok = data2[group]; !ok {
-				data2[group] = make(map[int][]string, 1024)
+			nRows++
+			if chunkProgress > 0 && nRows%chunkProgress == 0 {
+				log.Infof("csvtk summary: %d rows processed", nRows)
 			}
 
-			for _, f = range fieldsDUniq {
-				if _, ok = data2[group][f]; !ok {
-					data2[group][f] = []string{}
+			group = strings.Join(record.Selected[numFieldsD:numFieldsD+numFieldsG], "_shenwei356_")
+			if accsG, ok = accs[group]; !ok {
+				accsG = make(map[int]*summaryAcc, len(fieldsDUniq))
+				for _, f = range fieldsDUniq {
+					accsG[f] = newSummaryAcc(needs[f], compression)
 				}
-				data2[group][f] = append(data2[group][f], record.All[f-1])
+				accs[group] = accsG
+			}
 
-				needParseDigits = false
-				for _, op := range statsI[f] {
-					if _, ok = allStats[op]; ok {
-						needParseDigits = true
-						break
-					}
+			if weightField != "" {
+				w = math.NaN() // skipped in weighted operations
+				wStr := record.Selected[len(record.Selected)-1]
+				if reDigitals.MatchString(wStr) {
+					w, e = strconv.ParseFloat(removeComma(wStr), 64)
+					checkError(e)
+				} else if !ignore {
+					checkError(fmt.Errorf("weight field has non-numeric data: %s, you can use flag -i/--ignore-non-numbers to skip these data", wStr))
 				}
+			}
 
-				if !needParseDigits {
+			for _, f = range fieldsDUniq {
+				acc = accsG[f]
+				nd = needs[f]
+				acc.addText(record.All[f-1])
+
+				if !nd.numbers {
 					continue
 				}
 				if !reDigitals.MatchString(record.All[f-1]) {
@@ -280,22 +334,22 @@ Available operations:
 					checkError(fmt.Errorf("column %d has non-numeric data: %s, you can use flag -i/--ignore-non-numbers to skip these data", f, record.All[f-1]))
 				}
 				if strings.Contains(record.All[f-1], "E") {
-					scientifc[group][f] = 'E'
+					acc.scientific = 'E'
 				} else if strings.Contains(record.All[f-1], "e") {
-					scientifc[group][f] = 'e'
+					acc.scientific = 'e'
 				}
 
 				v, e = strconv.ParseFloat(removeComma(record.All[f-1]), 64)
 				checkError(e)
-				if _, ok = data[group][f]; !ok {
-					data[group][f] = []float64{}
-				}
-				data[group][f] = append(data[group][f], v)
+				acc.addNumber(v, w)
 			}
 
 		}
 
 		readerReport(&config, csvReader, file)
+		if chunkProgress > 0 && nRows%chunkProgress != 0 {
+			log.Infof("csvtk summary: %d rows processed", nRows)
+		}
 
 		colsOut := len(fieldsG) + len(fieldsD)
 		if hasHeaderLine {
@@ -313,14 +367,13 @@ Available operations:
 			writer.Write(record)
 		}
 
-		groups := make([]string, 0, len(data)+len(data2))
-		for group := range data {
+		groups := make([]string, 0, len(accs))
+		for group := range accs {
 			groups = append(groups, group)
 		}
 		sort.Strings(groups)
 
-		var fu func([]float64) float64
-		var fu2 func([]string) string
+		var value float64
 		for _, group := range groups {
 			record := make([]string, 0, colsOut)
 			if len(fieldsG) > 0 {
@@ -329,35 +382,23 @@ Available operations:
 
 			for i, ss := range statsList {
 				s := ss[1]
-				f := fieldsD[i]
+				acc = accs[group][fieldsD[i]]
 
-				sorted := false
-				if _, ok = allStats[s]; !ok {
-					fu2 = allStats2[s]
-					record = append(record, fu2(data2[group][f]))
-				} else {
-					needSort := false
-					for _, s := range statsI[f] {
-						if s == "q1" || s == "q2" || s == "q3" || s == "median" {
-							needSort = true
-							break
-						}
-					}
-					if needSort && !sorted {
-						sort.Float64s(data[group][f])
-						sorted = true
-					}
+				if _, ok = allStats2[s]; ok {
+					record = append(record, acc.text(s))
+					continue
+				}
 
-					fu = allStats[s]
-					if s == "countn" {
-						record = append(record, fmt.Sprintf("%.0f", fu(data[group][f])))
-					} else if scientifc[group][f] == 'E' {
-						record = append(record, fmt.Sprintf(decimalFormatScientificE, fu(data[group][f])))
-					} else if scientifc[group][f] == 'e' {
-						record = append(record, fmt.Sprintf(decimalFormatScientifice, fu(data[group][f])))
-					} else {
-						record = append(record, fmt.Sprintf(decimalFormat, fu(data[group][f])))
-					}
+				value = acc.number(s)
+
+				if s == "countn" {
+					record = append(record, fmt.Sprintf("%.0f", value))
+				} else if acc.scientific == 'E' {
+					record = append(record, fmt.Sprintf(decimalFormatScientificE, value))
+				} else if acc.scientific == 'e' {
+					record = append(record, fmt.Sprintf(decimalFormatScientifice, value))
+				} else {
+					record = append(record, fmt.Sprintf(decimalFormat, value))
 				}
 			}
 			writer.Write(record)
@@ -368,8 +409,201 @@ Available operations:
 
 var allStats map[string]func([]float64) float64
 var allStats2 map[string]func([]string) string
+var allStatsWeighted map[string]struct{}
 var allStatsList []string
 
+// operations computed from accumulators in one pass, used in summary
+var summaryStats map[string]func(*summaryAcc) float64
+var summaryStats2 map[string]func(*summaryAcc) string
+
+var rePercentileOp = regexp.MustCompile(`^p(\d+(\.\d+)?)$`)
+
+// parsePercentileOp parses operations like "p95" and returns the percentile in [0, 1].
+func parsePercentileOp(op string) (float64, bool) {
+	m := rePercentileOp.FindStringSubmatch(op)
+	if m == nil {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || p > 100 {
+		return 0, false
+	}
+	return p / 100, true
+}
+
+// summaryNeeds tells what to keep for the operations of a field.
+type summaryNeeds struct {
+	numbers bool // parse numbers
+	values  bool // keep all numbers for exact quantiles
+	digest  bool // estimate quantiles with t-digest
+	texts   bool // keep all texts for rand and collapse
+	counts  bool // count distinct texts for uniq, countunique and mode
+}
+
+func newSummaryNeeds(ops []string, approx bool) summaryNeeds {
+	var nd summaryNeeds
+	for _, op := range ops {
+		switch op {
+		case "rand", "collapse":
+			nd.texts = true
+			continue
+		case "uniq", "unique", "countuniq", "countunique", "mode":
+			nd.counts = true
+			continue
+		case "count", "first", "last":
+			continue
+		}
+		nd.numbers = true
+		if _, ok := parsePercentileOp(op); ok || op == "median" || op == "q1" || op == "q2" || op == "q3" {
+			if approx {
+				nd.digest = true
+			} else {
+				nd.values = true
+			}
+		}
+	}
+	return nd
+}
+
+// summaryAcc accumulates data of a field in a group in one pass.
+// Only the operations of quantiles, rand and collapse need to keep values.
+type summaryAcc struct {
+	// numbers
+	n                float64
+	sum, prod        float64
+	min, max         float64
+	argmin, argmax   int
+	mean, m2, m3, m4 float64 // central moments, updated with Welford's method
+	sumLog, sumInv   float64
+	entropy          float64
+	nW, sumW, sumWX  float64
+
+	scientific byte
+
+	values []float64 // for exact quantiles
+	sorted bool
+	digest *tDigest // for approximate quantiles
+
+	// texts
+	count       int
+	first, last string
+	texts       []string       // for rand and collapse
+	counts      map[string]int // for uniq, countunique and mode
+	mode        string
+	modeN       int
+}
+
+func newSummaryAcc(nd summaryNeeds, compression float64) *summaryAcc {
+	a := &summaryAcc{prod: 1, min: math.NaN(), max: math.NaN()}
+	if nd.values {
+		a.values = make([]float64, 0, 1024)
+	}
+	if nd.digest {
+		a.digest = newTDigest(compression)
+	}
+	if nd.texts {
+		a.texts = make([]string, 0, 1024)
+	}
+	if nd.counts {
+		a.counts = make(map[string]int, 1024)
+	}
+	return a
+}
+
+func (a *summaryAcc) addText(s string) {
+	if a.count == 0 {
+		a.first = s
+	}
+	a.count++
+	a.last = s
+	if a.texts != nil {
+		a.texts = append(a.texts, s)
+	}
+	if a.counts != nil {
+		a.counts[s]++
+		if a.counts[s] > a.modeN { // the first one for ties
+			a.mode, a.modeN = s, a.counts[s]
+		}
+	}
+}
+
+// addNumber adds a value with its weight, NaN weights are skipped in weighted operations.
+func (a *summaryAcc) addNumber(x, w float64) {
+	n1 := a.n
+	a.n++
+	if n1 == 0 || x > a.max {
+		a.max, a.argmax = x, int(a.n)
+	}
+	if n1 == 0 || x < a.min {
+		a.min, a.argmin = x, int(a.n)
+	}
+	a.sum += x
+	a.prod *= x
+	a.sumLog += math.Log(x)
+	a.sumInv += 1 / x
+	if x != 0 {
+		a.entropy -= x * math.Log(x)
+	}
+
+	delta := x - a.mean
+	deltaN := delta / a.n
+	deltaN2 := deltaN * deltaN
+	term1 := delta * deltaN * n1
+	a.mean += deltaN
+	a.m4 += term1*deltaN2*(a.n*a.n-3*a.n+3) + 6*deltaN2*a.m2 - 4*deltaN*a.m3
+	a.m3 += term1*deltaN*(a.n-2) - 3*deltaN*a.m2
+	a.m2 += term1
+
+	if !math.IsNaN(w) {
+		a.nW++
+		a.sumW += w
+		a.sumWX += w * x
+	}
+
+	if a.values != nil {
+		a.values = append(a.values, x)
+	}
+	if a.digest != nil {
+		a.digest.Add(x)
+	}
+}
+
+// quantile returns the p-quantile.
+func (a *summaryAcc) quantile(p float64) float64 {
+	if a.n == 0 {
+		return math.NaN()
+	}
+	if a.digest != nil {
+		return a.digest.Quantile(p)
+	}
+	if !a.sorted {
+		sort.Float64s(a.values)
+		a.sorted = true
+	}
+	if p == 0.5 {
+		return median(a.values)
+	}
+	return percentileValue(a.values, p)
+}
+
+// number returns the value of a numeric operation.
+func (a *summaryAcc) number(op string) float64 {
+	if fu, ok := summaryStats[op]; ok {
+		return fu(a)
+	}
+	p, _ := parsePercentileOp(op)
+	return a.quantile(p)
+}
+
+// text returns the value of a textual operation.
+func (a *summaryAcc) text(op string) string {
+	return summaryStats2[op](a)
+}
+
+func (a *summaryAcc) stdev() float64 {
+	return math.Sqrt(a.m2 / (a.n - 1))
+}
+
 func init() {
 	allStats = make(map[string]func([]float64) float64)
 	allStats["sum"] = func(s []float64) float64 {
@@ -433,11 +667,28 @@ func init() {
 		return percentileValue(s, 0.75)
 	}
 
+	allStats["hmean"] = func(s []float64) float64 {
+		if len(s) == 0 {
+			return math.NaN()
+		}
+		return stat.HarmonicMean(s, nil)
+	}
+	allStats["gmean"] = func(s []float64) float64 {
+		if len(s) == 0 {
+			return math.NaN()
+		}
+		return stat.GeometricMean(s, nil)
+	}
+	allStats["skewness"] = func(s []float64) float64 { return stat.Skew(s, nil) }
+	allStats["kurtosis"] = func(s []float64) float64 { return stat.ExKurtosis(s, nil) }
+
+	allStatsWeighted = map[string]struct{}{"wmean": {}, "wsum": {}}
+
 	allStats2 = make(map[string]func([]string) string)
 	allStats2["count"] = func(s []string) string { return fmt.Sprintf("%d", len(s)) }
 	allStats2["first"] = func(s []string) string { return s[0] }
 	allStats2["last"] = func(s []string) string { return s[len(s)-1] }
-	allStats2["rand"] = func(s []string) string { return s[rand.Intn(len(s))] }
+	allStats2["rand"] = func(s []string) string { return s[statsRand.Intn(len(s))] }
 	allStats2["uniq"] = func(s []string) string {
 		m := make(map[string]struct{}, len(s))
 		for _, v := range s {
@@ -461,6 +712,108 @@ func init() {
 	}
 	allStats2["countuniq"] = allStats2["countunique"]
 	allStats2["collapse"] = func(s []string) string { return strings.Join(s, separater) }
+	allStats2["mode"] = func(s []string) string {
+		m := make(map[string]int, len(s))
+		var mode string
+		var n int
+		for _, v := range s {
+			m[v]++
+			if m[v] > n { // the first one for ties
+				mode, n = v, m[v]
+			}
+		}
+		return mode
+	}
+
+	nan := math.NaN()
+
+	summaryStats = make(map[string]func(*summaryAcc) float64)
+	summaryStats["countn"] = func(a *summaryAcc) float64 { return a.n }
+	summaryStats["sum"] = func(a *summaryAcc) float64 {
+		if a.n == 0 {
+			return nan
+		}
+		return a.sum
+	}
+	summaryStats["max"] = func(a *summaryAcc) float64 { return a.max }
+	summaryStats["min"] = func(a *summaryAcc) float64 { return a.min }
+	summaryStats["argmax"] = func(a *summaryAcc) float64 {
+		if a.n == 0 {
+			return nan
+		}
+		return float64(a.argmax)
+	}
+	summaryStats["argmin"] = func(a *summaryAcc) float64 {
+		if a.n == 0 {
+			return nan
+		}
+		return float64(a.argmin)
+	}
+	summaryStats["prod"] = func(a *summaryAcc) float64 { return a.prod }
+	summaryStats["mean"] = func(a *summaryAcc) float64 { return a.sum / a.n }
+	summaryStats["stdev"] = func(a *summaryAcc) float64 { return a.stdev() }
+	summaryStats["variance"] = func(a *summaryAcc) float64 { return a.m2 / (a.n - 1) }
+	summaryStats["entropy"] = func(a *summaryAcc) float64 { return a.entropy }
+	summaryStats["median"] = func(a *summaryAcc) float64 { return a.quantile(0.5) }
+	summaryStats["q1"] = func(a *summaryAcc) float64 { return a.quantile(0.25) }
+	summaryStats["q2"] = summaryStats["median"]
+	summaryStats["q3"] = func(a *summaryAcc) float64 { return a.quantile(0.75) }
+
+	summaryStats["hmean"] = func(a *summaryAcc) float64 {
+		if a.n == 0 {
+			return nan
+		}
+		return a.n / a.sumInv
+	}
+	summaryStats["gmean"] = func(a *summaryAcc) float64 {
+		if a.n == 0 {
+			return nan
+		}
+		return math.Exp(a.sumLog / a.n)
+	}
+	// the same corrections as gonum's stat.Skew and stat.ExKurtosis
+	summaryStats["skewness"] = func(a *summaryAcc) float64 {
+		std := a.stdev()
+		return a.m3 / (std * std * std) * (a.n / (a.n - 1)) * (1 / (a.n - 2))
+	}
+	summaryStats["kurtosis"] = func(a *summaryAcc) float64 {
+		std := a.stdev()
+		n := a.n
+		mul := ((n + 1) / (n - 1)) * (n / (n - 2)) * (1 / (n - 3))
+		offset := 3 * ((n - 1) / (n - 2)) * ((n - 1) / (n - 3))
+		return a.m4/(std*std*std*std)*mul - offset
+	}
+
+	summaryStats["wmean"] = func(a *summaryAcc) float64 {
+		if a.nW == 0 {
+			return nan
+		}
+		return a.sumWX / a.sumW
+	}
+	summaryStats["wsum"] = func(a *summaryAcc) float64 {
+		if a.nW == 0 {
+			return nan
+		}
+		return a.sumWX
+	}
+
+	summaryStats2 = make(map[string]func(*summaryAcc) string)
+	summaryStats2["count"] = func(a *summaryAcc) string { return fmt.Sprintf("%d", a.count) }
+	summaryStats2["first"] = func(a *summaryAcc) string { return a.first }
+	summaryStats2["last"] = func(a *summaryAcc) string { return a.last }
+	summaryStats2["rand"] = func(a *summaryAcc) string { return a.texts[statsRand.Intn(len(a.texts))] }
+	summaryStats2["uniq"] = func(a *summaryAcc) string {
+		vs := make([]string, 0, len(a.counts))
+		for v := range a.counts {
+			vs = append(vs, v)
+		}
+		return strings.Join(vs, separater)
+	}
+	summaryStats2["unique"] = summaryStats2["uniq"]
+	summaryStats2["countunique"] = func(a *summaryAcc) string { return fmt.Sprintf("%d", len(a.counts)) }
+	summaryStats2["countuniq"] = summaryStats2["countunique"]
+	summaryStats2["collapse"] = func(a *summaryAcc) string { return strings.Join(a.texts, separater) }
+	summaryStats2["mode"] = func(a *summaryAcc) string { return a.mode }
 
 	// ---------------
 
@@ -471,6 +824,10 @@ func init() {
 	for k := range allStats2 {
 		allStatsList = append(allStatsList, k)
 	}
+	for k := range allStatsWeighted {
+		allStatsList = append(allStatsList, k)
+	}
+	allStatsList = append(allStatsList, "pN")
 	sort.Strings(allStatsList)
 
 	RootCmd.AddCommand(summaryCmd)
@@ -480,6 +837,10 @@ func init() {
 	summaryCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
 	summaryCmd.Flags().StringP("separater", "s", "; ", "separater for collapsed data")
 	summaryCmd.Flags().Int64P("rand-seed", "S", 11, `rand seed for operation "rand"`)
+	summaryCmd.Flags().StringP("weight-field", "", "", `field of weights for weighted operations, e.g., wmean and wsum`)
+	summaryCmd.Flags().BoolP("approx-quantiles", "a", false, `estimate quantiles (median, q1, q2, q3 and pN) with t-digest in bounded memory, instead of keeping all values`)
+	summaryCmd.Flags().Float64P("compression", "", 200, `compression of t-digest for -a/--approx-quantiles, a larger value is more accurate but uses more memory`)
+	summaryCmd.Flags().IntP("chunk-progress", "", 0, `show progress every N rows, 0 for no progress`)
 }
 
 func median(sorted []float64) float64 {
@@ -510,5 +871,8 @@ func percentileValue(sorted []float64, percentile float64) float64 {
 
 	h := float64(l-1) * percentile
 	fh := math.Floor(h)
+	if int(fh) == l-1 {
+		return sorted[l-1]
+	}
 	return sorted[int(fh)] + (h-fh)*(sorted[int(fh)+1]-sorted[int(fh)])
 }
@@ -0,0 +1,156 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"math"
+	"sort"
+)
+
+// tDigest is a merging t-digest for estimating quantiles of a stream of numbers
+// in bounded memory (Dunning & Ertl, 2019). Centroids near the tails are kept
+// small, so extreme quantiles are more accurate than the median.
+type tDigest struct {
+	compression float64
+
+	centroids []tCentroid // sorted by mean
+	buffer    []tCentroid // unmerged values
+
+	count    float64
+	min, max float64
+}
+
+type tCentroid struct {
+	mean, weight float64
+}
+
+// newTDigest creates a t-digest, a larger compression means more centroids
+// and better accuracy. 100 is a good default.
+func newTDigest(compression float64) *tDigest {
+	if compression < 20 {
+		compression = 20
+	}
+	return &tDigest{
+		compression: compression,
+		buffer:      make([]tCentroid, 0, int(compression)*5),
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add adds a value.
+func (t *tDigest) Add(x float64) {
+	if math.IsNaN(x) {
+		return
+	}
+	t.buffer = append(t.buffer, tCentroid{x, 1})
+	t.count++
+	if x < t.min {
+		t.min = x
+	}
+	if x > t.max {
+		t.max = x
+	}
+	if len(t.buffer) == cap(t.buffer) {
+		t.compress()
+	}
+}
+
+// Count returns the number of added values.
+func (t *tDigest) Count() float64 {
+	return t.count
+}
+
+// k1 scale function
+func (t *tDigest) k(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// compress merges buffered values into centroids.
+func (t *tDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.buffer, t.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]tCentroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	var sofar float64 // weight of merged centroids before cur
+	kLeft := t.k(0)
+	for _, c := range all[1:] {
+		if t.k((sofar+cur.weight+c.weight)/t.count)-kLeft <= 1 {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		sofar += cur.weight
+		kLeft = t.k(sofar / t.count)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	t.centroids = merged
+	t.buffer = t.buffer[:0]
+}
+
+// Quantile returns the estimated q-quantile, q in [0, 1]. Positions between
+// centroids are interpolated the same way as R's quantile (type=7), so the
+// result is exact when all centroids are single values.
+func (t *tDigest) Quantile(q float64) float64 {
+	t.compress()
+	n := len(t.centroids)
+	if n == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	if q == 0 {
+		return t.min
+	}
+	if q == 1 {
+		return t.max
+	}
+
+	// centroid i covers ranks [cum, cum+weight), and its mean sits in the center
+	index := q*(t.count-1) + 0.5
+
+	first := t.centroids[0]
+	if index < first.weight/2 {
+		return t.min + (first.mean-t.min)*index/(first.weight/2)
+	}
+
+	var cum float64
+	var left, right float64
+	for i := 0; i < n-1; i++ {
+		left = cum + t.centroids[i].weight/2
+		right = cum + t.centroids[i].weight + t.centroids[i+1].weight/2
+		if index < right {
+			return t.centroids[i].mean + (t.centroids[i+1].mean-t.centroids[i].mean)*(index-left)/(right-left)
+		}
+		cum += t.centroids[i].weight
+	}
+
+	last := t.centroids[n-1]
+	left = t.count - last.weight/2
+	if index <= left {
+		return last.mean
+	}
+	return last.mean + (t.max-last.mean)*(index-left)/(last.weight/2)
+}
@@ -0,0 +1,211 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// templateCmd represents the template command
+var templateCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:     "template",
+	Aliases: []string{"render"},
+	Short:   "render each row with a Go text/template",
+	Long: `render each row with a Go text/template
+
+Each row is rendered with a template (-s/--template) or a template file
+(-S/--template-file), see https://pkg.go.dev/text/template.
+A newline is appended to the output of each row unless -n/--no-newline
+is given.
+
+Values are accessed by column names, e.g., {{.name}}, or
+{{index . "column name"}} for names with special characters, or c1, c2, ...
+with -H/--no-header-row.
+
+Extra functions:
+
+  row                the row number, header row skipped
+  lower, upper       case conversion
+  title              capitalize the first letter of each word
+  trim               trim leading and trailing spaces
+  replace OLD NEW S  replace all OLD in S with NEW
+  default DEF S      DEF if S is empty, otherwise S
+  sqlquote           SQL string literal, e.g., 'O''Brien'
+  shellquote         shell-safe string, e.g., 'it'\''s'
+  json               JSON string, e.g., "a\"b"
+
+Examples:
+
+    csvtk template -s "INSERT INTO users VALUES ({{.id}}, {{sqlquote .name}});" \
+        --head "BEGIN;" --tail "COMMIT;" users.csv
+    csvtk template -s "- [{{.title}}]({{.url}})" links.csv
+    csvtk template -s "wget -O {{shellquote .file}} {{shellquote .url}}" urls.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		tplStr := getFlagString(cmd, "template")
+		tplFile := getFlagString(cmd, "template-file")
+		if (tplStr == "") == (tplFile == "") {
+			checkError(fmt.Errorf("one and only one of -s/--template and -S/--template-file needed"))
+		}
+		if tplFile != "" {
+			data, err := os.ReadFile(tplFile)
+			checkError(err)
+			tplStr = string(data)
+		}
+		noNewline := getFlagBool(cmd, "no-newline")
+		head := getFlagString(cmd, "head")
+		tail := getFlagString(cmd, "tail")
+
+		var row int
+		funcs := template.FuncMap{
+			"row":   func() int { return row },
+			"lower": strings.ToLower,
+			"upper": strings.ToUpper,
+			"title": func(s string) string {
+				words := strings.Fields(s)
+				for i, w := range words {
+					r := []rune(w)
+					words[i] = strings.ToUpper(string(r[0])) + string(r[1:])
+				}
+				return strings.Join(words, " ")
+			},
+			"trim":    strings.TrimSpace,
+			"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+			"default": func(def, s string) string {
+				if s == "" {
+					return def
+				}
+				return s
+			},
+			"sqlquote":   func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" },
+			"shellquote": func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" },
+			"json": func(s string) string {
+				data, _ := json.Marshal(s)
+				return string(data)
+			},
+		}
+		tpl, err := template.New("row").Funcs(funcs).Option("missingkey=error").Parse(tplStr)
+		if err != nil {
+			checkError(fmt.Errorf("failed to parse template: %s", err))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		w := bufio.NewWriter(outfh)
+		defer func() {
+			checkError(w.Flush())
+		}()
+
+		if head != "" {
+			w.WriteString(head + "\n")
+		}
+
+		var names []string
+		values := make(map[string]string, 64)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk template: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					names = make([]string, len(record.All))
+					for i := range names {
+						if config.NoHeaderRow {
+							names[i] = "c" + strconv.Itoa(i+1)
+						} else {
+							names[i] = record.All[i]
+						}
+					}
+
+					if !config.NoHeaderRow {
+						continue
+					}
+				}
+
+				row++
+				clear(values)
+				for i, v := range record.All {
+					values[names[i]] = v
+				}
+				if err = tpl.Execute(w, values); err != nil {
+					checkError(fmt.Errorf("[line %d] %s", record.Line, err))
+				}
+				if !noNewline {
+					w.WriteByte('\n')
+				}
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+
+		if tail != "" {
+			w.WriteString(tail + "\n")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(templateCmd)
+
+	templateCmd.Flags().StringP("template", "s", "", `template for each row, e.g., "{{.id}}: {{upper .name}}"`)
+	templateCmd.Flags().StringP("template-file", "S", "", `file of the template`)
+	templateCmd.Flags().BoolP("no-newline", "n", false, `do not append a newline to the output of each row`)
+	templateCmd.Flags().StringP("head", "", "", `text to output before all rows`)
+	templateCmd.Flags().StringP("tail", "", "", `text to output after all rows`)
+}
@@ -0,0 +1,414 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// tokenizeCmd represents the tokenize command
+var tokenizeCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:     "tokenize",
+	Aliases: []string{"text-stats"},
+	Short:   "text statistics of a field: word/character counts, n-grams and languages",
+	Long: `text statistics of a field: word/character counts, n-grams and languages
+
+Words are sequences of letters, digits and inner apostrophes, and each
+CJK character is treated as a word. Words are converted to lower case
+unless --keep-case is given.
+
+Modes:
+  1. Per-cell statistics (default): columns of the number of characters
+     and words are appended, with the suffixes "_chars" and "_words",
+     and a column of the detected language with -L/--lang (suffix "_lang").
+  2. Term frequencies (-q/--freq): n-grams (-n/--ngram) and their counts
+     are outputted, sorted by counts in descending order, for all records
+     or each group (-g/--groups), optionally limited to the top K (-k/--top).
+
+Language detection is rule-based and only for quick triage: scripts
+like Han, Hiragana/Katakana, Hangul, Cyrillic, Arabic, Greek, Hebrew,
+Devanagari and Thai, and stop words for Latin-script languages
+en, es, fr, de, it, pt and nl. "und" is reported for undetermined text.
+
+Examples:
+
+    csvtk tokenize -f comment -L survey.csv
+    csvtk tokenize -f comment -q -n 2 -k 20 -S survey.csv
+    csvtk tokenize -f comment -q -g region -k 10 survey.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		fieldStr := getFlagString(cmd, "field")
+		if fieldStr == "" {
+			checkError(fmt.Errorf("flag -f (--field) needed"))
+		}
+		freqMode := getFlagBool(cmd, "freq")
+		ngram := getFlagPositiveInt(cmd, "ngram")
+		top := getFlagNonNegativeInt(cmd, "top")
+		groupsStr := getFlagString(cmd, "groups")
+		lang := getFlagBool(cmd, "lang")
+		keepCase := getFlagBool(cmd, "keep-case")
+		removeStopWords := getFlagBool(cmd, "stop-words")
+		minLen := getFlagNonNegativeInt(cmd, "min-length")
+		if groupsStr != "" && !freqMode {
+			checkError(fmt.Errorf("flag -g/--groups only works with -q/--freq"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		var field int
+		var groupFields []int
+		var groupNames []string
+		counts := make(map[string]map[string]int, 8) // group -> ngram -> count
+		groups := make([]string, 0, 8)               // groups in order of appearance
+		groupKey := make([]string, 0, 8)
+		var group string
+		var m map[string]int
+		var ok bool
+
+		printHeaderRow := true
+		items := make([]string, 0, 64)
+		for _, file := range files {
+			csvReader, err := newCSVReaderByConfig(config, file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk tokenize: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			csvReader.Read(ReadOption{
+				FieldStr: "1-",
+			})
+
+			checkFirstLine := true
+			for record := range csvReader.Ch {
+				if record.Err != nil {
+					checkError(record.Err)
+				}
+
+				if checkFirstLine {
+					checkFirstLine = false
+
+					header := record.All
+					if config.NoHeaderRow {
+						header = make([]string, len(record.All))
+					}
+					fields := selectFieldsByHeader(header, fieldStr, false)
+					if len(fields) != 1 {
+						checkError(fmt.Errorf("only one field allowed: %s", fieldStr))
+					}
+					field = fields[0]
+					if groupsStr != "" {
+						groupFields = selectFieldsByHeader(header, groupsStr, false)
+						groupNames = make([]string, len(groupFields))
+						for i, f := range groupFields {
+							if config.NoHeaderRow {
+								groupNames[i] = strconv.Itoa(f)
+							} else {
+								groupNames[i] = header[f-1]
+							}
+						}
+					}
+
+					if printHeaderRow && !freqMode && !config.NoOutHeader {
+						name := strconv.Itoa(field)
+						if !config.NoHeaderRow {
+							name = header[field-1]
+						}
+						items = append(items[:0], header...)
+						if config.NoHeaderRow {
+							items = items[:0]
+							for i := range header {
+								items = append(items, strconv.Itoa(i+1))
+							}
+						}
+						items = append(items, name+"_chars", name+"_words")
+						if lang {
+							items = append(items, name+"_lang")
+						}
+						checkError(writer.Write(items))
+					}
+					printHeaderRow = false
+
+					if !config.NoHeaderRow {
+						continue
+					}
+				}
+
+				words := textTokenize(record.All[field-1], !keepCase)
+
+				if !freqMode {
+					items = append(items[:0], record.All...)
+					items = append(items,
+						strconv.Itoa(len([]rune(record.All[field-1]))),
+						strconv.Itoa(len(words)))
+					if lang {
+						items = append(items, detectLanguage(record.All[field-1], words))
+					}
+					checkError(writer.Write(items))
+					continue
+				}
+
+				groupKey = groupKey[:0]
+				for _, f := range groupFields {
+					groupKey = append(groupKey, record.All[f-1])
+				}
+				group = strings.Join(groupKey, "_shenwei356_")
+				if m, ok = counts[group]; !ok {
+					m = make(map[string]int, 1024)
+					counts[group] = m
+					groups = append(groups, group)
+				}
+
+				if removeStopWords || minLen > 0 {
+					words2 := words[:0]
+					for _, w := range words {
+						if removeStopWords {
+							if _, ok = stopWords["en"][strings.ToLower(w)]; ok {
+								continue
+							}
+						}
+						if len([]rune(w)) < minLen {
+							continue
+						}
+						words2 = append(words2, w)
+					}
+					words = words2
+				}
+				for i := 0; i+ngram <= len(words); i++ {
+					m[strings.Join(words[i:i+ngram], " ")]++
+				}
+			}
+
+			readerReport(&config, csvReader, file)
+		}
+
+		if !freqMode {
+			return
+		}
+
+		if !config.NoOutHeader {
+			items = append(items[:0], groupNames...)
+			items = append(items, "ngram", "count")
+			checkError(writer.Write(items))
+		}
+		for _, group = range groups {
+			var groupValues []string
+			if len(groupFields) > 0 {
+				groupValues = strings.Split(group, "_shenwei356_")
+			}
+			terms := make([]string, 0, len(counts[group]))
+			for t := range counts[group] {
+				terms = append(terms, t)
+			}
+			m = counts[group]
+			sort.Slice(terms, func(i, j int) bool {
+				if m[terms[i]] == m[terms[j]] {
+					return terms[i] < terms[j]
+				}
+				return m[terms[i]] > m[terms[j]]
+			})
+			if top > 0 && len(terms) > top {
+				terms = terms[:top]
+			}
+			for _, t := range terms {
+				items = append(items[:0], groupValues...)
+				items = append(items, t, strconv.Itoa(m[t]))
+				checkError(writer.Write(items))
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(tokenizeCmd)
+
+	tokenizeCmd.Flags().StringP("field", "f", "", `the text field. e.g -f 1 or -f comment`)
+	tokenizeCmd.Flags().BoolP("lang", "L", false, `append a column of detected languages`)
+	tokenizeCmd.Flags().BoolP("freq", "q", false, `output n-gram frequencies instead of per-cell statistics`)
+	tokenizeCmd.Flags().IntP("ngram", "n", 1, `n of n-grams for -q/--freq`)
+	tokenizeCmd.Flags().IntP("top", "k", 0, `only output the top K n-grams (of each group) for -q/--freq, 0 for all`)
+	tokenizeCmd.Flags().StringP("groups", "g", "", `group via fields for -q/--freq. e.g -g 1,2 or -g columnA,columnB`)
+	tokenizeCmd.Flags().BoolP("stop-words", "S", false, `remove English stop words for -q/--freq`)
+	tokenizeCmd.Flags().IntP("min-length", "m", 0, `minimum length of words for -q/--freq`)
+	tokenizeCmd.Flags().BoolP("keep-case", "", false, `do not convert words to lower case`)
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// textTokenize splits text into words.
+func textTokenize(text string, lower bool) []string {
+	if lower {
+		text = strings.ToLower(text)
+	}
+	words := make([]string, 0, 16)
+	runes := []rune(text)
+	start := -1
+	for i, r := range runes {
+		if isCJK(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			words = append(words, string(r))
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) ||
+			((r == '\'' || r == '’') && start >= 0 && i+1 < len(runes) && unicode.IsLetter(runes[i+1])) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, string(runes[start:i]))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+var langScripts = []struct {
+	lang   string
+	tables []*unicode.RangeTable
+}{
+	{"ja", []*unicode.RangeTable{unicode.Hiragana, unicode.Katakana}},
+	{"ko", []*unicode.RangeTable{unicode.Hangul}},
+	{"zh", []*unicode.RangeTable{unicode.Han}},
+	{"ru", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"ar", []*unicode.RangeTable{unicode.Arabic}},
+	{"el", []*unicode.RangeTable{unicode.Greek}},
+	{"he", []*unicode.RangeTable{unicode.Hebrew}},
+	{"hi", []*unicode.RangeTable{unicode.Devanagari}},
+	{"th", []*unicode.RangeTable{unicode.Thai}},
+}
+
+// detectLanguage guesses the language of text by scripts and stop words.
+func detectLanguage(text string, words []string) string {
+	scripts := make(map[string]int, 4)
+	var nLetters int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		nLetters++
+		for _, s := range langScripts {
+			if unicode.In(r, s.tables...) {
+				scripts[s.lang]++
+				break
+			}
+		}
+	}
+	if nLetters == 0 {
+		return "und"
+	}
+	// Japanese text often contains Han characters
+	if scripts["ja"] > 0 && scripts["ja"]*5 >= scripts["ja"]+scripts["zh"] {
+		return "ja"
+	}
+	best, bestN := "", 0
+	for _, s := range langScripts {
+		if scripts[s.lang] > bestN {
+			best, bestN = s.lang, scripts[s.lang]
+		}
+	}
+	if bestN*2 >= nLetters {
+		return best
+	}
+
+	// Latin scripts
+	best, bestN = "und", 0
+	for _, l := range stopWordLangs {
+		var n int
+		for _, w := range words {
+			if _, ok := stopWords[l][strings.ToLower(w)]; ok {
+				n++
+			}
+		}
+		if n > bestN {
+			best, bestN = l, n
+		}
+	}
+	return best
+}
+
+var stopWordLangs = []string{"en", "es", "fr", "de", "it", "pt", "nl"}
+
+var stopWords = func() map[string]map[string]struct{} {
+	lists := map[string]string{
+		"en": "a about above after again against all am an and any are as at be because been before being below between both but by can could did do does doing down during each few for from further had has have having he her here hers herself him himself his how i if in into is it its itself just me more most my myself no nor not now of off on once only or other our ours ourselves out over own same she should so some such than that the their theirs them themselves then there these they this those through to too under until up very was we were what when where which while who whom why will with would you your yours yourself yourselves",
+		"es": "a al algo como con de del el ella ellos en entre era es esta este esto estos fue ha hay la las le les lo los me mi muy más no nos o para pero por que qué se sin sobre son su sus también te tiene todo un una uno y ya yo",
+		"fr": "à au aux avec ce ces cette dans de des du elle en est et eux il ils je la le les leur lui ma mais me mes moi mon ne nos notre nous on ou où par pas pour qu que qui sa se ses son sont sur ta te tes toi ton tu un une vos votre vous y",
+		"de": "aber als am an auch auf aus bei bin bis das dass dem den der des die doch du ein eine einem einen einer es für hat ich ihr im in ist ja mit nach nicht noch nur oder sich sie sind so und uns von vor war was wie wir zu zum zur über",
+		"it": "a al alla anche che chi con da dei del della di e gli ha ho il in io la le lo ma mi non nel per più questo se si sono su tu un una uno è",
+		"pt": "a ao aos as com como da das de do dos e ela ele eles em entre era essa esse está eu foi isso já mais mas me muito na nas no nos não o os ou para pela pelo por que se sem seu sua são também um uma você é",
+		"nl": "aan al als bij dan dat de die dit door een en er het hij hoe ik in is je maar met mij niet nog of om ook op te tot uit van voor was wat we wel wij ze zich zij zijn",
+	}
+	m := make(map[string]map[string]struct{}, len(lists))
+	for l, s := range lists {
+		m[l] = make(map[string]struct{}, 256)
+		for _, w := range strings.Fields(s) {
+			m[l][w] = struct{}{}
+		}
+	}
+	return m
+}()
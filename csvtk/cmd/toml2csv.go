@@ -0,0 +1,199 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// toml2csvCmd represents the toml2csv command
+var toml2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "toml2csv",
+	Short: "convert TOML to CSV format",
+	Long: `convert TOML to CSV format
+
+Input is an array of tables, e.g.,
+
+    [[records]]
+    name = "A"
+    score = 95
+
+The name of the array is given by -k/--key, and the first array
+of tables is used by default.
+
+Columns are keys in the order of first appearance in all tables.
+Nested values (tables and arrays) are outputted in JSON format,
+and missing keys are outputted as empty strings, or the value of --na.
+
+This is the reverse operation of "csvtk csv2toml".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		key := getFlagString(cmd, "key")
+		na := getFlagString(cmd, "na")
+
+		records := make([]map[string]interface{}, 0, 1024)
+		keys := make([]string, 0, 8)
+		keysMap := make(map[string]struct{})
+		for _, file := range files {
+			fh, err := ropen(file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk toml2csv: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+			data, err := io.ReadAll(fh)
+			checkError(err)
+			checkError(fh.Close())
+
+			var doc map[string]interface{}
+			md, err := toml.Decode(string(data), &doc)
+			if err != nil {
+				checkError(fmt.Errorf("%s: %s", file, err))
+			}
+
+			// the array of tables
+			_key := key
+			if _key == "" {
+				for _, k := range md.Keys() {
+					if len(k) == 1 && md.Type(k[0]) == "ArrayHash" {
+						_key = k[0]
+						break
+					}
+				}
+				if _key == "" {
+					checkError(fmt.Errorf("%s: no array of tables found", file))
+				}
+			}
+			tables, ok := doc[_key].([]map[string]interface{})
+			if !ok {
+				checkError(fmt.Errorf("%s: array of tables not found: %s", file, _key))
+			}
+
+			// keys in order of appearance
+			for _, k := range md.Keys() {
+				if len(k) != 2 || k[0] != _key {
+					continue
+				}
+				if _, ok = keysMap[k[1]]; !ok {
+					keysMap[k[1]] = struct{}{}
+					keys = append(keys, k[1])
+				}
+			}
+			records = append(records, tables...)
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if len(keys) == 0 {
+			return
+		}
+		if !config.NoOutHeader {
+			checkError(writer.Write(keys))
+		}
+		row := make([]string, len(keys))
+		for _, record := range records {
+			for i, k := range keys {
+				v, ok := record[k]
+				if !ok {
+					row[i] = na
+					continue
+				}
+				row[i], err = tomlValue2String(v)
+				checkError(err)
+			}
+			checkError(writer.Write(row))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(toml2csvCmd)
+	toml2csvCmd.Flags().StringP("key", "k", "", "name of the array of tables (default: the first one)")
+	toml2csvCmd.Flags().StringP("na", "", "", "string for missing keys")
+}
+
+// tomlValue2String converts a TOML value to a string,
+// nested values are outputted in JSON format.
+func tomlValue2String(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		// local date-times, dates and times have special zone names
+		switch name, _ := v.Zone(); name {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999"), nil
+		case "date-local":
+			return v.Format("2006-01-02"), nil
+		case "time-local":
+			return v.Format("15:04:05.999999999"), nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,199 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"container/heap"
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	GroupID: "order",
+
+	Use:   "top",
+	Short: "select the top N rows by keys without sorting all",
+	Long: `select the top N rows by keys without sorting all
+
+The top N rows, i.e., the first N rows if all rows are sorted by the keys
+with "csvtk sort", are selected in a single pass with a bounded heap,
+so only N rows are kept in memory. Rows with the same keys keep their
+input order, and the output is sorted by the keys.
+
+Sort types of keys are the same as "csvtk sort" except the user-defined
+order, e.g., "-k score:nr" for the N rows with the highest scores.
+
+Examples:
+
+    csvtk top -n 100 -k score:nr data.csv
+    csvtk top -n 10 -k chr:N -k pos:n variants.tsv -t
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		n := getFlagPositiveInt(cmd, "number")
+		keys := getFlagStringSlice(cmd, "keys")
+		if len(keys) == 0 {
+			checkError(fmt.Errorf("flag -k (--keys) needed"))
+		}
+		ignoreCase := getFlagBool(cmd, "ignore-case")
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk top: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+
+			DoNotAllowDuplicatedColumnName: true,
+		})
+
+		var headerRow []string
+		h := &topHeap{rows: make([]topRow, 0, n)}
+		var i int
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header := record.All
+				if !config.NoHeaderRow || record.IsHeaderRow {
+					headerRow = record.All
+				} else {
+					header = make([]string, len(record.All))
+					for j := range header {
+						header[j] = fmt.Sprintf("c%d", j+1)
+					}
+				}
+				h.sortTypes = parseMergeSortKeys(header, keys, ignoreCase)
+
+				if headerRow != nil {
+					continue
+				}
+			}
+
+			i++
+			row := topRow{idx: i, record: record.All}
+			if h.Len() < n {
+				heap.Push(h, row)
+			} else if h.compare(row, h.rows[0]) < 0 { // better than the worst one
+				h.rows[0] = row
+				heap.Fix(h, 0)
+			}
+		}
+		readerReport(&config, csvReader, file)
+
+		rows := h.rows
+		sort.Slice(rows, func(i, j int) bool { return h.compare(rows[i], rows[j]) < 0 })
+
+		if headerRow != nil && !config.NoOutHeader {
+			checkError(writer.Write(headerRow))
+		}
+		for _, row := range rows {
+			checkError(writer.Write(row.record))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(topCmd)
+	topCmd.Flags().IntP("number", "n", 10, `number of rows to select`)
+	topCmd.Flags().StringSliceP("keys", "k", []string{}, `keys (multiple values supported), with sort types the same as "csvtk sort", e.g., "-k score:nr" or "-k chr:N -k pos:n"`)
+	topCmd.Flags().BoolP("ignore-case", "i", false, "ignore-case")
+}
+
+type topRow struct {
+	idx    int // input order
+	record []string
+}
+
+// topHeap is a heap with the worst row at the root.
+type topHeap struct {
+	rows      []topRow
+	sortTypes []sortType
+}
+
+// compare compares rows by keys and then the input order.
+func (h *topHeap) compare(a, b topRow) int {
+	if v := compareBySortTypes(h.sortTypes, a.record, b.record); v != 0 {
+		return v
+	}
+	if a.idx < b.idx {
+		return -1
+	}
+	if a.idx > b.idx {
+		return 1
+	}
+	return 0
+}
+
+func (h *topHeap) Len() int           { return len(h.rows) }
+func (h *topHeap) Less(i, j int) bool { return h.compare(h.rows[i], h.rows[j]) > 0 }
+func (h *topHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *topHeap) Push(x interface{}) { h.rows = append(h.rows, x.(topRow)) }
+func (h *topHeap) Pop() interface{} {
+	old := h.rows
+	n := len(old)
+	x := old[n-1]
+	h.rows = old[0 : n-1]
+	return x
+}
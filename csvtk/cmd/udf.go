@@ -0,0 +1,113 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"go.starlark.net/starlark"
+)
+
+// loadStarlarkUDFs loads user-defined functions from Starlark files.
+// Top-level functions not starting with "_" are available in expressions,
+// with numbers, strings, booleans and None converted in both directions.
+func loadStarlarkUDFs(files []string) (map[string]govaluate.ExpressionFunction, error) {
+	functions := make(map[string]govaluate.ExpressionFunction)
+	for _, file := range files {
+		thread := &starlark.Thread{Name: file}
+		globals, err := starlark.ExecFileOptions(starlarkFileOptions, thread, file, nil, nil)
+		if err != nil {
+			if e, ok := err.(*starlark.EvalError); ok {
+				return nil, fmt.Errorf("failed to load UDF file: %s", e.Backtrace())
+			}
+			return nil, fmt.Errorf("failed to load UDF file: %s", err)
+		}
+
+		names := make([]string, 0, len(globals))
+		for name := range globals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fn, ok := globals[name].(*starlark.Function)
+			if !ok || strings.HasPrefix(name, "_") {
+				continue
+			}
+			if _, ok = functions[name]; ok {
+				return nil, fmt.Errorf("duplicated UDF: %s", name)
+			}
+			functions[name] = starlarkExpressionFunction(file, fn)
+		}
+	}
+	return functions, nil
+}
+
+func starlarkExpressionFunction(file string, fn *starlark.Function) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		params := make(starlark.Tuple, len(args))
+		for i, arg := range args {
+			switch v := arg.(type) {
+			case nil:
+				params[i] = starlark.None
+			case bool:
+				params[i] = starlark.Bool(v)
+			case string:
+				params[i] = starlark.String(v)
+			case float64:
+				if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+					params[i] = starlark.MakeInt64(int64(v))
+				} else {
+					params[i] = starlark.Float(v)
+				}
+			default:
+				params[i] = starlark.String(fmt.Sprintf("%v", v))
+			}
+		}
+
+		thread := &starlark.Thread{Name: file}
+		result, err := starlark.Call(thread, fn, params, nil)
+		if err != nil {
+			if e, ok := err.(*starlark.EvalError); ok {
+				return nil, fmt.Errorf("%s", e.Backtrace())
+			}
+			return nil, err
+		}
+
+		switch v := result.(type) {
+		case starlark.NoneType:
+			return nil, nil
+		case starlark.Bool:
+			return bool(v), nil
+		case starlark.String:
+			return string(v), nil
+		case starlark.Int:
+			f, _ := starlark.AsFloat(v)
+			return f, nil
+		case starlark.Float:
+			return float64(v), nil
+		}
+		return nil, fmt.Errorf("unsupported type of value returned by %s(): %s", fn.Name(), result.Type())
+	}
+}
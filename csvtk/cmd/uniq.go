@@ -21,11 +21,14 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
+	"io"
+	"math"
 	"runtime"
+	"strconv"
 	"strings"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 )
@@ -38,6 +41,20 @@ var uniqCmd = &cobra.Command{
 	Short: "unique data without sorting",
 	Long: `unique data without sorting
 
+All keys are kept in memory by default. For huge files, there are two
+other modes:
+
+  --approx          Keys are stored in a Bloom filter with a bounded
+                    memory, decided by the expected number of keys
+                    (--expected-keys) and the false positive rate
+                    (--fp-rate). A small fraction of unique records
+                    might be removed as false positives.
+                    Only -n/--keep-n 1 is supported.
+  --spill-to-disk   Records are deduplicated exactly with the memory
+                    bounded by --buffer-size, using temporary files in
+                    --temp-dir. Records are output in the input order
+                    after all records are read.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -57,11 +74,39 @@ var uniqCmd = &cobra.Command{
 		ignoreCase := getFlagBool(cmd, "ignore-case")
 		keepN := getFlagPositiveInt(cmd, "keep-n")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		approx := getFlagBool(cmd, "approx")
+		spill := getFlagBool(cmd, "spill-to-disk")
+		if approx && spill {
+			checkError(fmt.Errorf("flag --approx and --spill-to-disk are incompatible"))
+		}
+		var bloom *bloomFilter
+		if approx {
+			if keepN != 1 {
+				checkError(fmt.Errorf("flag -n/--keep-n should be 1 when using --approx"))
+			}
+			fpRate := getFlagFloat64(cmd, "fp-rate")
+			if fpRate <= 0 || fpRate >= 1 {
+				checkError(fmt.Errorf("value of flag --fp-rate should be in range of (0, 1)"))
+			}
+			bloom = newBloomFilter(getFlagPositiveInt(cmd, "expected-keys"), fpRate)
+		}
+		var sorter *RecordSorter
+		if spill {
+			bufferSize, err := ParseByteSize(getFlagString(cmd, "buffer-size"))
+			checkError(err)
+			if bufferSize <= 0 {
+				checkError(fmt.Errorf("value of flag --buffer-size should be greater than 0"))
+			}
+			// records sorted by keys, with the input order kept for records with the same keys
+			sorter = NewRecordSorter(getFlagString(cmd, "temp-dir"), bufferSize, nil)
+			sorter.SetThreads(config.NumCPUs)
+		}
+
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -105,6 +150,7 @@ var uniqCmd = &cobra.Command{
 		var key string
 		var n int
 		var ok bool
+		var i int
 
 		checkFirstLine := true
 		for record := range csvReader.Ch {
@@ -128,6 +174,20 @@ var uniqCmd = &cobra.Command{
 			if ignoreCase {
 				key = strings.ToLower(key)
 			}
+
+			if approx {
+				if bloom.testAndAdd(key) {
+					continue
+				}
+				checkError(writer.Write(record.All))
+				continue
+			}
+			if spill {
+				i++
+				checkError(sorter.Add(&KeyedRecord{Key: key, Record: append([]string{strconv.Itoa(i)}, record.All...)}))
+				continue
+			}
+
 			if n, ok = keysMaps[key]; ok {
 				if n >= keepN {
 					continue
@@ -140,6 +200,10 @@ var uniqCmd = &cobra.Command{
 		}
 
 		readerReport(&config, csvReader, file)
+
+		if spill {
+			checkError(uniqSpilled(sorter, keepN, writer))
+		}
 	},
 }
 
@@ -149,5 +213,106 @@ func init() {
 	uniqCmd.Flags().BoolP("ignore-case", "i", false, `ignore case`)
 	uniqCmd.Flags().BoolP("fuzzy-fields", "F", false, `using fuzzy fields, e.g., -F -f "*name" or -F -f "id123*"`)
 	uniqCmd.Flags().IntP("keep-n", "n", 1, `keep at most N records for a key`)
+	uniqCmd.Flags().BoolP("approx", "", false, `deduplicate approximately with a Bloom filter, using bounded memory`)
+	uniqCmd.Flags().IntP("expected-keys", "", 10000000, `expected number of unique keys for --approx`)
+	uniqCmd.Flags().Float64P("fp-rate", "", 0.001, `false positive rate of the Bloom filter for --approx`)
+	uniqCmd.Flags().BoolP("spill-to-disk", "", false, `deduplicate exactly with bounded memory, using temporary files`)
+	uniqCmd.Flags().StringP("buffer-size", "", "256M", `size of records kept in memory before spilling to disk for --spill-to-disk, supported units: K, M, G`)
+	uniqCmd.Flags().StringP("temp-dir", "", "", `directory of temporary files for --spill-to-disk, default: the system temporary directory`)
+
+}
+
+// uniqSpilled keeps at most keepN records for each key from records sorted
+// by keys, and writes them in the input order, which is saved in the first
+// column of records.
+func uniqSpilled(sorter *RecordSorter, keepN int, writer *csvWriter) error {
+	defer sorter.Close()
+	records, err := sorter.Sort()
+	if err != nil {
+		return err
+	}
 
+	// kept records sorted by the input order
+	sorter2 := NewRecordSorter(sorter.tmpDir, sorter.bufSize, nil)
+	sorter2.SetThreads(sorter.threads)
+	defer sorter2.Close()
+
+	var r *KeyedRecord
+	var pre string
+	var n int
+	for {
+		r, err = records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if n > 0 && r.Key == pre {
+			if n >= keepN {
+				continue
+			}
+			n++
+		} else {
+			pre, n = r.Key, 1
+		}
+		i, _ := strconv.Atoi(r.Record[0])
+		if err = sorter2.Add(&KeyedRecord{Key: fmt.Sprintf("%016x", i), Record: r.Record[1:]}); err != nil {
+			return err
+		}
+	}
+
+	records, err = sorter2.Sort()
+	if err != nil {
+		return err
+	}
+	for {
+		r, err = records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = writer.Write(r.Record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bloomFilter is a Bloom filter of strings.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint64 // number of hash functions
+}
+
+// newBloomFilter creates a Bloom filter for n keys with a false positive rate of p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// testAndAdd adds a key and returns whether it might have been added before.
+func (b *bloomFilter) testAndAdd(key string) bool {
+	h1 := xxhash.Sum64String(key)
+	h2 := (h1>>32 | h1<<32) | 1 // double hashing
+	found := true
+	var i, j uint64
+	for i = 0; i < b.k; i++ {
+		j = (h1 + i*h2) % b.m
+		if b.bits[j>>6]&(1<<(j&63)) == 0 {
+			found = false
+			b.bits[j>>6] |= 1 << (j & 63)
+		}
+	}
+	return found
 }
@@ -0,0 +1,626 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:   "validate",
+	Short: "validate CSV with a schema file (Frictionless Table Schema)",
+	Long: `validate CSV with a schema file (Frictionless Table Schema)
+
+The schema file (-s/--schema) is a Table Schema in JSON or YAML format,
+see https://specs.frictionlessdata.io/table-schema/. E.g.,
+
+    fields:
+      - name: id
+        type: integer
+        constraints: {required: true, unique: true}
+      - name: email
+        type: string
+        format: email
+      - name: score
+        type: number
+        constraints: {minimum: 0, maximum: 100}
+      - name: date
+        type: date
+        format: "%Y/%m/%d"
+      - name: group
+        type: string
+        constraints: {enum: [A, B, C], pattern: "[A-Z]"}
+    missingValues: ["", "NA"]
+    primaryKey: id
+    foreignKeys:
+      - fields: group
+        reference: {resource: groups.csv, fields: name}
+
+Supported:
+  1. Types: string (formats: email, uri, uuid), integer, number, boolean,
+     date, time, datetime (formats: default, any, or a pattern like
+     "%Y-%m-%d %H:%M:%S"), year, object, array, any.
+  2. Constraints: required, unique, pattern, minimum, maximum,
+     minLength, maxLength, enum.
+  3. Schema properties: missingValues, primaryKey, foreignKeys.
+     The resource of a foreign key is a CSV file, relative to the
+     directory of the schema file, or "" for the input file itself.
+
+Columns are matched by names, or by positions with -H/--no-header-row.
+
+Violations are reported in CSV format with columns of row (the header
+row is row 1), column, value and error. The exit code is 1 if any
+violation is found.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		schemaFile := getFlagString(cmd, "schema")
+		if schemaFile == "" {
+			checkError(fmt.Errorf("flag -s/--schema needed"))
+		}
+		maxErrors := getFlagNonNegativeInt(cmd, "max-errors")
+
+		schema, err := readTableSchema(schemaFile)
+		checkError(err)
+
+		file := files[0]
+		header, data, err := readCSVAll(config, file)
+		checkError(err)
+
+		v := &schemaValidator{schema: schema, maxErrors: maxErrors}
+		v.validate(config, schemaFile, file, header, data)
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+
+		if !config.NoOutHeader {
+			checkError(writer.Write([]string{"row", "column", "value", "error"}))
+		}
+		for _, e := range v.errors {
+			checkError(writer.Write([]string{strconv.Itoa(e.row), e.column, e.value, e.err}))
+		}
+		writer.Flush()
+		checkError(writer.Error())
+
+		if len(v.errors) > 0 {
+			if config.Verbose {
+				log.Warningf("%d violation(s) found in %s", len(v.errors), file)
+			}
+			exitCode = 1
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringP("schema", "s", "", `schema file in JSON or YAML format (Frictionless Table Schema)`)
+	validateCmd.Flags().IntP("max-errors", "m", 0, `stop after N violations, 0 for no limit`)
+}
+
+// tableSchema is a Frictionless Table Schema.
+type tableSchema struct {
+	Fields        []*schemaField      `json:"fields" yaml:"fields"`
+	MissingValues []string            `json:"missingValues" yaml:"missingValues"`
+	PrimaryKey    interface{}         `json:"primaryKey" yaml:"primaryKey"`
+	ForeignKeys   []*schemaForeignKey `json:"foreignKeys" yaml:"foreignKeys"`
+
+	missing map[string]struct{}
+}
+
+type schemaField struct {
+	Name        string            `json:"name" yaml:"name"`
+	Type        string            `json:"type" yaml:"type"`
+	Format      string            `json:"format" yaml:"format"`
+	TrueValues  []string          `json:"trueValues" yaml:"trueValues"`
+	FalseValues []string          `json:"falseValues" yaml:"falseValues"`
+	Constraints schemaConstraints `json:"constraints" yaml:"constraints"`
+
+	parse   func(string) (interface{}, bool)
+	pattern *regexp.Regexp
+	min     interface{}
+	max     interface{}
+	enum    map[string]struct{}
+}
+
+type schemaConstraints struct {
+	Required  bool          `json:"required" yaml:"required"`
+	Unique    bool          `json:"unique" yaml:"unique"`
+	Pattern   string        `json:"pattern" yaml:"pattern"`
+	Minimum   interface{}   `json:"minimum" yaml:"minimum"`
+	Maximum   interface{}   `json:"maximum" yaml:"maximum"`
+	MinLength *int          `json:"minLength" yaml:"minLength"`
+	MaxLength *int          `json:"maxLength" yaml:"maxLength"`
+	Enum      []interface{} `json:"enum" yaml:"enum"`
+}
+
+type schemaForeignKey struct {
+	Fields    interface{} `json:"fields" yaml:"fields"`
+	Reference struct {
+		Resource string      `json:"resource" yaml:"resource"`
+		Fields   interface{} `json:"fields" yaml:"fields"`
+	} `json:"reference" yaml:"reference"`
+}
+
+// readTableSchema reads a Table Schema in JSON or YAML format.
+func readTableSchema(file string) (*tableSchema, error) {
+	fh, err := ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(fh)
+	if err != nil {
+		return nil, err
+	}
+	if err = fh.Close(); err != nil {
+		return nil, err
+	}
+
+	schema := &tableSchema{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, schema)
+	} else {
+		err = yaml.Unmarshal(data, schema)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema file %s: %s", file, err)
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("no fields in schema file: %s", file)
+	}
+
+	if schema.MissingValues == nil {
+		schema.MissingValues = []string{""}
+	}
+	schema.missing = make(map[string]struct{}, len(schema.MissingValues))
+	for _, s := range schema.MissingValues {
+		schema.missing[s] = struct{}{}
+	}
+
+	for _, f := range schema.Fields {
+		if err = f.init(); err != nil {
+			return nil, fmt.Errorf("schema file %s: %s", file, err)
+		}
+	}
+	return schema, nil
+}
+
+func (f *schemaField) init() error {
+	if f.Name == "" {
+		return fmt.Errorf("field without name")
+	}
+	var err error
+	f.parse, err = schemaTypeParser(f)
+	if err != nil {
+		return fmt.Errorf("field %s: %s", f.Name, err)
+	}
+
+	c := f.Constraints
+	if c.Pattern != "" {
+		// patterns match the whole value
+		if f.pattern, err = regexp.Compile("^(?:" + c.Pattern + ")$"); err != nil {
+			return fmt.Errorf("field %s: invalid pattern: %s", f.Name, err)
+		}
+	}
+	var ok bool
+	if c.Minimum != nil {
+		if f.min, ok = f.parse(fmt.Sprint(c.Minimum)); !ok {
+			return fmt.Errorf("field %s: invalid minimum: %v", f.Name, c.Minimum)
+		}
+	}
+	if c.Maximum != nil {
+		if f.max, ok = f.parse(fmt.Sprint(c.Maximum)); !ok {
+			return fmt.Errorf("field %s: invalid maximum: %v", f.Name, c.Maximum)
+		}
+	}
+	if len(c.Enum) > 0 {
+		f.enum = make(map[string]struct{}, len(c.Enum))
+		for _, e := range c.Enum {
+			f.enum[fmt.Sprint(e)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+var reSchemaEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+var reSchemaUUID = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// schemaTypeParser returns a function checking and parsing values of a field.
+// Parsed numbers are float64, and dates and times are time.Time.
+func schemaTypeParser(f *schemaField) (func(string) (interface{}, bool), error) {
+	switch f.Type {
+	case "", "string":
+		switch f.Format {
+		case "", "default":
+			return func(s string) (interface{}, bool) { return s, true }, nil
+		case "email":
+			return func(s string) (interface{}, bool) { return s, reSchemaEmail.MatchString(s) }, nil
+		case "uri":
+			return func(s string) (interface{}, bool) {
+				u, err := url.Parse(s)
+				return s, err == nil && u.Scheme != ""
+			}, nil
+		case "uuid":
+			return func(s string) (interface{}, bool) { return s, reSchemaUUID.MatchString(s) }, nil
+		}
+		return nil, fmt.Errorf("unsupported format of string: %s", f.Format)
+	case "integer", "year":
+		return func(s string) (interface{}, bool) {
+			v, err := strconv.ParseInt(s, 10, 64)
+			if f.Type == "year" && (len(strings.TrimLeft(s, "+-")) != 4) {
+				return nil, false
+			}
+			return float64(v), err == nil
+		}, nil
+	case "number":
+		return func(s string) (interface{}, bool) {
+			v, err := strconv.ParseFloat(s, 64)
+			return v, err == nil
+		}, nil
+	case "boolean":
+		trues, falses := f.TrueValues, f.FalseValues
+		if trues == nil {
+			trues = []string{"true", "True", "TRUE", "1"}
+		}
+		if falses == nil {
+			falses = []string{"false", "False", "FALSE", "0"}
+		}
+		values := make(map[string]struct{}, len(trues)+len(falses))
+		for _, s := range append(trues, falses...) {
+			values[s] = struct{}{}
+		}
+		return func(s string) (interface{}, bool) {
+			_, ok := values[s]
+			return s, ok
+		}, nil
+	case "date", "time", "datetime":
+		var layouts []string
+		switch f.Format {
+		case "", "default":
+			layouts = map[string][]string{
+				"date":     {"2006-01-02"},
+				"time":     {"15:04:05"},
+				"datetime": {time.RFC3339Nano, "2006-01-02T15:04:05"},
+			}[f.Type]
+		case "any":
+			layouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05",
+				"2006-01-02", "2006/01/02", "01/02/2006", "02 Jan 2006", "Jan 2, 2006",
+				"15:04:05", "15:04"}
+		default:
+			layouts = []string{strftime2layout(f.Format)}
+		}
+		return func(s string) (interface{}, bool) {
+			for _, layout := range layouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, true
+				}
+			}
+			return nil, false
+		}, nil
+	case "object", "array":
+		return func(s string) (interface{}, bool) {
+			var v interface{}
+			if json.Unmarshal([]byte(s), &v) != nil {
+				return nil, false
+			}
+			if f.Type == "object" {
+				_, ok := v.(map[string]interface{})
+				return s, ok
+			}
+			_, ok := v.([]interface{})
+			return s, ok
+		}, nil
+	case "any":
+		return func(s string) (interface{}, bool) { return s, true }, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %s", f.Type)
+}
+
+// strftime2layout converts a strftime pattern like "%Y-%m-%d" to a layout of Go.
+func strftime2layout(format string) string {
+	return strings.NewReplacer(
+		"%Y", "2006", "%y", "06", "%m", "01", "%d", "02", "%e", "_2",
+		"%b", "Jan", "%B", "January", "%a", "Mon", "%A", "Monday",
+		"%H", "15", "%I", "03", "%M", "04", "%S", "05", "%p", "PM",
+		"%f", "000000", "%z", "-0700", "%Z", "MST", "%%", "%",
+	).Replace(format)
+}
+
+// schemaList converts a string or a list of strings.
+func schemaList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, e := range v {
+			list[i] = fmt.Sprint(e)
+		}
+		return list
+	}
+	return nil
+}
+
+type schemaError struct {
+	row    int
+	column string
+	value  string
+	err    string
+}
+
+type schemaValidator struct {
+	schema    *tableSchema
+	maxErrors int
+	errors    []schemaError
+}
+
+func (v *schemaValidator) addError(row int, column, value, format string, args ...interface{}) {
+	if v.maxErrors > 0 && len(v.errors) >= v.maxErrors {
+		return
+	}
+	v.errors = append(v.errors, schemaError{row, column, value, fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) validate(config Config, schemaFile string, file string, header []string, data [][]string) {
+	schema := v.schema
+
+	// columns of fields
+	cols := make([]int, len(schema.Fields)) // -1 for missing
+	colsByName := make(map[string]int, len(header))
+	if config.NoHeaderRow {
+		for i, f := range schema.Fields {
+			cols[i] = i
+			if i >= len(header) {
+				cols[i] = -1
+				v.addError(0, f.Name, "", "missing column")
+			}
+			colsByName[f.Name] = cols[i]
+		}
+	} else {
+		for i, c := range header {
+			colsByName[c] = i
+		}
+		fieldNames := make(map[string]struct{}, len(schema.Fields))
+		for i, f := range schema.Fields {
+			fieldNames[f.Name] = struct{}{}
+			var ok bool
+			if cols[i], ok = colsByName[f.Name]; !ok {
+				cols[i] = -1
+				v.addError(1, f.Name, "", "missing column")
+			}
+		}
+		for _, c := range header {
+			if _, ok := fieldNames[c]; !ok {
+				v.addError(1, c, "", "extra column")
+			}
+		}
+	}
+
+	rowNumber := func(i int) int {
+		if config.NoHeaderRow {
+			return i + 1
+		}
+		return i + 2
+	}
+
+	// values of fields
+	var val string
+	var value interface{}
+	var ok, missing bool
+	uniques := make([]map[string]int, len(schema.Fields))
+	for i, f := range schema.Fields {
+		if f.Constraints.Unique {
+			uniques[i] = make(map[string]int, len(data))
+		}
+	}
+	for r, record := range data {
+		for i, f := range schema.Fields {
+			if cols[i] < 0 || cols[i] >= len(record) {
+				continue
+			}
+			val = record[cols[i]]
+			_, missing = schema.missing[val]
+			if missing {
+				if f.Constraints.Required {
+					v.addError(rowNumber(r), f.Name, val, "missing value of required column")
+				}
+				continue
+			}
+
+			if value, ok = f.parse(val); !ok {
+				if f.Format != "" && f.Format != "default" {
+					v.addError(rowNumber(r), f.Name, val, "invalid %s of format %s", f.typeName(), f.Format)
+				} else {
+					v.addError(rowNumber(r), f.Name, val, "invalid %s", f.typeName())
+				}
+				continue
+			}
+			if f.pattern != nil && !f.pattern.MatchString(val) {
+				v.addError(rowNumber(r), f.Name, val, "not matching pattern: %s", f.Constraints.Pattern)
+			}
+			if f.enum != nil {
+				if _, ok = f.enum[val]; !ok {
+					v.addError(rowNumber(r), f.Name, val, "not in enum")
+				}
+			}
+			if n := len([]rune(val)); f.Constraints.MinLength != nil && n < *f.Constraints.MinLength {
+				v.addError(rowNumber(r), f.Name, val, "length less than %d", *f.Constraints.MinLength)
+			} else if f.Constraints.MaxLength != nil && n > *f.Constraints.MaxLength {
+				v.addError(rowNumber(r), f.Name, val, "length greater than %d", *f.Constraints.MaxLength)
+			}
+			if f.min != nil && schemaLess(value, f.min) {
+				v.addError(rowNumber(r), f.Name, val, "less than minimum: %v", f.Constraints.Minimum)
+			}
+			if f.max != nil && schemaLess(f.max, value) {
+				v.addError(rowNumber(r), f.Name, val, "greater than maximum: %v", f.Constraints.Maximum)
+			}
+			if uniques[i] != nil {
+				if r0, ok := uniques[i][val]; ok {
+					v.addError(rowNumber(r), f.Name, val, "duplicated value of unique column, first seen in row %d", r0)
+				} else {
+					uniques[i][val] = rowNumber(r)
+				}
+			}
+		}
+	}
+
+	keyOf := func(record []string, cols []int) (string, bool) {
+		items := make([]string, len(cols))
+		for i, c := range cols {
+			if c < 0 || c >= len(record) {
+				return "", false
+			}
+			items[i] = record[c]
+		}
+		return strings.Join(items, ", "), true
+	}
+	colsOf := func(names []string, colsByName map[string]int) ([]int, bool) {
+		cols := make([]int, len(names))
+		var ok bool
+		for i, name := range names {
+			if cols[i], ok = colsByName[name]; !ok {
+				return nil, false
+			}
+		}
+		return cols, true
+	}
+
+	// primary key
+	if pk := schemaList(schema.PrimaryKey); len(pk) > 0 {
+		if pkCols, ok := colsOf(pk, colsByName); ok {
+			name := strings.Join(pk, ", ")
+			keys := make(map[string]int, len(data))
+			for r, record := range data {
+				key, _ := keyOf(record, pkCols)
+				if r0, ok := keys[key]; ok {
+					v.addError(rowNumber(r), name, key, "duplicated primary key, first seen in row %d", r0)
+				} else {
+					keys[key] = rowNumber(r)
+				}
+			}
+		}
+	}
+
+	// foreign keys
+	for _, fk := range schema.ForeignKeys {
+		fields, refFields := schemaList(fk.Fields), schemaList(fk.Reference.Fields)
+		if len(fields) == 0 || len(fields) != len(refFields) {
+			checkError(fmt.Errorf("invalid foreign key: fields and reference fields should have the same length"))
+		}
+		fkCols, ok := colsOf(fields, colsByName)
+		if !ok {
+			continue
+		}
+
+		refHeader, refData := header, data
+		if res := fk.Reference.Resource; res != "" {
+			refFile := res
+			if !filepath.IsAbs(refFile) && !isURL(refFile) {
+				if _, err := os.Stat(refFile); err != nil {
+					refFile = filepath.Join(filepath.Dir(schemaFile), res)
+				}
+			}
+			var err error
+			refHeader, refData, err = readCSVAll(config, refFile)
+			checkError(err)
+		}
+		refColsByName := make(map[string]int, len(refHeader))
+		for i, c := range refHeader {
+			refColsByName[c] = i
+		}
+		refCols, ok := colsOf(refFields, refColsByName)
+		if !ok {
+			checkError(fmt.Errorf("reference fields not found in %s: %s", fk.Reference.Resource, strings.Join(refFields, ", ")))
+		}
+		refKeys := make(map[string]struct{}, len(refData))
+		for _, record := range refData {
+			if key, ok := keyOf(record, refCols); ok {
+				refKeys[key] = struct{}{}
+			}
+		}
+
+		name := strings.Join(fields, ", ")
+		for r, record := range data {
+			key, _ := keyOf(record, fkCols)
+			if _, missing = schema.missing[key]; missing {
+				continue
+			}
+			if _, ok = refKeys[key]; !ok {
+				v.addError(rowNumber(r), name, key, "foreign key not found in %s", fk.Reference.Resource)
+			}
+		}
+	}
+}
+
+func (f *schemaField) typeName() string {
+	if f.Type == "" {
+		return "string"
+	}
+	return f.Type
+}
+
+// schemaLess compares two parsed values of the same type.
+func schemaLess(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		return a < b.(float64)
+	case time.Time:
+		return a.Before(b.(time.Time))
+	case string:
+		return a < b.(string)
+	}
+	return false
+}
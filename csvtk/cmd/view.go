@@ -0,0 +1,651 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// viewCmd represents the view command
+var viewCmd = &cobra.Command{
+	GroupID: "info",
+
+	Use:   "view",
+	Short: "view CSV in an interactive and scrollable table",
+	Long: `view CSV in an interactive and scrollable table
+
+The header row is fixed on the top, and wide tables can be scrolled
+horizontally. Rows are read on demand, so it opens big files immediately.
+Keys are read from the terminal, so the data can also be piped from stdin.
+
+Keys:
+
+  j, Down, k, Up         move down or up by one row
+  Space, PgDn, b, PgUp   move down or up by one page
+  g, Home, G, End        go to the first or the last row (all rows are read)
+  l, Right, h, Left      move to the right or left column
+  0, $                   go to the first or the last column
+  -                      hide the current column
+  +                      show all hidden columns
+  /                      search a regular expression, the case is ignored if
+                         the pattern only contains lowercase letters
+  n, N                   go to the next or the previous match
+  f                      filter rows with a regular expression in any visible
+                         column on the fly. An empty pattern removes the filter
+  q, Ctrl-C              quit
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		file := files[0]
+
+		maxWidth := getFlagPositiveInt(cmd, "max-width")
+
+		// keys are read from the terminal, as stdin might be used for the data
+		in, out := os.Stdin, os.Stdout
+		if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+			defer tty.Close()
+			in, out = tty, tty
+		} else if isStdin(file) {
+			checkError(fmt.Errorf("failed to open the terminal for reading keys: %s", err))
+		}
+		if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+			checkError(fmt.Errorf("csvtk view needs a terminal, please use 'csvtk pretty' instead"))
+		}
+
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk view: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		v := &csvViewer{
+			name:     file,
+			in:       in,
+			out:      bufio.NewWriter(out),
+			fd:       int(out.Fd()),
+			ch:       csvReader.Ch,
+			maxWidth: maxWidth,
+		}
+		if isStdin(file) {
+			v.name = "stdin"
+		}
+
+		// the header row
+		record, ok := <-v.ch
+		if !ok {
+			return
+		}
+		checkError(record.Err)
+		if !config.NoHeaderRow || record.IsHeaderRow {
+			v.header = record.All
+		} else {
+			v.header = make([]string, len(record.All))
+			for i := range record.All {
+				v.header[i] = strconv.Itoa(i + 1)
+			}
+			v.addRow(record)
+		}
+		v.hidden = make([]bool, len(v.header))
+		v.widths = make([]int, len(v.header))
+		for i, c := range v.header {
+			v.widths[i] = min(runewidth.StringWidth(c), maxWidth)
+		}
+
+		state, err := term.MakeRaw(int(in.Fd()))
+		checkError(err)
+		err = v.run()
+		term.Restore(int(in.Fd()), state)
+		checkError(err)
+	},
+}
+
+// csvViewer is a simple terminal table viewer.
+type csvViewer struct {
+	name string
+	in   *os.File
+	out  *bufio.Writer
+	fd   int
+
+	ch  <-chan Record
+	eof bool
+
+	header  []string
+	rows    [][]string
+	rowNums []int
+	widths  []int
+	hidden  []bool
+
+	filter *regexp.Regexp
+	view   []int // indexes of rows matching the filter
+	search *regexp.Regexp
+
+	maxWidth      int
+	width, height int
+
+	top, cur  int // the first row on the screen and the current row, indexes of view
+	left, col int // the first column on the screen and the current column
+
+	prompt, input string // the prompt of the input box and the input
+	message       string
+}
+
+func (v *csvViewer) addRow(record Record) {
+	v.rows = append(v.rows, record.All)
+	v.rowNums = append(v.rowNums, record.Row)
+	for i, c := range record.All {
+		if i >= len(v.widths) {
+			break
+		}
+		if w := min(runewidth.StringWidth(c), v.maxWidth); w > v.widths[i] {
+			v.widths[i] = w
+		}
+	}
+	if v.match(record.All, v.filter) {
+		v.view = append(v.view, len(v.rows)-1)
+	}
+}
+
+// load reads rows till n rows are shown, n < 0 for all rows.
+func (v *csvViewer) load(n int) error {
+	for !v.eof && (n < 0 || len(v.view) < n) {
+		record, ok := <-v.ch
+		if !ok {
+			v.eof = true
+			break
+		}
+		if record.Err != nil {
+			return record.Err
+		}
+		v.addRow(record)
+	}
+	return nil
+}
+
+// match checks if any visible cell matches a pattern.
+func (v *csvViewer) match(row []string, re *regexp.Regexp) bool {
+	if re == nil {
+		return true
+	}
+	for i, c := range row {
+		if i < len(v.hidden) && v.hidden[i] {
+			continue
+		}
+		if re.MatchString(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFilter filters loaded rows.
+func (v *csvViewer) applyFilter() {
+	v.view = v.view[:0]
+	for i, row := range v.rows {
+		if v.match(row, v.filter) {
+			v.view = append(v.view, i)
+		}
+	}
+	v.top, v.cur = 0, 0
+}
+
+// compileViewerPattern compiles a pattern, ignoring the case if it only
+// contains lowercase letters.
+func compileViewerPattern(s string) (*regexp.Regexp, error) {
+	if strings.IndexFunc(s, unicode.IsUpper) < 0 {
+		s = "(?i)" + s
+	}
+	return regexp.Compile(s)
+}
+
+func (v *csvViewer) run() error {
+	v.out.WriteString("\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	defer func() {
+		v.out.WriteString("\x1b[?25h\x1b[?1049l")
+		v.out.Flush()
+	}()
+
+	buf := make([]byte, 64)
+	var keys []string
+	for {
+		if err := v.render(); err != nil {
+			return err
+		}
+
+		n, err := v.in.Read(buf)
+		if err != nil {
+			return err
+		}
+		keys = parseViewerKeys(buf[:n], keys[:0])
+		for _, key := range keys {
+			quit, err := v.handle(key)
+			if err != nil {
+				return err
+			}
+			if quit {
+				return nil
+			}
+		}
+	}
+}
+
+// parseViewerKeys splits the input into keys, escape sequences are kept whole.
+func parseViewerKeys(b []byte, keys []string) []string {
+	var j int
+	for i := 0; i < len(b); {
+		if b[i] == 0x1b && i+2 < len(b) && (b[i+1] == '[' || b[i+1] == 'O') {
+			j = i + 2
+			for j < len(b) && (b[j] < 0x40 || b[j] > 0x7e) {
+				j++
+			}
+			if j < len(b) {
+				j++
+			}
+			keys = append(keys, string(b[i:j]))
+			i = j
+			continue
+		}
+		_, size := utf8.DecodeRune(b[i:])
+		keys = append(keys, string(b[i:i+size]))
+		i += size
+	}
+	return keys
+}
+
+// handle handles a key, and returns true for quitting.
+func (v *csvViewer) handle(key string) (bool, error) {
+	v.message = ""
+
+	if v.prompt != "" {
+		return false, v.handleInput(key)
+	}
+
+	page := v.height - 2
+	if page < 1 {
+		page = 1
+	}
+
+	switch key {
+	case "q", "\x03":
+		return true, nil
+	case "j", "\x1b[B", "\x1bOB", "\r":
+		return false, v.moveRow(v.cur + 1)
+	case "k", "\x1b[A", "\x1bOA":
+		return false, v.moveRow(v.cur - 1)
+	case " ", "\x1b[6~", "\x06":
+		return false, v.moveRow(v.cur + page)
+	case "b", "\x1b[5~", "\x02":
+		return false, v.moveRow(v.cur - page)
+	case "g", "\x1b[H", "\x1b[1~", "\x1bOH":
+		return false, v.moveRow(0)
+	case "G", "\x1b[F", "\x1b[4~", "\x1bOF":
+		if err := v.load(-1); err != nil {
+			return false, err
+		}
+		return false, v.moveRow(len(v.view) - 1)
+	case "l", "\x1b[C", "\x1bOC":
+		v.moveCol(1)
+	case "h", "\x1b[D", "\x1bOD":
+		v.moveCol(-1)
+	case "0":
+		v.col = -1
+		v.moveCol(1)
+	case "$":
+		v.col = len(v.header)
+		v.moveCol(-1)
+	case "-":
+		if v.nVisible() == 1 {
+			v.message = "the last visible column can not be hidden"
+			break
+		}
+		v.hidden[v.col] = true
+		if !v.moveCol(1) {
+			v.moveCol(-1)
+		}
+	case "+":
+		for i := range v.hidden {
+			v.hidden[i] = false
+		}
+	case "/", "f":
+		v.prompt, v.input = key, ""
+		if key == "f" && v.filter != nil {
+			v.input = strings.TrimPrefix(v.filter.String(), "(?i)")
+		}
+	case "n":
+		return false, v.find(1)
+	case "N":
+		return false, v.find(-1)
+	}
+	return false, nil
+}
+
+// handleInput edits the input box.
+func (v *csvViewer) handleInput(key string) error {
+	switch key {
+	case "\x1b", "\x03": // cancel
+		v.prompt = ""
+		return nil
+	case "\r", "\n":
+		prompt := v.prompt
+		v.prompt = ""
+		if prompt == "/" {
+			if v.input == "" {
+				v.search = nil
+				return nil
+			}
+			re, err := compileViewerPattern(v.input)
+			if err != nil {
+				v.message = err.Error()
+				return nil
+			}
+			v.search = re
+			return v.find(0)
+		}
+		return nil
+	case "\x7f", "\x08":
+		if v.input != "" {
+			_, size := utf8.DecodeLastRuneInString(v.input)
+			v.input = v.input[:len(v.input)-size]
+		}
+	default:
+		r, _ := utf8.DecodeRuneInString(key)
+		if len(key) > 1 && key[0] == 0x1b || !unicode.IsPrint(r) {
+			return nil
+		}
+		v.input += key
+	}
+
+	// filter on the fly
+	if v.prompt == "f" {
+		if v.input == "" {
+			v.filter = nil
+		} else if re, err := compileViewerPattern(v.input); err == nil {
+			v.filter = re
+		} else {
+			return nil
+		}
+		v.applyFilter()
+	}
+	return nil
+}
+
+// find moves to the next (d=1), previous (d=-1) or current (d=0) matched row.
+func (v *csvViewer) find(d int) error {
+	if v.search == nil {
+		v.message = "no search pattern, type / to search"
+		return nil
+	}
+	step := d
+	if step == 0 {
+		step = 1
+	}
+	for i := v.cur + d; i >= 0; i += step {
+		if i >= len(v.view) {
+			if err := v.load(i + 1); err != nil {
+				return err
+			}
+			if i >= len(v.view) {
+				break
+			}
+		}
+		if v.match(v.rows[v.view[i]], v.search) {
+			return v.moveRow(i)
+		}
+	}
+	v.message = "pattern not found: " + strings.TrimPrefix(v.search.String(), "(?i)")
+	return nil
+}
+
+// moveRow moves to the row and scrolls the screen if needed.
+func (v *csvViewer) moveRow(i int) error {
+	if err := v.load(i + 1); err != nil {
+		return err
+	}
+	if i >= len(v.view) {
+		i = len(v.view) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	v.cur = i
+
+	page := v.height - 2
+	if page < 1 {
+		page = 1
+	}
+	if v.cur < v.top {
+		v.top = v.cur
+	} else if v.cur >= v.top+page {
+		v.top = v.cur - page + 1
+	}
+	return nil
+}
+
+// moveCol moves to the next visible column in the direction, and returns
+// false if there's no more visible columns.
+func (v *csvViewer) moveCol(d int) bool {
+	for i := v.col + d; i >= 0 && i < len(v.header); i += d {
+		if !v.hidden[i] {
+			v.col = i
+			if v.col < v.left {
+				v.left = v.col
+			}
+			return true
+		}
+	}
+	if v.col < 0 || v.col >= len(v.header) {
+		v.col = 0
+	}
+	return false
+}
+
+func (v *csvViewer) nVisible() int {
+	var n int
+	for _, h := range v.hidden {
+		if !h {
+			n++
+		}
+	}
+	return n
+}
+
+// columns returns visible columns on the screen.
+func (v *csvViewer) columns(x int) []int {
+	cols := make([]int, 0, 8)
+	for i := v.left; i < len(v.header); i++ {
+		if v.hidden[i] {
+			continue
+		}
+		if x >= v.width && len(cols) > 0 {
+			break
+		}
+		cols = append(cols, i)
+		x += v.widths[i] + 3
+	}
+	return cols
+}
+
+func (v *csvViewer) render() error {
+	var err error
+	if v.width, v.height, err = term.GetSize(v.fd); err != nil {
+		return err
+	}
+	page := v.height - 2
+	if page < 1 {
+		page = 1
+	}
+	if err = v.load(v.top + page); err != nil {
+		return err
+	}
+	if v.cur >= len(v.view) && len(v.view) > 0 {
+		v.cur = len(v.view) - 1
+	}
+
+	// the width of row numbers
+	nw := 1
+	if n := len(v.view); n > 0 {
+		nw = len(strconv.Itoa(v.rowNums[v.view[min(v.top+page, n)-1]]))
+	}
+
+	// scroll right till the current column is on the screen
+	if v.left > v.col {
+		v.left = v.col
+	}
+	var cols []int
+	for {
+		cols = v.columns(nw + 3)
+		if v.left >= v.col || v.shown(cols, nw) {
+			break
+		}
+		v.left++
+	}
+
+	out := v.out
+	out.WriteString("\x1b[H")
+
+	// header
+	out.WriteString("\x1b[1;7m")
+	v.writeLine(strings.Repeat(" ", nw), v.header, cols, nw, -1)
+	out.WriteString("\x1b[0m\x1b[K\r\n")
+
+	// rows
+	var i int
+	for y := 0; y < page; y++ {
+		i = v.top + y
+		if i < len(v.view) {
+			if i == v.cur {
+				out.WriteString("\x1b[7m")
+			}
+			v.writeLine(strconv.Itoa(v.rowNums[v.view[i]]), v.rows[v.view[i]], cols, nw, i)
+			out.WriteString("\x1b[0m")
+		} else {
+			out.WriteString("\x1b[2m~\x1b[0m")
+		}
+		out.WriteString("\x1b[K\r\n")
+	}
+
+	// status line
+	var status string
+	if v.prompt != "" {
+		status = v.prompt + v.input
+	} else if v.message != "" {
+		status = v.message
+	} else {
+		total := strconv.Itoa(len(v.view))
+		if !v.eof {
+			total += "+"
+		}
+		status = fmt.Sprintf("%s  row %d/%s  column %d/%d (%s)", v.name, min(v.cur+1, len(v.view)), total,
+			v.col+1, len(v.header), v.header[v.col])
+		if n := len(v.header) - v.nVisible(); n > 0 {
+			status += fmt.Sprintf("  %d hidden", n)
+		}
+		if v.filter != nil {
+			status += "  filter: " + strings.TrimPrefix(v.filter.String(), "(?i)")
+		}
+		status += "  q:quit"
+	}
+	out.WriteString("\x1b[7m")
+	out.WriteString(runewidth.FillRight(runewidth.Truncate(status, v.width, ""), v.width))
+	out.WriteString("\x1b[0m")
+	if v.prompt != "" {
+		out.WriteString("\x1b[?25h")
+	} else {
+		out.WriteString("\x1b[?25l")
+	}
+
+	return out.Flush()
+}
+
+// shown checks if the current column is wholly shown on the screen.
+func (v *csvViewer) shown(cols []int, x int) bool {
+	for _, c := range cols {
+		x += v.widths[c] + 3
+		if c == v.col {
+			return x <= v.width
+		}
+	}
+	return false
+}
+
+// writeLine writes cells of the columns, the current cell and matched cells
+// are highlighted.
+func (v *csvViewer) writeLine(num string, row []string, cols []int, nw int, i int) {
+	var line strings.Builder
+	line.WriteString("\x1b[2m")
+	line.WriteString(runewidth.FillLeft(num, nw))
+	line.WriteString("\x1b[22m")
+
+	x := nw
+	var cell, text string
+	var w int
+	for _, c := range cols {
+		cell = ""
+		if c < len(row) {
+			cell = row[c]
+		}
+		w = min(v.widths[c], v.width-x-3)
+		if w <= 0 {
+			break
+		}
+		text = runewidth.FillRight(runewidth.Truncate(cell, w, "…"), w)
+
+		line.WriteString(" │ ")
+		switch {
+		case i >= 0 && i == v.cur && c == v.col:
+			line.WriteString("\x1b[1;4m" + text + "\x1b[22;24m")
+		case i >= 0 && v.search != nil && v.search.MatchString(cell):
+			line.WriteString("\x1b[33m" + text + "\x1b[39m")
+		default:
+			line.WriteString(text)
+		}
+		x += w + 3
+	}
+	v.out.WriteString(line.String())
+}
+
+func init() {
+	RootCmd.AddCommand(viewCmd)
+	viewCmd.Flags().IntP("max-width", "W", 40, "max width of columns, longer cells are clipped")
+}
@@ -0,0 +1,413 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/util/stringutil"
+	"github.com/spf13/cobra"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// violinCmd represents the violin command
+var violinCmd = &cobra.Command{
+	Use:   "violin",
+	Short: "plot violin plot",
+	Long: `plot violin plot
+
+Notes:
+
+  1. Output file can be set by flag -o/--out-file.
+  2. File format is determined by the out file suffix.
+     Supported formats: eps, jpg|jpeg, pdf, png, svg, tif|tiff, and html
+  3. If flag -o/--out-file not set (default), image is written to stdout,
+     you can display the image by pipping to "display" command of Imagemagic
+     or just redirect to file.
+  4. The html format outputs an interactive chart, see "csvtk plot -h".
+  5. Densities are estimated by Gaussian kernel density estimation with
+     the bandwidth of Silverman's rule, and trimmed to the data range.
+     Each violin is scaled to the same maximum width.
+  6. A narrow box plot is drawn inside each violin, unless --no-box given.
+     The box is not drawn in html output.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		plotConfig := getPlotConfigs(cmd)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		skipNA := getFlagBool(cmd, "skip-na")
+		naValues := getFlagStringSlice(cmd, "na-values")
+		if skipNA && len(naValues) == 0 {
+			log.Errorf("the value of --na-values should not be empty when using --skip-na")
+		}
+
+		lineWidth := vg.Points(getFlagPositiveFloat64(cmd, "line-width") * plotConfig.scale)
+		pointSize := vg.Length(getFlagPositiveFloat64(cmd, "point-size") * plotConfig.scale)
+		colorIndex := getFlagPositiveInt(cmd, "color-index")
+		if colorIndex > 7 {
+			checkError(fmt.Errorf("unsupported color index"))
+		}
+
+		naMap := make(map[string]interface{}, len(naValues))
+		for _, na := range naValues {
+			naMap[strings.ToLower(na)] = struct{}{}
+		}
+
+		file := files[0]
+		headerRow, fields, data, headerRowAll, dataAll, err := parseCSVfile(cmd, config, file, plotConfig.fieldStr, false, true, plotConfig.facetFieldStr != "")
+
+		if err != nil {
+			// if err == xopen.ErrNoContent {
+			// 	log.Warningf("csvtk violin: skipping empty input file: %s", file)
+			// 	return
+			// }
+			checkError(err)
+		}
+
+		build := func(data [][]string) *plot.Plot {
+			// =======================================
+
+			horiz := getFlagBool(cmd, "horiz")
+			violinWidth := getFlagPositiveFloat64(cmd, "violin-width")
+			if violinWidth > 1 {
+				checkError(fmt.Errorf("value of flag --violin-width should be in (0, 1]"))
+			}
+			noBox := getFlagBool(cmd, "no-box")
+			w := vg.Length(getFlagNonNegativeFloat64(cmd, "box-width"))
+
+			groups := make(map[string]plotter.Values)
+			groupOrderMap := make(map[string]int)
+			var f float64
+			var ok bool
+			var order int
+			var groupName string
+			for _, d := range data {
+				if skipNA {
+					if _, ok = naMap[strings.ToLower(d[0])]; ok {
+						continue
+					}
+				}
+
+				f, err = strconv.ParseFloat(d[0], 64)
+				if err != nil {
+					if len(headerRow) > 0 {
+						checkError(fmt.Errorf("fail to parse data: %s at column: %s. please choose the right column by flag -f (--data-field)", d[0], headerRow[0]))
+					} else {
+						checkError(fmt.Errorf("fail to parse data: %s at column: %d. please choose the right column by flag -f (--data-field)", d[0], fields[0]))
+					}
+				}
+				if len(d) > 1 {
+					groupName = d[1]
+				} else { // no group, only given a field
+					if len(headerRow) > 0 {
+						groupName = headerRow[0]
+					} else {
+						groupName = ""
+					}
+				}
+				if _, ok = groups[groupName]; !ok {
+					groups[groupName] = make(plotter.Values, 0)
+				}
+				groups[groupName] = append(groups[groupName], f)
+
+				if _, ok = groupOrderMap[groupName]; !ok {
+					groupOrderMap[groupName] = order
+					order++
+				}
+			}
+
+			p := plot.New()
+
+			var groupOrders []stringutil.StringCount
+			for g := range groupOrderMap {
+				groupOrders = append(groupOrders, stringutil.StringCount{Key: g, Count: groupOrderMap[g]})
+			}
+			sort.Sort(stringutil.StringCountList(groupOrders))
+
+			if w == 0 {
+				if !horiz {
+					w = vg.Points(float64(plotConfig.width*vg.Inch) / float64(len(groupOrders)) * violinWidth / 8)
+				} else {
+					w = vg.Points(float64(plotConfig.height*vg.Inch) / float64(len(groupOrders)) * violinWidth / 8)
+				}
+			}
+
+			groupNames := make([]string, len(groupOrders))
+			j := colorIndex - 1
+			for i, group := range groupOrders {
+				groupNames[i] = group.Key
+				values := groups[group.Key]
+
+				poly, err := plotter.NewPolygon(violinOutline(values, float64(i), violinWidth/2, horiz))
+				checkError(err)
+				c := color.NRGBAModel.Convert(plotutil.Color(j)).(color.NRGBA)
+				poly.LineStyle.Color = c
+				poly.LineStyle.Width = lineWidth
+				c.A = 128
+				poly.Color = c
+				p.Add(poly)
+
+				if !noBox {
+					b, err := plotter.NewBoxPlot(w, float64(i), values)
+					checkError(err)
+					b.Horizontal = horiz
+					b.FillColor = color.White
+					b.BoxStyle.Width = lineWidth
+					b.MedianStyle.Width = lineWidth
+					b.WhiskerStyle.Width = lineWidth
+					b.GlyphStyle.Color = plotutil.Color(j)
+					b.GlyphStyle.Radius = pointSize
+					p.Add(b)
+				}
+				j++
+			}
+
+			if !horiz {
+				p.NominalX(groupNames...)
+				// p.HideX()
+			} else {
+				p.NominalY(groupNames...)
+				// p.HideY()
+			}
+
+			if plotConfig.ylab == "" {
+				if len(headerRow) > 0 {
+					plotConfig.ylab = headerRow[0]
+				} else {
+					plotConfig.ylab = "Values"
+				}
+			}
+			if plotConfig.xlab == "" {
+				if len(headerRow) > 1 {
+					plotConfig.xlab = headerRow[1]
+				} else {
+					plotConfig.xlab = "Groups"
+				}
+			}
+			if horiz {
+				plotConfig.xlab, plotConfig.ylab = plotConfig.ylab, plotConfig.xlab
+			}
+
+			if plotConfig.html {
+				values := make([]vegaObj, 0, len(data))
+				for _, g := range groupNames {
+					for _, f := range groups[g] {
+						values = append(values, vegaObj{"group": g, "value": f})
+					}
+				}
+				spec := newVegaLiteSpec(plotConfig, values)
+				width, height := spec["width"].(float64), spec["height"].(float64)
+				delete(spec, "width")
+				delete(spec, "height")
+
+				density := vegaObj{
+					"field": "density", "type": "quantitative", "stack": "center", "impute": nil, "title": nil,
+					"axis": vegaObj{"labels": false, "values": []float64{0}, "grid": false, "ticks": false},
+				}
+				facet := vegaObj{
+					"field": "group", "type": "nominal", "sort": groupNames,
+					"header": vegaObj{"titleOrient": "bottom", "labelOrient": "bottom"},
+				}
+				encoding := vegaObj{
+					"color": vegaObj{
+						"field": "group", "type": "nominal", "legend": nil,
+						"scale": vegaObj{"domain": groupNames, "range": vegaPlotutilColors(colorIndex-1, len(groupNames))},
+					},
+				}
+				inner := vegaObj{
+					"transform": []vegaObj{{"density": "value", "groupby": []string{"group"}}},
+					"encoding":  encoding,
+				}
+				n := float64(len(groupNames))
+				if !horiz {
+					facet["title"] = vegaTitle(plotConfig.xlab)
+					spec["facet"] = vegaObj{"column": facet}
+					inner["mark"] = vegaObj{"type": "area", "orient": "horizontal", "tooltip": true}
+					inner["width"], inner["height"] = math.Round(width/n*violinWidth), height
+					encoding["x"] = density
+					encoding["y"] = vegaQuantitative("value", plotConfig.ylab, plotConfig.scaleLnY,
+						plotConfig.yminStr, plotConfig.ymin, plotConfig.ymaxStr, plotConfig.ymax)
+				} else {
+					facet["title"] = vegaTitle(plotConfig.ylab)
+					spec["facet"] = vegaObj{"row": facet}
+					inner["mark"] = vegaObj{"type": "area", "orient": "vertical", "tooltip": true}
+					inner["width"], inner["height"] = width, math.Round(height/n*violinWidth)
+					encoding["y"] = density
+					encoding["x"] = vegaQuantitative("value", plotConfig.xlab, plotConfig.scaleLnX,
+						plotConfig.xminStr, plotConfig.xmin, plotConfig.xmaxStr, plotConfig.xmax)
+				}
+				spec["spec"] = inner
+				spec["spacing"] = 0
+				spec["config"].(vegaObj)["view"] = vegaObj{"stroke": nil}
+				writePlotHTML(config.OutFile, plotConfig, spec)
+				return nil
+			}
+
+			p.Title.Text = plotConfig.title
+			p.Title.TextStyle.Font.Size = plotConfig.titleSize
+			p.X.Label.Text = plotConfig.xlab
+			p.Y.Label.Text = plotConfig.ylab
+			p.X.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.Y.Label.TextStyle.Font.Size = plotConfig.labelSize
+			p.X.Width = plotConfig.axisWidth
+			p.Y.Width = plotConfig.axisWidth
+			p.X.Tick.Width = plotConfig.tickWidth
+			p.Y.Tick.Width = plotConfig.tickWidth
+			p.X.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			p.Y.Tick.Label.Font.Size = plotConfig.tickLabelSize
+			if plotConfig.scaleLnX {
+				p.X.Scale = plot.LogScale{}
+				p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+			if plotConfig.scaleLnY {
+				p.Y.Scale = plot.LogScale{}
+				p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+			}
+
+			if plotConfig.xminStr != "" {
+				log.Warning("flag --x-min ignored for command violin")
+			}
+			if plotConfig.xmaxStr != "" {
+				log.Warning("flag --x-max ignored for command violin")
+			}
+			if plotConfig.yminStr != "" {
+				log.Warning("flag --y-min ignored for command violin")
+			}
+			if plotConfig.ymaxStr != "" {
+				log.Warning("flag --y-max ignored for command violin")
+			}
+
+			return p
+		}
+
+		if plotConfig.facetFieldStr != "" {
+			plotFacets(config, plotConfig, headerRowAll, data, dataAll, build)
+			return
+		}
+
+		p := build(data)
+		if p == nil { // html or terminal format
+			return
+		}
+
+		// Save image
+		if isStdin(config.OutFile) {
+			fh, err := p.WriterTo(plotConfig.width*vg.Inch,
+				plotConfig.height*vg.Inch,
+				plotConfig.format)
+			checkError(err)
+			_, err = fh.WriteTo(os.Stdout)
+			checkError(err)
+		} else {
+			checkError(p.Save(plotConfig.width*vg.Inch,
+				plotConfig.height*vg.Inch,
+				config.OutFile))
+		}
+	},
+}
+
+// violinOutline returns the outline of a violin at the position pos,
+// with the maximum half width of halfWidth in the unit of positions.
+func violinOutline(values []float64, pos float64, halfWidth float64, horiz bool) plotter.XYs {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	min, max := sorted[0], sorted[len(sorted)-1]
+
+	// Silverman's rule of thumb
+	n := float64(len(sorted))
+	sd := stat.StdDev(sorted, nil)
+	iqr := (percentileValue(sorted, 0.75) - percentileValue(sorted, 0.25)) / 1.34
+	spread := sd
+	if iqr > 0 && iqr < sd {
+		spread = iqr
+	}
+	bw := 0.9 * spread * math.Pow(n, -0.2)
+
+	const nPoints = 128
+	ys := make([]float64, nPoints)
+	densities := make([]float64, nPoints)
+	var maxDensity float64
+	for k := range ys {
+		ys[k] = min + (max-min)*float64(k)/float64(nPoints-1)
+		if bw > 0 && !math.IsNaN(bw) {
+			var d, z float64
+			for _, v := range sorted {
+				z = (ys[k] - v) / bw
+				d += math.Exp(-z * z / 2)
+			}
+			densities[k] = d
+		} else { // all values are the same
+			densities[k] = 1
+		}
+		if densities[k] > maxDensity {
+			maxDensity = densities[k]
+		}
+	}
+
+	outline := make(plotter.XYs, 0, nPoints*2)
+	var x float64
+	for k := 0; k < nPoints; k++ {
+		x = pos + densities[k]/maxDensity*halfWidth
+		outline = append(outline, plotter.XY{X: x, Y: ys[k]})
+	}
+	for k := nPoints - 1; k >= 0; k-- {
+		x = pos - densities[k]/maxDensity*halfWidth
+		outline = append(outline, plotter.XY{X: x, Y: ys[k]})
+	}
+	if horiz {
+		for k := range outline {
+			outline[k].X, outline[k].Y = outline[k].Y, outline[k].X
+		}
+	}
+	return outline
+}
+
+func init() {
+	plotCmd.AddCommand(violinCmd)
+
+	violinCmd.Flags().Float64P("violin-width", "", 0.8, "violin width, relative to the distance between violins, in (0, 1]")
+	violinCmd.Flags().Float64P("box-width", "", 0, "width of the inner box, 0 for auto")
+	violinCmd.Flags().BoolP("no-box", "", false, "do not draw the inner box plot")
+	violinCmd.Flags().BoolP("horiz", "", false, "horize violin plot")
+
+	violinCmd.Flags().Float64P("line-width", "", 1.5, "line width")
+	violinCmd.Flags().Float64P("point-size", "", 3, "point size of outliers in the inner box plot")
+	violinCmd.Flags().IntP("color-index", "", 1, `color index, 1-7`)
+}
@@ -0,0 +1,454 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"gonum.org/v1/gonum/stat"
+)
+
+// windowCmd represents the window command
+var windowCmd = &cobra.Command{
+	GroupID: "transform",
+
+	Use:   "window",
+	Short: "window functions: rolling statistics, cumulative sums, lag/lead and ranks",
+	Long: `window functions: rolling statistics, cumulative sums, lag/lead and ranks
+
+Window functions are computed over records in the input order, partitioned
+by -g/--groups. Please sort the data in advance with "csvtk sort" if needed.
+New columns are appended in the order of flags listed below, and their names
+can be given with "as <name>", e.g., --lag "price:1 as prev_price".
+
+Functions:
+
+  --rolling   "op:column", rolling statistics of the last --window records,
+              ops: mean, sum, min, max, std. Values of incomplete windows
+              are empty unless --partial is given.
+  --cumsum    "column", cumulative sums.
+  --lag       "column:N", the value of N records before.
+  --lead      "column:N", the value of N records after.
+  --rank      "column", rank with gaps for ties, e.g., 1, 2, 2, 4.
+  --dense-rank "column", rank without gaps, e.g., 1, 2, 2, 3.
+  --row-number "name", row number starting from 1.
+
+Ranks are computed in ascending order (-r/--desc for descending). If any value
+of the column is numeric, values are compared as numbers, and non-numeric
+values like "NA" get the value of --na. Otherwise, values are compared as
+strings.
+
+Examples:
+
+    csvtk window -g id --rolling "mean:price as ma7" --window 7 \
+        --lag "price:1 as prev_price" --cumsum volume data.csv
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		groupsStr := getFlagString(cmd, "groups")
+		window := getFlagPositiveInt(cmd, "window")
+		partial := getFlagBool(cmd, "partial")
+		desc := getFlagBool(cmd, "desc")
+		ignore := getFlagBool(cmd, "ignore-non-numbers")
+		na := getFlagString(cmd, "na")
+		decimalFormat := fmt.Sprintf("%%.%df", getFlagNonNegativeInt(cmd, "decimal-width"))
+
+		specs := make([]*windowSpec, 0, 4)
+		for _, kind := range []string{"rolling", "cumsum", "lag", "lead", "rank", "dense-rank"} {
+			for _, s := range getFlagStringArray(cmd, kind) {
+				spec, err := parseWindowSpec(kind, s)
+				checkError(err)
+				if kind == "rolling" {
+					spec.name2 = fmt.Sprintf("%s_rolling_%s%d", spec.column, spec.op, window)
+				}
+				specs = append(specs, spec)
+			}
+		}
+		if name := getFlagString(cmd, "row-number"); name != "" {
+			specs = append(specs, &windowSpec{kind: "row-number", name: name})
+		}
+		if len(specs) == 0 {
+			checkError(fmt.Errorf("at least one window function needed"))
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		file := files[0]
+		csvReader, err := newCSVReaderByConfig(config, file)
+		if err != nil {
+			if err == xopen.ErrNoContent {
+				if config.Verbose {
+					log.Warningf("csvtk window: skipping empty input file: %s", file)
+				}
+				return
+			}
+			checkError(err)
+		}
+
+		csvReader.Read(ReadOption{
+			FieldStr: "1-",
+		})
+
+		var groupFields []int
+		records := make([][]string, 0, 1024)
+		partitions := make(map[string][]int, 128) // group -> indexes of records
+		keyEncoder := &joinKeyEncoder{}
+		var group string
+
+		checkFirstLine := true
+		for record := range csvReader.Ch {
+			if record.Err != nil {
+				checkError(record.Err)
+			}
+
+			if checkFirstLine {
+				checkFirstLine = false
+
+				header := record.All
+				if config.NoHeaderRow {
+					header = make([]string, len(record.All))
+				}
+				if groupsStr != "" {
+					groupFields = selectFieldsByHeader(header, groupsStr, false)
+				}
+				for _, spec := range specs {
+					if spec.kind == "row-number" {
+						continue
+					}
+					fields := selectFieldsByHeader(header, spec.column, false)
+					if len(fields) != 1 {
+						checkError(fmt.Errorf("only one column allowed: %s", spec.column))
+					}
+					spec.field = fields[0]
+				}
+
+				if !config.NoHeaderRow {
+					if !config.NoOutHeader {
+						items := make([]string, 0, len(header)+len(specs))
+						items = append(items, header...)
+						for _, spec := range specs {
+							items = append(items, spec.outName())
+						}
+						checkError(writer.Write(items))
+					}
+					continue
+				}
+			}
+
+			group, _ = keyEncoder.key(record.All, groupFields)
+			partitions[group] = append(partitions[group], len(records))
+
+			records = append(records, record.All)
+		}
+		readerReport(&config, csvReader, file)
+
+		parseNum := func(val string) (float64, bool) {
+			if !reDigitals.MatchString(val) {
+				if ignore {
+					return 0, false
+				}
+				checkError(fmt.Errorf("non-numeric value: %s, you can use flag -i/--ignore-non-numbers to skip these data", val))
+			}
+			v, err := strconv.ParseFloat(removeComma(val), 64)
+			checkError(err)
+			return v, true
+		}
+
+		// columns with any numeric values are ranked as numbers
+		numericRanks := make(map[int]bool, len(specs))
+		for _, spec := range specs {
+			if spec.kind != "rank" && spec.kind != "dense-rank" {
+				continue
+			}
+			if _, ok := numericRanks[spec.field]; ok {
+				continue
+			}
+			numericRanks[spec.field] = false
+			for _, record := range records {
+				if reDigitals.MatchString(record[spec.field-1]) {
+					numericRanks[spec.field] = true
+					break
+				}
+			}
+		}
+
+		results := make([][]string, len(records))
+		for i := range results {
+			results[i] = make([]string, len(specs))
+		}
+
+		for _, rows := range partitions {
+			for j, spec := range specs {
+				switch spec.kind {
+				case "row-number":
+					for k, r := range rows {
+						results[r][j] = strconv.Itoa(k + 1)
+					}
+				case "lag", "lead":
+					n := spec.n
+					if spec.kind == "lag" {
+						n = -n
+					}
+					for k, r := range rows {
+						if k+n >= 0 && k+n < len(rows) {
+							results[r][j] = records[rows[k+n]][spec.field-1]
+						} else {
+							results[r][j] = na
+						}
+					}
+				case "cumsum":
+					var sum float64
+					for _, r := range rows {
+						if v, ok := parseNum(records[r][spec.field-1]); ok {
+							sum += v
+						}
+						results[r][j] = fmt.Sprintf(decimalFormat, sum)
+					}
+				case "rolling":
+					values := make([]float64, 0, window)
+					valid := make([]bool, len(rows))
+					nums := make([]float64, len(rows))
+					for k, r := range rows {
+						nums[k], valid[k] = parseNum(records[r][spec.field-1])
+
+						values = values[:0]
+						for i := k - window + 1; i <= k; i++ {
+							if i >= 0 && valid[i] {
+								values = append(values, nums[i])
+							}
+						}
+						if len(values) == 0 || (!partial && (k+1 < window || len(values) < window)) {
+							results[r][j] = na
+							continue
+						}
+						results[r][j] = fmt.Sprintf(decimalFormat, rollingStats[spec.op](values))
+					}
+				case "rank", "dense-rank":
+					ranks := windowRanks(records, rows, spec.field, desc, spec.kind == "dense-rank", numericRanks[spec.field])
+					for k, r := range rows {
+						if ranks[k] == 0 {
+							results[r][j] = na
+							continue
+						}
+						results[r][j] = strconv.Itoa(ranks[k])
+					}
+				}
+			}
+		}
+
+		items := make([]string, 0, 64)
+		for i, record := range records {
+			items = append(items[:0], record...)
+			items = append(items, results[i]...)
+			checkError(writer.Write(items))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(windowCmd)
+
+	windowCmd.Flags().StringP("groups", "g", "", `partition via fields. e.g -g 1,2 or -g columnA,columnB`)
+	windowCmd.Flags().StringArrayP("rolling", "", []string{}, `rolling statistics, e.g., "mean:price as ma7". ops: mean, sum, min, max, std. multiple values supported`)
+	windowCmd.Flags().IntP("window", "", 3, `window size for rolling statistics`)
+	windowCmd.Flags().BoolP("partial", "", false, `compute rolling statistics for incomplete windows`)
+	windowCmd.Flags().StringArrayP("cumsum", "", []string{}, `cumulative sums, e.g., "volume as total". multiple values supported`)
+	windowCmd.Flags().StringArrayP("lag", "", []string{}, `the value of N records before, e.g., "price:1 as prev_price". multiple values supported`)
+	windowCmd.Flags().StringArrayP("lead", "", []string{}, `the value of N records after, e.g., "price:1 as next_price". multiple values supported`)
+	windowCmd.Flags().StringArrayP("rank", "", []string{}, `rank with gaps for ties, e.g., "score as rank". multiple values supported`)
+	windowCmd.Flags().StringArrayP("dense-rank", "", []string{}, `rank without gaps, e.g., "score as rank". multiple values supported`)
+	windowCmd.Flags().StringP("row-number", "", "", `name of the row number column to append`)
+	windowCmd.Flags().BoolP("desc", "r", false, `rank in descending order`)
+	windowCmd.Flags().BoolP("ignore-non-numbers", "i", false, `ignore non-numeric values like "NA" or "N/A"`)
+	windowCmd.Flags().StringP("na", "", "", `content for missing values, e.g., lags of the first records`)
+	windowCmd.Flags().IntP("decimal-width", "w", 2, "limit floats to N decimal points")
+}
+
+// windowSpec is a window function like "price:1 as prev_price".
+type windowSpec struct {
+	kind   string
+	op     string // for rolling
+	n      int    // for lag and lead
+	column string
+	name   string
+	name2  string // default name
+	field  int
+}
+
+func (s *windowSpec) outName() string {
+	if s.name != "" {
+		return s.name
+	}
+	if s.name2 != "" {
+		return s.name2
+	}
+	switch s.kind {
+	case "lag", "lead":
+		return fmt.Sprintf("%s_%s%d", s.column, s.kind, s.n)
+	case "dense-rank":
+		return s.column + "_dense_rank"
+	}
+	return s.column + "_" + s.kind
+}
+
+var reWindowSpec = regexp.MustCompile(`(?is)^(.+?)(?:\s+as\s+(.+))?$`)
+
+var rollingStats = map[string]func([]float64) float64{
+	"mean": func(s []float64) float64 { return stat.Mean(s, nil) },
+	"sum": func(s []float64) float64 {
+		var sum float64
+		for _, v := range s {
+			sum += v
+		}
+		return sum
+	},
+	"min": func(s []float64) float64 {
+		min := math.Inf(1)
+		for _, v := range s {
+			min = math.Min(min, v)
+		}
+		return min
+	},
+	"max": func(s []float64) float64 {
+		max := math.Inf(-1)
+		for _, v := range s {
+			max = math.Max(max, v)
+		}
+		return max
+	},
+	"std": func(s []float64) float64 { return stat.StdDev(s, nil) },
+}
+
+func parseWindowSpec(kind string, s string) (*windowSpec, error) {
+	found := reWindowSpec.FindStringSubmatch(strings.TrimSpace(s))
+	if found == nil {
+		return nil, fmt.Errorf("invalid value of --%s: %s", kind, s)
+	}
+	spec := &windowSpec{kind: kind, column: strings.TrimSpace(found[1]), name: strings.TrimSpace(found[2])}
+
+	switch kind {
+	case "rolling":
+		i := strings.Index(spec.column, ":")
+		if i < 0 {
+			return nil, fmt.Errorf(`invalid value of --rolling: %s, it should be like "mean:price"`, s)
+		}
+		spec.op, spec.column = strings.ToLower(spec.column[:i]), spec.column[i+1:]
+		if spec.op == "stdev" {
+			spec.op = "std"
+		}
+		if _, ok := rollingStats[spec.op]; !ok {
+			return nil, fmt.Errorf("invalid rolling statistics: %s. available: mean, sum, min, max, std", spec.op)
+		}
+	case "lag", "lead":
+		spec.n = 1
+		if i := strings.LastIndex(spec.column, ":"); i >= 0 {
+			n, err := strconv.Atoi(spec.column[i+1:])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf(`invalid value of --%s: %s, it should be like "price:1"`, kind, s)
+			}
+			spec.n, spec.column = n, spec.column[:i]
+		}
+	}
+	if spec.column == "" {
+		return nil, fmt.Errorf("column needed in --%s: %s", kind, s)
+	}
+	return spec, nil
+}
+
+// windowRanks returns ranks of records in a partition. If numeric is true,
+// values are compared as numbers, and non-numeric values get the rank 0.
+func windowRanks(records [][]string, rows []int, field int, desc bool, dense bool, numeric bool) []int {
+	vals := make([]string, len(rows))
+	nums := make([]float64, len(rows))
+	idx := make([]int, 0, len(rows)) // records to rank
+	var err error
+	for k, r := range rows {
+		vals[k] = records[r][field-1]
+		if numeric {
+			if !reDigitals.MatchString(vals[k]) {
+				continue
+			}
+			if nums[k], err = strconv.ParseFloat(removeComma(vals[k]), 64); err != nil {
+				continue
+			}
+		}
+		idx = append(idx, k)
+	}
+	less := func(a, b int) bool {
+		if numeric {
+			return nums[a] < nums[b]
+		}
+		return vals[a] < vals[b]
+	}
+	if desc {
+		less0 := less
+		less = func(a, b int) bool { return less0(b, a) }
+	}
+
+	sort.SliceStable(idx, func(i, j int) bool { return less(idx[i], idx[j]) })
+
+	ranks := make([]int, len(rows))
+	var rank, dRank int
+	for i, k := range idx {
+		if i == 0 || less(idx[i-1], k) {
+			rank = i + 1
+			dRank++
+		}
+		if dense {
+			ranks[k] = dRank
+		} else {
+			ranks[k] = rank
+		}
+	}
+	return ranks
+}
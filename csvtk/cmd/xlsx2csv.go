@@ -21,12 +21,11 @@
 package cmd
 
 import (
-	"encoding/csv"
+	"bytes"
 	"fmt"
 	"runtime"
 	"sort"
 
-	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 	"github.com/xuri/excelize/v2"
 )
@@ -39,6 +38,13 @@ var xlsx2csvCmd = &cobra.Command{
 	Short: "convert XLSX to CSV format",
 	Long: `convert XLSX to CSV format
 
+The input can also be a http(s) URL, e.g., a Google Sheets document
+exported as XLSX:
+
+    csvtk xlsx2csv "https://docs.google.com/spreadsheets/d/<ID>/export?format=xlsx"
+
+Use the global flag --http-header to set headers like "Authorization".
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -56,11 +62,11 @@ var xlsx2csvCmd = &cobra.Command{
 		sheetName := getFlagString(cmd, "sheet-name")
 		sheetIndex := getFlagPositiveInt(cmd, "sheet-index")
 
-		outfh, err := xopen.Wopen(config.OutFile)
+		outfh, err := wopen(config.OutFile)
 		checkError(err)
 		defer outfh.Close()
 
-		xlsx, err := excelize.OpenFile(files[0])
+		xlsx, err := openXLSX(files[0])
 		checkError(err)
 
 		sheets := xlsx.GetSheetMap()
@@ -97,7 +103,7 @@ var xlsx2csvCmd = &cobra.Command{
 			}
 		}
 
-		writer := csv.NewWriter(outfh)
+		writer := newCSVWriter(outfh)
 		if config.OutTabs || config.Tabs {
 			if config.OutDelimiter == ',' {
 				writer.Comma = '\t'
@@ -176,3 +182,53 @@ func init() {
 	xlsx2csvCmd.Flags().BoolP("list-sheets", "a", false, "list all sheets")
 	xlsx2csvCmd.Flags().IntP("sheet-index", "i", 1, "Nth sheet to retrieve")
 }
+
+// openXLSX opens a local XLSX file or a http(s) URL.
+func openXLSX(file string) (*excelize.File, error) {
+	if !isURL(file) {
+		return excelize.OpenFile(file)
+	}
+	rc, err := openURL(file)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return excelize.OpenReader(rc)
+}
+
+// newXLSXSource creates a source of records from the first sheet of a XLSX file.
+// Rows are padded with empty cells to the same number of columns.
+func newXLSXSource(file string) (*sliceSource, error) {
+	var xlsx *excelize.File
+	var err error
+	if isStdin(file) || inCompressed() {
+		var data []byte
+		if data, err = readAllDecompressed(file); err != nil {
+			return nil, err
+		}
+		xlsx, err = excelize.OpenReader(bytes.NewReader(data))
+	} else {
+		xlsx, err = openXLSX(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file %s: %s", file, err)
+	}
+	defer xlsx.Close()
+
+	rows, err := xlsx.GetRows(xlsx.GetSheetName(0), excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file %s: %s", file, err)
+	}
+	var nColsMax int
+	for _, row := range rows {
+		if nColsMax < len(row) {
+			nColsMax = len(row)
+		}
+	}
+	for i, row := range rows {
+		if len(row) < nColsMax {
+			rows[i] = append(row, make([]string, nColsMax-len(row))...)
+		}
+	}
+	return &sliceSource{records: rows}, nil
+}
@@ -0,0 +1,219 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// yaml2csvCmd represents the yaml2csv command
+var yaml2csvCmd = &cobra.Command{
+	GroupID: "format",
+
+	Use:   "yaml2csv",
+	Short: "convert YAML to CSV format",
+	Long: `convert YAML to CSV format
+
+Input:
+  1. A sequence of mappings, e.g.,
+       - name: A
+         score: 95
+  2. Or a sequence of mappings under a top-level key given by -k/--key.
+  3. Or multiple documents of mappings, separated by "---".
+
+Columns are keys in the order of first appearance in all records.
+Nested values (mappings and sequences) are outputted in YAML flow style,
+e.g., [a, b] and {x: 1}. Null values are converted to empty strings,
+or the value of --na.
+
+This is the reverse operation of "csvtk csv2yaml".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		runtime.GOMAXPROCS(config.NumCPUs)
+
+		key := getFlagString(cmd, "key")
+		na := getFlagString(cmd, "na")
+
+		records := make([][][2]string, 0, 1024)
+		keys := make([]string, 0, 8)
+		keysMap := make(map[string]int)
+		for _, file := range files {
+			fh, err := ropen(file)
+			if err != nil {
+				if err == xopen.ErrNoContent {
+					if config.Verbose {
+						log.Warningf("csvtk yaml2csv: skipping empty input file: %s", file)
+					}
+					continue
+				}
+				checkError(err)
+			}
+
+			dec := yaml.NewDecoder(fh)
+			for {
+				var doc yaml.Node
+				err = dec.Decode(&doc)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					checkError(fmt.Errorf("%s: %s", file, err))
+				}
+				if len(doc.Content) == 0 {
+					continue
+				}
+
+				node := doc.Content[0]
+				if key != "" {
+					node = yamlMappingValue(node, key)
+					if node == nil {
+						checkError(fmt.Errorf("%s: key not found: %s", file, key))
+					}
+				}
+
+				var items []*yaml.Node
+				switch node.Kind {
+				case yaml.SequenceNode:
+					items = node.Content
+				case yaml.MappingNode:
+					items = []*yaml.Node{node}
+				default:
+					checkError(fmt.Errorf("%s: a sequence of mappings or mappings expected", file))
+				}
+
+				for _, item := range items {
+					if item.Kind == yaml.AliasNode {
+						item = item.Alias
+					}
+					if item.Kind != yaml.MappingNode {
+						checkError(fmt.Errorf("%s: line %d: a mapping expected", file, item.Line))
+					}
+					record := make([][2]string, 0, len(item.Content)/2)
+					for i := 0; i+1 < len(item.Content); i += 2 {
+						k := item.Content[i].Value
+						if _, ok := keysMap[k]; !ok {
+							keysMap[k] = len(keys)
+							keys = append(keys, k)
+						}
+						v, err := yamlValue2String(item.Content[i+1], na)
+						checkError(err)
+						record = append(record, [2]string{k, v})
+					}
+					records = append(records, record)
+				}
+			}
+			checkError(fh.Close())
+		}
+
+		outfh, err := wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+
+		writer := newCSVWriter(outfh)
+		if config.OutTabs || config.Tabs {
+			if config.OutDelimiter == ',' {
+				writer.Comma = '\t'
+			} else {
+				writer.Comma = config.OutDelimiter
+			}
+		} else {
+			writer.Comma = config.OutDelimiter
+		}
+		defer func() {
+			writer.Flush()
+			checkError(writer.Error())
+		}()
+
+		if len(keys) == 0 {
+			return
+		}
+		if !config.NoOutHeader {
+			checkError(writer.Write(keys))
+		}
+		row := make([]string, len(keys))
+		for _, record := range records {
+			for i := range row {
+				row[i] = na
+			}
+			for _, kv := range record {
+				row[keysMap[kv[0]]] = kv[1]
+			}
+			checkError(writer.Write(row))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(yaml2csvCmd)
+	yaml2csvCmd.Flags().StringP("key", "k", "", "top-level key of the sequence of mappings")
+	yaml2csvCmd.Flags().StringP("na", "", "", "string for null values and missing keys")
+}
+
+// yamlMappingValue returns the value of a key in a mapping node.
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlValue2String converts a YAML node to a string, nested values are
+// outputted in flow style.
+func yamlValue2String(node *yaml.Node, na string) (string, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode {
+		if node.ShortTag() == "!!null" {
+			return na, nil
+		}
+		return node.Value, nil
+	}
+
+	setFlowStyle(node)
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+func setFlowStyle(node *yaml.Node) {
+	node.Style |= yaml.FlowStyle
+	for _, c := range node.Content {
+		setFlowStyle(c)
+	}
+}
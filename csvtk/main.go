@@ -18,6 +18,10 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+// csvtk sample -p relies on rand.Seed seeding the global source.
+//
+//go:debug randseednop=0
+
 package main
 
 import (
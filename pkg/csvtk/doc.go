@@ -0,0 +1,45 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package csvtk provides composable readers, transformers and writers of
+// CSV/TSV data, for doing what the csvtk command does in Go programs.
+//
+// A Reader returns records one by one, a Transformer wraps a Reader into a
+// new one, and records are written by WriteCSV. Transformers are lazy,
+// records are only read when the final Reader is consumed.
+//
+//	people, _ := os.Open("people.csv")
+//	regions, _ := os.Open("regions.csv")
+//
+//	r, err := csvtk.Pipe(
+//		csvtk.NewCSVReader(people, csvtk.CSVOptions{}),
+//		csvtk.FilterExpr(`$age > 30`),
+//		csvtk.Join(csvtk.NewCSVReader(regions, csvtk.CSVOptions{}),
+//			[]string{"region"}, []string{"code"}, csvtk.JoinOptions{Type: csvtk.LeftJoin}),
+//		csvtk.MutateExpr("decade", `$age / 10`),
+//		csvtk.Select("name", "country", "decade"),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err = csvtk.WriteCSV(os.Stdout, r, csvtk.CSVOptions{}); err != nil {
+//		log.Fatal(err)
+//	}
+package csvtk
@@ -0,0 +1,189 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package csvtk
+
+import (
+	"fmt"
+	"io"
+)
+
+// JoinType is the type of joins.
+type JoinType int
+
+const (
+	// InnerJoin keeps records with keys found in both tables.
+	InnerJoin JoinType = iota
+	// LeftJoin keeps all records of the left table.
+	LeftJoin
+	// OuterJoin keeps all records of both tables.
+	OuterJoin
+)
+
+// JoinOptions contains options of Join.
+type JoinOptions struct {
+	Type       JoinType
+	IgnoreCase bool                  // ignore case of keys
+	Transforms []func(string) string // normalizing values of keys, see ParseKeyTransforms
+	Fill       string                // value for missing cells in left and outer joins
+	Suffix     string                // suffix for columns of the right table with duplicated names, "_2" by default
+}
+
+// Join joins the right table to the input (the left table) by keys, like
+// "csvtk join", with keys encoded by KeyEncoder in the same way. The right table is read into memory, while the left one is
+// streamed. Key columns of the right table are not output, and records of
+// the right table only are appended after all records of the left table
+// for outer joins.
+func Join(right Reader, leftKeys, rightKeys []string, opt JoinOptions) Transformer {
+	return TransformerFunc(func(left Reader) (Reader, error) {
+		if len(leftKeys) == 0 || len(leftKeys) != len(rightKeys) {
+			return nil, fmt.Errorf("the numbers of keys of both tables should be equal and positive")
+		}
+		li, err := columnIndexes(left.Header(), leftKeys)
+		if err != nil {
+			return nil, fmt.Errorf("left table: %s", err)
+		}
+		ri, err := columnIndexes(right.Header(), rightKeys)
+		if err != nil {
+			return nil, fmt.Errorf("right table: %s", err)
+		}
+		suffix := opt.Suffix
+		if suffix == "" {
+			suffix = "_2"
+		}
+
+		// columns of the right table to output
+		isKey := make(map[int]bool, len(ri))
+		for _, i := range ri {
+			isKey[i] = true
+		}
+		names := make(map[string]bool, len(left.Header()))
+		for _, col := range left.Header() {
+			names[col] = true
+		}
+		header := append([]string(nil), left.Header()...)
+		var values []int
+		for i, col := range right.Header() {
+			if isKey[i] {
+				continue
+			}
+			for names[col] {
+				col += suffix
+			}
+			names[col] = true
+			values = append(values, i)
+			header = append(header, col)
+		}
+
+		leftFields, rightFields := make([]int, len(li)), make([]int, len(ri))
+		for i := range li {
+			leftFields[i], rightFields[i] = li[i]+1, ri[i]+1
+		}
+		keyEncoder := &KeyEncoder{IgnoreCase: opt.IgnoreCase, Transforms: opt.Transforms}
+
+		// read the right table
+		index := make(map[string][]Record, 1024)
+		var order []string
+		for {
+			record, err := right.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("right table: %s", err)
+			}
+			k, _, _ := keyEncoder.Key(record, rightFields)
+			if _, ok := index[k]; !ok {
+				order = append(order, k)
+			}
+			index[k] = append(index[k], record)
+		}
+		matched := make(map[string]bool, len(index))
+
+		nLeft := len(left.Header())
+		var pending []Record
+		var leftDone bool
+		var unmatched int // index of order for outer joins
+		return &funcReader{header: header, read: func() (Record, error) {
+			for {
+				if len(pending) > 0 {
+					record := pending[0]
+					pending = pending[1:]
+					return record, nil
+				}
+
+				if leftDone {
+					if opt.Type != OuterJoin {
+						return nil, io.EOF
+					}
+					for unmatched < len(order) && matched[order[unmatched]] {
+						unmatched++
+					}
+					if unmatched == len(order) {
+						return nil, io.EOF
+					}
+					for _, rr := range index[order[unmatched]] {
+						out := make(Record, len(header))
+						for i := 0; i < nLeft; i++ {
+							out[i] = opt.Fill
+						}
+						for i, j := range li {
+							out[j] = rr[ri[i]]
+						}
+						for i, j := range values {
+							out[nLeft+i] = rr[j]
+						}
+						pending = append(pending, out)
+					}
+					unmatched++
+					continue
+				}
+
+				record, err := left.Read()
+				if err == io.EOF {
+					leftDone = true
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				k, _, _ := keyEncoder.Key(record, leftFields)
+				rights, ok := index[k]
+				if !ok {
+					if opt.Type == InnerJoin {
+						continue
+					}
+					out := append(make(Record, 0, len(header)), record...)
+					for range values {
+						out = append(out, opt.Fill)
+					}
+					return out, nil
+				}
+				matched[k] = true
+				for _, rr := range rights {
+					out := append(make(Record, 0, len(header)), record...)
+					for _, j := range values {
+						out = append(out, rr[j])
+					}
+					pending = append(pending, out)
+				}
+			}
+		}}, nil
+	})
+}
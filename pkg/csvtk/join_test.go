@@ -0,0 +1,82 @@
+package csvtk
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	regions := func() Reader {
+		return NewSliceReader([]string{"code", "region", "name"}, [][]string{
+			{"eu", "Europe", "EU"},
+			{"US", "United States", "US"},
+			{"AS", "Asia", "AS"},
+		})
+	}
+	left := func() Reader {
+		return NewSliceReader([]string{"name", "code"}, [][]string{
+			{"Ann", "EU"},
+			{"Bob", "CN"},
+			{"Cat", "US"},
+		})
+	}
+
+	tests := []struct {
+		opt    JoinOptions
+		header []string
+		rows   []Record
+	}{
+		{JoinOptions{}, []string{"name", "code", "region", "name_2"}, []Record{
+			{"Cat", "US", "United States", "US"},
+		}},
+		{JoinOptions{Type: LeftJoin, IgnoreCase: true, Fill: "NA"}, []string{"name", "code", "region", "name_2"}, []Record{
+			{"Ann", "EU", "Europe", "EU"},
+			{"Bob", "CN", "NA", "NA"},
+			{"Cat", "US", "United States", "US"},
+		}},
+		{JoinOptions{Type: OuterJoin, Suffix: ".r"}, []string{"name", "code", "region", "name.r"}, []Record{
+			{"Ann", "EU", "", ""},
+			{"Bob", "CN", "", ""},
+			{"Cat", "US", "United States", "US"},
+			{"", "eu", "Europe", "EU"},
+			{"", "AS", "Asia", "AS"},
+		}},
+	}
+	for i, test := range tests {
+		r, err := Pipe(left(), Join(regions(), []string{"code"}, []string{"code"}, test.opt))
+		header, rows := readRows(t, r, err)
+		if !slices.Equal(header, test.header) {
+			t.Errorf("test %d: header: want %q, got %q", i, test.header, header)
+		}
+		if !slices.EqualFunc(rows, test.rows, slices.Equal) {
+			t.Errorf("test %d: records: want %q, got %q", i, test.rows, rows)
+		}
+	}
+}
+
+func TestJoinCompositeKeys(t *testing.T) {
+	// values of multiple key fields never collide
+	right := NewSliceReader([]string{"a", "b", "v"}, [][]string{{"a\x00b", "c", "1"}})
+	left := NewSliceReader([]string{"a", "b"}, [][]string{{"a", "b\x00c"}, {"a\x00b", "c"}})
+	r, err := Pipe(left, Join(right, []string{"a", "b"}, []string{"a", "b"}, JoinOptions{}))
+	_, rows := readRows(t, r, err)
+	if len(rows) != 1 || rows[0][2] != "1" || rows[0][0] != "a\x00b" {
+		t.Errorf("records: %q", rows)
+	}
+
+	transforms, err := ParseKeyTransforms([]string{"strip-zeros"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	right = NewSliceReader([]string{"id", "v"}, [][]string{{"7", "x"}})
+	left = NewSliceReader([]string{"id"}, [][]string{{"007"}})
+	r, err = Pipe(left, Join(right, []string{"id"}, []string{"id"}, JoinOptions{Transforms: transforms}))
+	_, rows = readRows(t, r, err)
+	if len(rows) != 1 || rows[0][1] != "x" {
+		t.Errorf("records with key transforms: %q", rows)
+	}
+
+	if _, err = Pipe(left, Join(right, []string{"id"}, nil, JoinOptions{})); err == nil {
+		t.Errorf("error expected for different numbers of keys")
+	}
+}
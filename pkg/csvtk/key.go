@@ -0,0 +1,125 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package csvtk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeyEncoder encodes values of key fields into a key, for joining tables or
+// grouping records. It's also used by csvtk commands like join, uniq and diff.
+//
+// By default, values are delimited by NUL characters, and NUL and \x01 in values
+// are escaped, so keys of different values never collide, and keys sort like
+// tuples of values. If Sep is given, values are simply joined with it, and an
+// error is returned if any value contains Sep.
+type KeyEncoder struct {
+	Sep        string
+	IgnoreCase bool
+	IgnoreNull bool // treat keys with any empty value as NULL
+	Transforms []func(string) string
+
+	buf strings.Builder
+}
+
+// Key returns the key of a record, and whether it's NULL.
+// fields are 1-based, like column numbers of csvtk.
+func (e *KeyEncoder) Key(record []string, fields []int) (string, bool, error) {
+	e.buf.Reset()
+	var v string
+	for i, f := range fields {
+		v = record[f-1]
+		if e.IgnoreNull && v == "" {
+			return "", true, nil
+		}
+		if e.IgnoreCase {
+			v = strings.ToLower(v)
+		}
+		for _, t := range e.Transforms {
+			v = t(v)
+		}
+
+		if e.Sep != "" {
+			if strings.Contains(v, e.Sep) {
+				return "", false, fmt.Errorf("value of key field contains the key separator (%q): %s", e.Sep, v)
+			}
+			if i > 0 {
+				e.buf.WriteString(e.Sep)
+			}
+			e.buf.WriteString(v)
+			continue
+		}
+
+		if i > 0 {
+			e.buf.WriteByte(0)
+		}
+		if strings.ContainsAny(v, "\x00\x01") {
+			v = keyEscaper.Replace(v)
+		}
+		e.buf.WriteString(v)
+	}
+	return e.buf.String(), false, nil
+}
+
+var keyEscaper = strings.NewReplacer("\x01", "\x01\x02", "\x00", "\x01\x01")
+
+// KeyTransforms are functions for normalizing values of key fields.
+var KeyTransforms = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"strip-zeros": func(v string) string { // "007" -> "7", "000" -> "0", "00.5" -> "0.5"
+		var sign string
+		if len(v) > 0 && (v[0] == '-' || v[0] == '+') {
+			sign, v = v[:1], v[1:]
+		}
+		v = strings.TrimLeft(v, "0")
+		if v == "" || v[0] == '.' {
+			v = "0" + v
+		}
+		return sign + v
+	},
+	"numeric": func(v string) string { // "1.50" -> "1.5", "1e3" -> "1000"
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil { // non-numeric values are kept
+			return v
+		}
+		if f == 0 { // -0
+			f = 0
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	},
+}
+
+// ParseKeyTransforms returns functions of KeyTransforms by names.
+func ParseKeyTransforms(names []string) ([]func(string) string, error) {
+	transforms := make([]func(string) string, 0, len(names))
+	for _, name := range names {
+		t, ok := KeyTransforms[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid key transform: %s. available: trim, lower, upper, strip-zeros, numeric", name)
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
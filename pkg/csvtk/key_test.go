@@ -0,0 +1,89 @@
+package csvtk
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestKeyEncoder(t *testing.T) {
+	// values containing delimiters, NUL and \x01 which collide with naive encodings
+	records := [][]string{
+		{"a", "b,c"},
+		{"a,b", "c"},
+		{"a\x00b", "c"},
+		{"a", "b\x00c"},
+		{"a\x01", "c"},
+		{"a", "\x01c"},
+		{"a\x01\x01", ""},
+		{"a\x01", "\x01"},
+		{"a", ""},
+		{"", "a"},
+		{"", ""},
+		{"ab", "c"},
+		{"a", "bc"},
+	}
+	fields := []int{1, 2}
+
+	e := &KeyEncoder{}
+	keys := make(map[string][]string, len(records))
+	for _, record := range records {
+		key, null, err := e.Key(record, fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if null {
+			t.Errorf("unexpected NULL key of record: %q", record)
+		}
+		if r, ok := keys[key]; ok {
+			t.Errorf("key collision: %q and %q", r, record)
+		}
+		keys[key] = record
+	}
+
+	// keys sort like tuples of values
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for i := 1; i < len(sorted); i++ {
+		a, b := keys[sorted[i-1]], keys[sorted[i]]
+		if slices.Compare(a, b) >= 0 {
+			t.Errorf("keys of %q and %q are not sorted like tuples", a, b)
+		}
+	}
+
+	// NULL keys
+	e = &KeyEncoder{IgnoreNull: true}
+	for _, record := range records {
+		_, null, _ := e.Key(record, fields)
+		if expect := record[0] == "" || record[1] == ""; null != expect {
+			t.Errorf("NULL key of record %q: want %v, got %v", record, expect, null)
+		}
+	}
+
+	// case and transforms
+	transforms, err := ParseKeyTransforms([]string{"trim", "strip-zeros"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = &KeyEncoder{IgnoreCase: true, Transforms: transforms}
+	k1, _, _ := e.Key([]string{" 007 ", "ABC"}, fields)
+	k2, _, _ := e.Key([]string{"7", "abc"}, fields)
+	if k1 != k2 {
+		t.Errorf("keys of normalized values should be equal: %q, %q", k1, k2)
+	}
+
+	// custom separator
+	e = &KeyEncoder{Sep: "|"}
+	if key, _, _ := e.Key([]string{"a", "b"}, fields); key != "a|b" {
+		t.Errorf("key with separator: want %q, got %q", "a|b", key)
+	}
+	if _, _, err = e.Key([]string{"a|b", "c"}, fields); err == nil {
+		t.Errorf("value containing the separator should be reported")
+	}
+	if _, err = ParseKeyTransforms([]string{"trim", "nope"}); err == nil {
+		t.Errorf("invalid key transform should be reported")
+	}
+}
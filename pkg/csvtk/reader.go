@@ -0,0 +1,205 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package csvtk
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Record is a row of a table.
+type Record []string
+
+// Reader reads records of a table. Read returns io.EOF at the end.
+type Reader interface {
+	// Header returns column names.
+	Header() []string
+	// Read returns the next record, which should not be modified by callers.
+	Read() (Record, error)
+}
+
+// CSVOptions contains options of reading and writing CSV/TSV data.
+type CSVOptions struct {
+	Comma       rune // field delimiter, ',' by default
+	Comment     rune // lines starting with it are ignored when reading, no comment by default
+	LazyQuotes  bool // see csv.Reader.LazyQuotes
+	NoHeaderRow bool // no header row, columns are named as c1, c2, ...
+}
+
+func (opt CSVOptions) comma() rune {
+	if opt.Comma == 0 {
+		return ','
+	}
+	return opt.Comma
+}
+
+// CSVReader reads records from CSV/TSV data.
+type CSVReader struct {
+	reader *csv.Reader
+	header []string
+	first  Record // first record for data without header row
+	err    error
+}
+
+// NewCSVReader creates a reader of CSV/TSV data. The header row is read
+// immediately, and errors are returned by Read.
+func NewCSVReader(r io.Reader, opt CSVOptions) *CSVReader {
+	reader := csv.NewReader(r)
+	reader.Comma = opt.comma()
+	reader.Comment = opt.Comment
+	reader.LazyQuotes = opt.LazyQuotes
+	reader.ReuseRecord = false
+
+	cr := &CSVReader{reader: reader}
+	record, err := reader.Read()
+	if err != nil {
+		cr.err = err
+		return cr
+	}
+	if opt.NoHeaderRow {
+		cr.header = defaultColumnNames(len(record))
+		cr.first = record
+	} else {
+		cr.header = record
+	}
+	return cr
+}
+
+// Header returns column names.
+func (r *CSVReader) Header() []string { return r.header }
+
+// Read returns the next record.
+func (r *CSVReader) Read() (Record, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.first != nil {
+		record := r.first
+		r.first = nil
+		return record, nil
+	}
+	record, err := r.reader.Read()
+	if err != nil {
+		r.err = err
+		return nil, err
+	}
+	return record, nil
+}
+
+// SliceReader reads records from a slice.
+type SliceReader struct {
+	header []string
+	rows   [][]string
+	i      int
+}
+
+// NewSliceReader creates a reader of records in memory.
+func NewSliceReader(header []string, rows [][]string) *SliceReader {
+	return &SliceReader{header: header, rows: rows}
+}
+
+// Header returns column names.
+func (r *SliceReader) Header() []string { return r.header }
+
+// Read returns the next record.
+func (r *SliceReader) Read() (Record, error) {
+	if r.i >= len(r.rows) {
+		return nil, io.EOF
+	}
+	r.i++
+	return r.rows[r.i-1], nil
+}
+
+// ReadAll reads all records of a reader.
+func ReadAll(r Reader) ([]string, []Record, error) {
+	var rows []Record
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return r.Header(), rows, nil
+		}
+		if err != nil {
+			return r.Header(), rows, err
+		}
+		rows = append(rows, record)
+	}
+}
+
+// WriteCSV writes the header row and all records of a reader.
+func WriteCSV(w io.Writer, r Reader, opt CSVOptions) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = opt.comma()
+	if !opt.NoHeaderRow {
+		if err := writer.Write(r.Header()); err != nil {
+			return err
+		}
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func defaultColumnNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("c%d", i+1)
+	}
+	return names
+}
+
+// columnIndex returns the index of a column, given by the name or
+// the 1-based number.
+func columnIndex(header []string, col string) (int, error) {
+	for i, name := range header {
+		if name == col {
+			return i, nil
+		}
+	}
+	var n int
+	if _, err := fmt.Sscanf(col, "%d", &n); err == nil && fmt.Sprint(n) == col && n >= 1 && n <= len(header) {
+		return n - 1, nil
+	}
+	return -1, fmt.Errorf("column not found: %s (available: %s)", col, strings.Join(header, ", "))
+}
+
+func columnIndexes(header []string, cols []string) ([]int, error) {
+	indexes := make([]int, len(cols))
+	for i, col := range cols {
+		j, err := columnIndex(header, col)
+		if err != nil {
+			return nil, err
+		}
+		indexes[i] = j
+	}
+	return indexes, nil
+}
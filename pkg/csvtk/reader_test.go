@@ -0,0 +1,60 @@
+package csvtk
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCSVReader(t *testing.T) {
+	data := "name,age\n\"Smith, J\",30\nLee,25\n"
+	r := NewCSVReader(strings.NewReader(data), CSVOptions{})
+	header, rows, err := ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(header, []string{"name", "age"}) {
+		t.Errorf("header: %q", header)
+	}
+	if len(rows) != 2 || !slices.Equal(rows[0], Record{"Smith, J", "30"}) {
+		t.Errorf("records: %q", rows)
+	}
+
+	// no header row
+	r = NewCSVReader(strings.NewReader("a\tb\n# comment\nc\td\n"), CSVOptions{Comma: '\t', Comment: '#', NoHeaderRow: true})
+	header, rows, err = ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(header, []string{"c1", "c2"}) || len(rows) != 2 || !slices.Equal(rows[1], Record{"c", "d"}) {
+		t.Errorf("header: %q, records: %q", header, rows)
+	}
+
+	// empty data
+	r = NewCSVReader(strings.NewReader(""), CSVOptions{})
+	if _, err = r.Read(); err != io.EOF {
+		t.Errorf("empty data: want io.EOF, got %v", err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := NewSliceReader([]string{"a", "b"}, [][]string{{"1", "x y"}, {"2", "\"q\""}})
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, r, CSVOptions{Comma: '\t'}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\tb\n1\tx y\n2\t\"\"\"q\"\"\"\n"; buf.String() != want {
+		t.Errorf("want %q, got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	r = NewSliceReader([]string{"a"}, [][]string{{"1"}})
+	if err := WriteCSV(&buf, r, CSVOptions{NoHeaderRow: true}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "1\n" {
+		t.Errorf("no header row: got %q", buf.String())
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright © 2016-2023 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package csvtk
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Transformer transforms a reader into a new one.
+type Transformer interface {
+	Transform(r Reader) (Reader, error)
+}
+
+// TransformerFunc is a function implementing Transformer.
+type TransformerFunc func(r Reader) (Reader, error)
+
+// Transform calls f(r).
+func (f TransformerFunc) Transform(r Reader) (Reader, error) { return f(r) }
+
+// Pipe applies transformers in order.
+func Pipe(r Reader, transformers ...Transformer) (Reader, error) {
+	var err error
+	for _, t := range transformers {
+		if r, err = t.Transform(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// funcReader is a reader with a header and a function returning records.
+type funcReader struct {
+	header []string
+	read   func() (Record, error)
+}
+
+func (r *funcReader) Header() []string      { return r.header }
+func (r *funcReader) Read() (Record, error) { return r.read() }
+
+// Filter keeps records for which fn returns true.
+func Filter(fn func(header []string, record Record) (bool, error)) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		header := r.Header()
+		return &funcReader{header: header, read: func() (Record, error) {
+			for {
+				record, err := r.Read()
+				if err != nil {
+					return nil, err
+				}
+				ok, err := fn(header, record)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return record, nil
+				}
+			}
+		}}, nil
+	})
+}
+
+// FilterExpr keeps records matching an expression like "csvtk filter2",
+// e.g., `$age > 30 && $region == "EU"`. Columns are referred by $name,
+// ${name with spaces} or $number, and numeric values are compared as numbers.
+func FilterExpr(expr string) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		e, err := compileExpr(expr, r.Header())
+		if err != nil {
+			return nil, err
+		}
+		return Filter(func(_ []string, record Record) (bool, error) {
+			v, err := e.eval(record)
+			if err != nil {
+				return false, err
+			}
+			ok, isBool := v.(bool)
+			if !isBool {
+				return false, fmt.Errorf("expression does not return a boolean value: %s", expr)
+			}
+			return ok, nil
+		}).Transform(r)
+	})
+}
+
+// Mutate appends a new column, with values computed by fn.
+func Mutate(name string, fn func(header []string, record Record) (string, error)) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		header := r.Header()
+		for _, col := range header {
+			if col == name {
+				return nil, fmt.Errorf("column existed: %s", name)
+			}
+		}
+		newHeader := append(append(make([]string, 0, len(header)+1), header...), name)
+		return &funcReader{header: newHeader, read: func() (Record, error) {
+			record, err := r.Read()
+			if err != nil {
+				return nil, err
+			}
+			v, err := fn(header, record)
+			if err != nil {
+				return nil, err
+			}
+			return append(append(make(Record, 0, len(record)+1), record...), v), nil
+		}}, nil
+	})
+}
+
+// MutateExpr appends a new column, with values computed by an expression
+// like "csvtk mutate2", e.g., `$a + $b`. Floats are formatted with 2 decimal
+// places.
+func MutateExpr(name string, expr string) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		e, err := compileExpr(expr, r.Header())
+		if err != nil {
+			return nil, err
+		}
+		return Mutate(name, func(_ []string, record Record) (string, error) {
+			v, err := e.eval(record)
+			if err != nil {
+				return "", err
+			}
+			switch v := v.(type) {
+			case float64:
+				return strconv.FormatFloat(v, 'f', 2, 64), nil
+			case nil:
+				return "", nil
+			default:
+				return fmt.Sprint(v), nil
+			}
+		}).Transform(r)
+	})
+}
+
+// Select keeps the given columns in the given order. Columns are given by
+// names or 1-based numbers.
+func Select(cols ...string) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		indexes, err := columnIndexes(r.Header(), cols)
+		if err != nil {
+			return nil, err
+		}
+		header := make([]string, len(indexes))
+		for i, j := range indexes {
+			header[i] = r.Header()[j]
+		}
+		return &funcReader{header: header, read: func() (Record, error) {
+			record, err := r.Read()
+			if err != nil {
+				return nil, err
+			}
+			out := make(Record, len(indexes))
+			for i, j := range indexes {
+				out[i] = record[j]
+			}
+			return out, nil
+		}}, nil
+	})
+}
+
+// Rename renames columns with a map of old names to new names.
+func Rename(names map[string]string) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		header := append([]string(nil), r.Header()...)
+		for old, name := range names {
+			i, err := columnIndex(header, old)
+			if err != nil {
+				return nil, err
+			}
+			header[i] = name
+		}
+		return &funcReader{header: header, read: r.Read}, nil
+	})
+}
+
+// Head keeps the first n records.
+func Head(n int) Transformer {
+	return TransformerFunc(func(r Reader) (Reader, error) {
+		var i int
+		return &funcReader{header: r.Header(), read: func() (Record, error) {
+			if i >= n {
+				return nil, io.EOF
+			}
+			i++
+			return r.Read()
+		}}, nil
+	})
+}
+
+var reExprVar = regexp.MustCompile(`\$\{([^}]+?)\}|\$([^ +-/*&\|^%><!~=()"',?:\[\]]+)`)
+
+// compiledExpr is an expression with columns replaced by parameters.
+type compiledExpr struct {
+	expr    *govaluate.EvaluableExpression
+	columns []int    // column indexes of parameters
+	names   []string // names of parameters
+	params  map[string]interface{}
+}
+
+func compileExpr(expr string, header []string) (*compiledExpr, error) {
+	e := &compiledExpr{params: make(map[string]interface{})}
+	var err error
+	s := reExprVar.ReplaceAllStringFunc(expr, func(m string) string {
+		sub := reExprVar.FindStringSubmatch(m)
+		col := sub[1]
+		if col == "" {
+			col = sub[2]
+		}
+		i, err2 := columnIndex(header, col)
+		if err2 != nil {
+			err = err2
+			return m
+		}
+		name := fmt.Sprintf("p%d", len(e.columns))
+		e.columns = append(e.columns, i)
+		e.names = append(e.names, name)
+		return "[" + name + "]"
+	})
+	if err != nil {
+		return nil, err
+	}
+	if e.expr, err = govaluate.NewEvaluableExpression(s); err != nil {
+		return nil, fmt.Errorf("invalid expression: %s: %s", expr, err)
+	}
+	return e, nil
+}
+
+func (e *compiledExpr) eval(record Record) (interface{}, error) {
+	for i, j := range e.columns {
+		v := record[j]
+		if f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64); err == nil {
+			e.params[e.names[i]] = f
+		} else {
+			e.params[e.names[i]] = v
+		}
+	}
+	return e.expr.Evaluate(e.params)
+}
@@ -0,0 +1,84 @@
+package csvtk
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func people() Reader {
+	return NewSliceReader([]string{"name", "age", "region"}, [][]string{
+		{"Ann", "35", "EU"},
+		{"Bob", "28", "US"},
+		{"Cat", "41", "US"},
+		{"Dan", "52", "EU"},
+	})
+}
+
+func readRows(t *testing.T, r Reader, err error) ([]string, []Record) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, rows, err := ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header, rows
+}
+
+func TestPipe(t *testing.T) {
+	r, err := Pipe(people(),
+		FilterExpr(`$age > 30 && $region == "US"`),
+		MutateExpr("decade", `$age / 10`),
+		Rename(map[string]string{"name": "who"}),
+		Select("who", "decade"),
+	)
+	header, rows := readRows(t, r, err)
+	if !slices.Equal(header, []string{"who", "decade"}) {
+		t.Errorf("header: %q", header)
+	}
+	if len(rows) != 1 || !slices.Equal(rows[0], Record{"Cat", "4.10"}) {
+		t.Errorf("records: %q", rows)
+	}
+}
+
+func TestTransformers(t *testing.T) {
+	// columns by numbers, and ${name}
+	r, err := Pipe(people(), FilterExpr(`${region} == "EU"`), Select("1"))
+	_, rows := readRows(t, r, err)
+	if len(rows) != 2 || rows[0][0] != "Ann" || rows[1][0] != "Dan" {
+		t.Errorf("filter: %q", rows)
+	}
+
+	r, err = Pipe(people(), Head(2))
+	_, rows = readRows(t, r, err)
+	if len(rows) != 2 {
+		t.Errorf("head: %q", rows)
+	}
+
+	r, err = Pipe(people(), Mutate("id", func(header []string, record Record) (string, error) {
+		return fmt.Sprintf("%s-%s", record[2], record[0]), nil
+	}))
+	_, rows = readRows(t, r, err)
+	if rows[1][3] != "US-Bob" {
+		t.Errorf("mutate: %q", rows)
+	}
+
+	// errors
+	for _, tr := range []Transformer{
+		Select("nope"),
+		FilterExpr(`$nope > 1`),
+		FilterExpr(`$age + 1`),
+		MutateExpr("age", `$age * 2`),
+		Rename(map[string]string{"nope": "x"}),
+	} {
+		r, err := Pipe(people(), tr)
+		if err == nil {
+			_, _, err = ReadAll(r)
+		}
+		if err == nil {
+			t.Errorf("error expected for transformer %T", tr)
+		}
+	}
+}
@@ -247,6 +247,648 @@ assert_equal $(seq 10 \
     | $app del-header) \
     20
 
+# ----------------------------------------------------------------------------
+# csvtk genrows
+# ----------------------------------------------------------------------------
+
+GENROWS_ARGS="-n 100 -c id:seq -c a:int:1,100 -c b:normal:0,1 -c c:corr:b,0.8 -c d:poisson:3 -c e:choice:x,y,z -c f:regex:[a-z]{3}[0-9]+ -c g:uuid"
+
+# same seed, same output
+fn() {
+    $app genrows $GENROWS_ARGS -S 11
+}
+run "genrows -S 11" fn
+assert_no_stderr
+assert_equal $(cat $STDOUT_FILE | md5sum | cut -d " " -f 1) $($app genrows $GENROWS_ARGS -S 11 | md5sum | cut -d " " -f 1)
+
+# different seeds, different output
+assert_equal $([ "$($app genrows $GENROWS_ARGS -S 11 | md5sum)" != "$($app genrows $GENROWS_ARGS -S 12 | md5sum)" ] && echo differ) differ
+
+# ----------------------------------------------------------------------------
+# csvtk sample
+# ----------------------------------------------------------------------------
+
+# sampling is reproducible with the same seed
+for SAMPLE_ARGS in "-p 0.1" "-N 5" "-N 2 -b 1" "-p 0.1 -b 1"; do
+    assert_equal $(seq 1000 | awk '{print $1%3","$1}' | $app sample -H $SAMPLE_ARGS -s 11 | md5sum | cut -d " " -f 1) \
+        $(seq 1000 | awk '{print $1%3","$1}' | $app sample -H $SAMPLE_ARGS -s 11 | md5sum | cut -d " " -f 1)
+done
+
+# ----------------------------------------------------------------------------
+# csvtk join
+# ----------------------------------------------------------------------------
+
+# outer join keeps the order of the first file, followed by records
+# with keys only existing in other files in order of appearance
+fn() {
+    $app join -f 1 testdata/phones.csv testdata/region.csv -O --na NA
+}
+run "join -O" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" \
+    "username,phone,region gri,11111,somewhere rob,12345,NA ken,22222,nowhere shenwei,999999,another Thompson,NA,there"
+
+fn() {
+    $app join -f 1 testdata/region.csv testdata/phones.csv --keep-unmatched-of 2 --na NA
+}
+run "join --keep-unmatched-of 2" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" \
+    "name,region,phone ken,nowhere,22222 gri,somewhere,11111 shenwei,another,999999 rob,NA,12345"
+
+# stdin is allowed for outer join
+assert_equal $(cat testdata/phones.csv | $app join -f 1 - testdata/region.csv -O --na NA | md5sum | cut -d " " -f 1) \
+    $($app join -f 1 testdata/phones.csv testdata/region.csv -O --na NA | md5sum | cut -d " " -f 1)
+
+# records are sorted by keys with --spill-to-disk
+assert_equal "$($app join -f 1 testdata/phones.csv testdata/region.csv -O --na NA --spill-to-disk | paste -s -d ' ')" \
+    "username,phone,region Thompson,NA,there gri,11111,somewhere ken,22222,nowhere rob,12345,NA shenwei,999999,another"
+
+# --na with values for each file, or a value containing ";" for all files
+assert_equal "$($app join -f 1 testdata/phones.csv testdata/region.csv -O --na 'NA;-' | tail -n 1)" "Thompson,NA,there"
+assert_equal "$($app join -f 1 testdata/phones.csv testdata/region.csv -O --na 'N;A;-' | tail -n 1)" "Thompson,N;A;-,there"
+
+# keys of multiple fields containing the delimiter, quotes, NUL and \x01, duplicated keys and empty keys
+printf 'k1,k2,a\na,"b,c",1\n"a,b",c,2\n"a\0b",c,3\na,"b\0c",4\na,"b\001c",5\n"a\001",c,6\n"a""",,7\n,,8\n' > join_a.csv
+printf 'k1,k2,b\na,"b,c",x\n"a,b",c,y\n"a\0b",c,z\na,"b\0c",w\na,"b\0c",w2\n"a\001",c,v\nq,q,u\nq,q,u2\n,,t\n' > join_b.csv
+printf 'k1,k2,c\nA,"B,C",i\n"a\0b",c,j\nq,q,k\n"a""",,l\n' > join_c.csv
+
+fn() {
+    $app join -f k1,k2 join_a.csv join_b.csv | tr '\000\001' '@#'
+}
+run "join keys with special characters" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" \
+    'k1,k2,a,b a,"b,c",1,x "a,b",c,2,y a@b,c,3,z a,b@c,4,w a,b@c,4,w2 a#,c,6,v ,,8,t'
+
+# the in-memory join and the join of spilled records give the same records
+for JOIN_OPTS in "" "-k" "-O" "--keep-unmatched-of 2" "--keep-unmatched-of 3" "--keep-unmatched-of 1,3" "-O -n" "-O -i" "-k --keep-fields 2:b"; do
+    assert_equal $($app join -f k1,k2 --na NA $JOIN_OPTS join_a.csv join_b.csv join_c.csv | sort | md5sum | cut -d " " -f 1) \
+        $($app join -f k1,k2 --na NA $JOIN_OPTS join_a.csv join_b.csv join_c.csv --spill-to-disk --buffer-size 1 2> /dev/null | sort | md5sum | cut -d " " -f 1)
+done
+
+rm join_a.csv join_b.csv join_c.csv
+
+# ----------------------------------------------------------------------------
+# csvtk sql
+# ----------------------------------------------------------------------------
+
+# -q/--query does not collide with the global flag --quiet
+fn() {
+    $app sql --quiet -q "select username from phones where phone = '22222'" testdata/phones.csv
+}
+run "sql -q" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "username ken"
+
+# ----------------------------------------------------------------------------
+# csvtk bin
+# ----------------------------------------------------------------------------
+
+# the outermost edges are included in the labels
+assert_equal "$((echo v; seq 100) | $app bin -f v -b 4 | $app cut -f v_bin | $app uniq -f 1 | $app del-header | paste -s -d ' ')" \
+    '"[1,25.75)" "[25.75,50.5)" "[50.5,75.25)" "[75.25,100]"'
+assert_equal "$((echo v; seq 100) | $app bin -f v -b 4 -r | $app cut -f v_bin | $app uniq -f 1 | $app del-header | paste -s -d ' ')" \
+    '"[1,25.75]" "(25.75,50.5]" "(50.5,75.25]" "(75.25,100]"'
+
+# ----------------------------------------------------------------------------
+# csvtk geo
+# ----------------------------------------------------------------------------
+
+# nearest reference city with bundled data, points far from land get --na
+fn() {
+    printf 'id,lat,lon\nparis,48.85,2.35\ntokyo,35.68,139.76\nocean,-40,-30\nbad,x,1\n' \
+        | $app geo nearest -c lat,lon --na NA
+}
+run "geo nearest" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" \
+    "id,lat,lon,country_code,country,timezone paris,48.85,2.35,FR,France,Europe/Paris tokyo,35.68,139.76,JP,Japan,Asia/Tokyo ocean,-40,-30,NA,NA,NA bad,x,1,NA,NA,NA"
+
+fn() {
+    printf 'id,lat,lon\nparis,48.85,2.35\n' | $app geo nearest -c lat,lon -a timezone,distance -n tz,km -w 1
+}
+run "geo nearest -a -n" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,lat,lon,tz,km paris,48.85,2.35,Europe/Paris,2.2"
+
+# it's an approximation, points near borders may get the neighbouring country
+fn() {
+    printf 'id,lat,lon\nstrasbourg,48.58,7.75\nwindsor,42.30,-83.02\n' | $app geo nearest -c lat,lon -a country_code,timezone
+}
+run "geo nearest near borders" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,lat,lon,country_code,timezone strasbourg,48.58,7.75,DE,Europe/Busingen windsor,42.30,-83.02,US,America/Detroit"
+
+
+# ----------------------------------------------------------------------------
+# csvtk pivot
+# ----------------------------------------------------------------------------
+
+pivot_data='region,month,sales\nnorth,jan,1\nsouth,jan,2\nnorth,feb,3\nnorth,jan,4\nsouth,mar,NA\n'
+
+# non-numeric values
+fn() {
+    printf "$pivot_data" | $app pivot -r region -c month -v sales -a sum
+}
+run "pivot non-numeric" fn
+assert_exit_code 255
+assert_in_stderr "non-numeric value: NA"
+
+# sum, with ignored non-numeric values, sorted columns and filled cells
+fn() {
+    printf "$pivot_data" | $app pivot -r region -c month -v sales -a sum -i -S --fill 0
+}
+run "pivot sum" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "region,feb,jan,mar north,3.00,5.00,0.00 south,0.00,2.00,0.00"
+
+# count needs no values, columns in order of appearance
+fn() {
+    printf "$pivot_data" | $app pivot -r region -c month -a count --fill 0
+}
+run "pivot count" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "region,jan,feb,mar north,2,1,0 south,1,0,1"
+
+# textual fill is kept as it is
+fn() {
+    printf "$pivot_data" | $app pivot -r region -c month -v sales -a mean -i -w 1 --fill -
+}
+run "pivot mean" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "region,jan,feb,mar north,2.5,3.0,- south,2.0,-,-"
+
+fn() {
+    printf "$pivot_data" | $app pivot -r region -c month -v sales -a collapse -s '|'
+}
+run "pivot collapse" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "region,jan,feb,mar north,1|4,3, south,2,,NA"
+
+# rand is reproducible with the same seed
+assert_equal "$(seq 100 | awk 'BEGIN{print "g,c,v"} {print "a,x,"$1}' | $app pivot -r g -c c -v v -a rand --rand-seed 1 | md5sum)" \
+    "$(seq 100 | awk 'BEGIN{print "g,c,v"} {print "a,x,"$1}' | $app pivot -r g -c c -v v -a rand --rand-seed 1 | md5sum)"
+
+
+# ----------------------------------------------------------------------------
+# csvtk agg
+# ----------------------------------------------------------------------------
+
+agg_data='country,year,sales,customer\nUS,2020,10,a\nUS,2020,20,b\nCN,2021,5,a\nUS,2021,1,a\nCN,2021,NA,c\n'
+
+# named outputs of groups, in order of first appearance
+fn() {
+    printf "$agg_data" | $app agg -g country,year -i \
+        -e 'sum(sales) as total, count(*) as n, countunique(customer) as customers'
+}
+run "agg groups" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "country,year,total,n,customers US,2020,30.00,2,2 CN,2021,5.00,2,2 US,2021,1.00,1,1"
+
+# all records in one row without groups
+fn() {
+    printf "$agg_data" | $app agg -i -e 'mean(sales) as avg, quantile(sales, 0.5) as p50, max(sales), first(customer), collapse(customer)'
+}
+run "agg all" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "avg,p50,max(sales),first(customer),collapse(customer) 9.00,7.50,20.00,a,a; b; a; a; c"
+
+# non-numeric values
+fn() {
+    printf "$agg_data" | $app agg -g country -e 'sum(sales)'
+}
+run "agg non-numeric" fn
+assert_exit_code 255
+assert_in_stderr "non-numeric value in sum(sales): NA"
+
+# values of multiple group fields never collide
+fn() {
+    printf 'a,b,v\na_shenwei356_b,c,1\na,b_shenwei356_c,2\n' | $app agg -g a,b -e 'sum(v)'
+}
+run "agg composite groups" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a,b,sum(v) a_shenwei356_b,c,1.00 a,b_shenwei356_c,2.00"
+
+
+# ----------------------------------------------------------------------------
+# csvtk window
+# ----------------------------------------------------------------------------
+
+# numeric values are ranked as numbers, non-numeric values get --na
+fn() {
+    printf 'id,g\n11,a\n2,a\nNA,a\n4,a\n1,a\n4,b\n' | $app window -g g --rank id --dense-rank 'id as dense' --na NA
+}
+run "window rank" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,g,id_rank,dense 11,a,4,4 2,a,2,2 NA,a,NA,NA 4,a,3,3 1,a,1,1 4,b,1,1"
+
+# strings
+fn() {
+    printf 'n\nb\na\nc\na\n' | $app window --rank n -r
+}
+run "window rank strings" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "n,n_rank b,2 a,3 c,1 a,3"
+
+# values of multiple group fields never collide
+fn() {
+    printf 'a,b,v\na_shenwei356_b,c,1\na,b_shenwei356_c,2\n' | $app window -g a,b --cumsum v
+}
+run "window composite groups" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a,b,v,v_cumsum a_shenwei356_b,c,1,1.00 a,b_shenwei356_c,2,2.00"
+
+
+
+# ----------------------------------------------------------------------------
+# csvtk diff
+# ----------------------------------------------------------------------------
+
+# values of multiple key fields never collide
+fn() {
+    $app diff -f a,b -m rows <(printf 'a,b,v\na_shenwei356_b,c,1\nx,y,2\n') <(printf 'a,b,v\na,b_shenwei356_c,1\nx,y,3\n')
+}
+run "diff composite keys" fn
+assert_exit_code 1
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "_diff,a,b,v removed,a_shenwei356_b,c,1 changed,x,y,3 added,a,b_shenwei356_c,1"
+
+fn() {
+    $app diff -f a,b -m cells <(printf 'a,b,v\nx,y,2\n') <(printf 'a,b,v\nx,y,3\n')
+}
+run "diff cells" fn
+assert_exit_code 1
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a,b,column,old,new x,y,v,2,3"
+
+# no differences
+fn() {
+    $app diff -f a <(printf 'a,b\n1,2\n') <(printf 'a,b\n1,2\n')
+}
+run "diff identical" fn
+assert_exit_code 0
+
+# duplicated keys are reported with the original values
+fn() {
+    $app diff -f a,b <(printf 'a,b,v\nx,y,1\nx,y,2\n') <(printf 'a,b,v\nx,y,3\n')
+}
+run "diff duplicated keys" fn
+assert_exit_code 255
+assert_in_stderr "duplicated key in the first file: x, y"
+
+
+# ----------------------------------------------------------------------------
+# csvtk validate
+# ----------------------------------------------------------------------------
+
+schema() {
+    printf 'fields:\n  - name: id\n    type: integer\n    constraints: {required: true, unique: true}\n  - name: score\n    type: number\n    constraints: {minimum: 0, maximum: 100}\n  - name: group\n    constraints: {enum: [A, B]}\nmissingValues: ["", "NA"]\n'
+}
+
+fn() {
+    printf 'id,score,group\n1,90,A\n2,NA,B\n' | $app validate -s <(schema)
+}
+run "validate valid file" fn
+assert_no_stderr
+assert_exit_code 0
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "row,column,value,error"
+
+fn() {
+    printf 'id,score,group\n1,190,A\n1,x,C\n,1,A\n' | $app validate -s <(schema)
+}
+run "validate invalid file" fn
+assert_exit_code 1
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "row,column,value,error 2,score,190,greater than maximum: 100 3,id,1,\"duplicated value of unique column, first seen in row 2\" 3,score,x,invalid number 3,group,C,not in enum 4,id,,missing value of required column"
+
+fn() {
+    printf 'id,score,group\n1,190,A\n1,x,C\n,1,A\n' | $app validate -s <(schema) -m 2
+}
+run "validate max errors" fn
+assert_exit_code 1
+assert_equal "$(cat $STDOUT_FILE | wc -l)" "3"
+
+fn() {
+    printf 'id\n1\n' | $app validate -s <(printf 'fields:\n  - name: id\n    type: integr\n')
+}
+run "validate invalid schema" fn
+assert_exit_code 255
+assert_in_stderr "unsupported type"
+
+
+# ----------------------------------------------------------------------------
+# csvtk dedup
+# ----------------------------------------------------------------------------
+
+fn() {
+    printf 'name,city\nJohn Smith,NY\n john smith ,NY\nJohn Smith,LA\n' | $app dedup -f name,city -n trim,casefold -k last
+}
+run "dedup normalize" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "name,city \" john smith \",NY John Smith,LA"
+
+fn() {
+    printf 'name,city\nJohn Smith,NY\nJon Smith,NY\nJohn Smith,LA\nMary,NY\n' | $app dedup --threshold name:0.8
+}
+run "dedup fuzzy" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "name,city John Smith,NY John Smith,LA Mary,NY"
+
+fn() {
+    printf 'name,city,tel\nJohn,NY,\nJohn,NY,123\n' | $app dedup -f name,city -k best
+}
+run "dedup best" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "name,city,tel John,NY,123"
+
+# values of multiple fields never collide
+fn() {
+    printf 'a,b,v\na_shenwei356_b,c,1\na,b_shenwei356_c,2\n' | $app dedup -f a,b
+}
+run "dedup composite keys" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a,b,v a_shenwei356_b,c,1 a,b_shenwei356_c,2"
+
+
+# ----------------------------------------------------------------------------
+# csvtk expand-dates
+# ----------------------------------------------------------------------------
+
+fn() {
+    printf 'date,g,v\n2020-01-03,a,1\n2020-01-01,a,2\n2020-01-02,b,3\n2020-01-04,b,4\n' | $app expand-dates -f date -g g --fill NA
+}
+run "expand-dates day" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "date,g,v 2020-01-01,a,2 2020-01-02,a,NA 2020-01-03,a,1 2020-01-02,b,3 2020-01-03,b,NA 2020-01-04,b,4"
+
+# months are stepped from the first date, clamped to the end of shorter months
+fn() {
+    printf 'date,v\n2020-01-31,1\n2020-03-31,2\n2020-05-15,3\n' | $app expand-dates -f date --freq month --fill 0
+}
+run "expand-dates month" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "date,v 2020-01-31,1 2020-02-29,0 2020-03-31,2 2020-04-30,0 2020-05-15,3"
+
+fn() {
+    printf 'month,v\n2024-02,1\n' | $app expand-dates -f month --freq month --fill 0 --start 2024-01 --end 2024-04
+}
+run "expand-dates month with start and end" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "month,v 2024-01,0 2024-02,1 2024-03,0 2024-04,0"
+
+
+# ----------------------------------------------------------------------------
+# csvtk crosscheck
+# ----------------------------------------------------------------------------
+
+fn() {
+    printf 'id,v\n1,a\n3,b\n,c\n' | $app crosscheck -f id -r <(printf 'id\n1\n2\n') -k id
+}
+run "crosscheck orphans" fn
+assert_exit_code 1
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "file,line,id -,3,3"
+
+fn() {
+    printf 'id,v\n1,a\n,c\n' | $app crosscheck -f id -r <(printf 'id\n1\n2\n') -k id
+}
+run "crosscheck no orphans" fn
+assert_exit_code 0
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "file,line,id"
+
+# values of multiple key fields never collide
+fn() {
+    printf 'a,b\na,b_shenwei356_c\nx,Y\n' | $app crosscheck -f a,b -r <(printf 'a,b\na_shenwei356_b,c\nX,y\n') -i
+}
+run "crosscheck composite keys" fn
+assert_exit_code 1
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "file,line,a,b -,2,a,b_shenwei356_c"
+
+
+# ----------------------------------------------------------------------------
+# csvtk exec
+# ----------------------------------------------------------------------------
+
+# values are quoted for the shell
+fn() {
+    printf 'v\n%s\n%s\n%s\n%s\n%s\n' "it's" 'a;echo INJ' '$(echo INJ)' '`echo INJ`' '"say ""hi"""' \
+        | $app exec -c 'printf %s {v}' -n out | $app cut -f out
+}
+run "exec quoting" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d '|')" "out|it's|a;echo INJ|\$(echo INJ)|\`echo INJ\`|\"say \"\"hi\"\"\""
+
+fn() {
+    printf 'v\nb\n' | $app exec -c 'echo a {v} c' --no-quote
+}
+run "exec no quote" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "v,output b,a b c"
+
+# non-zero exit codes
+fn() {
+    printf 'n\n0\n3\n' | $app exec -c 'echo hi; exit {n}'
+}
+run "exec fail" fn
+assert_exit_code 255
+assert_in_stderr "[line 3] command failed"
+
+fn() {
+    printf 'n\n0\n3\n' | $app exec -c 'echo hi; exit {n}' -e keep --exit-code-column code
+}
+run "exec keep" fn
+assert_exit_code 0
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "n,output,code 0,hi,0 3,hi,3"
+
+fn() {
+    printf 'n\n0\n3\n' | $app exec -c 'echo hi; exit {n}' -e skip
+}
+run "exec skip" fn
+assert_exit_code 0
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "n,output 0,hi"
+
+fn() {
+    printf 'n\n1\n' | $app exec -c 'sleep {n}' --timeout 100ms
+}
+run "exec timeout" fn
+assert_exit_code 255
+assert_in_stderr "timeout after 100ms"
+
+
+# ----------------------------------------------------------------------------
+# csvtk merge-sorted
+# ----------------------------------------------------------------------------
+
+fn() {
+    printf 'a,f\n1,x\n3,x\n10,x\n' | $app merge-sorted -k a:n - <(printf 'a,f\n2,y\n3,y\n')
+}
+run "merge-sorted" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a,f 1,x 2,y 3,x 3,y 10,x"
+
+fn() {
+    printf 'a\nb\na\n' | $app merge-sorted -k a:r -
+}
+run "merge-sorted reverse" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a b a"
+
+# records are compared with the previous ones of the same file
+fn() {
+    printf 'a\n1\n5\n3\n' | $app merge-sorted -k a:n - <(printf 'a\n2\n4\n')
+}
+run "merge-sorted unsorted input" fn
+assert_exit_code 0
+assert_in_stderr "file - is not sorted by the keys at line 4"
+
+fn() {
+    printf 'a\n1\n5\n3\n' | $app merge-sorted -k a:n -c - <(printf 'a\n2\n4\n')
+}
+run "merge-sorted check" fn
+assert_exit_code 255
+assert_in_stderr "file - is not sorted by the keys at line 4"
+
+
+# ----------------------------------------------------------------------------
+# csvtk lookup
+# ----------------------------------------------------------------------------
+
+fn() {
+    printf 'id,code\n1,CN\n2,de\n3,FR\n' | $app lookup -m code:<(printf 'code,country,continent\nCN,China,Asia\nDE,Germany,Europe\n') -i --default NA
+}
+run "lookup append" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,code,country,continent 1,CN,China,Asia 2,de,Germany,Europe 3,FR,NA,NA"
+
+fn() {
+    printf 'id,code\n1,CN\n2,FR\n' | $app lookup -m code:<(printf 'code,country\nCN,China\n') -R -k
+}
+run "lookup replace" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,code 1,China 2,FR"
+
+# values of multiple key fields never collide
+fn() {
+    printf 'a,b\na,b_shenwei356_c\na_shenwei356_b,c\n' | $app lookup -m a,b:<(printf 'a,b,v\na_shenwei356_b,c,1\n') --default NA
+}
+run "lookup composite keys" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "a,b,v a,b_shenwei356_c,NA a_shenwei356_b,c,1"
+
+# ----------------------------------------------------------------------------
+# csvtk repl
+# ----------------------------------------------------------------------------
+
+out=$(mktemp)
+
+fn() {
+    printf 'grep -f last_name -p Thompson\n:keep\nsort -k id:n\n:write %s\n' $out | $app repl testdata/names.csv > /dev/null
+    cat $out
+}
+run "repl keep and write" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,first_name,last_name,username 1,Robert,Thompson,abc 2,Ken,Thompson,ken"
+
+# a failed command does not stop the session
+fn() {
+    printf 'cut -f nope\nhead -n 1\n:write %s\n' $out | $app repl testdata/names.csv > /dev/null
+    cat $out
+}
+run "repl failed command" fn
+assert_in_stderr 'column "nope" not existed'
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,first_name,last_name,username 11,Rob,Pike,rob"
+
+fn() {
+    printf 'cut -f 2\n:keep\nuniq -f 1\n:write %s\n' $out | $app repl -H testdata/names.csv > /dev/null
+    cat $out
+}
+run "repl no header row" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "first_name Rob Ken Robert"
+
+rm $out
+
+
+# ----------------------------------------------------------------------------
+# csvtk pipeline
+# ----------------------------------------------------------------------------
+
+pipeline=$(mktemp)
+cat > $pipeline <<'YAML'
+steps:
+  - cmd: grep
+    flags:
+      fields: last_name
+      pattern: Thompson
+  - cmd: mutate2
+    flags:
+      name: id2
+      e: '$id * 2'
+      w: 0
+  - cmd: sort
+    flags:
+      keys: [id:n]
+YAML
+
+fn() {
+    $app pipeline -p $pipeline testdata/names.csv -T
+}
+run "pipeline" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "$(printf 'id\tfirst_name\tlast_name\tusername\tid2 1\tRobert\tThompson\tabc\t2 2\tKen\tThompson\tken\t4')"
+
+fn() {
+    $app pipeline -p $pipeline testdata/names.csv -T --print
+}
+run "pipeline print" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d '|')" "step 1: csvtk grep --fields last_name --pattern Thompson -- testdata/names.csv|step 2: csvtk mutate2 --name id2 -e '\$id * 2' -w 0|step 3: csvtk sort --keys id:n --out-tabs=true"
+
+fn() {
+    printf 'steps:\n  - cmd: cut\n    args: [-f, nope]\n  - cmd: head\n' > $pipeline
+    $app pipeline -p $pipeline testdata/names.csv
+}
+run "pipeline failed step" fn
+assert_exit_code 255
+assert_in_stderr 'column "nope" not existed'
+
+rm $pipeline
+
+
+# ----------------------------------------------------------------------------
+# csvtk filter2 aggregates
+# ----------------------------------------------------------------------------
+
+scores() { printf 'id,score\na,1\nb,2\nc,3\nd,100\ne,2\n'; }
+
+fn() {
+    scores | $app filter2 -f '$score > mean($score)'
+}
+run "filter2 aggregate" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,score d,100"
+
+# the first rows are buffered, so the estimate is exact for small inputs
+fn() {
+    scores | $app filter2 --approx -f '$score > mean($score)'
+}
+run "filter2 aggregate approx" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,score d,100"
+
+# rows after the first --approx-rows rows use running aggregates
+fn() {
+    scores | $app filter2 --approx --approx-rows 2 -f '$score > mean($score)'
+}
+run "filter2 aggregate approx running" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,score b,2 c,3 d,100"
+
+fn() {
+    scores | $app filter2 --approx -f '$score >= median($score) && lead($id) != ""'
+}
+run "filter2 aggregate approx with lead" fn
+assert_no_stderr
+assert_equal "$(cat $STDOUT_FILE | paste -s -d ' ')" "id,score b,2 c,3 d,100"
+
+
 # ----------------------------------------------------------------------------
 # csvtk xxx
 # ----------------------------------------------------------------------------